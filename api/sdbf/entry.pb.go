@@ -20,6 +20,63 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// RecordType 表示条目的记录类型
+type RecordType int32
+
+const (
+	// 未设置：旧版本（v1）写入的条目没有这个字段，类型由 tombstone 与 range_end 推导
+	RecordType_RECORD_TYPE_UNSPECIFIED RecordType = 0
+	// 普通的键值对
+	RecordType_RECORD_TYPE_VALUE RecordType = 1
+	// 单个 key 的删除标记
+	RecordType_RECORD_TYPE_DELETE RecordType = 2
+	// 范围删除标记，删除 [key, range_end) 区间
+	RecordType_RECORD_TYPE_RANGE_DELETE RecordType = 3
+)
+
+// Enum value maps for RecordType.
+var (
+	RecordType_name = map[int32]string{
+		0: "RECORD_TYPE_UNSPECIFIED",
+		1: "RECORD_TYPE_VALUE",
+		2: "RECORD_TYPE_DELETE",
+		3: "RECORD_TYPE_RANGE_DELETE",
+	}
+	RecordType_value = map[string]int32{
+		"RECORD_TYPE_UNSPECIFIED":  0,
+		"RECORD_TYPE_VALUE":        1,
+		"RECORD_TYPE_DELETE":       2,
+		"RECORD_TYPE_RANGE_DELETE": 3,
+	}
+)
+
+func (x RecordType) Enum() *RecordType {
+	p := new(RecordType)
+	*p = x
+	return p
+}
+
+func (x RecordType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (RecordType) Descriptor() protoreflect.EnumDescriptor {
+	return file_proto_sdbf_entry_proto_enumTypes[0].Descriptor()
+}
+
+func (RecordType) Type() protoreflect.EnumType {
+	return &file_proto_sdbf_entry_proto_enumTypes[0]
+}
+
+func (x RecordType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use RecordType.Descriptor instead.
+func (RecordType) EnumDescriptor() ([]byte, []int) {
+	return file_proto_sdbf_entry_proto_rawDescGZIP(), []int{0}
+}
+
 // Entry 表示数据库中的一个键值对条目
 type Entry struct {
 	state         protoimpl.MessageState
@@ -32,8 +89,22 @@ type Entry struct {
 	Value []byte `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
 	// 是否为删除标记（墓碑）
 	Tombstone bool `protobuf:"varint,3,opt,name=tombstone,proto3" json:"tombstone,omitempty"`
-	// 数据版本号
+	// 数据版本号：写入时由引擎分配的序列号，全库严格递增
 	Version int64 `protobuf:"varint,4,opt,name=version,proto3" json:"version,omitempty"`
+	// 过期时间（Unix 纳秒时间戳），0 表示永不过期
+	ExpireAt int64 `protobuf:"varint,5,opt,name=expire_at,json=expireAt,proto3" json:"expire_at,omitempty"`
+	// 所属的列族，空字符串表示默认列族
+	ColumnFamily string `protobuf:"bytes,6,opt,name=column_family,json=columnFamily,proto3" json:"column_family,omitempty"`
+	// 范围墓碑的结束 key（不含），非空时该条目是一个范围墓碑，删除 [key, range_end) 区间内
+	// 版本号更小的所有条目
+	RangeEnd string `protobuf:"bytes,7,opt,name=range_end,json=rangeEnd,proto3" json:"range_end,omitempty"`
+	// 条目的校验和（CRC32C），启用 Options.EntryChecksums 时写入时计算、读取时校验，0 表示没有校验和
+	Checksum uint32 `protobuf:"fixed32,8,opt,name=checksum,proto3" json:"checksum,omitempty"`
+	// 记录类型，写入时由引擎根据 tombstone 与 range_end 填写；读取时未设置的条目按 v1 格式推导，
+	// 无法识别的类型说明数据由更新版本的引擎写入，拒绝解码
+	RecordType RecordType `protobuf:"varint,9,opt,name=record_type,json=recordType,proto3,enum=sdbf.RecordType" json:"record_type,omitempty"`
+	// 用户自定义的元数据（如内容类型、schema 版本），引擎原样保存，不参与读写逻辑
+	UserMeta []byte `protobuf:"bytes,10,opt,name=user_meta,json=userMeta,proto3" json:"user_meta,omitempty"`
 }
 
 func (x *Entry) Reset() {
@@ -96,21 +167,84 @@ func (x *Entry) GetVersion() int64 {
 	return 0
 }
 
+func (x *Entry) GetExpireAt() int64 {
+	if x != nil {
+		return x.ExpireAt
+	}
+	return 0
+}
+
+func (x *Entry) GetColumnFamily() string {
+	if x != nil {
+		return x.ColumnFamily
+	}
+	return ""
+}
+
+func (x *Entry) GetRangeEnd() string {
+	if x != nil {
+		return x.RangeEnd
+	}
+	return ""
+}
+
+func (x *Entry) GetChecksum() uint32 {
+	if x != nil {
+		return x.Checksum
+	}
+	return 0
+}
+
+func (x *Entry) GetRecordType() RecordType {
+	if x != nil {
+		return x.RecordType
+	}
+	return RecordType_RECORD_TYPE_UNSPECIFIED
+}
+
+func (x *Entry) GetUserMeta() []byte {
+	if x != nil {
+		return x.UserMeta
+	}
+	return nil
+}
+
 var File_proto_sdbf_entry_proto protoreflect.FileDescriptor
 
 var file_proto_sdbf_entry_proto_rawDesc = []byte{
 	0x0a, 0x16, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x2f, 0x73, 0x64, 0x62, 0x66, 0x2f, 0x65, 0x6e, 0x74,
-	0x72, 0x79, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x04, 0x73, 0x64, 0x62, 0x66, 0x22, 0x67,
-	0x0a, 0x05, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c,
-	0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x12,
-	0x1c, 0x0a, 0x09, 0x74, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x18, 0x03, 0x20, 0x01,
-	0x28, 0x08, 0x52, 0x09, 0x74, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x12, 0x18, 0x0a,
-	0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07,
-	0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x42, 0x2e, 0x5a, 0x2c, 0x67, 0x69, 0x74, 0x68, 0x75,
-	0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x69, 0x72, 0x65, 0x65, 0x74, 0x2f, 0x53, 0x69, 0x6d,
-	0x70, 0x6c, 0x65, 0x44, 0x42, 0x46, 0x6f, 0x72, 0x67, 0x65, 0x2f, 0x6c, 0x73, 0x6d, 0x2f, 0x70,
-	0x6b, 0x67, 0x2f, 0x73, 0x64, 0x62, 0x66, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x72, 0x79, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x04, 0x73, 0x64, 0x62, 0x66, 0x22, 0xb2,
+	0x02, 0x0a, 0x05, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61,
+	0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65,
+	0x12, 0x1c, 0x0a, 0x09, 0x74, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x08, 0x52, 0x09, 0x74, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x12, 0x18,
+	0x0a, 0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x07, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x1b, 0x0a, 0x09, 0x65, 0x78, 0x70, 0x69,
+	0x72, 0x65, 0x5f, 0x61, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x08, 0x65, 0x78, 0x70,
+	0x69, 0x72, 0x65, 0x41, 0x74, 0x12, 0x23, 0x0a, 0x0d, 0x63, 0x6f, 0x6c, 0x75, 0x6d, 0x6e, 0x5f,
+	0x66, 0x61, 0x6d, 0x69, 0x6c, 0x79, 0x18, 0x06, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x63, 0x6f,
+	0x6c, 0x75, 0x6d, 0x6e, 0x46, 0x61, 0x6d, 0x69, 0x6c, 0x79, 0x12, 0x1b, 0x0a, 0x09, 0x72, 0x61,
+	0x6e, 0x67, 0x65, 0x5f, 0x65, 0x6e, 0x64, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72,
+	0x61, 0x6e, 0x67, 0x65, 0x45, 0x6e, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x63, 0x68, 0x65, 0x63, 0x6b,
+	0x73, 0x75, 0x6d, 0x18, 0x08, 0x20, 0x01, 0x28, 0x07, 0x52, 0x08, 0x63, 0x68, 0x65, 0x63, 0x6b,
+	0x73, 0x75, 0x6d, 0x12, 0x31, 0x0a, 0x0b, 0x72, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x5f, 0x74, 0x79,
+	0x70, 0x65, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x10, 0x2e, 0x73, 0x64, 0x62, 0x66, 0x2e,
+	0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x54, 0x79, 0x70, 0x65, 0x52, 0x0a, 0x72, 0x65, 0x63, 0x6f,
+	0x72, 0x64, 0x54, 0x79, 0x70, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x6d,
+	0x65, 0x74, 0x61, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x75, 0x73, 0x65, 0x72, 0x4d,
+	0x65, 0x74, 0x61, 0x2a, 0x76, 0x0a, 0x0a, 0x52, 0x65, 0x63, 0x6f, 0x72, 0x64, 0x54, 0x79, 0x70,
+	0x65, 0x12, 0x1b, 0x0a, 0x17, 0x52, 0x45, 0x43, 0x4f, 0x52, 0x44, 0x5f, 0x54, 0x59, 0x50, 0x45,
+	0x5f, 0x55, 0x4e, 0x53, 0x50, 0x45, 0x43, 0x49, 0x46, 0x49, 0x45, 0x44, 0x10, 0x00, 0x12, 0x15,
+	0x0a, 0x11, 0x52, 0x45, 0x43, 0x4f, 0x52, 0x44, 0x5f, 0x54, 0x59, 0x50, 0x45, 0x5f, 0x56, 0x41,
+	0x4c, 0x55, 0x45, 0x10, 0x01, 0x12, 0x16, 0x0a, 0x12, 0x52, 0x45, 0x43, 0x4f, 0x52, 0x44, 0x5f,
+	0x54, 0x59, 0x50, 0x45, 0x5f, 0x44, 0x45, 0x4c, 0x45, 0x54, 0x45, 0x10, 0x02, 0x12, 0x1c, 0x0a,
+	0x18, 0x52, 0x45, 0x43, 0x4f, 0x52, 0x44, 0x5f, 0x54, 0x59, 0x50, 0x45, 0x5f, 0x52, 0x41, 0x4e,
+	0x47, 0x45, 0x5f, 0x44, 0x45, 0x4c, 0x45, 0x54, 0x45, 0x10, 0x03, 0x42, 0x2e, 0x5a, 0x2c, 0x67,
+	0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x69, 0x72, 0x65, 0x65, 0x74,
+	0x2f, 0x53, 0x69, 0x6d, 0x70, 0x6c, 0x65, 0x44, 0x42, 0x46, 0x6f, 0x72, 0x67, 0x65, 0x2f, 0x6c,
+	0x73, 0x6d, 0x2f, 0x70, 0x6b, 0x67, 0x2f, 0x73, 0x64, 0x62, 0x66, 0x62, 0x06, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x33,
 }
 
 var (
@@ -125,16 +259,19 @@ func file_proto_sdbf_entry_proto_rawDescGZIP() []byte {
 	return file_proto_sdbf_entry_proto_rawDescData
 }
 
+var file_proto_sdbf_entry_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
 var file_proto_sdbf_entry_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
 var file_proto_sdbf_entry_proto_goTypes = []interface{}{
-	(*Entry)(nil), // 0: sdbf.Entry
+	(RecordType)(0), // 0: sdbf.RecordType
+	(*Entry)(nil),   // 1: sdbf.Entry
 }
 var file_proto_sdbf_entry_proto_depIdxs = []int32{
-	0, // [0:0] is the sub-list for method output_type
-	0, // [0:0] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0, // 0: sdbf.Entry.record_type:type_name -> sdbf.RecordType
+	1, // [1:1] is the sub-list for method output_type
+	1, // [1:1] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
 }
 
 func init() { file_proto_sdbf_entry_proto_init() }
@@ -161,13 +298,14 @@ func file_proto_sdbf_entry_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_proto_sdbf_entry_proto_rawDesc,
-			NumEnums:      0,
+			NumEnums:      1,
 			NumMessages:   1,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
 		GoTypes:           file_proto_sdbf_entry_proto_goTypes,
 		DependencyIndexes: file_proto_sdbf_entry_proto_depIdxs,
+		EnumInfos:         file_proto_sdbf_entry_proto_enumTypes,
 		MessageInfos:      file_proto_sdbf_entry_proto_msgTypes,
 	}.Build()
 	File_proto_sdbf_entry_proto = out.File
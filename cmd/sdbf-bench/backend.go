@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+	"github.com/aireet/SimpleDBForge/pkg/client"
+)
+
+// backend 是压测的对象：嵌入式的 lsm.DB 或通过 HTTP 网关访问的 sdbf-server
+type backend interface {
+	// Get 读取 key，不存在时 found 为 false 而不是返回错误
+	Get(key string) (found bool, err error)
+	Set(key string, value []byte) error
+	// Scan 从 start 开始读取最多 limit 条记录，返回读到的条数
+	Scan(start string, limit int) (int, error)
+	Close() error
+}
+
+// scanEnd 扫描的上界，大于所有 formatKey 生成的 key
+const scanEnd = keyPrefix + "~"
+
+// embeddedBackend 在进程内直接打开数据库
+type embeddedBackend struct {
+	db *lsm.DB
+}
+
+func openEmbedded(dir string, opts lsm.Options) (*embeddedBackend, error) {
+	db, err := lsm.Open(dir, opts)
+	if err != nil {
+		return nil, fmt.Errorf("open embedded backend: %w", err)
+	}
+	return &embeddedBackend{db: db}, nil
+}
+
+func (b *embeddedBackend) Get(key string) (bool, error) {
+	_, err := b.db.Get(key)
+	if errors.Is(err, lsm.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *embeddedBackend) Set(key string, value []byte) error { return b.db.Set(key, value) }
+func (b *embeddedBackend) Close() error                       { return b.db.Close() }
+
+func (b *embeddedBackend) Scan(start string, limit int) (int, error) {
+	entries, _, err := b.db.ScanPage(start, scanEnd, limit)
+	return len(entries), err
+}
+
+// remoteBackend 通过 pkg/client 访问 sdbf-server 的 HTTP 网关
+type remoteBackend struct {
+	c *client.Client
+}
+
+func openRemote(addr string, opts client.Options) *remoteBackend {
+	return &remoteBackend{c: client.New(addr, opts)}
+}
+
+func (b *remoteBackend) Get(key string) (bool, error) {
+	_, err := b.c.Get(context.Background(), key)
+	if errors.Is(err, lsm.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *remoteBackend) Set(key string, value []byte) error {
+	return b.c.Set(context.Background(), key, value)
+}
+
+func (b *remoteBackend) Scan(start string, limit int) (int, error) {
+	entries, _, err := b.c.ScanPage(context.Background(), start, scanEnd, limit)
+	return len(entries), err
+}
+
+func (b *remoteBackend) Close() error { return b.c.Close() }
@@ -0,0 +1,123 @@
+// sdbf-bench 对 SimpleDBForge 运行压测负载，输出吞吐与延迟分位数
+//
+// 用法：
+//
+//	sdbf-bench -workloads fillseq,readrandom,ycsba -num 1000000 -threads 8
+//	sdbf-bench -dir ./bench-data -sync every -workloads fillrandom
+//	sdbf-bench -addr localhost:8080 -workloads fillseq,ycsbb    # 压测运行中的 sdbf-server
+//
+// 默认在纯内存数据库上运行；-dir 指定数据目录时在磁盘上运行，-addr 指定时通过 HTTP 网关压测服务端。
+// 负载按给定的顺序在同一个数据库上依次执行，读类负载（readrandom、scan、ycsb*）应在 fill* 之后运行
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+	"github.com/aireet/SimpleDBForge/pkg/client"
+)
+
+func main() {
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintln(out, "用法: sdbf-bench [-dir DIR | -addr HOST:PORT] [flags]\n\n负载:")
+		for _, wl := range workloads {
+			fmt.Fprintf(out, "  %-12s %s\n", wl.name, wl.desc)
+		}
+		fmt.Fprintln(out)
+		flag.PrintDefaults()
+	}
+	dir := flag.String("dir", "", "数据目录，为空时使用纯内存数据库")
+	addr := flag.String("addr", "", "sdbf-server 的 HTTP 网关地址，指定时压测服务端而不是嵌入式数据库")
+	token := flag.String("token", "", "服务端启用认证时使用的 token")
+	list := flag.String("workloads", "fillseq,readrandom", "逗号分隔的负载，按顺序执行")
+	num := flag.Int("num", 100000, "每个负载执行的操作数")
+	keys := flag.Int("keys", 0, "key 的个数，默认等于 -num")
+	valueSize := flag.Int("value-size", 100, "value 的长度（字节）")
+	threads := flag.Int("threads", 1, "并发数")
+	scanLen := flag.Int("scan-len", 100, "每次扫描读取的条数（ycsbe 为最大条数）")
+	seed := flag.Uint64("seed", uint64(time.Now().UnixNano()), "随机数种子")
+	syncMode := flag.String("sync", "none", "嵌入式数据库的 WAL fsync 策略：every、periodic 或 none")
+	flag.Parse()
+
+	cfg := config{num: *num, keys: *keys, valueSize: *valueSize, threads: *threads, scanLen: *scanLen, seed: *seed}
+	if cfg.keys <= 0 {
+		cfg.keys = cfg.num
+	}
+	if err := run(*dir, *addr, *token, *syncMode, strings.Split(*list, ","), cfg, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, addr, token, syncMode string, names []string, cfg config, out io.Writer) error {
+	if cfg.num <= 0 || cfg.keys <= 0 || cfg.valueSize < 0 || cfg.threads <= 0 || cfg.scanLen <= 0 {
+		return errors.New("-num, -keys, -threads and -scan-len must be positive, -value-size must not be negative")
+	}
+	var selected []workload
+	for _, name := range names {
+		wl, ok := findWorkload(strings.TrimSpace(name))
+		if !ok {
+			return fmt.Errorf("unknown workload %q", name)
+		}
+		selected = append(selected, wl)
+	}
+
+	b, desc, err := openBackend(dir, addr, token, syncMode)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	fmt.Fprintf(out, "backend:   %s\nkeys:      %d (%d bytes each)\nvalues:    %d bytes\nthreads:   %d\nseed:      %d\n",
+		desc, cfg.keys, len(formatKey(0)), cfg.valueSize, cfg.threads, cfg.seed)
+	fmt.Fprintln(out, strings.Repeat("-", 60))
+
+	st := &state{}
+	st.inserted.Store(uint64(cfg.keys))
+	for _, wl := range selected {
+		res, err := runWorkload(b, cfg, st, wl)
+		if err != nil {
+			return err
+		}
+		res.print(out)
+	}
+	return nil
+}
+
+// openBackend 按参数打开压测对象，返回用于输出的描述
+func openBackend(dir, addr, token, syncMode string) (backend, string, error) {
+	if addr != "" {
+		if dir != "" {
+			return nil, "", errors.New("-dir and -addr are mutually exclusive")
+		}
+		return openRemote(addr, client.Options{Token: token}), "server " + addr, nil
+	}
+
+	opts := lsm.DefaultOptions()
+	switch syncMode {
+	case "every":
+		opts.SyncMode = lsm.SyncEveryWrite
+	case "periodic":
+		opts.SyncMode = lsm.SyncPeriodic
+	case "none":
+		opts.SyncMode = lsm.NoSync
+	default:
+		return nil, "", fmt.Errorf("invalid -sync %q, want every, periodic or none", syncMode)
+	}
+	desc := fmt.Sprintf("embedded %s (%s)", dir, opts.SyncMode)
+	if dir == "" {
+		dir, desc = lsm.InMemory, "embedded in-memory"
+	}
+	b, err := openEmbedded(dir, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	return b, desc, nil
+}
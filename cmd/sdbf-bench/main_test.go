@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+	"github.com/aireet/SimpleDBForge/internal/server"
+)
+
+func TestRun(t *testing.T) {
+	var names []string
+	for _, wl := range workloads {
+		names = append(names, wl.name)
+	}
+	cfg := config{num: 500, keys: 200, valueSize: 16, threads: 4, scanLen: 10, seed: 1}
+
+	db, err := lsm.Open(lsm.InMemory, lsm.DefaultOptions())
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	ts := httptest.NewServer(server.NewHTTPServer(db).Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		dir  string
+		addr string
+	}{
+		{name: "内存"},
+		{name: "磁盘", dir: t.TempDir()},
+		{name: "服务端", addr: ts.URL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := run(tt.dir, tt.addr, "", "none", names, cfg, &out); err != nil {
+				t.Fatalf("压测失败: %v", err)
+			}
+			for _, name := range names {
+				if !strings.Contains(out.String(), name+" ") {
+					t.Fatalf("输出中缺少 %s:\n%s", name, out.String())
+				}
+			}
+			// fillseq 写入了所有 key，之后的均匀读取全部命中
+			if !strings.Contains(out.String(), "(500 of 500 reads found)") {
+				t.Fatalf("readrandom 期望全部命中:\n%s", out.String())
+			}
+		})
+	}
+
+	for _, bad := range []struct {
+		names []string
+		cfg   config
+		sync  string
+	}{
+		{names: []string{"nope"}, cfg: cfg, sync: "none"},
+		{names: []string{"fillseq"}, cfg: config{num: 1, keys: 1}, sync: "none"},
+		{names: []string{"fillseq"}, cfg: cfg, sync: "sometimes"},
+	} {
+		if err := run("", "", "", bad.sync, bad.names, bad.cfg, &bytes.Buffer{}); err == nil {
+			t.Fatalf("%v %+v %s 期望出错", bad.names, bad.cfg, bad.sync)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// keyPrefix 所有 key 的前缀，formatKey 生成定长的 key，字典序与编号的大小顺序一致
+const keyPrefix = "user"
+
+func formatKey(i uint64) string {
+	return fmt.Sprintf("%s%016d", keyPrefix, i)
+}
+
+// config 压测参数
+type config struct {
+	// num 每个负载执行的操作数
+	num int
+	// keys 预先写入（fill*）与读取时选择的 key 的个数
+	keys int
+	// valueSize 写入的 value 长度（字节）
+	valueSize int
+	// threads 并发执行操作的 goroutine 数
+	threads int
+	// scanLen 每次扫描读取的条数
+	scanLen int
+	// seed 随机数种子，相同的种子生成相同的 key 序列（并发时各 goroutine 之间的交错除外）
+	seed uint64
+}
+
+// outcome 一个操作的类型与结果
+type outcome int
+
+const (
+	write outcome = iota
+	// hit 与 miss 读操作（包括扫描）读到或没有读到数据
+	hit
+	miss
+)
+
+func readOutcome(found bool, err error) (outcome, error) {
+	if found {
+		return hit, err
+	}
+	return miss, err
+}
+
+// workload 一种负载，op 执行第 i 个操作（从 0 开始）
+type workload struct {
+	name string
+	desc string
+	op   func(w *worker, i int) (outcome, error)
+}
+
+// zipfS Zipf 分布的参数，math/rand 要求大于 1，YCSB 默认的 0.99 取不到，用接近的值代替
+const zipfS = 1.01
+
+// workloads 支持的负载，YCSB A-F 的比例与官方定义一致，key 按 Zipf 分布选择（D 为最近写入的优先）
+var workloads = []workload{
+	{name: "fillseq", desc: "按顺序写入 key", op: func(w *worker, i int) (outcome, error) {
+		return write, w.set(uint64(i % w.cfg.keys))
+	}},
+	{name: "fillrandom", desc: "随机写入 key", op: func(w *worker, i int) (outcome, error) {
+		return write, w.set(w.uniform())
+	}},
+	{name: "readrandom", desc: "随机读取 key", op: func(w *worker, i int) (outcome, error) {
+		return readOutcome(w.b.Get(formatKey(w.uniform())))
+	}},
+	{name: "scan", desc: "从随机的 key 开始扫描 -scan-len 条", op: func(w *worker, i int) (outcome, error) {
+		n, err := w.b.Scan(formatKey(w.uniform()), w.cfg.scanLen)
+		return readOutcome(n > 0, err)
+	}},
+	{name: "ycsba", desc: "50% 读 50% 更新", op: func(w *worker, i int) (outcome, error) {
+		if w.rng.IntN(100) < 50 {
+			return readOutcome(w.b.Get(formatKey(w.zipfian())))
+		}
+		return write, w.set(w.zipfian())
+	}},
+	{name: "ycsbb", desc: "95% 读 5% 更新", op: func(w *worker, i int) (outcome, error) {
+		if w.rng.IntN(100) < 95 {
+			return readOutcome(w.b.Get(formatKey(w.zipfian())))
+		}
+		return write, w.set(w.zipfian())
+	}},
+	{name: "ycsbc", desc: "100% 读", op: func(w *worker, i int) (outcome, error) {
+		return readOutcome(w.b.Get(formatKey(w.zipfian())))
+	}},
+	{name: "ycsbd", desc: "95% 读最近插入的 key 5% 插入新 key", op: func(w *worker, i int) (outcome, error) {
+		if w.rng.IntN(100) < 95 {
+			return readOutcome(w.b.Get(formatKey(w.latest())))
+		}
+		return write, w.insert()
+	}},
+	{name: "ycsbe", desc: "95% 短扫描 5% 插入新 key", op: func(w *worker, i int) (outcome, error) {
+		if w.rng.IntN(100) < 95 {
+			n, err := w.b.Scan(formatKey(w.zipfian()), 1+w.rng.IntN(w.cfg.scanLen))
+			return readOutcome(n > 0, err)
+		}
+		return write, w.insert()
+	}},
+	{name: "ycsbf", desc: "50% 读 50% 读-改-写", op: func(w *worker, i int) (outcome, error) {
+		key := w.zipfian()
+		o, err := readOutcome(w.b.Get(formatKey(key)))
+		if err != nil || w.rng.IntN(100) < 50 {
+			return o, err
+		}
+		// 读-改-写计为一次操作，延迟包含读与写
+		return o, w.set(key)
+	}},
+}
+
+func findWorkload(name string) (workload, bool) {
+	i := slices.IndexFunc(workloads, func(w workload) bool { return w.name == name })
+	if i < 0 {
+		return workload{}, false
+	}
+	return workloads[i], true
+}
+
+// state 同一次运行的多个负载之间共享的状态
+type state struct {
+	// inserted 已插入的 key 的个数：key [0, keys) 由 fill* 写入，之后的 key 由 ycsbd/ycsbe 插入
+	inserted atomic.Uint64
+}
+
+// worker 一个执行操作的 goroutine 的状态，rng 与 zipf 不是并发安全的，每个 worker 各有一份
+type worker struct {
+	b     backend
+	cfg   config
+	st    *state
+	rng   *rand.Rand
+	zipf  *rand.Zipf
+	value []byte
+	// latencies 每个操作的耗时，hits 与 misses 读到与没有读到数据的读操作数
+	latencies    []time.Duration
+	hits, misses int
+}
+
+func newWorker(b backend, cfg config, st *state, id int) *worker {
+	rng := rand.New(rand.NewPCG(cfg.seed, uint64(id)))
+	// 一段比 value 长的随机数据，每次写入从中截取不同的位置
+	value := make([]byte, 2*cfg.valueSize+1)
+	for i := range value {
+		value[i] = byte(rng.Uint32())
+	}
+	return &worker{
+		b:     b,
+		cfg:   cfg,
+		st:    st,
+		rng:   rng,
+		zipf:  rand.NewZipf(rng, zipfS, 1, uint64(cfg.keys-1)),
+		value: value,
+	}
+}
+
+func (w *worker) uniform() uint64 {
+	return w.rng.Uint64N(uint64(w.cfg.keys))
+}
+
+// zipfian 按 Zipf 分布选择 key，并把热点打散到整个 key 空间，避免热点集中在 key 空间的开头
+func (w *worker) zipfian() uint64 {
+	return w.zipf.Uint64() * 0x9E3779B97F4A7C15 % uint64(w.cfg.keys)
+}
+
+// latest 按 Zipf 分布选择最近插入的 key；其他 worker 刚分配、还没写完的 key 可能读不到
+func (w *worker) latest() uint64 {
+	n := w.st.inserted.Load()
+	return n - 1 - min(w.zipf.Uint64(), n-1)
+}
+
+func (w *worker) insert() error {
+	return w.set(w.st.inserted.Add(1) - 1)
+}
+
+// set 写入一个新分配的 value：引擎持有传入的切片，各次写入不能共享底层数组
+func (w *worker) set(key uint64) error {
+	off := w.rng.IntN(w.cfg.valueSize + 1)
+	value := make([]byte, w.cfg.valueSize)
+	copy(value, w.value[off:])
+	return w.b.Set(formatKey(key), value)
+}
+
+// result 一个负载的执行结果
+type result struct {
+	name         string
+	ops          int
+	hits, misses int
+	elapsed      time.Duration
+	// latencies 升序排列
+	latencies []time.Duration
+	bytes     int64
+}
+
+// runWorkload 用 cfg.threads 个 goroutine 执行 cfg.num 个操作，遇到错误时停止并返回第一个错误
+func runWorkload(b backend, cfg config, st *state, wl workload) (result, error) {
+	var (
+		next     atomic.Int64
+		firstErr error
+		errOnce  sync.Once
+		wg       sync.WaitGroup
+	)
+	workers := make([]*worker, cfg.threads)
+	for id := range workers {
+		workers[id] = newWorker(b, cfg, st, id)
+	}
+
+	start := time.Now()
+	for _, w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.latencies = make([]time.Duration, 0, cfg.num/cfg.threads+1)
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= cfg.num {
+					return
+				}
+				t := time.Now()
+				o, err := wl.op(w, i)
+				w.latencies = append(w.latencies, time.Since(t))
+				if err != nil {
+					errOnce.Do(func() { firstErr = fmt.Errorf("%s: op %d: %w", wl.name, i, err) })
+					// 让其他 worker 尽快停止
+					next.Store(int64(cfg.num))
+					return
+				}
+				switch o {
+				case hit:
+					w.hits++
+				case miss:
+					w.misses++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return result{}, firstErr
+	}
+
+	res := result{name: wl.name, elapsed: time.Since(start)}
+	for _, w := range workers {
+		res.latencies = append(res.latencies, w.latencies...)
+		res.hits += w.hits
+		res.misses += w.misses
+	}
+	slices.Sort(res.latencies)
+	res.ops = len(res.latencies)
+	res.bytes = int64(res.ops) * int64(cfg.valueSize+len(formatKey(0)))
+	return res, nil
+}
+
+// percentile 返回升序排列的 latencies 中第 p 百分位的值
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	i := int(p / 100 * float64(len(latencies)-1))
+	return latencies[i]
+}
+
+// print 以一行输出结果，格式参考 LevelDB/RocksDB 的 db_bench
+func (r result) print(out io.Writer) {
+	secs := r.elapsed.Seconds()
+	fmt.Fprintf(out, "%-10s : %10.3f µs/op %10.0f ops/s %8.1f MB/s  p50 %v  p95 %v  p99 %v  p99.9 %v  max %v",
+		r.name,
+		secs*1e6/float64(max(r.ops, 1)),
+		float64(r.ops)/secs,
+		float64(r.bytes)/secs/(1<<20),
+		percentile(r.latencies, 50),
+		percentile(r.latencies, 95),
+		percentile(r.latencies, 99),
+		percentile(r.latencies, 99.9),
+		percentile(r.latencies, 100),
+	)
+	if reads := r.hits + r.misses; reads > 0 {
+		fmt.Fprintf(out, "  (%d of %d reads found)", r.hits, reads)
+	}
+	fmt.Fprintln(out)
+}
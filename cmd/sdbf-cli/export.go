@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+)
+
+// exportData 把本地数据目录 dir 中的键值对导出到 file，file 为空或 "-" 时写到 out
+//
+//	sdbf-cli -dir ./data export -format csv dump.csv
+func exportData(dir string, args []string, keys lsm.KeyProvider, out io.Writer) error {
+	format, file, err := parseTransferArgs("export", dir, args)
+	if err != nil {
+		return err
+	}
+	st, err := openLocalStore(dir, keys)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	if file == "-" {
+		_, err := st.db.Export(out, format)
+		return err
+	}
+	fd, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	n, err := st.db.Export(fd, format)
+	if cerr := fd.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("export: %w", cerr)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "exported %d keys to %s\n", n, file)
+	return nil
+}
+
+// importData 把 file 中的键值对导入本地数据目录 dir，file 为空或 "-" 时从 in 读取
+//
+//	sdbf-cli -dir ./data import -format csv dump.csv
+func importData(dir string, args []string, keys lsm.KeyProvider, in io.Reader, out io.Writer) error {
+	format, file, err := parseTransferArgs("import", dir, args)
+	if err != nil {
+		return err
+	}
+	st, err := openLocalStore(dir, keys)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	r := in
+	if file != "-" {
+		fd, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("import: %w", err)
+		}
+		defer fd.Close()
+		r = fd
+	}
+	n, err := st.db.Import(r, format)
+	fmt.Fprintf(out, "imported %d keys\n", n)
+	return err
+}
+
+// parseTransferArgs 解析 export 与 import 共同的参数 [-format jsonl|csv] [file]
+func parseTransferArgs(cmd, dir string, args []string) (lsm.ExportFormat, string, error) {
+	fset := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fset.SetOutput(io.Discard)
+	name := fset.String("format", "jsonl", "文件格式：jsonl 或 csv")
+	if err := fset.Parse(args); err != nil {
+		return 0, "", fmt.Errorf("%s: %w", cmd, err)
+	}
+	if dir == "" || fset.NArg() > 1 {
+		return 0, "", fmt.Errorf("usage: sdbf-cli -dir DIR %s [-format jsonl|csv] [file]", cmd)
+	}
+	format, err := lsm.ParseExportFormat(*name)
+	if err != nil {
+		return 0, "", fmt.Errorf("%s: %w", cmd, err)
+	}
+	file := fset.Arg(0)
+	if file == "" {
+		file = "-"
+	}
+	return format, file, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	src := t.TempDir()
+	st, err := openLocalStore(src, nil)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	for _, k := range []string{"a", "b"} {
+		if err := st.Put(k, []byte(k+"-value")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	st.Close()
+
+	file := filepath.Join(t.TempDir(), "dump.csv")
+	var out strings.Builder
+	if err := exportData(src, []string{"-format", "csv", file}, nil, &out); err != nil {
+		t.Fatalf("export 失败: %v", err)
+	}
+	if out.String() != "exported 2 keys to "+file+"\n" {
+		t.Fatalf("输出不正确: %q", out.String())
+	}
+
+	dst := t.TempDir()
+	out.Reset()
+	if err := importData(dst, []string{"-format=csv", file}, nil, nil, &out); err != nil {
+		t.Fatalf("import 失败: %v", err)
+	}
+	if out.String() != "imported 2 keys\n" {
+		t.Fatalf("输出不正确: %q", out.String())
+	}
+
+	// 不指定文件时 jsonl 写到标准输出，并从标准输入读取
+	out.Reset()
+	if err := exportData(dst, nil, nil, &out); err != nil {
+		t.Fatalf("export 失败: %v", err)
+	}
+	want := `{"key":"a","value":"a-value"}` + "\n" + `{"key":"b","value":"b-value"}` + "\n"
+	if out.String() != want {
+		t.Fatalf("期望 %q, 实际 %q", want, out.String())
+	}
+	var imported strings.Builder
+	if err := importData(t.TempDir(), nil, nil, strings.NewReader(want), &imported); err != nil || imported.String() != "imported 2 keys\n" {
+		t.Fatalf("从标准输入导入失败: %q, err=%v", imported.String(), err)
+	}
+
+	for _, args := range [][]string{{"-format", "xml"}, {"a", "b"}} {
+		if err := exportData(src, args, nil, &out); err == nil {
+			t.Fatalf("参数 %v 期望报错", args)
+		}
+	}
+	if err := importData("", nil, nil, nil, &out); err == nil {
+		t.Fatal("缺少 -dir 时期望报错")
+	}
+}
@@ -0,0 +1,228 @@
+// sdbf-cli 是 SimpleDBForge 的命令行工具，可以直接打开本地数据目录，
+// 也可以通过 HTTP 网关连接运行中的 sdbf-server
+//
+// 用法：
+//
+//	sdbf-cli -dir ./data put k v
+//	sdbf-cli -addr localhost:8080 get k
+//	sdbf-cli -dir ./data            # 不带命令时进入交互模式
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+const usage = `用法: sdbf-cli [-dir DIR | -addr HOST:PORT [-token TOKEN]] [-key-file FILE] <command> [args]
+
+命令:
+  get <key>                       输出 key 的值
+  put <key> <value>               写入键值对
+  delete <key>                    删除 key
+  scan [start] [end] [limit]      按序输出 [start, end] 区间内的键值对
+  stats                           输出统计信息
+  compact                         触发合并
+  wal-dump <file>                 逐条解码 WAL 段文件并报告损坏位置（无需 -dir/-addr）
+  restore [-wal DIR] [-seq N] <dst> <backup>...
+                                  从全量备份及其增量备份恢复到新目录，可继续回放 WAL 归档（无需 -dir/-addr）
+  reencrypt-wal                   用密钥文件中的当前密钥重新加密本地数据目录的 WAL（需要 -dir 与 -key-file）
+  export [-format jsonl|csv] [file]
+                                  把本地数据目录中的键值对导出为 JSON Lines 或 CSV，默认写到标准输出（需要 -dir）
+  import [-format jsonl|csv] [file]
+                                  导入 export 格式的键值对，默认从标准输入读取（需要 -dir）
+  verify                          离线检查本地数据目录的一致性并给出修复建议（需要 -dir，数据库不能被打开）
+
+不带命令时从标准输入逐行读取命令（交互模式），输入 quit 退出
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	dir := flag.String("dir", "", "本地数据目录")
+	addr := flag.String("addr", "", "sdbf-server 的 HTTP 网关地址")
+	token := flag.String("token", "", "服务端启用认证时使用的 token")
+	keyFile := flag.String("key-file", "", "加密密钥文件（格式见 lsm.ReadKeyFile），用于加密的本地数据目录、wal-dump、restore、reencrypt-wal、verify、export 与 import")
+	flag.Parse()
+
+	if err := run(*dir, *addr, *token, *keyFile, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, addr, token, keyFile string, args []string) error {
+	var keys lsm.KeyProvider
+	if keyFile != "" {
+		key, err := lsm.ReadKeyFile(vfs.OSFS{}, keyFile)
+		if err != nil {
+			return err
+		}
+		keys = key
+	}
+
+	// wal-dump、restore、reencrypt-wal、verify、export 与 import 直接读写文件，不需要连接服务
+	if len(args) > 0 {
+		switch args[0] {
+		case "wal-dump":
+			return walDump(args[1:], keys, os.Stdout)
+		case "restore":
+			return restore(args[1:], keys, os.Stdout)
+		case "reencrypt-wal":
+			return reencryptWAL(dir, args[1:], keys, os.Stdout)
+		case "verify":
+			return verify(dir, args[1:], keys, os.Stdout)
+		case "export":
+			return exportData(dir, args[1:], keys, os.Stdout)
+		case "import":
+			return importData(dir, args[1:], keys, os.Stdin, os.Stdout)
+		}
+	}
+
+	var st store
+	switch {
+	case dir != "" && addr != "":
+		return errors.New("-dir and -addr are mutually exclusive")
+	case dir != "":
+		local, err := openLocalStore(dir, keys)
+		if err != nil {
+			return fmt.Errorf("run: %w", err)
+		}
+		st = local
+	case addr != "":
+		st = newHTTPStore(addr, token)
+	default:
+		flag.Usage()
+		return errors.New("one of -dir and -addr is required")
+	}
+	defer st.Close()
+
+	if len(args) > 0 {
+		return execute(st, args, os.Stdout)
+	}
+	return repl(st, os.Stdin, os.Stdout)
+}
+
+// repl 逐行执行命令，单条命令失败只输出错误，不退出
+func repl(st store, in io.Reader, out io.Writer) error {
+	scanner := bufio.NewScanner(in)
+	fmt.Fprint(out, "sdbf> ")
+	for scanner.Scan() {
+		args := strings.Fields(scanner.Text())
+		if len(args) > 0 {
+			if args[0] == "quit" || args[0] == "exit" {
+				return nil
+			}
+			if err := execute(st, args, out); err != nil {
+				fmt.Fprintln(out, "(error)", err)
+			}
+		}
+		fmt.Fprint(out, "sdbf> ")
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read command: %w", err)
+	}
+	return nil
+}
+
+// execute 执行一条命令，结果写入 out
+func execute(st store, args []string, out io.Writer) error {
+	cmd, args := args[0], args[1:]
+	wantArgs := func(min, max int) error {
+		if len(args) < min || len(args) > max {
+			return fmt.Errorf("wrong number of arguments for %q", cmd)
+		}
+		return nil
+	}
+
+	switch cmd {
+	case "get":
+		if err := wantArgs(1, 1); err != nil {
+			return err
+		}
+		value, err := st.Get(args[0])
+		if errors.Is(err, errNotFound) {
+			fmt.Fprintln(out, "(nil)")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("get: %w", err)
+		}
+		fmt.Fprintf(out, "%s\n", value)
+
+	case "put", "set":
+		if err := wantArgs(2, 2); err != nil {
+			return err
+		}
+		if err := st.Put(args[0], []byte(args[1])); err != nil {
+			return fmt.Errorf("put: %w", err)
+		}
+		fmt.Fprintln(out, "OK")
+
+	case "delete", "del":
+		if err := wantArgs(1, 1); err != nil {
+			return err
+		}
+		if err := st.Delete(args[0]); err != nil {
+			return fmt.Errorf("delete: %w", err)
+		}
+		fmt.Fprintln(out, "OK")
+
+	case "scan":
+		if err := wantArgs(0, 3); err != nil {
+			return err
+		}
+		args = append(args, "", "", "")
+		limit := -1
+		if args[2] != "" {
+			n, err := strconv.Atoi(args[2])
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid limit %q", args[2])
+			}
+			limit = n
+		}
+		entries, err := st.Scan(args[0], args[1], limit)
+		if err != nil {
+			return fmt.Errorf("scan: %w", err)
+		}
+		for _, e := range entries {
+			fmt.Fprintf(out, "%s\t%s\n", e.Key, e.Value)
+		}
+
+	case "stats":
+		if err := wantArgs(0, 0); err != nil {
+			return err
+		}
+		stats, err := st.Stats()
+		if err != nil {
+			return fmt.Errorf("stats: %w", err)
+		}
+		keys := make([]string, 0, len(stats))
+		for k := range stats {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			fmt.Fprintf(out, "%s\t%s\n", k, stats[k])
+		}
+
+	case "compact":
+		// 数据目前只存在于 MemTable 与 WAL 中，SSTable 与合并实现后再接入
+		return errors.New("compact is not supported yet: the engine has no SSTables to compact")
+
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+	"github.com/aireet/SimpleDBForge/internal/server"
+)
+
+func TestExecute(t *testing.T) {
+	local, err := openLocalStore(t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("打开本地数据目录失败: %v", err)
+	}
+	defer local.Close()
+
+	db, err := lsm.Open(t.TempDir(), lsm.Options{SyncMode: lsm.NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	ts := httptest.NewServer(server.NewHTTPServer(db).Handler())
+	defer ts.Close()
+
+	backends := map[string]store{
+		"local":  local,
+		"remote": newHTTPStore(ts.URL, ""),
+	}
+
+	tests := []struct {
+		args    string
+		want    string
+		wantErr bool
+	}{
+		{args: "get a", want: "(nil)\n"},
+		{args: "put a 1", want: "OK\n"},
+		{args: "put user/1 alice", want: "OK\n"},
+		{args: "put b 2", want: "OK\n"},
+		{args: "get a", want: "1\n"},
+		{args: "get user/1", want: "alice\n"},
+		{args: "scan", want: "a\t1\nb\t2\nuser/1\talice\n"},
+		{args: "scan b", want: "b\t2\nuser/1\talice\n"},
+		{args: "scan a b", want: "a\t1\nb\t2\n"},
+		{args: "scan a  1", want: "a\t1\n"},
+		{args: "delete a", want: "OK\n"},
+		{args: "get a", want: "(nil)\n"},
+		{args: "get", wantErr: true},
+		{args: "scan a b x", wantErr: true},
+		{args: "compact", wantErr: true},
+		{args: "unknown", wantErr: true},
+	}
+
+	for name, st := range backends {
+		t.Run(name, func(t *testing.T) {
+			for _, tt := range tests {
+				var out strings.Builder
+				// 用 Split 而不是 Fields，以便测试空参数（scan a "" 1）
+				err := execute(st, strings.Split(tt.args, " "), &out)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("%s: 期望错误 %v, 实际 %v", tt.args, tt.wantErr, err)
+				}
+				if got := out.String(); got != tt.want {
+					t.Fatalf("%s: 期望输出 %q, 实际 %q", tt.args, tt.want, got)
+				}
+			}
+
+			var out strings.Builder
+			if err := execute(st, []string{"stats"}, &out); err != nil {
+				t.Fatalf("stats 失败: %v", err)
+			}
+			for _, want := range []string{"keys\t2\n", "memtable_entries\t", "last_sequence\t"} {
+				if !strings.Contains(out.String(), want) {
+					t.Fatalf("stats 期望包含 %q, 实际 %q", want, out.String())
+				}
+			}
+		})
+	}
+}
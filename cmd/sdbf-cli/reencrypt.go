@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+)
+
+// reencryptWAL 打开本地数据目录 dir，用密钥文件中的当前密钥重新加密 WAL，并输出不再使用的旧密钥
+//
+//	sdbf-cli -dir ./data -key-file ./keys reencrypt-wal
+func reencryptWAL(dir string, args []string, keys lsm.KeyProvider, out io.Writer) error {
+	if len(args) != 0 || dir == "" || keys == nil {
+		return errors.New("usage: sdbf-cli -dir DIR -key-file FILE reencrypt-wal")
+	}
+	st, err := openLocalStore(dir, keys)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	info, err := st.db.ReencryptWAL(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "reencrypted %d records in %d segments with key %d\n", info.Records, info.Segments, info.KeyID)
+	if len(info.RetiredKeys) > 0 {
+		fmt.Fprintf(out, "keys no longer used by the wal: %v\n", info.RetiredKeys)
+	}
+	return nil
+}
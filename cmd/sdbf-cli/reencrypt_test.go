@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+)
+
+func TestReencryptWAL(t *testing.T) {
+	dir := t.TempDir()
+	oldKey := lsm.StaticKey{ID: 1, Secret: bytes.Repeat([]byte{0x11}, 32)}
+	st, err := openLocalStore(dir, oldKey)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := st.Put("a", []byte("1")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	st.Close()
+
+	ring := lsm.KeyRing{Current: 2, Keys: map[uint32][]byte{1: oldKey.Secret, 2: bytes.Repeat([]byte{0x22}, 32)}}
+	var out strings.Builder
+	if err := reencryptWAL(dir, nil, ring, &out); err != nil {
+		t.Fatalf("reencrypt-wal 失败: %v", err)
+	}
+	for _, want := range []string{"reencrypted 1 records in 1 segments with key 2", "keys no longer used by the wal: [1]"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("输出中缺少 %q:\n%s", want, out.String())
+		}
+	}
+	if err := reencryptWAL(dir, nil, nil, &out); err == nil {
+		t.Fatal("缺少密钥文件时期望报错")
+	}
+}
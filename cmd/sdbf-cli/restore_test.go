@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+)
+
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	db, err := lsm.Open(dir, lsm.DefaultOptions())
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	backup := filepath.Join(t.TempDir(), "full")
+	for _, k := range []string{"a", "b"} {
+		if err := db.Set(k, []byte(k)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := db.Backup(context.Background(), backup); err != nil {
+		t.Fatalf("备份失败: %v", err)
+	}
+	if err := db.Set("c", []byte("c")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	db.Close()
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{name: "仅备份", args: []string{"{dst}", backup}, want: "to seq 2"},
+		{name: "回放归档", args: []string{"-wal", filepath.Join(dir, "wal"), "{dst}", backup}, want: "to seq 3"},
+		{name: "缺少参数", args: []string{"{dst}"}, wantErr: true},
+		{name: "非法序列号", args: []string{"-seq", "x", "{dst}", backup}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := filepath.Join(t.TempDir(), "restored")
+			args := make([]string, len(tt.args))
+			for i, a := range tt.args {
+				args[i] = strings.ReplaceAll(a, "{dst}", dst)
+			}
+
+			var out strings.Builder
+			err := restore(args, nil, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("期望错误 %v, 实际 %v", tt.wantErr, err)
+			}
+			if !strings.Contains(out.String(), tt.want) {
+				t.Fatalf("输出中缺少 %q: %s", tt.want, out.String())
+			}
+		})
+	}
+}
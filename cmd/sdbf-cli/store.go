@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+	"github.com/aireet/SimpleDBForge/pkg/client"
+)
+
+// errNotFound 两种后端统一的 key 不存在错误
+var errNotFound = errors.New("key not found")
+
+// kv 是 scan 返回的一条记录
+type kv struct {
+	Key     string `json:"key"`
+	Value   []byte `json:"value"`
+	Version int64  `json:"version"`
+}
+
+// store 是 CLI 操作的后端：直接打开本地数据目录，或通过 HTTP 网关连接服务
+type store interface {
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+	Delete(key string) error
+	// Scan 返回 [start, end] 区间内最多 limit 条记录，end 为空表示不设上界，limit < 0 表示不限制
+	Scan(start, end string, limit int) ([]kv, error)
+	// Stats 返回后端特有的状态信息，按 key 排序输出
+	Stats() (map[string]string, error)
+	Close() error
+}
+
+// localStore 直接打开数据目录，运行期间独占该目录，不能与服务同时使用
+type localStore struct {
+	db *lsm.DB
+}
+
+// openLocalStore 打开 dir，keys 不为 nil 时用于加密的数据目录
+func openLocalStore(dir string, keys lsm.KeyProvider) (*localStore, error) {
+	opts := lsm.DefaultOptions()
+	opts.EncryptionKeys = keys
+	db, err := lsm.Open(dir, opts)
+	if err != nil {
+		return nil, fmt.Errorf("open local store: %w", err)
+	}
+	return &localStore{db: db}, nil
+}
+
+func (s *localStore) Get(key string) ([]byte, error) {
+	value, err := s.db.Get(key)
+	if errors.Is(err, lsm.ErrNotFound) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	return value, nil
+}
+
+func (s *localStore) Put(key string, value []byte) error { return s.db.Set(key, value) }
+func (s *localStore) Delete(key string) error            { return s.db.Delete(key) }
+func (s *localStore) Close() error                       { return s.db.Close() }
+
+func (s *localStore) Scan(start, end string, limit int) ([]kv, error) {
+	it, err := s.db.NewIterator()
+	if err != nil {
+		return nil, fmt.Errorf("scan: %w", err)
+	}
+	defer it.Close()
+	var out []kv
+	for it.Seek(start); it.Valid() && limit != 0; it.Next() {
+		if end != "" && utils.CompareKey(it.Key(), end) > 0 {
+			break
+		}
+		e := it.Entry()
+		out = append(out, kv{Key: e.Key, Value: e.Value, Version: e.Version})
+		limit--
+	}
+	return out, nil
+}
+
+// Stats 统计存活的 key 以及引擎状态
+func (s *localStore) Stats() (map[string]string, error) {
+	stats, err := s.db.Stats()
+	if err != nil {
+		return nil, fmt.Errorf("stats: %w", err)
+	}
+	return mergeStats(s, stats)
+}
+
+// httpStore 通过 sdbf-server 的 HTTP 网关访问远端实例
+type httpStore struct {
+	c *client.Client
+}
+
+func newHTTPStore(addr, token string) *httpStore {
+	return &httpStore{c: client.New(addr, client.Options{Token: token})}
+}
+
+func (s *httpStore) Get(key string) ([]byte, error) {
+	value, err := s.c.Get(context.Background(), key)
+	if errors.Is(err, lsm.ErrNotFound) {
+		return nil, errNotFound
+	}
+	return value, err
+}
+
+func (s *httpStore) Put(key string, value []byte) error {
+	return s.c.Set(context.Background(), key, value)
+}
+
+func (s *httpStore) Delete(key string) error {
+	return s.c.Delete(context.Background(), key)
+}
+
+func (s *httpStore) Scan(start, end string, limit int) ([]kv, error) {
+	var entries []*sdbf.Entry
+	var err error
+	switch {
+	case limit < 0:
+		entries, err = s.c.Scan(context.Background(), start, end)
+	case limit > 0:
+		entries, _, err = s.c.ScanPage(context.Background(), start, end, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]kv, len(entries))
+	for i, e := range entries {
+		out[i] = kv{Key: e.Key, Value: e.Value, Version: e.Version}
+	}
+	return out, nil
+}
+
+func (s *httpStore) Stats() (map[string]string, error) {
+	stats, err := s.c.Stats(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return mergeStats(s, stats)
+}
+
+func (s *httpStore) Close() error { return s.c.Close() }
+
+// mergeStats 把引擎状态按 JSON 字段名展开，并补充全量扫描得到的存活 key 统计
+func mergeStats(s store, stats lsm.Stats) (map[string]string, error) {
+	out, err := scanStats(s)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return nil, fmt.Errorf("stats: %w", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("stats: %w", err)
+	}
+	for k, v := range fields {
+		out[k] = string(v)
+	}
+	return out, nil
+}
+
+// scanStats 通过全量扫描统计存活 key 的数量与大小，两种后端通用
+func scanStats(s store) (map[string]string, error) {
+	entries, err := s.Scan("", "", -1)
+	if err != nil {
+		return nil, fmt.Errorf("stats: %w", err)
+	}
+	var keyBytes, valueBytes int
+	for _, e := range entries {
+		keyBytes += len(e.Key)
+		valueBytes += len(e.Value)
+	}
+	return map[string]string{
+		"keys":        strconv.Itoa(len(entries)),
+		"keys.bytes":  strconv.Itoa(keyBytes),
+		"value.bytes": strconv.Itoa(valueBytes),
+	}, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+)
+
+// verify 离线检查本地数据目录 dir，输出发现的问题与修复建议；有错误级别的问题时返回错误
+//
+//	sdbf-cli -dir ./data [-key-file ./keys] verify
+func verify(dir string, args []string, keys lsm.KeyProvider, out io.Writer) error {
+	if len(args) != 0 || dir == "" {
+		return errors.New("usage: sdbf-cli -dir DIR [-key-file FILE] verify")
+	}
+	report, err := lsm.VerifyConsistency(dir, lsm.Options{EncryptionKeys: keys})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%d segments, %d bytes, %d records, %d entries, last seq %d\n",
+		report.Segments, report.Bytes, report.Records, report.Entries, report.LastSequence)
+	for i, p := range report.Problems {
+		fmt.Fprintf(out, "%d. %v\n   repair: %s\n", i+1, p, p.Repair)
+	}
+	if !report.OK() {
+		return fmt.Errorf("verify %s: found %d problems", dir, len(report.Problems))
+	}
+	fmt.Fprintln(out, "ok")
+	return nil
+}
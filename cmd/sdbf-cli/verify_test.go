@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	st, err := openLocalStore(dir, nil)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := st.Put("a", []byte("1")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	st.Close()
+
+	var out strings.Builder
+	if err := verify(dir, nil, nil, &out); err != nil {
+		t.Fatalf("verify 失败: %v", err)
+	}
+	if !strings.Contains(out.String(), "1 entries, last seq 1") || !strings.HasSuffix(out.String(), "ok\n") {
+		t.Fatalf("输出不正确:\n%s", out.String())
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "wal", "000005.wal"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := verify(dir, nil, nil, &out); err == nil {
+		t.Fatal("缺少段时期望报错")
+	}
+	if !strings.Contains(out.String(), "are missing") || !strings.Contains(out.String(), "repair: ") {
+		t.Fatalf("输出中缺少问题与修复建议:\n%s", out.String())
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+func TestWALDump(t *testing.T) {
+	dir := t.TempDir()
+	w, err := lsm.OpenWAL(vfs.OSFS{}, dir, "000001.wal")
+	if err != nil {
+		t.Fatalf("打开 WAL 失败: %v", err)
+	}
+	if _, err := w.Write(&sdbf.Entry{Key: "a", Value: []byte("1"), Version: 1}); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if _, err := w.WriteBatch([]*sdbf.Entry{{Key: "b", Version: 2}, {Key: "c", Tombstone: true, Version: 3}}); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	w.Close()
+	path := filepath.Join(dir, "000001.wal")
+
+	var out strings.Builder
+	if err := walDump([]string{path}, nil, &out); err != nil {
+		t.Fatalf("wal-dump 失败: %v", err)
+	}
+	for _, want := range []string{
+		`offset=0 len=`,
+		` batch key="c" tombstone=true version=3`,
+		"2 records, 3 entries",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf("输出中缺少 %q:\n%s", want, out.String())
+		}
+	}
+
+	// 追加一段垃圾数据，报告损坏位置
+	info, _ := os.Stat(path)
+	fd, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	fd.Write([]byte{0xFF, 0xFF})
+	fd.Close()
+
+	out.Reset()
+	if err := walDump([]string{path}, nil, &out); err == nil {
+		t.Fatal("期望报告损坏")
+	}
+	if want := "corruption begins at offset " + strconv.FormatInt(info.Size(), 10); !strings.Contains(out.String(), want) {
+		t.Fatalf("输出中缺少 %q:\n%s", want, out.String())
+	}
+}
+
+func TestWALDump_Encrypted(t *testing.T) {
+	dir := t.TempDir()
+	key := lsm.StaticKey{ID: 3, Secret: bytes.Repeat([]byte{0x5a}, 32)}
+	m, err := lsm.OpenWALManager(dir, lsm.Options{EncryptionKeys: key})
+	if err != nil {
+		t.Fatalf("打开 WAL 失败: %v", err)
+	}
+	if _, err := m.Write(&sdbf.Entry{Key: "a", Value: []byte("1"), Version: 1}); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	m.Close()
+	path := filepath.Join(dir, "000001.wal")
+
+	var out strings.Builder
+	if err := walDump([]string{path}, key, &out); err != nil {
+		t.Fatalf("wal-dump 失败: %v", err)
+	}
+	if want := ` encrypted(key=3) key="a" tombstone=false version=1`; !strings.Contains(out.String(), want) {
+		t.Fatalf("输出中缺少 %q:\n%s", want, out.String())
+	}
+	if err := walDump([]string{path}, nil, &out); !errors.Is(err, lsm.ErrEncryptionKey) {
+		t.Fatalf("没有密钥时期望 ErrEncryptionKey, 实际 %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+// sdbf-server 以网络服务的方式运行 SimpleDBForge
+//
+// 用法：
+//
+//	sdbf-server -dir ./data -resp-addr :6380 -http-addr :8080
+//	redis-cli -p 6380 set k v
+//	curl localhost:8080/kv/k
+//
+// 监听地址为空时不启动对应的服务，至少需要启动一个。
+// 指定 -follow 时作为 follower 从 leader 的 HTTP 网关复制数据，此时不应再向本实例写入：
+//
+//	sdbf-server -dir ./replica -resp-addr :6381 -follow http://localhost:8080
+//
+// 在可信的局域网之外运行时启用 TLS 与认证，-auth-file 的格式见 server.LoadAuthFile：
+//
+//	sdbf-server -http-addr :8443 -tls-cert server.crt -tls-key server.key -tls-client-ca ca.crt -auth-file auth.conf
+//
+// -rate-qps 与 -rate-bytes 按客户端（token、客户端证书或来源 IP）限制请求速率与带宽，见 server.RateLimitConfig。
+// -debug-addr 启动 pprof 与引擎内部状态的调试接口（见 server.DebugServer），不做认证，只应监听本机：
+//
+//	sdbf-server -http-addr :8080 -debug-addr localhost:6060
+//	go tool pprof http://localhost:6060/debug/pprof/profile
+//
+// -encryption-key-file 用 AES-GCM 加密 WAL 与备份（格式见 lsm.ReadKeyFile），follower 需要使用与 leader 相同的密钥。
+// 轮换密钥时在文件末尾追加新密钥并发送 SIGHUP，再停止服务执行 sdbf-cli reencrypt-wal，之后即可移除旧密钥。
+// -encryption-key-env 从环境变量读取密钥；对接其他 KMS 时实现 lsm.KeyProvider 即可
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+	"github.com/aireet/SimpleDBForge/internal/replication"
+	"github.com/aireet/SimpleDBForge/internal/server"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+func main() {
+	dir := flag.String("dir", "data", "数据目录")
+	respAddr := flag.String("resp-addr", ":6380", "RESP（Redis 协议）监听地址，为空则不启动")
+	httpAddr := flag.String("http-addr", "", "HTTP/JSON 监听地址，为空则不启动")
+	debugAddr := flag.String("debug-addr", "", "pprof 与调试接口的监听地址，为空则不启动")
+	follow := flag.String("follow", "", "leader 的 HTTP 网关地址，指定时作为 follower 复制其数据")
+	followToken := flag.String("follow-token", "", "leader 启用认证时 follower 使用的 token")
+	tlsCert := flag.String("tls-cert", "", "服务端证书（PEM），与 -tls-key 一起指定时启用 TLS")
+	tlsKey := flag.String("tls-key", "", "服务端私钥（PEM）")
+	tlsClientCA := flag.String("tls-client-ca", "", "客户端证书的 CA（PEM），指定时要求双向 TLS")
+	authFile := flag.String("auth-file", "", "token 与客户端证书角色的配置文件，指定时要求认证")
+	rateQPS := flag.Float64("rate-qps", 0, "每个客户端每秒允许的请求数，0 表示不限制")
+	rateBurst := flag.Int("rate-burst", 0, "每个客户端允许的突发请求数，默认为 -rate-qps 向上取整")
+	rateBytes := flag.Int64("rate-bytes", 0, "每个客户端每秒允许的请求与响应字节数，0 表示不限制")
+	slowOp := flag.Duration("slow-op", 0, "耗时超过该值的操作打印带各阶段耗时的警告，0 表示不记录")
+	slowOpHashKeys := flag.Bool("slow-op-hash-keys", false, "慢操作日志中用 key 的哈希代替原文")
+	scrubInterval := flag.Duration("scrub-interval", 0, "后台校验封存的 WAL 段的间隔，0 表示不校验")
+	entryChecksums := flag.Bool("entry-checksums", false, "写入时为每个条目计算校验和，读取时校验，发现数据损坏")
+	keyFile := flag.String("encryption-key-file", "", "WAL 与备份的加密密钥文件（每行 \"<ID> <十六进制密钥>\"，最后一行为当前密钥），指定时启用静态数据加密，收到 SIGHUP 时重新加载")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "退出时等待进行中的请求完成并关闭数据库的最长时间")
+	keyEnv := flag.String("encryption-key-env", "", "从该环境变量读取加密密钥（格式同 -encryption-key-file，可用逗号分隔），与 -encryption-key-file 互斥")
+	flag.Parse()
+
+	auth, err := loadAuth(*tlsCert, *tlsKey, *tlsClientCA, *authFile)
+	if err != nil {
+		slog.Error("sdbf-server exited", "err", err)
+		os.Exit(1)
+	}
+	limit := &server.RateLimitConfig{QPS: *rateQPS, Burst: *rateBurst, BytesPerSec: *rateBytes}
+	opts := lsm.DefaultOptions()
+	opts.SlowOpThreshold, opts.SlowOpHashKeys = *slowOp, *slowOpHashKeys
+	opts.EntryChecksums, opts.ScrubInterval = *entryChecksums, *scrubInterval
+	keys, err := loadKeys(*keyFile, *keyEnv)
+	if err != nil {
+		slog.Error("sdbf-server exited", "err", err)
+		os.Exit(1)
+	}
+	opts.EncryptionKeys = keys
+	if err := run(*dir, opts, *respAddr, *httpAddr, *debugAddr, *follow, *followToken, auth, limit, *shutdownTimeout); err != nil {
+		slog.Error("sdbf-server exited", "err", err)
+		os.Exit(1)
+	}
+}
+
+// reloadKeys 在收到 SIGHUP 时重新加载密钥文件，失败时继续使用原来的密钥
+func reloadKeys(keys lsm.KeyProvider) {
+	p, ok := keys.(*lsm.FileKeyProvider)
+	if !ok {
+		slog.Warn("SIGHUP ignored: no encryption key file to reload")
+		return
+	}
+	if err := p.Reload(); err != nil {
+		slog.Error("reload encryption keys", "err", err)
+		return
+	}
+	id, _, _ := p.CurrentKey()
+	slog.Info("encryption keys reloaded", "current", id)
+}
+
+// frontend 是一个可以独立启停的网络服务
+type frontend interface {
+	ListenAndServe(addr string) error
+	Close() error
+}
+
+// loadKeys 根据命令行参数构造静态数据加密的 KeyProvider，都未指定时返回 nil（不加密）
+func loadKeys(keyFile, keyEnv string) (lsm.KeyProvider, error) {
+	switch {
+	case keyFile != "" && keyEnv != "":
+		return nil, errors.New("-encryption-key-file and -encryption-key-env are mutually exclusive")
+	case keyFile != "":
+		return lsm.NewFileKeyProvider(vfs.OSFS{}, keyFile)
+	case keyEnv != "":
+		return lsm.KeyRingFromEnv(keyEnv)
+	}
+	return nil, nil
+}
+
+// loadAuth 根据命令行参数构造 TLS 与认证配置，都未指定时返回 nil
+func loadAuth(certFile, keyFile, clientCAFile, authFile string) (*server.AuthConfig, error) {
+	if certFile == "" && keyFile == "" && clientCAFile == "" && authFile == "" {
+		return nil, nil
+	}
+	auth := &server.AuthConfig{}
+	switch {
+	case certFile != "" && keyFile != "":
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load tls certificate: %w", err)
+		}
+		auth.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	case certFile != "" || keyFile != "":
+		return nil, errors.New("-tls-cert and -tls-key must be given together")
+	}
+	if clientCAFile != "" {
+		if auth.TLS == nil {
+			return nil, errors.New("-tls-client-ca requires -tls-cert and -tls-key")
+		}
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client ca: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("load client ca %s: no certificates found", clientCAFile)
+		}
+		auth.TLS.ClientCAs = pool
+		auth.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if authFile != "" {
+		tokens, certRoles, err := server.LoadAuthFile(authFile)
+		if err != nil {
+			return nil, err
+		}
+		auth.Tokens, auth.CertRoles = tokens, certRoles
+	}
+	return auth, nil
+}
+
+func run(dir string, opts lsm.Options, respAddr, httpAddr, debugAddr, follow, followToken string, auth *server.AuthConfig, limit *server.RateLimitConfig, shutdownTimeout time.Duration) error {
+	if respAddr == "" && httpAddr == "" {
+		return errors.New("at least one of -resp-addr and -http-addr is required")
+	}
+
+	db, err := lsm.Open(dir, opts)
+	if err != nil {
+		return fmt.Errorf("start server: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := db.CloseWithOptions(ctx, lsm.CloseOptions{}); err != nil {
+			slog.Error("close db", "err", err)
+		}
+	}()
+
+	var frontends []frontend
+	errCh := make(chan error, 4)
+	start := func(f frontend, addr string) {
+		frontends = append(frontends, f)
+		go func() { errCh <- f.ListenAndServe(addr) }()
+	}
+	if respAddr != "" {
+		s := server.NewRESPServer(db)
+		s.SetAuth(auth)
+		s.SetRateLimit(limit)
+		start(s, respAddr)
+	}
+	if httpAddr != "" {
+		s := server.NewHTTPServer(db)
+		s.SetAuth(auth)
+		s.SetRateLimit(limit)
+		start(s, httpAddr)
+	}
+	if debugAddr != "" {
+		start(server.NewDebugServer(db), debugAddr)
+	}
+
+	if follow != "" {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		fopts := replication.DefaultFollowerOptions()
+		fopts.Token = followToken
+		fopts.EncryptionKeys = opts.EncryptionKeys
+		f := replication.NewFollower(db, follow, fopts)
+		go func() {
+			if err := f.Run(ctx); !errors.Is(err, context.Canceled) {
+				errCh <- fmt.Errorf("replication: %w", err)
+			}
+		}()
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	var serveErr error
+	for {
+		select {
+		case s := <-sig:
+			if s == syscall.SIGHUP {
+				reloadKeys(opts.EncryptionKeys)
+				continue
+			}
+			slog.Info("shutting down", "signal", s.String())
+		case err := <-errCh:
+			if !errors.Is(err, server.ErrServerClosed) {
+				serveErr = fmt.Errorf("serve: %w", err)
+			}
+		}
+		break
+	}
+
+	errs := []error{serveErr}
+	for _, f := range frontends {
+		errs = append(errs, f.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,512 @@
+// Package expr 实现服务端扫描使用的过滤表达式：对每个条目求值，只返回结果为 true 的条目，
+// 远程客户端不需要把整个区间传输回来再过滤
+//
+// 语法：
+//
+//	expr    := or
+//	or      := and ("||" and)*
+//	and     := unary ("&&" unary)*
+//	unary   := "!" unary | compare
+//	compare := primary (("==" | "!=" | "<" | "<=" | ">" | ">=") primary)?
+//	primary := "key" | "value" | "true" | "false" | 字符串 | 整数 | 函数调用 | "(" expr ")"
+//
+// key 与 value 是当前条目的 key 与值，类型为字符串；字符串字面量使用 Go 的双引号语法。
+// 比较的两边类型必须相同，字符串按字节序比较，bool 只支持 == 与 !=。内置函数：
+//
+//	has_prefix(s, prefix) bool    has_suffix(s, suffix) bool    contains(s, sub) bool
+//	glob(s, pattern) bool         path.Match 的通配符语法
+//	len(s) int                    字节数
+//	int(s) int                    把十进制文本解析为整数
+//
+// 例如 has_prefix(key, "user/") && int(value) >= 18。
+//
+// 表达式在编译时检查类型，没有循环、变量与副作用，长度与嵌套深度都有上限，
+// 求值时间与表达式长度加上 key、value 的长度成正比，可以安全地执行来自客户端的表达式。
+// int 解析失败或 glob 的模式不合法时，整个表达式对该条目的结果为 false
+package expr
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+const (
+	// MaxLen 表达式的最大长度（字节）
+	MaxLen = 4096
+	// maxDepth 括号、一元运算与函数调用的最大嵌套深度
+	maxDepth = 64
+)
+
+// ErrSyntax 表达式有语法或类型错误
+var ErrSyntax = errors.New("invalid expression")
+
+// Program 是编译好的表达式，可以被多个 goroutine 并发使用
+type Program struct {
+	eval boolFn
+}
+
+// env 是一次求值的输入，按值传给各个节点，不会逃逸到堆上
+type env struct {
+	key, value string
+}
+
+// 编译后的节点：ok 为 false 表示求值失败（例如 int 解析失败），失败向上传递，最终结果为 false
+type (
+	boolFn func(env) (bool, bool)
+	intFn  func(env) (int64, bool)
+	strFn  func(env) (string, bool)
+)
+
+// Compile 编译表达式，表达式有错误时返回包装了 ErrSyntax 的错误
+func Compile(src string) (*Program, error) {
+	if len(src) > MaxLen {
+		return nil, fmt.Errorf("%w: longer than %d bytes", ErrSyntax, MaxLen)
+	}
+	p := &parser{src: src}
+	p.next()
+	n, err := p.parseOr()
+	if err == nil && p.tok.kind != tokEOF {
+		err = p.errorf("unexpected %s", p.tok)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if n.kind != kindBool {
+		return nil, fmt.Errorf("%w: result is %s, want bool", ErrSyntax, n.kind)
+	}
+	return &Program{eval: n.b}, nil
+}
+
+// Match 对一个条目求值
+func (p *Program) Match(key string, value []byte) bool {
+	// value 只在求值期间以字符串的形式读取，不做复制
+	e := env{key: key, value: unsafe.String(unsafe.SliceData(value), len(value))}
+	v, ok := p.eval(e)
+	return ok && v
+}
+
+// kind 是表达式的静态类型
+type kind int
+
+const (
+	kindBool kind = iota
+	kindInt
+	kindString
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindBool:
+		return "bool"
+	case kindInt:
+		return "int"
+	default:
+		return "string"
+	}
+}
+
+// node 是编译后的子表达式，按 kind 使用对应的求值函数
+type node struct {
+	kind kind
+	b    boolFn
+	i    intFn
+	s    strFn
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokString
+	tokInt
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+type parser struct {
+	src   string
+	pos   int
+	tok   token
+	depth int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: at offset %d: %s", ErrSyntax, p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// next 读取下一个 token，不合法的字符作为单字符运算符返回，由解析报告错误
+func (p *parser) next() {
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos == len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+	c := p.src[p.pos]
+	switch {
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isAlnum(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, text: p.src[start:p.pos], pos: start}
+	case c >= '0' && c <= '9' || c == '-' && p.pos+1 < len(p.src) && p.src[p.pos+1] >= '0' && p.src[p.pos+1] <= '9':
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+			p.pos++
+		}
+		p.tok = token{kind: tokInt, text: p.src[start:p.pos], pos: start}
+	case c == '"':
+		p.pos++
+		for p.pos < len(p.src) && p.src[p.pos] != '"' {
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+		p.pos = min(p.pos+1, len(p.src))
+		p.tok = token{kind: tokString, text: p.src[start:p.pos], pos: start}
+	default:
+		op := p.src[p.pos : p.pos+1]
+		if p.pos+1 < len(p.src) {
+			switch two := p.src[p.pos : p.pos+2]; two {
+			case "&&", "||", "==", "!=", "<=", ">=":
+				op = two
+			}
+		}
+		p.pos += len(op)
+		p.tok = token{kind: tokOp, text: op, pos: start}
+	}
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func (p *parser) isOp(op string) bool {
+	return p.tok.kind == tokOp && p.tok.text == op
+}
+
+func (p *parser) expectOp(op string) error {
+	if !p.isOp(op) {
+		return p.errorf("expected %q, got %s", op, p.tok)
+	}
+	p.next()
+	return nil
+}
+
+// enter 增加嵌套深度，超过 maxDepth 时返回错误；与 leave 成对调用
+func (p *parser) enter() error {
+	p.depth++
+	if p.depth > maxDepth {
+		return p.errorf("nested deeper than %d", maxDepth)
+	}
+	return nil
+}
+
+func (p *parser) leave() { p.depth-- }
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return node{}, err
+	}
+	for p.isOp("||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return node{}, err
+		}
+		if left, err = p.logical("||", left, right); err != nil {
+			return node{}, err
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return node{}, err
+	}
+	for p.isOp("&&") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return node{}, err
+		}
+		if left, err = p.logical("&&", left, right); err != nil {
+			return node{}, err
+		}
+	}
+	return left, nil
+}
+
+// logical 组合 && 与 ||，短路求值
+func (p *parser) logical(op string, left, right node) (node, error) {
+	if left.kind != kindBool || right.kind != kindBool {
+		return node{}, p.errorf("%s needs bool operands, got %s and %s", op, left.kind, right.kind)
+	}
+	l, r := left.b, right.b
+	if op == "&&" {
+		return node{kind: kindBool, b: func(e env) (bool, bool) {
+			if v, ok := l(e); !ok || !v {
+				return false, ok
+			}
+			return r(e)
+		}}, nil
+	}
+	return node{kind: kindBool, b: func(e env) (bool, bool) {
+		if v, ok := l(e); !ok || v {
+			return v, ok
+		}
+		return r(e)
+	}}, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if !p.isOp("!") {
+		return p.parseCompare()
+	}
+	if err := p.enter(); err != nil {
+		return node{}, err
+	}
+	defer p.leave()
+	p.next()
+	n, err := p.parseUnary()
+	if err != nil {
+		return node{}, err
+	}
+	if n.kind != kindBool {
+		return node{}, p.errorf("! needs a bool operand, got %s", n.kind)
+	}
+	f := n.b
+	return node{kind: kindBool, b: func(e env) (bool, bool) {
+		v, ok := f(e)
+		return !v, ok
+	}}, nil
+}
+
+func (p *parser) parseCompare() (node, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return node{}, err
+	}
+	if p.tok.kind != tokOp {
+		return left, nil
+	}
+	op := p.tok.text
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return left, nil
+	}
+	p.next()
+	right, err := p.parsePrimary()
+	if err != nil {
+		return node{}, err
+	}
+	if left.kind != right.kind {
+		return node{}, p.errorf("cannot compare %s with %s", left.kind, right.kind)
+	}
+	switch left.kind {
+	case kindString:
+		return compare(op, left.s, right.s), nil
+	case kindInt:
+		return compare(op, left.i, right.i), nil
+	}
+	if op != "==" && op != "!=" {
+		return node{}, p.errorf("bool only supports == and !=")
+	}
+	l, r, want := left.b, right.b, op == "=="
+	return node{kind: kindBool, b: func(e env) (bool, bool) {
+		a, ok := l(e)
+		if !ok {
+			return false, false
+		}
+		b, ok := r(e)
+		return (a == b) == want, ok
+	}}, nil
+}
+
+// compare 生成比较两个同类型子表达式的节点
+func compare[T cmp.Ordered](op string, l, r func(env) (T, bool)) node {
+	// 比较结果（-1、0、1）满足运算符时为 true
+	var match [3]bool
+	switch op {
+	case "==":
+		match = [3]bool{false, true, false}
+	case "!=":
+		match = [3]bool{true, false, true}
+	case "<":
+		match = [3]bool{true, false, false}
+	case "<=":
+		match = [3]bool{true, true, false}
+	case ">":
+		match = [3]bool{false, false, true}
+	default:
+		match = [3]bool{false, true, true}
+	}
+	return node{kind: kindBool, b: func(e env) (bool, bool) {
+		a, ok := l(e)
+		if !ok {
+			return false, false
+		}
+		b, ok := r(e)
+		if !ok {
+			return false, false
+		}
+		return match[cmp.Compare(a, b)+1], true
+	}}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	if err := p.enter(); err != nil {
+		return node{}, err
+	}
+	defer p.leave()
+
+	tok := p.tok
+	switch tok.kind {
+	case tokString:
+		s, err := strconv.Unquote(tok.text)
+		if err != nil {
+			return node{}, p.errorf("invalid string %s", tok.text)
+		}
+		p.next()
+		return node{kind: kindString, s: func(env) (string, bool) { return s, true }}, nil
+	case tokInt:
+		n, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return node{}, p.errorf("invalid integer %s", tok.text)
+		}
+		p.next()
+		return node{kind: kindInt, i: func(env) (int64, bool) { return n, true }}, nil
+	case tokIdent:
+		p.next()
+		if p.isOp("(") {
+			return p.parseCall(tok)
+		}
+		switch tok.text {
+		case "key":
+			return node{kind: kindString, s: func(e env) (string, bool) { return e.key, true }}, nil
+		case "value":
+			return node{kind: kindString, s: func(e env) (string, bool) { return e.value, true }}, nil
+		case "true", "false":
+			v := tok.text == "true"
+			return node{kind: kindBool, b: func(env) (bool, bool) { return v, true }}, nil
+		}
+		return node{}, fmt.Errorf("%w: at offset %d: unknown identifier %q", ErrSyntax, tok.pos, tok.text)
+	case tokOp:
+		if tok.text == "(" {
+			p.next()
+			n, err := p.parseOr()
+			if err != nil {
+				return node{}, err
+			}
+			return n, p.expectOp(")")
+		}
+	}
+	return node{}, p.errorf("unexpected %s", tok)
+}
+
+// parseCall 解析函数调用的参数并检查类型，name 为函数名，当前 token 为 "("
+func (p *parser) parseCall(name token) (node, error) {
+	p.next()
+	var args []node
+	for !p.isOp(")") {
+		if len(args) > 0 {
+			if err := p.expectOp(","); err != nil {
+				return node{}, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return node{}, err
+		}
+		args = append(args, arg)
+	}
+	p.next()
+
+	want := 2
+	if name.text == "len" || name.text == "int" {
+		want = 1
+	}
+	switch name.text {
+	case "has_prefix", "has_suffix", "contains", "glob", "len", "int":
+	default:
+		return node{}, fmt.Errorf("%w: at offset %d: unknown function %q", ErrSyntax, name.pos, name.text)
+	}
+	if len(args) != want {
+		return node{}, fmt.Errorf("%w: at offset %d: %s takes %d arguments, got %d", ErrSyntax, name.pos, name.text, want, len(args))
+	}
+	for _, arg := range args {
+		if arg.kind != kindString {
+			return node{}, fmt.Errorf("%w: at offset %d: %s needs string arguments, got %s", ErrSyntax, name.pos, name.text, arg.kind)
+		}
+	}
+
+	s := args[0].s
+	switch name.text {
+	case "len":
+		return node{kind: kindInt, i: func(e env) (int64, bool) {
+			v, ok := s(e)
+			return int64(len(v)), ok
+		}}, nil
+	case "int":
+		return node{kind: kindInt, i: func(e env) (int64, bool) {
+			v, ok := s(e)
+			if !ok {
+				return 0, false
+			}
+			n, err := strconv.ParseInt(v, 10, 64)
+			return n, err == nil
+		}}, nil
+	}
+
+	var f func(a, b string) (bool, bool)
+	switch name.text {
+	case "has_prefix":
+		f = func(a, b string) (bool, bool) { return strings.HasPrefix(a, b), true }
+	case "has_suffix":
+		f = func(a, b string) (bool, bool) { return strings.HasSuffix(a, b), true }
+	case "contains":
+		f = func(a, b string) (bool, bool) { return strings.Contains(a, b), true }
+	default:
+		f = func(s, pattern string) (bool, bool) {
+			ok, err := path.Match(pattern, s)
+			return ok, err == nil
+		}
+	}
+	t := args[1].s
+	return node{kind: kindBool, b: func(e env) (bool, bool) {
+		a, ok := s(e)
+		if !ok {
+			return false, false
+		}
+		b, ok := t(e)
+		if !ok {
+			return false, false
+		}
+		return f(a, b)
+	}}, nil
+}
@@ -0,0 +1,93 @@
+package expr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestProgram_Match(t *testing.T) {
+	tests := []struct {
+		expr       string
+		key, value string
+		want       bool
+	}{
+		{expr: `true`, want: true},
+		{expr: `key == "a"`, key: "a", want: true},
+		{expr: `key != "a"`, key: "a", want: false},
+		{expr: `value < "b" && value >= "a"`, value: "ab", want: true},
+		{expr: `has_prefix(key, "user/")`, key: "user/1", want: true},
+		{expr: `has_suffix(key, ".json")`, key: "a.txt", want: false},
+		{expr: `contains(value, "\"x\"")`, value: `{"x":1}`, want: true},
+		{expr: `glob(key, "user/*/name")`, key: "user/7/name", want: true},
+		{expr: `len(value) > 3`, value: "abcd", want: true},
+		{expr: `int(value) >= 18 && int(value) < 65`, value: "42", want: true},
+		{expr: `int(value) <= -1`, value: "-3", want: true},
+		{expr: `!(key == "a") || value == "x"`, key: "a", value: "x", want: true},
+		{expr: `(key == "a" || key == "b") && !false`, key: "b", want: true},
+		{expr: `has_prefix(key, "a") == true`, key: "abc", want: true},
+		// int 解析失败时整个表达式为 false，取反也不会变为 true
+		{expr: `int(value) > 0`, value: "abc", want: false},
+		{expr: `!(int(value) > 0)`, value: "abc", want: false},
+		{expr: `int(value) > 0 || true`, value: "abc", want: false},
+		// 短路求值：左边已经决定结果时不计算右边
+		{expr: `true || int(value) > 0`, value: "abc", want: true},
+		{expr: `!glob(key, "[")`, key: "a", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			p, err := Compile(tt.expr)
+			if err != nil {
+				t.Fatalf("编译失败: %v", err)
+			}
+			if got := p.Match(tt.key, []byte(tt.value)); got != tt.want {
+				t.Fatalf("key=%q value=%q 期望 %v, 实际 %v", tt.key, tt.value, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{name: "空表达式", expr: ""},
+		{name: "结果不是 bool", expr: `len(key)`},
+		{name: "未知标识符", expr: `foo == "a"`},
+		{name: "未知函数", expr: `exec("rm")`},
+		{name: "参数个数", expr: `has_prefix(key)`},
+		{name: "参数类型", expr: `contains(key, 1)`},
+		{name: "比较类型不同", expr: `key == 1`},
+		{name: "bool 大小比较", expr: `true < false`},
+		{name: "逻辑运算的类型", expr: `key && true`},
+		{name: "取反的类型", expr: `!key`},
+		{name: "未闭合的括号", expr: `(key == "a"`},
+		{name: "未闭合的字符串", expr: `key == "a`},
+		{name: "多余的 token", expr: `key == "a" "b"`},
+		{name: "非法字符", expr: `key == "a" # b`},
+		{name: "整数溢出", expr: `len(key) > 99999999999999999999`},
+		{name: "嵌套过深", expr: strings.Repeat("(", maxDepth+1) + "true" + strings.Repeat(")", maxDepth+1)},
+		{name: "过长", expr: `key == "` + strings.Repeat("a", MaxLen) + `"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Compile(tt.expr); !errors.Is(err, ErrSyntax) {
+				t.Fatalf("期望 ErrSyntax, 实际 %v", err)
+			}
+		})
+	}
+}
+
+func BenchmarkProgram_Match(b *testing.B) {
+	p, err := Compile(`has_prefix(key, "user/") && int(value) >= 18`)
+	if err != nil {
+		b.Fatalf("编译失败: %v", err)
+	}
+	value := []byte("42")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Match("user/12345", value)
+	}
+}
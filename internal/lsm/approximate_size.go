@@ -0,0 +1,118 @@
+package lsm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/internal/utils"
+)
+
+// KeyRange 是 [Start, End) 区间（utils.CompareKey 定义的顺序），End 为空表示直到最后一个 key
+type KeyRange struct {
+	Start, End string
+}
+
+// contains 报告 key 是否不超过区间的终点，调用方保证 key 不小于 Start
+func (r KeyRange) contains(key string) bool {
+	return r.End == "" || utils.CompareKey(key, r.End) < 0
+}
+
+// RangeSize 是 ApproximateSizes 对一个区间的统计
+type RangeSize struct {
+	// Keys 区间内存活的 key 数
+	Keys int64
+	// Bytes 这些 key 与其当前值的总长度，不包含编码开销、旧版本与墓碑
+	Bytes int64
+}
+
+// ApproximateSizes 返回默认列族中每个区间的 key 数与数据量，sizes[i] 对应 ranges[i]，
+// 用于选择分片的切分点或估算扫描进度
+//
+// 所有区间统计的是同一个序列号时刻的数据，已删除与已过期的 key 不计入。
+// 目前数据只存在于 MemTable 中，没有 SSTable 的索引可以用来估算，
+// 统计需要遍历区间内的 key，代价与区间内的 key 数成正比，不适合频繁地对整个数据库调用
+func (db *DB) ApproximateSizes(ranges []KeyRange) ([]RangeSize, error) {
+	return db.approximateSizes(db.memTable.def, ranges)
+}
+
+// ApproximateSizes 返回列族中每个区间的 key 数与数据量，见 DB.ApproximateSizes
+func (cf *ColumnFamily) ApproximateSizes(ranges []KeyRange) ([]RangeSize, error) {
+	return cf.db.approximateSizes(cf.f, ranges)
+}
+
+func (db *DB) approximateSizes(f *memFamily, ranges []KeyRange) ([]RangeSize, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+	// 登记快照使遍历期间版本回收不会丢弃序列号 seq 时刻可见的条目
+	seq := db.memTable.acquireSnapshot(db.snapshots)
+	defer db.snapshots.release(seq)
+
+	it := newLiveIterator(f.iterator(seq), db.now())
+	sizes := make([]RangeSize, len(ranges))
+	for i, r := range ranges {
+		for it.Seek(r.Start); it.Valid() && r.contains(it.Key()); it.Next() {
+			sizes[i].Keys++
+			sizes[i].Bytes += int64(len(it.Key()) + len(it.Value()))
+		}
+	}
+	return sizes, nil
+}
+
+// SplitRange 把默认列族中的区间 r 切分为最多 n 个数据量大致相等的相邻区间，按顺序返回，
+// 用于并行导出、并行扫描或把数据分配到多个分片
+//
+// 返回的区间首尾相接、恰好覆盖 r：第一个区间的 Start 为 r.Start，最后一个的 End 为 r.End，
+// 中间的切分点都是区间内存活的 key。数据量的计算方法同 ApproximateSizes，切分点只能落在 key 上，
+// 单个很大的值会使所在的区间偏大；区间内的 key 少于 n 个或没有数据时返回的区间少于 n 个。
+// 统计与切分基于同一个序列号时刻的数据，代价是遍历区间两次
+func (db *DB) SplitRange(r KeyRange, n int) ([]KeyRange, error) {
+	return db.splitRange(db.memTable.def, r, n)
+}
+
+// SplitRange 切分列族中的区间 r，见 DB.SplitRange
+func (cf *ColumnFamily) SplitRange(r KeyRange, n int) ([]KeyRange, error) {
+	return cf.db.splitRange(cf.f, r, n)
+}
+
+func (db *DB) splitRange(f *memFamily, r KeyRange, n int) ([]KeyRange, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("split range: n must be positive, got %d", n)
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+	seq := db.memTable.acquireSnapshot(db.snapshots)
+	defer db.snapshots.release(seq)
+	return splitRangeAt(f, r, n, seq, db.now()), nil
+}
+
+// splitRangeAt 在序列号 seq 时刻切分 f 中的区间 r，调用方保证 seq 已登记为快照
+func splitRangeAt(f *memFamily, r KeyRange, n int, seq int64, now time.Time) []KeyRange {
+	var total int64
+	it := newLiveIterator(f.iterator(seq), now)
+	for it.Seek(r.Start); it.Valid() && r.contains(it.Key()); it.Next() {
+		total += int64(len(it.Key()) + len(it.Value()))
+	}
+
+	var ranges []KeyRange
+	start := r.Start
+	// 第 len(ranges)+1 个切分点放在之前的累计数据量首次达到 total*(len(ranges)+1)/n 的 key 上
+	var sum int64
+	it = newLiveIterator(f.iterator(seq), now)
+	for it.Seek(r.Start); it.Valid() && r.contains(it.Key()) && len(ranges) < n-1; it.Next() {
+		if sum > 0 && sum >= total*int64(len(ranges)+1)/int64(n) {
+			ranges = append(ranges, KeyRange{Start: start, End: it.Key()})
+			start = it.Key()
+		}
+		sum += int64(len(it.Key()) + len(it.Value()))
+	}
+	return append(ranges, KeyRange{Start: start, End: r.End})
+}
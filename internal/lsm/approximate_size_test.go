@@ -0,0 +1,126 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// 测试 ApproximateSizes 统计每个区间内存活的 key 数与数据量
+func TestDB_ApproximateSizes(t *testing.T) {
+	db, err := Open(t.TempDir(), Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	// key-00 到 key-09，每个 key 与值共 10 字节
+	for i := 0; i < 10; i++ {
+		if err := db.Set(fmt.Sprintf("key-%02d", i), []byte("abcd")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := db.Delete("key-03"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if err := db.DeleteRange("key-07", "key-09"); err != nil {
+		t.Fatalf("范围删除失败: %v", err)
+	}
+	if err := db.SetWithTTL("key-05", []byte("abcd"), time.Nanosecond); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	cf, err := db.CF("other")
+	if err != nil {
+		t.Fatalf("创建列族失败: %v", err)
+	}
+	if err := cf.Set("key-00", []byte("abcd")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		r    KeyRange
+		want RangeSize
+	}{
+		{name: "全部", r: KeyRange{}, want: RangeSize{Keys: 6, Bytes: 60}},
+		{name: "左闭右开", r: KeyRange{Start: "key-00", End: "key-02"}, want: RangeSize{Keys: 2, Bytes: 20}},
+		{name: "跳过墓碑与过期", r: KeyRange{Start: "key-03", End: "key-06"}, want: RangeSize{Keys: 1, Bytes: 10}},
+		{name: "跳过范围删除", r: KeyRange{Start: "key-07"}, want: RangeSize{Keys: 1, Bytes: 10}},
+		{name: "空区间", r: KeyRange{Start: "x", End: "y"}},
+		{name: "终点小于起点", r: KeyRange{Start: "key-05", End: "key-01"}},
+	}
+	ranges := make([]KeyRange, len(tests))
+	for i, tt := range tests {
+		ranges[i] = tt.r
+	}
+	sizes, err := db.ApproximateSizes(ranges)
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	for i, tt := range tests {
+		if sizes[i] != tt.want {
+			t.Errorf("%s: 期望 %+v, 实际 %+v", tt.name, tt.want, sizes[i])
+		}
+	}
+
+	if sizes, err := cf.ApproximateSizes([]KeyRange{{}}); err != nil || sizes[0] != (RangeSize{Keys: 1, Bytes: 10}) {
+		t.Fatalf("列族统计不正确: %+v %v", sizes, err)
+	}
+	db.Close()
+	if _, err := db.ApproximateSizes(ranges); !errors.Is(err, ErrClosed) {
+		t.Fatalf("关闭后期望 ErrClosed, 实际 %v", err)
+	}
+}
+
+// 测试 SplitRange 按数据量切分出首尾相接的区间
+func TestDB_SplitRange(t *testing.T) {
+	db, err := Open(t.TempDir(), Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	// key-00 到 key-99 大小相同，big 的值与其余所有 key 的数据量相同
+	for i := 0; i < 100; i++ {
+		if err := db.Set(fmt.Sprintf("key-%02d", i), []byte("abcd")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := db.Set("zz-big", make([]byte, 994)); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		r    KeyRange
+		n    int
+		want []KeyRange
+	}{
+		{name: "不切分", r: KeyRange{Start: "a", End: "b"}, n: 1, want: []KeyRange{{Start: "a", End: "b"}}},
+		{name: "四等分", r: KeyRange{End: "zz"}, n: 4, want: []KeyRange{
+			{End: "key-25"}, {Start: "key-25", End: "key-50"}, {Start: "key-50", End: "key-75"}, {Start: "key-75", End: "zz"},
+		}},
+		{name: "key 少于 n", r: KeyRange{Start: "key-10", End: "key-13"}, n: 5, want: []KeyRange{
+			{Start: "key-10", End: "key-11"}, {Start: "key-11", End: "key-12"}, {Start: "key-12", End: "key-13"},
+		}},
+		{name: "没有数据", r: KeyRange{Start: "x", End: "y"}, n: 3, want: []KeyRange{{Start: "x", End: "y"}}},
+		{name: "大值独占一半", r: KeyRange{}, n: 2, want: []KeyRange{{End: "zz-big"}, {Start: "zz-big"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.SplitRange(tt.r, tt.n)
+			if err != nil {
+				t.Fatalf("切分失败: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("期望 %+v, 实际 %+v", tt.want, got)
+			}
+		})
+	}
+	if _, err := db.SplitRange(KeyRange{}, 0); err == nil {
+		t.Fatalf("n 为 0 时期望返回错误")
+	}
+}
@@ -0,0 +1,67 @@
+package lsm
+
+import (
+	"fmt"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+// SetAsync 异步写入一个键值对，写入完成（已写入 WAL 并对读可见）或失败后调用 done，
+// done 为 nil 时忽略结果。与 WriteAsync 相同，返回错误时 done 不会被调用
+func (db *DB) SetAsync(key string, value []byte, done func(error)) error {
+	if err := db.checkSize(key, value); err != nil {
+		return fmt.Errorf("set %s: %w", key, err)
+	}
+	return db.commitAsync([]*sdbf.Entry{{Key: key, Value: value}}, done)
+}
+
+// WriteAsync 异步地原子提交一个批次，不等待 WAL 写入与 fsync，适合对延迟不敏感、
+// 需要流水线式写入的生产者：并发的异步写入会在组提交中合并，共享一次 fsync
+//
+// 批次的内容在调用时复制，返回后即可复用 b。提交完成后在后台 goroutine 中调用 done，
+// 不同写入的 done 可能并发执行，且不保证按调用顺序执行；done 中不能调用 Close。
+// 校验失败或数据库已关闭时直接返回错误，此时 done 不会被调用。
+// 未完成的异步写入达到 Options.AsyncWriteQueueSize 后，WriteAsync 阻塞直到有写入完成。
+// Close 会等待所有已接受的异步写入完成
+func (db *DB) WriteAsync(b *WriteBatch, done func(error)) error {
+	if b.Len() == 0 {
+		if done != nil {
+			go done(nil)
+		}
+		return nil
+	}
+	if err := db.checkBatch(b); err != nil {
+		return fmt.Errorf("write batch: %w", err)
+	}
+	return db.commitAsync(b.entries(), done)
+}
+
+// commitAsync 在后台提交 entries
+//
+// 后台 goroutine 不持有 db.mu：Close 在关闭 WAL 之前等待 db.async，
+// 而 db.async.Add 在读锁内、确认未关闭之后执行，因此提交期间 WAL 一定是打开的
+func (db *DB) commitAsync(entries []*sdbf.Entry, done func(error)) error {
+	db.asyncSlots <- struct{}{}
+
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		<-db.asyncSlots
+		return ErrClosed
+	}
+	db.async.Add(1)
+	db.mu.RUnlock()
+
+	go func() {
+		defer db.async.Done()
+		err := db.memTable.commit(entries)
+		<-db.asyncSlots
+		if err != nil {
+			err = fmt.Errorf("async write: %w", err)
+		}
+		if done != nil {
+			done(err)
+		}
+	}()
+	return nil
+}
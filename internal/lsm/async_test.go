@@ -0,0 +1,100 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// 测试异步写入：回调收到结果，Close 等待已接受的写入完成，重新打开后数据完整
+func TestDB_WriteAsync(t *testing.T) {
+	dir := t.TempDir()
+	opts := DefaultOptions()
+	// 队列很小，生产者会被阻塞，覆盖背压的路径
+	opts.AsyncWriteQueueSize = 4
+	db, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	const producers, perProducer = 4, 50
+	var wg sync.WaitGroup
+	var completed, failed atomic.Int64
+	done := func(err error) {
+		if err != nil {
+			failed.Add(1)
+		}
+		completed.Add(1)
+	}
+	for p := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b := NewWriteBatch()
+			for i := range perProducer {
+				key := fmt.Sprintf("p%d:%03d", p, i)
+				var err error
+				if i%2 == 0 {
+					err = db.SetAsync(key, []byte("v"), done)
+				} else {
+					// 批次在调用时被复制，可以立即复用
+					b.Reset()
+					b.Set(key, []byte("v"))
+					err = db.WriteAsync(b, done)
+				}
+				if err != nil {
+					t.Errorf("异步写入失败: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	if n := completed.Load(); n != producers*perProducer {
+		t.Fatalf("Close 返回时期望 %d 个回调已执行, 实际 %d", producers*perProducer, n)
+	}
+	if n := failed.Load(); n != 0 {
+		t.Fatalf("%d 个异步写入失败", n)
+	}
+	if err := db.SetAsync("late", nil, done); !errors.Is(err, ErrClosed) {
+		t.Fatalf("关闭后期望 ErrClosed, 实际 %v", err)
+	}
+
+	db, err = Open(dir, opts)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer db.Close()
+	if got := len(dumpDB(t, db)); got != producers*perProducer {
+		t.Fatalf("重新打开后期望 %d 个 key, 实际 %d", producers*perProducer, got)
+	}
+}
+
+// 测试异步写入的同步校验：失败时直接返回错误，回调不会被调用
+func TestDB_WriteAsync_Validation(t *testing.T) {
+	opts := DefaultOptions()
+	opts.MaxValueSize = 4
+	db, err := Open(InMemory, opts)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	called := false
+	if err := db.SetAsync("k", []byte("too large"), func(error) { called = true }); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("期望 ErrValueTooLarge, 实际 %v", err)
+	}
+	b := NewWriteBatch()
+	b.Set("k", []byte("too large"))
+	if err := db.WriteAsync(b, func(error) { called = true }); !errors.Is(err, ErrValueTooLarge) {
+		t.Fatalf("期望 ErrValueTooLarge, 实际 %v", err)
+	}
+	if called {
+		t.Fatal("校验失败时回调不应被调用")
+	}
+}
@@ -0,0 +1,298 @@
+package lsm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+var (
+	// ErrBackupDirNotEmpty 备份目标目录已存在且非空
+	ErrBackupDirNotEmpty = errors.New("backup destination is not empty")
+	// ErrInvalidBackup 备份目录缺少元数据或元数据与备份链不匹配
+	ErrInvalidBackup = errors.New("invalid backup")
+)
+
+const (
+	// backupBatchSize 备份时每次写入 WAL 的条目数
+	backupBatchSize = 1000
+	// backupMetaName 备份目录下记录 BackupInfo 的文件
+	backupMetaName = "BACKUP.json"
+)
+
+// BackupInfo 是写在每个备份目录下的元数据，增量备份通过 ParentID 串成一条链
+//
+// 备份目录布局：
+//
+//	<dst>/
+//	├── BACKUP.json
+//	└── wal/
+//	    └── 000001.wal
+type BackupInfo struct {
+	// ID 备份固定的快照序列号，同一个数据库的备份按 ID 排序即为时间顺序
+	ID int64 `json:"id"`
+	// ParentID 增量备份所基于的上一个备份的 ID，全量备份为 0
+	ParentID int64 `json:"parent_id"`
+	// Incremental 是否为增量备份
+	Incremental bool `json:"incremental"`
+	// Entries 备份写出的条目数
+	Entries int `json:"entries"`
+	// CreatedAt 备份完成的时间
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Backup 把数据库当前的一致视图备份到 dst 目录，dst 可以直接用 Open 作为独立的数据库打开
+//
+// 备份基于快照：备份期间的写入不会出现在备份中，也不会被阻塞。目前所有数据都在 MemTable 中，
+// 备份只写出快照中仍然存活的条目（不含墓碑、被覆盖的旧版本和已过期的条目），
+// 保留原有的序列号与过期时间，得到一个精简后的 WAL 段。
+//
+// dst 必须不存在或为空目录，写在与数据库相同的文件系统（Options.FS）上；
+// 纯内存数据库的备份写到操作系统的文件系统上。ctx 取消时停止备份并删除已写出的文件
+func (db *DB) Backup(ctx context.Context, dst string) error {
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		return fmt.Errorf("backup %s: %w", dst, err)
+	}
+	defer snap.Release()
+
+	// 所有列族的条目依次写入，条目自身记录了所属的列族
+	it := newLiveIterator(db.memTable.familiesIterator(snap.Seq()), db.now())
+	info := BackupInfo{ID: snap.Seq()}
+	if err := db.writeBackup(ctx, db.backupFS(), dst, it, &info); err != nil {
+		return fmt.Errorf("backup %s: %w", dst, err)
+	}
+	slog.Info("db backup finished", "dir", db.dir, "dst", dst, "id", info.ID, "entries", info.Entries)
+	return nil
+}
+
+// IncrementalBackup 把 base 备份（全量或增量）之后的所有修改备份到 dst 目录
+//
+// 增量备份只包含序列号大于 base 的每个 key 的最新条目，墓碑与已过期的条目同样保留，
+// 以便恢复时遮蔽 base 中的旧值。增量备份不能单独打开，需要与它所在的备份链一起通过
+// RestoreBackup 恢复。base 必须是本数据库之前生成的备份，dst 的要求同 Backup
+func (db *DB) IncrementalBackup(ctx context.Context, dst, base string) error {
+	fsys := db.backupFS()
+	baseInfo, err := ReadBackupInfo(fsys, base)
+	if err != nil {
+		return fmt.Errorf("incremental backup %s: %w", dst, err)
+	}
+
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		return fmt.Errorf("incremental backup %s: %w", dst, err)
+	}
+	defer snap.Release()
+	if baseInfo.ID > snap.Seq() {
+		return fmt.Errorf("incremental backup %s: %w: base %s (id %d) is newer than the db (seq %d)",
+			dst, ErrInvalidBackup, base, baseInfo.ID, snap.Seq())
+	}
+
+	// 不经过 liveIterator：墓碑与过期条目也要写入增量备份
+	it := &sinceIterator{
+		Iterator:   db.memTable.familiesIterator(snap.Seq()),
+		minVersion: baseInfo.ID + 1,
+	}
+	info := BackupInfo{ID: snap.Seq(), ParentID: baseInfo.ID, Incremental: true}
+	if err := db.writeBackup(ctx, fsys, dst, it, &info); err != nil {
+		return fmt.Errorf("incremental backup %s: %w", dst, err)
+	}
+	slog.Info("db incremental backup finished", "dir", db.dir, "dst", dst, "id", info.ID, "parent", info.ParentID, "entries", info.Entries)
+	return nil
+}
+
+// backupFS 备份写入的文件系统，见 Backup
+func (db *DB) backupFS() vfs.FS {
+	if db.dir == InMemory {
+		return vfs.OSFS{}
+	}
+	return db.opts.FS
+}
+
+// backupCipher 备份使用的加密，与数据库的 WAL 相同
+func (db *DB) backupCipher() (*walCipher, error) {
+	if db.wal != nil {
+		return db.wal.cipher, nil
+	}
+	return newWALCipher(db.opts.EncryptionKeys)
+}
+
+// ReadBackupInfo 读取 fsys 中 dir 备份目录的元数据
+func ReadBackupInfo(fsys vfs.FS, dir string) (BackupInfo, error) {
+	path := filepath.Join(dir, backupMetaName)
+	fd, err := fsys.Open(path)
+	if err != nil {
+		return BackupInfo{}, fmt.Errorf("%w: open %s: %w", ErrInvalidBackup, path, err)
+	}
+	defer fd.Close()
+
+	var info BackupInfo
+	if err := json.NewDecoder(fd).Decode(&info); err != nil {
+		return BackupInfo{}, fmt.Errorf("%w: decode %s: %w", ErrInvalidBackup, path, err)
+	}
+	return info, nil
+}
+
+// sinceIterator 跳过版本号小于 minVersion 的条目
+type sinceIterator struct {
+	Iterator
+	minVersion int64
+}
+
+func (it *sinceIterator) Seek(target string) {
+	it.Iterator.Seek(target)
+	it.skipOlder()
+}
+
+func (it *sinceIterator) Next() {
+	it.Iterator.Next()
+	it.skipOlder()
+}
+
+func (it *sinceIterator) skipOlder() {
+	for it.Iterator.Valid() && it.Iterator.Entry().Version < it.minVersion {
+		it.Iterator.Next()
+	}
+}
+
+// writeBackup 把 it 中的所有条目写到 dst 下的第一个 WAL 段，再写入元数据 info
+//
+// 段文件与元数据都先写入临时文件，fsync 后再重命名，元数据最后出现：
+// 中途失败不会留下一个带有元数据、看起来完整的备份
+//
+// 配置了 Options.EncryptionKeys 时备份同样加密
+func (db *DB) writeBackup(ctx context.Context, fsys vfs.FS, dst string, it Iterator, info *BackupInfo) error {
+	c, err := db.backupCipher()
+	if err != nil {
+		return err
+	}
+	dstExisted, err := checkEmptyDir(fsys, dst)
+	if err != nil {
+		return err
+	}
+
+	walDir := filepath.Join(dst, walDirName)
+	if err := fsys.MkdirAll(walDir, 0755); err != nil {
+		return fmt.Errorf("create wal dir %s: %w", walDir, err)
+	}
+	segPath := filepath.Join(walDir, segmentName(1))
+	metaPath := filepath.Join(dst, backupMetaName)
+
+	err = writeFileAtomic(fsys, segPath, func(fd vfs.File) error {
+		w := NewWAL(fd, walDir, segPath, walVersion)
+		w.syncMode = NoSync
+		w.cipher = c
+		n, err := copyEntries(ctx, w, it)
+		info.Entries = n
+		return err
+	})
+	if err == nil {
+		info.CreatedAt = time.Now()
+		err = writeFileAtomic(fsys, metaPath, func(fd vfs.File) error {
+			return json.NewEncoder(fd).Encode(info)
+		})
+	}
+	if err != nil {
+		// 清理本次创建的文件与目录，使 dst 恢复到备份之前的状态，可以直接重试
+		cleanup := []string{metaPath, segPath, walDir}
+		if !dstExisted {
+			cleanup = append(cleanup, dst)
+		}
+		for _, p := range cleanup {
+			if rerr := fsys.Remove(p); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) {
+				slog.Warn("remove incomplete backup", "path", p, "err", rerr)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// checkEmptyDir 确认 dir 不存在或为空目录，返回它是否已存在，
+// 写入失败时只删除本次创建的目录
+func checkEmptyDir(fsys vfs.FS, dir string) (bool, error) {
+	names, err := fsys.List(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("list destination: %w", err)
+	}
+	if len(names) > 0 {
+		return false, ErrBackupDirNotEmpty
+	}
+	return err == nil, nil
+}
+
+// writeFileAtomic 通过 write 写入 path.tmp，fsync 后重命名为 path 并 fsync 所在目录，
+// 失败时删除临时文件
+func writeFileAtomic(fsys vfs.FS, path string, write func(fd vfs.File) error) error {
+	tmpPath := path + ".tmp"
+	fd, err := fsys.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", tmpPath, err)
+	}
+
+	err = write(fd)
+	if err == nil {
+		if err = fd.Sync(); err != nil {
+			err = fmt.Errorf("sync %s: %w", tmpPath, err)
+		}
+	}
+	if cerr := fd.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("close %s: %w", tmpPath, cerr)
+	}
+	if err == nil {
+		if err = fsys.Rename(tmpPath, path); err != nil {
+			err = fmt.Errorf("rename %s: %w", tmpPath, err)
+		}
+	}
+	if err == nil {
+		err = syncDir(fsys, filepath.Dir(path))
+	}
+	if err != nil {
+		if rerr := fsys.Remove(tmpPath); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) {
+			slog.Warn("remove temp file", "path", tmpPath, "err", rerr)
+		}
+		return err
+	}
+	return nil
+}
+
+// copyEntries 按批把 it 中的条目写入 w，每批之间检查 ctx 是否已取消
+func copyEntries(ctx context.Context, w *WAL, it Iterator) (int, error) {
+	batch := make([]*sdbf.Entry, 0, backupBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := w.Write(batch...); err != nil {
+			return fmt.Errorf("write backup wal: %w", err)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	n := 0
+	for it.Seek(""); it.Valid(); it.Next() {
+		batch = append(batch, it.Entry())
+		n++
+		if len(batch) == backupBatchSize {
+			if err := flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+	return n, ctx.Err()
+}
@@ -0,0 +1,189 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDB_Backup(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  func(t *testing.T) string
+	}{
+		{name: "磁盘", dir: func(t *testing.T) string { return t.TempDir() }},
+		{name: "纯内存", dir: func(t *testing.T) string { return InMemory }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := Open(tt.dir(t), DefaultOptions())
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+			defer db.Close()
+
+			for _, k := range []string{"a", "b", "c"} {
+				if err := db.Set(k, []byte("old-"+k)); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+			}
+			if err := db.Set("a", []byte("new-a")); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+			if err := db.Delete("b"); err != nil {
+				t.Fatalf("删除失败: %v", err)
+			}
+			if err := db.SetWithTTL("ttl", []byte("v"), time.Hour); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+			stats, err := db.Stats()
+			if err != nil {
+				t.Fatalf("获取统计信息失败: %v", err)
+			}
+
+			dst := filepath.Join(t.TempDir(), "backup")
+			if err := db.Backup(context.Background(), dst); err != nil {
+				t.Fatalf("备份失败: %v", err)
+			}
+			// 备份之后的写入不属于备份
+			if err := db.Set("after", []byte("x")); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+
+			restored := openTestDB(t, dst)
+			defer restored.Close()
+
+			want := map[string]string{"a": "new-a", "c": "old-c", "ttl": "v"}
+			if got := dumpDB(t, restored); !maps.Equal(got, want) {
+				t.Fatalf("期望 %v, 实际 %v", want, got)
+			}
+			wantExpire, _ := db.ExpireAt("ttl")
+			if got, err := restored.ExpireAt("ttl"); err != nil || !got.Equal(wantExpire) {
+				t.Fatalf("过期时间期望 %v, 实际 %v %v", wantExpire, got, err)
+			}
+			// 最后一次写入（ttl）保留在备份中，序列号从它之后继续分配
+			if err := restored.Set("d", nil); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+			restoredStats, err := restored.Stats()
+			if err != nil || restoredStats.LastSequence != stats.LastSequence+1 {
+				t.Fatalf("恢复后的序列号期望 %d, 实际 %d %v", stats.LastSequence+1, restoredStats.LastSequence, err)
+			}
+		})
+	}
+}
+
+func TestDB_BackupErrors(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	nonEmpty := t.TempDir()
+	if err := os.WriteFile(filepath.Join(nonEmpty, "f"), nil, 0644); err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		dst     string
+		wantErr error
+	}{
+		{name: "目标非空", ctx: context.Background(), dst: nonEmpty, wantErr: ErrBackupDirNotEmpty},
+		{name: "已取消", ctx: canceled, dst: filepath.Join(t.TempDir(), "backup"), wantErr: context.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.Backup(tt.ctx, tt.dst)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("期望 %v, 实际 %v", tt.wantErr, err)
+			}
+			if tt.dst != nonEmpty {
+				if _, err := os.Stat(tt.dst); !errors.Is(err, os.ErrNotExist) {
+					t.Fatalf("失败的备份应被清理: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestDB_IncrementalBackup(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+
+	for _, k := range []string{"a", "b", "c"} {
+		if err := db.Set(k, []byte("old-"+k)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	root := t.TempDir()
+	full := filepath.Join(root, "full")
+	if err := db.Backup(context.Background(), full); err != nil {
+		t.Fatalf("全量备份失败: %v", err)
+	}
+	fullInfo, err := ReadBackupInfo(db.opts.FS, full)
+	if err != nil {
+		t.Fatalf("读取备份元数据失败: %v", err)
+	}
+	if fullInfo.Incremental || fullInfo.ParentID != 0 || fullInfo.Entries != 3 {
+		t.Fatalf("全量备份元数据不符合预期: %+v", fullInfo)
+	}
+
+	if err := db.Set("a", []byte("new-a")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Delete("b"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if err := db.Set("d", []byte("d")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	incr := filepath.Join(root, "incr")
+	if err := db.IncrementalBackup(context.Background(), incr, full); err != nil {
+		t.Fatalf("增量备份失败: %v", err)
+	}
+	incrInfo, err := ReadBackupInfo(db.opts.FS, incr)
+	if err != nil {
+		t.Fatalf("读取备份元数据失败: %v", err)
+	}
+	if !incrInfo.Incremental || incrInfo.ParentID != fullInfo.ID || incrInfo.ID <= fullInfo.ID {
+		t.Fatalf("增量备份元数据不符合预期: %+v, 全量 %+v", incrInfo, fullInfo)
+	}
+
+	// 增量备份只包含 base 之后修改过的 key，删除以墓碑的形式保留
+	got := map[string]string{}
+	err = InspectWAL(filepath.Join(incr, walDirName, segmentName(1)), nil, func(rec WALRecord) error {
+		for _, e := range rec.Entries {
+			if e.Tombstone {
+				got[e.Key] = "<tombstone>"
+			} else {
+				got[e.Key] = string(e.Value)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("读取增量备份失败: %v", err)
+	}
+	want := map[string]string{"a": "new-a", "b": "<tombstone>", "d": "d"}
+	if !maps.Equal(got, want) || incrInfo.Entries != len(want) {
+		t.Fatalf("期望 %v, 实际 %v (entries %d)", want, got, incrInfo.Entries)
+	}
+
+	// base 不是备份目录
+	err = db.IncrementalBackup(context.Background(), filepath.Join(root, "bad"), t.TempDir())
+	if !errors.Is(err, ErrInvalidBackup) {
+		t.Fatalf("期望 %v, 实际 %v", ErrInvalidBackup, err)
+	}
+}
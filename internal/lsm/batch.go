@@ -0,0 +1,133 @@
+package lsm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+// WriteBatch 收集一组写入与删除，通过 DB.Write 原子地提交：
+// 这组修改作为一条批量记录写入 WAL，崩溃恢复与快照读取只会看到全部或者全部看不到；
+// 不经过快照的 Get 可能在应用过程中先看到其中一部分 key 的新值
+//
+// WriteBatch 不是并发安全的
+type WriteBatch struct {
+	ops []batchOp
+	// seq 最近一次成功提交时分配给最后一个操作的序列号
+	seq int64
+}
+
+type batchOp struct {
+	// cf 所属的列族，空字符串表示默认列族
+	cf        string
+	key       string
+	value     []byte
+	tombstone bool
+	// expireAt 过期时间（Unix 纳秒），0 表示永不过期
+	expireAt int64
+	// rangeEnd 非空时为范围删除 [key, rangeEnd)
+	rangeEnd string
+	// meta 用户元数据，见 DB.SetWithMeta
+	meta []byte
+}
+
+func NewWriteBatch() *WriteBatch {
+	return &WriteBatch{}
+}
+
+// Set 在批次中追加一次写入
+func (b *WriteBatch) Set(key string, value []byte) {
+	b.ops = append(b.ops, batchOp{key: key, value: value})
+}
+
+// SetWithTTL 在批次中追加一次带过期时间的写入，过期时间从调用时开始计算
+func (b *WriteBatch) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("batch set %s: %w", key, ErrInvalidTTL)
+	}
+	b.ops = append(b.ops, batchOp{key: key, value: value, expireAt: time.Now().Add(ttl).UnixNano()})
+	return nil
+}
+
+// Delete 在批次中追加一次删除
+func (b *WriteBatch) Delete(key string) {
+	b.ops = append(b.ops, batchOp{key: key, tombstone: true})
+}
+
+// SetCF 在批次中追加一次对列族 cf 的写入，同一个批次可以跨越多个列族
+func (b *WriteBatch) SetCF(cf *ColumnFamily, key string, value []byte) {
+	b.ops = append(b.ops, batchOp{cf: cf.name, key: key, value: value})
+}
+
+// DeleteCF 在批次中追加一次对列族 cf 的删除
+func (b *WriteBatch) DeleteCF(cf *ColumnFamily, key string) {
+	b.ops = append(b.ops, batchOp{cf: cf.name, key: key, tombstone: true})
+}
+
+// Len 返回批次中的操作数
+func (b *WriteBatch) Len() int {
+	return len(b.ops)
+}
+
+// Reset 清空批次以便复用
+func (b *WriteBatch) Reset() {
+	b.ops = b.ops[:0]
+	b.seq = 0
+}
+
+// Seq 返回最近一次通过 DB.Write 成功提交时分配的序列号，还未提交时返回 0
+//
+// 批次中的操作按顺序获得连续的序列号，Seq 是其中最后一个，即 Seq-Len()+1 到 Seq。
+// 序列号由引擎单调递增地分配，可以与 Snapshot.Seq、DB.LastSequence 比较，
+// 例如判断某个快照或 follower（见 DB.WriteChangesSince）是否已经包含这次写入
+func (b *WriteBatch) Seq() int64 {
+	return b.seq
+}
+
+// entries 为每个操作生成新的条目，同一个批次可以被多次提交
+func (b *WriteBatch) entries() []*sdbf.Entry {
+	entries := make([]*sdbf.Entry, len(b.ops))
+	for i, op := range b.ops {
+		entries[i] = &sdbf.Entry{
+			Key:          op.key,
+			Value:        op.value,
+			Tombstone:    op.tombstone,
+			ExpireAt:     op.expireAt,
+			ColumnFamily: op.cf,
+			RangeEnd:     op.rangeEnd,
+			UserMeta:     op.meta,
+		}
+	}
+	return entries
+}
+
+// Write 原子地提交一个批次
+func (db *DB) Write(b *WriteBatch) error {
+	return db.WriteWithOptions(b, WriteOptions{})
+}
+
+// batchOpOverhead 批量记录中每个条目除 key 与 value 之外编码开销的上界：
+// 长度前缀与 protobuf 的字段标签、长度、Version、ExpireAt、Checksum 等
+const batchOpOverhead = 64
+
+// checkBatch 检查批次中每个操作的大小，以及整个批次能否放进一条 WAL 记录
+func (db *DB) checkBatch(b *WriteBatch) error {
+	size := 0
+	for _, op := range b.ops {
+		if err := db.checkSize(op.key, op.value); err != nil {
+			return fmt.Errorf("key %s: %w", op.key, err)
+		}
+		if err := db.checkSize(op.rangeEnd, nil); err != nil {
+			return fmt.Errorf("range end %s: %w", op.rangeEnd, err)
+		}
+		if err := checkUserMeta(op.meta); err != nil {
+			return fmt.Errorf("key %s: %w", op.key, err)
+		}
+		size += len(op.cf) + len(op.key) + len(op.value) + len(op.rangeEnd) + len(op.meta) + batchOpOverhead
+	}
+	if int64(size) > db.opts.WALMaxRecordSize {
+		return fmt.Errorf("%w: about %d bytes, limit %d", ErrBatchTooLarge, size, db.opts.WALMaxRecordSize)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+// ErrNotInteger 值不是十进制整数或自增溢出，见 DB.Increment
+var ErrNotInteger = errors.New("value is not an integer or out of range")
+
+// VersionConflictError 是 CAS 与 CompareAndDelete 的前置条件不满足时返回的错误，
+// errors.Is(err, ErrConflict) 为 true
+type VersionConflictError struct {
+	Key string
+	// Expected 调用方期望的版本，Actual 提交时 key 的版本，两者为 0 都表示 key 不存在；
+	// 与同时提交的另一个写入冲突时那次写入还没有分配版本，Actual 为 -1
+	Expected int64
+	Actual   int64
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("%v: key %s: expected version %d, actual %d", ErrConflict, e.Key, e.Expected, e.Actual)
+}
+
+func (e *VersionConflictError) Unwrap() error { return ErrConflict }
+
+// versionCheck 是条件写入的前置条件：提交时 key 在默认列族中的可见版本必须等于 version
+type versionCheck struct {
+	key     string
+	version int64
+	// now 判断过期的时间点（Unix 纳秒），已过期的 key 视为不存在
+	now int64
+}
+
+// GetWithVersion 读取 key 的值以及它的版本（写入时分配的序列号），版本用于 CAS 与 CompareAndDelete
+func (db *DB) GetWithVersion(key string) ([]byte, int64, error) {
+	t := db.startOp("get", key, "")
+	defer t.done()
+
+	entry, err := db.getLive(key)
+	t.stage("memtable")
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := db.verifyEntry(entry); err != nil {
+		return nil, 0, err
+	}
+	return entry.Value, entry.Version, nil
+}
+
+// CAS 在 key 的当前版本等于 expectedVersion 时写入 newValue，返回写入分配的新版本；
+// expectedVersion 为 0 表示只在 key 不存在（或已删除、已过期）时写入
+//
+// 版本检查与写入在组提交的 leader 中原子地完成，与 Txn 的冲突检测相同，检查与写入之间不会插入其他提交。
+// 版本不匹配时返回 *VersionConflictError，不写入任何数据。可以在此基础上实现分布式锁、计数器等
+func (db *DB) CAS(key string, expectedVersion int64, newValue []byte) (int64, error) {
+	seq, err := db.compareAndWrite("cas", &sdbf.Entry{Key: key, Value: newValue}, expectedVersion)
+	if err != nil {
+		return 0, fmt.Errorf("cas %s: %w", key, err)
+	}
+	return seq, nil
+}
+
+// CompareAndDelete 在 key 的当前版本等于 expectedVersion 时删除它，返回删除分配的版本，语义同 CAS
+func (db *DB) CompareAndDelete(key string, expectedVersion int64) (int64, error) {
+	seq, err := db.compareAndWrite("delete", &sdbf.Entry{Key: key, Tombstone: true}, expectedVersion)
+	if err != nil {
+		return 0, fmt.Errorf("compare and delete %s: %w", key, err)
+	}
+	return seq, nil
+}
+
+// Increment 把 key 的值作为十进制整数加上 delta（可以为负数），返回新的值；key 不存在时视为 0
+//
+// 值以十进制文本存储（如 "42"），与 RESP 的 INCRBY 兼容，可以直接用 Get 读取。
+// 读取与写入通过 CAS 完成，与其他写入冲突时重新读取再试，并发的自增不会丢失更新；
+// 已有的过期时间保持不变。值不是整数或结果溢出 int64 时返回 ErrNotInteger
+func (db *DB) Increment(key string, delta int64) (int64, error) {
+	for {
+		var n, version, expireAt int64
+		entry, err := db.getLive(key)
+		switch {
+		case errors.Is(err, ErrNotFound):
+		case err != nil:
+			return 0, fmt.Errorf("increment %s: %w", key, err)
+		default:
+			if err := db.verifyEntry(entry); err != nil {
+				return 0, fmt.Errorf("increment %s: %w", key, err)
+			}
+			if n, err = strconv.ParseInt(string(entry.Value), 10, 64); err != nil {
+				return 0, fmt.Errorf("increment %s: %w", key, ErrNotInteger)
+			}
+			version, expireAt = entry.Version, entry.ExpireAt
+		}
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return 0, fmt.Errorf("increment %s: %w", key, ErrNotInteger)
+		}
+		n += delta
+
+		e := &sdbf.Entry{Key: key, Value: strconv.AppendInt(nil, n, 10), ExpireAt: expireAt}
+		_, err = db.compareAndWrite("increment", e, version)
+		var conflict *VersionConflictError
+		if errors.As(err, &conflict) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("increment %s: %w", key, err)
+		}
+		return n, nil
+	}
+}
+
+// compareAndWrite 在 entry.Key 的版本等于 expected 时提交 entry，返回分配的序列号
+func (db *DB) compareAndWrite(op string, entry *sdbf.Entry, expected int64) (int64, error) {
+	t := db.startOp(op, entry.Key, "")
+	defer t.done()
+
+	if err := db.checkSize(entry.Key, entry.Value); err != nil {
+		return 0, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return 0, ErrClosed
+	}
+	req := &commitRequest{
+		entries: []*sdbf.Entry{entry},
+		expect:  &versionCheck{key: entry.Key, version: expected, now: db.now().UnixNano()},
+	}
+	err := db.memTable.commitRequest(req)
+	t.commit(req)
+	if err != nil {
+		return 0, err
+	}
+	return entry.Version, nil
+}
+
+// checkVersion 检查 c.key 的可见版本是否等于 c.version，written 的含义同 checkConflict
+func (mt *MemTable) checkVersion(c *versionCheck, written *pendingWrites) error {
+	if written.contains(c.key) {
+		return &VersionConflictError{Key: c.key, Expected: c.version, Actual: -1}
+	}
+	var actual int64
+	if e, ok := mt.Get(c.key); ok && isLive(e, c.now) {
+		actual = e.Version
+	}
+	if actual != c.version {
+		return &VersionConflictError{Key: c.key, Expected: c.version, Actual: actual}
+	}
+	return nil
+}
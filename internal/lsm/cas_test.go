@@ -0,0 +1,177 @@
+package lsm
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDB_CAS(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	db.now = clock.Now
+
+	// version 记录每一步成功之后 key 的版本，供后续步骤引用
+	var version int64
+	tests := []struct {
+		name string
+		op   func() (int64, error)
+		// actual 返回冲突时期望的当前版本，为 nil 表示期望成功
+		actual func() int64
+	}{
+		{"不存在时创建", func() (int64, error) { return db.CAS("k", 0, []byte("1")) }, nil},
+		{"已存在时创建失败", func() (int64, error) { return db.CAS("k", 0, []byte("2")) }, func() int64 { return version }},
+		{"版本匹配", func() (int64, error) { return db.CAS("k", version, []byte("2")) }, nil},
+		{"版本过旧", func() (int64, error) { return db.CAS("k", version-1, []byte("3")) }, func() int64 { return version }},
+		{"删除版本不匹配", func() (int64, error) { return db.CompareAndDelete("k", version+1) }, func() int64 { return version }},
+		{"删除", func() (int64, error) { return db.CompareAndDelete("k", version) }, nil},
+		{"删除之后版本失效", func() (int64, error) { return db.CAS("k", version, []byte("4")) }, func() int64 { return 0 }},
+		{"删除之后重新创建", func() (int64, error) { return db.CAS("k", 0, []byte("5")) }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seq, err := tt.op()
+			if tt.actual == nil {
+				if err != nil || seq <= version {
+					t.Fatalf("期望成功且版本大于 %d, 实际 %d, err=%v", version, seq, err)
+				}
+				version = seq
+				return
+			}
+			var conflict *VersionConflictError
+			if !errors.As(err, &conflict) || !errors.Is(err, ErrConflict) || conflict.Actual != tt.actual() {
+				t.Fatalf("期望当前版本为 %d 的冲突, 实际 %v", tt.actual(), err)
+			}
+		})
+	}
+
+	if value, v, err := db.GetWithVersion("k"); err != nil || string(value) != "5" || v != version {
+		t.Fatalf("期望 5@%d, 实际 %q@%d, err=%v", version, value, v, err)
+	}
+
+	// 已过期的 key 视为不存在
+	if err := db.SetWithTTL("ttl", []byte("v"), time.Second); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	clock.Advance(2 * time.Second)
+	if _, err := db.CAS("ttl", 0, []byte("v")); err != nil {
+		t.Fatalf("过期之后创建失败: %v", err)
+	}
+	if _, _, err := db.GetWithVersion("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("期望 ErrNotFound, 实际 %v", err)
+	}
+}
+
+// 并发的 CAS 自增不丢失更新
+func TestDB_CASCounter(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+
+	const workers, increments = 8, 50
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range increments {
+				for {
+					value, version, err := db.GetWithVersion("counter")
+					if errors.Is(err, ErrNotFound) {
+						value, version, err = []byte("0"), 0, nil
+					}
+					if err != nil {
+						t.Errorf("读取失败: %v", err)
+						return
+					}
+					n, _ := strconv.Atoi(string(value))
+					_, err = db.CAS("counter", version, []byte(strconv.Itoa(n+1)))
+					if err == nil {
+						break
+					}
+					if !errors.Is(err, ErrConflict) {
+						t.Errorf("CAS 失败: %v", err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if value, err := db.Get("counter"); err != nil || string(value) != strconv.Itoa(workers*increments) {
+		t.Fatalf("期望 %d, 实际 %q, err=%v", workers*increments, value, err)
+	}
+}
+
+func TestDB_Increment(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+	if err := db.Set("text", []byte("abc")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Set("max", []byte(strconv.FormatInt(math.MaxInt64, 10))); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		key   string
+		delta int64
+		want  int64
+		err   error
+	}{
+		{"不存在时从 0 开始", "n", 5, 5, nil},
+		{"自增", "n", 1, 6, nil},
+		{"自减", "n", -10, -4, nil},
+		{"非整数", "text", 1, 0, ErrNotInteger},
+		{"溢出", "max", 1, 0, ErrNotInteger},
+		{"不溢出", "max", -1, math.MaxInt64 - 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.Increment(tt.key, tt.delta)
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Fatalf("期望 %d, %v, 实际 %d, %v", tt.want, tt.err, got, err)
+			}
+		})
+	}
+	if value, err := db.Get("n"); err != nil || string(value) != "-4" {
+		t.Fatalf("期望 -4, 实际 %q, err=%v", value, err)
+	}
+
+	// 保留过期时间
+	if err := db.SetWithTTL("ttl", []byte("1"), time.Hour); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	before, _ := db.ExpireAt("ttl")
+	if _, err := db.Increment("ttl", 1); err != nil {
+		t.Fatalf("自增失败: %v", err)
+	}
+	if after, err := db.ExpireAt("ttl"); err != nil || !after.Equal(before) {
+		t.Fatalf("过期时间期望 %v, 实际 %v, err=%v", before, after, err)
+	}
+
+	// 并发自增不丢失更新
+	const workers, increments = 8, 50
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range increments {
+				if _, err := db.Increment("counter", 1); err != nil {
+					t.Errorf("自增失败: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n, err := db.Increment("counter", 0); err != nil || n != workers*increments {
+		t.Fatalf("期望 %d, 实际 %d, err=%v", workers*increments, n, err)
+	}
+}
@@ -0,0 +1,121 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+// ErrInMemory 操作依赖磁盘上的数据文件，纯内存数据库不支持
+var ErrInMemory = errors.New("not supported by in-memory databases")
+
+// Checkpoint 在 dir 目录中生成数据库当前状态的一份廉价的磁盘快照，dir 可以直接用 Open 打开，
+// 用于启动只读副本或离线分析
+//
+// 与 Backup 不同，Checkpoint 不重写数据：已封存的 WAL 段不再修改，直接创建硬链接
+// （文件系统不支持硬链接时退化为复制），只有活跃段复制调用时已写入的部分。
+// 因此 dir 必须与数据库位于同一个文件系统（Options.FS）上，要求同 Backup：不存在或为空目录。
+// 复制活跃段期间会短暂阻塞写入
+func (db *DB) Checkpoint(dir string) error {
+	if db.wal == nil {
+		return fmt.Errorf("checkpoint %s: %w", dir, ErrInMemory)
+	}
+	fsys := db.opts.FS
+
+	dirExisted, err := checkEmptyDir(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("checkpoint %s: %w", dir, err)
+	}
+	walDir := filepath.Join(dir, walDirName)
+	if err := fsys.MkdirAll(walDir, 0755); err != nil {
+		return fmt.Errorf("checkpoint %s: create wal dir %s: %w", dir, walDir, err)
+	}
+
+	segments, err := db.wal.checkpoint(walDir)
+	if err != nil {
+		// 清理已链接或复制的段，使 dir 恢复到调用之前的状态
+		names, _ := fsys.List(walDir)
+		cleanup := make([]string, 0, len(names)+2)
+		for _, name := range names {
+			cleanup = append(cleanup, filepath.Join(walDir, name))
+		}
+		cleanup = append(cleanup, walDir)
+		if !dirExisted {
+			cleanup = append(cleanup, dir)
+		}
+		for _, p := range cleanup {
+			if rerr := fsys.Remove(p); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) {
+				slog.Warn("remove incomplete checkpoint", "path", p, "err", rerr)
+			}
+		}
+		return fmt.Errorf("checkpoint %s: %w", dir, err)
+	}
+
+	slog.Info("db checkpoint finished", "dir", db.dir, "dst", dir, "segments", segments)
+	return nil
+}
+
+// checkpoint 把所有段写到 dstDir 下的同名文件，返回段的数量
+//
+// 持有写锁期间链接封存的段并记录活跃段的大小，此时没有进行中的写入，
+// 活跃段的前 size 字节都是完整的记录；释放锁之后写入只会在其后追加，再复制这部分即可
+func (m *WALManager) checkpoint(dstDir string) (int, error) {
+	m.mu.Lock()
+	segments := len(m.segments)
+	activeID := m.segments[len(m.segments)-1]
+	for _, id := range m.segments[:len(m.segments)-1] {
+		src, dst := filepath.Join(m.dir, segmentName(id)), filepath.Join(dstDir, segmentName(id))
+		if err := m.fs.Link(src, dst); err != nil {
+			slog.Warn("link wal segment failed, copy instead", "src", src, "err", err)
+			if err := copyFile(m.fs, src, dst); err != nil {
+				m.mu.Unlock()
+				return 0, err
+			}
+		}
+	}
+	size := m.active.Size()
+	// 在锁内打开活跃段，之后即使段被切换和删除，已打开的文件仍然可读
+	src := filepath.Join(m.dir, segmentName(activeID))
+	fd, err := m.fs.Open(src)
+	m.mu.Unlock()
+	if err != nil {
+		return 0, fmt.Errorf("open active wal %s: %w", src, err)
+	}
+	defer fd.Close()
+
+	if err := copyFrom(m.fs, fd, filepath.Join(dstDir, segmentName(activeID)), size); err != nil {
+		return 0, fmt.Errorf("copy active wal %s: %w", src, err)
+	}
+	return segments, syncDir(m.fs, dstDir)
+}
+
+// copyFile 把 src 的全部内容复制为 dst
+func copyFile(fsys vfs.FS, src, dst string) error {
+	fd, err := fsys.Open(src)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", src, err)
+	}
+	defer fd.Close()
+	if err := copyFrom(fsys, fd, dst, -1); err != nil {
+		return fmt.Errorf("copy %s: %w", src, err)
+	}
+	return nil
+}
+
+// copyFrom 把 fd 当前位置起的 n 个字节（n < 0 时为剩余全部）写为 dst
+func copyFrom(fsys vfs.FS, fd vfs.File, dst string, n int64) error {
+	return writeFileAtomic(fsys, dst, func(w vfs.File) error {
+		var err error
+		if n < 0 {
+			_, err = io.Copy(w, fd)
+		} else {
+			_, err = io.CopyN(w, fd, n)
+		}
+		return err
+	})
+}
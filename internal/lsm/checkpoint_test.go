@@ -0,0 +1,96 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+func TestDB_Checkpoint(t *testing.T) {
+	tests := []struct {
+		name string
+		fs   vfs.FS
+		dir  func(t *testing.T) string
+	}{
+		{name: "磁盘", fs: vfs.OSFS{}, dir: func(t *testing.T) string { return t.TempDir() }},
+		{name: "MemFS", fs: vfs.NewMemFS(), dir: func(t *testing.T) string { return "/" + t.Name() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.FS = tt.fs
+			opts.WALSegmentSize = 128
+			dir := tt.dir(t)
+			db, err := Open(filepath.Join(dir, "db"), opts)
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+			defer db.Close()
+
+			want := map[string]string{}
+			for i := range 20 {
+				k, v := fmt.Sprintf("key%02d", i), fmt.Sprint(i)
+				if err := db.Set(k, []byte(v)); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+				want[k] = v
+			}
+			if len(db.wal.Segments()) < 2 {
+				t.Fatalf("期望写入跨越多个段, 实际 %v", db.wal.Segments())
+			}
+
+			cp := filepath.Join(dir, "checkpoint")
+			if err := db.Checkpoint(cp); err != nil {
+				t.Fatalf("生成检查点失败: %v", err)
+			}
+			// 检查点之后的写入不属于检查点
+			if err := db.Set("after", []byte("x")); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+
+			if _, ok := tt.fs.(vfs.OSFS); ok {
+				// 封存的段以硬链接的方式共享
+				sealed := segmentName(db.wal.Segments()[0])
+				src, _ := os.Stat(filepath.Join(dir, "db", walDirName, sealed))
+				dst, _ := os.Stat(filepath.Join(cp, walDirName, sealed))
+				if !os.SameFile(src, dst) {
+					t.Fatalf("期望封存的段 %s 为硬链接", sealed)
+				}
+			}
+
+			cpDB, err := Open(cp, opts)
+			if err != nil {
+				t.Fatalf("打开检查点失败: %v", err)
+			}
+			defer cpDB.Close()
+			if got := dumpDB(t, cpDB); !maps.Equal(got, want) {
+				t.Fatalf("期望 %v, 实际 %v", want, got)
+			}
+			// 检查点是独立的数据库，写入互不影响
+			if err := cpDB.Set("cp-only", nil); err != nil {
+				t.Fatalf("写入检查点失败: %v", err)
+			}
+			if _, err := db.Get("cp-only"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("期望 %v, 实际 %v", ErrNotFound, err)
+			}
+
+			if err := db.Checkpoint(cp); !errors.Is(err, ErrBackupDirNotEmpty) {
+				t.Fatalf("期望 %v, 实际 %v", ErrBackupDirNotEmpty, err)
+			}
+		})
+	}
+}
+
+func TestDB_CheckpointInMemory(t *testing.T) {
+	db := openTestDB(t, InMemory)
+	defer db.Close()
+	if err := db.Checkpoint(t.TempDir()); !errors.Is(err, ErrInMemory) {
+		t.Fatalf("期望 %v, 实际 %v", ErrInMemory, err)
+	}
+}
@@ -0,0 +1,191 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+)
+
+// ErrUnloggedNotTracked 指定了 CloseOptions.FlushUnlogged，但打开时没有启用 Options.TrackUnloggedWrites
+var ErrUnloggedNotTracked = errors.New("unlogged writes are not tracked")
+
+// CloseOptions 控制 CloseWithOptions，零值与 Close 的行为相同
+type CloseOptions struct {
+	// FlushUnlogged 为 true 时把 WriteOptions.DisableWAL 写入的数据在关闭前补写到 WAL，
+	// 重新打开后仍然存在；为 false 时这些数据在关闭后丢失。需要在打开时启用 Options.TrackUnloggedWrites，
+	// 否则 CloseWithOptions 返回 ErrUnloggedNotTracked，不关闭数据库。纯内存数据库忽略该选项
+	FlushUnlogged bool
+}
+
+// Close 关闭数据库，等待进行中的操作完成，见 CloseWithOptions
+func (db *DB) Close() error {
+	return db.CloseWithOptions(context.Background(), CloseOptions{})
+}
+
+// CloseWithOptions 按 co 关闭数据库，ctx 限制等待的时间
+//
+// 关闭依次：拒绝新的操作（之后的调用返回 ErrClosed），等待进行中的读写与异步写入完成，
+// 按 co.FlushUnlogged 处理没有写入 WAL 的数据，停止后台的 fsync、校验与归档并 fsync 活跃段，
+// 最后释放目录锁。其他数据都已经在 WAL 中，重新打开时恢复。
+//
+// ctx 在关闭完成之前到期时返回包装了 ctx.Err() 的错误，关闭在后台继续进行；
+// 之后再次调用会等待它完成并返回同样的结果。重复调用时只有第一次的 co 生效
+func (db *DB) CloseWithOptions(ctx context.Context, co CloseOptions) error {
+	if co.FlushUnlogged && db.wal != nil && !db.opts.TrackUnloggedWrites {
+		return fmt.Errorf("close db %s: flush unlogged writes: %w", db.dir, ErrUnloggedNotTracked)
+	}
+	db.closeOnce.Do(func() { go db.close(co) })
+	select {
+	case <-db.closeDone:
+		return db.closeErr
+	case <-ctx.Done():
+		return fmt.Errorf("close db %s: %w", db.dir, ctx.Err())
+	}
+}
+
+// close 执行关闭的全部步骤，完成后把结果写入 closeErr 并关闭 closeDone
+func (db *DB) close(co CloseOptions) {
+	defer close(db.closeDone)
+
+	// 获取写锁等待持有读锁的操作完成；之后的操作都会看到 closed，不再访问 WAL 与 MemTable
+	db.mu.Lock()
+	db.closed = true
+	db.mu.Unlock()
+	// 异步写入不持有 db.mu，必须在关闭 WAL 之前等待它们完成
+	db.async.Wait()
+
+	if db.wal == nil {
+		slog.Info("db closed", "dir", db.dir)
+		return
+	}
+	var err error
+	if co.FlushUnlogged {
+		var n int
+		if n, err = db.memTable.flushUnlogged(); err != nil {
+			err = fmt.Errorf("flush unlogged writes: %w", err)
+		} else if n > 0 {
+			slog.Info("unlogged writes flushed", "dir", db.dir, "entries", n)
+		}
+	}
+	// 无论之前的步骤是否成功都关闭 WAL 并释放锁，否则本进程之后无法重新打开该目录
+	if werr := db.wal.Close(); err == nil {
+		err = werr
+	}
+	if lerr := db.lock.Close(); err == nil && lerr != nil {
+		err = fmt.Errorf("release lock: %w", lerr)
+	}
+	if err != nil {
+		db.closeErr = fmt.Errorf("close db %s: %w", db.dir, err)
+		slog.Error("db close", "dir", db.dir, "err", err)
+		return
+	}
+	slog.Info("db closed", "dir", db.dir)
+}
+
+// unloggedKey 标识 MemTable.unlogged 中的一个 key
+type unloggedKey struct {
+	family, key string
+}
+
+// recordUnlogged 记录本组中没有写入 WAL 的条目，只在启用 Options.TrackUnloggedWrites 时
+// 由组提交的 leader 在写入 WAL 之后调用
+//
+// 写入 WAL 的点写入会移除同 key 之前的记录，因此 unlogged 中的条目总是该 key 最新的写入；
+// 没有记录时写入 WAL 的请求直接跳过
+func (mt *MemTable) recordUnlogged(accepted []*commitRequest) {
+	for _, r := range accepted {
+		if !r.disableWAL && len(mt.unlogged) == 0 {
+			continue
+		}
+		for _, e := range r.entries {
+			k := unloggedKey{family: e.ColumnFamily, key: e.Key}
+			switch {
+			case e.RangeEnd != "":
+				if r.disableWAL {
+					mt.unloggedRanges = append(mt.unloggedRanges, e)
+				}
+			case r.disableWAL:
+				if mt.unlogged == nil {
+					mt.unlogged = make(map[unloggedKey]*sdbf.Entry)
+				}
+				mt.unlogged[k] = e
+			default:
+				delete(mt.unlogged, k)
+			}
+		}
+	}
+}
+
+// flushUnlogged 把没有写入 WAL 的数据作为新的写入提交到 WAL，返回提交的条目数；调用方保证没有并发的写入
+//
+// 补写的条目使用新的序列号，WAL 中的序列号保持递增，不影响恢复、订阅与复制。
+// 为此不能原样补写条目：新的序列号会让范围墓碑删除在它之后写入的数据，
+// 也会让被之后的范围墓碑删除的点写入重新可见。因此补写的是这些写入造成的结果：
+//   - 点写入仍然可见时补写一份，已被范围墓碑删除时补写一个点墓碑
+//   - 范围墓碑删除的其他 key（最新的写入在 WAL 中）各补写一个点墓碑
+//
+// 重新打开后这些 key 的状态与关闭前相同
+func (mt *MemTable) flushUnlogged() (int, error) {
+	var entries []*sdbf.Entry
+	deleted := make(map[unloggedKey]struct{})
+	mt.mu.Lock()
+	for k, e := range mt.unlogged {
+		f := mt.familyLocked(k.family)
+		if f.rangeDels.mask(e, math.MaxInt64) != e {
+			// 已被范围墓碑删除，WAL 中可能还有更旧的版本，用点墓碑覆盖
+			entries = append(entries, &sdbf.Entry{Key: e.Key, Tombstone: true, ColumnFamily: e.ColumnFamily})
+			continue
+		}
+		entries = append(entries, &sdbf.Entry{
+			Key:          e.Key,
+			Value:        e.Value,
+			Tombstone:    e.Tombstone,
+			ExpireAt:     e.ExpireAt,
+			ColumnFamily: e.ColumnFamily,
+			UserMeta:     e.UserMeta,
+		})
+	}
+	for _, t := range mt.unloggedRanges {
+		f := mt.familyLocked(t.ColumnFamily)
+		for _, e := range f.list.All() {
+			k := unloggedKey{family: t.ColumnFamily, key: e.Key}
+			if utils.CompareKey(e.Key, t.Key) < 0 || utils.CompareKey(e.Key, t.RangeEnd) >= 0 {
+				continue
+			}
+			if _, ok := mt.unlogged[k]; ok {
+				// 最新的写入没有写入 WAL，已在上面按点写入处理
+				continue
+			}
+			if _, ok := deleted[k]; ok {
+				continue
+			}
+			if latest, ok := f.list.Get(e.Key); !ok || latest.Tombstone || f.rangeDels.mask(latest, math.MaxInt64) == latest {
+				continue
+			}
+			deleted[k] = struct{}{}
+			entries = append(entries, &sdbf.Entry{Key: e.Key, Tombstone: true, ColumnFamily: t.ColumnFamily})
+		}
+	}
+	mt.mu.Unlock()
+
+	// 按列族与 key 排序，得到确定的写入顺序
+	slices.SortFunc(entries, func(a, b *sdbf.Entry) int {
+		if c := utils.CompareKey(a.ColumnFamily, b.ColumnFamily); c != 0 {
+			return c
+		}
+		return utils.CompareKey(a.Key, b.Key)
+	})
+	// 逐条提交，每条记录都不超过原来写入时的大小；关闭 WAL 时统一 fsync
+	for i, e := range entries {
+		if err := mt.commitRequest(&commitRequest{entries: []*sdbf.Entry{e}, noSync: true}); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
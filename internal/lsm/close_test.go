@@ -0,0 +1,158 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// 测试 FlushUnlogged：DisableWAL 写入在关闭时补写到 WAL，重新打开后与关闭前的状态相同；
+// 不补写时丢失，只留下写入 WAL 的数据
+func TestDB_CloseWithOptions_FlushUnlogged(t *testing.T) {
+	tests := []struct {
+		name  string
+		flush bool
+		// want 重新打开后各个 key 的值，空字符串表示不存在
+		want map[string]string
+	}{
+		{name: "补写", flush: true, want: map[string]string{
+			"a": "2", "b": "2", "c": "1", "d1": "", "d2": "2", "f": "", "meta/m": "1",
+		}},
+		{name: "丢弃", want: map[string]string{
+			"a": "1", "b": "2", "c": "", "d1": "1", "d2": "2", "f": "1", "meta/m": "",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := Open(dir, Options{SyncMode: NoSync, TrackUnloggedWrites: true})
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+			cf, err := db.CF("meta")
+			if err != nil {
+				t.Fatalf("创建列族失败: %v", err)
+			}
+			write := func(disableWAL bool, fill func(b *WriteBatch)) {
+				b := NewWriteBatch()
+				fill(b)
+				if err := db.WriteWithOptions(b, WriteOptions{DisableWAL: disableWAL}); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+			}
+			// a：之后的 DisableWAL 写入覆盖 WAL 中的版本
+			write(false, func(b *WriteBatch) { b.Set("a", []byte("1")) })
+			write(true, func(b *WriteBatch) { b.Set("a", []byte("2")) })
+			// b：DisableWAL 写入被之后写入 WAL 的写入覆盖
+			write(true, func(b *WriteBatch) { b.Set("b", []byte("1")) })
+			write(false, func(b *WriteBatch) { b.Set("b", []byte("2")) })
+			// c 与列族中的 m：只存在于 MemTable
+			write(true, func(b *WriteBatch) {
+				b.Set("c", []byte("1"))
+				b.SetCF(cf, "m", []byte("1"))
+			})
+			// d：DisableWAL 的范围删除，之后写入 WAL 的 d2 不受影响
+			write(false, func(b *WriteBatch) {
+				b.Set("d1", []byte("1"))
+				b.Set("d2", []byte("1"))
+			})
+			write(true, func(b *WriteBatch) { b.DeleteRange("d", "e") })
+			write(false, func(b *WriteBatch) { b.Set("d2", []byte("2")) })
+			// f：DisableWAL 的写入又被 DisableWAL 的范围删除删除
+			write(false, func(b *WriteBatch) { b.Set("f", []byte("1")) })
+			write(true, func(b *WriteBatch) { b.Set("f", []byte("2")) })
+			write(true, func(b *WriteBatch) { b.DeleteRange("f", "g") })
+
+			if err := db.CloseWithOptions(context.Background(), CloseOptions{FlushUnlogged: tt.flush}); err != nil {
+				t.Fatalf("关闭失败: %v", err)
+			}
+
+			db, err = Open(dir, Options{SyncMode: NoSync})
+			if err != nil {
+				t.Fatalf("重新打开失败: %v", err)
+			}
+			defer db.Close()
+			cf, err = db.CF("meta")
+			if err != nil {
+				t.Fatalf("打开列族失败: %v", err)
+			}
+			for key, want := range tt.want {
+				get := db.Get
+				if key == "meta/m" {
+					get = func(string) ([]byte, error) { return cf.Get("m") }
+				}
+				got, err := get(key)
+				if want == "" {
+					if !errors.Is(err, ErrNotFound) {
+						t.Errorf("%s: 期望不存在, 实际 %q %v", key, got, err)
+					}
+					continue
+				}
+				if err != nil || string(got) != want {
+					t.Errorf("%s: 期望 %q, 实际 %q %v", key, want, got, err)
+				}
+			}
+			// 补写使用新的序列号，之后的写入仍然可以正常分配序列号
+			if err := db.Set("z", []byte("1")); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+		})
+	}
+}
+
+// 测试没有启用 TrackUnloggedWrites 时不记录 DisableWAL 写入，FlushUnlogged 被拒绝且数据库保持打开
+func TestDB_CloseWithOptions_NotTracked(t *testing.T) {
+	db, err := Open(t.TempDir(), Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	b := NewWriteBatch()
+	b.Set("k", []byte("v"))
+	b.DeleteRange("a", "b")
+	if err := db.WriteWithOptions(b, WriteOptions{DisableWAL: true}); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if db.memTable.unlogged != nil || db.memTable.unloggedRanges != nil {
+		t.Fatalf("未启用时不应记录 DisableWAL 写入: %v %v", db.memTable.unlogged, db.memTable.unloggedRanges)
+	}
+
+	if err := db.CloseWithOptions(context.Background(), CloseOptions{FlushUnlogged: true}); !errors.Is(err, ErrUnloggedNotTracked) {
+		t.Fatalf("期望 ErrUnloggedNotTracked, 实际 %v", err)
+	}
+	if _, err := db.Get("k"); err != nil {
+		t.Fatalf("被拒绝的关闭不应关闭数据库: %v", err)
+	}
+}
+
+// 测试等待进行中的操作超过 ctx 的期限时返回错误，关闭在后台完成后再次调用返回结果并释放目录锁
+func TestDB_CloseWithOptions_Deadline(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	// 模拟一个持有读锁、尚未结束的操作
+	db.mu.RLock()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := db.CloseWithOptions(ctx, CloseOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("期望 DeadlineExceeded, 实际 %v", err)
+	}
+	db.mu.RUnlock()
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	if err := db.Set("k", []byte("v")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("期望 ErrClosed, 实际 %v", err)
+	}
+	db, err = Open(dir, Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	db.Close()
+}
@@ -0,0 +1,159 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+var (
+	// ErrInvalidColumnFamily 列族名称不合法
+	ErrInvalidColumnFamily = errors.New("invalid column family name")
+	// ErrColumnFamilyNotFound LookupCF 的列族不存在
+	ErrColumnFamilyNotFound = errors.New("column family not found")
+)
+
+const (
+	// DefaultColumnFamily 默认列族的名称，DB 自身的 Get/Set/Scan 等方法读写的就是它
+	DefaultColumnFamily = "default"
+	// maxColumnFamilyName 列族名称的最大长度，名称随每个条目写入 WAL，不宜过长
+	maxColumnFamilyName = 255
+)
+
+// ColumnFamily 是数据库中一个独立的 key 空间（列族）：不同列族中的同名 key 互不影响
+//
+// 每个列族有自己的 MemTable 跳表，所有列族共享 WAL、组提交与序列号，
+// 因此跨列族的 WriteBatch 同样是原子的。WAL 中的每个条目记录了所属的列族，
+// 恢复、备份与复制时据此把条目放回对应的列族，不需要额外的元数据文件。
+//
+// 列族在第一次通过 DB.CF 获取时创建，创建记录写入 WAL，没有数据的列族在重启之后同样存在。
+// 快照与事务目前只覆盖默认列族。ColumnFamily 是并发安全的
+type ColumnFamily struct {
+	db *DB
+	// name 写入条目的列族名称，默认列族为空字符串
+	name string
+	f    *memFamily
+}
+
+// CF 返回名为 name 的列族，不存在时创建；name 为 DefaultColumnFamily 时返回默认列族
+func (db *DB) CF(name string) (*ColumnFamily, error) {
+	if name == "" || len(name) > maxColumnFamilyName {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidColumnFamily, name)
+	}
+	if name == DefaultColumnFamily {
+		name = ""
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+	f, err := db.memTable.createFamily(name)
+	if err != nil {
+		return nil, err
+	}
+	return &ColumnFamily{db: db, name: name, f: f}, nil
+}
+
+// LookupCF 返回已存在的名为 name 的列族，不存在时返回 ErrColumnFamilyNotFound，不会创建；
+// 适用于只读的调用方，例如不应在 WAL 中留下创建记录的只读请求
+func (db *DB) LookupCF(name string) (*ColumnFamily, error) {
+	if name == "" || len(name) > maxColumnFamilyName {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidColumnFamily, name)
+	}
+	if name == DefaultColumnFamily {
+		name = ""
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+	f, ok := db.memTable.lookupFamily(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrColumnFamilyNotFound, name)
+	}
+	return &ColumnFamily{db: db, name: name, f: f}, nil
+}
+
+// ColumnFamilies 返回所有列族的名称，默认列族在前，其余按名称排序
+func (db *DB) ColumnFamilies() ([]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+	names, _ := db.memTable.allFamilies()
+	names[0] = DefaultColumnFamily
+	return names, nil
+}
+
+// Name 返回列族的名称
+func (cf *ColumnFamily) Name() string {
+	if cf.name == "" {
+		return DefaultColumnFamily
+	}
+	return cf.name
+}
+
+// Get 返回 key 对应的值，key 不存在、已被删除或已过期时返回 ErrNotFound
+func (cf *ColumnFamily) Get(key string) ([]byte, error) {
+	return cf.GetWithOptions(key, ReadOptions{})
+}
+
+// Set 写入或覆盖一个键值对
+func (cf *ColumnFamily) Set(key string, value []byte) error {
+	return cf.write(&sdbf.Entry{Key: key, Value: value})
+}
+
+// SetWithTTL 写入一个键值对，ttl 之后该 key 视为不存在，见 DB.SetWithTTL
+func (cf *ColumnFamily) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("cf %s: set %s: %w", cf.Name(), key, ErrInvalidTTL)
+	}
+	return cf.write(&sdbf.Entry{Key: key, Value: value, ExpireAt: cf.db.now().Add(ttl).UnixNano()})
+}
+
+// Delete 写入一个墓碑标记，之后的 Get 将返回 ErrNotFound
+func (cf *ColumnFamily) Delete(key string) error {
+	return cf.write(&sdbf.Entry{Key: key, Tombstone: true})
+}
+
+func (cf *ColumnFamily) write(entry *sdbf.Entry) error {
+	if err := cf.db.checkSize(entry.Key, entry.Value); err != nil {
+		return fmt.Errorf("cf %s: write %s: %w", cf.Name(), entry.Key, err)
+	}
+	entry.ColumnFamily = cf.name
+
+	cf.db.mu.RLock()
+	defer cf.db.mu.RUnlock()
+
+	if cf.db.closed {
+		return ErrClosed
+	}
+	if err := cf.db.memTable.commit([]*sdbf.Entry{entry}); err != nil {
+		return fmt.Errorf("cf %s: write %s: %w", cf.Name(), entry.Key, err)
+	}
+	return nil
+}
+
+// Scan 返回 [start, end] 区间内所有未被删除的条目，按 key 有序
+func (cf *ColumnFamily) Scan(start, end string) ([]*sdbf.Entry, error) {
+	return cf.ScanWithOptions(start, end, ReadOptions{})
+}
+
+// NewIterator 返回遍历整个列族的迭代器，语义同 DB.NewIterator
+func (cf *ColumnFamily) NewIterator() (*SnapshotIterator, error) {
+	snap, err := cf.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return newSnapshotIterator(snap, newLiveIterator(cf.f.iterator(snap.seq), cf.db.now())), nil
+}
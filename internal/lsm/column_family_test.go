@@ -0,0 +1,159 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// 测试列族之间相互隔离，跨列族的批次原子提交，重新打开与备份后列族的数据保持不变
+func TestDB_ColumnFamily(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir)
+
+	users, err := db.CF("users")
+	if err != nil {
+		t.Fatalf("获取列族失败: %v", err)
+	}
+	if err := db.Set("k", []byte("default")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := users.Set("k", []byte("users")); err != nil {
+		t.Fatalf("写入列族失败: %v", err)
+	}
+	if err := users.Set("gone", []byte("x")); err != nil {
+		t.Fatalf("写入列族失败: %v", err)
+	}
+	if err := users.Delete("gone"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+
+	orders, err := db.CF("orders")
+	if err != nil {
+		t.Fatalf("获取列族失败: %v", err)
+	}
+	b := NewWriteBatch()
+	b.SetCF(orders, "o1", []byte("1"))
+	b.SetCF(users, "u1", []byte("1"))
+	b.Set("d1", []byte("1"))
+	if err := db.Write(b); err != nil {
+		t.Fatalf("批量写入失败: %v", err)
+	}
+
+	check := func(t *testing.T, db *DB) {
+		t.Helper()
+		want := map[string]map[string]string{
+			DefaultColumnFamily: {"k": "default", "d1": "1"},
+			"users":             {"k": "users", "u1": "1"},
+			"orders":            {"o1": "1"},
+		}
+		names, err := db.ColumnFamilies()
+		if err != nil {
+			t.Fatalf("列出列族失败: %v", err)
+		}
+		if !slices.Equal(names, []string{DefaultColumnFamily, "orders", "users"}) {
+			t.Fatalf("列族列表不符: %v", names)
+		}
+		for name, kvs := range want {
+			cf, err := db.CF(name)
+			if err != nil {
+				t.Fatalf("获取列族 %s 失败: %v", name, err)
+			}
+			entries, err := cf.Scan("", "\xff")
+			if err != nil {
+				t.Fatalf("扫描列族 %s 失败: %v", name, err)
+			}
+			got := map[string]string{}
+			for _, e := range entries {
+				got[e.Key] = string(e.Value)
+			}
+			if len(got) != len(kvs) {
+				t.Fatalf("列族 %s: 期望 %v, 实际 %v", name, kvs, got)
+			}
+			for k, v := range kvs {
+				if got[k] != v {
+					t.Fatalf("列族 %s: 期望 %v, 实际 %v", name, kvs, got)
+				}
+			}
+		}
+		if _, err := db.Get("u1"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("其他列族的 key 不应出现在默认列族中, 实际 %v", err)
+		}
+	}
+	check(t, db)
+
+	dst := filepath.Join(t.TempDir(), "backup")
+	if err := db.Backup(context.Background(), dst); err != nil {
+		t.Fatalf("备份失败: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	t.Run("重新打开", func(t *testing.T) {
+		db := openTestDB(t, dir)
+		defer db.Close()
+		check(t, db)
+	})
+	t.Run("备份", func(t *testing.T) {
+		db := openTestDB(t, dst)
+		defer db.Close()
+		check(t, db)
+	})
+}
+
+func TestDB_ColumnFamily_InvalidName(t *testing.T) {
+	db, err := Open(InMemory, DefaultOptions())
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	for _, name := range []string{"", string(make([]byte, maxColumnFamilyName+1))} {
+		if _, err := db.CF(name); !errors.Is(err, ErrInvalidColumnFamily) {
+			t.Fatalf("名称长度 %d: 期望 ErrInvalidColumnFamily, 实际 %v", len(name), err)
+		}
+	}
+	cf, err := db.CF(DefaultColumnFamily)
+	if err != nil {
+		t.Fatalf("获取默认列族失败: %v", err)
+	}
+	if err := cf.Set("k", []byte("v")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if v, err := db.Get("k"); err != nil || string(v) != "v" {
+		t.Fatalf("默认列族的句柄应与 DB 读写同一份数据, 实际 %q, %v", v, err)
+	}
+}
+
+// 测试 LookupCF 只返回已存在的列族，不会创建
+func TestDB_LookupCF(t *testing.T) {
+	db, err := Open(t.TempDir(), Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.CF("meta"); err != nil {
+		t.Fatalf("创建列族失败: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		wantErr error
+	}{
+		{name: DefaultColumnFamily},
+		{name: "meta"},
+		{name: "missing", wantErr: ErrColumnFamilyNotFound},
+		{name: "", wantErr: ErrInvalidColumnFamily},
+	}
+	for _, tt := range tests {
+		if _, err := db.LookupCF(tt.name); !errors.Is(err, tt.wantErr) {
+			t.Fatalf("%q: 期望 %v, 实际 %v", tt.name, tt.wantErr, err)
+		}
+	}
+	if names, err := db.ColumnFamilies(); err != nil || len(names) != 2 {
+		t.Fatalf("LookupCF 不应创建列族: %v %v", names, err)
+	}
+}
@@ -0,0 +1,247 @@
+package lsm
+
+import (
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// crashOp 崩溃测试中的一次提交，batch 中的所有操作原子生效
+type crashOp struct {
+	batch []batchOp
+	// end 提交完成后 WAL 的逻辑长度（所有段大小之和）
+	end int64
+}
+
+// apply 把一次提交应用到模型上
+func (op crashOp) apply(model map[string]string) {
+	for _, b := range op.batch {
+		if b.tombstone {
+			delete(model, b.key)
+		} else {
+			model[b.key] = string(b.value)
+		}
+	}
+}
+
+// crashFault 描述崩溃时 WAL 活跃段尾部的状态
+type crashFault struct {
+	name string
+	// tail 根据活跃段已落盘的前缀 prefix 与尚未落盘的部分 rest 生成崩溃后的文件内容，
+	// 同时返回文件中完好的字节数，之后的数据都不可信
+	tail func(prefix, rest []byte) ([]byte, int)
+}
+
+var crashFaults = []crashFault{
+	{
+		// 写入中途崩溃，之后的字节没有落盘
+		name: "截断",
+		tail: func(prefix, rest []byte) ([]byte, int) { return prefix, len(prefix) },
+	},
+	{
+		// 文件系统先扩展了文件长度，数据块尚未写入
+		name: "尾部补零",
+		tail: func(prefix, rest []byte) ([]byte, int) {
+			return append(prefix, make([]byte, min(len(rest), 32))...), len(prefix)
+		},
+	},
+	{
+		// 尚未落盘的数据中发生位翻转，翻转位置之前的字节完好
+		name: "尾部损坏",
+		tail: func(prefix, rest []byte) ([]byte, int) {
+			if len(rest) == 0 {
+				return prefix, len(prefix)
+			}
+			flip := len(rest) / 2
+			data := append(prefix, rest...)
+			data[len(prefix)+flip] ^= 0xff
+			return data, len(prefix) + flip
+		},
+	},
+}
+
+// 测试在 WAL 任意位置崩溃后，恢复出的数据恰好是某个已提交操作的前缀
+//
+// 先正常写入一系列单条写入、删除与批量提交，记录每次提交后 WAL 的逻辑长度；
+// 然后在每个字节偏移处构造崩溃时的数据目录：之前的段保持完整，偏移所在的段作为活跃段，
+// 按 crashFaults 处理其尾部，之后的段尚未创建。恢复后的数据必须等于
+// 所有完整位于完好字节内的提交应用后的结果，且恢复后的数据库可以继续正常写入
+func TestDB_CrashRecovery(t *testing.T) {
+	dir := t.TempDir()
+	opts := DefaultOptions()
+	opts.WALSegmentSize = 256
+	opts.SyncMode = NoSync
+
+	db, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	ops := runCrashWorkload(t, db, 40)
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	walDir := filepath.Join(dir, walDirName)
+	ids, err := listSegments(opts.FS, walDir)
+	if err != nil {
+		t.Fatalf("列出 WAL 段失败: %v", err)
+	}
+	if len(ids) < 3 {
+		t.Fatalf("期望写入跨越多个段, 实际 %d 个", len(ids))
+	}
+	segments := make([][]byte, len(ids))
+	for i, id := range ids {
+		if segments[i], err = os.ReadFile(filepath.Join(walDir, segmentName(id))); err != nil {
+			t.Fatalf("读取 WAL 段失败: %v", err)
+		}
+	}
+
+	step := 1
+	if testing.Short() {
+		step = 7
+	}
+	crashDir := filepath.Join(t.TempDir(), "crash")
+	for _, fault := range crashFaults {
+		t.Run(fault.name, func(t *testing.T) {
+			var base int64
+			for i, seg := range segments {
+				for off := 0; off <= len(seg); off += step {
+					name := fmt.Sprintf("段%d偏移%d", ids[i], off)
+					tail, intact := fault.tail(append([]byte(nil), seg[:off]...), seg[off:])
+					checkCrashImage(t, name, crashDir, opts, ids[:i+1], segments[:i], tail, ops, base+int64(intact))
+				}
+				base += int64(len(seg))
+			}
+		})
+	}
+}
+
+// runCrashWorkload 执行 n 次随机提交，返回每次提交的内容及提交后 WAL 的逻辑长度
+func runCrashWorkload(t *testing.T, db *DB, n int) []crashOp {
+	t.Helper()
+	rng := rand.New(rand.NewPCG(1, 2))
+	randOp := func() batchOp {
+		key := fmt.Sprintf("key%02d", rng.IntN(12))
+		if rng.IntN(4) == 0 {
+			return batchOp{key: key, tombstone: true}
+		}
+		return batchOp{key: key, value: fmt.Appendf(nil, "value-%d", rng.IntN(1000))}
+	}
+
+	ops := make([]crashOp, 0, n)
+	for range n {
+		var op crashOp
+		var err error
+		switch rng.IntN(3) {
+		case 0:
+			b := NewWriteBatch()
+			for range 2 + rng.IntN(3) {
+				bo := randOp()
+				if bo.tombstone {
+					b.Delete(bo.key)
+				} else {
+					b.Set(bo.key, bo.value)
+				}
+			}
+			op.batch = b.ops
+			err = db.Write(b)
+		default:
+			bo := randOp()
+			op.batch = []batchOp{bo}
+			if bo.tombstone {
+				err = db.Delete(bo.key)
+			} else {
+				err = db.Set(bo.key, bo.value)
+			}
+		}
+		if err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+
+		for _, id := range db.wal.Segments() {
+			info, err := os.Stat(filepath.Join(db.wal.dir, segmentName(id)))
+			if err != nil {
+				t.Fatalf("获取 WAL 段信息失败: %v", err)
+			}
+			op.end += info.Size()
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+// checkCrashImage 构造一个崩溃后的数据目录并验证恢复结果
+//
+// sealed 为已封存段的完整内容，active 为崩溃时活跃段的内容，durable 为崩溃时已完整落盘的 WAL 逻辑长度
+func checkCrashImage(t *testing.T, name, dir string, opts Options, ids []uint64, sealed [][]byte, active []byte, ops []crashOp, durable int64) {
+	t.Helper()
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("清理目录失败: %v", err)
+	}
+	walDir := filepath.Join(dir, walDirName)
+	if err := os.MkdirAll(walDir, 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	for i, id := range ids {
+		data := active
+		if i < len(sealed) {
+			data = sealed[i]
+		}
+		if err := os.WriteFile(filepath.Join(walDir, segmentName(id)), data, 0644); err != nil {
+			t.Fatalf("写入 WAL 段失败: %v", err)
+		}
+	}
+
+	want := map[string]string{}
+	for _, op := range ops {
+		if op.end > durable {
+			break
+		}
+		op.apply(want)
+	}
+
+	db, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("%s: 恢复失败: %v", name, err)
+	}
+	if got := dumpDB(t, db); !maps.Equal(got, want) {
+		db.Close()
+		t.Fatalf("%s: 恢复结果不是已提交操作的前缀\n期望 %v\n实际 %v", name, want, got)
+	}
+
+	// 损坏的尾部必须已被截断，否则之后的追加在下次恢复时会丢失
+	if err := db.Set("after-crash", []byte("ok")); err != nil {
+		t.Fatalf("%s: 恢复后写入失败: %v", name, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("%s: 关闭失败: %v", name, err)
+	}
+	want["after-crash"] = "ok"
+
+	db, err = Open(dir, opts)
+	if err != nil {
+		t.Fatalf("%s: 再次恢复失败: %v", name, err)
+	}
+	defer db.Close()
+	if got := dumpDB(t, db); !maps.Equal(got, want) {
+		t.Fatalf("%s: 恢复后的写入丢失\n期望 %v\n实际 %v", name, want, got)
+	}
+}
+
+// dumpDB 返回数据库中所有可见的键值对
+func dumpDB(t *testing.T, db *DB) map[string]string {
+	t.Helper()
+	it, err := db.NewIterator()
+	if err != nil {
+		t.Fatalf("创建迭代器失败: %v", err)
+	}
+	defer it.Close()
+	got := map[string]string{}
+	for it.Seek(""); it.Valid(); it.Next() {
+		got[it.Key()] = string(it.Entry().Value)
+	}
+	return got
+}
@@ -0,0 +1,404 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+var (
+	ErrNotFound   = errors.New("key not found")
+	ErrClosed     = errors.New("db is closed")
+	ErrInvalidTTL = errors.New("ttl must be positive")
+	// ErrLocked 数据目录已被另一个进程（或同一进程中另一个未关闭的 DB）打开
+	ErrLocked = errors.New("db is locked by another process")
+	// ErrKeyTooLarge key 的长度超过 Options.MaxKeySize
+	ErrKeyTooLarge = errors.New("key too large")
+	// ErrValueTooLarge value 的长度超过 Options.MaxValueSize
+	ErrValueTooLarge = errors.New("value too large")
+	// ErrBatchTooLarge 一个批次或事务编码后超过单条 WAL 记录的长度上限
+	ErrBatchTooLarge = errors.New("batch too large")
+)
+
+const (
+	// walDirName 数据目录下存放 WAL 段文件的子目录
+	walDirName = "wal"
+	// lockFileName 数据目录下的锁文件，打开期间持有排他锁，防止两个进程同时写入同一个 WAL
+	lockFileName = "LOCK"
+)
+
+// InMemory 作为 Open 的目录时打开一个纯内存数据库：不写 WAL、不访问磁盘，
+// 关闭后数据全部丢弃，适用于测试和缓存。每次 Open 都得到一个独立的实例
+const InMemory = ":memory:"
+
+// DB 是面向使用者的存储引擎入口，负责串联 WAL、MemTable 等组件
+//
+// 目录布局：
+//
+//	<dir>/
+//	├── LOCK
+//	└── wal/
+//	    ├── 000001.wal
+//	    └── 000002.wal
+type DB struct {
+	// mu 保护 closed 状态：读写操作持有读锁，Close 持有写锁设置 closed，
+	// 保证关闭底层文件时没有正在进行的读写，之后的操作也不会再访问它们
+	mu     sync.RWMutex
+	closed bool
+	dir    string
+	opts   Options
+	// lock 数据目录的锁，纯内存模式下为 nil
+	lock io.Closer
+	// wal 纯内存模式下为 nil
+	wal      *WALManager
+	memTable *MemTable
+	// snapshots 所有未释放的快照
+	snapshots *snapshotList
+	// async 未完成的异步写入，asyncSlots 限制其数量
+	async      sync.WaitGroup
+	asyncSlots chan struct{}
+	// now 判断条目是否过期时使用的时钟，测试中可以替换
+	now func() time.Time
+
+	// optsMu 串行化 SetOptions，它修改的字段（见 dynamic_options.go）只在持有 optsMu 时写入 opts；
+	// slowOpThreshold 为当前的 Options.SlowOpThreshold（纳秒），热路径上无锁读取
+	optsMu          sync.Mutex
+	slowOpThreshold atomic.Int64
+
+	// closeOnce 保证关闭只执行一次，closeDone 在关闭完成后关闭，closeErr 为关闭的结果，见 close.go
+	closeOnce sync.Once
+	closeDone chan struct{}
+	closeErr  error
+}
+
+// Open 打开（不存在则创建）dir 目录下的数据库，并从 WAL 恢复内存数据
+// dir 为 InMemory 时打开一个纯内存数据库
+func Open(dir string, opts Options) (*DB, error) {
+	opts = opts.withDefaults()
+
+	var (
+		lock io.Closer
+		wal  *WALManager
+	)
+	if dir == InMemory {
+		// 之后落盘产生的文件同样只写入内存
+		opts.FS = vfs.NewMemFS()
+	} else {
+		walDir := filepath.Join(dir, walDirName)
+		if err := opts.FS.MkdirAll(walDir, 0755); err != nil {
+			return nil, fmt.Errorf("create wal dir %s: %w", walDir, err)
+		}
+
+		// 在读取 WAL 之前加锁，恢复过程会截断损坏的尾部，同样不能与其他进程并发
+		var err error
+		lock, err = opts.FS.Lock(filepath.Join(dir, lockFileName))
+		if errors.Is(err, vfs.ErrLocked) {
+			return nil, fmt.Errorf("open db %s: %w", dir, ErrLocked)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("open db %s: lock: %w", dir, err)
+		}
+		// 在读取 WAL 之前检查配置，不兼容的数据不会被当作损坏截断
+		if err := syncOptionsFile(opts.FS, dir, opts); err != nil {
+			lock.Close()
+			return nil, fmt.Errorf("open db %s: %w", dir, err)
+		}
+
+		wal, err = OpenWALManager(walDir, opts)
+		if err != nil {
+			lock.Close()
+			return nil, fmt.Errorf("open db %s: %w", dir, err)
+		}
+	}
+
+	snapshots := newSnapshotList()
+	mt := NewMemTable(wal, opts)
+	mt.snapshots = snapshots
+	if err := mt.Recovery(opts.RecoveryBatchSize); err != nil {
+		wal.Close()
+		lock.Close()
+		return nil, fmt.Errorf("open db %s: %w", dir, err)
+	}
+
+	if wal != nil {
+		slog.Info("db opened", "dir", dir, "walSegments", len(wal.Segments()), "syncMode", opts.SyncMode, "walSyncMethod", opts.WALSyncMethod, "recoveryMode", opts.RecoveryMode)
+	} else {
+		slog.Info("db opened", "dir", dir)
+	}
+
+	db := &DB{
+		dir:        dir,
+		opts:       opts,
+		lock:       lock,
+		wal:        wal,
+		memTable:   mt,
+		snapshots:  snapshots,
+		asyncSlots: make(chan struct{}, opts.AsyncWriteQueueSize),
+		now:        time.Now,
+		closeDone:  make(chan struct{}),
+	}
+	db.slowOpThreshold.Store(int64(opts.SlowOpThreshold))
+	return db, nil
+}
+
+// Get 返回 key 对应的值，key 不存在、已被删除或已过期时返回 ErrNotFound
+func (db *DB) Get(key string) ([]byte, error) {
+	return db.GetWithOptions(key, ReadOptions{})
+}
+
+// ExpireAt 返回 key 的过期时间，永不过期时返回零值
+func (db *DB) ExpireAt(key string) (time.Time, error) {
+	entry, err := db.getLive(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if entry.ExpireAt == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, entry.ExpireAt), nil
+}
+
+// getLive 返回 key 当前未被删除且未过期的条目
+func (db *DB) getLive(key string) (*sdbf.Entry, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	entry, ok := db.memTable.Get(key)
+	if !ok || !isLive(entry, db.now().UnixNano()) {
+		return nil, ErrNotFound
+	}
+	return entry, nil
+}
+
+// Set 写入或覆盖一个键值对
+func (db *DB) Set(key string, value []byte) error {
+	t := db.startOp("set", key, "")
+	defer t.done()
+
+	if err := db.checkSize(key, value); err != nil {
+		return fmt.Errorf("set %s: %w", key, err)
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	entry := &sdbf.Entry{
+		Key:   key,
+		Value: value,
+	}
+	req := &commitRequest{entries: []*sdbf.Entry{entry}}
+	err := db.memTable.commitRequest(req)
+	t.commit(req)
+	if err != nil {
+		return fmt.Errorf("set %s: %w", key, err)
+	}
+	return nil
+}
+
+// SetWithTTL 写入一个键值对，ttl 之后该 key 视为不存在
+//
+// 过期采用惰性策略：读取时跳过已过期的条目，条目本身仍保留在 MemTable 与 WAL 中，
+// 直到被新的写入覆盖
+func (db *DB) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	t := db.startOp("set", key, "")
+	defer t.done()
+
+	if ttl <= 0 {
+		return fmt.Errorf("set %s: %w", key, ErrInvalidTTL)
+	}
+	if err := db.checkSize(key, value); err != nil {
+		return fmt.Errorf("set %s: %w", key, err)
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	entry := &sdbf.Entry{
+		Key:      key,
+		Value:    value,
+		ExpireAt: db.now().Add(ttl).UnixNano(),
+	}
+	req := &commitRequest{entries: []*sdbf.Entry{entry}}
+	err := db.memTable.commitRequest(req)
+	t.commit(req)
+	if err != nil {
+		return fmt.Errorf("set %s: %w", key, err)
+	}
+	return nil
+}
+
+// Delete 写入一个墓碑标记，之后的 Get 将返回 ErrNotFound，Scan 不再返回该 key
+func (db *DB) Delete(key string) error {
+	t := db.startOp("delete", key, "")
+	defer t.done()
+
+	if err := db.checkSize(key, nil); err != nil {
+		return fmt.Errorf("delete %s: %w", key, err)
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	req := &commitRequest{entries: []*sdbf.Entry{{Key: key, Tombstone: true}}}
+	err := db.memTable.commitRequest(req)
+	t.commit(req)
+	if err != nil {
+		return fmt.Errorf("delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// checkSize 检查 key 与 value 的长度是否超过配置的上限
+func (db *DB) checkSize(key string, value []byte) error {
+	if len(key) > db.opts.MaxKeySize {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrKeyTooLarge, len(key), db.opts.MaxKeySize)
+	}
+	if len(value) > db.opts.MaxValueSize {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrValueTooLarge, len(value), db.opts.MaxValueSize)
+	}
+	return nil
+}
+
+// Scan 返回 [start, end] 区间内所有未被删除的条目，按 key 有序
+func (db *DB) Scan(start, end string) ([]*sdbf.Entry, error) {
+	return db.ScanWithOptions(start, end, ReadOptions{})
+}
+
+// ScanPage 返回 [start, end] 区间内最多 limit 条未被删除的条目（limit <= 0 表示不限制），
+// 以及读取下一页的游标 next：下一页通过 ScanPage(next, end, limit) 获取，next 为空表示已经读完
+//
+// 每一页读取一个临时快照，直接遍历 MemTable 而不复制整个数据库；不同页之间不保证一致，
+// 需要跨页一致时在同一个 Snapshot 上调用 ScanPage
+func (db *DB) ScanPage(start, end string, limit int) (entries []*sdbf.Entry, next string, err error) {
+	t := db.startOp("scan", start, end)
+	defer t.done()
+
+	snap, err := db.GetSnapshot()
+	t.stage("iterator")
+	if err != nil {
+		return nil, "", err
+	}
+	defer snap.Release()
+	entries, next, err = snap.ScanPage(start, end, limit)
+	t.stage("iterate")
+	return entries, next, err
+}
+
+// scanPage 从 start 开始收集 it 中不超过 end 的最多 limit 条条目，返回条目与下一条的 key
+func scanPage(it Iterator, start, end string, limit int) ([]*sdbf.Entry, string) {
+	var entries []*sdbf.Entry
+	for it.Seek(start); it.Valid() && utils.CompareKey(it.Key(), end) <= 0; it.Next() {
+		if limit > 0 && len(entries) >= limit {
+			return entries, it.Key()
+		}
+		entries = append(entries, it.Entry())
+	}
+	return entries, ""
+}
+
+// ScanPrefix 返回所有以 prefix 开头且未被删除的条目，按 key 有序，最多 limit 条（limit <= 0 表示不限制）
+func (db *DB) ScanPrefix(prefix string, limit int) ([]*sdbf.Entry, error) {
+	it, err := db.NewIterator()
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	start, end, bounded := utils.PrefixRange(prefix)
+	var entries []*sdbf.Entry
+	for it.Seek(start); it.Valid(); it.Next() {
+		if bounded && utils.CompareKey(it.Key(), end) >= 0 {
+			break
+		}
+		// prefix 含有 '@' 时区间内可能混入前缀不同的 key，见 utils.PrefixRange
+		if !strings.HasPrefix(it.Key(), prefix) {
+			continue
+		}
+		entries = append(entries, it.Entry())
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// NewIterator 返回遍历整个数据库的迭代器，已删除或已过期的 key 会被跳过
+// 迭代器基于创建时刻登记的临时快照，之后的写入对其不可见；使用完毕后调用 Close 释放快照
+func (db *DB) NewIterator() (*SnapshotIterator, error) {
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	it, err := snap.NewIterator()
+	if err != nil {
+		snap.Release()
+		return nil, err
+	}
+	return newSnapshotIterator(snap, it), nil
+}
+
+// LastSequence 返回最后一次对读可见的写入的序列号
+//
+// 每个写入的条目都会获得一个由引擎分配、严格递增的序列号（即 Entry.Version），
+// 快照（Snapshot.Seq）、事务的冲突检测与复制的追赶位置都基于它。
+// 新打开的数据库从 WAL 中恢复出最大的序列号并继续递增，空数据库返回 0
+func (db *DB) LastSequence() (int64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return 0, ErrClosed
+	}
+	db.memTable.mu.Lock()
+	defer db.memTable.mu.Unlock()
+	return db.memTable.visibleSeq, nil
+}
+
+// Sync 将所有已写入的数据 fsync 到磁盘，
+// 在 SyncPeriodic / NoSync 模式下可用于在关键点手动保证持久性，纯内存模式下不做任何事
+func (db *DB) Sync() error {
+	t := db.startOp("sync", "", "")
+	defer t.done()
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	if db.wal == nil {
+		return nil
+	}
+	err := db.wal.Sync()
+	t.stage("wal sync")
+	if err != nil {
+		return fmt.Errorf("sync db %s: %w", db.dir, err)
+	}
+	return nil
+}
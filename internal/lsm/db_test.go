@@ -0,0 +1,798 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+// 创建测试用的 DB 实例
+func openTestDB(t *testing.T, dir string) *DB {
+	t.Helper()
+	db, err := Open(dir, DefaultOptions())
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	return db
+}
+
+// 测试 Open 创建目录布局
+func TestDB_OpenLayout(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	db := openTestDB(t, dir)
+	defer db.Close()
+
+	walPath := filepath.Join(dir, walDirName, segmentName(1))
+	if _, err := os.Stat(walPath); err != nil {
+		t.Fatalf("期望 WAL 文件 %s 存在: %v", walPath, err)
+	}
+}
+
+// 测试基本的读写删除
+func TestDB_SetGetDelete(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+
+	if err := db.Set("user:1", []byte("Alice")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Set("user:2", []byte("Bob")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Delete("user:2"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		want    string
+		wantErr error
+	}{
+		{name: "存在的key", key: "user:1", want: "Alice"},
+		{name: "已删除的key", key: "user:2", wantErr: ErrNotFound},
+		{name: "不存在的key", key: "user:3", wantErr: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.Get(tt.key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("期望错误 %v, 实际错误 %v", tt.wantErr, err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("期望 %q, 实际 %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// 测试范围扫描跳过墓碑
+func TestDB_Scan(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		if err := db.Set(k, []byte("v-"+k)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := db.Delete("c"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+
+	entries, err := db.Scan("b", "d")
+	if err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+
+	want := []string{"b", "d"}
+	if len(entries) != len(want) {
+		t.Fatalf("期望 %d 条记录, 实际 %d 条", len(want), len(entries))
+	}
+	for i, k := range want {
+		if entries[i].Key != k {
+			t.Errorf("位置 %d 期望 key %s, 实际 %s", i, k, entries[i].Key)
+		}
+	}
+}
+
+// 测试分页扫描：按游标逐页读取，limit <= 0 不限制，在快照上分页时看不到之后的写入
+func TestDB_ScanPage(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+
+	for _, k := range []string{"a", "b", "c", "d", "e", "f"} {
+		if err := db.Set(k, []byte("v-"+k)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := db.Delete("c"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	defer snap.Release()
+	// 快照之后的写入只对 DB 的分页可见
+	if err := db.Set("bb", []byte("v-bb")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	type scanFunc func(start, end string, limit int) ([]*sdbf.Entry, string, error)
+	tests := []struct {
+		name  string
+		scan  scanFunc
+		end   string
+		limit int
+		want  [][]string
+	}{
+		{name: "DB/每页 2 条", scan: db.ScanPage, end: "e", limit: 2, want: [][]string{{"a", "b"}, {"bb", "d"}, {"e"}}},
+		{name: "DB/恰好读完", scan: db.ScanPage, end: "d", limit: 2, want: [][]string{{"a", "b"}, {"bb", "d"}}},
+		{name: "DB/不限制", scan: db.ScanPage, end: "z", limit: 0, want: [][]string{{"a", "b", "bb", "d", "e", "f"}}},
+		{name: "快照/每页 2 条", scan: snap.ScanPage, end: "e", limit: 2, want: [][]string{{"a", "b"}, {"d", "e"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]string
+			start := "a"
+			for {
+				entries, next, err := tt.scan(start, tt.end, tt.limit)
+				if err != nil {
+					t.Fatalf("分页扫描失败: %v", err)
+				}
+				var page []string
+				for _, e := range entries {
+					page = append(page, e.Key)
+				}
+				got = append(got, page)
+				if next == "" {
+					break
+				}
+				start = next
+			}
+			if !slices.EqualFunc(got, tt.want, slices.Equal) {
+				t.Fatalf("期望 %q, 实际 %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// 测试关闭后重新打开能从 WAL 恢复数据
+func TestDB_Reopen(t *testing.T) {
+	dir := t.TempDir()
+
+	db := openTestDB(t, dir)
+	if err := db.Set("k1", []byte("v1")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Set("k2", []byte("v2")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Delete("k2"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	db = openTestDB(t, dir)
+	defer db.Close()
+
+	got, err := db.Get("k1")
+	if err != nil {
+		t.Fatalf("恢复后读取失败: %v", err)
+	}
+	if string(got) != "v1" {
+		t.Errorf("期望 v1, 实际 %s", got)
+	}
+	if _, err := db.Get("k2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("期望已删除的 key 返回 ErrNotFound, 实际 %v", err)
+	}
+}
+
+// 测试同一个目录不能被同时打开两次，关闭后锁被释放
+func TestDB_Lock(t *testing.T) {
+	tests := []struct {
+		name string
+		fs   vfs.FS
+		dir  func(t *testing.T) string
+	}{
+		{name: "OSFS", fs: vfs.OSFS{}, dir: func(t *testing.T) string { return t.TempDir() }},
+		{name: "MemFS", fs: vfs.NewMemFS(), dir: func(t *testing.T) string { return "/db" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.FS = tt.fs
+			dir := tt.dir(t)
+
+			db, err := Open(dir, opts)
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+			if _, err := tt.fs.Stat(filepath.Join(dir, lockFileName)); err != nil {
+				t.Fatalf("期望锁文件存在: %v", err)
+			}
+			if _, err := Open(dir, opts); !errors.Is(err, ErrLocked) {
+				t.Fatalf("期望 %v, 实际 %v", ErrLocked, err)
+			}
+
+			if err := db.Close(); err != nil {
+				t.Fatalf("关闭失败: %v", err)
+			}
+			db, err = Open(dir, opts)
+			if err != nil {
+				t.Fatalf("关闭后重新打开失败: %v", err)
+			}
+			db.Close()
+		})
+	}
+}
+
+// 测试数据库可以完全运行在内存文件系统上，包括段切换与恢复
+func TestDB_MemFS(t *testing.T) {
+	memFS := vfs.NewMemFS()
+	opts := DefaultOptions()
+	opts.FS = memFS
+	opts.WALSegmentSize = 128
+
+	db, err := Open("/db", opts)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	for i := range 20 {
+		if err := db.Set(fmt.Sprintf("key%02d", i), []byte(strconv.Itoa(i))); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	names, err := memFS.List(filepath.Join("/db", walDirName))
+	if err != nil || len(names) < 2 {
+		t.Fatalf("期望写入跨越多个段, 实际 %v %v", names, err)
+	}
+
+	db, err = Open("/db", opts)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer db.Close()
+	for i := range 20 {
+		got, err := db.Get(fmt.Sprintf("key%02d", i))
+		if err != nil || string(got) != strconv.Itoa(i) {
+			t.Fatalf("key%02d 期望 %d, 实际 %q %v", i, i, got, err)
+		}
+	}
+}
+
+// 测试纯内存模式：不创建任何文件，实例之间互不影响
+func TestDB_InMemory(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	db1, err := Open(InMemory, DefaultOptions())
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	db2, err := Open(InMemory, DefaultOptions())
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db2.Close()
+
+	if err := db1.Set("a", []byte("1")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	b := NewWriteBatch()
+	b.Set("b", []byte("2"))
+	b.Delete("a")
+	if err := db1.Write(b); err != nil {
+		t.Fatalf("批量写入失败: %v", err)
+	}
+	if err := db1.Sync(); err != nil {
+		t.Fatalf("Sync 失败: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		db      *DB
+		key     string
+		want    string
+		wantErr error
+	}{
+		{name: "已删除", db: db1, key: "a", wantErr: ErrNotFound},
+		{name: "批量写入", db: db1, key: "b", want: "2"},
+		{name: "其他实例不可见", db: db2, key: "b", wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.db.Get(tt.key)
+			if !errors.Is(err, tt.wantErr) || string(got) != tt.want {
+				t.Fatalf("期望 %q %v, 实际 %q %v", tt.want, tt.wantErr, got, err)
+			}
+		})
+	}
+
+	if err := db1.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	if names, _ := os.ReadDir("."); len(names) != 0 {
+		t.Fatalf("纯内存模式不应创建文件, 实际 %v", names)
+	}
+}
+
+// 测试 Stats 反映写入、快照与 WAL 状态
+func TestDB_Stats(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  func(t *testing.T) string
+	}{
+		{name: "磁盘", dir: func(t *testing.T) string { return t.TempDir() }},
+		{name: "纯内存", dir: func(t *testing.T) string { return InMemory }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := Open(tt.dir(t), DefaultOptions())
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+			defer db.Close()
+
+			for _, k := range []string{"a", "b", "c"} {
+				if err := db.Set(k, []byte("value")); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+			}
+			snap, err := db.GetSnapshot()
+			if err != nil {
+				t.Fatalf("创建快照失败: %v", err)
+			}
+			defer snap.Release()
+
+			stats, err := db.Stats()
+			if err != nil {
+				t.Fatalf("获取统计信息失败: %v", err)
+			}
+			inMemory := db.wal == nil
+			if stats.MemTableEntries != 3 || stats.LastSequence != 3 || stats.Snapshots != 1 || stats.InMemory != inMemory {
+				t.Fatalf("统计信息不正确: %+v", stats)
+			}
+			if inMemory != (stats.WALSegments == 0 && stats.WALBytes == 0) {
+				t.Fatalf("WAL 统计不正确: %+v", stats)
+			}
+			if !inMemory && stats.DiskUsageBytes != stats.WALBytes {
+				t.Fatalf("磁盘占用应等于 WAL 大小: %+v", stats)
+			}
+		})
+	}
+
+	db := openTestDB(t, t.TempDir())
+	db.Close()
+	if _, err := db.Stats(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("关闭后期望 ErrClosed, 实际 %v", err)
+	}
+}
+
+// 测试关闭后的操作返回 ErrClosed
+func TestDB_Closed(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("重复关闭不应报错: %v", err)
+	}
+
+	if _, err := db.Get("k"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Get 期望 ErrClosed, 实际 %v", err)
+	}
+	if err := db.Set("k", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Set 期望 ErrClosed, 实际 %v", err)
+	}
+	if _, err := db.Scan("a", "z"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Scan 期望 ErrClosed, 实际 %v", err)
+	}
+}
+
+// 测试并发写入经过组提交后全部可读且可恢复
+func TestDB_ConcurrentSet(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxDelay time.Duration
+	}{
+		{name: "不等待", maxDelay: 0},
+		{name: "等待攒批", maxDelay: time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := DefaultOptions()
+			opts.GroupCommitMaxDelay = tt.maxDelay
+			opts.GroupCommitMaxBatch = 16
+
+			db, err := Open(dir, opts)
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+
+			const workers, perWorker = 8, 50
+			var wg sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < perWorker; i++ {
+						key := fmt.Sprintf("w%d:%03d", w, i)
+						if err := db.Set(key, []byte(key)); err != nil {
+							t.Errorf("写入 %s 失败: %v", key, err)
+						}
+					}
+				}(w)
+			}
+			wg.Wait()
+			if err := db.Close(); err != nil {
+				t.Fatalf("关闭失败: %v", err)
+			}
+
+			db, err = Open(dir, opts)
+			if err != nil {
+				t.Fatalf("重新打开失败: %v", err)
+			}
+			defer db.Close()
+
+			for w := 0; w < workers; w++ {
+				for i := 0; i < perWorker; i++ {
+					key := fmt.Sprintf("w%d:%03d", w, i)
+					got, err := db.Get(key)
+					if err != nil || string(got) != key {
+						t.Fatalf("读取 %s 失败: %q %v", key, got, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDB_ParallelSet(b *testing.B) {
+	db, err := Open(b.TempDir(), DefaultOptions())
+	if err != nil {
+		b.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	value := []byte("benchmark_value_with_some_content")
+	var n atomic.Int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			db.Set(fmt.Sprintf("key:%d", n.Add(1)), value)
+		}
+	})
+}
+
+// 测试不同 fsync 策略下数据都能在正常关闭后恢复
+func TestDB_SyncModes(t *testing.T) {
+	tests := []struct {
+		name   string
+		mode   SyncMode
+		method WALSyncMethod
+	}{
+		{name: "每次写入fsync", mode: SyncEveryWrite},
+		{name: "周期fsync", mode: SyncPeriodic},
+		{name: "不主动fsync", mode: NoSync},
+		{name: "每次写入fdatasync", mode: SyncEveryWrite, method: WALSyncFdatasync},
+		{name: "周期fdatasync", mode: SyncPeriodic, method: WALSyncFdatasync},
+		{name: "O_DSYNC", mode: SyncEveryWrite, method: WALSyncDSync},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := DefaultOptions()
+			opts.SyncMode = tt.mode
+			opts.WALSyncMethod = tt.method
+			opts.SyncPeriod = time.Millisecond
+
+			db, err := Open(dir, opts)
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+			for i := 0; i < 20; i++ {
+				if err := db.Set(fmt.Sprintf("k%02d", i), []byte("v")); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+			}
+			if err := db.Sync(); err != nil {
+				t.Fatalf("手动 fsync 失败: %v", err)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatalf("关闭失败: %v", err)
+			}
+			if err := db.Sync(); !errors.Is(err, ErrClosed) {
+				t.Fatalf("关闭后 Sync 期望 ErrClosed, 实际 %v", err)
+			}
+
+			db, err = Open(dir, opts)
+			if err != nil {
+				t.Fatalf("重新打开失败: %v", err)
+			}
+			defer db.Close()
+			entries, err := db.Scan("k00", "k99")
+			if err != nil {
+				t.Fatalf("扫描失败: %v", err)
+			}
+			if len(entries) != 20 {
+				t.Fatalf("期望恢复 20 条记录, 实际 %d 条", len(entries))
+			}
+		})
+	}
+}
+
+// 测试删除的各种组合
+func TestDB_Delete(t *testing.T) {
+	tests := []struct {
+		name    string
+		ops     func(db *DB) error
+		want    string
+		wantErr error
+	}{
+		{
+			name: "删除不存在的key",
+			ops: func(db *DB) error {
+				return db.Delete("k")
+			},
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "删除后重新写入",
+			ops: func(db *DB) error {
+				if err := db.Set("k", []byte("v1")); err != nil {
+					return err
+				}
+				if err := db.Delete("k"); err != nil {
+					return err
+				}
+				return db.Set("k", []byte("v2"))
+			},
+			want: "v2",
+		},
+		{
+			name: "重复删除",
+			ops: func(db *DB) error {
+				if err := db.Set("k", []byte("v1")); err != nil {
+					return err
+				}
+				if err := db.Delete("k"); err != nil {
+					return err
+				}
+				return db.Delete("k")
+			},
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db := openTestDB(t, dir)
+			if err := tt.ops(db); err != nil {
+				t.Fatalf("操作失败: %v", err)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatalf("关闭失败: %v", err)
+			}
+
+			// 重新打开后从 WAL 回放的结果应与之前一致
+			db = openTestDB(t, dir)
+			defer db.Close()
+			got, err := db.Get("k")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("期望错误 %v, 实际错误 %v", tt.wantErr, err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("期望 %q, 实际 %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDB_ScanPrefix(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+
+	keys := []string{
+		"order:1", "user", "user@5", "user:1", "user:1@100", "user:2", "user:3",
+		"userx", "usf", "usf@9", "a@12", "a@1b", "中文:1", "中文:2", "中斌",
+	}
+	for _, k := range keys {
+		if err := db.Set(k, []byte("v")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := db.Delete("user:3"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		prefix string
+		limit  int
+		want   []string
+	}{
+		{name: "普通前缀", prefix: "user:", want: []string{"user:1@100", "user:1", "user:2"}},
+		{name: "包含时间戳版本", prefix: "user", want: []string{"user@5", "user", "user:1@100", "user:1", "user:2", "userx"}},
+		{name: "上界的时间戳版本不会混入", prefix: "use", limit: 0, want: []string{"user@5", "user", "user:1@100", "user:1", "user:2", "userx"}},
+		{name: "limit", prefix: "user:", limit: 2, want: []string{"user:1@100", "user:1"}},
+		{name: "前缀含有 @", prefix: "a@1", want: []string{"a@12", "a@1b"}},
+		{name: "多字节前缀", prefix: "中文", want: []string{"中文:1", "中文:2"}},
+		{name: "没有匹配", prefix: "zzz", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := db.ScanPrefix(tt.prefix, tt.limit)
+			if err != nil {
+				t.Fatalf("前缀扫描失败: %v", err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Key)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("期望 %q, 实际 %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// 测试 key 与 value 的长度上限
+func TestDB_SizeLimits(t *testing.T) {
+	opts := DefaultOptions()
+	opts.MaxKeySize = 8
+	opts.MaxValueSize = 16
+	db, err := Open(InMemory, opts)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	longKey := strings.Repeat("k", 9)
+	longValue := make([]byte, 17)
+	tests := []struct {
+		name    string
+		write   func() error
+		wantErr error
+	}{
+		{"上限以内", func() error { return db.Set("kkkkkkkk", make([]byte, 16)) }, nil},
+		{"key 过长", func() error { return db.Set(longKey, nil) }, ErrKeyTooLarge},
+		{"value 过长", func() error { return db.Set("k", longValue) }, ErrValueTooLarge},
+		{"带 TTL 的写入", func() error { return db.SetWithTTL("k", longValue, time.Minute) }, ErrValueTooLarge},
+		{"删除", func() error { return db.Delete(longKey) }, ErrKeyTooLarge},
+		{"批量写入", func() error {
+			b := NewWriteBatch()
+			b.Set("a", []byte("1"))
+			b.Set("b", longValue)
+			return db.Write(b)
+		}, ErrValueTooLarge},
+		{"事务", func() error {
+			txn, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			defer txn.Rollback()
+			return txn.Set(longKey, nil)
+		}, ErrKeyTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.write(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("期望 %v, 实际 %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// 被拒绝的批量写入不应部分生效
+	if _, err := db.Get("a"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("被拒绝的批次中的 key 不应可见, 实际 %v", err)
+	}
+
+	// 超过硬上限的配置被截断
+	opts = Options{MaxKeySize: MaxKeySizeLimit + 1, MaxValueSize: MaxValueSizeLimit + 1}.withDefaults()
+	if opts.MaxKeySize != MaxKeySizeLimit || opts.MaxValueSize != MaxValueSizeLimit {
+		t.Fatalf("期望配置被截断为硬上限, 实际 %d/%d", opts.MaxKeySize, opts.MaxValueSize)
+	}
+}
+
+// 测试序列号的分配与暴露：批次与事务返回提交时的序列号，重新打开后继续递增
+func TestDB_Sequence(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir)
+
+	lastSeq := func(db *DB) int64 {
+		t.Helper()
+		seq, err := db.LastSequence()
+		if err != nil {
+			t.Fatalf("获取序列号失败: %v", err)
+		}
+		return seq
+	}
+	if seq := lastSeq(db); seq != 0 {
+		t.Fatalf("空数据库期望序列号 0, 实际 %d", seq)
+	}
+
+	if err := db.Set("a", []byte("1")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	b := NewWriteBatch()
+	b.Set("b", []byte("2"))
+	b.Set("c", []byte("3"))
+	b.Delete("a")
+	if b.Seq() != 0 {
+		t.Fatalf("未提交的批次期望序列号 0, 实际 %d", b.Seq())
+	}
+	if err := db.Write(b); err != nil {
+		t.Fatalf("批量写入失败: %v", err)
+	}
+	if b.Seq() != 4 || lastSeq(db) != 4 {
+		t.Fatalf("期望批次占用序列号 2..4, 实际批次 %d, 最新 %d", b.Seq(), lastSeq(db))
+	}
+
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		t.Fatalf("获取快照失败: %v", err)
+	}
+	if snap.Seq() != b.Seq() {
+		t.Fatalf("快照序列号期望 %d, 实际 %d", b.Seq(), snap.Seq())
+	}
+	snap.Release()
+
+	txn, err := db.Begin()
+	if err != nil {
+		t.Fatalf("开始事务失败: %v", err)
+	}
+	if err := txn.Set("d", []byte("4")); err != nil {
+		t.Fatalf("事务写入失败: %v", err)
+	}
+	if err := txn.Commit(); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	if txn.Seq() != 5 {
+		t.Fatalf("事务期望序列号 5, 实际 %d", txn.Seq())
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	db = openTestDB(t, dir)
+	defer db.Close()
+	if seq := lastSeq(db); seq != 5 {
+		t.Fatalf("重新打开后期望序列号 5, 实际 %d", seq)
+	}
+	b.Reset()
+	b.Set("e", []byte("5"))
+	if err := db.Write(b); err != nil {
+		t.Fatalf("批量写入失败: %v", err)
+	}
+	if b.Seq() != 6 {
+		t.Fatalf("重新打开后序列号应继续递增, 期望 6, 实际 %d", b.Seq())
+	}
+}
@@ -0,0 +1,128 @@
+package lsm
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// MemTableInfo MemTable 的内部状态，用于在线排查问题，可以直接序列化为 JSON
+//
+// 与 Stats 相比包含更多实现细节，字段可能随实现变化，不要依赖它做监控
+type MemTableInfo struct {
+	// Families 各列族的数据，默认列族（名称为空）在前
+	Families []MemFamilyInfo `json:"families"`
+	// VisibleSequence 已应用到跳表、对读可见的最大序列号
+	VisibleSequence int64 `json:"visible_sequence"`
+	// PendingCommits 排队等待组提交的写入请求数，GroupCommitLeading 是否有 leader 正在提交
+	PendingCommits     int  `json:"pending_commits"`
+	GroupCommitLeading bool `json:"group_commit_leading"`
+	// Snapshots 未释放的快照数，OldestSnapshot 为最旧快照的序列号（没有快照时为 0），
+	// 它之后被覆盖的旧版本都不能回收
+	Snapshots      int   `json:"snapshots"`
+	OldestSnapshot int64 `json:"oldest_snapshot"`
+	// VersionGCBytes 触发旧版本回收的大小，VersionGCBase 上次回收后的大小，见 Options.MemTableGCBytes
+	VersionGCBytes int64 `json:"version_gc_bytes"`
+	VersionGCBase  int64 `json:"version_gc_base"`
+	// MemoryUsedBytes 与 MemoryBudgetBytes 见 Stats，OverBudget 上次检查时是否超出预算
+	MemoryUsedBytes   int64 `json:"memory_used_bytes"`
+	MemoryBudgetBytes int64 `json:"memory_budget_bytes"`
+	OverBudget        bool  `json:"over_budget"`
+}
+
+// MemFamilyInfo 一个列族在 MemTable 中的数据
+type MemFamilyInfo struct {
+	Name string `json:"name"`
+	// Entries 跳表中的条目数，包含墓碑与为快照保留的旧版本
+	Entries int `json:"entries"`
+	// Bytes 估算的内存占用，包含范围墓碑
+	Bytes int64 `json:"bytes"`
+	// RangeTombstones 范围墓碑数
+	RangeTombstones int `json:"range_tombstones"`
+}
+
+// MemTableInfo 返回 MemTable 当前的内部状态，各部分分别读取，不保证是同一时刻的一致视图
+func (db *DB) MemTableInfo() (MemTableInfo, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return MemTableInfo{}, ErrClosed
+	}
+
+	mt := db.memTable
+	var info MemTableInfo
+	names, families := mt.allFamilies()
+	for i, f := range families {
+		info.Families = append(info.Families, MemFamilyInfo{
+			Name:            names[i],
+			Entries:         f.list.Len(),
+			Bytes:           f.size(),
+			RangeTombstones: len(f.rangeDels.load()),
+		})
+	}
+
+	mt.commitMu.Lock()
+	info.PendingCommits = len(mt.pending)
+	info.GroupCommitLeading = mt.leading
+	mt.commitMu.Unlock()
+
+	mt.mu.Lock()
+	info.VisibleSequence = mt.visibleSeq
+	info.VersionGCBytes = mt.versionGCBytes
+	info.VersionGCBase = mt.versionGCBase
+	info.OverBudget = mt.overBudget
+	mt.mu.Unlock()
+
+	info.Snapshots = db.snapshots.len()
+	info.OldestSnapshot, _ = db.snapshots.oldest()
+	info.MemoryUsedBytes = mt.budget.Used()
+	info.MemoryBudgetBytes = mt.budget.Limit()
+	return info, nil
+}
+
+// WALFileInfo 一个 WAL 段文件
+type WALFileInfo struct {
+	Segment uint64 `json:"segment"`
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	// Active 是否为正在写入的活跃段，其余的段都已封存
+	Active bool `json:"active"`
+}
+
+// WALFiles 返回所有 WAL 段文件，按段序号升序排列；纯内存数据库返回空
+//
+// 目前数据只持久化在 WAL 中，这就是数据目录中全部的数据文件
+func (db *DB) WALFiles() ([]WALFileInfo, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+	if db.wal == nil {
+		return nil, nil
+	}
+	return db.wal.files()
+}
+
+// files 返回所有段文件的信息
+func (m *WALManager) files() ([]WALFileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	files := make([]WALFileInfo, len(m.segments))
+	for i, id := range m.segments {
+		path := filepath.Join(m.dir, segmentName(id))
+		files[i] = WALFileInfo{Segment: id, Path: path}
+		if i == len(m.segments)-1 {
+			files[i].Size, files[i].Active = m.active.Size(), true
+			continue
+		}
+		info, err := m.fs.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("stat wal segment %s: %w", path, err)
+		}
+		files[i].Size = info.Size()
+	}
+	return files, nil
+}
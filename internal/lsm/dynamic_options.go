@@ -0,0 +1,170 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidOption SetOptions 的选项名不存在、不能在运行期间修改，或者值不合法
+var ErrInvalidOption = errors.New("invalid option")
+
+// dynamicOptions 可以通过 SetOptions 在运行期间修改的选项：解析并校验 value，写入 opts 中对应的字段
+var dynamicOptions = map[string]func(opts *Options, value string) error{
+	// memtable_gc_bytes 对应 Options.MemTableGCBytes
+	"memtable_gc_bytes": func(opts *Options, value string) (err error) {
+		opts.MemTableGCBytes, err = parseOptionInt(value, 1)
+		return err
+	},
+	// memory_budget 对应 Options.MemoryBudget，0 表示不限制
+	"memory_budget": func(opts *Options, value string) (err error) {
+		opts.MemoryBudget, err = parseOptionInt(value, 0)
+		return err
+	},
+	// wal_segment_size 对应 Options.WALSegmentSize，只影响之后的段切换
+	"wal_segment_size": func(opts *Options, value string) (err error) {
+		opts.WALSegmentSize, err = parseOptionInt(value, 1)
+		return err
+	},
+	// sync_mode 对应 Options.SyncMode，取值为 SyncMode.String() 的结果，不区分大小写
+	"sync_mode": func(opts *Options, value string) error {
+		for _, mode := range []SyncMode{SyncEveryWrite, SyncPeriodic, NoSync} {
+			if strings.EqualFold(value, mode.String()) {
+				opts.SyncMode = mode
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %q is not one of SyncEveryWrite, SyncPeriodic, NoSync", ErrInvalidOption, value)
+	},
+	// sync_period 对应 Options.SyncPeriod，格式见 time.ParseDuration
+	"sync_period": func(opts *Options, value string) (err error) {
+		opts.SyncPeriod, err = parseOptionDuration(value, time.Nanosecond)
+		return err
+	},
+	// slow_op_threshold 对应 Options.SlowOpThreshold，0 表示关闭慢操作日志
+	"slow_op_threshold": func(opts *Options, value string) (err error) {
+		opts.SlowOpThreshold, err = parseOptionDuration(value, 0)
+		return err
+	},
+}
+
+// parseOptionInt 解析十进制整数，小于 minValue 时返回 ErrInvalidOption
+func parseOptionInt(value string, minValue int64) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidOption, err)
+	}
+	if n < minValue {
+		return 0, fmt.Errorf("%w: %d is less than %d", ErrInvalidOption, n, minValue)
+	}
+	return n, nil
+}
+
+// parseOptionDuration 解析 time.ParseDuration 格式的时长，小于 minValue 时返回 ErrInvalidOption
+func parseOptionDuration(value string, minValue time.Duration) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidOption, err)
+	}
+	if d < minValue {
+		return 0, fmt.Errorf("%w: %v is less than %v", ErrInvalidOption, d, minValue)
+	}
+	return d, nil
+}
+
+// DynamicOptionNames 返回可以通过 SetOptions 修改的选项名，按名称排序
+func DynamicOptionNames() []string {
+	return slices.Sorted(maps.Keys(dynamicOptions))
+}
+
+// SetOptions 在运行期间修改选项，不需要重新打开数据库；可以修改的选项见 DynamicOptionNames，
+// 值的格式为十进制整数（字节数）、time.ParseDuration 格式的时长或 SyncMode 的名称
+//
+// 先校验全部选项，任何一项不存在或不合法时返回包装了 ErrInvalidOption 的错误，不做任何修改；
+// 应用时（写入 OPTIONS 文件或切换 SyncMode）出错同样不做任何修改。
+// 其余选项（影响数据格式或在 Open 时就已确定的组件）只能在 Open 时指定。
+// 修改 SyncMode 时先 fsync 活跃段，之前的写入在返回前持久化；新的 MemTableGCBytes 与
+// MemoryBudget 在下一次写入时生效
+func (db *DB) SetOptions(changes map[string]string) error {
+	db.optsMu.Lock()
+	defer db.optsMu.Unlock()
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	next := db.opts
+	for _, name := range slices.Sorted(maps.Keys(changes)) {
+		set, ok := dynamicOptions[name]
+		if !ok {
+			return fmt.Errorf("set option %q: %w: not settable at runtime, settable options are %s",
+				name, ErrInvalidOption, strings.Join(DynamicOptionNames(), ", "))
+		}
+		if err := set(&next, changes[name]); err != nil {
+			return fmt.Errorf("set option %q: %w", name, err)
+		}
+	}
+	return db.applyOptions(next)
+}
+
+// applyOptions 把 next 中可以动态修改的字段应用到各个组件，调用方持有 optsMu 与 mu 的读锁
+//
+// 可能失败的步骤（写 OPTIONS 文件、切换 SyncMode）放在最前面，任何一步失败时撤销之前的步骤并返回，
+// 所有选项都保持不变；之后的步骤不会失败。其他 goroutine 会无锁读取 opts 中的其他字段，
+// 因此只逐个写入修改的字段，不整体赋值
+func (db *DB) applyOptions(next Options) error {
+	cur := db.opts
+	// OPTIONS 文件记录了段大小，先写入新的内容，失败时还没有修改任何选项
+	persist := db.wal != nil && next.WALSegmentSize != cur.WALSegmentSize
+	if persist {
+		if err := syncOptionsFile(cur.FS, db.dir, next); err != nil {
+			return fmt.Errorf("set options: %w", err)
+		}
+	}
+	if next.SyncMode != cur.SyncMode || next.SyncPeriod != cur.SyncPeriod {
+		if db.wal != nil {
+			if err := db.wal.setSyncMode(next.SyncMode, next.SyncPeriod); err != nil {
+				err = fmt.Errorf("set options: %w", err)
+				// setSyncMode 失败时没有做任何修改，恢复 OPTIONS 文件使它与仍在使用的配置一致
+				if persist {
+					if rerr := syncOptionsFile(cur.FS, db.dir, cur); rerr != nil {
+						err = errors.Join(err, fmt.Errorf("restore OPTIONS file: %w", rerr))
+					}
+				}
+				return err
+			}
+		}
+		db.opts.SyncMode = next.SyncMode
+		db.opts.SyncPeriod = next.SyncPeriod
+	}
+
+	mt := db.memTable
+	mt.mu.Lock()
+	mt.versionGCBytes = next.MemTableGCBytes
+	mt.mu.Unlock()
+	db.opts.MemTableGCBytes = next.MemTableGCBytes
+
+	mt.budget.SetLimit(next.MemoryBudget)
+	db.opts.MemoryBudget = next.MemoryBudget
+
+	if db.wal != nil {
+		db.wal.setSegmentSize(next.WALSegmentSize)
+	}
+	db.opts.WALSegmentSize = next.WALSegmentSize
+
+	db.slowOpThreshold.Store(int64(next.SlowOpThreshold))
+	mt.timeStages.Store(next.SlowOpThreshold > 0)
+	db.opts.SlowOpThreshold = next.SlowOpThreshold
+
+	slog.Info("options changed", "dir", db.dir, "syncMode", next.SyncMode, "syncPeriod", next.SyncPeriod,
+		"memTableGCBytes", next.MemTableGCBytes, "memoryBudget", next.MemoryBudget,
+		"walSegmentSize", next.WALSegmentSize, "slowOpThreshold", next.SlowOpThreshold)
+	return nil
+}
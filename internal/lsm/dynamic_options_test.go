@@ -0,0 +1,171 @@
+package lsm
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+// 测试不存在或不合法的选项返回 ErrInvalidOption，同一次调用中合法的选项也不生效
+func TestDB_SetOptions_Invalid(t *testing.T) {
+	db, err := Open(t.TempDir(), Options{SyncMode: NoSync, MemoryBudget: 1 << 20})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name    string
+		changes map[string]string
+	}{
+		{name: "不存在的选项", changes: map[string]string{"compaction_concurrency": "4"}},
+		{name: "只能在 Open 时指定", changes: map[string]string{"max_key_size": "16"}},
+		{name: "不是整数", changes: map[string]string{"memory_budget": "1GB"}},
+		{name: "负数", changes: map[string]string{"memory_budget": "-1"}},
+		{name: "零", changes: map[string]string{"memtable_gc_bytes": "0"}},
+		{name: "未知的 SyncMode", changes: map[string]string{"sync_mode": "always"}},
+		{name: "不是时长", changes: map[string]string{"sync_period": "100"}},
+		{name: "负的时长", changes: map[string]string{"slow_op_threshold": "-1s"}},
+		{name: "部分合法", changes: map[string]string{"memory_budget": "4096", "sync_mode": "always"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := db.SetOptions(tt.changes); !errors.Is(err, ErrInvalidOption) {
+				t.Fatalf("期望 ErrInvalidOption, 实际 %v", err)
+			}
+			if got := db.memTable.budget.Limit(); got != 1<<20 {
+				t.Fatalf("失败时不应修改任何选项, 内存预算 %d", got)
+			}
+			if db.wal.syncMode != NoSync {
+				t.Fatalf("失败时不应修改任何选项, SyncMode %v", db.wal.syncMode)
+			}
+		})
+	}
+}
+
+// 测试写入 OPTIONS 文件失败时返回错误，所有选项与 OPTIONS 文件都保持不变
+func TestDB_SetOptions_PersistFailure(t *testing.T) {
+	dir := t.TempDir()
+	fail := &atomic.Bool{}
+	db, err := Open(dir, Options{SyncMode: NoSync, FS: failSyncFS{FS: vfs.NewMemFS(), fail: fail}})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	segmentSize := db.opts.WALSegmentSize
+
+	fail.Store(true)
+	err = db.SetOptions(map[string]string{
+		"wal_segment_size":  "8192",
+		"memory_budget":     "4096",
+		"sync_mode":         "SyncPeriodic",
+		"slow_op_threshold": "1s",
+	})
+	fail.Store(false)
+	if err == nil {
+		t.Fatalf("写入 OPTIONS 文件失败时期望返回错误")
+	}
+
+	if db.wal.segmentSize != segmentSize || db.opts.WALSegmentSize != segmentSize {
+		t.Fatalf("段大小不应修改: %d %d", db.wal.segmentSize, db.opts.WALSegmentSize)
+	}
+	if got := db.memTable.budget.Limit(); got != 0 {
+		t.Fatalf("内存预算不应修改: %d", got)
+	}
+	if db.wal.syncMode != NoSync || db.wal.stopSync != nil || db.opts.SyncMode != NoSync {
+		t.Fatalf("SyncMode 不应修改: %v", db.wal.syncMode)
+	}
+	if db.slowOpThreshold.Load() != 0 || db.memTable.timeStages.Load() {
+		t.Fatalf("慢操作阈值不应修改: %d", db.slowOpThreshold.Load())
+	}
+	p, _, err := readOptionsFile(db.opts.FS, dir)
+	if err != nil || p.WALSegmentSize != segmentSize {
+		t.Fatalf("OPTIONS 文件不应修改: %+v %v", p, err)
+	}
+}
+
+// 测试修改的选项立即应用到各个组件，并写入 OPTIONS 文件
+func TestDB_SetOptions(t *testing.T) {
+	dir := t.TempDir()
+	listener := &slowOpListener{}
+	db, err := Open(dir, Options{SyncMode: NoSync, EventListener: listener})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	err = db.SetOptions(map[string]string{
+		"memtable_gc_bytes": "1024",
+		"memory_budget":     "4096",
+		"wal_segment_size":  "8192",
+		"sync_mode":         "syncperiodic",
+		"sync_period":       "10ms",
+		"slow_op_threshold": "1ns",
+	})
+	if err != nil {
+		t.Fatalf("修改选项失败: %v", err)
+	}
+
+	if db.wal.syncMode != SyncPeriodic || db.wal.active.syncMode != SyncPeriodic || db.wal.stopSync == nil {
+		t.Fatalf("SyncPeriodic 未生效: %v %v", db.wal.syncMode, db.wal.stopSync != nil)
+	}
+	if db.wal.segmentSize != 8192 {
+		t.Fatalf("期望段大小 8192, 实际 %d", db.wal.segmentSize)
+	}
+	if got := db.memTable.budget.Limit(); got != 4096 {
+		t.Fatalf("期望内存预算 4096, 实际 %d", got)
+	}
+	if got := db.memTable.versionGCBytes; got != 1024 {
+		t.Fatalf("期望回收阈值 1024, 实际 %d", got)
+	}
+	if err := db.Set("k", []byte("v")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if len(listener.ops) != 1 || listener.ops[0].Op != "set" || len(listener.ops[0].Stages) != 3 {
+		t.Fatalf("期望一条带组提交阶段的慢操作, 实际 %+v", listener.ops)
+	}
+	p, _, err := readOptionsFile(db.opts.FS, dir)
+	if err != nil || p.WALSegmentSize != 8192 {
+		t.Fatalf("OPTIONS 文件未更新: %+v %v", p, err)
+	}
+
+	// 切换回 SyncEveryWrite 停止后台 fsync，关闭慢操作日志
+	err = db.SetOptions(map[string]string{"sync_mode": "SyncEveryWrite", "slow_op_threshold": "0s"})
+	if err != nil {
+		t.Fatalf("修改选项失败: %v", err)
+	}
+	if db.wal.active.syncMode != SyncEveryWrite || db.wal.stopSync != nil {
+		t.Fatalf("SyncEveryWrite 未生效: %v %v", db.wal.active.syncMode, db.wal.stopSync != nil)
+	}
+	if err := db.Set("k", []byte("v2")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if len(listener.ops) != 1 {
+		t.Fatalf("关闭后不应记录慢操作, 实际 %+v", listener.ops)
+	}
+
+	db.Close()
+	if err := db.SetOptions(map[string]string{"memory_budget": "0"}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("期望 ErrClosed, 实际 %v", err)
+	}
+}
+
+// 测试纯内存数据库同样可以修改选项
+func TestDB_SetOptions_InMemory(t *testing.T) {
+	db, err := Open(InMemory, Options{})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	err = db.SetOptions(map[string]string{"sync_mode": "NoSync", "memory_budget": "100", "slow_op_threshold": time.Hour.String()})
+	if err != nil {
+		t.Fatalf("修改选项失败: %v", err)
+	}
+	if db.opts.SyncMode != NoSync || db.memTable.budget.Limit() != 100 || db.slowOpThreshold.Load() != int64(time.Hour) {
+		t.Fatalf("选项未生效: %v %d %d", db.opts.SyncMode, db.memTable.budget.Limit(), db.slowOpThreshold.Load())
+	}
+}
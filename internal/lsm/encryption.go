@@ -0,0 +1,151 @@
+package lsm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aireet/SimpleDBForge/internal/utils"
+)
+
+var (
+	// ErrEncryptionKey 读取加密的数据时没有配置 KeyProvider，或 KeyProvider 无法提供记录使用的密钥
+	ErrEncryptionKey = errors.New("encryption key unavailable")
+	// ErrDecrypt 加密的记录通过了 CRC 校验但解密失败：密钥与加密时使用的不同，或者数据被篡改
+	ErrDecrypt = errors.New("decrypt failed")
+)
+
+// 加密的记录数据部分：[1字节加密方案][4字节密钥 ID][12字节 nonce][密文 + 16字节认证标签]
+//
+// 加密在压缩之后进行，记录头部的标志位作为附加数据参与认证，不能被单独修改。
+// CRC32C 对密文计算，损坏的检测与截断不需要密钥
+const (
+	// encryptionAESGCM AES-GCM，密钥长度决定 AES-128/192/256，nonce 每条记录随机生成
+	encryptionAESGCM byte = 1
+
+	walNonceSize = 12
+	// walEncryptionOverhead 加密后数据部分增加的长度
+	walEncryptionOverhead = 1 + 4 + walNonceSize + 16
+)
+
+// walCipher 加解密 WAL 记录，按密钥 ID 缓存 AEAD，可以被多个 goroutine 同时使用
+type walCipher struct {
+	keys  KeyProvider
+	mu    sync.RWMutex
+	aeads map[uint32]cipher.AEAD
+}
+
+// newWALCipher 返回使用 keys 的 walCipher，keys 为 nil 时返回 nil（不加密）。
+// 当前密钥无效时返回错误，而不是等到第一次写入
+func newWALCipher(keys KeyProvider) (*walCipher, error) {
+	if keys == nil {
+		return nil, nil
+	}
+	c := &walCipher{keys: keys, aeads: make(map[uint32]cipher.AEAD)}
+	if _, _, err := c.current(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// current 返回加密新数据使用的密钥 ID 与 AEAD；每次都询问 KeyProvider，当前密钥更换后立即生效
+func (c *walCipher) current() (uint32, cipher.AEAD, error) {
+	id, key, err := c.keys.CurrentKey()
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: current key: %w", ErrEncryptionKey, err)
+	}
+	aead, err := c.aead(id, func() ([]byte, error) { return key, nil })
+	return id, aead, err
+}
+
+// aead 返回 ID 对应的 AEAD，缓存中没有时用 load 取得密钥
+func (c *walCipher) aead(id uint32, load func() ([]byte, error)) (cipher.AEAD, error) {
+	c.mu.RLock()
+	aead, ok := c.aeads[id]
+	c.mu.RUnlock()
+	if ok {
+		return aead, nil
+	}
+
+	key, err := load()
+	if err != nil {
+		return nil, fmt.Errorf("%w: key %d: %w", ErrEncryptionKey, id, err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: key %d: %w", ErrEncryptionKey, id, err)
+	}
+	aead, err = cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("%w: key %d: %w", ErrEncryptionKey, id, err)
+	}
+	c.mu.Lock()
+	c.aeads[id] = aead
+	c.mu.Unlock()
+	return aead, nil
+}
+
+// seal 用当前密钥加密 plaintext，结果追加到 dst 之后；flags 为记录最终的标志位（包含 walFlagEncrypted）
+func (c *walCipher) seal(dst []byte, flags byte, plaintext []byte) ([]byte, error) {
+	id, aead, err := c.current()
+	if err != nil {
+		return dst, err
+	}
+	dst = append(dst, encryptionAESGCM)
+	dst = binary.LittleEndian.AppendUint32(dst, id)
+	n := len(dst)
+	dst = append(dst, make([]byte, walNonceSize)...)
+	nonce := dst[n:]
+	if _, err := rand.Read(nonce); err != nil {
+		return dst[:n-5], fmt.Errorf("generate nonce: %w", err)
+	}
+	return aead.Seal(dst, nonce, plaintext, []byte{flags}), nil
+}
+
+// open 解密 seal 产生的数据，结果追加到 dst 之后，同时返回所用密钥的 ID。
+// 数据过短视为损坏；未知的加密方案、取不到密钥与认证失败都不是损坏，恢复时不能据此截断
+func (c *walCipher) open(dst []byte, flags byte, data []byte) ([]byte, uint32, error) {
+	if len(data) < walEncryptionOverhead {
+		return dst, 0, fmt.Errorf("%w: encrypted record of %d bytes is too short", errCorruptedWAL, len(data))
+	}
+	if data[0] != encryptionAESGCM {
+		return dst, 0, fmt.Errorf("unknown encryption scheme %d", data[0])
+	}
+	id := binary.LittleEndian.Uint32(data[1:5])
+	if c == nil {
+		return dst, id, fmt.Errorf("%w: record is encrypted with key %d but no KeyProvider is configured", ErrEncryptionKey, id)
+	}
+	aead, err := c.aead(id, func() ([]byte, error) { return c.keys.GetKey(id) })
+	if err != nil {
+		return dst, id, err
+	}
+	out, err := aead.Open(dst, data[5:5+walNonceSize], data[5+walNonceSize:], []byte{flags})
+	if err != nil {
+		return dst, id, fmt.Errorf("%w: key %d: %w", ErrDecrypt, id, err)
+	}
+	return out, id, nil
+}
+
+// reseal 用当前密钥重新加密 seal 产生的 data，结果追加到 dst 之后，同时返回原来的密钥 ID。
+// data 已经使用当前密钥时原样追加；加密后的长度只取决于明文，与密钥无关，因此结果与 data 等长
+func (c *walCipher) reseal(dst []byte, flags byte, data []byte) ([]byte, uint32, error) {
+	plain := utils.Pool.Get()
+	defer utils.Pool.Put(plain)
+	plaintext, id, err := c.open(plain.AvailableBuffer(), flags, data)
+	if err != nil {
+		return dst, id, err
+	}
+	current, _, err := c.current()
+	if err != nil {
+		return dst, id, err
+	}
+	if id == current {
+		return append(dst, data...), id, nil
+	}
+	dst, err = c.seal(dst, flags, plaintext)
+	return dst, id, err
+}
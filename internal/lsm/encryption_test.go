@@ -0,0 +1,321 @@
+package lsm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/internal/utils"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+var testKey = StaticKey{ID: 3, Secret: bytes.Repeat([]byte{0x5a}, 32)}
+
+// readSegments 返回 dir 下所有 WAL 段文件内容的拼接
+func readSegments(t *testing.T, dir string) []byte {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("找不到 WAL 段: %v", err)
+	}
+	var all []byte
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, data...)
+	}
+	return all
+}
+
+// 测试加密的 WAL：磁盘上没有明文，用同样的密钥重新打开后数据完整；
+// 缺少密钥或密钥错误时 Open 失败，且不会把加密的记录当作损坏截断
+func TestDB_Encryption(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec utils.CodecID
+	}{
+		{name: "none", codec: utils.CodecNone},
+		{name: "zstd", codec: utils.CodecZstd},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := Options{SyncMode: NoSync, WALCompression: tt.codec, EncryptionKeys: testKey}
+			db, err := Open(dir, opts)
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+			secret := []byte(strings.Repeat("top-secret-value ", 30))
+			if err := db.Set("k1", secret); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+			batch := NewWriteBatch()
+			batch.Set("k2", secret)
+			batch.Delete("k1")
+			if err := db.Write(batch); err != nil {
+				t.Fatalf("批量写入失败: %v", err)
+			}
+			if err := db.Close(); err != nil {
+				t.Fatalf("关闭失败: %v", err)
+			}
+
+			walDir := filepath.Join(dir, walDirName)
+			raw := readSegments(t, walDir)
+			if bytes.Contains(raw, []byte("top-secret")) || bytes.Contains(raw, []byte("k2")) {
+				t.Fatal("WAL 中出现了明文")
+			}
+			segment := filepath.Join(walDir, segmentName(1))
+			var keyIDs []uint32
+			if err := InspectWAL(segment, testKey, func(rec WALRecord) error {
+				if !rec.IsEncrypted() {
+					t.Errorf("offset %d 的记录没有加密", rec.Offset)
+				}
+				keyIDs = append(keyIDs, rec.KeyID)
+				return nil
+			}); err != nil {
+				t.Fatalf("检查 WAL 失败: %v", err)
+			}
+			if len(keyIDs) != 2 || keyIDs[0] != testKey.ID || keyIDs[1] != testKey.ID {
+				t.Fatalf("记录的密钥 ID 不正确: %v", keyIDs)
+			}
+			if err := InspectWAL(segment, nil, func(WALRecord) error { return nil }); !errors.Is(err, ErrEncryptionKey) {
+				t.Fatalf("没有密钥时期望 ErrEncryptionKey, 实际 %v", err)
+			}
+
+			// 缺少密钥与密钥错误都不是损坏：Open 失败，段文件保持不变
+			wrongKey := StaticKey{ID: testKey.ID, Secret: bytes.Repeat([]byte{0x01}, 32)}
+			for _, keys := range []struct {
+				provider KeyProvider
+				want     error
+			}{
+				{provider: nil, want: ErrEncryptionKey},
+				{provider: StaticKey{ID: 9, Secret: testKey.Secret}, want: ErrEncryptionKey},
+				{provider: wrongKey, want: ErrDecrypt},
+			} {
+				o := opts
+				o.EncryptionKeys = keys.provider
+				if _, err := Open(dir, o); !errors.Is(err, keys.want) {
+					t.Fatalf("期望 %v, 实际 %v", keys.want, err)
+				}
+			}
+			if after := readSegments(t, walDir); !bytes.Equal(after, raw) {
+				t.Fatal("打开失败后 WAL 被修改")
+			}
+
+			db, err = Open(dir, opts)
+			if err != nil {
+				t.Fatalf("重新打开失败: %v", err)
+			}
+			defer db.Close()
+			if got, err := db.Get("k2"); err != nil || !bytes.Equal(got, secret) {
+				t.Fatalf("k2 回放后不一致: %v", err)
+			}
+			if _, err := db.Get("k1"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("k1 应当已被删除, 实际 %v", err)
+			}
+		})
+	}
+
+	if _, err := Open(t.TempDir(), Options{EncryptionKeys: StaticKey{ID: 1, Secret: []byte("short")}}); !errors.Is(err, ErrEncryptionKey) {
+		t.Fatalf("无效的密钥应当在打开时报错, 实际 %v", err)
+	}
+}
+
+// 测试启用加密之前写入的明文记录仍然可读
+func TestDB_EncryptionEnableLater(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.Set("plain", []byte("v1")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	db.Close()
+
+	opts := Options{SyncMode: NoSync, EncryptionKeys: testKey}
+	db, err = Open(dir, opts)
+	if err != nil {
+		t.Fatalf("启用加密后打开失败: %v", err)
+	}
+	if err := db.Set("encrypted", []byte("v2")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	db.Close()
+
+	db, err = Open(dir, opts)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer db.Close()
+	for k, want := range map[string]string{"plain": "v1", "encrypted": "v2"} {
+		if got, err := db.Get(k); err != nil || string(got) != want {
+			t.Fatalf("%s 期望 %q, 实际 %q %v", k, want, got, err)
+		}
+	}
+}
+
+// 测试加密数据库的备份同样加密，恢复时需要同样的密钥
+func TestDB_EncryptedBackup(t *testing.T) {
+	opts := Options{SyncMode: NoSync, EncryptionKeys: testKey}
+	db, err := Open(t.TempDir(), opts)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	if err := db.Set("key", []byte("backup-secret")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	backup := filepath.Join(t.TempDir(), "full")
+	if err := db.Backup(context.Background(), backup); err != nil {
+		t.Fatalf("备份失败: %v", err)
+	}
+	if bytes.Contains(readSegments(t, filepath.Join(backup, walDirName)), []byte("backup-secret")) {
+		t.Fatal("备份中出现了明文")
+	}
+
+	dst := filepath.Join(t.TempDir(), "restored")
+	if _, err := RestoreBackup(context.Background(), vfs.OSFS{}, dst, []string{backup}, RestoreOptions{}); !errors.Is(err, ErrEncryptionKey) {
+		t.Fatalf("没有密钥时期望 ErrEncryptionKey, 实际 %v", err)
+	}
+	if _, err := RestoreBackup(context.Background(), vfs.OSFS{}, dst, []string{backup}, RestoreOptions{EncryptionKeys: testKey}); err != nil {
+		t.Fatalf("恢复失败: %v", err)
+	}
+	if bytes.Contains(readSegments(t, filepath.Join(dst, walDirName)), []byte("backup-secret")) {
+		t.Fatal("恢复出的 WAL 中出现了明文")
+	}
+	restored, err := Open(dst, opts)
+	if err != nil {
+		t.Fatalf("打开恢复的数据库失败: %v", err)
+	}
+	defer restored.Close()
+	if got, err := restored.Get("key"); err != nil || string(got) != "backup-secret" {
+		t.Fatalf("恢复的数据不一致: %q %v", got, err)
+	}
+}
+
+// 测试轮换密钥后重新加密 WAL：旧密钥的记录换用新密钥，明文记录保持不变，之后旧密钥可以移除
+func TestDB_ReencryptWAL(t *testing.T) {
+	dir := t.TempDir()
+	oldKey, newKey := bytes.Repeat([]byte{0x11}, 32), bytes.Repeat([]byte{0x22}, 16)
+	opts := Options{SyncMode: NoSync, WALSegmentSize: 512}
+
+	// 启用加密之前写入一条明文记录，之后分别用密钥 1、2 写入若干记录
+	write := func(keys KeyProvider, prefix string, n int) {
+		t.Helper()
+		o := opts
+		o.EncryptionKeys = keys
+		db, err := Open(dir, o)
+		if err != nil {
+			t.Fatalf("打开数据库失败: %v", err)
+		}
+		for i := range n {
+			if err := db.Set(fmt.Sprintf("%s-%02d", prefix, i), []byte(strings.Repeat(prefix, 20))); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+		}
+		if err := db.Close(); err != nil {
+			t.Fatalf("关闭失败: %v", err)
+		}
+	}
+	write(nil, "plain", 1)
+	write(KeyRing{Current: 1, Keys: map[uint32][]byte{1: oldKey}}, "old", 20)
+	ring := KeyRing{Current: 2, Keys: map[uint32][]byte{1: oldKey, 2: newKey}}
+	write(ring, "new", 5)
+
+	o := opts
+	o.EncryptionKeys = ring
+	db, err := Open(dir, o)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	sizes := segmentSizes(t, filepath.Join(dir, walDirName))
+	info, err := db.ReencryptWAL(context.Background())
+	if err != nil {
+		t.Fatalf("重新加密失败: %v", err)
+	}
+	if info.KeyID != 2 || info.Records != 20 || info.Segments == 0 || !slices.Equal(info.RetiredKeys, []uint32{1}) {
+		t.Fatalf("重新加密的结果不符合预期: %+v", info)
+	}
+	// 记录的长度不变，已有的段大小保持不变
+	for name, size := range segmentSizes(t, filepath.Join(dir, walDirName)) {
+		if before, ok := sizes[name]; ok && before != size {
+			t.Fatalf("%s 的大小从 %d 变为 %d", name, before, size)
+		}
+	}
+	if info, err := db.ReencryptWAL(context.Background()); err != nil || info.Records != 0 || info.Segments != 0 {
+		t.Fatalf("再次重新加密期望没有需要处理的记录, 实际 %+v %v", info, err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	// 移除旧密钥后所有数据仍然可读，明文记录没有被加密
+	onlyNew := KeyRing{Current: 2, Keys: map[uint32][]byte{2: newKey}}
+	var plain int
+	for name := range segmentSizes(t, filepath.Join(dir, walDirName)) {
+		err := InspectWAL(filepath.Join(dir, walDirName, name), onlyNew, func(rec WALRecord) error {
+			if !rec.IsEncrypted() {
+				plain++
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("检查 %s 失败: %v", name, err)
+		}
+	}
+	if plain != 1 {
+		t.Fatalf("期望 1 条明文记录, 实际 %d", plain)
+	}
+	o.EncryptionKeys = onlyNew
+	db, err = Open(dir, o)
+	if err != nil {
+		t.Fatalf("移除旧密钥后打开失败: %v", err)
+	}
+	defer db.Close()
+	for _, key := range []string{"plain-00", "old-00", "old-19", "new-04"} {
+		if _, err := db.Get(key); err != nil {
+			t.Fatalf("读取 %s 失败: %v", key, err)
+		}
+	}
+
+	plainDB := openTestDB(t, t.TempDir())
+	defer plainDB.Close()
+	if _, err := plainDB.ReencryptWAL(context.Background()); !errors.Is(err, ErrEncryptionKey) {
+		t.Fatalf("未启用加密时期望 ErrEncryptionKey, 实际 %v", err)
+	}
+	memDB, err := Open(InMemory, Options{EncryptionKeys: onlyNew})
+	if err != nil {
+		t.Fatalf("打开纯内存数据库失败: %v", err)
+	}
+	defer memDB.Close()
+	if _, err := memDB.ReencryptWAL(context.Background()); !errors.Is(err, ErrInMemory) {
+		t.Fatalf("纯内存数据库期望 ErrInMemory, 实际 %v", err)
+	}
+}
+
+// segmentSizes 返回 dir 下每个 WAL 段文件的大小
+func segmentSizes(t *testing.T, dir string) map[string]int64 {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := make(map[string]int64, len(paths))
+	for _, p := range paths {
+		fi, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[filepath.Base(p)] = fi.Size()
+	}
+	return sizes
+}
@@ -0,0 +1,62 @@
+package lsm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+)
+
+// ErrChecksumMismatch 读取到的条目与写入时计算的校验和不一致，见 Options.EntryChecksums
+var ErrChecksumMismatch = errors.New("entry checksum mismatch")
+
+// entryChecksum 计算条目的校验和，覆盖列族、key、value、过期时间与用户元数据。
+// 没有用户元数据时与加入元数据之前的计算结果相同，已有的校验和仍然有效。
+// 结果为 0 时取 1，0 留给没有校验和的条目
+func entryChecksum(e *sdbf.Entry) uint32 {
+	buf := utils.Pool.Get()
+	defer utils.Pool.Put(buf)
+	b := buf.AvailableBuffer()
+	b = binary.AppendUvarint(b, uint64(len(e.ColumnFamily)))
+	b = append(b, e.ColumnFamily...)
+	b = binary.AppendUvarint(b, uint64(len(e.Key)))
+	b = append(b, e.Key...)
+	b = binary.LittleEndian.AppendUint64(b, uint64(e.ExpireAt))
+	if len(e.UserMeta) > 0 {
+		b = binary.AppendUvarint(b, uint64(len(e.UserMeta)))
+		b = append(b, e.UserMeta...)
+	}
+	crc := crc32.Update(crc32.Checksum(b, crcTable), crcTable, e.Value)
+	return max(crc, 1)
+}
+
+// setChecksums 为还没有校验和的写入计算校验和；墓碑没有值，不需要校验
+func setChecksums(entries []*sdbf.Entry) {
+	for _, e := range entries {
+		if !e.Tombstone && e.Checksum == 0 {
+			e.Checksum = entryChecksum(e)
+		}
+	}
+}
+
+// verifyEntry 在启用 Options.EntryChecksums 时校验读取到的条目，没有校验和的条目（启用之前写入的）不校验
+func (db *DB) verifyEntry(e *sdbf.Entry) error {
+	return db.checkEntry(e, db.opts.EntryChecksums)
+}
+
+// checkEntry 在 verify 为 true 且条目带有校验和时校验它
+func (db *DB) checkEntry(e *sdbf.Entry, verify bool) error {
+	if !verify || e.Checksum == 0 {
+		return nil
+	}
+	if got := entryChecksum(e); got != e.Checksum {
+		slog.Error("entry checksum mismatch", "dir", db.dir, "cf", e.ColumnFamily,
+			"key", e.Key, "version", e.Version, "want", e.Checksum, "got", got)
+		return fmt.Errorf("%w: key %q version %d", ErrChecksumMismatch, e.Key, e.Version)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package lsm
+
+import (
+	"errors"
+	"testing"
+)
+
+// 测试启用条目校验和：写入时计算并随 WAL 保存，值在写入之后被修改时 Get 返回 ErrChecksumMismatch
+func TestDB_EntryChecksums(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{SyncMode: NoSync, EntryChecksums: true}
+	db, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	cf, err := db.CF("meta")
+	if err != nil {
+		t.Fatalf("创建列族失败: %v", err)
+	}
+
+	values := map[string][]byte{"db": []byte("value-db"), "cf": []byte("value-cf"), "snap": []byte("value-snap")}
+	if err := db.Set("db", values["db"]); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := cf.Set("cf", values["cf"]); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Set("snap", values["snap"]); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	defer snap.Release()
+	if err := db.Delete("deleted"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		get  func() ([]byte, error)
+	}{
+		{name: "db", get: func() ([]byte, error) { return db.Get("db") }},
+		{name: "cf", get: func() ([]byte, error) { return cf.Get("cf") }},
+		{name: "snap", get: func() ([]byte, error) { return snap.Get("snap") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.get(); err != nil || string(got) != "value-"+tt.name {
+				t.Fatalf("读取失败: %q %v", got, err)
+			}
+			// Set 保存的是调用方的切片，修改它相当于 MemTable 中的数据被破坏
+			values[tt.name][0] ^= 0xff
+			if _, err := tt.get(); !errors.Is(err, ErrChecksumMismatch) {
+				t.Fatalf("期望 ErrChecksumMismatch, 实际 %v", err)
+			}
+			values[tt.name][0] ^= 0xff
+		})
+	}
+	if e, ok := db.memTable.Get("deleted"); !ok || e.Checksum != 0 {
+		t.Fatalf("墓碑不应有校验和: %+v", e)
+	}
+
+	// 校验和随 WAL 保存，重新打开后仍然校验
+	db.Close()
+	db, err = Open(dir, opts)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer db.Close()
+	e, ok := db.memTable.Get("db")
+	if !ok || e.Checksum != entryChecksum(e) {
+		t.Fatalf("回放后的校验和不正确: %+v", e)
+	}
+	e.Value[0] ^= 0xff
+	if _, err := db.Get("db"); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("期望 ErrChecksumMismatch, 实际 %v", err)
+	}
+}
+
+// 测试未启用时不计算也不校验，启用之前写入的条目没有校验和，不做校验
+func TestDB_EntryChecksumsDisabled(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.Set("k", []byte("v")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if e, _ := db.memTable.Get("k"); e.Checksum != 0 {
+		t.Fatalf("未启用时不应计算校验和: %d", e.Checksum)
+	}
+	db.Close()
+
+	db, err = Open(dir, Options{SyncMode: NoSync, EntryChecksums: true})
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer db.Close()
+	if got, err := db.Get("k"); err != nil || string(got) != "v" {
+		t.Fatalf("启用之前写入的条目应当可读: %q %v", got, err)
+	}
+}
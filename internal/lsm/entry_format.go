@@ -0,0 +1,61 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+// ErrUnsupportedFormat 数据由更新版本的引擎写入，包含当前版本无法识别的记录类型。
+// 这类数据通过了 CRC 校验，不是损坏，恢复时不能截断，需要升级引擎后再打开
+var ErrUnsupportedFormat = errors.New("unsupported entry format")
+
+// entryFormatVersion 当前写入的 Entry 格式版本，记录在 OPTIONS 文件中：
+//   - v1：没有 record_type，条目类型由 tombstone 与 range_end 推导
+//   - v2：写入时填写 record_type 与 user_meta
+//
+// 新字段都是 proto3 的可选字段，v1 的数据按 v2 解码时 record_type 为 UNSPECIFIED，
+// 读取时统一补齐，之后的代码不需要区分两种格式
+const entryFormatVersion = 2
+
+// recordTypeOf 根据 tombstone 与 range_end 推导条目的记录类型
+func recordTypeOf(e *sdbf.Entry) sdbf.RecordType {
+	switch {
+	case e.RangeEnd != "":
+		return sdbf.RecordType_RECORD_TYPE_RANGE_DELETE
+	case e.Tombstone:
+		return sdbf.RecordType_RECORD_TYPE_DELETE
+	default:
+		return sdbf.RecordType_RECORD_TYPE_VALUE
+	}
+}
+
+// setRecordTypes 为还没有记录类型的写入填写记录类型
+func setRecordTypes(entries []*sdbf.Entry) {
+	for _, e := range entries {
+		if e.RecordType == sdbf.RecordType_RECORD_TYPE_UNSPECIFIED {
+			e.RecordType = recordTypeOf(e)
+		}
+	}
+}
+
+// upgradeEntries 检查从磁盘解码出的条目的记录类型：v1 的条目补齐记录类型；
+// 记录类型与 tombstone、range_end 矛盾时返回包装了 errCorruptedWAL 的错误；
+// 无法识别的记录类型返回 ErrUnsupportedFormat
+func upgradeEntries(entries []*sdbf.Entry) error {
+	for _, e := range entries {
+		want := recordTypeOf(e)
+		switch e.RecordType {
+		case sdbf.RecordType_RECORD_TYPE_UNSPECIFIED:
+			e.RecordType = want
+		case sdbf.RecordType_RECORD_TYPE_VALUE, sdbf.RecordType_RECORD_TYPE_DELETE, sdbf.RecordType_RECORD_TYPE_RANGE_DELETE:
+			if e.RecordType != want {
+				return fmt.Errorf("%w: key %q has record type %v, expected %v", errCorruptedWAL, e.Key, e.RecordType, want)
+			}
+		default:
+			return fmt.Errorf("%w: key %q has unknown record type %d", ErrUnsupportedFormat, e.Key, int32(e.RecordType))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+// 测试解码时 v1 条目补齐记录类型，矛盾的记录类型视为损坏，无法识别的记录类型返回 ErrUnsupportedFormat
+func TestDecodeRecord_RecordType(t *testing.T) {
+	tests := []struct {
+		name     string
+		entry    *sdbf.Entry
+		want     sdbf.RecordType
+		wantErr  error
+		corrupts bool
+	}{
+		{name: "v1 值", entry: &sdbf.Entry{Key: "k", Value: []byte("v")}, want: sdbf.RecordType_RECORD_TYPE_VALUE},
+		{name: "v1 墓碑", entry: &sdbf.Entry{Key: "k", Tombstone: true}, want: sdbf.RecordType_RECORD_TYPE_DELETE},
+		{name: "v1 范围墓碑", entry: &sdbf.Entry{Key: "a", RangeEnd: "b", Tombstone: true}, want: sdbf.RecordType_RECORD_TYPE_RANGE_DELETE},
+		{name: "v2 值", entry: &sdbf.Entry{Key: "k", RecordType: sdbf.RecordType_RECORD_TYPE_VALUE, UserMeta: []byte("meta")}, want: sdbf.RecordType_RECORD_TYPE_VALUE},
+		{name: "类型矛盾", entry: &sdbf.Entry{Key: "k", RecordType: sdbf.RecordType_RECORD_TYPE_DELETE}, wantErr: errCorruptedWAL},
+		{name: "未知类型", entry: &sdbf.Entry{Key: "k", RecordType: 42}, wantErr: ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var frame, buf bytes.Buffer
+			if err := appendEntryFrame(&frame, tt.entry, nil, nil, WALMaxRecordSizeLimit); err != nil {
+				t.Fatalf("编码失败: %v", err)
+			}
+			rec, err := decodeRecord(&frame, &buf, WALMaxRecordSizeLimit, nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("期望错误 %v, 实际 %v", tt.wantErr, err)
+			}
+			if tt.wantErr == ErrUnsupportedFormat && errors.Is(err, errCorruptedWAL) {
+				t.Fatalf("无法识别的记录类型不应视为损坏: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if got := rec.Entries[0].RecordType; got != tt.want {
+				t.Fatalf("期望记录类型 %v, 实际 %v", tt.want, got)
+			}
+			if !bytes.Equal(rec.Entries[0].UserMeta, tt.entry.UserMeta) {
+				t.Fatalf("user_meta 期望 %q, 实际 %q", tt.entry.UserMeta, rec.Entries[0].UserMeta)
+			}
+		})
+	}
+}
+
+// 测试写入时填写记录类型，重启后 v1 的记录照常恢复，包含未知记录类型的 WAL 拒绝打开且不被截断
+func TestOpen_EntryFormat(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	if err := db.Set("k", []byte("v")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Delete("d"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	for key, want := range map[string]sdbf.RecordType{"k": sdbf.RecordType_RECORD_TYPE_VALUE, "d": sdbf.RecordType_RECORD_TYPE_DELETE} {
+		if e, ok := db.memTable.def.get(key); !ok || e.RecordType != want {
+			t.Fatalf("%s 期望记录类型 %v, 实际 %v", key, want, e)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	path := filepath.Join(dir, walDirName, segmentName(1))
+	appendRaw := func(e *sdbf.Entry) {
+		var frame bytes.Buffer
+		if err := appendEntryFrame(&frame, e, nil, nil, WALMaxRecordSizeLimit); err != nil {
+			t.Fatalf("编码失败: %v", err)
+		}
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.Write(frame.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 旧版本写入的记录没有 record_type
+	appendRaw(&sdbf.Entry{Key: "old", Value: []byte("v1"), Version: 100})
+	db, err = Open(dir, Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开 v1 记录失败: %v", err)
+	}
+	if got, err := db.Get("old"); err != nil || string(got) != "v1" {
+		t.Fatalf("读取 v1 记录失败: %q %v", got, err)
+	}
+	if e, _ := db.memTable.def.get("old"); e.RecordType != sdbf.RecordType_RECORD_TYPE_VALUE {
+		t.Fatalf("v1 记录应补齐记录类型, 实际 %v", e.RecordType)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	// 更新版本的引擎写入的记录
+	appendRaw(&sdbf.Entry{Key: "new", Version: 200, RecordType: 42})
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(dir, Options{SyncMode: NoSync}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("期望 ErrUnsupportedFormat, 实际 %v", err)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatal("无法识别的记录不应被截断")
+	}
+}
@@ -0,0 +1,68 @@
+package lsm
+
+// EventListener 接收引擎内部事件的通知，通过 Options.EventListener 注册，
+// 便于外部系统观测引擎行为而不必解析日志
+//
+// 回调在触发事件的 goroutine 中同步执行，且不持有引擎内部的锁：回调中可以调用 DB 的方法，
+// 但耗时的回调会直接拖慢对应的操作（例如段切换会拖慢触发它的写入）。
+// 回调可能被并发调用，实现需要自行保证并发安全
+//
+// 实现时建议嵌入 BaseEventListener，之后新增的事件不会破坏已有实现
+type EventListener interface {
+	// OnWALRotate 在 WAL 活跃段被封存并切换到新段之后调用
+	OnWALRotate(info WALRotateInfo)
+	// OnWALArchive 在一个封存的段被归档（见 Options.WALArchiveDir）之后调用，
+	// 在后台归档协程中执行，可以在这里把段上传到对象存储等，供时间点恢复使用
+	OnWALArchive(info WALArchiveInfo)
+	// OnRecoveryProgress 在打开数据库回放 WAL 时，每应用一批记录、每回放完一个段调用一次，
+	// 在 Open 的 goroutine 中执行，可以用于展示大 WAL 的恢复进度
+	OnRecoveryProgress(progress RecoveryProgress)
+	// OnSlowOp 在一次操作的耗时达到 Options.SlowOpThreshold 时、操作返回之前调用
+	OnSlowOp(info SlowOpInfo)
+	// OnCorruption 在后台校验（见 Options.ScrubInterval）发现封存的 WAL 段损坏时调用，
+	// 在后台校验协程中执行，每个损坏的段只报告一次
+	OnCorruption(info CorruptionInfo)
+}
+
+// WALRotateInfo 描述一次 WAL 段切换
+type WALRotateInfo struct {
+	// Dir WAL 段所在目录
+	Dir string
+	// SealedSegment 被封存的段序号，SealedSize 为其封存时的大小（字节）
+	SealedSegment uint64
+	SealedSize    int64
+	// ActiveSegment 新的活跃段序号
+	ActiveSegment uint64
+}
+
+// WALArchiveInfo 描述一次 WAL 段归档
+type WALArchiveInfo struct {
+	// Dir 归档目录
+	Dir string
+	// Segment 归档的段序号，Path 与 Size 为归档文件的路径与大小
+	Segment uint64
+	Path    string
+	Size    int64
+}
+
+// CorruptionInfo 描述校验时在 WAL 段中发现的一处损坏
+type CorruptionInfo struct {
+	// Path 损坏的段文件，Segment 为其序号
+	Path    string
+	Segment uint64
+	// Offset 第一条损坏的记录在段中的偏移，之后的记录无法定位，不再校验
+	Offset int64
+	// Err 损坏的原因，满足 errors.As(err, *WALCorruptionError)
+	Err error
+}
+
+// BaseEventListener 对所有事件不做任何处理，用于嵌入到只关心部分事件的实现中
+type BaseEventListener struct{}
+
+func (BaseEventListener) OnWALRotate(WALRotateInfo)           {}
+func (BaseEventListener) OnWALArchive(WALArchiveInfo)         {}
+func (BaseEventListener) OnRecoveryProgress(RecoveryProgress) {}
+func (BaseEventListener) OnSlowOp(SlowOpInfo)                 {}
+func (BaseEventListener) OnCorruption(CorruptionInfo)         {}
+
+var _ EventListener = BaseEventListener{}
@@ -0,0 +1,294 @@
+package lsm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidImport 导入的数据格式不正确
+var ErrInvalidImport = errors.New("invalid import data")
+
+// ExportFormat 是 DB.Export 与 DB.Import 使用的文本格式
+type ExportFormat int
+
+const (
+	// FormatJSONLines 每行一个 JSON 对象：
+	//
+	//	{"cf":"users","key":"a","value":"1","expire_at":"2026-01-02T15:04:05Z"}
+	//
+	// 默认列族与永不过期时省略 cf 与 expire_at
+	FormatJSONLines ExportFormat = iota
+	// FormatCSV 第一行是表头 cf,key,value,expire_at,encoding，之后每行一个键值对，
+	// 默认列族与永不过期时对应的列为空
+	FormatCSV
+)
+
+// exportBase64 是 encoding 字段的取值：key 与 value 不是合法的 UTF-8 文本或包含 \r 时
+// 两者都以标准 base64 编码，其余情况下原样写出，便于阅读与编辑
+const exportBase64 = "base64"
+
+// csvHeader 是 FormatCSV 的表头
+var csvHeader = []string{"cf", "key", "value", "expire_at", "encoding"}
+
+// importBatchSize 导入时每个 WriteBatch 的最大条目数
+const importBatchSize = 1000
+
+func (f ExportFormat) String() string {
+	switch f {
+	case FormatJSONLines:
+		return "jsonl"
+	case FormatCSV:
+		return "csv"
+	default:
+		return fmt.Sprintf("ExportFormat(%d)", int(f))
+	}
+}
+
+// ParseExportFormat 解析 ExportFormat.String 的结果
+func ParseExportFormat(s string) (ExportFormat, error) {
+	switch s {
+	case "jsonl":
+		return FormatJSONLines, nil
+	case "csv":
+		return FormatCSV, nil
+	default:
+		return 0, fmt.Errorf("unknown export format %q, want jsonl or csv", s)
+	}
+}
+
+// exportRecord 是导出文件中的一条记录
+type exportRecord struct {
+	CF       string `json:"cf,omitempty"`
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	ExpireAt string `json:"expire_at,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Export 把数据库当前的一致视图以 format 格式写入 w，返回写出的键值对数
+//
+// 与 Backup 一样基于快照，依次写出每个列族中存活的键值对，墓碑与已过期的条目不写出；
+// 过期时间以 RFC 3339 格式的绝对时间写出。导出文件用于与其他系统交换数据或调试时查看，
+// 不保留序列号，需要完整恢复时应当使用 Backup
+func (db *DB) Export(w io.Writer, format ExportFormat) (int, error) {
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		return 0, fmt.Errorf("export: %w", err)
+	}
+	defer snap.Release()
+
+	write, flush, err := newExportWriter(w, format)
+	if err != nil {
+		return 0, fmt.Errorf("export: %w", err)
+	}
+	n := 0
+	it := newLiveIterator(db.memTable.familiesIterator(snap.Seq()), db.now())
+	for it.Seek(""); it.Valid(); it.Next() {
+		if err := write(toExportRecord(it.Entry().ColumnFamily, it.Key(), it.Value(), it.Entry().ExpireAt)); err != nil {
+			return n, fmt.Errorf("export: %w", err)
+		}
+		n++
+	}
+	if err := flush(); err != nil {
+		return n, fmt.Errorf("export: %w", err)
+	}
+	return n, nil
+}
+
+// newExportWriter 返回按 format 向 w 写出一条记录的 write，以及写完之后刷出缓冲的 flush；CSV 先写出表头
+func newExportWriter(w io.Writer, format ExportFormat) (write func(exportRecord) error, flush func() error, err error) {
+	switch format {
+	case FormatJSONLines:
+		bw := bufio.NewWriter(w)
+		enc := json.NewEncoder(bw)
+		enc.SetEscapeHTML(false)
+		return func(rec exportRecord) error { return enc.Encode(rec) }, bw.Flush, nil
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		write = func(rec exportRecord) error {
+			return cw.Write([]string{rec.CF, rec.Key, rec.Value, rec.ExpireAt, rec.Encoding})
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+		return write, flush, cw.Write(csvHeader)
+	default:
+		return nil, nil, fmt.Errorf("unknown format %v", format)
+	}
+}
+
+func toExportRecord(cf, key string, value []byte, expireAt int64) exportRecord {
+	rec := exportRecord{CF: cf, Key: key, Value: string(value)}
+	if !utf8.ValidString(key) || !utf8.Valid(value) || strings.ContainsRune(key, '\r') || bytes.ContainsRune(value, '\r') {
+		rec.Key = base64.StdEncoding.EncodeToString([]byte(key))
+		rec.Value = base64.StdEncoding.EncodeToString(value)
+		rec.Encoding = exportBase64
+	}
+	if expireAt != 0 {
+		rec.ExpireAt = time.Unix(0, expireAt).UTC().Format(time.RFC3339Nano)
+	}
+	return rec
+}
+
+// Import 从 r 读取 format 格式（见 ExportFormat）的键值对并写入数据库，返回写入的键值对数
+//
+// 键值对按 importBatchSize 分批通过 DB.Write 提交，整个导入不是原子的：出错时已提交的批次保留，
+// 返回值为出错前写入的键值对数。已存在的 key 被覆盖；过期时间已过的键值对被跳过；
+// cf 列为空或为 DefaultColumnFamily 时写入默认列族，不存在的列族会被创建
+func (db *DB) Import(r io.Reader, format ExportFormat) (int, error) {
+	next, err := newImportReader(r, format)
+	if err != nil {
+		return 0, fmt.Errorf("import: %w", err)
+	}
+
+	b := NewWriteBatch()
+	n, size := 0, 0
+	flush := func() error {
+		if b.Len() == 0 {
+			return nil
+		}
+		if err := db.Write(b); err != nil {
+			return err
+		}
+		n += b.Len()
+		b.Reset()
+		size = 0
+		return nil
+	}
+
+	cfs := make(map[string]string)
+	now := db.now().UnixNano()
+	for i := 1; ; i++ {
+		rec, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, fmt.Errorf("import: %w", err)
+		}
+		op, err := db.importOp(rec, cfs)
+		if err != nil {
+			return n, fmt.Errorf("import: record %d: %w", i, err)
+		}
+		if op.expireAt != 0 && op.expireAt <= now {
+			continue
+		}
+		// 批次的编码大小估算同 checkBatch，保持在单条 WAL 记录上限的一半以内
+		opSize := len(op.cf) + len(op.key) + len(op.value) + batchOpOverhead
+		if b.Len() == importBatchSize || int64(size+opSize) > db.opts.WALMaxRecordSize/2 {
+			if err := flush(); err != nil {
+				return n, fmt.Errorf("import: %w", err)
+			}
+		}
+		b.ops = append(b.ops, op)
+		size += opSize
+	}
+	if err := flush(); err != nil {
+		return n, fmt.Errorf("import: %w", err)
+	}
+	return n, nil
+}
+
+// importOp 把一条记录转换为批次中的写入操作，cfs 缓存已校验过的列族名称
+func (db *DB) importOp(rec exportRecord, cfs map[string]string) (batchOp, error) {
+	op := batchOp{key: rec.Key, value: []byte(rec.Value)}
+	switch rec.Encoding {
+	case "":
+	case exportBase64:
+		key, err := base64.StdEncoding.DecodeString(rec.Key)
+		if err != nil {
+			return batchOp{}, fmt.Errorf("%w: key: %w", ErrInvalidImport, err)
+		}
+		if op.value, err = base64.StdEncoding.DecodeString(rec.Value); err != nil {
+			return batchOp{}, fmt.Errorf("%w: value: %w", ErrInvalidImport, err)
+		}
+		op.key = string(key)
+	default:
+		return batchOp{}, fmt.Errorf("%w: unknown encoding %q", ErrInvalidImport, rec.Encoding)
+	}
+	if rec.ExpireAt != "" {
+		t, err := time.Parse(time.RFC3339Nano, rec.ExpireAt)
+		if err != nil {
+			return batchOp{}, fmt.Errorf("%w: expire_at: %w", ErrInvalidImport, err)
+		}
+		op.expireAt = t.UnixNano()
+	}
+	if rec.CF != "" {
+		name, ok := cfs[rec.CF]
+		if !ok {
+			cf, err := db.CF(rec.CF)
+			if err != nil {
+				return batchOp{}, err
+			}
+			name = cf.name
+			cfs[rec.CF] = name
+		}
+		op.cf = name
+	}
+	return op, nil
+}
+
+// newImportReader 返回按 format 从 r 依次读取记录的函数，读完时返回 io.EOF
+func newImportReader(r io.Reader, format ExportFormat) (func() (exportRecord, error), error) {
+	switch format {
+	case FormatJSONLines:
+		br := bufio.NewReader(r)
+		line := 0
+		return func() (exportRecord, error) {
+			for {
+				data, err := br.ReadBytes('\n')
+				line++
+				if len(bytes.TrimSpace(data)) == 0 {
+					if err != nil {
+						return exportRecord{}, err
+					}
+					continue
+				}
+				if err != nil && err != io.EOF {
+					return exportRecord{}, err
+				}
+				var rec exportRecord
+				if err := json.Unmarshal(data, &rec); err != nil {
+					return exportRecord{}, fmt.Errorf("%w: line %d: %w", ErrInvalidImport, line, err)
+				}
+				return rec, nil
+			}
+		}, nil
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = len(csvHeader)
+		header, err := cr.Read()
+		if err == io.EOF {
+			return func() (exportRecord, error) { return exportRecord{}, io.EOF }, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+		}
+		if !slices.Equal(header, csvHeader) {
+			return nil, fmt.Errorf("%w: csv header %q, want %q", ErrInvalidImport, header, csvHeader)
+		}
+		return func() (exportRecord, error) {
+			fields, err := cr.Read()
+			if err == io.EOF {
+				return exportRecord{}, err
+			}
+			if err != nil {
+				return exportRecord{}, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+			}
+			return exportRecord{CF: fields[0], Key: fields[1], Value: fields[2], ExpireAt: fields[3], Encoding: fields[4]}, nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %v", format)
+	}
+}
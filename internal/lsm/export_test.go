@@ -0,0 +1,124 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDB_ExportImport(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	src := openTestDB(t, t.TempDir())
+	defer src.Close()
+	src.now = clock.Now
+
+	for key, value := range map[string]string{"a": "1", "deleted": "x", "bin": "\xff\x00", "crlf": "x\r\ny", "quote": `"a,b"`} {
+		if err := src.Set(key, []byte(value)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := src.Delete("deleted"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if err := src.SetWithTTL("ttl", []byte("v"), time.Hour); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := src.SetWithTTL("expired", []byte("v"), time.Second); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	users, err := src.CF("users")
+	if err != nil {
+		t.Fatalf("获取列族失败: %v", err)
+	}
+	if err := users.Set("u1", []byte("alice")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	clock.Advance(2 * time.Second)
+
+	for _, format := range []ExportFormat{FormatJSONLines, FormatCSV} {
+		t.Run(format.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := src.Export(&buf, format)
+			if err != nil || n != 6 {
+				t.Fatalf("导出期望 6 条, 实际 %d, err=%v", n, err)
+			}
+			exported := buf.String()
+			if !strings.Contains(exported, "alice") || strings.Contains(exported, "deleted") || strings.Contains(exported, "expired") {
+				t.Fatalf("导出内容不正确:\n%s", exported)
+			}
+
+			dst := openTestDB(t, t.TempDir())
+			defer dst.Close()
+			dst.now = clock.Now
+			if n, err := dst.Import(&buf, format); err != nil || n != 6 {
+				t.Fatalf("导入期望 6 条, 实际 %d, err=%v", n, err)
+			}
+			for key, want := range map[string]string{"bin": "\xff\x00", "crlf": "x\r\ny", "quote": `"a,b"`} {
+				if got, err := dst.Get(key); err != nil || string(got) != want {
+					t.Fatalf("%s 期望 %q, 实际 %q, err=%v", key, want, got, err)
+				}
+			}
+			if at, err := dst.ExpireAt("ttl"); err != nil || !at.Equal(clock.now.Add(time.Hour-2*time.Second)) {
+				t.Fatalf("ttl 的过期时间不正确: %v, err=%v", at, err)
+			}
+			cf, err := dst.CF("users")
+			if err != nil {
+				t.Fatalf("获取列族失败: %v", err)
+			}
+			if got, err := cf.Get("u1"); err != nil || string(got) != "alice" {
+				t.Fatalf("列族中的 u1 期望 alice, 实际 %q, err=%v", got, err)
+			}
+
+			// 再次导出得到相同的内容
+			var again bytes.Buffer
+			if _, err := dst.Export(&again, format); err != nil || again.String() != exported {
+				t.Fatalf("往返后导出内容不同, err=%v:\n%s\n%s", err, exported, again.String())
+			}
+
+			// 导入时已经过期的键值对被跳过
+			clock.Advance(time.Hour)
+			if n, err := dst.Import(strings.NewReader(exported), format); err != nil || n != 5 {
+				t.Fatalf("导入期望 5 条, 实际 %d, err=%v", n, err)
+			}
+			clock.Advance(-time.Hour)
+		})
+	}
+}
+
+func TestDB_ImportErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format ExportFormat
+		input  string
+		// n 出错之前已写入的键值对数
+		n int
+	}{
+		{"非法 JSON", FormatJSONLines, "{\"key\":\"a\",\"value\":\"1\"}\n{bad\n", 0},
+		{"未知编码", FormatJSONLines, `{"key":"a","value":"1","encoding":"hex"}`, 0},
+		{"非法 base64", FormatJSONLines, `{"key":"!","value":"","encoding":"base64"}`, 0},
+		{"非法过期时间", FormatJSONLines, `{"key":"a","value":"1","expire_at":"tomorrow"}`, 0},
+		{"CSV 表头不正确", FormatCSV, "key,value\na,1\n", 0},
+		{"CSV 列数不正确", FormatCSV, "cf,key,value,expire_at,encoding\n,a,1,,\n,b\n", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, t.TempDir())
+			defer db.Close()
+			n, err := db.Import(strings.NewReader(tt.input), tt.format)
+			if !errors.Is(err, ErrInvalidImport) || n != tt.n {
+				t.Fatalf("期望 ErrInvalidImport 且写入 %d 条, 实际 %d, err=%v", tt.n, n, err)
+			}
+		})
+	}
+
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+	if _, err := db.Import(strings.NewReader(`{"cf":"`+strings.Repeat("x", 300)+`","key":"a","value":"1"}`), FormatJSONLines); !errors.Is(err, ErrInvalidColumnFamily) {
+		t.Fatalf("期望 ErrInvalidColumnFamily, 实际 %v", err)
+	}
+	if _, err := ParseExportFormat("xml"); err == nil {
+		t.Fatal("未知格式期望报错")
+	}
+}
@@ -0,0 +1,333 @@
+package lsm
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+)
+
+// commitRequest 是排队等待提交的一次写入，其中的条目作为一个整体原子地提交
+type commitRequest struct {
+	entries []*sdbf.Entry
+	// checkKeys 非空时，提交前检查这些 key 在 readSeq 之后是否被其他写入修改过，
+	// 用于乐观事务的冲突检测
+	checkKeys []string
+	readSeq   int64
+	// expect 非空时，提交前检查 key 的可见版本，用于 CAS
+	expect *versionCheck
+	// replicated 为 true 时条目已带有序列号（从 leader 复制而来），按原样写入，
+	// 序列号必须严格递增且大于已分配的序列号
+	replicated bool
+	// noSync 与 disableWAL 见 WriteOptions.NoSync 与 WriteOptions.DisableWAL
+	noSync, disableWAL bool
+	err                error
+	// leader 为 true 表示该请求被上一任 leader 提升为新的 leader
+	leader bool
+	done   chan struct{}
+	// walTime 与 applyTime 所在组写入 WAL 与应用到跳表的耗时，只在启用慢操作日志时记录
+	walTime, applyTime time.Duration
+}
+
+// groupCommitter 实现组提交：并发的写入者排队，由其中一个 leader 把队列里的
+// 所有记录一次性写入 WAL，用一次 fsync 覆盖整组，再按顺序应用到跳表。
+//
+// 并发安全：
+//   - mu 保护 pending 与 leading，只在入队、出队时短暂持有
+//   - 同一时刻只有一个 leader 在执行 WAL 写入与应用，因此 WAL 中的顺序与
+//     跳表的应用顺序一致，恢复时回放得到的状态与崩溃前相同
+//   - leader 完成一组后把 leader 身份交给队首的等待者，避免某个写入者在持续
+//     负载下一直充当 leader 而无法返回
+type groupCommitter struct {
+	maxDelay time.Duration
+	maxBatch int
+	// full 在队列长度达到 maxBatch 时收到通知，让等待中的 leader 提前提交
+	full chan struct{}
+}
+
+func newGroupCommitter(maxDelay time.Duration, maxBatch int) groupCommitter {
+	return groupCommitter{
+		maxDelay: maxDelay,
+		maxBatch: maxBatch,
+		full:     make(chan struct{}, 1),
+	}
+}
+
+// commit 原子地提交一组条目，返回时条目已写入 WAL 并对读可见
+func (mt *MemTable) commit(entries []*sdbf.Entry) error {
+	return mt.commitRequest(&commitRequest{entries: entries})
+}
+
+func (mt *MemTable) commitRequest(req *commitRequest) error {
+	req.done = make(chan struct{})
+	// 在写入者自己的 goroutine 中计算，不占用组提交 leader 的时间
+	setRecordTypes(req.entries)
+	if mt.entryChecksums {
+		setChecksums(req.entries)
+	}
+
+	mt.commitMu.Lock()
+	mt.pending = append(mt.pending, req)
+	if len(mt.pending) >= mt.gc.maxBatch {
+		select {
+		case mt.gc.full <- struct{}{}:
+		default:
+		}
+	}
+	if mt.leading {
+		mt.commitMu.Unlock()
+		<-req.done
+		if !req.leader {
+			return req.err
+		}
+	} else {
+		mt.leading = true
+		mt.commitMu.Unlock()
+	}
+
+	// 作为 leader 提交队首的一组请求，其中一定包含 req 自己
+	mt.waitForGroup()
+
+	mt.commitMu.Lock()
+	n := min(len(mt.pending), mt.gc.maxBatch)
+	group := mt.pending[:n:n]
+	mt.pending = mt.pending[n:]
+	mt.commitMu.Unlock()
+
+	mt.applyGroup(group)
+	for _, r := range group {
+		if r != req {
+			close(r.done)
+		}
+	}
+
+	mt.commitMu.Lock()
+	if len(mt.pending) > 0 {
+		next := mt.pending[0]
+		next.leader = true
+		close(next.done)
+	} else {
+		mt.leading = false
+	}
+	mt.commitMu.Unlock()
+
+	return req.err
+}
+
+// waitForGroup 在配置了 maxDelay 时等待更多写入者加入本组，
+// 直到队列攒满 maxBatch 或等待超过 maxDelay
+func (mt *MemTable) waitForGroup() {
+	if mt.gc.maxDelay <= 0 {
+		return
+	}
+
+	// 丢弃上一组遗留的通知，之后再检查队列长度，不会错过新的通知
+	select {
+	case <-mt.gc.full:
+	default:
+	}
+
+	mt.commitMu.Lock()
+	full := len(mt.pending) >= mt.gc.maxBatch
+	mt.commitMu.Unlock()
+	if full {
+		return
+	}
+
+	timer := time.NewTimer(mt.gc.maxDelay)
+	defer timer.Stop()
+	select {
+	case <-mt.gc.full:
+	case <-timer.C:
+	}
+}
+
+// applyGroup 校验一组请求，为通过校验的条目分配序列号，一次性写入 WAL，
+// 然后按顺序应用到跳表。每个请求的结果写入其 err 字段
+func (mt *MemTable) applyGroup(group []*commitRequest) {
+	batches := make([][]*sdbf.Entry, 0, len(group))
+	accepted := group[:0:0]
+
+	// written 记录本组中排在前面、即将写入的 key 与范围删除：它们还没有应用到跳表，
+	// 冲突检测看不到，需要单独检查
+	var written *pendingWrites
+	// seq 排在前面的请求通过校验之后将要分配到的最大序列号
+	seq := mt.lastSeq
+	for _, r := range group {
+		if r.replicated {
+			if err := checkReplicated(r.entries, seq); err != nil {
+				r.err = err
+				continue
+			}
+		}
+		if r.checkKeys != nil || r.expect != nil {
+			if written == nil {
+				written = &pendingWrites{keys: make(map[string]struct{})}
+				for _, prev := range accepted {
+					written.add(prev.entries)
+				}
+			}
+			var err error
+			if r.checkKeys != nil {
+				err = mt.checkConflict(r, written)
+			} else {
+				err = mt.checkVersion(r.expect, written)
+			}
+			if err != nil {
+				r.err = err
+				continue
+			}
+		}
+		if written != nil {
+			written.add(r.entries)
+		}
+		if r.replicated {
+			seq = r.entries[len(r.entries)-1].Version
+		} else {
+			seq += int64(len(r.entries))
+		}
+		accepted = append(accepted, r)
+		batches = append(batches, r.entries)
+	}
+	if len(accepted) == 0 {
+		return
+	}
+
+	// 按提交顺序分配序列号，写入 WAL 后恢复时可以还原出相同的版本
+	prevSeq := mt.lastSeq
+	for _, r := range accepted {
+		if r.replicated {
+			mt.lastSeq = r.entries[len(r.entries)-1].Version
+			continue
+		}
+		for _, entry := range r.entries {
+			mt.lastSeq++
+			entry.Version = mt.lastSeq
+		}
+	}
+
+	var start time.Time
+	if mt.timeStages.Load() {
+		start = time.Now()
+	}
+	if mt.wal != nil {
+		if err := mt.writeWAL(accepted, batches); err != nil {
+			mt.lastSeq = prevSeq
+			err = fmt.Errorf("write wal: %w", err)
+			for _, r := range accepted {
+				r.err = err
+			}
+			return
+		}
+		if mt.trackUnlogged {
+			mt.recordUnlogged(accepted)
+		}
+	}
+
+	var walTime time.Duration
+	if mt.timeStages.Load() {
+		walTime = time.Since(start)
+		start = time.Now()
+	}
+
+	mt.mu.Lock()
+	for _, batch := range batches {
+		for _, entry := range batch {
+			mt.apply(entry)
+		}
+	}
+	mt.visibleSeq = mt.lastSeq
+	mt.maybeCollectLocked()
+	mt.mu.Unlock()
+
+	if mt.timeStages.Load() {
+		applyTime := time.Since(start)
+		for _, r := range accepted {
+			r.walTime, r.applyTime = walTime, applyTime
+		}
+	}
+}
+
+// writeWAL 把 accepted 中的请求（batches 为各自的条目）一次性写入 WAL，跳过 disableWAL 的请求；
+// 只有全部请求都设置了 noSync 时才不 fsync
+func (mt *MemTable) writeWAL(accepted []*commitRequest, batches [][]*sdbf.Entry) error {
+	noSync, skipped := true, false
+	for _, r := range accepted {
+		if r.disableWAL {
+			skipped = true
+		} else {
+			noSync = noSync && r.noSync
+		}
+	}
+	// 常见情况下没有跳过 WAL 的请求，直接使用 batches
+	if skipped {
+		batches = make([][]*sdbf.Entry, 0, len(accepted))
+		for _, r := range accepted {
+			if !r.disableWAL {
+				batches = append(batches, r.entries)
+			}
+		}
+		if len(batches) == 0 {
+			return nil
+		}
+	}
+	_, err := mt.wal.writeBatch(noSync, batches...)
+	return err
+}
+
+// checkReplicated 检查复制来的条目的序列号是否严格递增且大于 after
+func checkReplicated(entries []*sdbf.Entry, after int64) error {
+	for _, e := range entries {
+		if e.Version <= after {
+			return fmt.Errorf("%w: seq %d after %d", ErrSequenceOutOfOrder, e.Version, after)
+		}
+		after = e.Version
+	}
+	return nil
+}
+
+// pendingWrites 本组中已通过校验、尚未应用的写入
+type pendingWrites struct {
+	keys   map[string]struct{}
+	ranges []*sdbf.Entry
+}
+
+func (w *pendingWrites) add(entries []*sdbf.Entry) {
+	for _, e := range entries {
+		if e.RangeEnd != "" {
+			w.ranges = append(w.ranges, e)
+			continue
+		}
+		w.keys[e.Key] = struct{}{}
+	}
+}
+
+// contains 判断 key 是否会被这些写入修改
+func (w *pendingWrites) contains(key string) bool {
+	if _, ok := w.keys[key]; ok {
+		return true
+	}
+	for _, t := range w.ranges {
+		if utils.CompareKey(t.Key, key) <= 0 && utils.CompareKey(key, t.RangeEnd) < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConflict 检查 r.checkKeys 在 r.readSeq 之后是否被修改过（包括被范围删除），
+// written 为本组中排在 r 之前、尚未应用的写入
+//
+// 只由 leader 调用，而跳表也只由 leader 修改，因此读到的最新版本在检查期间不会变化
+func (mt *MemTable) checkConflict(r *commitRequest, written *pendingWrites) error {
+	for _, key := range r.checkKeys {
+		if written.contains(key) {
+			return fmt.Errorf("%w: key %s", ErrConflict, key)
+		}
+		if e, ok := mt.Get(key); ok && e.Version > r.readSeq {
+			return fmt.Errorf("%w: key %s", ErrConflict, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package lsm
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+	"github.com/aireet/SimpleDBForge/pkg/skiplist"
+)
+
+// Iterator 按 key 升序（utils.CompareKey 定义的顺序）遍历条目
+//
+// 典型用法：
+//
+//	for it.Seek(start); it.Valid(); it.Next() {
+//		use(it.Key(), it.Value())
+//	}
+type Iterator interface {
+	// Seek 定位到第一个 key >= target 的条目
+	Seek(target string)
+	// Next 移动到下一个条目，调用前 Valid 必须为 true
+	Next()
+	// Valid 当前是否指向一个有效条目
+	Valid() bool
+	// Key 当前条目的 key
+	Key() string
+	// Value 当前条目的 value
+	Value() []byte
+	// Entry 当前条目本身，包含墓碑与版本信息
+	Entry() *sdbf.Entry
+}
+
+// sliceIterator 遍历一个已按 key 排好序的条目切片
+type sliceIterator struct {
+	entries []*sdbf.Entry
+	pos     int
+}
+
+func newSliceIterator(entries []*sdbf.Entry) *sliceIterator {
+	return &sliceIterator{entries: entries, pos: len(entries)}
+}
+
+func (it *sliceIterator) Seek(target string) {
+	it.pos = sort.Search(len(it.entries), func(i int) bool {
+		return utils.CompareKey(it.entries[i].Key, target) >= 0
+	})
+}
+
+func (it *sliceIterator) Next()              { it.pos++ }
+func (it *sliceIterator) Valid() bool        { return it.pos < len(it.entries) }
+func (it *sliceIterator) Key() string        { return it.entries[it.pos].Key }
+func (it *sliceIterator) Value() []byte      { return it.entries[it.pos].Value }
+func (it *sliceIterator) Entry() *sdbf.Entry { return it.entries[it.pos] }
+
+// listIterator 把跳表迭代器适配为 Iterator，遍历时不复制条目
+type listIterator struct {
+	*skiplist.Iterator
+}
+
+func (it listIterator) Seek(target string) { it.SeekGE(target) }
+
+// mergeIterator 把多个有序的数据源合并成一个有序视图
+//
+// 数据源按从新到旧排列（可变 MemTable、不可变 MemTable、各层 SSTable），
+// 同一个 key 出现在多个数据源时只保留 Version 最大的条目，Version 相同时取更新的数据源。
+// 墓碑会照常返回，由上层决定是否跳过（例如 DB 的读路径跳过，合并落盘时保留）。
+type mergeIterator struct {
+	iters []Iterator
+	h     mergeHeap
+	curr  *mergeItem
+}
+
+type mergeItem struct {
+	it       Iterator
+	priority int // 数据源下标，越小越新
+}
+
+func newMergeIterator(iters []Iterator) *mergeIterator {
+	return &mergeIterator{iters: iters}
+}
+
+func (m *mergeIterator) Seek(target string) {
+	m.h = m.h[:0]
+	for i, it := range m.iters {
+		it.Seek(target)
+		if it.Valid() {
+			m.h = append(m.h, &mergeItem{it: it, priority: i})
+		}
+	}
+	heap.Init(&m.h)
+	m.pick()
+}
+
+// pick 从堆顶取出当前最小的 key，并跳过其他数据源中同 key 的旧条目
+func (m *mergeIterator) pick() {
+	m.curr = nil
+	if len(m.h) == 0 {
+		return
+	}
+	m.curr = heap.Pop(&m.h).(*mergeItem)
+	key := m.curr.it.Key()
+
+	for len(m.h) > 0 && utils.CompareKey(m.h[0].it.Key(), key) == 0 {
+		dup := heap.Pop(&m.h).(*mergeItem)
+		// 堆按 Version 降序、priority 升序打破平局，所以先弹出的一定是要保留的条目
+		dup.it.Next()
+		if dup.it.Valid() {
+			heap.Push(&m.h, dup)
+		}
+	}
+}
+
+func (m *mergeIterator) Next() {
+	// 同一个数据源中也可能有同 key 的多个版本（从新到旧排列），一并跳过
+	key := m.curr.it.Key()
+	for m.curr != nil && utils.CompareKey(m.curr.it.Key(), key) == 0 {
+		m.curr.it.Next()
+		if m.curr.it.Valid() {
+			heap.Push(&m.h, m.curr)
+		}
+		m.pick()
+	}
+}
+
+func (m *mergeIterator) Valid() bool        { return m.curr != nil }
+func (m *mergeIterator) Key() string        { return m.curr.it.Key() }
+func (m *mergeIterator) Value() []byte      { return m.curr.it.Value() }
+func (m *mergeIterator) Entry() *sdbf.Entry { return m.curr.it.Entry() }
+
+// mergeHeap 按 key 升序排列；key 相同时 Version 大的在前，再相同时更新的数据源在前
+type mergeHeap []*mergeItem
+
+func (h mergeHeap) Len() int { return len(h) }
+
+func (h mergeHeap) Less(i, j int) bool {
+	if cmp := utils.CompareKey(h[i].it.Key(), h[j].it.Key()); cmp != 0 {
+		return cmp < 0
+	}
+	vi, vj := h[i].it.Entry().Version, h[j].it.Entry().Version
+	if vi != vj {
+		return vi > vj
+	}
+	return h[i].priority < h[j].priority
+}
+
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *mergeHeap) Push(x any) { *h = append(*h, x.(*mergeItem)) }
+
+func (h *mergeHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// chainIterator 依次遍历多个迭代器，用于把各个列族的数据拼接成一个序列
+//
+// key 只在每个迭代器内部有序，整体并不有序；Seek 让每个迭代器都定位到 target，
+// 然后从第一个有效的迭代器开始遍历
+type chainIterator struct {
+	iters []Iterator
+	pos   int
+}
+
+func newChainIterator(iters []Iterator) *chainIterator {
+	return &chainIterator{iters: iters, pos: len(iters)}
+}
+
+func (c *chainIterator) Seek(target string) {
+	for _, it := range c.iters {
+		it.Seek(target)
+	}
+	c.pos = 0
+	c.skipExhausted()
+}
+
+func (c *chainIterator) Next() {
+	c.iters[c.pos].Next()
+	c.skipExhausted()
+}
+
+func (c *chainIterator) skipExhausted() {
+	for c.pos < len(c.iters) && !c.iters[c.pos].Valid() {
+		c.pos++
+	}
+}
+
+func (c *chainIterator) Valid() bool        { return c.pos < len(c.iters) }
+func (c *chainIterator) Key() string        { return c.iters[c.pos].Key() }
+func (c *chainIterator) Value() []byte      { return c.iters[c.pos].Value() }
+func (c *chainIterator) Entry() *sdbf.Entry { return c.iters[c.pos].Entry() }
+
+// liveIterator 跳过墓碑与已过期的条目，只暴露对读可见的条目
+type liveIterator struct {
+	Iterator
+	// now 判断过期的时间点（Unix 纳秒），在创建时固定，保证一次遍历内的结果一致
+	now int64
+}
+
+func newLiveIterator(it Iterator, now time.Time) *liveIterator {
+	return &liveIterator{Iterator: it, now: now.UnixNano()}
+}
+
+func (it *liveIterator) Seek(target string) {
+	it.Iterator.Seek(target)
+	it.skipHidden()
+}
+
+func (it *liveIterator) Next() {
+	it.Iterator.Next()
+	it.skipHidden()
+}
+
+func (it *liveIterator) skipHidden() {
+	for it.Iterator.Valid() && !isLive(it.Iterator.Entry(), it.now) {
+		it.Iterator.Next()
+	}
+}
+
+// isLive 条目在 now（Unix 纳秒）时刻是否可见：不是墓碑且没有过期
+//
+// 过期的条目和墓碑一样会遮蔽同 key 的旧版本，因此它们都必须作为最新版本参与合并，
+// 只在最后一步跳过
+func isLive(e *sdbf.Entry, now int64) bool {
+	return !e.Tombstone && (e.ExpireAt == 0 || e.ExpireAt > now)
+}
@@ -0,0 +1,149 @@
+package lsm
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+func collect(it Iterator, seek string) []string {
+	var out []string
+	for it.Seek(seek); it.Valid(); it.Next() {
+		e := it.Entry()
+		s := fmt.Sprintf("%s=%s", e.Key, e.Value)
+		if e.Tombstone {
+			s = e.Key + "=<del>"
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestMergeIterator(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources [][]*sdbf.Entry
+		seek    string
+		live    bool
+		want    []string
+	}{
+		{
+			name: "不重叠的数据源",
+			sources: [][]*sdbf.Entry{
+				{{Key: "a", Value: []byte("1")}, {Key: "c", Value: []byte("3")}},
+				{{Key: "b", Value: []byte("2")}, {Key: "d", Value: []byte("4")}},
+			},
+			want: []string{"a=1", "b=2", "c=3", "d=4"},
+		},
+		{
+			name: "版本相同时较新的数据源优先",
+			sources: [][]*sdbf.Entry{
+				{{Key: "a", Value: []byte("new")}},
+				{{Key: "a", Value: []byte("old")}, {Key: "b", Value: []byte("2")}},
+			},
+			want: []string{"a=new", "b=2"},
+		},
+		{
+			name: "版本大的优先",
+			sources: [][]*sdbf.Entry{
+				{{Key: "a", Value: []byte("v1"), Version: 1}},
+				{{Key: "a", Value: []byte("v5"), Version: 5}},
+				{{Key: "a", Value: []byte("v3"), Version: 3}},
+			},
+			want: []string{"a=v5"},
+		},
+		{
+			name: "墓碑遮蔽旧数据",
+			sources: [][]*sdbf.Entry{
+				{{Key: "a", Tombstone: true, Version: 2}},
+				{{Key: "a", Value: []byte("1"), Version: 1}, {Key: "b", Value: []byte("2"), Version: 1}},
+			},
+			want: []string{"a=<del>", "b=2"},
+		},
+		{
+			name: "跳过墓碑",
+			sources: [][]*sdbf.Entry{
+				{{Key: "a", Tombstone: true, Version: 2}},
+				{{Key: "a", Value: []byte("1"), Version: 1}, {Key: "b", Value: []byte("2"), Version: 1}},
+			},
+			live: true,
+			want: []string{"b=2"},
+		},
+		{
+			name: "Seek 定位",
+			sources: [][]*sdbf.Entry{
+				{{Key: "a", Value: []byte("1")}, {Key: "c", Value: []byte("3")}},
+				{{Key: "b", Value: []byte("2")}, {Key: "d", Value: []byte("4")}},
+			},
+			seek: "bb",
+			want: []string{"c=3", "d=4"},
+		},
+		{
+			name:    "空数据源",
+			sources: [][]*sdbf.Entry{{}, {}},
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var iters []Iterator
+			for _, src := range tt.sources {
+				iters = append(iters, newSliceIterator(src))
+			}
+			var it Iterator = newMergeIterator(iters)
+			if tt.live {
+				it = &liveIterator{Iterator: it}
+			}
+
+			got := collect(it, tt.seek)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("期望 %v, 实际 %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// 测试 DB 迭代器基于创建时登记的临时快照：之后的写入与覆盖写都不可见，Close 释放快照
+func TestDB_IteratorSnapshot(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+
+	for _, k := range []string{"a", "b", "c"} {
+		if err := db.Set(k, []byte(k)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := db.Delete("b"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+
+	it, err := db.NewIterator()
+	if err != nil {
+		t.Fatalf("创建迭代器失败: %v", err)
+	}
+
+	// 创建迭代器之后的写入不可见；覆盖写保留旧版本，不会改变迭代器看到的条目
+	if err := db.Set("d", []byte("d")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Set("a", []byte("a2")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	want := []string{"a=a", "c=c"}
+	if got := collect(it, ""); !slices.Equal(got, want) {
+		t.Fatalf("期望 %v, 实际 %v", want, got)
+	}
+
+	if n := db.snapshots.len(); n != 1 {
+		t.Fatalf("迭代器应持有 1 个快照, 实际 %d", n)
+	}
+	it.Close()
+	it.Close()
+	if n := db.snapshots.len(); n != 0 {
+		t.Fatalf("Close 后快照应被释放, 实际 %d", n)
+	}
+}
@@ -0,0 +1,193 @@
+package lsm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+// KeyProvider 为静态数据加密提供密钥，通过 Options.EncryptionKeys 配置
+//
+// 每个密钥由一个 ID 标识，加密的记录中保存了所用密钥的 ID，读取时按 ID 查找密钥。
+// 同一个 ID 必须始终对应同一个密钥；密钥长度为 16、24 或 32 字节，分别对应 AES-128/192/256
+//
+// 引擎内置了 StaticKey、KeyRing（可由 ReadKeyFile 或 KeyRingFromEnv 得到）与 FileKeyProvider。
+// 对接 Vault、云厂商 KMS 等外部系统时实现这个接口即可，不需要修改引擎：
+// 例如用 KMS 解密随配置下发的数据密钥后缓存在内存中。引擎按 ID 缓存由密钥构造的 AEAD，
+// GetKey 只在第一次遇到某个 ID 时调用；CurrentKey 在每次写入时调用，实现应当只返回内存中的值，
+// 不能在其中发起网络请求。两个方法都可能被并发调用
+type KeyProvider interface {
+	// CurrentKey 返回加密新数据使用的密钥及其 ID
+	CurrentKey() (id uint32, key []byte, err error)
+	// GetKey 返回 ID 对应的密钥，用于解密已有的数据
+	GetKey(id uint32) ([]byte, error)
+}
+
+// StaticKey 是只有一个密钥的 KeyProvider
+type StaticKey struct {
+	ID     uint32
+	Secret []byte
+}
+
+func (k StaticKey) CurrentKey() (uint32, []byte, error) { return k.ID, k.Secret, nil }
+
+func (k StaticKey) GetKey(id uint32) ([]byte, error) {
+	if id != k.ID {
+		return nil, fmt.Errorf("unknown key id %d", id)
+	}
+	return k.Secret, nil
+}
+
+// KeyRing 是包含多个密钥版本的 KeyProvider：新数据使用 Current 对应的密钥，
+// 已有的数据按记录中保存的 ID 选择密钥。轮换密钥时加入新密钥并修改 Current，
+// 旧密钥在 DB.ReencryptWAL 报告不再使用之后才能移除
+type KeyRing struct {
+	Current uint32
+	Keys    map[uint32][]byte
+}
+
+func (r KeyRing) CurrentKey() (uint32, []byte, error) {
+	key, err := r.GetKey(r.Current)
+	return r.Current, key, err
+}
+
+func (r KeyRing) GetKey(id uint32) ([]byte, error) {
+	key, ok := r.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %d", id)
+	}
+	return key, nil
+}
+
+// ReadKeyFile 从 fsys 中读取密钥文件，每行一个密钥 "<ID> <十六进制密钥>"，
+// 例如 "1 000102...1f"（AES-256）。最后一行的密钥是当前密钥，轮换时在文件末尾追加新密钥即可；
+// ID 不能重复，# 开头的行与空行被忽略
+func ReadKeyFile(fsys vfs.FS, path string) (KeyRing, error) {
+	fd, err := fsys.Open(path)
+	if err != nil {
+		return KeyRing{}, fmt.Errorf("read key file: %w", err)
+	}
+	defer fd.Close()
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(fd); err != nil {
+		return KeyRing{}, fmt.Errorf("read key file %s: %w", path, err)
+	}
+
+	ring, err := parseKeyRing(strings.Split(buf.String(), "\n"))
+	if err != nil {
+		return KeyRing{}, fmt.Errorf("key file %s %w", path, err)
+	}
+	return ring, nil
+}
+
+// KeyRingFromEnv 从环境变量 name 读取密钥，格式同 ReadKeyFile，多个密钥之间也可以用逗号分隔，
+// 例如 SDBF_ENCRYPTION_KEYS="1 <十六进制密钥>,2 <十六进制密钥>"，最后一个是当前密钥。
+// 适合由容器编排系统或 KMS 的 sidecar 注入密钥，避免密钥落盘
+func KeyRingFromEnv(name string) (KeyRing, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return KeyRing{}, fmt.Errorf("key env %s: not set", name)
+	}
+	ring, err := parseKeyRing(strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }))
+	if err != nil {
+		return KeyRing{}, fmt.Errorf("key env %s %w", name, err)
+	}
+	return ring, nil
+}
+
+// parseKeyRing 解析每行一个的 "<ID> <十六进制密钥>"，最后一个密钥是当前密钥；
+// 错误以 "line N: " 开头，由调用方加上来源
+func parseKeyRing(lines []string) (KeyRing, error) {
+	ring := KeyRing{Keys: make(map[uint32][]byte)}
+	for n, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := parseKeyLine(line)
+		if err != nil {
+			return KeyRing{}, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		if _, ok := ring.Keys[key.ID]; ok {
+			return KeyRing{}, fmt.Errorf("line %d: duplicate key id %d", n+1, key.ID)
+		}
+		ring.Keys[key.ID] = key.Secret
+		ring.Current = key.ID
+	}
+	if len(ring.Keys) == 0 {
+		return KeyRing{}, errors.New("has no key")
+	}
+	return ring, nil
+}
+
+// parseKeyLine 解析 "<ID> <十六进制密钥>"
+func parseKeyLine(line string) (StaticKey, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 {
+		return StaticKey{}, errors.New(`want "<id> <hex key>"`)
+	}
+	id, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return StaticKey{}, fmt.Errorf("invalid key id: %w", err)
+	}
+	key, err := hex.DecodeString(fields[1])
+	if err != nil {
+		return StaticKey{}, fmt.Errorf("invalid key: %w", err)
+	}
+	if _, err := aes.NewCipher(key); err != nil {
+		return StaticKey{}, err
+	}
+	return StaticKey{ID: uint32(id), Secret: key}, nil
+}
+
+// FileKeyProvider 从密钥文件（格式见 ReadKeyFile）读取密钥，运行期间可以通过 Reload 重新加载，
+// 例如在 Vault Agent 等工具重新渲染密钥文件之后：追加的新密钥成为当前密钥，不必重启数据库
+type FileKeyProvider struct {
+	fsys vfs.FS
+	path string
+	// mu 串行化 Reload；读取只访问 ring，不加锁
+	mu   sync.Mutex
+	ring atomic.Pointer[KeyRing]
+}
+
+// NewFileKeyProvider 读取 path 并返回 FileKeyProvider，文件无效时返回错误
+func NewFileKeyProvider(fsys vfs.FS, path string) (*FileKeyProvider, error) {
+	ring, err := ReadKeyFile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	p := &FileKeyProvider{fsys: fsys, path: path}
+	p.ring.Store(&ring)
+	return p, nil
+}
+
+// Reload 重新读取密钥文件。文件无效，或者修改了已有 ID 对应的密钥时返回错误并继续使用原来的密钥；
+// 文件中去掉的密钥随之不可用，移除之前需要先用 DB.ReencryptWAL 确认它不再被使用
+func (p *FileKeyProvider) Reload() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ring, err := ReadKeyFile(p.fsys, p.path)
+	if err != nil {
+		return err
+	}
+	for id, old := range p.ring.Load().Keys {
+		if key, ok := ring.Keys[id]; ok && !bytes.Equal(key, old) {
+			return fmt.Errorf("key file %s: key %d changed, a key id must always refer to the same key", p.path, id)
+		}
+	}
+	p.ring.Store(&ring)
+	return nil
+}
+
+func (p *FileKeyProvider) CurrentKey() (uint32, []byte, error) { return p.ring.Load().CurrentKey() }
+
+func (p *FileKeyProvider) GetKey(id uint32) ([]byte, error) { return p.ring.Load().GetKey(id) }
@@ -0,0 +1,140 @@
+package lsm
+
+import (
+	"bytes"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+func TestReadKeyFile(t *testing.T) {
+	hexKey := strings.Repeat("5a", 32)
+	tests := []struct {
+		name    string
+		content string
+		want    KeyRing
+		wantErr bool
+	}{
+		{name: "有效", content: "# 注释\n\n3 " + hexKey + "\n", want: KeyRing{Current: 3, Keys: map[uint32][]byte{3: testKey.Secret}}},
+		{name: "AES-128", content: "1 " + strings.Repeat("ab", 16), want: KeyRing{Current: 1, Keys: map[uint32][]byte{1: bytes.Repeat([]byte{0xab}, 16)}}},
+		{
+			name:    "多个密钥时最后一个是当前密钥",
+			content: "2 " + hexKey + "\n1 " + strings.Repeat("ab", 16),
+			want:    KeyRing{Current: 1, Keys: map[uint32][]byte{2: testKey.Secret, 1: bytes.Repeat([]byte{0xab}, 16)}},
+		},
+		{name: "空文件", content: "# 没有密钥\n", wantErr: true},
+		{name: "缺少 ID", content: hexKey, wantErr: true},
+		{name: "非十六进制", content: "1 zz", wantErr: true},
+		{name: "长度无效", content: "1 abcd", wantErr: true},
+		{name: "ID 重复", content: "1 " + hexKey + "\n1 " + hexKey, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "key")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadKeyFile(vfs.OSFS{}, path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("期望错误 %v, 实际 %v", tt.wantErr, err)
+			}
+			if got.Current != tt.want.Current || !maps.EqualFunc(got.Keys, tt.want.Keys, bytes.Equal) {
+				t.Fatalf("期望 %+v, 实际 %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestKeyRingFromEnv(t *testing.T) {
+	hexKey := strings.Repeat("5a", 32)
+	tests := []struct {
+		name    string
+		value   string
+		unset   bool
+		want    KeyRing
+		wantErr bool
+	}{
+		{
+			name:  "逗号分隔",
+			value: "3 " + hexKey + ", 1 " + strings.Repeat("ab", 16),
+			want:  KeyRing{Current: 1, Keys: map[uint32][]byte{3: testKey.Secret, 1: bytes.Repeat([]byte{0xab}, 16)}},
+		},
+		{name: "换行分隔", value: "3 " + hexKey + "\n", want: KeyRing{Current: 3, Keys: map[uint32][]byte{3: testKey.Secret}}},
+		{name: "未设置", unset: true, wantErr: true},
+		{name: "为空", value: "", wantErr: true},
+		{name: "格式错误", value: "3:" + hexKey, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const name = "SDBF_TEST_ENCRYPTION_KEYS"
+			t.Setenv(name, tt.value)
+			if tt.unset {
+				os.Unsetenv(name)
+			}
+			got, err := KeyRingFromEnv(name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("期望错误 %v, 实际 %v", tt.wantErr, err)
+			}
+			if got.Current != tt.want.Current || !maps.EqualFunc(got.Keys, tt.want.Keys, bytes.Equal) {
+				t.Fatalf("期望 %+v, 实际 %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+// 测试 FileKeyProvider 重新加载：追加的密钥成为当前密钥，修改已有密钥或文件无效时保留原来的密钥
+func TestFileKeyProvider(t *testing.T) {
+	key1, key2 := strings.Repeat("11", 32), strings.Repeat("22", 32)
+	path := filepath.Join(t.TempDir(), "keys")
+	writeKeys := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wantCurrent := func(p *FileKeyProvider, want uint32) {
+		t.Helper()
+		if id, _, err := p.CurrentKey(); err != nil || id != want {
+			t.Fatalf("当前密钥期望 %d, 实际 %d %v", want, id, err)
+		}
+	}
+
+	writeKeys("1 " + key1)
+	p, err := NewFileKeyProvider(vfs.OSFS{}, path)
+	if err != nil {
+		t.Fatalf("读取密钥文件失败: %v", err)
+	}
+	wantCurrent(p, 1)
+
+	// 追加新密钥
+	writeKeys("1 " + key1 + "\n2 " + key2)
+	if err := p.Reload(); err != nil {
+		t.Fatalf("重新加载失败: %v", err)
+	}
+	wantCurrent(p, 2)
+	if got, err := p.GetKey(1); err != nil || !bytes.Equal(got, bytes.Repeat([]byte{0x11}, 32)) {
+		t.Fatalf("旧密钥应当仍然可用: %v", err)
+	}
+
+	// 修改已有的密钥与无效的文件都被拒绝
+	for _, content := range []string{"1 " + key2 + "\n2 " + key2, "# 空"} {
+		writeKeys(content)
+		if err := p.Reload(); err == nil {
+			t.Fatalf("期望重新加载 %q 失败", content)
+		}
+		wantCurrent(p, 2)
+	}
+
+	// 移除旧密钥
+	writeKeys("2 " + key2)
+	if err := p.Reload(); err != nil {
+		t.Fatalf("重新加载失败: %v", err)
+	}
+	if _, err := p.GetKey(1); err == nil {
+		t.Fatal("移除的密钥不应再可用")
+	}
+}
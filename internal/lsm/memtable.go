@@ -1,65 +1,353 @@
 package lsm
 
 import (
+	"fmt"
 	"log/slog"
+	"maps"
+	"math"
+	"slices"
 	"sync"
+	"sync/atomic"
 
 	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/utils"
 	"github.com/aireet/SimpleDBForge/pkg/skiplist"
 )
 
 type MemTable struct {
 	sync.Once
-	mu       sync.RWMutex
+	// mu 串行化对跳表的修改与快照登记；跳表本身支持并发读写，读操作不需要持有 mu
+	mu sync.Mutex
+	// def 默认列族，skipList 即 def.list
+	def      *memFamily
 	skipList *skiplist.SkipList
-	wal      *WAL
-	walDir   string
+	// families 非默认列族，按列族名称索引，由 mu 保护；
+	// 创建后不会被替换，列族句柄直接持有 memFamily，读取时无需查找
+	families map[string]*memFamily
+	maxLevel int
+	p        float64
+	// wal 为 nil 时不写 WAL（纯内存模式）
+	wal *WALManager
+	// timeStages 组提交是否记录各阶段耗时，供慢操作日志使用
+	timeStages atomic.Bool
+	// entryChecksums 提交前为条目计算校验和，见 Options.EntryChecksums
+	entryChecksums bool
+
+	// snapshots 未释放的快照，覆盖写之前需要确认旧版本对它们不可见
+	snapshots *snapshotList
+	// lastSeq 最后分配的序列号，只由组提交的 leader（或恢复过程）修改
+	lastSeq int64
+	// visibleSeq 已应用到跳表、对读可见的最大序列号，由 mu 保护
+	visibleSeq int64
+	// 旧版本回收，见 collectLocked：versionGCBytes 为触发阈值，versionGCBase 为上次回收后的大小，由 mu 保护
+	versionGCBytes int64
+	versionGCBase  int64
+	// budget 内存预算，accounted 为已经申报到预算上的占用，overBudget 记录上次检查时是否超出，由 mu 保护
+	budget     *utils.MemoryBudget
+	accounted  int64
+	overBudget bool
+	// unlogged 没有写入 WAL（WriteOptions.DisableWAL）的点写入，按列族与 key 只保留最新的一个，
+	// 同 key 之后写入 WAL 的写入会把它移除；unloggedRanges 为没有写入 WAL 的范围墓碑。
+	// 只在 trackUnlogged（Options.TrackUnloggedWrites）为 true 时记录。
+	// 只由组提交的 leader 修改，见 flushUnlogged
+	trackUnlogged  bool
+	unlogged       map[unloggedKey]*sdbf.Entry
+	unloggedRanges []*sdbf.Entry
+
+	// 组提交队列，见 group_commit.go
+	commitMu sync.Mutex
+	pending  []*commitRequest
+	leading  bool
+	gc       groupCommitter
+}
+
+// memFamily 是一个列族在 MemTable 中的数据：点写入与墓碑存放在跳表中，范围墓碑单独存放
+type memFamily struct {
+	list      *skiplist.SkipList
+	rangeDels rangeTombstones
+}
+
+func newMemFamily(maxLevel int, p float64) *memFamily {
+	return &memFamily{list: skiplist.NewSkipList(maxLevel, p)}
+}
+
+// size 返回列族估算的内存占用：跳表与范围墓碑
+func (f *memFamily) size() int64 {
+	return int64(f.list.GetSize()) + f.rangeDels.size()
+}
+
+// get 返回 key 的最新条目，被范围墓碑删除时返回一个墓碑
+func (f *memFamily) get(key string) (*sdbf.Entry, bool) {
+	e, ok := f.list.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return f.rangeDels.mask(e, math.MaxInt64), true
 }
 
-func NewMebTable(walDir string) *MemTable {
-	return &MemTable{
-		skipList: skiplist.NewSkipList(4, 0.5),
-		walDir:   walDir,
+// getVersion 返回 key 在序列号 seq 时刻可见的条目，被当时的范围墓碑删除时返回一个墓碑
+func (f *memFamily) getVersion(key string, seq int64) (*sdbf.Entry, bool) {
+	e, ok := f.list.GetVersion(key, seq)
+	if !ok {
+		return nil, false
 	}
+	return f.rangeDels.mask(e, seq), true
 }
 
-func (mt *MemTable) Recovery() {
+// iterator 返回序列号 maxVersion 时刻的迭代器（包含墓碑），每个 key 只返回当时最新的条目，
+// 被范围墓碑删除的条目会被跳过
+//
+// maxVersion 必须是一个已登记、在迭代期间不会释放的快照（读取最新数据时登记一个临时快照）：
+// 对它可见的版本不会被覆盖或回收，可以直接在跳表上流式遍历，之后的写入版本号更大，会被跳过
+func (f *memFamily) iterator(maxVersion int64) Iterator {
+	it := &versionIterator{Iterator: listIterator{f.list.NewIterator()}, maxVersion: maxVersion}
+	return f.rangeDels.filter(newMergeIterator([]Iterator{it}), maxVersion)
+}
 
-	mt.Once.Do(func() {
+// apply 将条目写入列族，调用方需持有 MemTable.mu；keepOld 为 true 时保留同 key 的旧版本
+func (f *memFamily) apply(entry *sdbf.Entry, keepOld bool) {
+	switch {
+	case entry.RangeEnd != "":
+		f.rangeDels.add(entry)
+	case keepOld:
+		f.list.Insert(entry)
+	default:
+		f.list.Set(entry)
+	}
+}
 
-		// 从wal log 中重放数据到 skip list
-		entryChan, err := mt.wal.ReadBatch(1000)
-		if err != nil {
-			slog.Error("recovery memtable", "err", err)
+func NewMemTable(wal *WALManager, opts Options) *MemTable {
+	def := newMemFamily(opts.MaxLevel, opts.P)
+	mt := &MemTable{
+		def:      def,
+		skipList: def.list,
+		families: make(map[string]*memFamily),
+		maxLevel: opts.MaxLevel,
+		p:        opts.P,
+		wal:      wal,
+		gc:       newGroupCommitter(opts.GroupCommitMaxDelay, opts.GroupCommitMaxBatch),
+
+		entryChecksums: opts.EntryChecksums,
+
+		versionGCBytes: opts.MemTableGCBytes,
+		budget:         utils.NewMemoryBudget(opts.MemoryBudget),
+		trackUnlogged:  opts.TrackUnloggedWrites,
+	}
+	mt.timeStages.Store(opts.SlowOpThreshold > 0)
+	return mt
+}
+
+// Recovery 从 wal log 中重放数据到 skip list，只会执行一次
+func (mt *MemTable) Recovery(batchSize int) error {
+	var err error
+	mt.Once.Do(func() {
+		if mt.wal == nil {
 			return
 		}
 
-		for {
-			entries := <-entryChan
-			if entries == nil {
-				break
+		// 从wal log 中重放数据到 skip list
+		mt.mu.Lock()
+		defer mt.mu.Unlock()
+		rerr := mt.wal.replay(batchSize, func(rec WALRecord) {
+			if rec.Type == WALRecordCreateColumnFamily {
+				mt.familyLocked(rec.ColumnFamily)
+				return
 			}
-			for _, entry := range entries {
-				mt.skipList.Set(entry)
+			for _, entry := range rec.Entries {
+				mt.familyLocked(entry.ColumnFamily).apply(entry, false)
+				mt.lastSeq = max(mt.lastSeq, entry.Version)
 			}
+		})
+		if rerr != nil {
+			err = fmt.Errorf("recovery memtable: %w", rerr)
+			return
 		}
-
+		mt.visibleSeq = mt.lastSeq
+		mt.accountLocked()
 	})
+	return err
 }
 
+// Set 写入一个条目，并发的 Set 会通过组提交共享一次 fsync
 func (mt *MemTable) Set(entry *sdbf.Entry) error {
+	return mt.commit([]*sdbf.Entry{entry})
+}
+
+// Delete 写入 key 的墓碑标记
+// 墓碑和普通条目一样经过 WAL 与组提交，恢复时同样会被回放
+func (mt *MemTable) Delete(key string) error {
+	return mt.commit([]*sdbf.Entry{{Key: key, Tombstone: true}})
+}
+
+// Get 返回 key 对应的条目，条目可能是墓碑
+// 墓碑需要返回给调用方，以便遮蔽更旧的数据，而不是当作不存在继续向下查找
+//
+// 读操作不加锁，不会被正在应用的写入阻塞；同一组提交中的多个 key 是逐个可见的，
+// 需要跨 key 一致的视图时应使用快照
+func (mt *MemTable) Get(key string) (*sdbf.Entry, bool) {
+	return mt.def.get(key)
+}
+
+// GetVersion 返回 key 在序列号 seq 时刻可见的条目，条目可能是墓碑
+func (mt *MemTable) GetVersion(key string, seq int64) (*sdbf.Entry, bool) {
+	return mt.def.getVersion(key, seq)
+}
+
+// acquireSnapshot 在 snapshots 中登记当前可见的序列号并返回
+//
+// 登记与读取 visibleSeq 必须在同一把锁内完成：否则一次并发的覆盖写可能在登记之前
+// 完成可见性检查并丢弃旧版本，而快照的序列号又还看不到这次覆盖写
+func (mt *MemTable) acquireSnapshot(snapshots *snapshotList) int64 {
 	mt.mu.Lock()
 	defer mt.mu.Unlock()
-	_, err := mt.wal.Write(entry)
-	if err != nil {
-		return err
+	seq := mt.visibleSeq
+	snapshots.acquire(seq)
+	return seq
+}
+
+// apply 将条目写入对应的列族，调用方需持有 mu
+// 同 key 的旧版本仍对某个快照可见时保留旧版本，否则直接覆盖
+func (mt *MemTable) apply(entry *sdbf.Entry) {
+	f := mt.familyLocked(entry.ColumnFamily)
+	keepOld := false
+	if newest, ok := mt.snapshots.newest(); ok {
+		old, found := f.list.Get(entry.Key)
+		keepOld = found && old.Version <= newest
 	}
-	mt.skipList.Set(entry)
-	return nil
+	f.apply(entry, keepOld)
 }
 
-func (mt *MemTable) Get(key string) (*sdbf.Entry, bool) {
-	mt.mu.RLock()
-	defer mt.mu.RUnlock()
-	return mt.skipList.Get(key)
+// maybeCollectLocked 在 MemTable 的估算大小超过 versionGCBytes（或超出内存预算）且比上次回收后翻倍时
+// 回收旧版本，然后把占用的变化申报到内存预算，调用方需持有 mu。
+// 翻倍的条件保证数据大多仍然有效时回收的开销按写入量均摊
+func (mt *MemTable) maybeCollectLocked() {
+	size := mt.sizeLocked()
+	if (size >= mt.versionGCBytes || mt.budget.Exceeded()) && size >= 2*mt.versionGCBase {
+		mt.collectLocked()
+		mt.versionGCBase = mt.sizeLocked()
+	}
+	mt.accountLocked()
+}
+
+// accountLocked 把上次申报之后的占用变化申报到内存预算，调用方需持有 mu
+//
+// 目前还不能把 MemTable 落盘，超出预算时只能回收旧版本，仍然超出时打印一次警告
+func (mt *MemTable) accountLocked() {
+	size := mt.sizeLocked()
+	mt.budget.Add(size - mt.accounted)
+	mt.accounted = size
+
+	exceeded := mt.budget.Exceeded()
+	if exceeded && !mt.overBudget {
+		slog.Warn("memory budget exceeded", "used", mt.budget.Used(), "limit", mt.budget.Limit(), "memtable", size)
+	}
+	mt.overBudget = exceeded
+}
+
+// collectLocked 删除所有列族中不再对任何读取可见的旧版本，调用方需持有 mu
+//
+// 持有 mu 期间不会登记新的快照（见 acquireSnapshot），所以之后的读取使用的序列号都不小于
+// horizon：最旧的快照，没有快照时为 visibleSeq。墓碑总会保留，增量备份依赖它们传达删除
+func (mt *MemTable) collectLocked() {
+	horizon, ok := mt.snapshots.oldest()
+	if !ok {
+		horizon = mt.visibleSeq
+	}
+	before := mt.sizeLocked()
+	dropped := mt.def.list.DropShadowed(horizon)
+	for _, f := range mt.families {
+		dropped += f.list.DropShadowed(horizon)
+	}
+	if dropped > 0 {
+		slog.Info("memtable old versions dropped", "horizon", horizon, "versions", dropped,
+			"bytesBefore", before, "bytesAfter", mt.sizeLocked())
+	}
+}
+
+// sizeLocked 返回所有列族估算的内存占用之和，调用方需持有 mu
+func (mt *MemTable) sizeLocked() int64 {
+	size := mt.def.size()
+	for _, f := range mt.families {
+		size += f.size()
+	}
+	return size
+}
+
+// family 返回列族 name，不存在时创建，name 为空表示默认列族
+func (mt *MemTable) family(name string) *memFamily {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	return mt.familyLocked(name)
+}
+
+// createFamily 返回名为 name 的列族，不存在时先在 WAL 中记录它的创建，
+// 使还没有数据的列族在重启之后仍然存在。并发创建同一个列族时可能记录多次，回放时是幂等的
+func (mt *MemTable) createFamily(name string) (*memFamily, error) {
+	mt.mu.Lock()
+	_, ok := mt.families[name]
+	mt.mu.Unlock()
+	if !ok && name != "" && mt.wal != nil {
+		if err := mt.wal.writeRecord(WALRecordCreateColumnFamily, []byte(name)); err != nil {
+			return nil, fmt.Errorf("create column family %s: %w", name, err)
+		}
+	}
+	return mt.family(name), nil
+}
+
+// lookupFamily 返回名为 name 的列族，不存在时返回 false，不会创建
+func (mt *MemTable) lookupFamily(name string) (*memFamily, bool) {
+	if name == "" {
+		return mt.def, true
+	}
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	f, ok := mt.families[name]
+	return f, ok
+}
+
+// familyLocked 同 family，调用方需持有 mu
+func (mt *MemTable) familyLocked(name string) *memFamily {
+	if name == "" {
+		return mt.def
+	}
+	f, ok := mt.families[name]
+	if !ok {
+		f = newMemFamily(mt.maxLevel, mt.p)
+		mt.families[name] = f
+	}
+	return f
+}
+
+// allFamilies 返回所有列族的名称与数据，默认列族在前，其余按名称排序
+func (mt *MemTable) allFamilies() ([]string, []*memFamily) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	names := append([]string{""}, slices.Sorted(maps.Keys(mt.families))...)
+	families := make([]*memFamily, len(names))
+	for i, name := range names {
+		families[i] = mt.familyLocked(name)
+	}
+	return names, families
+}
+
+// familiesIterator 依次遍历所有列族在序列号 maxVersion 时刻的数据，每个 key 只返回
+// 当时最新的条目（包含墓碑），key 只在列族内有序；用于备份与复制追赶这类不关心全局顺序的场景
+//
+// 每个列族的范围墓碑跟在该列族的条目之后返回，被它们删除的条目不会返回。
+// maxVersion 的要求同 memFamily.iterator
+func (mt *MemTable) familiesIterator(maxVersion int64) Iterator {
+	_, families := mt.allFamilies()
+	iters := make([]Iterator, 0, 2*len(families))
+	for _, f := range families {
+		iters = append(iters, f.iterator(maxVersion))
+		if ts := f.rangeDels.until(maxVersion); len(ts) > 0 {
+			iters = append(iters, newSliceIterator(ts))
+		}
+	}
+	return newChainIterator(iters)
+}
+
+// Scan 返回 [start, end] 区间内的所有条目（包含墓碑）
+func (mt *MemTable) Scan(start, end string) []*sdbf.Entry {
+	return mt.skipList.Scan(start, end)
 }
@@ -1,11 +1,14 @@
 package lsm
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
 )
 
 // 创建测试用的WAL实例
@@ -324,6 +327,124 @@ func TestWAL_ErrorHandling(t *testing.T) {
 	})
 }
 
+// 测试损坏记录的检测：读取应停在第一条损坏记录之前
+func TestWAL_Corruption(t *testing.T) {
+	entries := []*sdbf.Entry{
+		{Key: "k1", Value: []byte("v1"), Version: 1},
+		{Key: "k2", Value: []byte("v2"), Version: 2},
+		{Key: "k3", Value: []byte("v3"), Version: 3},
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(t *testing.T, path string, size int64)
+		want    int
+	}{
+		{
+			name:    "完整文件",
+			corrupt: func(t *testing.T, path string, size int64) {},
+			want:    3,
+		},
+		{
+			name: "尾部记录数据不完整",
+			corrupt: func(t *testing.T, path string, size int64) {
+				if err := os.Truncate(path, size-2); err != nil {
+					t.Fatalf("截断失败: %v", err)
+				}
+			},
+			want: 2,
+		},
+		{
+			name: "尾部只有半个长度头",
+			corrupt: func(t *testing.T, path string, size int64) {
+				appendBytes(t, path, []byte{0x01, 0x02, 0x03})
+			},
+			want: 3,
+		},
+		{
+			name: "中间记录校验和不匹配",
+			corrupt: func(t *testing.T, path string, size int64) {
+				// 第二条记录的数据区最后一个字节
+				flipByte(t, path, size/3*2-1)
+			},
+			want: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wal, path := createTestWAL(t)
+			defer wal.fd.Close()
+
+			if _, err := wal.Write(entries...); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+			stat, err := wal.fd.Stat()
+			if err != nil {
+				t.Fatalf("无法获取文件信息: %v", err)
+			}
+			tt.corrupt(t, path, stat.Size())
+
+			got, err := wal.ReadAll()
+			if err != nil {
+				t.Fatalf("读取不应失败: %v", err)
+			}
+			if len(got) != tt.want {
+				t.Fatalf("期望读取 %d 条记录，实际读取 %d 条", tt.want, len(got))
+			}
+			for i, e := range got {
+				if e.Key != entries[i].Key {
+					t.Errorf("记录 %d Key不匹配: 期望 %s, 实际 %s", i, entries[i].Key, e.Key)
+				}
+			}
+
+			// 截断损坏尾部后继续追加，新记录应能被读到
+			if err := wal.truncateCorruptedTail(); err != nil {
+				t.Fatalf("截断损坏尾部失败: %v", err)
+			}
+			if _, err := wal.Write(&sdbf.Entry{Key: "k4", Value: []byte("v4")}); err != nil {
+				t.Fatalf("追加写入失败: %v", err)
+			}
+			got, err = wal.ReadAll()
+			if err != nil {
+				t.Fatalf("读取不应失败: %v", err)
+			}
+			if len(got) != tt.want+1 || got[len(got)-1].Key != "k4" {
+				t.Fatalf("截断后追加的记录未被读到, 共读取 %d 条", len(got))
+			}
+		})
+	}
+}
+
+func appendBytes(t *testing.T, path string, data []byte) {
+	t.Helper()
+	fd, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer fd.Close()
+	if _, err := fd.Write(data); err != nil {
+		t.Fatalf("追加数据失败: %v", err)
+	}
+}
+
+func flipByte(t *testing.T, path string, offset int64) {
+	t.Helper()
+	fd, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer fd.Close()
+	b := make([]byte, 1)
+	if _, err := fd.ReadAt(b, offset); err != nil {
+		t.Fatalf("读取字节失败: %v", err)
+	}
+	b[0] ^= 0xFF
+	if _, err := fd.WriteAt(b, offset); err != nil {
+		t.Fatalf("写入字节失败: %v", err)
+	}
+}
+
 // 性能基准测试
 func BenchmarkWAL_Write(b *testing.B) {
 	// 创建临时文件
@@ -376,3 +497,66 @@ func BenchmarkWAL_Read(b *testing.B) {
 		wal.ReadAll()
 	}
 }
+
+// tornWriteFile 在 tear 为 true 时只写入一半的数据并返回错误，模拟写入中途失败（例如磁盘已满）
+type tornWriteFile struct {
+	vfs.File
+	tear bool
+}
+
+func (f *tornWriteFile) Write(p []byte) (int, error) {
+	if !f.tear {
+		return f.File.Write(p)
+	}
+	n, _ := f.File.Write(p[:len(p)/2])
+	return n, errors.New("injected short write")
+}
+
+// 测试写入中途失败后 size 不前进，下一次写入覆盖写了一半的记录，读取时前后两条完整的记录都在
+func TestWAL_TornWrite(t *testing.T) {
+	fs := vfs.NewMemFS()
+	fd, err := fs.Create("torn.wal")
+	if err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	f := &tornWriteFile{File: fd}
+	w := NewWAL(f, "", "torn.wal", walVersion)
+	defer w.Close()
+
+	if _, err := w.Write(&sdbf.Entry{Key: "a", Value: []byte("1"), Version: 1}); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	size := w.Size()
+
+	f.tear = true
+	if _, err := w.Write(&sdbf.Entry{Key: "torn", Value: bytes.Repeat([]byte("x"), 256), Version: 2}); err == nil {
+		t.Fatalf("写入中途失败时期望返回错误")
+	}
+	f.tear = false
+	if w.Size() != size {
+		t.Fatalf("写入失败后 size 不应前进: 期望 %d, 实际 %d", size, w.Size())
+	}
+
+	if _, err := w.Write(&sdbf.Entry{Key: "b", Value: []byte("2"), Version: 3}); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	entries, err := w.ReadAll()
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Key != "a" || entries[1].Key != "b" {
+		t.Fatalf("期望读到 a 与 b, 实际 %v", entries)
+	}
+
+	// 封存前截断残留，文件只包含完整的记录
+	if err := w.trim(); err != nil {
+		t.Fatalf("截断失败: %v", err)
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		t.Fatalf("stat 失败: %v", err)
+	}
+	if stat.Size() != w.Size() {
+		t.Fatalf("截断后文件大小期望 %d, 实际 %d", w.Size(), stat.Size())
+	}
+}
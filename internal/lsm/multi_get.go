@@ -0,0 +1,40 @@
+package lsm
+
+// MultiGet 读取多个 key，values[i] 对应 keys[i]：不存在、已删除或已过期的 key 为 nil，
+// 存在但值为空时为长度为 0 的非 nil 切片
+//
+// 所有 key 读取的是同一个序列号时刻的数据，不会只看到一个 WriteBatch 的一部分；
+// 与逐个调用 Get 相比，整组读取只获取一次锁、登记一次快照。
+// 目前所有数据都在 MemTable 中，没有 SSTable 的块缓存与布隆过滤器需要共享。
+// 启用 Options.EntryChecksums 时任何一个条目校验失败都返回 ErrChecksumMismatch
+func (db *DB) MultiGet(keys []string) ([][]byte, error) {
+	t := db.startOp("multiget", "", "")
+	defer t.done()
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+	seq := db.memTable.acquireSnapshot(db.snapshots)
+	defer db.snapshots.release(seq)
+
+	now := db.now().UnixNano()
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		entry, ok := db.memTable.GetVersion(key, seq)
+		if !ok || !isLive(entry, now) {
+			continue
+		}
+		if err := db.verifyEntry(entry); err != nil {
+			return nil, err
+		}
+		values[i] = entry.Value
+		if values[i] == nil {
+			values[i] = []byte{}
+		}
+	}
+	t.stage("memtable")
+	return values, nil
+}
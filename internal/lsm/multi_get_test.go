@@ -0,0 +1,91 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDB_MultiGet(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	db.now = clock.Now
+
+	for key, value := range map[string]string{"a": "1", "b": "2", "empty": "", "deleted": "x"} {
+		if err := db.Set(key, []byte(value)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := db.Delete("deleted"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if err := db.SetWithTTL("expired", []byte("x"), time.Second); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	clock.Advance(2 * time.Second)
+
+	tests := []struct {
+		name string
+		keys []string
+		want []any
+	}{
+		{"空", nil, []any{}},
+		{"保持顺序与重复", []string{"b", "a", "b"}, []any{"2", "1", "2"}},
+		{"不存在的 key 为 nil", []string{"a", "missing", "deleted", "expired"}, []any{"1", nil, nil, nil}},
+		{"空值不是 nil", []string{"empty"}, []any{""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := db.MultiGet(tt.keys)
+			if err != nil {
+				t.Fatalf("MultiGet 失败: %v", err)
+			}
+			if len(values) != len(tt.want) {
+				t.Fatalf("期望 %d 个值, 实际 %d", len(tt.want), len(values))
+			}
+			for i, v := range values {
+				if want, ok := tt.want[i].(string); !ok && v != nil || ok && (v == nil || string(v) != want) {
+					t.Fatalf("%s 期望 %v, 实际 %q", tt.keys[i], tt.want[i], v)
+				}
+			}
+		})
+	}
+
+	db.Close()
+	if _, err := db.MultiGet([]string{"a"}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("期望 ErrClosed, 实际 %v", err)
+	}
+}
+
+func BenchmarkDB_MultiGet(b *testing.B) {
+	db, err := Open(InMemory, DefaultOptions())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%04d", i*7)
+		if err := db.Set(keys[i], []byte("value")); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.Run("MultiGet", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := db.MultiGet(keys); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Get", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, key := range keys {
+				if _, err := db.Get(key); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
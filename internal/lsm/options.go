@@ -0,0 +1,181 @@
+package lsm
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/internal/utils"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+const (
+	// MaxKeySizeLimit Options.MaxKeySize 允许的最大值（1 MiB）
+	MaxKeySizeLimit = 1 << 20
+	// MaxValueSizeLimit Options.MaxValueSize 允许的最大值（512 MiB），
+	// 与 MaxKeySizeLimit 一起保证单个条目总能放进一条 WAL 记录
+	MaxValueSizeLimit = 512 << 20
+	// WALMaxRecordSizeLimit Options.WALMaxRecordSize 允许的最大值（1 GiB），
+	// 也是不知道写入方配置时（DecodeWAL、复制与备份流）读取记录使用的上限
+	WALMaxRecordSizeLimit = 1 << 30
+)
+
+// Options 控制 DB 的行为，零值字段会在 Open 时被替换为默认值
+type Options struct {
+	// MaxLevel 跳表的最大层级
+	MaxLevel int
+	// P 跳表节点提升到上一层的概率
+	P float64
+	// RecoveryBatchSize 恢复时每批从 WAL 读取的记录数
+	RecoveryBatchSize int
+	// RecoveryConcurrency 恢复时并行校验、解压与反序列化 WAL 记录的 goroutine 数，默认 GOMAXPROCS；
+	// 记录仍按写入顺序应用到 MemTable
+	RecoveryConcurrency int
+	// RecoveryMode 回放 WAL 时如何处理损坏的记录，默认 TolerateTailCorruption
+	RecoveryMode RecoveryMode
+	// MemTableGCBytes MemTable 的估算大小超过该值、且比上次回收后翻倍时，回收不再对任何快照
+	// 可见的旧版本（快照存在期间覆盖写保留的版本），见 MemTable.collectLocked
+	MemTableGCBytes int64
+	// MemoryBudget 内存预算（字节），MemTable 等组件按统一的方法（见 utils.EntrySize）估算占用并申报到
+	// 同一个预算上；超出时立即回收旧版本并打印警告，0 表示不限制。目前还不能落盘，预算不会阻止写入
+	MemoryBudget int64
+	// WALSegmentSize 单个 WAL 段文件的大小上限（字节），超过后切换到新段
+	WALSegmentSize int64
+	// GroupCommitMaxDelay 组提交的 leader 最多等待多久以攒更多的写入共享一次 fsync，
+	// 即单次写入因组提交额外增加的延迟上限。为 0 时不主动等待，只合并 fsync 期间排队的写入
+	GroupCommitMaxDelay time.Duration
+	// GroupCommitMaxBatch 单次组提交最多包含的写入请求数
+	GroupCommitMaxBatch int
+	// AsyncWriteQueueSize 未完成的异步写入（WriteAsync / SetAsync）数量上限，达到后新的异步写入阻塞
+	AsyncWriteQueueSize int
+	// MaxKeySize key 的最大长度（字节），超过时写入返回 ErrKeyTooLarge，不能超过 MaxKeySizeLimit
+	MaxKeySize int
+	// MaxValueSize value 的最大长度（字节），超过时写入返回 ErrValueTooLarge，不能超过 MaxValueSizeLimit
+	MaxValueSize int
+	// SyncMode WAL 的 fsync 策略
+	SyncMode SyncMode
+	// SyncPeriod SyncPeriodic 模式下后台 fsync 的周期
+	SyncPeriod time.Duration
+	// WALSyncMethod WAL 持久化使用的系统调用，默认 fsync
+	WALSyncMethod WALSyncMethod
+	// WALPreallocate 创建段时预分配 WALSegmentSize 的磁盘空间（Linux 上为 fallocate），
+	// 追加写入不再扩展文件，减少 ext4/xfs 上每次 fsync 附带的元数据日志
+	WALPreallocate bool
+	// WALArchiveDir 非空时在后台把封存的 WAL 段归档（硬链接或复制）到该目录，
+	// 供时间点恢复（RestoreOptions.WALDir）使用，每归档一个段通知 EventListener.OnWALArchive
+	WALArchiveDir string
+	// WALArchiveRetention 归档目录的保留策略，零值表示永久保留
+	WALArchiveRetention WALArchiveRetention
+	// WALRecycleSegments 最多保留多少个通过 RemoveSegmentsBefore 删除的段供之后的新段复用，
+	// 0 表示直接删除。回收的段在删除时被清零，复用时只需重命名，不再分配磁盘空间
+	WALRecycleSegments int
+	// WALCompression 压缩 WAL 记录使用的算法，默认不压缩。值较大时 fsync 受限于磁盘带宽，
+	// 压缩可以减少写入量；每条记录记录自己的算法，更换算法后旧的段仍然可读
+	WALCompression utils.CodecID
+	// WALMaxRecordSize 单条 WAL 记录数据部分（压缩前）的长度上限（字节），默认 WALMaxRecordSizeLimit。
+	// 写入时超出的批次返回 ErrBatchTooLarge；回放时长度字段超出的记录视为损坏，不会按损坏的长度分配内存。
+	// 不能小于 MaxKeySize + MaxValueSize 加上编码开销，保证单个条目总能写入；调小之后已有的段中
+	// 更大的记录将无法回放，应先调大再调小
+	WALMaxRecordSize int64
+	// EncryptionKeys 不为 nil 时用 AES-GCM 加密新写入的 WAL 记录（压缩之后）与备份，见 KeyProvider；
+	// 每条记录保存了加密方案与密钥 ID，未加密的旧记录仍然可读。读取加密的数据必须配置能提供对应密钥的 KeyProvider，
+	// 缺少密钥时 Open 返回 ErrEncryptionKey 而不会把这些记录当作损坏截断
+	EncryptionKeys KeyProvider
+	// EntryChecksums 写入时为每个条目计算 CRC32C 校验和并随条目保存（WAL、备份与复制中都保留），
+	// Get 返回之前重新计算并比较，不一致时返回 ErrChecksumMismatch。
+	// 用于发现 WAL 记录校验范围之外的损坏，例如 MemTable 中的位翻转；启用之前写入的条目没有校验和，不做校验
+	EntryChecksums bool
+	// TrackUnloggedWrites 记录 WriteOptions.DisableWAL 写入的 key，使 CloseOptions.FlushUnlogged
+	// 可以在关闭时把它们补写到 WAL。记录引用 MemTable 中的条目，每个 key 额外占用一个哈希表项；
+	// 不需要在关闭时保留这些写入时不要启用
+	TrackUnloggedWrites bool
+	// FS 所有文件读写使用的文件系统，默认为 vfs.OSFS
+	FS vfs.FS
+	// EventListener 接收引擎事件通知，为 nil 时不通知
+	EventListener EventListener
+	// SlowOpThreshold 大于 0 时，耗时达到该值的 Get/Set/Delete/Write/Scan/Sync 会打印一条带各阶段耗时的警告，
+	// 并通知 EventListener.OnSlowOp；为 0 时不计时，没有额外开销
+	SlowOpThreshold time.Duration
+	// SlowOpHashKeys 慢操作日志中用 key 的哈希代替原文，避免敏感数据进入日志
+	SlowOpHashKeys bool
+	// ScrubInterval 大于 0 时后台每隔该时间校验一遍所有封存的 WAL 段，
+	// 发现损坏时通过 EventListener.OnCorruption 报告，见 DB.Scrub；为 0 时不启动
+	ScrubInterval time.Duration
+	// ScrubBytesPerSec 后台校验每秒最多读取的字节数，避免与前台读写争抢磁盘，默认 8MB
+	ScrubBytesPerSec int64
+}
+
+// DefaultOptions 返回一份默认配置
+func DefaultOptions() Options {
+	return Options{
+		MaxLevel:            12,
+		P:                   0.5,
+		RecoveryBatchSize:   1000,
+		MemTableGCBytes:     64 << 20,
+		WALSegmentSize:      64 << 20,
+		GroupCommitMaxBatch: 256,
+		AsyncWriteQueueSize: 1024,
+		MaxKeySize:          64 << 10,
+		MaxValueSize:        64 << 20,
+		SyncMode:            SyncEveryWrite,
+		SyncPeriod:          100 * time.Millisecond,
+		ScrubBytesPerSec:    8 << 20,
+		FS:                  vfs.OSFS{},
+	}
+}
+
+// withDefaults 用默认值填充未设置的字段
+func (o Options) withDefaults() Options {
+	def := DefaultOptions()
+	if o.MaxLevel <= 0 {
+		o.MaxLevel = def.MaxLevel
+	}
+	if o.P <= 0 || o.P >= 1 {
+		o.P = def.P
+	}
+	if o.RecoveryBatchSize <= 0 {
+		o.RecoveryBatchSize = def.RecoveryBatchSize
+	}
+	if o.RecoveryConcurrency <= 0 {
+		o.RecoveryConcurrency = runtime.GOMAXPROCS(0)
+	}
+	if o.MemTableGCBytes <= 0 {
+		o.MemTableGCBytes = def.MemTableGCBytes
+	}
+	if o.WALSegmentSize <= 0 {
+		o.WALSegmentSize = def.WALSegmentSize
+	}
+	if o.GroupCommitMaxDelay < 0 {
+		o.GroupCommitMaxDelay = def.GroupCommitMaxDelay
+	}
+	if o.GroupCommitMaxBatch <= 0 {
+		o.GroupCommitMaxBatch = def.GroupCommitMaxBatch
+	}
+	if o.AsyncWriteQueueSize <= 0 {
+		o.AsyncWriteQueueSize = def.AsyncWriteQueueSize
+	}
+	if o.MaxKeySize <= 0 {
+		o.MaxKeySize = def.MaxKeySize
+	}
+	o.MaxKeySize = min(o.MaxKeySize, MaxKeySizeLimit)
+	if o.MaxValueSize <= 0 {
+		o.MaxValueSize = def.MaxValueSize
+	}
+	o.MaxValueSize = min(o.MaxValueSize, MaxValueSizeLimit)
+	if o.WALMaxRecordSize <= 0 {
+		o.WALMaxRecordSize = WALMaxRecordSizeLimit
+	}
+	o.WALMaxRecordSize = min(max(o.WALMaxRecordSize, int64(o.MaxKeySize+o.MaxValueSize+batchOpOverhead)), WALMaxRecordSizeLimit)
+	if o.SyncPeriod <= 0 {
+		o.SyncPeriod = def.SyncPeriod
+	}
+	if o.ScrubBytesPerSec <= 0 {
+		o.ScrubBytesPerSec = def.ScrubBytesPerSec
+	}
+	if o.FS == nil {
+		o.FS = def.FS
+	}
+	if o.EventListener == nil {
+		o.EventListener = BaseEventListener{}
+	}
+	return o
+}
@@ -0,0 +1,137 @@
+package lsm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/aireet/SimpleDBForge/internal/utils"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+// ErrIncompatibleOptions 数据目录由不兼容的配置或更新版本的引擎写入，错误信息中说明了原因与解决办法
+var ErrIncompatibleOptions = errors.New("incompatible options")
+
+const (
+	// optionsFileName 数据目录下记录生效配置的文件，每次 Open 时原子地重写
+	optionsFileName = "OPTIONS"
+	// optionsFormatVersion 当前 OPTIONS 文件的格式版本
+	optionsFormatVersion = 1
+	// bytewiseComparator key 按字节序比较，目前唯一的比较器
+	bytewiseComparator = "bytewise"
+)
+
+// persistedOptions 是 OPTIONS 文件的内容：数据目录中的数据依赖的格式与配置
+//
+// 重新打开时先检查它与当前的构建和配置是否兼容，不兼容时在读取 WAL 之前拒绝打开，
+// 不会把无法识别的数据当作损坏截断。没有 OPTIONS 文件的目录（引入之前创建的）视为兼容
+type persistedOptions struct {
+	FormatVersion int `json:"format_version"`
+	// Comparator key 的排序方式，决定了跳表与所有迭代器中的顺序
+	Comparator string `json:"comparator"`
+	// WALFormat WAL 文件格式版本，见 walVersion
+	WALFormat string `json:"wal_format"`
+	// EntryFormat 条目的编码版本，见 entryFormatVersion
+	EntryFormat int `json:"entry_format"`
+	// WALCompression 最近一次打开时压缩新记录使用的算法
+	WALCompression   string `json:"wal_compression"`
+	Encrypted        bool   `json:"encrypted"`
+	EntryChecksums   bool   `json:"entry_checksums"`
+	MaxKeySize       int    `json:"max_key_size"`
+	MaxValueSize     int    `json:"max_value_size"`
+	WALMaxRecordSize int64  `json:"wal_max_record_size"`
+	WALSegmentSize   int64  `json:"wal_segment_size"`
+}
+
+// persistOptions 返回 opts 对应的 OPTIONS 文件内容，opts 已经填充了默认值
+func persistOptions(opts Options) persistedOptions {
+	p := persistedOptions{
+		FormatVersion:    optionsFormatVersion,
+		Comparator:       bytewiseComparator,
+		WALFormat:        walVersion,
+		EntryFormat:      entryFormatVersion,
+		Encrypted:        opts.EncryptionKeys != nil,
+		EntryChecksums:   opts.EntryChecksums,
+		MaxKeySize:       opts.MaxKeySize,
+		MaxValueSize:     opts.MaxValueSize,
+		WALMaxRecordSize: opts.WALMaxRecordSize,
+		WALSegmentSize:   opts.WALSegmentSize,
+	}
+	if codec, err := utils.CodecByID(opts.WALCompression); err == nil {
+		p.WALCompression = codec.Name()
+	}
+	return p
+}
+
+// checkCompatible 检查按 p 写入的数据能否用 cur 打开，不兼容时返回包装了 ErrIncompatibleOptions 的错误
+func (p persistedOptions) checkCompatible(cur persistedOptions) error {
+	if p.FormatVersion > cur.FormatVersion {
+		return fmt.Errorf("%w: OPTIONS format version %d is newer than %d supported by this build; upgrade SimpleDBForge to open this directory",
+			ErrIncompatibleOptions, p.FormatVersion, cur.FormatVersion)
+	}
+	if p.Comparator != cur.Comparator {
+		return fmt.Errorf("%w: keys are ordered by comparator %q but this build only supports %q; open the directory with a build that provides that comparator",
+			ErrIncompatibleOptions, p.Comparator, cur.Comparator)
+	}
+	if p.WALFormat != cur.WALFormat {
+		return fmt.Errorf("%w: WAL format %s is not supported by this build (%s); open the directory with the engine version that wrote it, or restore a backup",
+			ErrIncompatibleOptions, p.WALFormat, cur.WALFormat)
+	}
+	if p.EntryFormat > cur.EntryFormat {
+		return fmt.Errorf("%w: entry format %d is newer than %d supported by this build; upgrade SimpleDBForge to open this directory",
+			ErrIncompatibleOptions, p.EntryFormat, cur.EntryFormat)
+	}
+	if p.WALCompression != "" {
+		if _, err := utils.CodecByName(p.WALCompression); err != nil {
+			return fmt.Errorf("%w: WAL records are compressed with %q, which this build does not support; upgrade SimpleDBForge to open this directory",
+				ErrIncompatibleOptions, p.WALCompression)
+		}
+	}
+	return nil
+}
+
+// readOptionsFile 读取 dir 下的 OPTIONS 文件，文件不存在时 found 为 false
+func readOptionsFile(fsys vfs.FS, dir string) (p persistedOptions, found bool, err error) {
+	path := filepath.Join(dir, optionsFileName)
+	fd, err := fsys.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return p, false, nil
+	}
+	if err != nil {
+		return p, false, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer fd.Close()
+	if err := json.NewDecoder(fd).Decode(&p); err != nil {
+		return p, false, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return p, true, nil
+}
+
+// syncOptionsFile 检查 dir 中已有的 OPTIONS 文件与 opts 是否兼容，兼容时原子地写入 opts 对应的新内容
+func syncOptionsFile(fsys vfs.FS, dir string, opts Options) error {
+	cur := persistOptions(opts)
+	prev, found, err := readOptionsFile(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("%w; remove the file to let Open recreate it", err)
+	}
+	if found {
+		if err := prev.checkCompatible(cur); err != nil {
+			return err
+		}
+		if cur.WALMaxRecordSize < prev.WALMaxRecordSize {
+			slog.Warn("WALMaxRecordSize reduced, larger records in existing segments will be treated as corrupt",
+				"dir", dir, "previous", prev.WALMaxRecordSize, "current", cur.WALMaxRecordSize)
+		}
+		if cur == prev {
+			return nil
+		}
+	}
+	return writeFileAtomic(fsys, filepath.Join(dir, optionsFileName), func(fd vfs.File) error {
+		enc := json.NewEncoder(fd)
+		enc.SetIndent("", "  ")
+		return enc.Encode(cur)
+	})
+}
@@ -0,0 +1,133 @@
+package lsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/internal/utils"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+// editOptionsFile 读取 dir 下的 OPTIONS 文件，用 edit 修改后写回
+func editOptionsFile(t *testing.T, dir string, edit func(p *persistedOptions)) {
+	t.Helper()
+	path := filepath.Join(dir, optionsFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p persistedOptions
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatalf("解析 OPTIONS 失败: %v", err)
+	}
+	edit(&p)
+	if data, err = json.Marshal(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 测试 Open 写入 OPTIONS 文件，配置变化时更新，没有 OPTIONS 文件的旧目录照常打开
+func TestOpen_OptionsFile(t *testing.T) {
+	dir := t.TempDir()
+	opts := Options{SyncMode: NoSync, WALCompression: utils.CodecZstd, EntryChecksums: true}
+	db, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	if err := db.Set("k", []byte("v")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	db.Close()
+
+	p, found, err := readOptionsFile(vfs.OSFS{}, dir)
+	if err != nil || !found {
+		t.Fatalf("读取 OPTIONS 失败: %v %v", found, err)
+	}
+	if want := persistOptions(opts.withDefaults()); p != want || p.WALCompression != "zstd" || p.Comparator != bytewiseComparator {
+		t.Fatalf("期望 %+v, 实际 %+v", want, p)
+	}
+	if _, err := os.Stat(filepath.Join(dir, optionsFileName+".tmp")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("不应留下临时文件: %v", err)
+	}
+
+	// 更换压缩算法是兼容的，OPTIONS 随之更新
+	db, err = Open(dir, Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	db.Close()
+	if p, _, _ := readOptionsFile(vfs.OSFS{}, dir); p.WALCompression != "none" || p.EntryChecksums {
+		t.Fatalf("OPTIONS 应当更新为当前配置: %+v", p)
+	}
+
+	// 引入 OPTIONS 之前创建的目录
+	if err := os.Remove(filepath.Join(dir, optionsFileName)); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(dir, Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开没有 OPTIONS 的目录失败: %v", err)
+	}
+	defer db.Close()
+	if got, err := db.Get("k"); err != nil || string(got) != "v" {
+		t.Fatalf("读取失败: %q %v", got, err)
+	}
+	if _, found, _ := readOptionsFile(vfs.OSFS{}, dir); !found {
+		t.Fatal("Open 应当补写 OPTIONS")
+	}
+}
+
+// 测试不兼容的 OPTIONS 在读取 WAL 之前拒绝打开，不修改 WAL 与 OPTIONS
+func TestOpen_IncompatibleOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(p *persistedOptions)
+	}{
+		{name: "OPTIONS 格式更新", edit: func(p *persistedOptions) { p.FormatVersion = optionsFormatVersion + 1 }},
+		{name: "比较器不同", edit: func(p *persistedOptions) { p.Comparator = "reverse" }},
+		{name: "WAL 格式不同", edit: func(p *persistedOptions) { p.WALFormat = "v3.0" }},
+		{name: "条目格式更新", edit: func(p *persistedOptions) { p.EntryFormat = entryFormatVersion + 1 }},
+		{name: "未知的压缩算法", edit: func(p *persistedOptions) { p.WALCompression = "lz9" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := Open(dir, Options{SyncMode: NoSync})
+			if err != nil {
+				t.Fatalf("打开失败: %v", err)
+			}
+			if err := db.Set("k", []byte("v")); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+			db.Close()
+			editOptionsFile(t, dir, tt.edit)
+			// 在 WAL 末尾追加不完整的记录：如果读取了 WAL，它会被截断
+			segment := filepath.Join(dir, walDirName, segmentName(1))
+			appendBytes(t, segment, []byte{1, 2, 3})
+			before, err := os.ReadFile(segment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			optionsBefore, err := os.ReadFile(filepath.Join(dir, optionsFileName))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := Open(dir, Options{SyncMode: NoSync}); !errors.Is(err, ErrIncompatibleOptions) {
+				t.Fatalf("期望 ErrIncompatibleOptions, 实际 %v", err)
+			}
+			after, _ := os.ReadFile(segment)
+			optionsAfter, _ := os.ReadFile(filepath.Join(dir, optionsFileName))
+			if !bytes.Equal(before, after) || !bytes.Equal(optionsBefore, optionsAfter) {
+				t.Fatal("拒绝打开时不应修改 WAL 或 OPTIONS")
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package lsm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+// ParallelScan 并行遍历默认列族中 [start, end) 区间（end 为空表示直到最后一个 key）内存活的条目，
+// 对每个条目调用 fn，用于统计、校验、导出这类需要读取大量数据的全量扫描
+//
+// 区间先由 SplitRange 切分为最多 workers 个数据量大致相等的子区间，每个子区间由一个 goroutine
+// 独立遍历。所有子区间读取同一个快照，同一个子区间内的条目按 key 升序传给 fn，
+// 不同子区间的 fn 并发执行，fn 需要是并发安全的；条目与 MemTable 共享，fn 不能修改它。
+// fn 返回错误或 ctx 被取消时停止所有遍历，返回第一个错误
+func (db *DB) ParallelScan(ctx context.Context, start, end string, workers int, fn func(*sdbf.Entry) error) error {
+	if err := db.parallelScan(ctx, db.memTable.def, KeyRange{Start: start, End: end}, workers, fn); err != nil {
+		return fmt.Errorf("parallel scan: %w", err)
+	}
+	return nil
+}
+
+// ParallelScan 并行遍历列族中 [start, end) 区间内存活的条目，见 DB.ParallelScan
+func (cf *ColumnFamily) ParallelScan(ctx context.Context, start, end string, workers int, fn func(*sdbf.Entry) error) error {
+	if err := cf.db.parallelScan(ctx, cf.f, KeyRange{Start: start, End: end}, workers, fn); err != nil {
+		return fmt.Errorf("parallel scan: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) parallelScan(ctx context.Context, f *memFamily, r KeyRange, workers int, fn func(*sdbf.Entry) error) error {
+	if workers <= 0 {
+		return fmt.Errorf("workers must be positive, got %d", workers)
+	}
+
+	// 只在登记快照时持有读锁，遍历期间不阻塞 Close
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		return ErrClosed
+	}
+	seq := db.memTable.acquireSnapshot(db.snapshots)
+	db.mu.RUnlock()
+	defer db.snapshots.release(seq)
+
+	now := db.now()
+	ranges := splitRangeAt(f, r, workers, seq, now)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	var wg sync.WaitGroup
+	for _, sub := range ranges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			it := newLiveIterator(f.iterator(seq), now)
+			for it.Seek(sub.Start); it.Valid() && sub.contains(it.Key()); it.Next() {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+				}
+				if err := fn(it.Entry()); err != nil {
+					cancel(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return context.Cause(ctx)
+}
@@ -0,0 +1,111 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+// 测试 ParallelScan 恰好访问区间内的每个存活条目一次
+func TestDB_ParallelScan(t *testing.T) {
+	db, err := Open(t.TempDir(), Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	for i := 0; i < 1000; i++ {
+		if err := db.Set(fmt.Sprintf("key-%03d", i), []byte("v")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := db.DeleteRange("key-100", "key-200"); err != nil {
+		t.Fatalf("范围删除失败: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		start, end string
+		workers    int
+		want       int
+	}{
+		{name: "单个 worker", workers: 1, want: 900},
+		{name: "多个 worker", workers: 8, want: 900},
+		{name: "子区间", start: "key-150", end: "key-300", workers: 4, want: 100},
+		{name: "worker 多于 key", start: "key-998", workers: 16, want: 2},
+		{name: "空区间", start: "x", workers: 4, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			seen := make(map[string]int)
+			err := db.ParallelScan(context.Background(), tt.start, tt.end, tt.workers, func(e *sdbf.Entry) error {
+				mu.Lock()
+				defer mu.Unlock()
+				seen[e.Key]++
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("扫描失败: %v", err)
+			}
+			if len(seen) != tt.want {
+				t.Fatalf("期望 %d 个 key, 实际 %d", tt.want, len(seen))
+			}
+			for key, n := range seen {
+				if n != 1 {
+					t.Fatalf("key %s 被访问了 %d 次", key, n)
+				}
+			}
+		})
+	}
+}
+
+// 测试 fn 返回错误或 ctx 被取消时停止扫描并返回对应的错误
+func TestDB_ParallelScanStop(t *testing.T) {
+	db, err := Open(t.TempDir(), Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	for i := 0; i < 1000; i++ {
+		if err := db.Set(fmt.Sprintf("key-%03d", i), []byte("v")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+
+	errStop := errors.New("stop")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		fn      func(*sdbf.Entry) error
+		wantErr error
+	}{
+		{name: "fn 返回错误", ctx: context.Background(), fn: func(*sdbf.Entry) error { return errStop }, wantErr: errStop},
+		{name: "ctx 已取消", ctx: canceled, fn: func(*sdbf.Entry) error { return nil }, wantErr: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int64
+			err := db.ParallelScan(tt.ctx, "", "", 4, func(e *sdbf.Entry) error {
+				calls.Add(1)
+				return tt.fn(e)
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("期望 %v, 实际 %v", tt.wantErr, err)
+			}
+			// 每个 worker 最多在发现停止之前再处理一个条目
+			if n := calls.Load(); n > 4 {
+				t.Fatalf("停止后仍然调用了 fn: %d 次", n)
+			}
+		})
+	}
+	if err := db.ParallelScan(context.Background(), "", "", 0, nil); err == nil {
+		t.Fatalf("workers 为 0 时期望返回错误")
+	}
+}
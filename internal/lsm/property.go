@@ -0,0 +1,162 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// ErrUnknownProperty GetProperty 的属性名不存在
+var ErrUnknownProperty = errors.New("unknown property")
+
+// 可以通过 GetProperty 读取的属性，值都是十进制整数的字符串，布尔值为 "0" 或 "1"
+const (
+	// PropNumEntriesActiveMemTable MemTable 中（所有列族）的条目数，包含墓碑与为快照保留的旧版本
+	PropNumEntriesActiveMemTable = "sdbf.num-entries-active-memtable"
+	// PropCurSizeActiveMemTable MemTable 估算的内存占用（字节）
+	PropCurSizeActiveMemTable = "sdbf.cur-size-active-memtable"
+	// PropEstimateLiveDataSize 数据的估算大小（字节）；目前所有数据都在 MemTable 中，等于 PropCurSizeActiveMemTable
+	PropEstimateLiveDataSize = "sdbf.estimate-live-data-size"
+	// PropIsWriteStalled 写入是否被阻塞：异步写入队列已满（见 Options.AsyncWriteQueueSize）
+	PropIsWriteStalled = "sdbf.is-write-stalled"
+	// PropNumPendingCommits 排队等待组提交的写入请求数
+	PropNumPendingCommits = "sdbf.num-pending-commits"
+	// PropIsOverMemoryBudget MemTable 等组件的占用是否超出 Options.MemoryBudget
+	PropIsOverMemoryBudget = "sdbf.is-over-memory-budget"
+	// PropNumSnapshots 未释放的快照数，PropOldestSnapshotSequence 最旧快照的序列号（没有快照时为 0）
+	PropNumSnapshots           = "sdbf.num-snapshots"
+	PropOldestSnapshotSequence = "sdbf.oldest-snapshot-sequence"
+	// PropLastSequence 最后一次对读可见的写入的序列号
+	PropLastSequence = "sdbf.last-sequence"
+	// PropNumWALFiles WAL 段文件数，PropTotalWALSize 所有段的总大小（字节），纯内存数据库都为 0
+	PropNumWALFiles  = "sdbf.num-wal-files"
+	PropTotalWALSize = "sdbf.total-wal-size"
+	// PropNumColumnFamilies 列族数，包括默认列族
+	PropNumColumnFamilies = "sdbf.num-column-families"
+)
+
+// properties 属性名 -> 读取函数，调用时已持有 db.mu 的读锁且数据库未关闭
+var properties = map[string]func(db *DB) (int64, error){
+	PropNumEntriesActiveMemTable: func(db *DB) (int64, error) {
+		var n int64
+		_, families := db.memTable.allFamilies()
+		for _, f := range families {
+			n += int64(f.list.Len())
+		}
+		return n, nil
+	},
+	PropCurSizeActiveMemTable: memTableSize,
+	PropEstimateLiveDataSize:  memTableSize,
+	PropIsWriteStalled: func(db *DB) (int64, error) {
+		return boolProp(db.writeStalled()), nil
+	},
+	PropNumPendingCommits: func(db *DB) (int64, error) {
+		db.memTable.commitMu.Lock()
+		defer db.memTable.commitMu.Unlock()
+		return int64(len(db.memTable.pending)), nil
+	},
+	PropIsOverMemoryBudget: func(db *DB) (int64, error) {
+		return boolProp(db.memTable.budget.Exceeded()), nil
+	},
+	PropNumSnapshots: func(db *DB) (int64, error) {
+		return int64(db.snapshots.len()), nil
+	},
+	PropOldestSnapshotSequence: func(db *DB) (int64, error) {
+		seq, _ := db.snapshots.oldest()
+		return seq, nil
+	},
+	PropLastSequence: func(db *DB) (int64, error) {
+		db.memTable.mu.Lock()
+		defer db.memTable.mu.Unlock()
+		return db.memTable.visibleSeq, nil
+	},
+	PropNumWALFiles: func(db *DB) (int64, error) {
+		if db.wal == nil {
+			return 0, nil
+		}
+		segments, _, err := db.wal.diskUsage()
+		return int64(segments), err
+	},
+	PropTotalWALSize: func(db *DB) (int64, error) {
+		if db.wal == nil {
+			return 0, nil
+		}
+		_, size, err := db.wal.diskUsage()
+		return size, err
+	},
+	PropNumColumnFamilies: func(db *DB) (int64, error) {
+		names, _ := db.memTable.allFamilies()
+		return int64(len(names)), nil
+	},
+}
+
+func memTableSize(db *DB) (int64, error) {
+	var n int64
+	_, families := db.memTable.allFamilies()
+	for _, f := range families {
+		n += f.size()
+	}
+	return n, nil
+}
+
+func boolProp(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// PropertyNames 返回所有可以通过 GetProperty 读取的属性名，按名称排序
+func PropertyNames() []string {
+	return slices.Sorted(maps.Keys(properties))
+}
+
+// GetProperty 返回名为 name 的属性（见 Prop* 常量），不存在时返回 ErrUnknownProperty
+//
+// 与 Stats 相比每次只读取一项，适合编排系统按需探测；值为十进制整数的字符串
+func (db *DB) GetProperty(name string) (string, error) {
+	v, err := db.GetIntProperty(name)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(v, 10), nil
+}
+
+// GetIntProperty 与 GetProperty 相同，但直接返回整数值
+func (db *DB) GetIntProperty(name string) (int64, error) {
+	get, ok := properties[name]
+	if !ok {
+		return 0, fmt.Errorf("get property %q: %w", name, ErrUnknownProperty)
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return 0, ErrClosed
+	}
+	v, err := get(db)
+	if err != nil {
+		return 0, fmt.Errorf("get property %q: %w", name, err)
+	}
+	return v, nil
+}
+
+// Health 检查数据库能否正常服务：已关闭时返回 ErrClosed，SyncPeriodic 模式下最近一次后台 fsync
+// 失败时返回该错误（此时写入虽然成功，但可能无法持久化）；正常时返回 nil
+func (db *DB) Health() error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	if db.wal != nil {
+		if err := db.wal.syncErr.Load(); err != nil {
+			return fmt.Errorf("health: wal background sync: %w", *err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package lsm
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+func TestDB_GetProperty(t *testing.T) {
+	db, err := Open(t.TempDir(), Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	for _, k := range []string{"a", "b"} {
+		if err := db.Set(k, []byte("v")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := db.Delete("a"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	defer snap.Release()
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr error
+	}{
+		{name: PropNumEntriesActiveMemTable, want: "2"},
+		{name: PropIsWriteStalled, want: "0"},
+		{name: PropNumPendingCommits, want: "0"},
+		{name: PropIsOverMemoryBudget, want: "0"},
+		{name: PropNumSnapshots, want: "1"},
+		{name: PropOldestSnapshotSequence, want: "3"},
+		{name: PropLastSequence, want: "3"},
+		{name: PropNumWALFiles, want: "1"},
+		{name: PropNumColumnFamilies, want: "1"},
+		{name: "sdbf.no-such-property", wantErr: ErrUnknownProperty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.GetProperty(tt.name)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Fatalf("期望 %q %v, 实际 %q %v", tt.want, tt.wantErr, got, err)
+			}
+		})
+	}
+
+	// 大小类的属性与 Stats 一致
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("读取统计信息失败: %v", err)
+	}
+	for name, want := range map[string]int64{
+		PropCurSizeActiveMemTable: int64(stats.MemTableBytes),
+		PropEstimateLiveDataSize:  int64(stats.MemTableBytes),
+		PropTotalWALSize:          stats.WALBytes,
+	} {
+		if got, err := db.GetIntProperty(name); err != nil || got != want || got == 0 {
+			t.Fatalf("%s 期望 %d, 实际 %d %v", name, want, got, err)
+		}
+	}
+	if names := PropertyNames(); len(names) != len(properties) {
+		t.Fatalf("期望 %d 个属性, 实际 %v", len(properties), names)
+	}
+
+	db.Close()
+	if _, err := db.GetProperty(PropLastSequence); !errors.Is(err, ErrClosed) {
+		t.Fatalf("关闭后期望 ErrClosed, 实际 %v", err)
+	}
+}
+
+// failSyncFS 在 fail 为 true 时让所有文件的 Sync 失败
+type failSyncFS struct {
+	vfs.FS
+	fail *atomic.Bool
+}
+
+func (fs failSyncFS) Create(name string) (vfs.File, error) {
+	f, err := fs.FS.Create(name)
+	return failSyncFile{File: f, fail: fs.fail}, err
+}
+
+func (fs failSyncFS) OpenReadWrite(name string) (vfs.File, error) {
+	f, err := fs.FS.OpenReadWrite(name)
+	return failSyncFile{File: f, fail: fs.fail}, err
+}
+
+type failSyncFile struct {
+	vfs.File
+	fail *atomic.Bool
+}
+
+func (f failSyncFile) Sync() error {
+	if f.fail.Load() {
+		return errors.New("injected sync failure")
+	}
+	return f.File.Sync()
+}
+
+// 测试后台 fsync 失败时 Health 报错，恢复后重新变为健康
+func TestDB_Health(t *testing.T) {
+	fail := &atomic.Bool{}
+	db, err := Open(t.TempDir(), Options{
+		SyncMode:   SyncPeriodic,
+		SyncPeriod: time.Millisecond,
+		FS:         failSyncFS{FS: vfs.NewMemFS(), fail: fail},
+	})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.Health(); err != nil {
+		t.Fatalf("期望健康, 实际 %v", err)
+	}
+
+	waitHealth := func(healthy bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for (db.Health() == nil) != healthy {
+			if time.Now().After(deadline) {
+				t.Fatalf("等待 Health 变为 %v 超时: %v", healthy, db.Health())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	fail.Store(true)
+	waitHealth(false)
+	fail.Store(false)
+	waitHealth(true)
+
+	db.Close()
+	if err := db.Health(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("关闭后期望 ErrClosed, 实际 %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package lsm
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+)
+
+// DeleteRange 删除 [start, end) 区间（utils.CompareKey 定义的顺序）内的所有 key
+//
+// 只写入一条范围墓碑，代价与单个 Delete 相同，而不是为区间内的每个 key 写一个墓碑：
+// 读取时范围墓碑遮蔽区间内序列号比它小的条目，之后的写入不受影响。
+// 被遮蔽的条目仍占用 MemTable 的内存，落盘与合并实现之后在合并时清除。
+// start 不小于 end 时区间为空，不做任何事
+func (db *DB) DeleteRange(start, end string) error {
+	b := NewWriteBatch()
+	b.DeleteRange(start, end)
+	if err := db.Write(b); err != nil {
+		return fmt.Errorf("delete range [%s, %s): %w", start, end, err)
+	}
+	return nil
+}
+
+// DeleteRange 删除列族中 [start, end) 区间内的所有 key，见 DB.DeleteRange
+func (cf *ColumnFamily) DeleteRange(start, end string) error {
+	b := NewWriteBatch()
+	b.DeleteRangeCF(cf, start, end)
+	if err := cf.db.Write(b); err != nil {
+		return fmt.Errorf("cf %s: delete range [%s, %s): %w", cf.Name(), start, end, err)
+	}
+	return nil
+}
+
+// DeleteRange 在批次中追加一次范围删除，见 DB.DeleteRange
+func (b *WriteBatch) DeleteRange(start, end string) {
+	b.deleteRange("", start, end)
+}
+
+// DeleteRangeCF 在批次中追加一次对列族 cf 的范围删除
+func (b *WriteBatch) DeleteRangeCF(cf *ColumnFamily, start, end string) {
+	b.deleteRange(cf.name, start, end)
+}
+
+func (b *WriteBatch) deleteRange(cf, start, end string) {
+	if utils.CompareKey(start, end) >= 0 {
+		return
+	}
+	b.ops = append(b.ops, batchOp{cf: cf, key: start, rangeEnd: end, tombstone: true})
+}
+
+// rangeTombstones 一个列族的所有范围墓碑，按序列号升序排列
+//
+// 写入时复制：add 由持有 MemTable.mu 的写入者调用，读取无锁
+type rangeTombstones struct {
+	p atomic.Pointer[[]*sdbf.Entry]
+	// bytes 所有范围墓碑估算的内存占用
+	bytes atomic.Int64
+}
+
+func (r *rangeTombstones) load() []*sdbf.Entry {
+	if p := r.p.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// add 加入一个范围墓碑，调用方需持有 MemTable.mu
+//
+// 写入按序列号顺序到达，通常直接追加在末尾；从增量备份恢复时同一个文件中的
+// 范围墓碑按 key 排列，需要插入到对应的位置
+func (r *rangeTombstones) add(t *sdbf.Entry) {
+	old := r.load()
+	i, _ := slices.BinarySearchFunc(old, t.Version, func(e *sdbf.Entry, v int64) int { return cmp.Compare(e.Version, v) })
+	ts := slices.Insert(slices.Clip(old), i, t)
+	r.p.Store(&ts)
+	r.bytes.Add(utils.EntrySize(t) + int64(unsafe.Sizeof(t)))
+}
+
+// size 返回所有范围墓碑估算的内存占用
+func (r *rangeTombstones) size() int64 {
+	return r.bytes.Load()
+}
+
+// until 返回序列号不大于 maxVersion 的范围墓碑，按起始 key 排序
+func (r *rangeTombstones) until(maxVersion int64) []*sdbf.Entry {
+	var ts []*sdbf.Entry
+	for _, t := range r.load() {
+		if t.Version <= maxVersion {
+			ts = append(ts, t)
+		}
+	}
+	slices.SortStableFunc(ts, func(a, b *sdbf.Entry) int { return utils.CompareKey(a.Key, b.Key) })
+	return ts
+}
+
+// mask 条目 e 被序列号不大于 maxVersion 的范围墓碑删除时返回代表这次删除的墓碑，否则返回 e
+func (r *rangeTombstones) mask(e *sdbf.Entry, maxVersion int64) *sdbf.Entry {
+	ts := r.load()
+	if len(ts) == 0 {
+		return e
+	}
+	if t := covering(ts, e, maxVersion); t != nil {
+		return &sdbf.Entry{Key: e.Key, Tombstone: true, Version: t.Version, ColumnFamily: e.ColumnFamily}
+	}
+	return e
+}
+
+// filter 让 it 跳过被序列号不大于 maxVersion 的范围墓碑删除的条目，没有范围墓碑时直接返回 it
+func (r *rangeTombstones) filter(it Iterator, maxVersion int64) Iterator {
+	ts := r.load()
+	if len(ts) == 0 {
+		return it
+	}
+	return &rangeDelIterator{Iterator: it, tombstones: ts, maxVersion: maxVersion}
+}
+
+// covering 返回删除了 e 的最新的范围墓碑：序列号大于 e 且不大于 maxVersion，区间包含 e.Key
+func covering(ts []*sdbf.Entry, e *sdbf.Entry, maxVersion int64) *sdbf.Entry {
+	for i := len(ts) - 1; i >= 0; i-- {
+		t := ts[i]
+		if t.Version <= e.Version {
+			// 按序列号升序排列，之前的墓碑都比 e 旧
+			return nil
+		}
+		if t.Version <= maxVersion && utils.CompareKey(t.Key, e.Key) <= 0 && utils.CompareKey(e.Key, t.RangeEnd) < 0 {
+			return t
+		}
+	}
+	return nil
+}
+
+// rangeDelIterator 跳过被范围墓碑删除的条目
+//
+// 内层迭代器每个 key 只能返回一个条目（已经过合并），否则被删除的最新版本跳过之后
+// 会露出同 key 的旧版本
+type rangeDelIterator struct {
+	Iterator
+	tombstones []*sdbf.Entry
+	maxVersion int64
+}
+
+func (it *rangeDelIterator) Seek(target string) {
+	it.Iterator.Seek(target)
+	it.skipDeleted()
+}
+
+func (it *rangeDelIterator) Next() {
+	it.Iterator.Next()
+	it.skipDeleted()
+}
+
+func (it *rangeDelIterator) skipDeleted() {
+	for it.Iterator.Valid() && covering(it.tombstones, it.Iterator.Entry(), it.maxVersion) != nil {
+		it.Iterator.Next()
+	}
+}
@@ -0,0 +1,233 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// 测试范围删除遮蔽区间内的 key，不影响之后的写入与之前的快照，重新打开与备份后保持不变
+func TestDB_DeleteRange(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir)
+
+	for _, k := range []string{"a", "b", "b1", "c", "d"} {
+		if err := db.Set(k, []byte("old-"+k)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	defer snap.Release()
+
+	if err := db.DeleteRange("b", "d"); err != nil {
+		t.Fatalf("范围删除失败: %v", err)
+	}
+	// 范围删除之后的写入不受影响
+	if err := db.Set("c", []byte("new-c")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	// 空区间不做任何事
+	if err := db.DeleteRange("d", "a"); err != nil {
+		t.Fatalf("空区间范围删除失败: %v", err)
+	}
+
+	want := map[string]string{"a": "old-a", "c": "new-c", "d": "old-d"}
+	check := func(t *testing.T, db *DB) {
+		t.Helper()
+		for _, k := range []string{"a", "b", "b1", "c", "d"} {
+			v, err := db.Get(k)
+			w, ok := want[k]
+			switch {
+			case ok && (err != nil || string(v) != w):
+				t.Fatalf("key %s: 期望 %q, 实际 %q (%v)", k, w, v, err)
+			case !ok && !errors.Is(err, ErrNotFound):
+				t.Fatalf("key %s 应已被范围删除, 实际 %q (%v)", k, v, err)
+			}
+		}
+		entries, err := db.Scan("", "\xff")
+		if err != nil {
+			t.Fatalf("扫描失败: %v", err)
+		}
+		var keys []string
+		for _, e := range entries {
+			keys = append(keys, e.Key)
+		}
+		if !slices.Equal(keys, []string{"a", "c", "d"}) {
+			t.Fatalf("扫描结果不符: %v", keys)
+		}
+	}
+	check(t, db)
+
+	// 快照仍然看到范围删除之前的数据
+	for _, k := range []string{"b", "b1", "c"} {
+		if v, err := snap.Get(k); err != nil || string(v) != "old-"+k {
+			t.Fatalf("快照中 key %s: 期望 %q, 实际 %q (%v)", k, "old-"+k, v, err)
+		}
+	}
+	entries, err := snap.Scan("", "\xff")
+	if err != nil {
+		t.Fatalf("扫描快照失败: %v", err)
+	}
+	if len(entries) != 5 {
+		t.Fatalf("快照中应有 5 个 key, 实际 %d", len(entries))
+	}
+	snap.Release()
+
+	dst := filepath.Join(t.TempDir(), "backup")
+	if err := db.Backup(context.Background(), dst); err != nil {
+		t.Fatalf("备份失败: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	t.Run("重新打开", func(t *testing.T) {
+		db := openTestDB(t, dir)
+		defer db.Close()
+		check(t, db)
+	})
+	t.Run("备份", func(t *testing.T) {
+		db := openTestDB(t, dst)
+		defer db.Close()
+		check(t, db)
+	})
+}
+
+// 测试范围删除与列族、批次、增量备份、事务冲突检测的配合
+func TestDB_DeleteRange_Combined(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, db *DB)
+	}{
+		{
+			name: "列族之间相互隔离",
+			run: func(t *testing.T, db *DB) {
+				users, err := db.CF("users")
+				if err != nil {
+					t.Fatalf("获取列族失败: %v", err)
+				}
+				if err := db.Set("k", []byte("default")); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+				if err := users.Set("k", []byte("users")); err != nil {
+					t.Fatalf("写入列族失败: %v", err)
+				}
+				if err := users.DeleteRange("a", "z"); err != nil {
+					t.Fatalf("范围删除失败: %v", err)
+				}
+				if _, err := users.Get("k"); !errors.Is(err, ErrNotFound) {
+					t.Fatalf("列族中的 key 应已被删除, 实际 %v", err)
+				}
+				if v, err := db.Get("k"); err != nil || string(v) != "default" {
+					t.Fatalf("默认列族不应受影响, 实际 %q (%v)", v, err)
+				}
+			},
+		},
+		{
+			name: "批次中范围删除之后的写入可见",
+			run: func(t *testing.T, db *DB) {
+				if err := db.Set("k1", []byte("old")); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+				b := NewWriteBatch()
+				b.DeleteRange("k", "l")
+				b.Set("k2", []byte("new"))
+				if err := db.Write(b); err != nil {
+					t.Fatalf("批量写入失败: %v", err)
+				}
+				if _, err := db.Get("k1"); !errors.Is(err, ErrNotFound) {
+					t.Fatalf("k1 应已被删除, 实际 %v", err)
+				}
+				if v, err := db.Get("k2"); err != nil || string(v) != "new" {
+					t.Fatalf("k2: 期望 %q, 实际 %q (%v)", "new", v, err)
+				}
+			},
+		},
+		{
+			name: "事务读过的 key 被范围删除时冲突",
+			run: func(t *testing.T, db *DB) {
+				if err := db.Set("k", []byte("v")); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+				txn, err := db.Begin()
+				if err != nil {
+					t.Fatalf("开始事务失败: %v", err)
+				}
+				if _, err := txn.Get("k"); err != nil {
+					t.Fatalf("事务读取失败: %v", err)
+				}
+				if err := txn.Set("other", []byte("x")); err != nil {
+					t.Fatalf("事务写入失败: %v", err)
+				}
+				if err := db.DeleteRange("a", "z"); err != nil {
+					t.Fatalf("范围删除失败: %v", err)
+				}
+				if err := txn.Commit(); !errors.Is(err, ErrConflict) {
+					t.Fatalf("期望 %v, 实际 %v", ErrConflict, err)
+				}
+			},
+		},
+		{
+			name: "增量备份包含范围墓碑",
+			run: func(t *testing.T, db *DB) {
+				for _, k := range []string{"a", "b", "c"} {
+					if err := db.Set(k, []byte(k)); err != nil {
+						t.Fatalf("写入失败: %v", err)
+					}
+				}
+				root := t.TempDir()
+				full := filepath.Join(root, "full")
+				if err := db.Backup(context.Background(), full); err != nil {
+					t.Fatalf("全量备份失败: %v", err)
+				}
+				if err := db.DeleteRange("b", "c"); err != nil {
+					t.Fatalf("范围删除失败: %v", err)
+				}
+				if err := db.DeleteRange("a", "b"); err != nil {
+					t.Fatalf("范围删除失败: %v", err)
+				}
+				incr := filepath.Join(root, "incr")
+				if err := db.IncrementalBackup(context.Background(), incr, full); err != nil {
+					t.Fatalf("增量备份失败: %v", err)
+				}
+
+				dst := filepath.Join(root, "restored")
+				if _, err := RestoreBackup(context.Background(), db.opts.FS, dst, []string{full, incr}, RestoreOptions{}); err != nil {
+					t.Fatalf("恢复失败: %v", err)
+				}
+				restored := openTestDB(t, dst)
+				defer restored.Close()
+				entries, err := restored.Scan("", "\xff")
+				if err != nil {
+					t.Fatalf("扫描失败: %v", err)
+				}
+				if len(entries) != 1 || entries[0].Key != "c" {
+					t.Fatalf("恢复后应只剩 c, 实际 %v", entries)
+				}
+			},
+		},
+		{
+			name: "key 过长",
+			run: func(t *testing.T, db *DB) {
+				long := strings.Repeat("z", db.opts.MaxKeySize+1)
+				if err := db.DeleteRange("a", long); !errors.Is(err, ErrKeyTooLarge) {
+					t.Fatalf("期望 %v, 实际 %v", ErrKeyTooLarge, err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, t.TempDir())
+			defer db.Close()
+			tt.run(t, db)
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+)
+
+// errForeignSnapshot ReadOptions.Snapshot 不是由读取的数据库创建的
+var errForeignSnapshot = errors.New("snapshot belongs to another database")
+
+// ChecksumVerification 决定读取时是否校验条目的校验和，见 Options.EntryChecksums
+type ChecksumVerification int
+
+const (
+	// VerifyDefault 与不带选项的读取相同：Get 在启用 Options.EntryChecksums 时校验，Scan 不校验
+	VerifyDefault ChecksumVerification = iota
+	// VerifyAlways Get 与 Scan 都校验带有校验和的条目，不论当前是否启用 Options.EntryChecksums
+	VerifyAlways
+	// VerifyNever 不校验，用于读出已经损坏的值进行排查
+	VerifyNever
+)
+
+// ReadOptions 控制一次读取，零值与 Get、Scan 的行为相同
+//
+// 数据只存在于 MemTable 中，没有块缓存，因此没有控制是否填充缓存的选项
+type ReadOptions struct {
+	// Snapshot 不为 nil 时读取快照时刻的数据，与 Snapshot.Get、Snapshot.Scan 相同；
+	// 快照必须由同一个数据库创建且尚未释放，已释放时返回 ErrSnapshotReleased
+	Snapshot *Snapshot
+	// VerifyChecksums 是否校验读取到的条目
+	VerifyChecksums ChecksumVerification
+	// Filter 不为 nil 时 Scan 只返回 Filter 返回 true 的条目。Filter 在遍历时对每个存活的条目调用，
+	// 被拒绝的条目不会进入结果；value 与 MemTable 共享，Filter 不能修改或保留它。Get 忽略 Filter
+	Filter func(key string, value []byte) bool
+}
+
+// GetWithOptions 按 ro 读取 key 对应的值
+func (db *DB) GetWithOptions(key string, ro ReadOptions) ([]byte, error) {
+	t := db.startOp("get", key, "")
+	defer t.done()
+
+	entry, err := db.readEntry(db.memTable.def, key, ro)
+	t.stage("memtable")
+	if err != nil {
+		return nil, err
+	}
+	return entry.Value, nil
+}
+
+// ScanWithOptions 按 ro 返回 [start, end] 区间内所有未被删除的条目，按 key 有序
+func (db *DB) ScanWithOptions(start, end string, ro ReadOptions) ([]*sdbf.Entry, error) {
+	t := db.startOp("scan", start, end)
+	defer t.done()
+
+	return db.scanFamily(db.memTable.def, start, end, ro, &t)
+}
+
+// GetWithOptions 按 ro 读取列族中 key 对应的值，见 DB.GetWithOptions
+func (cf *ColumnFamily) GetWithOptions(key string, ro ReadOptions) ([]byte, error) {
+	entry, err := cf.db.readEntry(cf.f, key, ro)
+	if err != nil {
+		return nil, err
+	}
+	return entry.Value, nil
+}
+
+// ScanWithOptions 按 ro 返回列族中 [start, end] 区间内所有未被删除的条目，见 DB.ScanWithOptions
+func (cf *ColumnFamily) ScanWithOptions(start, end string, ro ReadOptions) ([]*sdbf.Entry, error) {
+	return cf.db.scanFamily(cf.f, start, end, ro, &opTimer{})
+}
+
+// readSeq 返回 ro 读取的序列号，没有指定快照时为 math.MaxInt64，调用方持有 db.mu 的读锁
+func (db *DB) readSeq(ro ReadOptions) (int64, error) {
+	if db.closed {
+		return 0, ErrClosed
+	}
+	if ro.Snapshot == nil {
+		return math.MaxInt64, nil
+	}
+	if ro.Snapshot.db != db {
+		return 0, errForeignSnapshot
+	}
+	if ro.Snapshot.released.Load() {
+		return 0, ErrSnapshotReleased
+	}
+	return ro.Snapshot.seq, nil
+}
+
+// readEntry 按 ro 读取 f 中 key 的存活条目并校验
+func (db *DB) readEntry(f *memFamily, key string, ro ReadOptions) (*sdbf.Entry, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	seq, err := db.readSeq(ro)
+	if err != nil {
+		return nil, err
+	}
+	var entry *sdbf.Entry
+	var ok bool
+	if seq == math.MaxInt64 {
+		entry, ok = f.get(key)
+	} else {
+		entry, ok = f.getVersion(key, seq)
+	}
+	if !ok || !isLive(entry, db.now().UnixNano()) {
+		return nil, ErrNotFound
+	}
+	verify := ro.VerifyChecksums == VerifyAlways || (ro.VerifyChecksums == VerifyDefault && db.opts.EntryChecksums)
+	if err := db.checkEntry(entry, verify); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// scanFamily 按 ro 收集 f 中 [start, end] 区间内的存活条目，各阶段耗时记入 t
+func (db *DB) scanFamily(f *memFamily, start, end string, ro ReadOptions, t *opTimer) ([]*sdbf.Entry, error) {
+	db.mu.RLock()
+	seq, err := db.readSeq(ro)
+	var it Iterator
+	if err == nil {
+		if ro.Snapshot == nil {
+			// 读取最新数据时登记一个临时快照，遍历期间对它可见的版本不会被覆盖或回收
+			seq = db.memTable.acquireSnapshot(db.snapshots)
+			defer db.snapshots.release(seq)
+		}
+		it = newLiveIterator(f.iterator(seq), db.now())
+	}
+	db.mu.RUnlock()
+	t.stage("iterator")
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*sdbf.Entry
+	for it.Seek(start); it.Valid() && utils.CompareKey(it.Key(), end) <= 0; it.Next() {
+		e := it.Entry()
+		if err := db.checkEntry(e, ro.VerifyChecksums == VerifyAlways); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		if ro.Filter != nil && !ro.Filter(e.Key, e.Value) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	t.stage("iterate")
+	return entries, nil
+}
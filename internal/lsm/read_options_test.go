@@ -0,0 +1,152 @@
+package lsm
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// 测试 ReadOptions：快照读取旧版本，VerifyChecksums 控制 Get 与 Scan 是否校验
+func TestDB_ReadOptions(t *testing.T) {
+	db, err := Open(t.TempDir(), Options{SyncMode: NoSync, EntryChecksums: true})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	old := []byte("old")
+	if err := db.Set("k", old); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	defer snap.Release()
+	cur := []byte("new")
+	if err := db.Set("k", cur); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	// Set 保存的是调用方的切片，修改它相当于 MemTable 中的数据被破坏
+	cur[0] ^= 0xff
+	defer func() { cur[0] ^= 0xff }()
+
+	tests := []struct {
+		name     string
+		ro       ReadOptions
+		want     string
+		wantErr  error
+		scanErr  error
+		scanWant string
+	}{
+		{name: "默认", ro: ReadOptions{}, wantErr: ErrChecksumMismatch, scanWant: "\x91ew"},
+		{name: "总是校验", ro: ReadOptions{VerifyChecksums: VerifyAlways}, wantErr: ErrChecksumMismatch, scanErr: ErrChecksumMismatch},
+		{name: "不校验", ro: ReadOptions{VerifyChecksums: VerifyNever}, want: "\x91ew", scanWant: "\x91ew"},
+		{name: "快照", ro: ReadOptions{Snapshot: snap, VerifyChecksums: VerifyAlways}, want: "old", scanWant: "old"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := db.GetWithOptions("k", tt.ro)
+			if !errors.Is(err, tt.wantErr) || string(got) != tt.want {
+				t.Fatalf("Get 期望 %q %v, 实际 %q %v", tt.want, tt.wantErr, got, err)
+			}
+			entries, err := db.ScanWithOptions("a", "z", tt.ro)
+			if !errors.Is(err, tt.scanErr) {
+				t.Fatalf("Scan 期望错误 %v, 实际 %v", tt.scanErr, err)
+			}
+			if err == nil && (len(entries) != 1 || string(entries[0].Value) != tt.scanWant) {
+				t.Fatalf("Scan 期望 %q, 实际 %v", tt.scanWant, entries)
+			}
+		})
+	}
+}
+
+// 测试列族的 ReadOptions 与快照的列族隔离，以及其他数据库的快照被拒绝
+func TestColumnFamily_ReadOptions(t *testing.T) {
+	db, err := Open(t.TempDir(), Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	cf, err := db.CF("meta")
+	if err != nil {
+		t.Fatalf("创建列族失败: %v", err)
+	}
+	if err := cf.Set("k", []byte("v1")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	defer snap.Release()
+	if err := cf.Delete("k"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+
+	if _, err := cf.GetWithOptions("k", ReadOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("期望 ErrNotFound, 实际 %v", err)
+	}
+	if got, err := cf.GetWithOptions("k", ReadOptions{Snapshot: snap}); err != nil || string(got) != "v1" {
+		t.Fatalf("快照读取失败: %q %v", got, err)
+	}
+	if entries, err := cf.ScanWithOptions("", "z", ReadOptions{Snapshot: snap}); err != nil || len(entries) != 1 {
+		t.Fatalf("快照扫描失败: %v %v", entries, err)
+	}
+	if _, err := db.GetWithOptions("k", ReadOptions{Snapshot: snap}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("默认列族不应读到其他列族的数据: %v", err)
+	}
+
+	other, err := Open(t.TempDir(), Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer other.Close()
+	if _, err := other.GetWithOptions("k", ReadOptions{Snapshot: snap}); !errors.Is(err, errForeignSnapshot) {
+		t.Fatalf("期望 errForeignSnapshot, 实际 %v", err)
+	}
+}
+
+// 测试 ReadOptions.Filter 在扫描时过滤条目，Get 不受影响
+func TestDB_ScanFilter(t *testing.T) {
+	db, err := Open(t.TempDir(), Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+	for key, value := range map[string]string{"a1": "red", "a2": "blue", "b1": "red", "b2": "green"} {
+		if err := db.Set(key, []byte(value)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter func(key string, value []byte) bool
+		want   []string
+	}{
+		{name: "不过滤", want: []string{"a1", "a2", "b1", "b2"}},
+		{name: "按 value", filter: func(_ string, v []byte) bool { return string(v) == "red" }, want: []string{"a1", "b1"}},
+		{name: "按 key", filter: func(k string, _ []byte) bool { return strings.HasSuffix(k, "2") }, want: []string{"a2", "b2"}},
+		{name: "全部拒绝", filter: func(string, []byte) bool { return false }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := db.ScanWithOptions("a", "z", ReadOptions{Filter: tt.filter})
+			if err != nil {
+				t.Fatalf("扫描失败: %v", err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Key)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("期望 %v, 实际 %v", tt.want, got)
+			}
+		})
+	}
+	if got, err := db.GetWithOptions("a2", ReadOptions{Filter: func(string, []byte) bool { return false }}); err != nil || string(got) != "blue" {
+		t.Fatalf("Get 不应受 Filter 影响: %q %v", got, err)
+	}
+}
@@ -0,0 +1,31 @@
+package lsm
+
+import "fmt"
+
+// RecoveryMode 决定打开数据库回放 WAL 时如何处理损坏的记录
+type RecoveryMode int
+
+const (
+	// TolerateTailCorruption 在段中第一条损坏的记录处停止回放该段，截断之后的内容并继续下一个段。
+	// 崩溃时写了一半的尾部记录只会出现在活跃段末尾，这是崩溃后最常见的情况
+	TolerateTailCorruption RecoveryMode = iota
+	// AbsoluteConsistency 遇到任何损坏（包括写了一半的尾部记录）都让 Open 失败，不修改 WAL，
+	// 返回的错误包装了 *WALCorruptionError，适合要求不丢失任何已写入数据、由运维人工介入的场景
+	AbsoluteConsistency
+	// SkipCorruptRecords 跳过校验或解析失败的记录并记录日志，继续回放之后的记录，尽可能多地恢复数据；
+	// 头部损坏或不完整的记录之后无法定位下一条记录，仍会像 TolerateTailCorruption 一样截断
+	SkipCorruptRecords
+)
+
+func (m RecoveryMode) String() string {
+	switch m {
+	case TolerateTailCorruption:
+		return "TolerateTailCorruption"
+	case AbsoluteConsistency:
+		return "AbsoluteConsistency"
+	case SkipCorruptRecords:
+		return "SkipCorruptRecords"
+	default:
+		return fmt.Sprintf("RecoveryMode(%d)", int(m))
+	}
+}
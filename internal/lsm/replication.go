@@ -0,0 +1,227 @@
+package lsm
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+)
+
+var (
+	// ErrWALPositionGone 读取位置所在的 WAL 段已被删除，或位置超出了段的末尾
+	// （例如 leader 重启时截断了未持久化的尾部），需要通过 WriteChangesSince 重新追赶
+	ErrWALPositionGone = errors.New("wal position is no longer available")
+	// ErrSequenceOutOfOrder 复制来的条目的序列号不大于本地已分配的序列号
+	ErrSequenceOutOfOrder = errors.New("replicated sequence out of order")
+)
+
+// WALPosition 是 WAL 中的一个读取位置：段序号与段内偏移，偏移总是位于记录的边界上
+type WALPosition struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+// String 返回 "段序号/偏移" 形式的位置，可以由 ParseWALPosition 解析
+func (p WALPosition) String() string {
+	return strconv.FormatUint(p.Segment, 10) + "/" + strconv.FormatInt(p.Offset, 10)
+}
+
+// ParseWALPosition 解析 WALPosition.String 的输出
+func ParseWALPosition(s string) (WALPosition, error) {
+	seg, off, ok := strings.Cut(s, "/")
+	if !ok {
+		return WALPosition{}, fmt.Errorf("invalid wal position %q", s)
+	}
+	segment, err := strconv.ParseUint(seg, 10, 64)
+	if err != nil {
+		return WALPosition{}, fmt.Errorf("invalid wal position %q: %w", s, err)
+	}
+	offset, err := strconv.ParseInt(off, 10, 64)
+	if err != nil || offset < 0 {
+		return WALPosition{}, fmt.Errorf("invalid wal position %q", s)
+	}
+	return WALPosition{Segment: segment, Offset: offset}, nil
+}
+
+// ReadWAL 把 pos 之后已写入 WAL 的完整记录原样（段文件格式）写入 w，用于复制到 follower
+//
+// 每次只读取一个段，写出约 maxBytes 字节（至少一条记录）后停止，返回下一次读取的位置；
+// 没有新记录时返回的位置不变。读到已封存段的末尾时返回下一个段的起始位置。
+// 读取位置不可用时返回 ErrWALPositionGone。
+//
+// 注意：SyncPeriodic / NoSync 模式下返回的记录可能还没有 fsync，
+// leader 崩溃后这些记录可能丢失，而 follower 已经应用了它们
+func (db *DB) ReadWAL(pos WALPosition, maxBytes int64, w io.Writer) (WALPosition, error) {
+	if db.wal == nil {
+		return pos, fmt.Errorf("read wal: %w", ErrInMemory)
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return pos, ErrClosed
+	}
+	next, err := db.wal.readRaw(pos, maxBytes, w)
+	if err != nil {
+		return pos, fmt.Errorf("read wal at %s: %w", pos, err)
+	}
+	return next, nil
+}
+
+// readRaw 实现 DB.ReadWAL
+//
+// 活跃段只读到读取时的大小：WAL.size 在记录完整写入后才会更新，之前的部分都是完整的记录
+func (m *WALManager) readRaw(pos WALPosition, maxBytes int64, w io.Writer) (WALPosition, error) {
+	m.mu.RLock()
+	first, activeID := m.segments[0], m.segments[len(m.segments)-1]
+	end := int64(-1)
+	if pos.Segment == activeID {
+		end = m.active.Size()
+	}
+	m.mu.RUnlock()
+
+	if pos.Segment < first || pos.Segment > activeID {
+		return pos, ErrWALPositionGone
+	}
+
+	path := filepath.Join(m.dir, segmentName(pos.Segment))
+	fd, err := m.fs.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return pos, ErrWALPositionGone
+	}
+	if err != nil {
+		return pos, fmt.Errorf("open wal %s: %w", path, err)
+	}
+	defer fd.Close()
+
+	sealed := end < 0
+	if sealed {
+		stat, err := fd.Stat()
+		if err != nil {
+			return pos, fmt.Errorf("stat wal %s: %w", path, err)
+		}
+		end = stat.Size()
+	}
+	switch {
+	case pos.Offset > end:
+		return pos, ErrWALPositionGone
+	case pos.Offset == end && sealed:
+		return WALPosition{Segment: pos.Segment + 1}, nil
+	case pos.Offset == end:
+		return pos, nil
+	}
+
+	if _, err := fd.Seek(pos.Offset, io.SeekStart); err != nil {
+		return pos, fmt.Errorf("seek wal %s: %w", path, err)
+	}
+	r := bufio.NewReader(io.LimitReader(fd, end-pos.Offset))
+	offset := pos.Offset
+	for offset < end && offset-pos.Offset < max(maxBytes, 1) {
+		// 只解析头部得到记录长度，校验由接收方在解码时完成
+		var header [walHeaderSize]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return pos, fmt.Errorf("%w: read record header at %d: %w", errCorruptedWAL, offset, err)
+		}
+		if header == [walHeaderSize]byte{} {
+			// 崩溃在截断之前的封存段，之后是预分配的空间
+			end = offset
+			break
+		}
+		size := walHeaderSize + int64(binary.LittleEndian.Uint64(header[:8])&walLengthMask)
+		if offset+size > end {
+			return pos, fmt.Errorf("%w: record at %d exceeds segment end %d", errCorruptedWAL, offset, end)
+		}
+		if _, err := w.Write(header[:]); err != nil {
+			return pos, err
+		}
+		if _, err := io.CopyN(w, r, size-walHeaderSize); err != nil {
+			return pos, err
+		}
+		offset += size
+	}
+
+	if offset == end && sealed {
+		return WALPosition{Segment: pos.Segment + 1}, nil
+	}
+	return WALPosition{Segment: pos.Segment, Offset: offset}, nil
+}
+
+// WriteChangesSince 把序列号大于 since 的修改（每个 key 的最新条目，包含墓碑与已过期的条目）
+// 按序列号升序、以段文件格式写入 w，返回之后通过 ReadWAL 继续追赶的位置
+//
+// 用于 follower 首次同步或落后太多（需要的 WAL 段已被删除）时追赶：与逐条回放 WAL 相比，
+// 只传输每个 key 的最新状态。返回位置之后、序列号不大于写出的最大序列号的记录
+// 需要由调用方跳过。since 大于本库的最新序列号时返回 ErrSequenceOutOfOrder
+func (db *DB) WriteChangesSince(w io.Writer, since int64) (WALPosition, error) {
+	if db.wal == nil {
+		return WALPosition{}, fmt.Errorf("write changes: %w", ErrInMemory)
+	}
+	// 在获取快照之前确定追赶位置：快照之后的写入一定位于该段或之后的段中
+	start := WALPosition{Segment: db.wal.Segments()[0]}
+
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		return WALPosition{}, fmt.Errorf("write changes: %w", err)
+	}
+	defer snap.Release()
+	if since > snap.Seq() {
+		return WALPosition{}, fmt.Errorf("write changes: %w: since %d is after the last seq %d",
+			ErrSequenceOutOfOrder, since, snap.Seq())
+	}
+
+	it := &sinceIterator{
+		Iterator:   db.memTable.familiesIterator(snap.Seq()),
+		minVersion: since + 1,
+	}
+	var entries []*sdbf.Entry
+	for it.Seek(""); it.Valid(); it.Next() {
+		entries = append(entries, it.Entry())
+	}
+	slices.SortFunc(entries, func(a, b *sdbf.Entry) int { return cmp.Compare(a.Version, b.Version) })
+
+	buf := utils.Pool.Get()
+	defer utils.Pool.Put(buf)
+	for batch := range slices.Chunk(entries, backupBatchSize) {
+		buf.Reset()
+		if err := appendBatchFrame(buf, batch, nil, nil, WALMaxRecordSizeLimit); err != nil {
+			return WALPosition{}, fmt.Errorf("write changes: %w", err)
+		}
+		if _, err := buf.WriteTo(w); err != nil {
+			return WALPosition{}, fmt.Errorf("write changes: %w", err)
+		}
+	}
+	return start, nil
+}
+
+// ApplyReplicated 原样写入从 leader 复制来的一条 WAL 记录中的条目，保留它们的序列号，
+// 条目与本地写入一样经过 WAL 与组提交，并作为一个整体原子地可见
+//
+// 序列号必须严格递增且大于本库已分配的序列号，否则返回 ErrSequenceOutOfOrder。
+// 因此 follower 上不应再有本地写入，否则本地分配的序列号会与复制来的序列号冲突
+func (db *DB) ApplyReplicated(entries []*sdbf.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	if err := db.memTable.commitRequest(&commitRequest{entries: entries, replicated: true}); err != nil {
+		return fmt.Errorf("apply replicated: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+func TestParseWALPosition(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    WALPosition
+		wantErr bool
+	}{
+		{in: "3/1024", want: WALPosition{Segment: 3, Offset: 1024}},
+		{in: "0/0", want: WALPosition{}},
+		{in: "3", wantErr: true},
+		{in: "a/1", wantErr: true},
+		{in: "1/-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseWALPosition(tt.in)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Fatalf("期望 %v (err %v), 实际 %v %v", tt.want, tt.wantErr, got, err)
+			}
+			if err == nil && got.String() != tt.in {
+				t.Fatalf("String 期望 %s, 实际 %s", tt.in, got.String())
+			}
+		})
+	}
+}
+
+// readAllWAL 从 pos 开始循环调用 ReadWAL 直到没有新记录，返回读到的条目与最终位置
+func readAllWAL(t *testing.T, db *DB, pos WALPosition, maxBytes int64) ([]*sdbf.Entry, WALPosition) {
+	t.Helper()
+	var entries []*sdbf.Entry
+	for {
+		var buf bytes.Buffer
+		next, err := db.ReadWAL(pos, maxBytes, &buf)
+		if err != nil {
+			t.Fatalf("读取 WAL 失败: %v", err)
+		}
+		err = DecodeWAL(&buf, nil, func(rec WALRecord) error {
+			entries = append(entries, rec.Entries...)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("解码失败: %v", err)
+		}
+		if next == pos {
+			return entries, pos
+		}
+		pos = next
+	}
+}
+
+func TestDB_ReadWAL(t *testing.T) {
+	opts := DefaultOptions()
+	opts.WALSegmentSize = 128
+	db, err := Open(t.TempDir(), opts)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	for i := range 20 {
+		if err := db.Set(fmt.Sprintf("key%02d", i), []byte("v")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if len(db.wal.Segments()) < 3 {
+		t.Fatalf("期望写入跨越多个段, 实际 %v", db.wal.Segments())
+	}
+
+	for n, maxBytes := range []int64{0, 100, 1 << 20} {
+		t.Run(fmt.Sprint("maxBytes=", maxBytes), func(t *testing.T) {
+			// 之前的子测试各追加了一条写入
+			entries, end := readAllWAL(t, db, WALPosition{Segment: 1}, maxBytes)
+			if len(entries) != 20+n {
+				t.Fatalf("期望 %d 条记录, 实际 %d", 20+n, len(entries))
+			}
+			for i, e := range entries {
+				if e.Version != int64(i+1) {
+					t.Fatalf("第 %d 条记录的序列号期望 %d, 实际 %d", i, i+1, e.Version)
+				}
+			}
+
+			// 从结束位置继续只读到之后的写入
+			if err := db.Set(fmt.Sprint("more", maxBytes), nil); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+			more, _ := readAllWAL(t, db, end, maxBytes)
+			if len(more) != 1 || more[0].Key != fmt.Sprint("more", maxBytes) {
+				t.Fatalf("期望只读到新的写入, 实际 %v", more)
+			}
+		})
+	}
+
+	// 段被删除或位置超出段末尾时不可用
+	if err := db.wal.RemoveSegmentsBefore(2); err != nil {
+		t.Fatalf("删除段失败: %v", err)
+	}
+	for _, pos := range []WALPosition{{Segment: 1}, {Segment: 2, Offset: 1 << 20}, {Segment: 1000}} {
+		if _, err := db.ReadWAL(pos, 0, &bytes.Buffer{}); !errors.Is(err, ErrWALPositionGone) {
+			t.Fatalf("位置 %s 期望 %v, 实际 %v", pos, ErrWALPositionGone, err)
+		}
+	}
+}
+
+func TestDB_ApplyReplicated(t *testing.T) {
+	leader := openTestDB(t, t.TempDir())
+	defer leader.Close()
+	for _, k := range []string{"a", "b", "c"} {
+		if err := leader.Set(k, []byte(k)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := leader.Delete("b"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+
+	dir := t.TempDir()
+	follower := openTestDB(t, dir)
+	var buf bytes.Buffer
+	if _, err := leader.WriteChangesSince(&buf, 0); err != nil {
+		t.Fatalf("读取修改失败: %v", err)
+	}
+	err := DecodeWAL(&buf, nil, func(rec WALRecord) error { return follower.ApplyReplicated(rec.Entries) })
+	if err != nil {
+		t.Fatalf("应用失败: %v", err)
+	}
+
+	// 序列号不大于已应用的序列号时拒绝
+	if err := follower.ApplyReplicated([]*sdbf.Entry{{Key: "x", Version: 4}}); !errors.Is(err, ErrSequenceOutOfOrder) {
+		t.Fatalf("期望 %v, 实际 %v", ErrSequenceOutOfOrder, err)
+	}
+	if err := follower.ApplyReplicated([]*sdbf.Entry{{Key: "x", Version: 6}, {Key: "y", Version: 5}}); !errors.Is(err, ErrSequenceOutOfOrder) {
+		t.Fatalf("期望 %v, 实际 %v", ErrSequenceOutOfOrder, err)
+	}
+	if err := follower.ApplyReplicated([]*sdbf.Entry{{Key: "d", Value: []byte("d"), Version: 10}}); err != nil {
+		t.Fatalf("应用失败: %v", err)
+	}
+	// since 超过本库的最新序列号
+	if _, err := leader.WriteChangesSince(&buf, 10); !errors.Is(err, ErrSequenceOutOfOrder) {
+		t.Fatalf("期望 %v, 实际 %v", ErrSequenceOutOfOrder, err)
+	}
+
+	// 复制来的条目保留序列号，重启之后仍然可见
+	follower.Close()
+	follower = openTestDB(t, dir)
+	defer follower.Close()
+	want := map[string]string{"a": "a", "c": "c", "d": "d"}
+	if got := dumpDB(t, follower); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("期望 %v, 实际 %v", want, got)
+	}
+	stats, err := follower.Stats()
+	if err != nil || stats.LastSequence != 10 {
+		t.Fatalf("序列号期望 10, 实际 %d %v", stats.LastSequence, err)
+	}
+}
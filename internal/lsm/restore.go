@@ -0,0 +1,253 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+// ErrRestoreTarget 恢复目标不在备份链与 WAL 归档覆盖的范围内
+var ErrRestoreTarget = errors.New("restore target not covered by backups and wal")
+
+// RestoreOptions 控制 RestoreBackup 恢复到哪个时间点
+type RestoreOptions struct {
+	// WALDir 备份链之后继续回放的 WAL 段目录，通常是数据库 wal 目录的归档副本；
+	// 为空时只恢复备份链
+	WALDir string
+	// TargetSeq 恢复到的序列号（包含），0 表示恢复所有可用的修改
+	TargetSeq int64
+	// EncryptionKeys 解密加密的备份与 WAL 归档，并加密恢复出的 WAL 段；为 nil 时只能读取未加密的数据，
+	// 恢复出的段也不加密。打开恢复出的数据库时应使用同样的 Options.EncryptionKeys
+	EncryptionKeys KeyProvider
+}
+
+// RestoreBackup 在 fsys 的 dst 目录中重建数据库：依次应用备份链 chain（一个全量备份
+// 及基于它的增量备份，按生成顺序排列），再回放 opts.WALDir 中序列号更大的 WAL 记录，
+// 直到 opts.TargetSeq。返回恢复到的序列号，dst 之后可以直接用 Open 打开
+//
+// ID 大于 TargetSeq 的增量备份会被忽略；WAL 记录按原子单元回放，批量写入要么整体恢复，
+// 要么整体不恢复，TargetSeq 落在批量写入中间时恢复到该批量之前。条目没有记录写入时间，因此只支持按序列号恢复，需要按时间恢复时可以根据
+// BackupInfo.CreatedAt 选择备份链的前缀。dst 的要求同 Backup，失败时删除已写出的文件
+func RestoreBackup(ctx context.Context, fsys vfs.FS, dst string, chain []string, opts RestoreOptions) (int64, error) {
+	infos, err := readBackupChain(fsys, chain)
+	if err != nil {
+		return 0, fmt.Errorf("restore %s: %w", dst, err)
+	}
+	if opts.TargetSeq > 0 {
+		if opts.TargetSeq < infos[0].ID {
+			return 0, fmt.Errorf("restore %s: %w: target seq %d is before the full backup (id %d)",
+				dst, ErrRestoreTarget, opts.TargetSeq, infos[0].ID)
+		}
+		for i, info := range infos {
+			if info.ID > opts.TargetSeq {
+				chain, infos = chain[:i], infos[:i]
+				break
+			}
+		}
+	}
+
+	c, err := newWALCipher(opts.EncryptionKeys)
+	if err != nil {
+		return 0, fmt.Errorf("restore %s: %w", dst, err)
+	}
+	dstExisted, err := checkEmptyDir(fsys, dst)
+	if err != nil {
+		return 0, fmt.Errorf("restore %s: %w", dst, err)
+	}
+	walDir := filepath.Join(dst, walDirName)
+	if err := fsys.MkdirAll(walDir, 0755); err != nil {
+		return 0, fmt.Errorf("restore %s: create wal dir %s: %w", dst, walDir, err)
+	}
+
+	r := &restorer{ctx: ctx, fsys: fsys, walDir: walDir, target: opts.TargetSeq, cipher: c}
+	lastSeq, err := r.run(chain, infos, opts.WALDir)
+	if err == nil && opts.TargetSeq > 0 && !r.reached && lastSeq < opts.TargetSeq {
+		err = fmt.Errorf("%w: target seq %d is after the last available seq %d", ErrRestoreTarget, opts.TargetSeq, lastSeq)
+	}
+	if err != nil {
+		cleanup := r.written
+		cleanup = append(cleanup, walDir)
+		if !dstExisted {
+			cleanup = append(cleanup, dst)
+		}
+		for _, p := range cleanup {
+			if rerr := fsys.Remove(p); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) {
+				slog.Warn("remove incomplete restore", "path", p, "err", rerr)
+			}
+		}
+		return 0, fmt.Errorf("restore %s: %w", dst, err)
+	}
+
+	slog.Info("db restore finished", "dst", dst, "backups", len(chain), "seq", lastSeq)
+	return lastSeq, nil
+}
+
+// readBackupChain 读取并校验备份链：第一个是全量备份，之后每个增量备份都基于前一个
+func readBackupChain(fsys vfs.FS, chain []string) ([]BackupInfo, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("%w: empty backup chain", ErrInvalidBackup)
+	}
+
+	infos := make([]BackupInfo, len(chain))
+	for i, dir := range chain {
+		info, err := ReadBackupInfo(fsys, dir)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case i == 0 && info.Incremental:
+			return nil, fmt.Errorf("%w: %s is incremental, the chain must start with a full backup", ErrInvalidBackup, dir)
+		case i > 0 && (!info.Incremental || info.ParentID != infos[i-1].ID):
+			return nil, fmt.Errorf("%w: %s (parent %d) does not follow %s (id %d)",
+				ErrInvalidBackup, dir, info.ParentID, chain[i-1], infos[i-1].ID)
+		}
+		infos[i] = info
+	}
+	return infos, nil
+}
+
+// restorer 把备份链与 WAL 归档依次写成目标目录下连续编号的 WAL 段
+type restorer struct {
+	ctx    context.Context
+	fsys   vfs.FS
+	walDir string
+	target int64
+	// cipher 读取与写出的段使用的加密，为 nil 时不加密
+	cipher *walCipher
+
+	// reached 回放遇到了序列号超过目标的记录，即目标之前的修改已全部恢复
+	reached bool
+	// written 已写出的段文件，失败时清理
+	written []string
+}
+
+func (r *restorer) run(chain []string, infos []BackupInfo, archiveDir string) (int64, error) {
+	for i, dir := range chain {
+		src := filepath.Join(dir, walDirName, segmentName(1))
+		err := r.writeSegment(uint64(i+1), func(emit func([]*sdbf.Entry) error) error {
+			err := inspectWAL(r.fsys, src, r.cipher, func(rec WALRecord) error { return emit(rec.Entries) })
+			var corruption *WALCorruptionError
+			if errors.As(err, &corruption) {
+				return fmt.Errorf("%w: %s: %w", ErrInvalidBackup, src, err)
+			}
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	lastSeq := infos[len(infos)-1].ID
+	if archiveDir == "" {
+		return lastSeq, nil
+	}
+	err := r.writeSegment(uint64(len(chain)+1), func(emit func([]*sdbf.Entry) error) error {
+		var err error
+		lastSeq, err = r.replayArchive(archiveDir, lastSeq, emit)
+		return err
+	})
+	return lastSeq, err
+}
+
+// replayArchive 按段序号回放 dir 中序列号大于 since 且不超过目标的记录，返回回放到的序列号
+//
+// 回放的记录必须从 since+1 开始连续：归档缺段时无法恢复中间的修改，返回 ErrRestoreTarget。
+// 只有最后一个段允许有损坏的尾部（归档时正在写入的活跃段）
+func (r *restorer) replayArchive(dir string, since int64, emit func([]*sdbf.Entry) error) (int64, error) {
+	ids, err := listSegments(r.fsys, dir)
+	if err != nil {
+		return 0, err
+	}
+
+	errTargetReached := errors.New("target reached")
+	lastSeq := since
+	for i, id := range ids {
+		path := filepath.Join(dir, segmentName(id))
+		err := inspectWAL(r.fsys, path, r.cipher, func(rec WALRecord) error {
+			first, last := rec.Entries[0].Version, rec.Entries[len(rec.Entries)-1].Version
+			if last <= lastSeq {
+				return nil
+			}
+			if r.target > 0 && last > r.target {
+				return errTargetReached
+			}
+			if first != lastSeq+1 {
+				return fmt.Errorf("%w: wal archive jumps from seq %d to %d", ErrRestoreTarget, lastSeq, first)
+			}
+			lastSeq = last
+			return emit(rec.Entries)
+		})
+		var corruption *WALCorruptionError
+		switch {
+		case errors.Is(err, errTargetReached):
+			r.reached = true
+			return lastSeq, nil
+		case errors.As(err, &corruption) && i == len(ids)-1:
+			slog.Warn("wal archive ends with a corrupted record, stop replaying", "path", path, "offset", corruption.Offset)
+		case err != nil:
+			return 0, err
+		}
+	}
+	return lastSeq, nil
+}
+
+// writeSegment 把 read 产生的记录写入目标目录中序号为 id 的段，没有任何记录时不创建段文件
+func (r *restorer) writeSegment(id uint64, read func(emit func([]*sdbf.Entry) error) error) error {
+	path := filepath.Join(r.walDir, segmentName(id))
+	var (
+		w       *WAL
+		pending [][]*sdbf.Entry
+		n       int
+	)
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		if err := r.ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := w.WriteBatch(pending...); err != nil {
+			return fmt.Errorf("write restored wal: %w", err)
+		}
+		pending, n = pending[:0], 0
+		return nil
+	}
+
+	wrote := false
+	err := writeFileAtomic(r.fsys, path, func(fd vfs.File) error {
+		w = NewWAL(fd, r.walDir, path, walVersion)
+		w.syncMode = NoSync
+		w.cipher = r.cipher
+		err := read(func(entries []*sdbf.Entry) error {
+			wrote = true
+			pending = append(pending, entries)
+			n += len(entries)
+			if n >= backupBatchSize {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return flush()
+	})
+	if err != nil {
+		return err
+	}
+	if !wrote {
+		// 不保留空段，恢复出的数据库打开时会自行创建活跃段
+		if err := r.fsys.Remove(path); err != nil {
+			return fmt.Errorf("remove empty segment %s: %w", path, err)
+		}
+		return nil
+	}
+	r.written = append(r.written, path)
+	return nil
+}
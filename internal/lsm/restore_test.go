@@ -0,0 +1,120 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"maps"
+	"path/filepath"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+func TestRestoreBackup(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir)
+	root := t.TempDir()
+	full := filepath.Join(root, "full")
+	incr := filepath.Join(root, "incr")
+	ctx := context.Background()
+
+	// seq 1-2
+	for _, k := range []string{"a", "b"} {
+		if err := db.Set(k, []byte("1")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := db.Backup(ctx, full); err != nil {
+		t.Fatalf("全量备份失败: %v", err)
+	}
+	// seq 3-4
+	if err := db.Set("a", []byte("2")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Delete("b"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if err := db.IncrementalBackup(ctx, incr, full); err != nil {
+		t.Fatalf("增量备份失败: %v", err)
+	}
+	// seq 5、批量 6-7、seq 8
+	if err := db.Set("c", []byte("1")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	b := NewWriteBatch()
+	b.Set("d", []byte("1"))
+	b.Set("e", []byte("1"))
+	if err := db.Write(b); err != nil {
+		t.Fatalf("批量写入失败: %v", err)
+	}
+	if err := db.Set("a", []byte("3")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭数据库失败: %v", err)
+	}
+	archive := filepath.Join(dir, walDirName)
+
+	tests := []struct {
+		name    string
+		chain   []string
+		opts    RestoreOptions
+		want    map[string]string
+		wantSeq int64
+		wantErr error
+	}{
+		{name: "仅全量", chain: []string{full}, want: map[string]string{"a": "1", "b": "1"}, wantSeq: 2},
+		{name: "全量加增量", chain: []string{full, incr}, want: map[string]string{"a": "2"}, wantSeq: 4},
+		{
+			name: "回放全部归档", chain: []string{full, incr}, opts: RestoreOptions{WALDir: archive},
+			want: map[string]string{"a": "3", "c": "1", "d": "1", "e": "1"}, wantSeq: 8,
+		},
+		{
+			name: "指定序列号", chain: []string{full, incr}, opts: RestoreOptions{WALDir: archive, TargetSeq: 5},
+			want: map[string]string{"a": "2", "c": "1"}, wantSeq: 5,
+		},
+		{
+			name: "目标落在批量中间", chain: []string{full, incr}, opts: RestoreOptions{WALDir: archive, TargetSeq: 6},
+			want: map[string]string{"a": "2", "c": "1"}, wantSeq: 5,
+		},
+		{
+			name: "跳过目标之后的增量备份", chain: []string{full, incr}, opts: RestoreOptions{WALDir: archive, TargetSeq: 3},
+			want: map[string]string{"a": "2", "b": "1"}, wantSeq: 3,
+		},
+		{name: "没有归档无法到达目标", chain: []string{full, incr}, opts: RestoreOptions{TargetSeq: 5}, wantErr: ErrRestoreTarget},
+		{name: "目标早于全量备份", chain: []string{full}, opts: RestoreOptions{TargetSeq: 1}, wantErr: ErrRestoreTarget},
+		{name: "链以增量备份开始", chain: []string{incr}, wantErr: ErrInvalidBackup},
+		{name: "链不连续", chain: []string{full, full}, wantErr: ErrInvalidBackup},
+		{name: "空链", wantErr: ErrInvalidBackup},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := filepath.Join(t.TempDir(), "restored")
+			seq, err := RestoreBackup(ctx, vfs.OSFS{}, dst, tt.chain, tt.opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望 %v, 实际 %v", tt.wantErr, err)
+				}
+				if _, err := (vfs.OSFS{}).Stat(dst); !errors.Is(err, fs.ErrNotExist) {
+					t.Fatalf("失败的恢复应被清理: %v", err)
+				}
+				return
+			}
+			if err != nil || seq != tt.wantSeq {
+				t.Fatalf("恢复期望序列号 %d, 实际 %d %v", tt.wantSeq, seq, err)
+			}
+
+			restored := openTestDB(t, dst)
+			defer restored.Close()
+			if got := dumpDB(t, restored); !maps.Equal(got, tt.want) {
+				t.Fatalf("期望 %v, 实际 %v", tt.want, got)
+			}
+			stats, err := restored.Stats()
+			if err != nil || stats.LastSequence != tt.wantSeq {
+				t.Fatalf("恢复后的序列号期望 %d, 实际 %d %v", tt.wantSeq, stats.LastSequence, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package lsm
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// SlowOpInfo 描述一次耗时超过 Options.SlowOpThreshold 的操作，见 EventListener.OnSlowOp
+type SlowOpInfo struct {
+	// Op 操作名：get、multiget、set、delete、cas、increment、write（批次）、scan、sync；CompareAndDelete 记为 delete
+	Op string
+	// Key 操作的 key，scan 为区间起点，multiget、write 与 sync 为空；Options.SlowOpHashKeys 时为 key 的 FNV-64a 哈希
+	Key string
+	// End scan 的区间终点，哈希规则与 Key 相同
+	End string
+	// Duration 操作的总耗时
+	Duration time.Duration
+	// Stages 按执行顺序排列的各阶段耗时，见 SlowOpStage
+	Stages []SlowOpStage
+}
+
+// SlowOpStage 慢操作中一个阶段的耗时
+//
+// 写入（set/delete/write）的阶段为 queue（等待组提交的 leader 与本组攒满）、
+// wal（本组写入 WAL 并按 SyncMode 持久化）与 memtable（本组应用到跳表）；
+// 组内的写入共享后两个阶段的耗时。get 与 multiget 为 memtable，scan 为 iterator（创建迭代器或快照）与 iterate，
+// sync 为 wal sync
+type SlowOpStage struct {
+	Name     string
+	Duration time.Duration
+}
+
+// maxOpStages 单个操作最多记录的阶段数
+const maxOpStages = 4
+
+// opTimer 记录一次操作的各阶段耗时，未启用慢操作日志时为零值，所有方法都不做任何事
+//
+// 在调用方的栈上使用，阶段保存在定长数组里，只有真正超过阈值时才分配内存
+type opTimer struct {
+	db       *DB
+	op       string
+	key, end string
+	start    time.Time
+	last     time.Time
+	stages   [maxOpStages]SlowOpStage
+	n        int
+}
+
+// startOp 开始计时，未设置 SlowOpThreshold 时返回零值
+func (db *DB) startOp(op, key, end string) opTimer {
+	if db.slowOpThreshold.Load() <= 0 {
+		return opTimer{}
+	}
+	now := time.Now()
+	return opTimer{db: db, op: op, key: key, end: end, start: now, last: now}
+}
+
+// stage 结束名为 name 的阶段，耗时从上一个阶段结束（或操作开始）算起
+func (t *opTimer) stage(name string) {
+	if t.db == nil {
+		return
+	}
+	now := time.Now()
+	t.add(name, now.Sub(t.last))
+	t.last = now
+}
+
+func (t *opTimer) add(name string, d time.Duration) {
+	if t.n < maxOpStages {
+		t.stages[t.n] = SlowOpStage{Name: name, Duration: d}
+		t.n++
+	}
+}
+
+// commit 记录一次组提交的各阶段：leader 测得的 wal 与 memtable 耗时之外的部分都计入 queue
+func (t *opTimer) commit(req *commitRequest) {
+	if t.db == nil {
+		return
+	}
+	now := time.Now()
+	t.add("queue", max(now.Sub(t.last)-req.walTime-req.applyTime, 0))
+	t.add("wal", req.walTime)
+	t.add("memtable", req.applyTime)
+	t.last = now
+}
+
+// done 结束计时，总耗时达到阈值时打印警告并通知 EventListener.OnSlowOp
+func (t *opTimer) done() {
+	if t.db == nil {
+		return
+	}
+	// 阈值可能在操作进行期间被 SetOptions 修改，关闭后不再报告
+	threshold := time.Duration(t.db.slowOpThreshold.Load())
+	d := time.Since(t.start)
+	if threshold <= 0 || d < threshold {
+		return
+	}
+	info := SlowOpInfo{
+		Op:       t.op,
+		Key:      t.db.slowOpKey(t.key),
+		End:      t.db.slowOpKey(t.end),
+		Duration: d,
+		Stages:   slices.Clone(t.stages[:t.n]),
+	}
+	attrs := make([]any, 0, t.n)
+	for _, s := range info.Stages {
+		attrs = append(attrs, slog.Duration(s.Name, s.Duration))
+	}
+	slog.Warn("slow operation", "op", info.Op, "key", info.Key, "end", info.End, "duration", info.Duration, slog.Group("stages", attrs...))
+	t.db.opts.EventListener.OnSlowOp(info)
+}
+
+// slowOpKey 按 SlowOpHashKeys 返回写入慢操作日志的 key，空 key 保持为空
+func (db *DB) slowOpKey(key string) string {
+	if !db.opts.SlowOpHashKeys || key == "" {
+		return key
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
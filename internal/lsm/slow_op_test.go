@@ -0,0 +1,115 @@
+package lsm
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowOpListener 收集慢操作事件
+type slowOpListener struct {
+	BaseEventListener
+	mu  sync.Mutex
+	ops []SlowOpInfo
+}
+
+func (l *slowOpListener) OnSlowOp(info SlowOpInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ops = append(l.ops, info)
+}
+
+// 测试阈值极小时每个操作都被记录，并带有对应的阶段与（可选哈希的）key
+func TestDB_SlowOp(t *testing.T) {
+	tests := []struct {
+		name       string
+		hashKeys   bool
+		wantKey    string
+		wantScanTo string
+	}{
+		{name: "原始 key", wantKey: "k", wantScanTo: "z"},
+		{name: "哈希 key", hashKeys: true, wantKey: "af63e64c8601fd8a", wantScanTo: "af63f74c86021a6d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener := &slowOpListener{}
+			db, err := Open(t.TempDir(), Options{
+				SyncMode:        NoSync,
+				SlowOpThreshold: time.Nanosecond,
+				SlowOpHashKeys:  tt.hashKeys,
+				EventListener:   listener,
+			})
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+			defer db.Close()
+
+			b := NewWriteBatch()
+			b.Set("b", []byte("2"))
+			ops := []func() error{
+				func() error { return db.Set("k", []byte("v")) },
+				func() error { _, err := db.Get("k"); return err },
+				func() error { return db.Delete("k") },
+				func() error { return db.Write(b) },
+				func() error { _, err := db.Scan("a", "z"); return err },
+				func() error { return db.Sync() },
+			}
+			for _, op := range ops {
+				if err := op(); err != nil {
+					t.Fatalf("操作失败: %v", err)
+				}
+			}
+
+			want := []struct {
+				op, key, end string
+				stages       []string
+			}{
+				{op: "set", key: tt.wantKey, stages: []string{"queue", "wal", "memtable"}},
+				{op: "get", key: tt.wantKey, stages: []string{"memtable"}},
+				{op: "delete", key: tt.wantKey, stages: []string{"queue", "wal", "memtable"}},
+				{op: "write", stages: []string{"queue", "wal", "memtable"}},
+				{op: "scan", key: db.slowOpKey("a"), end: tt.wantScanTo, stages: []string{"iterator", "iterate"}},
+				{op: "sync", stages: []string{"wal sync"}},
+			}
+			if len(listener.ops) != len(want) {
+				t.Fatalf("期望 %d 条慢操作, 实际 %d: %+v", len(want), len(listener.ops), listener.ops)
+			}
+			for i, w := range want {
+				got := listener.ops[i]
+				var stages []string
+				var sum time.Duration
+				for _, s := range got.Stages {
+					stages = append(stages, s.Name)
+					sum += s.Duration
+				}
+				if got.Op != w.op || got.Key != w.key || got.End != w.end || !slices.Equal(stages, w.stages) {
+					t.Fatalf("第 %d 条期望 %s key=%q end=%q %v, 实际 %+v", i, w.op, w.key, w.end, w.stages, got)
+				}
+				if got.Duration <= 0 || sum > got.Duration {
+					t.Fatalf("第 %d 条各阶段耗时之和 %v 不应超过总耗时 %v", i, sum, got.Duration)
+				}
+			}
+		})
+	}
+}
+
+// 测试未达到阈值的操作不被记录
+func TestDB_SlowOpThreshold(t *testing.T) {
+	listener := &slowOpListener{}
+	db, err := Open(InMemory, Options{SlowOpThreshold: time.Hour, EventListener: listener})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Set("k", []byte("v")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if _, err := db.Get("k"); err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if len(listener.ops) != 0 {
+		t.Fatalf("期望没有慢操作, 实际 %+v", listener.ops)
+	}
+}
@@ -0,0 +1,197 @@
+package lsm
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+// ErrSnapshotReleased 读取已经调用过 Release 的快照；它引用的旧版本可能已被回收
+var ErrSnapshotReleased = errors.New("snapshot is released")
+
+// snapshotList 记录所有未释放快照的序列号
+//
+// 回收旧版本的路径（MemTable 覆盖写、未来的合并）必须先查询这里，
+// 不能丢弃仍对某个快照可见的版本
+type snapshotList struct {
+	mu sync.Mutex
+	// seqs 序列号 -> 持有该序列号的快照数量
+	seqs map[int64]int
+}
+
+func newSnapshotList() *snapshotList {
+	return &snapshotList{seqs: make(map[int64]int)}
+}
+
+func (l *snapshotList) acquire(seq int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seqs[seq]++
+}
+
+func (l *snapshotList) release(seq int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seqs[seq]--; l.seqs[seq] <= 0 {
+		delete(l.seqs, seq)
+	}
+}
+
+// len 返回未释放的快照数
+func (l *snapshotList) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, c := range l.seqs {
+		n += c
+	}
+	return n
+}
+
+// newest 返回最新快照的序列号，没有快照时 ok 为 false
+func (l *snapshotList) newest() (seq int64, ok bool) {
+	if l == nil {
+		return 0, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for s := range l.seqs {
+		if !ok || s > seq {
+			seq, ok = s, true
+		}
+	}
+	return seq, ok
+}
+
+// oldest 返回最旧快照的序列号，没有快照时 ok 为 false
+func (l *snapshotList) oldest() (seq int64, ok bool) {
+	if l == nil {
+		return 0, false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for s := range l.seqs {
+		if !ok || s < seq {
+			seq, ok = s, true
+		}
+	}
+	return seq, ok
+}
+
+// Snapshot 是数据库在某个序列号上的只读视图，之后的写入对其不可见
+// 使用完毕后必须调用 Release，否则被其引用的旧版本无法回收
+type Snapshot struct {
+	db       *DB
+	seq      int64
+	release  sync.Once
+	released atomic.Bool
+}
+
+// GetSnapshot 创建一个固定在当前已提交序列号上的快照
+func (db *DB) GetSnapshot() (*Snapshot, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	seq := db.memTable.acquireSnapshot(db.snapshots)
+	return &Snapshot{db: db, seq: seq}, nil
+}
+
+// Seq 返回快照固定的序列号
+func (s *Snapshot) Seq() int64 {
+	return s.seq
+}
+
+// Get 返回快照时刻 key 对应的值
+// 快照固定的是数据版本，过期仍按当前时间判断：快照创建后才过期的 key 同样读不到
+func (s *Snapshot) Get(key string) ([]byte, error) {
+	return s.db.GetWithOptions(key, ReadOptions{Snapshot: s})
+}
+
+// Scan 返回快照时刻 [start, end] 区间内所有未被删除的条目
+func (s *Snapshot) Scan(start, end string) ([]*sdbf.Entry, error) {
+	return s.db.ScanWithOptions(start, end, ReadOptions{Snapshot: s})
+}
+
+// ScanPage 与 DB.ScanPage 相同，但所有页都读取快照时刻的数据
+func (s *Snapshot) ScanPage(start, end string, limit int) (entries []*sdbf.Entry, next string, err error) {
+	it, err := s.NewIterator()
+	if err != nil {
+		return nil, "", err
+	}
+	entries, next = scanPage(it, start, end, limit)
+	return entries, next, nil
+}
+
+// NewIterator 返回快照时刻的迭代器，已删除或已过期的 key 会被跳过
+// 迭代器直接遍历 MemTable 而不复制，快照释放之后不能再使用；释放之后调用返回 ErrSnapshotReleased
+func (s *Snapshot) NewIterator() (Iterator, error) {
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	if s.db.closed {
+		return nil, ErrClosed
+	}
+	if s.released.Load() {
+		return nil, ErrSnapshotReleased
+	}
+
+	return newLiveIterator(s.db.memTable.def.iterator(s.seq), s.db.now()), nil
+}
+
+// SnapshotIterator 是 DB.NewIterator 与 ColumnFamily.NewIterator 返回的迭代器，
+// 持有创建时登记的临时快照，直接遍历 MemTable 而不复制。使用完毕后应调用 Close 释放快照，
+// 否则它引用的旧版本要等到迭代器被垃圾回收之后才能回收
+type SnapshotIterator struct {
+	Iterator
+	snap *Snapshot
+}
+
+// newSnapshotIterator 返回持有 snap 的迭代器，it 必须读取 snap 时刻的数据；迭代器不可达时自动释放 snap
+func newSnapshotIterator(snap *Snapshot, it Iterator) *SnapshotIterator {
+	si := &SnapshotIterator{Iterator: it, snap: snap}
+	runtime.AddCleanup(si, (*Snapshot).Release, snap)
+	return si
+}
+
+// Close 释放迭代器持有的快照，之后不能再使用迭代器；重复调用是安全的
+func (it *SnapshotIterator) Close() error {
+	it.snap.Release()
+	return nil
+}
+
+// Release 释放快照，重复调用是安全的；之后通过该快照读取返回 ErrSnapshotReleased
+func (s *Snapshot) Release() {
+	s.release.Do(func() {
+		s.released.Store(true)
+		s.db.snapshots.release(s.seq)
+	})
+}
+
+// versionIterator 跳过版本号大于 maxVersion 的条目
+type versionIterator struct {
+	Iterator
+	maxVersion int64
+}
+
+func (it *versionIterator) Seek(target string) {
+	it.Iterator.Seek(target)
+	it.skipNewer()
+}
+
+func (it *versionIterator) Next() {
+	it.Iterator.Next()
+	it.skipNewer()
+}
+
+func (it *versionIterator) skipNewer() {
+	for it.Iterator.Valid() && it.Iterator.Entry().Version > it.maxVersion {
+		it.Iterator.Next()
+	}
+}
@@ -0,0 +1,401 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+func TestSnapshot_Get(t *testing.T) {
+	tests := []struct {
+		name    string
+		after   func(db *DB) error
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "快照后覆盖写",
+			after: func(db *DB) error { return db.Set("k", []byte("v2")) },
+			want:  "v1",
+		},
+		{
+			name:  "快照后删除",
+			after: func(db *DB) error { return db.Delete("k") },
+			want:  "v1",
+		},
+		{
+			name: "快照后多次覆盖写",
+			after: func(db *DB) error {
+				for _, v := range []string{"v2", "v3", "v4"} {
+					if err := db.Set("k", []byte(v)); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			want: "v1",
+		},
+		{
+			name:    "快照后才写入的key",
+			after:   func(db *DB) error { return db.Set("new", []byte("x")) },
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, t.TempDir())
+			defer db.Close()
+
+			if err := db.Set("k", []byte("v1")); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+			snap, err := db.GetSnapshot()
+			if err != nil {
+				t.Fatalf("创建快照失败: %v", err)
+			}
+			defer snap.Release()
+
+			if err := tt.after(db); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+
+			key := "k"
+			if tt.wantErr != nil {
+				key = "new"
+			}
+			got, err := snap.Get(key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("期望错误 %v, 实际错误 %v", tt.wantErr, err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("期望 %q, 实际 %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestSnapshot_Scan(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+
+	for _, k := range []string{"a", "b", "c"} {
+		if err := db.Set(k, []byte(k+"1")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	defer snap.Release()
+
+	if err := db.Set("a", []byte("a2")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Delete("b"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if err := db.Set("d", []byte("d2")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		scan func() ([]string, error)
+		want []string
+	}{
+		{
+			name: "快照视图",
+			scan: func() ([]string, error) { return scanValues(snap.Scan("a", "z")) },
+			want: []string{"a1", "b1", "c1"},
+		},
+		{
+			name: "最新视图",
+			scan: func() ([]string, error) { return scanValues(db.Scan("a", "z")) },
+			want: []string{"a2", "c1", "d2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.scan()
+			if err != nil {
+				t.Fatalf("扫描失败: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("期望 %v, 实际 %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// 测试释放快照后覆盖写不再保留旧版本
+func TestSnapshot_Release(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+
+	if err := db.Set("k", []byte("v1")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	if err := db.Set("k", []byte("v2")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if n := len(db.memTable.skipList.All()); n != 2 {
+		t.Fatalf("快照未释放时期望保留 2 个版本, 实际 %d 个", n)
+	}
+
+	snap.Release()
+	snap.Release()
+	if err := db.Set("k", []byte("v3")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if n := len(db.memTable.skipList.All()); n != 2 {
+		t.Fatalf("快照释放后覆盖写不应新增版本, 实际 %d 个", n)
+	}
+	got, err := db.Get("k")
+	if err != nil || string(got) != "v3" {
+		t.Fatalf("期望 v3, 实际 %q %v", got, err)
+	}
+}
+
+// 测试快照释放并回收旧版本之后，通过它的所有读取都返回 ErrSnapshotReleased，而不是读到更新的版本
+func TestSnapshot_ReadAfterRelease(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+
+	if err := db.Set("k", []byte("v1")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	if err := db.Set("k", []byte("v2")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	snap.Release()
+	mt := db.memTable
+	mt.mu.Lock()
+	mt.collectLocked()
+	mt.mu.Unlock()
+	if n := len(mt.skipList.All()); n != 1 {
+		t.Fatalf("释放后期望回收到 1 个版本, 实际 %d 个", n)
+	}
+
+	tests := []struct {
+		name string
+		read func() error
+	}{
+		{name: "Get", read: func() error { _, err := snap.Get("k"); return err }},
+		{name: "Scan", read: func() error { _, err := snap.Scan("a", "z"); return err }},
+		{name: "ScanPage", read: func() error { _, _, err := snap.ScanPage("a", "z", 10); return err }},
+		{name: "NewIterator", read: func() error { _, err := snap.NewIterator(); return err }},
+		{name: "GetWithOptions", read: func() error {
+			_, err := db.GetWithOptions("k", ReadOptions{Snapshot: snap})
+			return err
+		}},
+		{name: "ScanWithOptions", read: func() error {
+			_, err := db.ScanWithOptions("a", "z", ReadOptions{Snapshot: snap})
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.read(); !errors.Is(err, ErrSnapshotReleased) {
+				t.Fatalf("期望 ErrSnapshotReleased, 实际 %v", err)
+			}
+		})
+	}
+}
+
+func scanValues(entries []*sdbf.Entry, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, e := range entries {
+		out = append(out, string(e.Value))
+	}
+	return out, nil
+}
+
+// 测试回收旧版本：只丢弃比最旧的快照可见的版本更旧的版本
+func TestMemTable_CollectOldVersions(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+
+	var snaps []*Snapshot
+	for _, v := range []string{"v1", "v2", "v3"} {
+		if err := db.Set("k", []byte(v)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+		snap, err := db.GetSnapshot()
+		if err != nil {
+			t.Fatalf("创建快照失败: %v", err)
+		}
+		snaps = append(snaps, snap)
+	}
+	if err := db.Set("k", []byte("v4")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	collect := func() []string {
+		mt := db.memTable
+		mt.mu.Lock()
+		mt.collectLocked()
+		mt.mu.Unlock()
+		var values []string
+		for _, e := range mt.skipList.All() {
+			values = append(values, string(e.Value))
+		}
+		return values
+	}
+
+	if got := collect(); !slices.Equal(got, []string{"v4", "v3", "v2", "v1"}) {
+		t.Fatalf("快照都未释放时不应回收, 实际 %v", got)
+	}
+	snaps[0].Release()
+	if got := collect(); !slices.Equal(got, []string{"v4", "v3", "v2"}) {
+		t.Fatalf("释放最旧的快照后期望保留 [v4 v3 v2], 实际 %v", got)
+	}
+	// 回收只以最旧的快照为界：v3 虽然已不对任何快照可见，仍保留到 snaps[1] 释放
+	snaps[2].Release()
+	if got := collect(); !slices.Equal(got, []string{"v4", "v3", "v2"}) {
+		t.Fatalf("期望保留 [v4 v3 v2], 实际 %v", got)
+	}
+	if got, err := snaps[1].Get("k"); err != nil || string(got) != "v2" {
+		t.Fatalf("快照期望读到 v2, 实际 %q %v", got, err)
+	}
+	snaps[1].Release()
+	if got := collect(); !slices.Equal(got, []string{"v4"}) {
+		t.Fatalf("快照全部释放后期望只保留 [v4], 实际 %v", got)
+	}
+}
+
+// 测试 MemTable 增长超过 MemTableGCBytes 后自动回收快照释放后残留的旧版本
+func TestMemTable_AutoCollect(t *testing.T) {
+	db, err := Open(t.TempDir(), Options{MemTableGCBytes: 1, SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	defer db.Close()
+
+	set := func(prefix string, n int) {
+		t.Helper()
+		for i := range n {
+			if err := db.Set(fmt.Sprintf("%s:%03d", prefix, i), []byte("value")); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+		}
+	}
+	set("old", 50)
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	set("old", 50)
+	if n := db.memTable.skipList.Len(); n != 100 {
+		t.Fatalf("快照未释放时期望 100 个版本, 实际 %d", n)
+	}
+	snap.Release()
+
+	set("new", 200)
+	if n := db.memTable.skipList.Len(); n != 250 {
+		t.Fatalf("期望旧版本被自动回收后剩余 250 个节点, 实际 %d", n)
+	}
+}
+
+// 测试内存预算：占用与 Stats 一致，超出预算时即使未达到 MemTableGCBytes 也会回收旧版本
+func TestMemTable_MemoryBudget(t *testing.T) {
+	db, err := Open(t.TempDir(), Options{MemoryBudget: 1, SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	defer db.Close()
+
+	set := func(prefix string, n int) {
+		t.Helper()
+		for i := range n {
+			if err := db.Set(fmt.Sprintf("%s:%03d", prefix, i), []byte("value")); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+		}
+	}
+	set("old", 50)
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	set("old", 50)
+	snap.Release()
+	set("new", 200)
+	if n := db.memTable.skipList.Len(); n != 250 {
+		t.Fatalf("超出预算后期望旧版本被回收, 剩余 250 个节点, 实际 %d", n)
+	}
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatalf("获取统计信息失败: %v", err)
+	}
+	if stats.MemoryBudgetBytes != 1 || stats.MemoryUsedBytes <= 0 || stats.MemoryUsedBytes != int64(stats.MemTableBytes) {
+		t.Fatalf("内存统计不正确: %+v", stats)
+	}
+}
+
+// 测试快照迭代器直接遍历跳表时，迭代期间的写入与旧版本回收不影响结果
+func TestSnapshot_IteratorConcurrentWrites(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+
+	var want []string
+	for i := range 20 {
+		key := fmt.Sprintf("k%02d", i)
+		want = append(want, key)
+		if err := db.Set(key, []byte("old")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	defer snap.Release()
+
+	it, err := snap.NewIterator()
+	if err != nil {
+		t.Fatalf("创建迭代器失败: %v", err)
+	}
+	var got []string
+	for it.Seek(""); it.Valid(); it.Next() {
+		got = append(got, it.Key())
+		if string(it.Value()) != "old" {
+			t.Fatalf("%s 期望 old, 实际 %s", it.Key(), it.Value())
+		}
+		// 每读一个 key 就覆盖写它与下一个 key、插入新 key、删除一个 key 并回收旧版本
+		next := fmt.Sprintf("k%02d", len(got))
+		for _, err := range []error{
+			db.Set(it.Key(), []byte("new")),
+			db.Set(next, []byte("new")),
+			db.Set(it.Key()+"x", []byte("new")),
+			db.Delete(next),
+		} {
+			if err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+		}
+		db.memTable.mu.Lock()
+		db.memTable.collectLocked()
+		db.memTable.mu.Unlock()
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("期望 %v, 实际 %v", want, got)
+	}
+}
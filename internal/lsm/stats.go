@@ -0,0 +1,78 @@
+package lsm
+
+import "fmt"
+
+// Stats 是数据库某一时刻的运行状态，可以直接序列化为 JSON
+//
+// 各字段分别读取，相互之间不保证是同一时刻的一致视图
+type Stats struct {
+	// MemTableEntries MemTable 中（所有列族）的条目数，包含墓碑以及为快照保留的旧版本
+	MemTableEntries int `json:"memtable_entries"`
+	// MemTableBytes MemTable 估算的内存占用，包含节点与条目的结构体开销以及范围墓碑
+	MemTableBytes int `json:"memtable_bytes"`
+	// MemoryUsedBytes 申报到内存预算（Options.MemoryBudget）上的总占用，MemoryBudgetBytes 为预算上限，0 表示不限制
+	MemoryUsedBytes   int64 `json:"memory_used_bytes"`
+	MemoryBudgetBytes int64 `json:"memory_budget_bytes"`
+	// WALSegments WAL 段文件数，纯内存模式下为 0
+	WALSegments int `json:"wal_segments"`
+	// WALBytes 所有 WAL 段文件的总大小
+	WALBytes int64 `json:"wal_bytes"`
+	// DiskUsageBytes 数据目录占用的总大小，目前只有 WAL
+	DiskUsageBytes int64 `json:"disk_usage_bytes"`
+	// LastSequence 最后一次对读可见的写入的序列号
+	LastSequence int64 `json:"last_sequence"`
+	// Snapshots 未释放的快照数（包括未结束的事务持有的快照）
+	Snapshots int `json:"snapshots"`
+	// InMemory 是否为纯内存数据库
+	InMemory bool `json:"in_memory"`
+}
+
+// Stats 返回数据库当前的运行状态
+func (db *DB) Stats() (Stats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return Stats{}, ErrClosed
+	}
+
+	mt := db.memTable
+	mt.mu.Lock()
+	lastSeq := mt.visibleSeq
+	mt.mu.Unlock()
+
+	stats := Stats{
+		MemoryUsedBytes:   mt.budget.Used(),
+		MemoryBudgetBytes: mt.budget.Limit(),
+		LastSequence:      lastSeq,
+		Snapshots:         db.snapshots.len(),
+		InMemory:          db.wal == nil,
+	}
+	_, families := mt.allFamilies()
+	for _, f := range families {
+		stats.MemTableEntries += f.list.Len()
+		stats.MemTableBytes += int(f.size())
+	}
+	if db.wal != nil {
+		segments, size, err := db.wal.diskUsage()
+		if err != nil {
+			return Stats{}, fmt.Errorf("stats: %w", err)
+		}
+		stats.WALSegments = segments
+		stats.WALBytes = size
+		stats.DiskUsageBytes = size
+	}
+	return stats, nil
+}
+
+// diskUsage 返回段文件数与所有段的总大小
+func (m *WALManager) diskUsage() (segments int, size int64, err error) {
+	files, err := m.files()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, f := range files {
+		size += f.Size
+	}
+	return len(files), size, nil
+}
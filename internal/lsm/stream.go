@@ -0,0 +1,49 @@
+package lsm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// SetReader 从 r 读取恰好 size 字节作为 key 的 value 写入，r 中多余的数据不会被读取
+//
+// value 直接读入一块 size 字节的缓冲区并交给 MemTable 持有，不会像 io.ReadAll 那样反复扩容复制，
+// 超过 Options.MaxValueSize 时在读取之前就返回 ErrValueTooLarge。
+// 在引入 value log 之前整个 value 仍然驻留在内存中
+func (db *DB) SetReader(key string, r io.Reader, size int64) error {
+	if size < 0 {
+		return fmt.Errorf("set %s: invalid value size %d", key, size)
+	}
+	if size > int64(db.opts.MaxValueSize) {
+		return fmt.Errorf("set %s: %w: %d bytes, limit %d", key, ErrValueTooLarge, size, db.opts.MaxValueSize)
+	}
+
+	value := make([]byte, size)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return fmt.Errorf("set %s: read value: %w", key, err)
+	}
+	return db.Set(key, value)
+}
+
+// GetReader 返回读取 key 当前 value 的 io.ReadCloser，不存在时返回 ErrNotFound
+//
+// 读取器直接引用 MemTable 中的 value，不复制；它同时实现了 io.Seeker、io.ReaderAt 与 io.WriterTo，
+// 可以交给 http.ServeContent 或 io.Copy 使用
+func (db *DB) GetReader(key string) (*ValueReader, error) {
+	value, err := db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return &ValueReader{Reader: bytes.NewReader(value)}, nil
+}
+
+// ValueReader 由 GetReader 返回，Size 为 value 的总长度
+type ValueReader struct {
+	*bytes.Reader
+}
+
+// Close 实现 io.Closer，value 不持有任何资源
+func (r *ValueReader) Close() error {
+	return nil
+}
@@ -0,0 +1,96 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// 测试 SetReader 按 size 读取 value，以及长度不符或超过上限时的错误
+func TestDB_SetReader(t *testing.T) {
+	opts := DefaultOptions()
+	opts.MaxValueSize = 8
+	db, err := Open(InMemory, opts)
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	defer db.Close()
+
+	tests := []struct {
+		name    string
+		input   string
+		size    int64
+		want    string
+		wantErr error
+	}{
+		{name: "恰好 size", input: "value", size: 5, want: "value"},
+		{name: "多余的数据不读取", input: "value-extra", size: 5, want: "value"},
+		{name: "空 value", input: "", size: 0, want: ""},
+		{name: "数据不足", input: "val", size: 5, wantErr: io.ErrUnexpectedEOF},
+		{name: "超过上限", input: "0123456789", size: 10, wantErr: ErrValueTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := strings.NewReader(tt.input)
+			err := db.SetReader("k", r, tt.size)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望 %v, 实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+			if rest := r.Len(); rest != len(tt.input)-int(tt.size) {
+				t.Fatalf("期望剩余 %d 字节未读, 实际 %d", len(tt.input)-int(tt.size), rest)
+			}
+			got, err := db.Get("k")
+			if err != nil || string(got) != tt.want {
+				t.Fatalf("期望读到 %q, 实际 %q %v", tt.want, got, err)
+			}
+		})
+	}
+
+	if err := db.SetReader("k", strings.NewReader(""), -1); err == nil {
+		t.Fatal("负数 size 应当返回错误")
+	}
+}
+
+// 测试 GetReader 流式读取 value
+func TestDB_GetReader(t *testing.T) {
+	db, err := Open(InMemory, DefaultOptions())
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.GetReader("missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("期望 ErrNotFound, 实际 %v", err)
+	}
+
+	value := bytes.Repeat([]byte("0123456789"), 1000)
+	if err := db.SetReader("big", bytes.NewReader(value), int64(len(value))); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	r, err := db.GetReader("big")
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	defer r.Close()
+	if r.Size() != int64(len(value)) {
+		t.Fatalf("期望大小 %d, 实际 %d", len(value), r.Size())
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, 10); err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if _, err := io.Copy(&buf, r); err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), value) {
+		t.Fatal("流式读取的内容不一致")
+	}
+}
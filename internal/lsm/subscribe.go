@@ -0,0 +1,154 @@
+package lsm
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+)
+
+const (
+	// subscribePollInterval 变更流追上 WAL 末尾之后检查新记录的间隔
+	subscribePollInterval = 20 * time.Millisecond
+	// subscribeReadBytes 变更流每次从 WAL 读取的字节数
+	subscribeReadBytes = 1 << 20
+)
+
+// Change 是变更流中的一次提交：同一条 WAL 记录（一次 Set、Delete 或一个 WriteBatch）中的全部条目
+type Change struct {
+	// Seq 这次提交中最大的序列号，订阅中断后把它作为 fromSeq 即可从下一次提交继续
+	Seq int64
+	// Entries 按序列号升序排列，包含墓碑与范围墓碑，条目的 ColumnFamily 为所属的列族（默认列族为空）
+	Entries []*sdbf.Entry
+}
+
+// Subscription 是 DB.Subscribe 返回的变更流
+type Subscription struct {
+	changes chan Change
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu  sync.Mutex
+	err error
+}
+
+// Changes 返回按提交顺序传递变更的 channel，订阅结束后被关闭，之后由 Err 给出原因
+func (s *Subscription) Changes() <-chan Change {
+	return s.changes
+}
+
+// Err 返回订阅结束的原因：ctx 取消或调用 Close 时为 ctx 的错误，数据库关闭时为 ErrClosed，
+// 订阅位置所在的 WAL 段被删除时包装了 ErrWALPositionGone。订阅未结束时返回 nil
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close 结束订阅并等待后台协程退出
+func (s *Subscription) Close() {
+	s.cancel()
+	<-s.done
+}
+
+// Subscribe 订阅序列号大于 fromSeq 的提交，按提交顺序逐个传递，用于维护缓存、搜索索引等下游系统
+//
+// 变更流从 WAL 中读取：先从第一个段开始回放已有的记录（跳过序列号不大于 fromSeq 的条目），
+// 追上之后每隔 subscribePollInterval 检查新写入的记录。消费过慢不会阻塞写入，但 WAL 段在被读到之前
+// 被 RemoveSegmentsBefore 删除时订阅以 ErrWALPositionGone 结束，此时应当用 Export 或
+// WriteChangesSince 重新同步。与 ReadWAL 一样，SyncPeriodic 与 NoSync 模式下传递的提交可能还没有 fsync
+//
+// 变更只包含 WAL 中仍然保留的记录：由备份恢复的数据库只含有恢复时写入的每个 key 的最新条目。
+// 纯内存数据库没有 WAL，返回 ErrInMemory。只关心部分 key 时使用 Watch
+func (db *DB) Subscribe(ctx context.Context, fromSeq int64) (*Subscription, error) {
+	s, err := db.subscribe(ctx, fromSeq, nil)
+	if err != nil {
+		return nil, fmt.Errorf("subscribe: %w", err)
+	}
+	return s, nil
+}
+
+// subscribe 实现 Subscribe 与 Watch：match 不为 nil 时只传递它返回 true 的条目，
+// 提交中没有匹配的条目时整个跳过
+func (db *DB) subscribe(ctx context.Context, fromSeq int64, match func(*sdbf.Entry) bool) (*Subscription, error) {
+	if db.wal == nil {
+		return nil, ErrInMemory
+	}
+	db.mu.RLock()
+	closed := db.closed
+	db.mu.RUnlock()
+	if closed {
+		return nil, ErrClosed
+	}
+
+	start := WALPosition{Segment: db.wal.Segments()[0]}
+	ctx, cancel := context.WithCancel(ctx)
+	s := &Subscription{changes: make(chan Change), cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(s.done)
+		defer close(s.changes)
+		err := db.streamChanges(ctx, start, fromSeq, match, s.changes)
+		s.mu.Lock()
+		s.err = err
+		s.mu.Unlock()
+	}()
+	return s, nil
+}
+
+// streamChanges 从 pos 开始读取 WAL，把序列号大于 fromSeq 的提交发送到 out，直到 ctx 取消或出错，
+// match 的含义同 subscribe
+func (db *DB) streamChanges(ctx context.Context, pos WALPosition, fromSeq int64, match func(*sdbf.Entry) bool, out chan<- Change) error {
+	buf := utils.Pool.Get()
+	defer utils.Pool.Put(buf)
+
+	send := func(rec WALRecord) error {
+		entries := rec.Entries
+		for len(entries) > 0 && entries[0].Version <= fromSeq {
+			entries = entries[1:]
+		}
+		if match != nil {
+			// 解码出的切片只属于这次回调，可以原地过滤
+			entries = slices.DeleteFunc(entries, func(e *sdbf.Entry) bool { return !match(e) })
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+		c := Change{Seq: entries[len(entries)-1].Version, Entries: entries}
+		select {
+		case out <- c:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for {
+		buf.Reset()
+		next, err := db.ReadWAL(pos, subscribeReadBytes, buf)
+		if err != nil {
+			return err
+		}
+		if buf.Len() > 0 {
+			err := decodeWAL(buf, db.opts.WALMaxRecordSize, db.wal.cipher, send)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				return fmt.Errorf("subscribe: wal at %s: %w", pos, err)
+			}
+		}
+		if next != pos {
+			pos = next
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(subscribePollInterval):
+		}
+	}
+}
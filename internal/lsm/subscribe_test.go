@@ -0,0 +1,156 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// nextChange 从订阅中读取一次提交，超时则测试失败
+func nextChange(t *testing.T, s *Subscription) Change {
+	t.Helper()
+	select {
+	case c, ok := <-s.Changes():
+		if !ok {
+			t.Fatalf("订阅意外结束: %v", s.Err())
+		}
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("等待变更超时")
+	}
+	return Change{}
+}
+
+// changeKeys 返回提交中的 key，形如 "cf/key"，默认列族省略前缀
+func changeKeys(c Change) string {
+	var s string
+	for i, e := range c.Entries {
+		if i > 0 {
+			s += ","
+		}
+		if e.ColumnFamily != "" {
+			s += e.ColumnFamily + "/"
+		}
+		s += e.Key
+	}
+	return s
+}
+
+func TestDB_Subscribe(t *testing.T) {
+	opts := DefaultOptions()
+	opts.WALSegmentSize = 256
+	db, err := Open(t.TempDir(), opts)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	for i := range 5 {
+		if err := db.Set(fmt.Sprintf("k%d", i), make([]byte, 64)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		fromSeq int64
+		want    []string
+	}{
+		{"从头订阅", 0, []string{"k0", "k1", "k2", "k3", "k4"}},
+		{"从中间订阅", 3, []string{"k3", "k4"}},
+		{"从最新订阅", 5, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := db.Subscribe(context.Background(), tt.fromSeq)
+			if err != nil {
+				t.Fatalf("订阅失败: %v", err)
+			}
+			defer s.Close()
+			for i, want := range tt.want {
+				c := nextChange(t, s)
+				if got := changeKeys(c); got != want || c.Seq != tt.fromSeq+int64(i)+1 {
+					t.Fatalf("期望 %s@%d, 实际 %s@%d", want, tt.fromSeq+int64(i)+1, got, c.Seq)
+				}
+			}
+			select {
+			case c := <-s.Changes():
+				t.Fatalf("不期望更多的变更: %v", changeKeys(c))
+			case <-time.After(3 * subscribePollInterval):
+			}
+		})
+	}
+
+	// 订阅之后的写入按提交顺序到达，批次作为一次提交
+	s, err := db.Subscribe(context.Background(), 5)
+	if err != nil {
+		t.Fatalf("订阅失败: %v", err)
+	}
+	users, err := db.CF("users")
+	if err != nil {
+		t.Fatalf("获取列族失败: %v", err)
+	}
+	b := NewWriteBatch()
+	b.Set("x", []byte("1"))
+	b.Delete("k0")
+	b.SetCF(users, "u1", []byte("alice"))
+	if err := db.Write(b); err != nil {
+		t.Fatalf("写入批次失败: %v", err)
+	}
+	if err := db.Delete("x"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if c := nextChange(t, s); changeKeys(c) != "x,k0,users/u1" || c.Seq != 8 || !c.Entries[1].Tombstone {
+		t.Fatalf("批次的变更不正确: %s@%d", changeKeys(c), c.Seq)
+	}
+	if c := nextChange(t, s); changeKeys(c) != "x" || c.Seq != 9 || !c.Entries[0].Tombstone {
+		t.Fatalf("删除的变更不正确: %s@%d", changeKeys(c), c.Seq)
+	}
+	s.Close()
+	if _, ok := <-s.Changes(); ok || !errors.Is(s.Err(), context.Canceled) {
+		t.Fatalf("Close 之后期望 context.Canceled, 实际 %v", s.Err())
+	}
+
+	// 订阅位置所在的段被删除
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s, err = db.Subscribe(ctx, 0)
+	if err != nil {
+		t.Fatalf("订阅失败: %v", err)
+	}
+	segments := db.wal.Segments()
+	if err := db.wal.RemoveSegmentsBefore(segments[len(segments)-1]); err != nil {
+		t.Fatalf("删除段失败: %v", err)
+	}
+	for range s.Changes() {
+	}
+	if !errors.Is(s.Err(), ErrWALPositionGone) {
+		t.Fatalf("期望 ErrWALPositionGone, 实际 %v", s.Err())
+	}
+
+	// 数据库关闭时订阅结束
+	s, err = db.Subscribe(context.Background(), 9)
+	if err != nil {
+		t.Fatalf("订阅失败: %v", err)
+	}
+	db.Close()
+	for range s.Changes() {
+	}
+	if !errors.Is(s.Err(), ErrClosed) {
+		t.Fatalf("期望 ErrClosed, 实际 %v", s.Err())
+	}
+	if _, err := db.Subscribe(context.Background(), 0); !errors.Is(err, ErrClosed) {
+		t.Fatalf("期望 ErrClosed, 实际 %v", err)
+	}
+
+	mem, err := Open(InMemory, DefaultOptions())
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer mem.Close()
+	if _, err := mem.Subscribe(context.Background(), 0); !errors.Is(err, ErrInMemory) {
+		t.Fatalf("期望 ErrInMemory, 实际 %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package lsm
+
+import "fmt"
+
+// SyncMode 决定 WAL 何时 fsync，用持久性换取吞吐
+type SyncMode int
+
+const (
+	// SyncEveryWrite 每次写入（一次组提交）都 fsync，崩溃时不丢失已返回成功的写入
+	SyncEveryWrite SyncMode = iota
+	// SyncPeriodic 由后台按 Options.SyncPeriod 周期 fsync，崩溃时最多丢失一个周期内的写入
+	SyncPeriodic
+	// NoSync 从不主动 fsync，由操作系统决定何时落盘，只在段切换和关闭时 fsync
+	NoSync
+)
+
+func (m SyncMode) String() string {
+	switch m {
+	case SyncEveryWrite:
+		return "SyncEveryWrite"
+	case SyncPeriodic:
+		return "SyncPeriodic"
+	case NoSync:
+		return "NoSync"
+	default:
+		return fmt.Sprintf("SyncMode(%d)", int(m))
+	}
+}
+
+// WALSyncMethod 决定 WAL 需要持久化时（时机见 SyncMode）使用的系统调用
+type WALSyncMethod int
+
+const (
+	// WALSyncFsync 调用 fsync，同时持久化数据与全部元数据
+	WALSyncFsync WALSyncMethod = iota
+	// WALSyncFdatasync 调用 fdatasync，跳过修改时间等无关元数据，通常能降低 fsync 的尾延迟；
+	// 非 Linux 平台退化为 fsync
+	WALSyncFdatasync
+	// WALSyncDSync 以 O_DSYNC 打开段文件，每次写入返回前已经持久化，不再单独 fsync。
+	// 所有写入都会同步落盘，因此只适合 SyncEveryWrite 模式；
+	// 平台或文件系统不支持时退化为 WALSyncFdatasync
+	WALSyncDSync
+)
+
+func (m WALSyncMethod) String() string {
+	switch m {
+	case WALSyncFsync:
+		return "fsync"
+	case WALSyncFdatasync:
+		return "fdatasync"
+	case WALSyncDSync:
+		return "O_DSYNC"
+	default:
+		return fmt.Sprintf("WALSyncMethod(%d)", int(m))
+	}
+}
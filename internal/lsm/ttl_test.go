@@ -0,0 +1,91 @@
+package lsm
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeClock 可手动推进的时钟
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestDB_TTL(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir)
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	db.now = clock.Now
+
+	if err := db.Set("shadowed", []byte("old")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	for key, ttl := range map[string]time.Duration{"short": time.Second, "long": time.Hour, "shadowed": time.Second} {
+		if err := db.SetWithTTL(key, []byte(key), ttl); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := db.Set("forever", []byte("forever")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.SetWithTTL("bad", []byte("v"), 0); !errors.Is(err, ErrInvalidTTL) {
+		t.Fatalf("期望 ErrInvalidTTL, 实际 %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		live    []string
+	}{
+		{name: "均未过期", advance: 0, live: []string{"forever", "long", "shadowed", "short"}},
+		{name: "刚好到期", advance: time.Second, live: []string{"forever", "long"}},
+		{name: "长 TTL 到期", advance: time.Hour, live: []string{"forever"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.Advance(tt.advance)
+
+			entries, err := db.Scan("", "~")
+			if err != nil {
+				t.Fatalf("扫描失败: %v", err)
+			}
+			var got []string
+			for _, e := range entries {
+				got = append(got, e.Key)
+			}
+			if !slices.Equal(got, tt.live) {
+				t.Fatalf("期望可见 %v, 实际 %v", tt.live, got)
+			}
+
+			// 过期的新版本同样遮蔽旧版本，shadowed 不会回退到 "old"
+			for _, key := range []string{"short", "long", "shadowed", "forever"} {
+				_, err := db.Get(key)
+				if want := slices.Contains(tt.live, key); (err == nil) != want {
+					t.Errorf("Get(%s) 期望可见 %v, 实际错误 %v", key, want, err)
+				}
+			}
+		})
+	}
+
+	// 重新打开后过期时间随 WAL 恢复
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	db = openTestDB(t, dir)
+	defer db.Close()
+	db.now = (&fakeClock{now: time.Unix(1700000000, 0)}).Now
+
+	expireAt, err := db.ExpireAt("long")
+	if err != nil {
+		t.Fatalf("获取过期时间失败: %v", err)
+	}
+	if want := time.Unix(1700000000, 0).Add(time.Hour); !expireAt.Equal(want) {
+		t.Fatalf("期望过期时间 %v, 实际 %v", want, expireAt)
+	}
+	if expireAt, err := db.ExpireAt("forever"); err != nil || !expireAt.IsZero() {
+		t.Fatalf("永不过期的 key 期望零值, 实际 %v %v", expireAt, err)
+	}
+}
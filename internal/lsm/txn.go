@@ -0,0 +1,149 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrConflict = errors.New("transaction conflict")
+	ErrTxnDone  = errors.New("transaction has already been committed or rolled back")
+)
+
+// Txn 是基于快照的乐观事务
+//
+//   - 读取：先读事务自己缓冲的写入，再读事务开始时的快照，并记录读过的 key
+//   - 写入：缓冲在事务内部，提交前对其他读取者不可见
+//   - 提交：读过或写过的 key 只要在快照之后被其他提交修改过，就返回 ErrConflict；
+//     否则所有写入作为一个 WriteBatch 原子地提交
+//
+// 冲突检测在组提交的 leader 中按提交顺序执行，检测与写入之间不会插入其他提交。
+// 事务内的范围读取不会被跟踪，因此不能防止幻读。Txn 不是并发安全的。
+type Txn struct {
+	db    *DB
+	snap  *Snapshot
+	batch *WriteBatch
+	// writes key -> 该 key 在 batch 中最后一次操作的下标
+	writes map[string]int
+	reads  map[string]struct{}
+	done   bool
+}
+
+// Begin 开始一个事务，事务结束时必须调用 Commit 或 Rollback
+func (db *DB) Begin() (*Txn, error) {
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		return nil, fmt.Errorf("begin txn: %w", err)
+	}
+	return &Txn{
+		db:     db,
+		snap:   snap,
+		batch:  NewWriteBatch(),
+		writes: make(map[string]int),
+		reads:  make(map[string]struct{}),
+	}, nil
+}
+
+// Get 读取 key，事务自己的写入优先于快照中的数据
+func (t *Txn) Get(key string) ([]byte, error) {
+	if t.done {
+		return nil, ErrTxnDone
+	}
+
+	if i, ok := t.writes[key]; ok {
+		op := t.batch.ops[i]
+		if op.tombstone || (op.expireAt != 0 && op.expireAt <= t.db.now().UnixNano()) {
+			return nil, ErrNotFound
+		}
+		return op.value, nil
+	}
+
+	t.reads[key] = struct{}{}
+	return t.snap.Get(key)
+}
+
+// Set 在事务中缓冲一次写入
+func (t *Txn) Set(key string, value []byte) error {
+	if t.done {
+		return ErrTxnDone
+	}
+	if err := t.db.checkSize(key, value); err != nil {
+		return fmt.Errorf("txn set %s: %w", key, err)
+	}
+	t.writes[key] = t.batch.Len()
+	t.batch.Set(key, value)
+	return nil
+}
+
+// Delete 在事务中缓冲一次删除
+func (t *Txn) Delete(key string) error {
+	if t.done {
+		return ErrTxnDone
+	}
+	if err := t.db.checkSize(key, nil); err != nil {
+		return fmt.Errorf("txn delete %s: %w", key, err)
+	}
+	t.writes[key] = t.batch.Len()
+	t.batch.Delete(key)
+	return nil
+}
+
+// Commit 检测冲突并原子地提交事务中的所有写入
+func (t *Txn) Commit() error {
+	if t.done {
+		return ErrTxnDone
+	}
+	t.done = true
+	defer t.snap.Release()
+
+	// 只读事务读到的是一致的快照，无需检测冲突
+	if t.batch.Len() == 0 {
+		return nil
+	}
+	if err := t.db.checkBatch(t.batch); err != nil {
+		return fmt.Errorf("commit txn: %w", err)
+	}
+
+	keys := make([]string, 0, len(t.reads)+len(t.writes))
+	for key := range t.reads {
+		keys = append(keys, key)
+	}
+	for key := range t.writes {
+		if _, ok := t.reads[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	t.db.mu.RLock()
+	defer t.db.mu.RUnlock()
+	if t.db.closed {
+		return ErrClosed
+	}
+
+	entries := t.batch.entries()
+	err := t.db.memTable.commitRequest(&commitRequest{
+		entries:   entries,
+		checkKeys: keys,
+		readSeq:   t.snap.Seq(),
+	})
+	if err != nil {
+		return fmt.Errorf("commit txn: %w", err)
+	}
+	t.batch.seq = entries[len(entries)-1].Version
+	return nil
+}
+
+// Seq 返回事务提交时分配给最后一个写入的序列号，语义同 WriteBatch.Seq；
+// 事务未提交、提交失败或没有写入时返回 0
+func (t *Txn) Seq() int64 {
+	return t.batch.seq
+}
+
+// Rollback 丢弃事务中的所有写入，对已结束的事务调用是安全的
+func (t *Txn) Rollback() {
+	if t.done {
+		return
+	}
+	t.done = true
+	t.snap.Release()
+}
@@ -0,0 +1,249 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestTxn_Conflict(t *testing.T) {
+	tests := []struct {
+		name    string
+		txn     func(txn *Txn) error
+		other   func(db *DB) error
+		wantErr error
+	}{
+		{
+			name: "读过的key被其他提交修改",
+			txn: func(txn *Txn) error {
+				if _, err := txn.Get("a"); err != nil {
+					return err
+				}
+				return txn.Set("b", []byte("from-txn"))
+			},
+			other:   func(db *DB) error { return db.Set("a", []byte("changed")) },
+			wantErr: ErrConflict,
+		},
+		{
+			name: "写过的key被其他提交修改",
+			txn: func(txn *Txn) error {
+				return txn.Set("a", []byte("from-txn"))
+			},
+			other:   func(db *DB) error { return db.Delete("a") },
+			wantErr: ErrConflict,
+		},
+		{
+			name: "读过的不存在的key被其他提交写入",
+			txn: func(txn *Txn) error {
+				if _, err := txn.Get("missing"); !errors.Is(err, ErrNotFound) {
+					return fmt.Errorf("期望 ErrNotFound, 实际 %v", err)
+				}
+				return txn.Set("b", []byte("from-txn"))
+			},
+			other:   func(db *DB) error { return db.Set("missing", []byte("x")) },
+			wantErr: ErrConflict,
+		},
+		{
+			name: "修改无关的key不冲突",
+			txn: func(txn *Txn) error {
+				if _, err := txn.Get("a"); err != nil {
+					return err
+				}
+				return txn.Set("b", []byte("from-txn"))
+			},
+			other: func(db *DB) error { return db.Set("c", []byte("x")) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, t.TempDir())
+			defer db.Close()
+			if err := db.Set("a", []byte("a0")); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+
+			txn, err := db.Begin()
+			if err != nil {
+				t.Fatalf("开始事务失败: %v", err)
+			}
+			if err := tt.txn(txn); err != nil {
+				t.Fatalf("事务操作失败: %v", err)
+			}
+			if err := tt.other(db); err != nil {
+				t.Fatalf("并发写入失败: %v", err)
+			}
+
+			err = txn.Commit()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("期望错误 %v, 实际错误 %v", tt.wantErr, err)
+			}
+
+			_, err = db.Get("b")
+			if tt.wantErr != nil && !errors.Is(err, ErrNotFound) {
+				t.Errorf("冲突的事务不应有任何写入生效, 实际 %v", err)
+			}
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("提交成功的事务写入应可见, 实际 %v", err)
+			}
+		})
+	}
+}
+
+func TestTxn_ReadYourWritesAndRollback(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+
+	txn, err := db.Begin()
+	if err != nil {
+		t.Fatalf("开始事务失败: %v", err)
+	}
+	if err := txn.Set("k", []byte("v")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if got, err := txn.Get("k"); err != nil || string(got) != "v" {
+		t.Fatalf("事务内应读到自己的写入, 实际 %q %v", got, err)
+	}
+	if _, err := db.Get("k"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("未提交的写入对外不可见, 实际 %v", err)
+	}
+	if err := txn.Delete("k"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if _, err := txn.Get("k"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("事务内删除后应读不到, 实际 %v", err)
+	}
+
+	txn.Rollback()
+	txn.Rollback()
+	if err := txn.Commit(); !errors.Is(err, ErrTxnDone) {
+		t.Fatalf("回滚后提交期望 ErrTxnDone, 实际 %v", err)
+	}
+	if _, err := db.Get("k"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("回滚的写入不应生效, 实际 %v", err)
+	}
+}
+
+// 测试并发事务计数器：冲突时重试，最终结果不丢失更新
+func TestTxn_ConcurrentCounter(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+	if err := db.Set("counter", []byte("0")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	const workers, perWorker = 4, 25
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; {
+				txn, err := db.Begin()
+				if err != nil {
+					t.Errorf("开始事务失败: %v", err)
+					return
+				}
+				v, err := txn.Get("counter")
+				if err != nil {
+					t.Errorf("读取失败: %v", err)
+					return
+				}
+				n, _ := strconv.Atoi(string(v))
+				txn.Set("counter", []byte(strconv.Itoa(n+1)))
+
+				err = txn.Commit()
+				if errors.Is(err, ErrConflict) {
+					continue
+				}
+				if err != nil {
+					t.Errorf("提交失败: %v", err)
+					return
+				}
+				i++
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := db.Get("counter")
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if want := strconv.Itoa(workers * perWorker); string(got) != want {
+		t.Fatalf("期望 %s, 实际 %s", want, got)
+	}
+}
+
+// 测试写了一半的批量记录在恢复时整体丢弃
+func TestWAL_TornBatch(t *testing.T) {
+	wal, _ := createTestWAL(t)
+	defer wal.fd.Close()
+
+	b := NewWriteBatch()
+	b.Set("a", []byte("1"))
+	b.Set("b", []byte("2"))
+	b.Delete("c")
+
+	if _, err := wal.Write(b.entries()[0]); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if _, err := wal.WriteBatch(b.entries()); err != nil {
+		t.Fatalf("批量写入失败: %v", err)
+	}
+
+	got, err := wal.ReadAll()
+	if err != nil || len(got) != 4 {
+		t.Fatalf("期望读取 4 条记录, 实际 %d 条 %v", len(got), err)
+	}
+
+	stat, err := wal.fd.Stat()
+	if err != nil {
+		t.Fatalf("无法获取文件信息: %v", err)
+	}
+	if err := wal.fd.Truncate(stat.Size() - 1); err != nil {
+		t.Fatalf("截断失败: %v", err)
+	}
+
+	got, err = wal.ReadAll()
+	if err != nil {
+		t.Fatalf("读取不应失败: %v", err)
+	}
+	if len(got) != 1 || got[0].Key != "a" {
+		t.Fatalf("写了一半的批量记录应整体丢弃, 实际读取 %d 条", len(got))
+	}
+}
+
+func TestDB_WriteBatch(t *testing.T) {
+	dir := t.TempDir()
+	db := openTestDB(t, dir)
+	if err := db.Set("c", []byte("old")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	b := NewWriteBatch()
+	b.Set("a", []byte("1"))
+	b.Set("b", []byte("2"))
+	b.Delete("c")
+	if err := db.Write(b); err != nil {
+		t.Fatalf("提交批次失败: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	db = openTestDB(t, dir)
+	defer db.Close()
+	entries, err := db.Scan("a", "z")
+	if err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Key != "a" || entries[1].Key != "b" {
+		t.Fatalf("期望恢复 a、b 两条记录, 实际 %v", entries)
+	}
+	if entries[0].Version+1 != entries[1].Version {
+		t.Errorf("同一批次的序列号应连续, 实际 %d %d", entries[0].Version, entries[1].Version)
+	}
+}
@@ -0,0 +1,96 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+// MaxUserMetaSize 单个条目用户元数据的长度上限
+const MaxUserMetaSize = 64 << 10
+
+// ErrUserMetaTooLarge 用户元数据的长度超过 MaxUserMetaSize
+var ErrUserMetaTooLarge = errors.New("user meta too large")
+
+// checkUserMeta 检查用户元数据的长度
+func checkUserMeta(meta []byte) error {
+	if len(meta) > MaxUserMetaSize {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrUserMetaTooLarge, len(meta), MaxUserMetaSize)
+	}
+	return nil
+}
+
+// SetWithMeta 写入或覆盖一个键值对，并附带用户元数据 meta
+//
+// meta 是对引擎不透明的字节串，用于标记内容类型、schema 版本等信息，而不必编码进 value 中。
+// 它与 value 一起写入 WAL 与 MemTable，由 GetWithMeta 与 Scan 返回的条目原样读出。
+// 元数据属于写入的这个版本：之后不带元数据的 Set 覆盖该 key 时元数据随之清空。
+// 与 Set 一样保存调用方的切片，写入之后不能再修改 meta
+func (db *DB) SetWithMeta(key string, value, meta []byte) error {
+	t := db.startOp("set", key, "")
+	defer t.done()
+
+	if err := db.checkSize(key, value); err != nil {
+		return fmt.Errorf("set %s: %w", key, err)
+	}
+	if err := checkUserMeta(meta); err != nil {
+		return fmt.Errorf("set %s: %w", key, err)
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+
+	entry := &sdbf.Entry{
+		Key:      key,
+		Value:    value,
+		UserMeta: meta,
+	}
+	req := &commitRequest{entries: []*sdbf.Entry{entry}}
+	err := db.memTable.commitRequest(req)
+	t.commit(req)
+	if err != nil {
+		return fmt.Errorf("set %s: %w", key, err)
+	}
+	return nil
+}
+
+// GetWithMeta 返回 key 对应的值与写入时附带的用户元数据，没有元数据时 meta 为 nil；
+// key 不存在、已被删除或已过期时返回 ErrNotFound
+func (db *DB) GetWithMeta(key string) (value, meta []byte, err error) {
+	t := db.startOp("get", key, "")
+	defer t.done()
+
+	entry, err := db.readEntry(db.memTable.def, key, ReadOptions{})
+	t.stage("memtable")
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry.Value, entry.UserMeta, nil
+}
+
+// SetWithMeta 在列族中写入一个附带用户元数据的键值对，见 DB.SetWithMeta
+func (cf *ColumnFamily) SetWithMeta(key string, value, meta []byte) error {
+	if err := checkUserMeta(meta); err != nil {
+		return fmt.Errorf("cf %s: write %s: %w", cf.Name(), key, err)
+	}
+	return cf.write(&sdbf.Entry{Key: key, Value: value, UserMeta: meta})
+}
+
+// GetWithMeta 返回列族中 key 对应的值与用户元数据，见 DB.GetWithMeta
+func (cf *ColumnFamily) GetWithMeta(key string) (value, meta []byte, err error) {
+	entry, err := cf.db.readEntry(cf.f, key, ReadOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+	return entry.Value, entry.UserMeta, nil
+}
+
+// SetWithMeta 在批次中追加一次附带用户元数据的写入，见 DB.SetWithMeta
+func (b *WriteBatch) SetWithMeta(key string, value, meta []byte) {
+	b.ops = append(b.ops, batchOp{key: key, value: value, meta: meta})
+}
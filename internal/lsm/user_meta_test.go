@@ -0,0 +1,123 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// 测试用户元数据随写入保存、重启后从 WAL 恢复，不带元数据的覆盖写入清空元数据
+func TestDB_UserMeta(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	cf, err := db.CF("docs")
+	if err != nil {
+		t.Fatalf("创建列族失败: %v", err)
+	}
+	if err := db.SetWithMeta("a", []byte("{}"), []byte("application/json")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := cf.SetWithMeta("c", []byte("v"), []byte("schema=2")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	b := NewWriteBatch()
+	b.SetWithMeta("b", []byte("v"), []byte("batch"))
+	b.Set("plain", []byte("v"))
+	if err := db.Write(b); err != nil {
+		t.Fatalf("提交批次失败: %v", err)
+	}
+	if err := db.SetWithMeta("overwritten", []byte("v1"), []byte("old")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Set("overwritten", []byte("v2")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	check := func(t *testing.T, db *DB) {
+		cf, err := db.CF("docs")
+		if err != nil {
+			t.Fatalf("打开列族失败: %v", err)
+		}
+		tests := []struct {
+			key       string
+			get       func(string) ([]byte, []byte, error)
+			wantValue string
+			wantMeta  []byte
+		}{
+			{key: "a", get: db.GetWithMeta, wantValue: "{}", wantMeta: []byte("application/json")},
+			{key: "b", get: db.GetWithMeta, wantValue: "v", wantMeta: []byte("batch")},
+			{key: "c", get: cf.GetWithMeta, wantValue: "v", wantMeta: []byte("schema=2")},
+			{key: "plain", get: db.GetWithMeta, wantValue: "v"},
+			{key: "overwritten", get: db.GetWithMeta, wantValue: "v2"},
+		}
+		for _, tt := range tests {
+			value, meta, err := tt.get(tt.key)
+			if err != nil || string(value) != tt.wantValue || !bytes.Equal(meta, tt.wantMeta) {
+				t.Fatalf("%s 期望 %q %q, 实际 %q %q %v", tt.key, tt.wantValue, tt.wantMeta, value, meta, err)
+			}
+		}
+		entries, err := db.Scan("a", "a")
+		if err != nil || len(entries) != 1 || string(entries[0].UserMeta) != "application/json" {
+			t.Fatalf("Scan 应返回元数据: %v %v", entries, err)
+		}
+		if _, _, err := db.GetWithMeta("missing"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("期望 ErrNotFound, 实际 %v", err)
+		}
+	}
+	check(t, db)
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	db, err = Open(dir, Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer db.Close()
+	check(t, db)
+}
+
+// 测试元数据的长度上限，以及校验和覆盖元数据
+func TestDB_UserMetaLimits(t *testing.T) {
+	db, err := Open(t.TempDir(), Options{SyncMode: NoSync, EntryChecksums: true})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	cf, err := db.CF("docs")
+	if err != nil {
+		t.Fatalf("创建列族失败: %v", err)
+	}
+	large := make([]byte, MaxUserMetaSize+1)
+	b := NewWriteBatch()
+	b.SetWithMeta("k", nil, large)
+	tests := []struct {
+		name  string
+		write func() error
+	}{
+		{name: "DB", write: func() error { return db.SetWithMeta("k", nil, large) }},
+		{name: "列族", write: func() error { return cf.SetWithMeta("k", nil, large) }},
+		{name: "批次", write: func() error { return db.Write(b) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.write(); !errors.Is(err, ErrUserMetaTooLarge) {
+				t.Fatalf("期望 ErrUserMetaTooLarge, 实际 %v", err)
+			}
+		})
+	}
+
+	meta := []byte("text/plain")
+	if err := db.SetWithMeta("k", []byte("v"), meta); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	// SetWithMeta 保存的是调用方的切片，修改它相当于 MemTable 中的元数据被破坏
+	meta[0] ^= 0xff
+	if _, _, err := db.GetWithMeta("k"); !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("期望 ErrChecksumMismatch, 实际 %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package lsm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+// Severity 一致性问题的严重程度
+type Severity int
+
+const (
+	// SeverityWarning 不影响已确认写入的数据，Open 会自动处理（例如截断写了一半的尾部记录）
+	SeverityWarning Severity = iota
+	// SeverityError 有数据无法恢复或 Open 会失败，需要人工处理
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// ConsistencyProblem 是 VerifyConsistency 发现的一个问题
+type ConsistencyProblem struct {
+	Severity Severity
+	// Path 出现问题的文件或目录，Offset 为问题在文件中的偏移，与具体位置无关时为 -1
+	Path   string
+	Offset int64
+	// Message 问题的描述，Repair 为建议的修复步骤
+	Message string
+	Repair  string
+}
+
+func (p ConsistencyProblem) String() string {
+	if p.Offset >= 0 {
+		return fmt.Sprintf("%s: %s at offset %d: %s", p.Severity, p.Path, p.Offset, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", p.Severity, p.Path, p.Message)
+}
+
+// ConsistencyReport 是 VerifyConsistency 的结果
+type ConsistencyReport struct {
+	// Segments 校验的 WAL 段数，Records 与 Entries 为完好的记录与条目数，Bytes 为段文件的总大小
+	Segments int
+	Records  int
+	Entries  int
+	Bytes    int64
+	// LastSequence 完好的条目中最大的序列号
+	LastSequence int64
+	Problems     []ConsistencyProblem
+}
+
+// OK 报告是否没有 SeverityError 级别的问题
+func (r *ConsistencyReport) OK() bool {
+	for _, p := range r.Problems {
+		if p.Severity == SeverityError {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *ConsistencyReport) add(sev Severity, path string, offset int64, msg, repair string) {
+	r.Problems = append(r.Problems, ConsistencyProblem{Severity: sev, Path: path, Offset: offset, Message: msg, Repair: repair})
+}
+
+// VerifyConsistency 离线检查 dir 下的数据库，不修改 WAL，返回发现的问题及修复建议
+//
+// 检查内容：OPTIONS 文件能否读取、是否与当前构建兼容，WAL 目录是否存在、段序号是否连续、
+// 每个段的每条记录能否完整读取与解析（CRC、解压、解密，长度上限与密钥取自 opts）、是否有中断的操作遗留的临时文件。
+// 活跃段（最后一个段）末尾写了一半的记录是崩溃后的正常现象，只作为警告报告。
+// 目前数据只存在于 WAL 中，没有 manifest 与 SSTable 需要检查
+//
+// 检查期间持有数据目录的锁，数据库正在被其他进程使用时返回 ErrLocked
+func VerifyConsistency(dir string, opts Options) (ConsistencyReport, error) {
+	opts = opts.withDefaults()
+	fsys := opts.FS
+	var report ConsistencyReport
+
+	if _, err := fsys.Stat(dir); err != nil {
+		return report, fmt.Errorf("verify %s: %w", dir, err)
+	}
+	lock, err := fsys.Lock(filepath.Join(dir, lockFileName))
+	if errors.Is(err, vfs.ErrLocked) {
+		return report, fmt.Errorf("verify %s: %w", dir, ErrLocked)
+	}
+	if err != nil {
+		return report, fmt.Errorf("verify %s: lock: %w", dir, err)
+	}
+	defer lock.Close()
+
+	optionsPath := filepath.Join(dir, optionsFileName)
+	if p, found, err := readOptionsFile(fsys, dir); err != nil {
+		report.add(SeverityError, optionsPath, -1, err.Error(), "remove the file; Open recreates it from the options it is given")
+	} else if found {
+		if err := p.checkCompatible(persistOptions(opts)); err != nil {
+			report.add(SeverityError, optionsPath, -1, err.Error(), "open the directory with a build compatible with the OPTIONS file")
+		}
+	}
+
+	c, err := newWALCipher(opts.EncryptionKeys)
+	if err != nil {
+		return report, fmt.Errorf("verify %s: %w", dir, err)
+	}
+
+	walDir := filepath.Join(dir, walDirName)
+	names, err := fsys.List(walDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		report.add(SeverityError, walDir, -1, "wal directory does not exist",
+			"check that the path is a data directory; an empty database is created by Open")
+		return report, nil
+	}
+	if err != nil {
+		return report, fmt.Errorf("verify %s: %w", dir, err)
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, ".tmp") {
+			report.add(SeverityWarning, filepath.Join(walDir, name), -1, "temporary file left by an interrupted operation",
+				"remove the file; it is never read")
+		}
+	}
+
+	ids, err := listSegments(fsys, walDir)
+	if err != nil {
+		return report, fmt.Errorf("verify %s: %w", dir, err)
+	}
+	for i, id := range ids {
+		path := filepath.Join(walDir, segmentName(id))
+		if i > 0 && id != ids[i-1]+1 {
+			report.add(SeverityError, path, -1,
+				fmt.Sprintf("segments %s to %s are missing", segmentName(ids[i-1]+1), segmentName(id-1)),
+				"copy the missing segments back from the wal archive (Options.WALArchiveDir) if one exists, "+
+					"otherwise restore the database from a backup; records in the missing segments are lost")
+		}
+		if err := verifySegment(fsys, path, i == len(ids)-1, opts.WALMaxRecordSize, c, &report); err != nil {
+			return report, fmt.Errorf("verify %s: %w", dir, err)
+		}
+	}
+	return report, nil
+}
+
+// verifySegment 校验一个段，结果计入 report；last 表示该段是活跃段
+func verifySegment(fsys vfs.FS, path string, last bool, limit int64, c *walCipher, report *ConsistencyReport) error {
+	fd, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	fi, err := fd.Stat()
+	if err != nil {
+		return fmt.Errorf("stat %s: %w", path, err)
+	}
+	report.Segments++
+	report.Bytes += fi.Size()
+
+	err = decodeWAL(bufio.NewReader(fd), limit, c, func(rec WALRecord) error {
+		report.Records++
+		report.Entries += len(rec.Entries)
+		for _, e := range rec.Entries {
+			report.LastSequence = max(report.LastSequence, e.Version)
+		}
+		return nil
+	})
+	var corruption *WALCorruptionError
+	switch {
+	case err == nil:
+	case errors.As(err, &corruption) && last:
+		report.add(SeverityWarning, path, corruption.Offset,
+			fmt.Sprintf("incomplete or corrupt tail (%d bytes): %v", fi.Size()-corruption.Offset, corruption.Err),
+			"usually a write interrupted by a crash; Open truncates it unless RecoveryMode is AbsoluteConsistency")
+	case errors.As(err, &corruption):
+		report.add(SeverityError, path, corruption.Offset,
+			fmt.Sprintf("corrupt record in a sealed segment, %d bytes after it are unreadable: %v", fi.Size()-corruption.Offset, corruption.Err),
+			"restore from a backup if possible; otherwise open with RecoveryMode SkipCorruptRecords to keep the readable "+
+				"records (the segment is truncated at the corruption), and inspect it first with sdbf-cli wal-dump")
+	case errors.Is(err, ErrEncryptionKey), errors.Is(err, ErrDecrypt):
+		report.add(SeverityError, path, -1, err.Error(),
+			"provide the key the segment was written with (Options.EncryptionKeys, sdbf-cli -key-file)")
+	default:
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestVerifyConsistency(t *testing.T) {
+	opts := Options{SyncMode: NoSync, WALSegmentSize: 512, EncryptionKeys: testKey}
+	tests := []struct {
+		name string
+		// damage 在关闭的数据库上制造问题
+		damage func(t *testing.T, walDir string)
+		// keys 检查时使用的密钥
+		keys KeyProvider
+		want []Severity
+	}{
+		{name: "完好", damage: func(*testing.T, string) {}, keys: testKey},
+		{
+			name:   "活跃段尾部不完整",
+			damage: func(t *testing.T, walDir string) { appendBytes(t, lastSegment(t, walDir), []byte{1, 2, 3}) },
+			keys:   testKey,
+			want:   []Severity{SeverityWarning},
+		},
+		{
+			name:   "封存的段损坏",
+			damage: func(t *testing.T, walDir string) { flipByte(t, filepath.Join(walDir, segmentName(1)), walHeaderSize) },
+			keys:   testKey,
+			want:   []Severity{SeverityError},
+		},
+		{
+			name: "缺少中间的段",
+			damage: func(t *testing.T, walDir string) {
+				if err := os.Remove(filepath.Join(walDir, segmentName(2))); err != nil {
+					t.Fatal(err)
+				}
+			},
+			keys: testKey,
+			want: []Severity{SeverityError},
+		},
+		{
+			name: "遗留的临时文件",
+			damage: func(t *testing.T, walDir string) {
+				if err := os.WriteFile(filepath.Join(walDir, segmentName(1)+".tmp"), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			keys: testKey,
+			want: []Severity{SeverityWarning},
+		},
+		{name: "缺少密钥", damage: func(*testing.T, string) {}, want: []Severity{SeverityError}},
+		{
+			name: "OPTIONS 不兼容",
+			damage: func(t *testing.T, walDir string) {
+				editOptionsFile(t, filepath.Dir(walDir), func(p *persistedOptions) { p.Comparator = "reverse" })
+			},
+			keys: testKey,
+			want: []Severity{SeverityError},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := Open(dir, opts)
+			if err != nil {
+				t.Fatalf("打开数据库失败: %v", err)
+			}
+			for i := range 30 {
+				if err := db.Set(fmt.Sprintf("key-%02d", i), bytes.Repeat([]byte{'v'}, 64)); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+			}
+			if _, err := VerifyConsistency(dir, opts); !errors.Is(err, ErrLocked) {
+				t.Fatalf("数据库打开期间期望 ErrLocked, 实际 %v", err)
+			}
+			db.Close()
+			tt.damage(t, filepath.Join(dir, walDirName))
+
+			o := opts
+			o.EncryptionKeys = tt.keys
+			report, err := VerifyConsistency(dir, o)
+			if err != nil {
+				t.Fatalf("检查失败: %v", err)
+			}
+			var got []Severity
+			for _, p := range report.Problems {
+				// 同一问题可能出现在多个段中，只比较出现过的严重程度
+				if !slices.Contains(got, p.Severity) {
+					got = append(got, p.Severity)
+				}
+				if p.Repair == "" {
+					t.Errorf("%v 缺少修复建议", p)
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("期望 %v, 实际 %v", tt.want, report.Problems)
+			}
+			wantOK := !strings.Contains(fmt.Sprint(tt.want), "error")
+			if report.OK() != wantOK {
+				t.Fatalf("OK() 期望 %v", wantOK)
+			}
+			if len(tt.want) == 0 && (report.Entries != 30 || report.LastSequence != 30 || report.Segments < 3) {
+				t.Fatalf("统计不正确: %+v", report)
+			}
+		})
+	}
+
+	report, err := VerifyConsistency(t.TempDir(), opts)
+	if err != nil || report.OK() {
+		t.Fatalf("没有 WAL 目录时期望报告错误: %+v %v", report, err)
+	}
+}
+
+// lastSegment 返回 walDir 中序号最大的段
+func lastSegment(t *testing.T, walDir string) string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(walDir, "*.wal"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("找不到 WAL 段: %v", err)
+	}
+	return paths[len(paths)-1]
+}
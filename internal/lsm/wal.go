@@ -1,34 +1,99 @@
 package lsm
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
-	"os"
+	"log/slog"
+	"path/filepath"
 	"sync"
 
 	"google.golang.org/protobuf/proto"
 
 	"github.com/aireet/SimpleDBForge/api/sdbf"
 	"github.com/aireet/SimpleDBForge/internal/utils"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
 )
 
 var (
 	errNilFD            = errors.New("fd must not be nil")
 	errInvalidEntrySize = errors.New("invalid entry size")
 	errCorruptedWAL     = errors.New("WAL file is corrupted")
+	errChecksumMismatch = errors.New("checksum mismatch")
 )
 
+// walHeaderSize 每条记录头部的大小：8字节长度 + 4字节校验和
+const walHeaderSize = 8 + 4
+
+// walMaxPrealloc 读取记录时按长度字段预分配的上限，
+// 长度字段损坏时不会因为一个巨大的长度而一次性分配内存，超出部分随读取逐步扩容
+const walMaxPrealloc = 1 << 20
+
+// 长度字段的最高字节存放记录标志位，低 56 位为数据长度
+const (
+	walFlagShift  = 56
+	walLengthMask = 1<<walFlagShift - 1
+
+	// walFlagBatch 批量记录，数据内容为多个条目
+	walFlagBatch byte = 1 << 0
+	// walFlagCompressed 数据内容经过压缩：[1字节 CodecID][压缩后的数据]，
+	// 校验和覆盖压缩后的数据，解压后按其余标志位解析
+	walFlagCompressed byte = 1 << 1
+	// walFlagEncrypted 数据内容（压缩之后）经过加密，格式见 encryption.go
+	walFlagEncrypted byte = 1 << 2
+	// walFlagTyped 数据内容（解密、解压之后）以一个字节的记录类型开头，见 WALRecordType
+	walFlagTyped byte = 1 << 3
+
+	walKnownFlags = walFlagBatch | walFlagCompressed | walFlagEncrypted | walFlagTyped
+)
+
+// walCompressMinSize 数据内容短于该长度的记录不压缩：压缩率低且白白消耗 CPU
+const walCompressMinSize = 256
+
+// 预分配（Options.WALPreallocate）或回收（Options.WALRecycleSegments）的活跃段在数据之后
+// 是全 0 的空间。记录的长度字段不会为 0，读到全 0 的头部即视为数据结束，与文件结束等价；
+// 段封存时会截断到实际的数据长度，封存的段与普通段没有区别
+
+// walVersion 当前 WAL 文件格式版本
+// v2.0 起每条记录带有 CRC32C 校验和
+const walVersion = "v2.0"
+
+// crcTable CRC32C (Castagnoli) 多项式表，现代 CPU 有硬件指令加速
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
 type WAL struct {
 	mu      sync.Mutex
-	fd      *os.File
+	fd      vfs.File
 	dir     string
 	path    string
 	version string
+	// size 当前文件大小，用于判断是否需要切换段
+	size int64
+	// syncMode 决定 Write 是否在返回前 fsync
+	syncMode SyncMode
+	// syncMethod 持久化使用的系统调用；dsync 为 true 时文件以 O_DSYNC 打开，写入已经持久化
+	syncMethod WALSyncMethod
+	dsync      bool
+	// preallocated 文件在 size 之后还有全 0 的预分配空间或写入失败留下的残留，封存时需要截断
+	preallocated bool
+	// codec 写入时压缩记录的算法，为 nil 时不压缩；读取时按记录中的 CodecID 解压，与它无关
+	codec utils.Codec
+	// maxRecordSize 记录数据部分（压缩前）的长度上限，写入时超出的记录被拒绝，读取时超出的记录视为损坏，
+	// 见 Options.WALMaxRecordSize；为 0 时使用 WALMaxRecordSizeLimit
+	maxRecordSize int64
+	// cipher 不为 nil 时写入的记录被加密；读取加密的记录时必须设置，见 Options.EncryptionKeys
+	cipher *walCipher
+
+	// corrupted 为 true 时 corruptedAt 记录第一条损坏记录的起始偏移，corruptedErr 为损坏的原因
+	corrupted    bool
+	corruptedAt  int64
+	corruptedErr error
 }
 
-func NewWAL(fd *os.File, dir, path, version string) *WAL {
+func NewWAL(fd vfs.File, dir, path, version string) *WAL {
 	return &WAL{
 		fd:      fd,
 		dir:     dir,
@@ -37,7 +102,191 @@ func NewWAL(fd *os.File, dir, path, version string) *WAL {
 	}
 }
 
+// recordLimit 返回记录数据部分的长度上限，见 maxRecordSize
+func (w *WAL) recordLimit() int64 {
+	if w.maxRecordSize <= 0 {
+		return WALMaxRecordSizeLimit
+	}
+	return w.maxRecordSize
+}
+
+// OpenWAL 打开 fs 中 dir 目录下名为 name 的 WAL 文件，文件不存在时自动创建
+func OpenWAL(fs vfs.FS, dir, name string) (*WAL, error) {
+	return openWAL(fs, dir, name, WALSyncFsync)
+}
+
+// openWAL 同 OpenWAL，按 method 持久化写入，见 WALSyncMethod
+func openWAL(fs vfs.FS, dir, name string, method WALSyncMethod) (*WAL, error) {
+	path := filepath.Join(dir, name)
+	var (
+		fd    vfs.File
+		err   error
+		dsync bool
+	)
+	if dfs, ok := fs.(vfs.DSyncFS); ok && method == WALSyncDSync {
+		fd, err = dfs.OpenReadWriteDSync(path)
+		dsync = true
+	} else {
+		fd, err = fs.OpenReadWrite(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open wal %s: %w", path, err)
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, fmt.Errorf("stat wal %s: %w", path, err)
+	}
+	w := NewWAL(fd, dir, path, walVersion)
+	w.size, err = findEnd(fd, stat.Size())
+	if err != nil {
+		fd.Close()
+		return nil, fmt.Errorf("find end of wal %s: %w", path, err)
+	}
+	w.preallocated = w.size < stat.Size()
+	w.syncMethod = method
+	w.dsync = dsync
+	return w, nil
+}
+
+// findEnd 返回数据的结束位置：文件末尾不是全 0 时就是文件大小，
+// 否则从头依次跳过每条记录，直到读到全 0 的头部（见 walFlagShift 之后的说明）。
+// 只解析头部而不校验数据，损坏的记录由恢复过程发现并截断
+func findEnd(fd vfs.File, fileSize int64) (int64, error) {
+	var header [walHeaderSize]byte
+	if fileSize < walHeaderSize {
+		return fileSize, nil
+	}
+	if _, err := fd.Seek(fileSize-walHeaderSize, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err := io.ReadFull(fd, header[:]); err != nil {
+		return 0, err
+	}
+	if header != [walHeaderSize]byte{} {
+		return fileSize, nil
+	}
+
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	var offset int64
+	for offset+walHeaderSize <= fileSize {
+		if _, err := io.ReadFull(fd, header[:]); err != nil {
+			return 0, err
+		}
+		length := int64(binary.LittleEndian.Uint64(header[:8]) & walLengthMask)
+		if length == 0 || offset+walHeaderSize+length > fileSize {
+			break
+		}
+		offset += walHeaderSize + length
+		if _, err := fd.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+	}
+	return offset, nil
+}
+
+// preallocate 把文件预分配到 size 字节，见 vfs.Preallocate
+func (w *WAL) preallocate(size int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.fd == nil {
+		return errNilFD
+	}
+	if w.size >= size {
+		return nil
+	}
+	if err := vfs.Preallocate(w.fd, size); err != nil {
+		return fmt.Errorf("preallocate wal %s: %w", w.path, err)
+	}
+	w.preallocated = true
+	return nil
+}
+
+// trim 截断数据之后的预分配空间，段封存前调用
+func (w *WAL) trim() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.fd == nil {
+		return errNilFD
+	}
+	if !w.preallocated {
+		return nil
+	}
+	if err := w.fd.Truncate(w.size); err != nil {
+		return fmt.Errorf("trim wal %s at %d: %w", w.path, w.size, err)
+	}
+	w.preallocated = false
+	return nil
+}
+
+// Size 返回当前数据的大小，不包含预分配的空间
+func (w *WAL) Size() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size
+}
+
+// Close 关闭底层文件，关闭后的 WAL 不可再读写
+func (w *WAL) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.fd == nil {
+		return nil
+	}
+	err := w.fd.Close()
+	w.fd = nil
+	if err != nil {
+		return fmt.Errorf("close wal %s: %w", w.path, err)
+	}
+	return nil
+}
+
 func (w *WAL) Write(entries ...*sdbf.Entry) (int, error) {
+	return w.write(false, func(buf *bytes.Buffer) (int, error) {
+		count := 0
+		for _, entry := range entries {
+			if err := appendEntryFrame(buf, entry, w.codec, w.cipher, w.recordLimit()); err != nil {
+				return count, err
+			}
+			count++
+		}
+		return count, nil
+	})
+}
+
+// WriteBatch 将每组条目编码为一条批量记录写入
+// 批量记录只有一个校验和，崩溃后恢复时一组条目要么全部可见要么全部不可见
+func (w *WAL) WriteBatch(batches ...[]*sdbf.Entry) (int, error) {
+	return w.writeBatch(false, batches...)
+}
+
+// writeBatch 同 WriteBatch，noSync 为 true 时即使是 SyncEveryWrite 模式也不 fsync
+func (w *WAL) writeBatch(noSync bool, batches ...[]*sdbf.Entry) (int, error) {
+	return w.write(noSync, func(buf *bytes.Buffer) (int, error) {
+		count := 0
+		for _, batch := range batches {
+			var err error
+			if len(batch) == 1 {
+				err = appendEntryFrame(buf, batch[0], w.codec, w.cipher, w.recordLimit())
+			} else {
+				err = appendBatchFrame(buf, batch, w.codec, w.cipher, w.recordLimit())
+			}
+			if err != nil {
+				return count, err
+			}
+			count += len(batch)
+		}
+		return count, nil
+	})
+}
+
+// write 将 encode 编码好的记录一次性追加到文件末尾，SyncEveryWrite 模式下除非 noSync 为 true 随后 fsync
+func (w *WAL) write(noSync bool, encode func(buf *bytes.Buffer) (int, error)) (int, error) {
 
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -45,45 +294,152 @@ func (w *WAL) Write(entries ...*sdbf.Entry) (int, error) {
 	if w.fd == nil {
 		return 0, errNilFD
 	}
-	// 将文件指针移动到文件末尾, 用于实现 WAL 追加
-	if _, err := w.fd.Seek(0, io.SeekEnd); err != nil {
+	// 将文件指针移动到数据末尾, 用于实现 WAL 追加；预分配的文件在数据之后还有空间
+	if _, err := w.fd.Seek(w.size, io.SeekStart); err != nil {
 		return 0, err
 	}
 
 	buf := utils.Pool.Get()
 	defer utils.Pool.Put(buf)
 
-	count := 0
-	for _, entry := range entries {
+	count, err := encode(buf)
+	if err != nil {
+		return count, err
+	}
 
-		// [数据长度] + [数据内容] 小端序
-		// ## 为什么选择小端序
-		// 1. 兼容性好 ：x86/x64 架构（最常见的服务器架构）使用小端序
-		// 2. 性能优势 ：在小端序机器上无需字节序转换
-		// 3. 标准选择 ：许多网络协议和文件格式采用小端序
+	// 写入磁盘；中途失败时 size 保持不变，下一次写入从 size 开始覆盖写了一半的记录。
+	// 覆盖不完的残留在所有完整记录之后，恢复时作为损坏的尾部丢弃，封存时与预分配空间一起截断
+	n, err := buf.WriteTo(w.fd)
+	if err != nil {
+		if n > 0 {
+			w.preallocated = true
+		}
+		return count, err
+	}
+	w.size += n
+	if w.syncMode == SyncEveryWrite && !noSync {
+		if err := w.syncFile(); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// syncFile 按 syncMethod 持久化已写入的数据，调用方需持有 mu
+func (w *WAL) syncFile() error {
+	switch {
+	case w.dsync:
+		return nil
+	case w.syncMethod == WALSyncFsync:
+		return w.fd.Sync()
+	default:
+		return vfs.SyncData(w.fd)
+	}
+}
+
+// appendEntryFrame 将单个条目编码为一条记录，codec 不为 nil 时尝试压缩，c 不为 nil 时加密，
+// 编码后超过 limit 字节时返回 ErrBatchTooLarge
+func appendEntryFrame(buf *bytes.Buffer, entry *sdbf.Entry, codec utils.Codec, c *walCipher, limit int64) error {
+	data, err := proto.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return appendEncodedFrame(buf, 0, data, codec, c, limit)
+}
+
+// appendBatchFrame 将一组条目编码为一条批量记录，
+// 数据内容为依次排列的 [uvarint 长度][protobuf Entry]，codec 不为 nil 时整体压缩，c 不为 nil 时整体加密
+func appendBatchFrame(buf *bytes.Buffer, entries []*sdbf.Entry, codec utils.Codec, c *walCipher, limit int64) error {
+	payload := utils.Pool.Get()
+	defer utils.Pool.Put(payload)
+
+	var lenBuf [binary.MaxVarintLen64]byte
+	for _, entry := range entries {
 		data, err := proto.Marshal(entry)
 		if err != nil {
-			return count, err
+			return err
 		}
-		// 写入数据长度（8字节）
-		if err := binary.Write(buf, binary.LittleEndian, int64(len(data))); err != nil {
-			return count, fmt.Errorf("failed to write data length: %w", err)
+		payload.Write(lenBuf[:binary.PutUvarint(lenBuf[:], uint64(len(data)))])
+		payload.Write(data)
+	}
+	return appendEncodedFrame(buf, walFlagBatch, payload.Bytes(), codec, c, limit)
+}
+
+// appendEncodedFrame 压缩、加密 data 后写入一条记录：codec 不为 nil 时用它压缩并带上 walFlagCompressed，
+// 数据太短或压缩后没有变小时不压缩；c 不为 nil 时再加密并带上 walFlagEncrypted
+func appendEncodedFrame(buf *bytes.Buffer, flags byte, data []byte, codec utils.Codec, c *walCipher, limit int64) error {
+	// 限制的是压缩前的长度：读取时解压后的数据同样受 limit 限制，超出的数据即使能压缩到上限以内也不写入
+	if int64(len(data)) > limit {
+		return fmt.Errorf("%w: record of %d bytes exceeds %d", ErrBatchTooLarge, len(data), limit)
+	}
+	if codec != nil && len(data) >= walCompressMinSize {
+		scratch := utils.Pool.Get()
+		defer utils.Pool.Put(scratch)
+		compressed := append(scratch.AvailableBuffer(), byte(codec.ID()))
+		compressed = codec.Encode(compressed, data)
+		if len(compressed) < len(data) {
+			data, flags = compressed, flags|walFlagCompressed
 		}
-		// 写入实际数据内容
-		if _, err := buf.Write(data); err != nil {
-			return count, fmt.Errorf("failed to write data: %w", err)
+	}
+	if c != nil {
+		sealed := utils.Pool.Get()
+		defer utils.Pool.Put(sealed)
+		flags |= walFlagEncrypted
+		var err error
+		if data, err = c.seal(sealed.AvailableBuffer(), flags, data); err != nil {
+			return err
 		}
-		count++
 	}
+	return appendFrame(buf, flags, data)
+}
 
-	// 写入磁盘
-	if _, err := buf.WriteTo(w.fd); err != nil {
-		return count, err
+// appendFrame 写入一条记录：[数据长度|标志位] + [CRC32C] + [数据内容] 小端序
+//
+// ## 为什么选择小端序
+// 1. 兼容性好 ：x86/x64 架构（最常见的服务器架构）使用小端序
+// 2. 性能优势 ：在小端序机器上无需字节序转换
+// 3. 标准选择 ：许多网络协议和文件格式采用小端序
+//
+// 长度由调用方按各自的上限检查，这里只检查格式本身的上限
+func appendFrame(buf *bytes.Buffer, flags byte, data []byte) error {
+	if len(data) > WALMaxRecordSizeLimit+walEncryptionOverhead {
+		return fmt.Errorf("%w: record of %d bytes exceeds %d", ErrBatchTooLarge, len(data), WALMaxRecordSizeLimit)
 	}
-	if err := w.fd.Sync(); err != nil {
-		return count, err
+	// 写入数据长度（8字节），最高字节存放标志位
+	header := int64(len(data)) | int64(flags)<<walFlagShift
+	if err := binary.Write(buf, binary.LittleEndian, header); err != nil {
+		return fmt.Errorf("failed to write data length: %w", err)
 	}
-	return count, nil
+	// 写入数据内容的校验和（4字节）
+	if err := binary.Write(buf, binary.LittleEndian, crc32.Checksum(data, crcTable)); err != nil {
+		return fmt.Errorf("failed to write checksum: %w", err)
+	}
+	// 写入实际数据内容
+	if _, err := buf.Write(data); err != nil {
+		return fmt.Errorf("failed to write data: %w", err)
+	}
+	return nil
+}
+
+// setSyncMode 修改之后的写入使用的 SyncMode
+func (w *WAL) setSyncMode(mode SyncMode) {
+	w.mu.Lock()
+	w.syncMode = mode
+	w.mu.Unlock()
+}
+
+// Sync 将已写入的数据 fsync 到磁盘，用于 SyncPeriodic / NoSync 模式下手动控制持久化时机
+func (w *WAL) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.fd == nil {
+		return errNilFD
+	}
+	if err := w.syncFile(); err != nil {
+		return fmt.Errorf("sync wal %s: %w", w.path, err)
+	}
+	return nil
 }
 
 func (w *WAL) ReadAll() ([]*sdbf.Entry, error) {
@@ -116,98 +472,252 @@ func (w *WAL) ReadAll() ([]*sdbf.Entry, error) {
 	return Allentries, nil
 }
 
-func (w *WAL) ReadBatch(batchSize int) (chan []*sdbf.Entry, error) {
-
-	if w.fd == nil {
-		return nil, errNilFD
-	}
-
-	entryChan := make(chan []*sdbf.Entry)
-
-	go func() {
-
-		w.mu.Lock()
-		defer w.mu.Unlock()
-
-		// 将文件指针移动到文件开头
-		if _, err := w.fd.Seek(0, io.SeekStart); err != nil {
-			panic(err)
+// ReadBatch 返回按批读取 w 中记录的迭代器，见 WALBatchReader
+func (w *WAL) ReadBatch(batchSize int) *WALBatchReader {
+	done := false
+	return newWALBatchReader(batchSize, func() (*WAL, bool, error) {
+		if done {
+			return nil, false, nil
 		}
-
-		for {
-
-			entries, hasMore, err := w.readNext(batchSize)
-			if err != nil {
-				err = fmt.Errorf("read wal failed: %w", err)
-				panic(err)
-			}
-
-			entryChan <- entries
-			if !hasMore {
-				close(entryChan)
-				break
-			}
-
-		}
-
-	}()
-
-	return entryChan, nil
+		done = true
+		return w, false, nil
+	})
 }
 
 // readNext 连续读取指定数量的记录，不重置文件指针
+//
+// 遇到不完整（写入中途崩溃）或校验失败的记录时停止读取并返回之前已读到的记录，
+// 同时记录损坏位置，由 truncateCorruptedTail 在恢复结束后截断
 func (w *WAL) readNext(maxCount int) ([]*sdbf.Entry, bool, error) {
 	if w.fd == nil {
 		return nil, false, errNilFD
 	}
 
+	offset, err := w.fd.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get wal offset: %w", err)
+	}
+
 	var entries []*sdbf.Entry
 	buf := utils.Pool.Get()
 	defer utils.Pool.Put(buf)
 
 	for i := 0; i < maxCount; i++ {
-		// 读取数据长度
-		var dataLen int64
-		// 这里 binary.Read 消耗了文件指针的前8个字节 ，读取完后文件指针已经移动到第9个字节的位置。
-		// 位置:  [0-7]     [8-242]
-		// 内容:  [235]  [JSON数据...]
-		err := binary.Read(w.fd, binary.LittleEndian, &dataLen)
+		es, n, err := w.readRecord(buf)
 		if err == io.EOF {
 			return entries, false, nil // 到达文件末尾，hasMore = false
 		}
+		if errors.Is(err, errCorruptedWAL) {
+			slog.Warn("wal corrupted, stop reading", "path", w.path, "offset", offset, "err", err)
+			w.corrupted = true
+			w.corruptedAt = offset
+			w.corruptedErr = err
+			return entries, false, nil
+		}
 		if err != nil {
-			return nil, false, fmt.Errorf("failed to read entry length: %w", err)
+			return nil, false, err
 		}
 
-		// 验证数据长度的合理性
-		if dataLen <= 0 {
-			return nil, false, fmt.Errorf("%w: non-positive length %d", errInvalidEntrySize, dataLen)
-		}
+		offset += n
+		entries = append(entries, es...)
+	}
+
+	return entries, true, nil // 读满指定数量，hasMore = true
+}
+
+// readRecord 读取一条记录，返回其中的条目（批量记录包含多个）及记录占用的字节数
+//
+// 文件干净地结束时返回 io.EOF，记录不完整或校验失败时返回包装了 errCorruptedWAL 的错误
+func (w *WAL) readRecord(buf *bytes.Buffer) ([]*sdbf.Entry, int64, error) {
+	rec, err := decodeRecord(w.fd, buf, w.recordLimit(), w.cipher)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rec.Entries, rec.Size(), nil
+}
+
+// decodeRecord 从 r 中解码一条记录，buf 用于暂存记录数据，数据部分压缩前后都不能超过 limit 字节，
+// 加密的记录用 c 解密，错误约定同 readRecord
+func decodeRecord(r io.Reader, buf *bytes.Buffer, limit int64, c *walCipher) (WALRecord, error) {
+	rec, err := readFrame(r, buf, limit)
+	if err != nil {
+		return rec, err
+	}
+	return decodeFrame(rec, buf.Bytes(), limit, c)
+}
 
-		// 准备buffer用于读取数据
-		buf.Reset()
-		if buf.Cap() < int(dataLen) {
-			buf.Grow(int(dataLen))
+// readFrame 从 r 中读取一条记录的头部与数据（放入 buf），不校验也不解析数据，
+// 错误约定同 readRecord：只有不完整的记录与不合法的头部（包括超过 limit 的长度）会在这里被发现
+func readFrame(r io.Reader, buf *bytes.Buffer, limit int64) (WALRecord, error) {
+	var rec WALRecord
+
+	// 读取数据长度
+	var header int64
+	// 这里 binary.Read 消耗了文件指针的前8个字节 ，读取完后文件指针已经移动到第9个字节的位置。
+	// 位置:  [0-7]  [8-11]   [12-246]
+	// 内容:  [235]  [CRC32C] [protobuf数据...]
+	err := binary.Read(r, binary.LittleEndian, &header)
+	if err == io.EOF || (err == nil && header == 0) {
+		// 全 0 的头部是预分配空间的开始，数据到此结束
+		return rec, io.EOF
+	}
+	if err == io.ErrUnexpectedEOF {
+		return rec, fmt.Errorf("%w: incomplete entry length", errCorruptedWAL)
+	}
+	if err != nil {
+		return rec, fmt.Errorf("failed to read entry length: %w", err)
+	}
+
+	rec.Flags = byte(uint64(header) >> walFlagShift)
+	rec.Length = header & walLengthMask
+	if rec.Flags&^walKnownFlags != 0 {
+		return rec, fmt.Errorf("%w: unknown record flags %#x", errCorruptedWAL, rec.Flags)
+	}
+
+	// 验证数据长度的合理性：写入时不会产生超出 limit 的记录，超出时长度字段已经损坏，
+	// 在分配内存之前拒绝
+	if rec.Length <= 0 {
+		return rec, fmt.Errorf("%w: %w: non-positive length %d", errCorruptedWAL, errInvalidEntrySize, rec.Length)
+	}
+	if rec.Flags&walFlagEncrypted != 0 {
+		limit += walEncryptionOverhead
+	}
+	if rec.Length > limit {
+		return rec, fmt.Errorf("%w: %w: length %d exceeds %d", errCorruptedWAL, errInvalidEntrySize, rec.Length, limit)
+	}
+
+	err = binary.Read(r, binary.LittleEndian, &rec.Checksum)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return rec, fmt.Errorf("%w: incomplete entry checksum", errCorruptedWAL)
+	}
+	if err != nil {
+		return rec, fmt.Errorf("failed to read entry checksum: %w", err)
+	}
+
+	// 准备buffer用于读取数据
+	buf.Reset()
+	if n := int(min(rec.Length, walMaxPrealloc)); buf.Cap() < n {
+		buf.Grow(n)
+	}
+
+	// 直接从文件读取到buffer中
+	n, err := io.CopyN(buf, r, rec.Length)
+	if err == io.EOF {
+		return rec, fmt.Errorf("%w: incomplete entry data, expected %d bytes, got %d", errCorruptedWAL, rec.Length, n)
+	}
+	if err != nil {
+		return rec, fmt.Errorf("failed to read entry data: %w", err)
+	}
+	return rec, nil
+}
+
+// decodeFrame 校验 readFrame 读到的数据并解析出其中的条目，
+// 不访问文件，可以在多个 goroutine 中并行执行。压缩记录解压后超过 limit 字节时视为损坏
+//
+// 加密的记录用 c 解密：c 为 nil、取不到密钥或解密失败时返回的错误不包装 errCorruptedWAL，
+// 这些记录通过了 CRC 校验，恢复时不能当作损坏的尾部截断；包含无法识别的条目记录类型
+// 或 WAL 记录类型时同理，返回 ErrUnsupportedFormat
+func decodeFrame(rec WALRecord, data []byte, limit int64, c *walCipher) (WALRecord, error) {
+	if crc32.Checksum(data, crcTable) != rec.Checksum {
+		return rec, fmt.Errorf("%w: %w", errCorruptedWAL, errChecksumMismatch)
+	}
+
+	var err error
+	if rec.Flags&walFlagEncrypted != 0 {
+		plain := utils.Pool.Get()
+		defer utils.Pool.Put(plain)
+		data, rec.KeyID, err = c.open(plain.AvailableBuffer(), rec.Flags, data)
+		if err != nil {
+			return rec, err
+		}
+	}
+	if rec.Flags&walFlagCompressed != 0 {
+		if len(data) == 0 {
+			return rec, fmt.Errorf("%w: compressed record without codec id", errCorruptedWAL)
+		}
+		codec, cerr := utils.CodecByID(utils.CodecID(data[0]))
+		if cerr != nil {
+			return rec, fmt.Errorf("%w: %w", errCorruptedWAL, cerr)
 		}
+		rec.Codec = codec.ID()
 
-		// 直接从文件读取到buffer中
-		n, err := io.CopyN(buf, w.fd, dataLen)
+		scratch := utils.Pool.Get()
+		defer utils.Pool.Put(scratch)
+		data, err = utils.DecodeLimit(codec, scratch.AvailableBuffer(), data[1:], int(limit))
 		if err != nil {
-			return nil, false, fmt.Errorf("failed to read entry data: %w", err)
+			return rec, fmt.Errorf("%w: decompress %s: %w", errCorruptedWAL, codec.Name(), err)
 		}
-		if n != dataLen {
-			return nil, false, fmt.Errorf("%w: incomplete entry data, expected %d bytes, got %d", errCorruptedWAL, dataLen, n)
+	}
+
+	if rec.Flags&walFlagTyped != 0 {
+		if len(data) == 0 {
+			return rec, fmt.Errorf("%w: typed record without type", errCorruptedWAL)
 		}
-		data := buf.Bytes()
+		rec.Type, data = WALRecordType(data[0]), data[1:]
+	}
+	if rec.Type != WALRecordEntries {
+		return decodeControl(rec, data)
+	}
 
-		// 反序列化数据
+	// 反序列化数据
+	if rec.Flags&walFlagBatch != 0 {
+		rec.Entries, err = decodeBatch(data)
+	} else {
 		e := &sdbf.Entry{}
-		if err := proto.Unmarshal(data, e); err != nil {
-			return nil, false, fmt.Errorf("failed to unmarshal entry: %w", err)
+		err = proto.Unmarshal(data, e)
+		rec.Entries = []*sdbf.Entry{e}
+	}
+	if err != nil {
+		return rec, fmt.Errorf("%w: failed to unmarshal entry: %w", errCorruptedWAL, err)
+	}
+	if err := upgradeEntries(rec.Entries); err != nil {
+		return rec, err
+	}
+
+	return rec, nil
+}
+
+// decodeBatch 解析批量记录的数据内容
+func decodeBatch(data []byte) ([]*sdbf.Entry, error) {
+	var entries []*sdbf.Entry
+	for len(data) > 0 {
+		size, n := binary.Uvarint(data)
+		if n <= 0 || size > uint64(len(data)-n) {
+			return nil, fmt.Errorf("%w: bad batch entry length", errInvalidEntrySize)
 		}
+		data = data[n:]
 
+		e := &sdbf.Entry{}
+		if err := proto.Unmarshal(data[:size], e); err != nil {
+			return nil, err
+		}
 		entries = append(entries, e)
+		data = data[size:]
 	}
+	return entries, nil
+}
 
-	return entries, true, nil // 读满指定数量，hasMore = true
+// truncateCorruptedTail 截断读取过程中发现的损坏尾部
+// 否则之后追加的记录会排在损坏数据之后，下次恢复时将无法读到
+func (w *WAL) truncateCorruptedTail() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.truncateCorruptedTailLocked()
+}
+
+func (w *WAL) truncateCorruptedTailLocked() error {
+	if !w.corrupted {
+		return nil
+	}
+	if w.fd == nil {
+		return errNilFD
+	}
+	if err := w.fd.Truncate(w.corruptedAt); err != nil {
+		return fmt.Errorf("truncate wal %s at %d: %w", w.path, w.corruptedAt, err)
+	}
+	w.size = w.corruptedAt
+	w.preallocated = false
+	slog.Warn("wal corrupted tail truncated", "path", w.path, "offset", w.corruptedAt)
+	w.corrupted = false
+	return nil
 }
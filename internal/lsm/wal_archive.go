@@ -0,0 +1,181 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// WALArchiveRetention 归档目录的保留策略，两个条件同时生效，零值表示永久保留
+//
+// 最新的一个归档段总会被保留：重新打开时据此判断哪些段已经归档过
+type WALArchiveRetention struct {
+	// MaxSegments 最多保留的归档段数量
+	MaxSegments int
+	// MaxAge 归档段（按修改时间，即封存时间）的最长保留时间
+	MaxAge time.Duration
+}
+
+// startArchiver 启动后台归档协程，归档 dir 中已有的最大序号之后的所有封存段
+//
+// 目前数据只存在于 MemTable 与 WAL 中，封存的段仍是恢复所必需的，归档只复制而不移动；
+// RemoveSegmentsBefore 不会删除还未归档的段，保证归档目录中的段是连续的
+func (m *WALManager) startArchiver(dir string, retention WALArchiveRetention) error {
+	if err := m.fs.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create wal archive dir %s: %w", dir, err)
+	}
+	ids, err := listSegments(m.fs, dir)
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		m.archived.Store(ids[len(ids)-1])
+	}
+
+	m.archiveDir = dir
+	m.retention = retention
+	m.archiveKick = make(chan struct{}, 1)
+	m.stopArchive = make(chan struct{})
+	m.archiveDone.Add(1)
+	go m.archiveLoop()
+	// 归档上次关闭之前还没来得及归档的段
+	m.kickArchiver()
+	return nil
+}
+
+// kickArchiver 通知归档协程有新的封存段，不阻塞
+func (m *WALManager) kickArchiver() {
+	if m.archiveKick == nil {
+		return
+	}
+	select {
+	case m.archiveKick <- struct{}{}:
+	default:
+	}
+}
+
+func (m *WALManager) archiveLoop() {
+	defer m.archiveDone.Done()
+	for {
+		select {
+		case <-m.stopArchive:
+			return
+		case <-m.archiveKick:
+			if err := m.archivePending(); err != nil {
+				slog.Error("wal archive failed", "dir", m.dir, "archive", m.archiveDir, "err", err)
+			}
+		}
+	}
+}
+
+// archivePending 按序号依次归档所有还未归档的封存段，然后执行保留策略
+func (m *WALManager) archivePending() error {
+	m.mu.RLock()
+	sealed := slices.Clone(m.segments[:len(m.segments)-1])
+	m.mu.RUnlock()
+
+	archived := m.archived.Load()
+	for _, id := range sealed {
+		if id <= archived {
+			continue
+		}
+		select {
+		case <-m.stopArchive:
+			return nil
+		default:
+		}
+		info, err := m.archiveSegment(id)
+		if err != nil {
+			return err
+		}
+		m.archived.Store(id)
+		archived = id
+		slog.Info("wal segment archived", "path", info.Path, "size", info.Size)
+		m.listener.OnWALArchive(info)
+	}
+	return m.applyRetention(time.Now())
+}
+
+// archiveSegment 把封存的段链接（不支持时复制）到归档目录
+//
+// 开启了段回收时必须复制：回收会原地清零段文件，硬链接的归档会被一并清零
+func (m *WALManager) archiveSegment(id uint64) (WALArchiveInfo, error) {
+	src, dst := filepath.Join(m.dir, segmentName(id)), filepath.Join(m.archiveDir, segmentName(id))
+	linked := false
+	if m.recycleLimit == 0 {
+		err := m.fs.Link(src, dst)
+		if errors.Is(err, fs.ErrExist) {
+			// 上次归档在链接之后、记录进度之前中断
+			err = nil
+		}
+		if err != nil {
+			slog.Warn("link wal segment failed, copy instead", "src", src, "err", err)
+		}
+		linked = err == nil
+	}
+	if linked {
+		if err := syncDir(m.fs, m.archiveDir); err != nil {
+			return WALArchiveInfo{}, err
+		}
+	} else if err := copyFile(m.fs, src, dst); err != nil {
+		return WALArchiveInfo{}, fmt.Errorf("archive wal segment %d: %w", id, err)
+	}
+
+	stat, err := m.fs.Stat(dst)
+	if err != nil {
+		return WALArchiveInfo{}, fmt.Errorf("stat archived wal segment %s: %w", dst, err)
+	}
+	return WALArchiveInfo{Dir: m.archiveDir, Segment: id, Path: dst, Size: stat.Size()}, nil
+}
+
+// applyRetention 按保留策略删除归档目录中过旧的段，最新的段总会被保留
+func (m *WALManager) applyRetention(now time.Time) error {
+	r := m.retention
+	if r.MaxSegments <= 0 && r.MaxAge <= 0 {
+		return nil
+	}
+	ids, err := listSegments(m.fs, m.archiveDir)
+	if err != nil {
+		return err
+	}
+
+	removed := false
+	for i, id := range ids[:max(len(ids)-1, 0)] {
+		path := filepath.Join(m.archiveDir, segmentName(id))
+		expired := r.MaxSegments > 0 && len(ids)-i > r.MaxSegments
+		if !expired && r.MaxAge > 0 {
+			stat, err := m.fs.Stat(path)
+			if err != nil {
+				return fmt.Errorf("stat archived wal segment %s: %w", path, err)
+			}
+			expired = now.Sub(stat.ModTime()) > r.MaxAge
+		}
+		if !expired {
+			// 段按序号（也就是封存时间）排列，之后的段更新
+			break
+		}
+		if err := m.fs.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("remove archived wal segment %s: %w", path, err)
+		}
+		removed = true
+		slog.Info("archived wal segment removed", "path", path)
+	}
+	if removed {
+		return syncDir(m.fs, m.archiveDir)
+	}
+	return nil
+}
+
+// stopArchiver 停止归档协程，正在归档的段会先完成
+func (m *WALManager) stopArchiver() {
+	if m.stopArchive == nil {
+		return
+	}
+	close(m.stopArchive)
+	m.archiveDone.Wait()
+	m.stopArchive = nil
+}
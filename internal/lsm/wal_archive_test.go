@@ -0,0 +1,109 @@
+package lsm
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+// archiveListener 把归档事件转发到 channel
+type archiveListener struct {
+	BaseEventListener
+	archived chan WALArchiveInfo
+}
+
+func (l *archiveListener) OnWALArchive(info WALArchiveInfo) {
+	l.archived <- info
+}
+
+// 测试封存的段被归档并按保留策略清理，重新打开后从上次的进度继续归档，归档的段可以用于时间点恢复
+func TestWALManager_Archive(t *testing.T) {
+	dir, archive := t.TempDir(), filepath.Join(t.TempDir(), "archive")
+	listener := &archiveListener{archived: make(chan WALArchiveInfo, 16)}
+	opts := Options{
+		WALArchiveDir:       archive,
+		WALArchiveRetention: WALArchiveRetention{MaxSegments: 2},
+		EventListener:       listener,
+	}
+	waitArchived := func(want ...uint64) {
+		t.Helper()
+		for _, id := range want {
+			select {
+			case info := <-listener.archived:
+				if info.Segment != id || info.Dir != archive || info.Size == 0 {
+					t.Fatalf("期望归档段 %d, 实际 %+v", id, info)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("等待归档段 %d 超时", id)
+			}
+		}
+	}
+
+	m, err := OpenWALManager(dir, opts)
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	var seq int64
+	writeAndRotate := func(m *WALManager, keys ...string) {
+		t.Helper()
+		for _, key := range keys {
+			seq++
+			if _, err := m.Write(&sdbf.Entry{Key: key, Value: []byte("v"), Version: seq}); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+		}
+		if _, err := m.Rotate(); err != nil {
+			t.Fatalf("切换失败: %v", err)
+		}
+	}
+	writeAndRotate(m, "a")
+	writeAndRotate(m, "b")
+	writeAndRotate(m, "c")
+	waitArchived(1, 2, 3)
+	if err := m.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	// 保留策略只保留最新的 2 个归档段
+	ids, err := listSegments(opts.withDefaults().FS, archive)
+	if err != nil {
+		t.Fatalf("列出归档段失败: %v", err)
+	}
+	if !slices.Equal(ids, []uint64{2, 3}) {
+		t.Fatalf("期望归档段 [2 3], 实际 %v", ids)
+	}
+
+	m, err = OpenWALManager(dir, opts)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer m.Close()
+	writeAndRotate(m, "d")
+	waitArchived(4)
+
+	// 已归档的段可以删除，归档中的记录仍然完整
+	if err := m.RemoveSegmentsBefore(4); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if got := m.Segments(); !slices.Equal(got, []uint64{4, 5}) {
+		t.Fatalf("期望段 [4 5], 实际 %v", got)
+	}
+	var keys []string
+	for _, id := range []uint64{3, 4} {
+		err := InspectWAL(filepath.Join(archive, segmentName(id)), nil, func(rec WALRecord) error {
+			for _, e := range rec.Entries {
+				keys = append(keys, e.Key)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("读取归档段 %d 失败: %v", id, err)
+		}
+	}
+	if !slices.Equal(keys, []string{"c", "d"}) {
+		t.Fatalf("归档段中的记录: 期望 [c d], 实际 %v", keys)
+	}
+}
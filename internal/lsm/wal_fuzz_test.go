@@ -0,0 +1,95 @@
+package lsm
+
+import (
+	"bytes"
+	"hash/crc32"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+	"google.golang.org/protobuf/proto"
+)
+
+// fuzzCipher 模糊测试使用的固定密钥
+func fuzzCipher(t testing.TB) *walCipher {
+	c, err := newWALCipher(StaticKey{ID: 7, Secret: bytes.Repeat([]byte{0x42}, 32)})
+	if err != nil {
+		t.Fatalf("创建 walCipher 失败: %v", err)
+	}
+	return c
+}
+
+// fuzzSeedFrames 返回用作种子的合法记录：单条、批量、每种算法压缩后的记录以及加密的记录
+func fuzzSeedFrames(t testing.TB, c *walCipher) [][]byte {
+	entries := []*sdbf.Entry{
+		{Key: "a", Value: []byte("v"), Version: 1},
+		{Key: "b", Value: bytes.Repeat([]byte("SimpleDBForge "), 20), Version: 2},
+		{Key: "c", Version: 3, Tombstone: true},
+	}
+	var frames [][]byte
+	add := func(encode func(buf *bytes.Buffer) error) {
+		var buf bytes.Buffer
+		if err := encode(&buf); err != nil {
+			t.Fatalf("编码种子记录失败: %v", err)
+		}
+		frames = append(frames, buf.Bytes())
+	}
+	add(func(buf *bytes.Buffer) error {
+		return appendEntryFrame(buf, entries[0], nil, nil, WALMaxRecordSizeLimit)
+	})
+	add(func(buf *bytes.Buffer) error { return appendBatchFrame(buf, entries, nil, nil, WALMaxRecordSizeLimit) })
+	add(func(buf *bytes.Buffer) error { return appendBatchFrame(buf, entries, nil, c, WALMaxRecordSizeLimit) })
+	for _, name := range utils.Codecs() {
+		codec, _ := utils.CodecByName(name)
+		add(func(buf *bytes.Buffer) error {
+			return appendEntryFrame(buf, entries[1], codec, nil, WALMaxRecordSizeLimit)
+		})
+		add(func(buf *bytes.Buffer) error {
+			return appendBatchFrame(buf, entries, codec, nil, WALMaxRecordSizeLimit)
+		})
+		add(func(buf *bytes.Buffer) error { return appendBatchFrame(buf, entries, codec, c, WALMaxRecordSizeLimit) })
+	}
+	return frames
+}
+
+// FuzzDecodeRecord 任意字节都不能让记录解码 panic 或按损坏的长度字段分配内存，
+// 解码成功的条目重新编码后应当解码出相同的内容
+func FuzzDecodeRecord(f *testing.F) {
+	c := fuzzCipher(f)
+	for _, frame := range fuzzSeedFrames(f, c) {
+		f.Add(frame)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var buf bytes.Buffer
+		rec, err := decodeRecord(bytes.NewReader(data), &buf, WALMaxRecordSizeLimit, c)
+		if err != nil {
+			return
+		}
+		var again bytes.Buffer
+		if err := appendBatchFrame(&again, rec.Entries, nil, c, WALMaxRecordSizeLimit); err != nil {
+			t.Fatalf("重新编码失败: %v", err)
+		}
+		got, err := decodeRecord(&again, &buf, WALMaxRecordSizeLimit, c)
+		if err != nil || len(got.Entries) != len(rec.Entries) {
+			t.Fatalf("重新编码后解码失败: %d 条, %v", len(got.Entries), err)
+		}
+		for i := range got.Entries {
+			if !proto.Equal(got.Entries[i], rec.Entries[i]) {
+				t.Fatalf("第 %d 条不一致: %v != %v", i, got.Entries[i], rec.Entries[i])
+			}
+		}
+	})
+}
+
+// FuzzDecodeFrame 直接对记录数据部分做模糊测试：校验和按输入计算，
+// 变异后的数据不会被 CRC 挡住，能够到达解压与反序列化
+func FuzzDecodeFrame(f *testing.F) {
+	c := fuzzCipher(f)
+	for _, frame := range fuzzSeedFrames(f, c) {
+		f.Add(byte(frame[7]), frame[walHeaderSize:])
+	}
+	f.Fuzz(func(t *testing.T, flags byte, data []byte) {
+		rec := WALRecord{Flags: flags & walKnownFlags, Length: int64(len(data)), Checksum: crc32.Checksum(data, crcTable)}
+		decodeFrame(rec, data, WALMaxRecordSizeLimit, c)
+	})
+}
@@ -0,0 +1,136 @@
+package lsm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+// WALRecord 是 WAL 中的一条记录（帧），供诊断工具使用
+type WALRecord struct {
+	// Offset 记录在文件中的起始偏移
+	Offset int64
+	// Length 记录数据部分的长度，不含 12 字节头部
+	Length int64
+	// Flags 记录标志位，例如批量记录
+	Flags byte
+	// Codec 压缩记录使用的算法，未压缩时为 utils.CodecNone
+	Codec utils.CodecID
+	// Checksum 头部中存储的 CRC32C
+	Checksum uint32
+	// KeyID 加密记录使用的密钥 ID，未加密时为 0
+	KeyID uint32
+	// Type 记录类型，数据记录为 WALRecordEntries
+	Type WALRecordType
+	// Entries 记录中的条目，批量记录包含多个；控制记录没有条目
+	Entries []*sdbf.Entry
+	// TxnID 事务开始与提交记录中的事务 ID
+	TxnID uint64
+	// ColumnFamily 创建列族记录中的列族名称
+	ColumnFamily string
+}
+
+// Size 返回记录在文件中占用的总字节数
+func (r WALRecord) Size() int64 {
+	return walHeaderSize + r.Length
+}
+
+// IsBatch 记录是否为批量记录
+func (r WALRecord) IsBatch() bool {
+	return r.Flags&walFlagBatch != 0
+}
+
+// IsCompressed 记录是否经过压缩
+func (r WALRecord) IsCompressed() bool {
+	return r.Flags&walFlagCompressed != 0
+}
+
+// IsEncrypted 记录是否经过加密
+func (r WALRecord) IsEncrypted() bool {
+	return r.Flags&walFlagEncrypted != 0
+}
+
+// WALCorruptionError 描述 WAL 中第一条损坏记录的位置
+type WALCorruptionError struct {
+	// Offset 损坏记录的起始偏移，恢复时文件会在这里被截断
+	Offset int64
+	Err    error
+}
+
+func (e *WALCorruptionError) Error() string {
+	return fmt.Sprintf("wal corrupted at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *WALCorruptionError) Unwrap() error {
+	return e.Err
+}
+
+// InspectWAL 只读地遍历 path 指向的 WAL 段文件，按顺序对每条完好的记录调用 fn
+//
+// 与恢复不同，这里不会截断损坏的尾部：遇到不完整或校验失败的记录时返回
+// *WALCorruptionError 说明损坏从哪里开始。fn 返回错误时停止遍历并返回该错误。
+// 加密的记录用 keys 解密，keys 为 nil 时遇到加密的记录返回 ErrEncryptionKey
+func InspectWAL(path string, keys KeyProvider, fn func(rec WALRecord) error) error {
+	c, err := newWALCipher(keys)
+	if err != nil {
+		return fmt.Errorf("inspect wal: %w", err)
+	}
+	return inspectWAL(vfs.OSFS{}, path, c, fn)
+}
+
+// inspectWAL 同 InspectWAL，从 fsys 中读取段文件
+func inspectWAL(fsys vfs.FS, path string, c *walCipher, fn func(rec WALRecord) error) error {
+	fd, err := fsys.Open(path)
+	if err != nil {
+		return fmt.Errorf("inspect wal: %w", err)
+	}
+	defer fd.Close()
+
+	err = decodeWAL(bufio.NewReader(fd), WALMaxRecordSizeLimit, c, fn)
+	var corruption *WALCorruptionError
+	if err != nil && !errors.As(err, &corruption) {
+		return fmt.Errorf("inspect wal %s: %w", path, err)
+	}
+	return err
+}
+
+// DecodeWAL 按顺序解码 r 中的 WAL 记录（与段文件格式相同）并对每条记录调用 fn，
+// 记录的 Offset 相对于 r 的起始位置。错误约定同 InspectWAL
+func DecodeWAL(r io.Reader, keys KeyProvider, fn func(rec WALRecord) error) error {
+	c, err := newWALCipher(keys)
+	if err != nil {
+		return fmt.Errorf("decode wal: %w", err)
+	}
+	return decodeWAL(r, WALMaxRecordSizeLimit, c, fn)
+}
+
+// decodeWAL 同 DecodeWAL，记录数据部分的长度上限为 limit
+func decodeWAL(r io.Reader, limit int64, c *walCipher, fn func(rec WALRecord) error) error {
+	buf := utils.Pool.Get()
+	defer utils.Pool.Put(buf)
+
+	var offset int64
+	for {
+		rec, err := decodeRecord(r, buf, limit, c)
+		if err == io.EOF {
+			return nil
+		}
+		if errors.Is(err, errCorruptedWAL) {
+			return &WALCorruptionError{Offset: offset, Err: err}
+		}
+		if err != nil {
+			return fmt.Errorf("at offset %d: %w", offset, err)
+		}
+
+		rec.Offset = offset
+		if err := fn(rec); err != nil {
+			return fmt.Errorf("at offset %d: %w", offset, err)
+		}
+		offset += rec.Size()
+	}
+}
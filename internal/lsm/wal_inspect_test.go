@@ -0,0 +1,110 @@
+package lsm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+func TestInspectWAL(t *testing.T) {
+	tests := []struct {
+		name string
+		// corrupt 在写入三条记录后破坏文件，sizes 为各条记录的大小
+		corrupt     func(t *testing.T, path string, sizes []int64)
+		wantRecords int
+		wantEntries int
+		// wantCorruptAt 为 -1 表示文件完好
+		wantCorruptAt func(sizes []int64) int64
+	}{
+		{
+			name:          "完好的文件",
+			corrupt:       func(t *testing.T, path string, sizes []int64) {},
+			wantRecords:   3,
+			wantEntries:   4,
+			wantCorruptAt: func(sizes []int64) int64 { return -1 },
+		},
+		{
+			name: "尾部不完整",
+			corrupt: func(t *testing.T, path string, sizes []int64) {
+				appendBytes(t, path, []byte{1, 2, 3})
+			},
+			wantRecords:   3,
+			wantEntries:   4,
+			wantCorruptAt: func(sizes []int64) int64 { return sizes[0] + sizes[1] + sizes[2] },
+		},
+		{
+			name: "第二条记录校验失败",
+			corrupt: func(t *testing.T, path string, sizes []int64) {
+				flipByte(t, path, sizes[0]+walHeaderSize+1)
+			},
+			wantRecords:   1,
+			wantEntries:   1,
+			wantCorruptAt: func(sizes []int64) int64 { return sizes[0] },
+		},
+		{
+			name: "第三条记录长度超过上限",
+			corrupt: func(t *testing.T, path string, sizes []int64) {
+				flipByte(t, path, sizes[0]+sizes[1]+6)
+			},
+			wantRecords:   2,
+			wantEntries:   3,
+			wantCorruptAt: func(sizes []int64) int64 { return sizes[0] + sizes[1] },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wal, path := createTestWAL(t)
+			var sizes []int64
+			write := func(fn func() error) {
+				before := wal.Size()
+				if err := fn(); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+				sizes = append(sizes, wal.Size()-before)
+			}
+			write(func() error { _, err := wal.Write(&sdbf.Entry{Key: "a", Value: []byte("1"), Version: 1}); return err })
+			write(func() error {
+				_, err := wal.WriteBatch([]*sdbf.Entry{
+					{Key: "b", Value: []byte("2"), Version: 2},
+					{Key: "c", Tombstone: true, Version: 3},
+				})
+				return err
+			})
+			write(func() error { _, err := wal.Write(&sdbf.Entry{Key: "d", Value: []byte("4"), Version: 4}); return err })
+			wal.Close()
+
+			tt.corrupt(t, path, sizes)
+
+			var records, entries int
+			var offset int64
+			err := InspectWAL(path, nil, func(rec WALRecord) error {
+				if rec.Offset != offset {
+					t.Errorf("第 %d 条记录期望偏移 %d, 实际 %d", records, offset, rec.Offset)
+				}
+				if rec.IsBatch() != (len(rec.Entries) > 1) {
+					t.Errorf("偏移 %d 的批量标志与条目数不符", rec.Offset)
+				}
+				offset += rec.Size()
+				records++
+				entries += len(rec.Entries)
+				return nil
+			})
+
+			if records != tt.wantRecords || entries != tt.wantEntries {
+				t.Fatalf("期望 %d 条记录 %d 个条目, 实际 %d 条记录 %d 个条目", tt.wantRecords, tt.wantEntries, records, entries)
+			}
+			wantAt := tt.wantCorruptAt(sizes)
+			var corruption *WALCorruptionError
+			switch {
+			case wantAt < 0 && err != nil:
+				t.Fatalf("期望文件完好, 实际 %v", err)
+			case wantAt >= 0 && !errors.As(err, &corruption):
+				t.Fatalf("期望 WALCorruptionError, 实际 %v", err)
+			case wantAt >= 0 && corruption.Offset != wantAt:
+				t.Fatalf("期望损坏位置 %d, 实际 %d", wantAt, corruption.Offset)
+			}
+		})
+	}
+}
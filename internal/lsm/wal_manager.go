@@ -0,0 +1,545 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+const (
+	// walSegmentSuffix WAL 段文件的扩展名
+	walSegmentSuffix = ".wal"
+	// walRecycleSuffix 等待复用的已清零段，例如 000001.recycle
+	walRecycleSuffix = ".recycle"
+)
+
+// walZeroChunk 清零回收的段时每次写入的大小
+const walZeroChunk = 1 << 20
+
+// WALManager 管理一组按序号命名的 WAL 段文件（000001.wal、000002.wal ...）
+//
+// 只有序号最大的段处于活跃状态并接收写入，当活跃段大小超过 segmentSize 时
+// 会被封存并创建新的段。封存的段在其数据被持久化到别处（例如 MemTable 落盘）后
+// 可以通过 RemoveSegmentsBefore 删除。
+type WALManager struct {
+	// mu 保护 active 与 segments：写入持有读锁，段切换持有写锁，
+	// 保证切换时不会有写入落在即将关闭的段上
+	mu          sync.RWMutex
+	fs          vfs.FS
+	dir         string
+	segmentSize int64
+	syncMode    SyncMode
+	syncMethod  WALSyncMethod
+	preallocate bool
+	// recycleLimit 最多保留的回收段数量，recycled 为已清零、等待复用的段（按原序号命名）
+	recycleLimit int
+	recycled     []uint64
+	// codec 新记录使用的压缩算法，为 nil 时不压缩
+	codec utils.Codec
+	// maxRecordSize 与 cipher 为打开的段的 WAL.maxRecordSize 与 WAL.cipher
+	maxRecordSize int64
+	cipher        *walCipher
+	listener      EventListener
+	// recoveryConcurrency 回放时并行解析记录的 goroutine 数，recoveryMode 为损坏记录的处理方式，见 replay
+	recoveryConcurrency int
+	recoveryMode        RecoveryMode
+	// segments 所有存在的段序号，升序排列，最后一个为活跃段
+	segments []uint64
+	active   *WAL
+	// reencryptMu 保证同一时间只有一次 ReencryptWAL，见 wal_reencrypt.go
+	reencryptMu sync.Mutex
+
+	// SyncPeriodic 模式下的后台 fsync 协程，syncErr 为最近一次后台 fsync 的错误，成功后清除
+	stopSync chan struct{}
+	syncDone sync.WaitGroup
+	syncErr  atomic.Pointer[error]
+
+	// 后台归档，见 wal_archive.go；archived 为已归档的最大段序号
+	archiveDir  string
+	retention   WALArchiveRetention
+	archived    atomic.Uint64
+	archiveKick chan struct{}
+	stopArchive chan struct{}
+	archiveDone sync.WaitGroup
+
+	// 后台校验，见 wal_scrub.go
+	stopScrub context.CancelFunc
+	scrubDone sync.WaitGroup
+}
+
+// OpenWALManager 打开 dir 下的所有 WAL 段，最后一个段作为活跃段继续追加
+func OpenWALManager(dir string, opts Options) (*WALManager, error) {
+	opts = opts.withDefaults()
+
+	var codec utils.Codec
+	if opts.WALCompression != utils.CodecNone {
+		c, err := utils.CodecByID(opts.WALCompression)
+		if err != nil {
+			return nil, fmt.Errorf("wal compression: %w", err)
+		}
+		codec = c
+	}
+	cipher, err := newWALCipher(opts.EncryptionKeys)
+	if err != nil {
+		return nil, fmt.Errorf("wal encryption: %w", err)
+	}
+
+	ids, err := listSegments(opts.FS, dir)
+	if err != nil {
+		return nil, err
+	}
+	recycled, err := listNumbered(opts.FS, dir, walRecycleSuffix)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		ids = []uint64{1}
+	}
+
+	m := &WALManager{
+		fs:            opts.FS,
+		dir:           dir,
+		segmentSize:   opts.WALSegmentSize,
+		syncMode:      opts.SyncMode,
+		syncMethod:    opts.WALSyncMethod,
+		preallocate:   opts.WALPreallocate,
+		recycleLimit:  opts.WALRecycleSegments,
+		recycled:      recycled,
+		codec:         codec,
+		maxRecordSize: opts.WALMaxRecordSize,
+		cipher:        cipher,
+		listener:      opts.EventListener,
+		segments:      ids,
+
+		recoveryConcurrency: opts.RecoveryConcurrency,
+		recoveryMode:        opts.RecoveryMode,
+	}
+
+	m.active, err = m.openSegment(ids[len(ids)-1])
+	if err != nil {
+		return nil, err
+	}
+	if err := syncDir(m.fs, dir); err != nil {
+		m.active.Close()
+		return nil, err
+	}
+
+	if opts.WALArchiveDir != "" {
+		if err := m.startArchiver(opts.WALArchiveDir, opts.WALArchiveRetention); err != nil {
+			m.active.Close()
+			return nil, err
+		}
+	}
+
+	if opts.ScrubInterval > 0 {
+		m.startScrubber(opts.ScrubInterval, opts.ScrubBytesPerSec)
+	}
+
+	if m.syncMode == SyncPeriodic {
+		m.startSync(opts.SyncPeriod)
+	}
+
+	return m, nil
+}
+
+func (m *WALManager) openSegment(id uint64) (*WAL, error) {
+	w, err := openWAL(m.fs, m.dir, segmentName(id), m.syncMethod)
+	if err != nil {
+		return nil, err
+	}
+	w.syncMode = m.syncMode
+	w.codec = m.codec
+	w.maxRecordSize = m.maxRecordSize
+	w.cipher = m.cipher
+	if m.preallocate {
+		if err := w.preallocate(m.segmentSize); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// openSealed 打开已封存的段用于读取，读取的配置与活跃段相同
+func (m *WALManager) openSealed(id uint64) (*WAL, error) {
+	w, err := OpenWAL(m.fs, m.dir, segmentName(id))
+	if err != nil {
+		return nil, err
+	}
+	w.maxRecordSize = m.maxRecordSize
+	w.cipher = m.cipher
+	return w, nil
+}
+
+// newSegment 创建序号为 id 的新段，有回收的段时直接重命名复用
+func (m *WALManager) newSegment(id uint64) (*WAL, error) {
+	if n := len(m.recycled); n > 0 {
+		src, dst := filepath.Join(m.dir, recycleName(m.recycled[n-1])), filepath.Join(m.dir, segmentName(id))
+		if err := m.fs.Rename(src, dst); err != nil {
+			return nil, fmt.Errorf("reuse recycled wal segment %s: %w", src, err)
+		}
+		m.recycled = m.recycled[:n-1]
+		slog.Info("wal segment reused", "src", src, "dst", dst)
+	}
+	return m.openSegment(id)
+}
+
+// recycle 把已删除的段清零后改名留作复用
+//
+// 从头开始清零：中途崩溃时段仍以原名存在，开头已是全 0 的头部，恢复时视为空段；
+// 只有完全清零的段才会改名，复用时数据之后不会残留旧的记录
+func (m *WALManager) recycle(id uint64) error {
+	path := filepath.Join(m.dir, segmentName(id))
+	fd, err := m.fs.OpenReadWrite(path)
+	if err != nil {
+		return fmt.Errorf("open wal segment %s: %w", path, err)
+	}
+	err = zeroFile(fd, m.segmentSize)
+	if cerr := fd.Close(); err == nil && cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("zero wal segment %s: %w", path, err)
+	}
+	dst := filepath.Join(m.dir, recycleName(id))
+	if err := m.fs.Rename(path, dst); err != nil {
+		return fmt.Errorf("recycle wal segment %s: %w", path, err)
+	}
+	m.recycled = append(m.recycled, id)
+	slog.Info("wal segment recycled", "path", dst)
+	return nil
+}
+
+// zeroFile 把 fd 截断或扩展为 size 字节并全部写为 0，然后 fsync
+func zeroFile(fd vfs.File, size int64) error {
+	stat, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() > size {
+		if err := fd.Truncate(size); err != nil {
+			return err
+		}
+	}
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	zeros := make([]byte, min(size, walZeroChunk))
+	for off := int64(0); off < size; off += int64(len(zeros)) {
+		if _, err := fd.Write(zeros[:min(int64(len(zeros)), size-off)]); err != nil {
+			return err
+		}
+	}
+	return fd.Sync()
+}
+
+// startSync 启动后台 fsync 协程
+func (m *WALManager) startSync(period time.Duration) {
+	m.stopSync = make(chan struct{})
+	m.syncDone.Add(1)
+	go m.syncLoop(period)
+}
+
+// stopSyncLoop 停止后台 fsync 协程（如果在运行），等待它退出
+func (m *WALManager) stopSyncLoop() {
+	if m.stopSync != nil {
+		close(m.stopSync)
+		m.syncDone.Wait()
+		m.stopSync = nil
+	}
+}
+
+// setSyncMode 在运行期间切换 SyncMode 与 SyncPeriod，调用方保证不与 Close 并发
+//
+// 切换时持有写锁并先 fsync 活跃段：之前按旧模式写入、尚未持久化的数据在返回前落盘，
+// 切换之后的写入都按新模式处理。fsync 失败时不做任何修改
+func (m *WALManager) setSyncMode(mode SyncMode, period time.Duration) error {
+	m.mu.Lock()
+	if err := m.active.Sync(); err != nil && !errors.Is(err, errNilFD) {
+		m.mu.Unlock()
+		return fmt.Errorf("set wal sync mode: %w", err)
+	}
+	m.syncMode = mode
+	m.active.setSyncMode(mode)
+	m.mu.Unlock()
+	// 刚刚的 fsync 已经持久化了全部写入，之前后台 fsync 的错误不再代表当前状态
+	m.syncErr.Store(nil)
+
+	m.stopSyncLoop()
+	if mode == SyncPeriodic {
+		m.startSync(period)
+	}
+	return nil
+}
+
+// setSegmentSize 调整段大小上限，只影响之后的切换判断与新建、回收的段
+func (m *WALManager) setSegmentSize(size int64) {
+	m.mu.Lock()
+	m.segmentSize = size
+	m.mu.Unlock()
+}
+
+// syncLoop 周期性 fsync 活跃段
+func (m *WALManager) syncLoop(period time.Duration) {
+	defer m.syncDone.Done()
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopSync:
+			return
+		case <-ticker.C:
+			if err := m.Sync(); err != nil {
+				slog.Error("periodic wal sync", "dir", m.dir, "err", err)
+				m.syncErr.Store(&err)
+			} else {
+				m.syncErr.Store(nil)
+			}
+		}
+	}
+}
+
+// Sync fsync 活跃段，封存的段在切换时已经 fsync
+func (m *WALManager) Sync() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.active.Sync()
+}
+
+// Write 将条目追加到活跃段，活跃段已满时先切换到新段
+func (m *WALManager) Write(entries ...*sdbf.Entry) (int, error) {
+	return m.writeActive(func(w *WAL) (int, error) {
+		return w.Write(entries...)
+	})
+}
+
+// WriteBatch 将每组条目作为一条批量记录追加到活跃段，见 WAL.WriteBatch
+func (m *WALManager) WriteBatch(batches ...[]*sdbf.Entry) (int, error) {
+	return m.writeBatch(false, batches...)
+}
+
+// writeBatch 同 WriteBatch，noSync 的含义见 WAL.writeBatch
+func (m *WALManager) writeBatch(noSync bool, batches ...[]*sdbf.Entry) (int, error) {
+	return m.writeActive(func(w *WAL) (int, error) {
+		return w.writeBatch(noSync, batches...)
+	})
+}
+
+func (m *WALManager) writeActive(write func(w *WAL) (int, error)) (int, error) {
+	for {
+		m.mu.RLock()
+		if m.active.Size() < m.segmentSize {
+			n, err := write(m.active)
+			m.mu.RUnlock()
+			return n, err
+		}
+		m.mu.RUnlock()
+
+		m.mu.Lock()
+		// 获取写锁期间可能已有其他写入者完成了切换
+		if m.active.Size() >= m.segmentSize {
+			info, err := m.rotateLocked()
+			m.mu.Unlock()
+			if err != nil {
+				return 0, err
+			}
+			m.listener.OnWALRotate(info)
+			continue
+		}
+		m.mu.Unlock()
+	}
+}
+
+// Rotate 封存当前活跃段并创建新段，返回新活跃段的序号
+// 新序号之前的所有段都已封存，可在数据持久化后交给 RemoveSegmentsBefore 删除
+func (m *WALManager) Rotate() (uint64, error) {
+	m.mu.Lock()
+	info, err := m.rotateLocked()
+	m.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	m.listener.OnWALRotate(info)
+	return info.ActiveSegment, nil
+}
+
+// rotateLocked 执行段切换，调用方需持有写锁，并在释放锁之后通知 listener
+func (m *WALManager) rotateLocked() (WALRotateInfo, error) {
+	next := m.segments[len(m.segments)-1] + 1
+	w, err := m.newSegment(next)
+	if err != nil {
+		return WALRotateInfo{}, fmt.Errorf("rotate wal: %w", err)
+	}
+	if err := syncDir(m.fs, m.dir); err != nil {
+		w.Close()
+		return WALRotateInfo{}, fmt.Errorf("rotate wal: %w", err)
+	}
+
+	// 封存前截断预分配的空间并 fsync，保证封存的段中不会出现写了一半的记录
+	sealed := m.active
+	if err := sealed.trim(); err != nil {
+		w.Close()
+		return WALRotateInfo{}, fmt.Errorf("rotate wal: %w", err)
+	}
+	if err := sealed.Sync(); err != nil {
+		w.Close()
+		return WALRotateInfo{}, fmt.Errorf("rotate wal: %w", err)
+	}
+	info := WALRotateInfo{
+		Dir:           m.dir,
+		SealedSegment: m.segments[len(m.segments)-1],
+		SealedSize:    sealed.Size(),
+		ActiveSegment: next,
+	}
+	m.active = w
+	m.segments = append(m.segments, next)
+	if err := sealed.Close(); err != nil {
+		slog.Warn("close sealed wal segment", "path", sealed.path, "err", err)
+	}
+
+	slog.Info("wal segment rotated", "dir", m.dir, "sealed", sealed.path, "active", w.path)
+	m.kickArchiver()
+	return info, nil
+}
+
+// RemoveSegmentsBefore 删除序号小于 id 的已封存段，活跃段永远不会被删除
+//
+// 配置了 Options.WALRecycleSegments 时，前几个段被清零后留作复用而不是删除；
+// 配置了 Options.WALArchiveDir 时，还未归档的段不会被删除
+func (m *WALManager) RemoveSegmentsBefore(id uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	activeID := m.segments[len(m.segments)-1]
+	if m.archiveDir != "" {
+		id = min(id, m.archived.Load()+1)
+	}
+	kept := m.segments[:0]
+	for _, seg := range m.segments {
+		if seg >= id || seg == activeID {
+			kept = append(kept, seg)
+			continue
+		}
+		if len(m.recycled) < m.recycleLimit {
+			if err := m.recycle(seg); err != nil {
+				return err
+			}
+			continue
+		}
+		path := filepath.Join(m.dir, segmentName(seg))
+		if err := m.fs.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove wal segment %s: %w", path, err)
+		}
+		slog.Info("wal segment removed", "path", path)
+	}
+	m.segments = kept
+	return syncDir(m.fs, m.dir)
+}
+
+// Segments 返回当前所有段的序号，升序排列
+func (m *WALManager) Segments() []uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return slices.Clone(m.segments)
+}
+
+// ReadBatch 返回按段序号依次读取所有段中记录的迭代器，见 WALBatchReader
+//
+// 由于段在封存前已 fsync，写了一半的记录只会出现在崩溃时的活跃段中。
+func (m *WALManager) ReadBatch(batchSize int) *WALBatchReader {
+	m.mu.RLock()
+	segments := slices.Clone(m.segments)
+	active := m.active
+	m.mu.RUnlock()
+
+	next := 0
+	return newWALBatchReader(batchSize, func() (*WAL, bool, error) {
+		if next == len(segments) {
+			return nil, false, nil
+		}
+		id := segments[next]
+		next++
+		if next == len(segments) {
+			return active, false, nil
+		}
+		w, err := m.openSealed(id)
+		if err != nil {
+			return nil, false, fmt.Errorf("read wal: %w", err)
+		}
+		return w, true, nil
+	})
+}
+
+// Close 停止后台 fsync 与归档，fsync 并关闭活跃段
+func (m *WALManager) Close() error {
+	m.stopScrubber()
+	m.stopArchiver()
+	m.stopSyncLoop()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.active.Sync(); err != nil && !errors.Is(err, errNilFD) {
+		return fmt.Errorf("close wal: %w", err)
+	}
+	return m.active.Close()
+}
+
+// segmentName 根据序号生成段文件名，例如 1 -> 000001.wal
+func segmentName(id uint64) string {
+	return fmt.Sprintf("%06d%s", id, walSegmentSuffix)
+}
+
+// recycleName 根据原序号生成回收段的文件名，例如 1 -> 000001.recycle
+func recycleName(id uint64) string {
+	return fmt.Sprintf("%06d%s", id, walRecycleSuffix)
+}
+
+// listSegments 列出 dir 下所有段文件的序号，升序排列，忽略无法识别的文件
+func listSegments(fs vfs.FS, dir string) ([]uint64, error) {
+	return listNumbered(fs, dir, walSegmentSuffix)
+}
+
+// listNumbered 列出 dir 下所有以序号命名、扩展名为 suffix 的文件的序号，升序排列
+func listNumbered(fs vfs.FS, dir, suffix string) ([]uint64, error) {
+	names, err := fs.List(dir)
+	if err != nil {
+		return nil, fmt.Errorf("list wal dir %s: %w", dir, err)
+	}
+
+	var ids []uint64
+	for _, name := range names {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, suffix), 10, 64)
+		if err != nil || id == 0 {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+// syncDir fsync 目录，保证文件的创建和删除被持久化
+func syncDir(fs vfs.FS, dir string) error {
+	if err := fs.SyncDir(dir); err != nil {
+		return fmt.Errorf("sync dir %s: %w", dir, err)
+	}
+	return nil
+}
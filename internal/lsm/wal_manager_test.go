@@ -0,0 +1,441 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+func readAllFromManager(t *testing.T, m *WALManager) []*sdbf.Entry {
+	t.Helper()
+	r := m.ReadBatch(2)
+	defer r.Close()
+	var all []*sdbf.Entry
+	for r.Next() {
+		all = append(all, r.Entries()...)
+	}
+	if err := r.Err(); err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	return all
+}
+
+// 测试按大小切换段，并在重新打开后按顺序回放
+func TestWALManager_RotateAndReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	// 每条记录约 20 字节，段大小 50 字节时每段最多容纳 3 条记录
+	m, err := OpenWALManager(dir, Options{WALSegmentSize: 50})
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+
+	var want []string
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key:%02d", i)
+		want = append(want, key)
+		if _, err := m.Write(&sdbf.Entry{Key: key, Value: []byte("v")}); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+
+	if n := len(m.Segments()); n < 3 {
+		t.Fatalf("期望至少切换出 3 个段, 实际 %d 个", n)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	m, err = OpenWALManager(dir, Options{WALSegmentSize: 50})
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer m.Close()
+
+	var got []string
+	for _, e := range readAllFromManager(t, m) {
+		got = append(got, e.Key)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("回放顺序不匹配: 期望 %v, 实际 %v", want, got)
+	}
+}
+
+// 测试删除已封存的段
+func TestWALManager_RemoveSegmentsBefore(t *testing.T) {
+	m, err := OpenWALManager(t.TempDir(), Options{WALSegmentSize: 1 << 20})
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	defer m.Close()
+
+	write := func(key string) {
+		if _, err := m.Write(&sdbf.Entry{Key: key, Value: []byte("v")}); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+
+	write("a")
+	if _, err := m.Rotate(); err != nil {
+		t.Fatalf("切换失败: %v", err)
+	}
+	write("b")
+	active, err := m.Rotate()
+	if err != nil {
+		t.Fatalf("切换失败: %v", err)
+	}
+	write("c")
+
+	tests := []struct {
+		name   string
+		before uint64
+		want   []uint64
+		keys   []string
+	}{
+		{name: "删除第一个段", before: 2, want: []uint64{2, 3}, keys: []string{"b", "c"}},
+		{name: "活跃段不会被删除", before: active + 10, want: []uint64{3}, keys: []string{"c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.RemoveSegmentsBefore(tt.before); err != nil {
+				t.Fatalf("删除失败: %v", err)
+			}
+			if got := m.Segments(); !slices.Equal(got, tt.want) {
+				t.Fatalf("期望段 %v, 实际 %v", tt.want, got)
+			}
+			var keys []string
+			for _, e := range readAllFromManager(t, m) {
+				keys = append(keys, e.Key)
+			}
+			if !slices.Equal(keys, tt.keys) {
+				t.Fatalf("期望回放 %v, 实际 %v", tt.keys, keys)
+			}
+		})
+	}
+}
+
+// recordingListener 记录收到的段切换事件
+type recordingListener struct {
+	BaseEventListener
+	mu      sync.Mutex
+	rotates []WALRotateInfo
+}
+
+func (l *recordingListener) OnWALRotate(info WALRotateInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rotates = append(l.rotates, info)
+}
+
+// 测试段切换（自动与手动）都会通知 EventListener
+func TestWALManager_EventListener(t *testing.T) {
+	dir := t.TempDir()
+	listener := &recordingListener{}
+	m, err := OpenWALManager(dir, Options{WALSegmentSize: 50, EventListener: listener})
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	defer m.Close()
+
+	for i := 0; i < 10; i++ {
+		if _, err := m.Write(&sdbf.Entry{Key: fmt.Sprintf("key:%02d", i), Value: []byte("v")}); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if _, err := m.Rotate(); err != nil {
+		t.Fatalf("手动切换失败: %v", err)
+	}
+
+	segments := m.Segments()
+	if len(listener.rotates) != len(segments)-1 {
+		t.Fatalf("期望 %d 次切换事件, 实际 %d 次", len(segments)-1, len(listener.rotates))
+	}
+	for i, info := range listener.rotates {
+		if info.SealedSegment != segments[i] || info.ActiveSegment != segments[i+1] || info.Dir != dir {
+			t.Errorf("第 %d 次切换事件不正确: %+v", i, info)
+		}
+		if i < len(listener.rotates)-1 && info.SealedSize < 50 {
+			t.Errorf("自动切换时封存段大小应达到上限, 实际 %d", info.SealedSize)
+		}
+	}
+}
+
+// 测试 WAL 压缩：大记录被压缩、小记录原样写入，换用其他算法重新打开后旧记录仍可回放
+func TestWALManager_Compression(t *testing.T) {
+	large := bytes.Repeat([]byte("value "), 200)
+	tests := []struct {
+		name  string
+		codec utils.CodecID
+	}{
+		{"zstd", utils.CodecZstd},
+		{"snappy", utils.CodecSnappy},
+		{"s2", utils.CodecS2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			m, err := OpenWALManager(dir, Options{WALCompression: tt.codec})
+			if err != nil {
+				t.Fatalf("打开失败: %v", err)
+			}
+			if _, err := m.Write(&sdbf.Entry{Key: "large", Value: large}); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+			if _, err := m.Write(&sdbf.Entry{Key: "small", Value: []byte("v")}); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+			batch := []*sdbf.Entry{{Key: "b1", Value: large}, {Key: "b2", Value: large}}
+			if _, err := m.WriteBatch(batch); err != nil {
+				t.Fatalf("批量写入失败: %v", err)
+			}
+			if err := m.Close(); err != nil {
+				t.Fatalf("关闭失败: %v", err)
+			}
+
+			var compressed []bool
+			err = InspectWAL(filepath.Join(dir, segmentName(1)), nil, func(rec WALRecord) error {
+				compressed = append(compressed, rec.IsCompressed())
+				if rec.IsCompressed() && rec.Codec != tt.codec {
+					t.Errorf("记录的算法为 %d, 期望 %d", rec.Codec, tt.codec)
+				}
+				if rec.IsCompressed() && rec.Length >= int64(len(large)) {
+					t.Errorf("压缩后的记录长度 %d 没有变小", rec.Length)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("检查 WAL 失败: %v", err)
+			}
+			if want := []bool{true, false, true}; !slices.Equal(compressed, want) {
+				t.Fatalf("记录是否压缩: 期望 %v, 实际 %v", want, compressed)
+			}
+
+			// 记录自带算法标识，不压缩地重新打开也能回放
+			m, err = OpenWALManager(dir, Options{})
+			if err != nil {
+				t.Fatalf("重新打开失败: %v", err)
+			}
+			defer m.Close()
+			var keys []string
+			for _, e := range readAllFromManager(t, m) {
+				keys = append(keys, e.Key)
+				if e.Key != "small" && !bytes.Equal(e.Value, large) {
+					t.Errorf("key %s 的值回放后不一致", e.Key)
+				}
+			}
+			if want := []string{"large", "small", "b1", "b2"}; !slices.Equal(keys, want) {
+				t.Fatalf("回放结果: 期望 %v, 实际 %v", want, keys)
+			}
+		})
+	}
+
+	if _, err := OpenWALManager(t.TempDir(), Options{WALCompression: 200}); err == nil {
+		t.Fatal("未注册的压缩算法应当在打开时报错")
+	}
+}
+
+// 测试记录长度上限：超出的批次在写入时被拒绝；上限调小后已有的更大记录在读取时视为损坏，
+// 不会按记录的长度分配内存
+func TestWALManager_MaxRecordSize(t *testing.T) {
+	opts := Options{MaxKeySize: 16, MaxValueSize: 1024, WALMaxRecordSize: 4096}
+	value := bytes.Repeat([]byte("v"), 1000)
+	large := []*sdbf.Entry{{Key: "b1", Value: value}, {Key: "b2", Value: value}, {Key: "b3", Value: value}, {Key: "b4", Value: value}, {Key: "b5", Value: value}}
+
+	dir := t.TempDir()
+	m, err := OpenWALManager(dir, opts)
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	if _, err := m.Write(&sdbf.Entry{Key: "a", Value: value}); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if _, err := m.WriteBatch(large); !errors.Is(err, ErrBatchTooLarge) {
+		t.Fatalf("期望 ErrBatchTooLarge, 实际 %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	// 用默认上限写入一条更大的记录，再以较小的上限重新打开
+	m, err = OpenWALManager(dir, Options{})
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	if _, err := m.WriteBatch(large); err != nil {
+		t.Fatalf("默认上限下批量写入失败: %v", err)
+	}
+	// 封存的段与活跃段使用相同的上限
+	if _, err := m.Rotate(); err != nil {
+		t.Fatalf("切换失败: %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	m, err = OpenWALManager(dir, opts)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer m.Close()
+	r := m.ReadBatch(10)
+	defer r.Close()
+	var keys []string
+	for r.Next() {
+		for _, e := range r.Entries() {
+			keys = append(keys, e.Key)
+		}
+	}
+	var corruption *WALCorruptionError
+	if err := r.Err(); !errors.As(err, &corruption) || !errors.Is(err, errInvalidEntrySize) {
+		t.Fatalf("期望长度超过上限的损坏错误, 实际 %v", err)
+	}
+	if !slices.Equal(keys, []string{"a"}) {
+		t.Fatalf("期望只读到 a, 实际 %v", keys)
+	}
+}
+
+func TestOptions_WALMaxRecordSize(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want int64
+	}{
+		{name: "默认", opts: Options{}, want: WALMaxRecordSizeLimit},
+		{name: "不超过格式上限", opts: Options{WALMaxRecordSize: 4 << 30}, want: WALMaxRecordSizeLimit},
+		{name: "至少能放下一个条目", opts: Options{MaxKeySize: 16, MaxValueSize: 1024, WALMaxRecordSize: 1}, want: 16 + 1024 + batchOpOverhead},
+		{name: "指定值", opts: Options{MaxKeySize: 16, MaxValueSize: 1024, WALMaxRecordSize: 1 << 20}, want: 1 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opts.withDefaults().WALMaxRecordSize; got != tt.want {
+				t.Fatalf("期望 %d, 实际 %d", tt.want, got)
+			}
+		})
+	}
+}
+
+// 测试预分配与回收段：活跃段预分配到段大小，封存时截断，重新打开后从数据末尾继续追加；
+// 删除的段清零后被新段复用，复用的段中不会回放出旧记录
+func TestWALManager_PreallocateAndRecycle(t *testing.T) {
+	impls := []struct {
+		name string
+		fs   vfs.FS
+		dir  func(t *testing.T) string
+	}{
+		{name: "OSFS", fs: vfs.OSFS{}, dir: func(t *testing.T) string { return t.TempDir() }},
+		{name: "MemFS", fs: vfs.NewMemFS(), dir: func(t *testing.T) string { return "/wal" }},
+	}
+
+	const segmentSize = 4 << 10
+	for _, impl := range impls {
+		t.Run(impl.name, func(t *testing.T) {
+			dir := impl.dir(t)
+			if err := impl.fs.MkdirAll(dir, 0755); err != nil {
+				t.Fatalf("创建目录失败: %v", err)
+			}
+			opts := Options{FS: impl.fs, WALSegmentSize: segmentSize, WALPreallocate: true, WALRecycleSegments: 1}
+			fileSize := func(id uint64, suffix string) int64 {
+				t.Helper()
+				info, err := impl.fs.Stat(filepath.Join(dir, fmt.Sprintf("%06d%s", id, suffix)))
+				if err != nil {
+					t.Fatalf("获取段 %d 的大小失败: %v", id, err)
+				}
+				return info.Size()
+			}
+			keys := func(m *WALManager) []string {
+				var keys []string
+				for _, e := range readAllFromManager(t, m) {
+					keys = append(keys, e.Key)
+				}
+				return keys
+			}
+			write := func(m *WALManager, keys ...string) {
+				t.Helper()
+				for _, key := range keys {
+					if _, err := m.Write(&sdbf.Entry{Key: key, Value: []byte("v")}); err != nil {
+						t.Fatalf("写入失败: %v", err)
+					}
+				}
+			}
+
+			m, err := OpenWALManager(dir, opts)
+			if err != nil {
+				t.Fatalf("打开失败: %v", err)
+			}
+			write(m, "a", "b")
+			if size := fileSize(1, walSegmentSuffix); size != segmentSize {
+				t.Fatalf("活跃段应预分配到 %d, 实际 %d", segmentSize, size)
+			}
+			if err := m.Close(); err != nil {
+				t.Fatalf("关闭失败: %v", err)
+			}
+
+			// 重新打开后从数据末尾而不是文件末尾继续追加
+			m, err = OpenWALManager(dir, opts)
+			if err != nil {
+				t.Fatalf("重新打开失败: %v", err)
+			}
+			defer func() { m.Close() }()
+			if got := keys(m); !slices.Equal(got, []string{"a", "b"}) {
+				t.Fatalf("回放结果: 期望 [a b], 实际 %v", got)
+			}
+			write(m, "c")
+			if _, err := m.Rotate(); err != nil {
+				t.Fatalf("切换失败: %v", err)
+			}
+			if size := fileSize(1, walSegmentSuffix); size >= segmentSize {
+				t.Fatalf("封存的段应截断到数据长度, 实际 %d", size)
+			}
+			write(m, "d")
+			if _, err := m.Rotate(); err != nil {
+				t.Fatalf("切换失败: %v", err)
+			}
+			write(m, "e")
+
+			if err := m.RemoveSegmentsBefore(3); err != nil {
+				t.Fatalf("删除失败: %v", err)
+			}
+			if size := fileSize(1, walRecycleSuffix); size != segmentSize {
+				t.Fatalf("回收的段应清零到 %d, 实际 %d", segmentSize, size)
+			}
+			if _, err := impl.fs.Stat(filepath.Join(dir, segmentName(2))); err == nil {
+				t.Fatal("超出回收数量的段应被删除")
+			}
+			if got := keys(m); !slices.Equal(got, []string{"e"}) {
+				t.Fatalf("回放结果: 期望 [e], 实际 %v", got)
+			}
+
+			// 新段复用回收的段
+			active, err := m.Rotate()
+			if err != nil {
+				t.Fatalf("切换失败: %v", err)
+			}
+			if _, err := impl.fs.Stat(filepath.Join(dir, recycleName(1))); err == nil {
+				t.Fatal("回收的段应已被复用")
+			}
+			if size := fileSize(active, walSegmentSuffix); size != segmentSize {
+				t.Fatalf("复用的段大小应为 %d, 实际 %d", segmentSize, size)
+			}
+			write(m, "f")
+			if err := m.Close(); err != nil {
+				t.Fatalf("关闭失败: %v", err)
+			}
+
+			m, err = OpenWALManager(dir, opts)
+			if err != nil {
+				t.Fatalf("重新打开失败: %v", err)
+			}
+			if got := keys(m); !slices.Equal(got, []string{"e", "f"}) {
+				t.Fatalf("回放结果: 期望 [e f], 实际 %v", got)
+			}
+		})
+	}
+}
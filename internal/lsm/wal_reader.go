@@ -0,0 +1,140 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+// WALBatchReader 按批顺序读取一个或多个 WAL 段中的记录，由 WAL.ReadBatch 与 WALManager.ReadBatch 创建
+//
+//	r := m.ReadBatch(1000)
+//	defer r.Close()
+//	for r.Next() {
+//		apply(r.Entries())
+//	}
+//	if err := r.Err(); err != nil { ... }
+//
+// 遇到损坏的记录时 Next 返回 false，Err 返回包装了 *WALCorruptionError 的错误。调用方可以就此失败
+// （fail-closed），也可以调用 Resume 截断该段损坏的尾部并从下一个段继续（fail-open）。
+//
+// 读取某个段期间持有该段的锁，读完之前不能向该段写入；提前结束时必须调用 Close
+type WALBatchReader struct {
+	batchSize int
+	// open 依次返回要读取的段，没有更多段时返回 nil；owned 为 true 的段由读取器负责关闭
+	open    func() (w *WAL, owned bool, err error)
+	w       *WAL
+	owned   bool
+	entries []*sdbf.Entry
+	err     error
+}
+
+func newWALBatchReader(batchSize int, open func() (*WAL, bool, error)) *WALBatchReader {
+	return &WALBatchReader{batchSize: max(batchSize, 1), open: open}
+}
+
+// Next 读取下一批记录，没有更多记录或出错时返回 false，之后应检查 Err
+func (r *WALBatchReader) Next() bool {
+	r.entries = nil
+	for r.err == nil {
+		if r.w == nil {
+			w, owned, err := r.open()
+			if err != nil {
+				r.err = err
+				return false
+			}
+			if w == nil {
+				return false
+			}
+			if err := r.acquire(w, owned); err != nil {
+				r.err = fmt.Errorf("read wal %s: %w", w.path, err)
+				return false
+			}
+		}
+
+		entries, hasMore, err := r.w.readNext(r.batchSize)
+		if err != nil {
+			r.err = fmt.Errorf("read wal %s: %w", r.w.path, err)
+			return false
+		}
+		if !hasMore {
+			if r.w.corrupted {
+				// 保留该段的锁，由 Resume 截断或 Close 放弃
+				r.err = fmt.Errorf("read wal %s: %w", r.w.path,
+					&WALCorruptionError{Offset: r.w.corruptedAt, Err: r.w.corruptedErr})
+			} else {
+				r.release()
+			}
+		}
+		if len(entries) > 0 {
+			r.entries = entries
+			return true
+		}
+	}
+	return false
+}
+
+// Entries 返回 Next 读到的一批条目，归调用方所有
+func (r *WALBatchReader) Entries() []*sdbf.Entry {
+	return r.entries
+}
+
+// Err 返回导致 Next 结束的错误，正常读完时为 nil
+func (r *WALBatchReader) Err() error {
+	return r.err
+}
+
+// Resume 在 Err 为损坏错误时截断当前段损坏的尾部（之后的追加可以被正常恢复），
+// 然后让 Next 从下一个段继续；其他错误无法恢复，原样返回
+func (r *WALBatchReader) Resume() error {
+	if r.err == nil {
+		return nil
+	}
+	var corruption *WALCorruptionError
+	if r.w == nil || !errors.As(r.err, &corruption) {
+		return r.err
+	}
+	if err := r.w.truncateCorruptedTailLocked(); err != nil {
+		return err
+	}
+	r.err = nil
+	r.release()
+	return nil
+}
+
+// Close 释放当前段，不会截断未处理的损坏
+func (r *WALBatchReader) Close() error {
+	if r.w == nil {
+		return nil
+	}
+	// 放弃的损坏留给下一次读取处理
+	r.w.corrupted = false
+	r.release()
+	return nil
+}
+
+// acquire 锁定 w 并从头开始读取
+func (r *WALBatchReader) acquire(w *WAL, owned bool) error {
+	r.w, r.owned = w, owned
+	w.mu.Lock()
+	err := errNilFD
+	if w.fd != nil {
+		_, err = w.fd.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		r.release()
+	}
+	return err
+}
+
+// release 解锁当前段，并关闭读取器打开的段
+func (r *WALBatchReader) release() {
+	w, owned := r.w, r.owned
+	r.w, r.owned = nil, false
+	w.mu.Unlock()
+	if owned {
+		w.Close()
+	}
+}
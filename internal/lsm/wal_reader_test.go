@@ -0,0 +1,113 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+// 测试损坏的记录通过 Err 报告，调用方可以选择就此失败或截断后继续读取下一个段
+func TestWALBatchReader_Corruption(t *testing.T) {
+	tests := []struct {
+		name   string
+		resume bool
+		// want 读到的 key，truncated 为损坏的段是否被截断
+		want      []string
+		truncated bool
+	}{
+		{name: "fail-closed", resume: false, want: []string{"a", "b"}, truncated: false},
+		{name: "fail-open", resume: true, want: []string{"a", "b", "e", "f"}, truncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			m, err := OpenWALManager(dir, Options{})
+			if err != nil {
+				t.Fatalf("打开失败: %v", err)
+			}
+			var corruptAt int64
+			for i, key := range []string{"a", "b", "c", "d", "e", "f"} {
+				switch i {
+				case 2:
+					corruptAt = m.active.Size()
+				case 4:
+					if _, err := m.Rotate(); err != nil {
+						t.Fatalf("切换失败: %v", err)
+					}
+				}
+				if _, err := m.Write(&sdbf.Entry{Key: key, Value: []byte("v"), Version: int64(i + 1)}); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+			}
+			if err := m.Close(); err != nil {
+				t.Fatalf("关闭失败: %v", err)
+			}
+			path := filepath.Join(dir, segmentName(1))
+			flipByte(t, path, corruptAt+walHeaderSize)
+			stat, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			size := stat.Size()
+
+			m, err = OpenWALManager(dir, Options{})
+			if err != nil {
+				t.Fatalf("重新打开失败: %v", err)
+			}
+			defer m.Close()
+
+			r := m.ReadBatch(1)
+			var got []string
+			read := func() {
+				for r.Next() {
+					for _, e := range r.Entries() {
+						got = append(got, e.Key)
+					}
+				}
+			}
+			read()
+			var corruption *WALCorruptionError
+			if err := r.Err(); !errors.As(err, &corruption) || corruption.Offset != corruptAt {
+				t.Fatalf("期望在 %d 处报告损坏, 实际 %v", corruptAt, err)
+			}
+			if tt.resume {
+				if err := r.Resume(); err != nil {
+					t.Fatalf("继续读取失败: %v", err)
+				}
+				read()
+				if err := r.Err(); err != nil {
+					t.Fatalf("读取失败: %v", err)
+				}
+			}
+			if err := r.Close(); err != nil {
+				t.Fatalf("关闭读取器失败: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("期望读到 %v, 实际 %v", tt.want, got)
+			}
+
+			stat, err = os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantSize := size
+			if tt.truncated {
+				wantSize = corruptAt
+			}
+			if stat.Size() != wantSize {
+				t.Fatalf("期望段大小 %d, 实际 %d", wantSize, stat.Size())
+			}
+
+			// 读取器释放了活跃段，之后仍可写入
+			if _, err := m.Write(&sdbf.Entry{Key: fmt.Sprintf("after-%s", tt.name), Version: 7}); err != nil {
+				t.Fatalf("读取后写入失败: %v", err)
+			}
+		})
+	}
+}
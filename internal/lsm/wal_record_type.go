@@ -0,0 +1,97 @@
+package lsm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/aireet/SimpleDBForge/internal/utils"
+)
+
+// WALRecordType 是 WAL 记录的类型
+//
+// 带有 walFlagTyped 标志的记录，数据内容（压缩与加密之前）的第一个字节是记录类型，之后是该类型的内容；
+// 没有这个标志的记录都是 WALRecordEntries，与引入记录类型之前写入的记录格式相同。
+// 数据记录仍然不带类型字节写入，只有控制记录使用 walFlagTyped
+type WALRecordType byte
+
+const (
+	// WALRecordEntries 数据记录：单个条目或批量记录，见 walFlagBatch
+	WALRecordEntries WALRecordType = iota
+	// WALRecordTxnBegin 多条记录组成的事务的开始，内容为 uvarint 编码的事务 ID
+	//
+	// 从 TxnBegin 到 ID 相同的 TxnCommit 之间的记录在一次写入中连续追加，回放时只有读到 TxnCommit
+	// 才一起应用；段在 TxnCommit 之前结束说明写入中途崩溃，按 RecoveryMode 当作损坏的尾部处理
+	WALRecordTxnBegin
+	// WALRecordTxnCommit 多条记录组成的事务的提交，内容为 uvarint 编码的事务 ID
+	WALRecordTxnCommit
+	// WALRecordCreateColumnFamily 创建列族，内容为列族名称，使没有数据的列族在重启之后仍然存在
+	WALRecordCreateColumnFamily
+)
+
+func (t WALRecordType) String() string {
+	switch t {
+	case WALRecordEntries:
+		return "entries"
+	case WALRecordTxnBegin:
+		return "txn_begin"
+	case WALRecordTxnCommit:
+		return "txn_commit"
+	case WALRecordCreateColumnFamily:
+		return "create_column_family"
+	default:
+		return fmt.Sprintf("WALRecordType(%d)", byte(t))
+	}
+}
+
+// appendControlFrame 将一条控制记录编码写入 buf：[类型][内容]，带 walFlagTyped 标志，
+// 控制记录很短，不压缩；c 不为 nil 时加密
+func appendControlFrame(buf *bytes.Buffer, typ WALRecordType, body []byte, c *walCipher) error {
+	data := utils.Pool.Get()
+	defer utils.Pool.Put(data)
+	data.WriteByte(byte(typ))
+	data.Write(body)
+	return appendEncodedFrame(buf, walFlagTyped, data.Bytes(), nil, c, WALMaxRecordSizeLimit)
+}
+
+// txnBody 返回事务开始与提交记录的内容
+func txnBody(id uint64) []byte {
+	return binary.AppendUvarint(nil, id)
+}
+
+// decodeControl 解析控制记录的内容，填写 rec 中对应类型的字段。内容不合法时返回包装了
+// errCorruptedWAL 的错误，无法识别的类型返回 ErrUnsupportedFormat
+func decodeControl(rec WALRecord, body []byte) (WALRecord, error) {
+	switch rec.Type {
+	case WALRecordTxnBegin, WALRecordTxnCommit:
+		id, n := binary.Uvarint(body)
+		if n <= 0 || n != len(body) {
+			return rec, fmt.Errorf("%w: bad %v record", errCorruptedWAL, rec.Type)
+		}
+		rec.TxnID = id
+	case WALRecordCreateColumnFamily:
+		if len(body) == 0 || len(body) > maxColumnFamilyName {
+			return rec, fmt.Errorf("%w: bad column family name of %d bytes", errCorruptedWAL, len(body))
+		}
+		rec.ColumnFamily = string(body)
+	default:
+		return rec, fmt.Errorf("%w: unknown WAL record type %d", ErrUnsupportedFormat, byte(rec.Type))
+	}
+	return rec, nil
+}
+
+// writeRecord 将一条控制记录追加到文件末尾，SyncEveryWrite 模式下随后 fsync
+func (w *WAL) writeRecord(typ WALRecordType, body []byte) error {
+	_, err := w.write(false, func(buf *bytes.Buffer) (int, error) {
+		return 0, appendControlFrame(buf, typ, body, w.cipher)
+	})
+	return err
+}
+
+// writeRecord 将一条控制记录追加到活跃段，见 WAL.writeRecord
+func (m *WALManager) writeRecord(typ WALRecordType, body []byte) error {
+	_, err := m.writeActive(func(w *WAL) (int, error) {
+		return 0, w.writeRecord(typ, body)
+	})
+	return err
+}
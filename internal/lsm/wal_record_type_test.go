@@ -0,0 +1,203 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+// 测试控制记录的编码与解析，包括加密的控制记录、内容不合法与无法识别的类型
+func TestDecodeRecord_Control(t *testing.T) {
+	c := fuzzCipher(t)
+	tests := []struct {
+		name    string
+		typ     WALRecordType
+		body    []byte
+		cipher  *walCipher
+		want    WALRecord
+		wantErr error
+	}{
+		{name: "事务开始", typ: WALRecordTxnBegin, body: txnBody(300), want: WALRecord{Type: WALRecordTxnBegin, TxnID: 300}},
+		{name: "事务提交", typ: WALRecordTxnCommit, body: txnBody(300), want: WALRecord{Type: WALRecordTxnCommit, TxnID: 300}},
+		{name: "创建列族", typ: WALRecordCreateColumnFamily, body: []byte("users"), want: WALRecord{Type: WALRecordCreateColumnFamily, ColumnFamily: "users"}},
+		{name: "加密", typ: WALRecordCreateColumnFamily, body: []byte("users"), cipher: c, want: WALRecord{Type: WALRecordCreateColumnFamily, ColumnFamily: "users"}},
+		{name: "事务 ID 之后有多余数据", typ: WALRecordTxnBegin, body: append(txnBody(1), 0), wantErr: errCorruptedWAL},
+		{name: "空的列族名称", typ: WALRecordCreateColumnFamily, wantErr: errCorruptedWAL},
+		{name: "无法识别的类型", typ: 200, body: []byte("x"), wantErr: ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var frame, buf bytes.Buffer
+			if err := appendControlFrame(&frame, tt.typ, tt.body, tt.cipher); err != nil {
+				t.Fatalf("编码失败: %v", err)
+			}
+			rec, err := decodeRecord(&frame, &buf, WALMaxRecordSizeLimit, c)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("期望错误 %v, 实际 %v", tt.wantErr, err)
+			}
+			if tt.wantErr == ErrUnsupportedFormat && errors.Is(err, errCorruptedWAL) {
+				t.Fatalf("无法识别的类型不应视为损坏: %v", err)
+			}
+			if err != nil {
+				return
+			}
+			if rec.Type != tt.want.Type || rec.TxnID != tt.want.TxnID || rec.ColumnFamily != tt.want.ColumnFamily || len(rec.Entries) != 0 {
+				t.Fatalf("期望 %v %d %q, 实际 %v %d %q %v", tt.want.Type, tt.want.TxnID, tt.want.ColumnFamily,
+					rec.Type, rec.TxnID, rec.ColumnFamily, rec.Entries)
+			}
+		})
+	}
+}
+
+// 测试回放时事务中的记录在读到提交记录之后才应用，没有提交记录的事务按 RecoveryMode 当作损坏处理
+func TestWALManager_ReplayTxn(t *testing.T) {
+	entry := func(key string) func(*bytes.Buffer) error {
+		return func(buf *bytes.Buffer) error {
+			return appendEntryFrame(buf, &sdbf.Entry{Key: key, Value: []byte("v")}, nil, nil, WALMaxRecordSizeLimit)
+		}
+	}
+	control := func(typ WALRecordType, id uint64) func(*bytes.Buffer) error {
+		return func(buf *bytes.Buffer) error { return appendControlFrame(buf, typ, txnBody(id), nil) }
+	}
+	begin := func(id uint64) func(*bytes.Buffer) error { return control(WALRecordTxnBegin, id) }
+	commit := func(id uint64) func(*bytes.Buffer) error { return control(WALRecordTxnCommit, id) }
+
+	tests := []struct {
+		name    string
+		mode    RecoveryMode
+		records []func(*bytes.Buffer) error
+		want    []string
+		// truncateAt 回放之后段应当被截断到第几条记录，-1 表示不截断
+		truncateAt int
+		wantErr    bool
+	}{
+		{
+			name:       "已提交",
+			records:    []func(*bytes.Buffer) error{entry("a"), begin(1), entry("b"), entry("c"), commit(1), entry("d")},
+			want:       []string{"a", "b", "c", "d"},
+			truncateAt: -1,
+		},
+		{
+			name:       "尾部事务没有提交",
+			records:    []func(*bytes.Buffer) error{entry("a"), begin(1), entry("b"), commit(1), begin(2), entry("c")},
+			want:       []string{"a", "b"},
+			truncateAt: 4,
+		},
+		{
+			name:       "跳过损坏记录也截断尾部事务",
+			mode:       SkipCorruptRecords,
+			records:    []func(*bytes.Buffer) error{entry("a"), begin(1), entry("b")},
+			want:       []string{"a"},
+			truncateAt: 1,
+		},
+		{
+			name:       "事务中途开始新事务",
+			records:    []func(*bytes.Buffer) error{entry("a"), begin(1), entry("b"), begin(2), entry("c"), commit(2)},
+			want:       []string{"a"},
+			truncateAt: 1,
+		},
+		{
+			name:       "跳过没有提交的事务",
+			mode:       SkipCorruptRecords,
+			records:    []func(*bytes.Buffer) error{entry("a"), begin(1), entry("b"), begin(2), entry("c"), commit(2)},
+			want:       []string{"a", "c"},
+			truncateAt: -1,
+		},
+		{
+			name:       "提交记录与开始记录不匹配",
+			records:    []func(*bytes.Buffer) error{entry("a"), commit(1), entry("b")},
+			want:       []string{"a"},
+			truncateAt: 1,
+		},
+		{
+			name:    "绝对一致",
+			mode:    AbsoluteConsistency,
+			records: []func(*bytes.Buffer) error{entry("a"), begin(1), entry("b")},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			var data bytes.Buffer
+			var offsets []int64
+			for _, encode := range tt.records {
+				offsets = append(offsets, int64(data.Len()))
+				if err := encode(&data); err != nil {
+					t.Fatalf("编码失败: %v", err)
+				}
+			}
+			path := filepath.Join(dir, segmentName(1))
+			if err := os.WriteFile(path, data.Bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			m, err := OpenWALManager(dir, Options{RecoveryMode: tt.mode})
+			if err != nil {
+				t.Fatalf("打开失败: %v", err)
+			}
+			defer m.Close()
+			var got []string
+			err = m.replay(2, func(rec WALRecord) {
+				for _, e := range rec.Entries {
+					got = append(got, e.Key)
+				}
+			})
+			if tt.wantErr {
+				var corruption *WALCorruptionError
+				if !errors.As(err, &corruption) || corruption.Offset != offsets[1] {
+					t.Fatalf("期望在 %d 处损坏, 实际 %v", offsets[1], err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("回放失败: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("期望回放 %v, 实际 %v", tt.want, got)
+			}
+			size := int64(data.Len())
+			if tt.truncateAt >= 0 {
+				size = offsets[tt.truncateAt]
+			}
+			if got := m.active.Size(); got != size {
+				t.Fatalf("期望段长度 %d, 实际 %d", size, got)
+			}
+		})
+	}
+}
+
+// 测试没有数据的列族在重启之后仍然存在
+func TestDB_CreateColumnFamilyDurable(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	for _, name := range []string{"empty", "empty", "users"} {
+		if _, err := db.CF(name); err != nil {
+			t.Fatalf("创建列族失败: %v", err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	db, err = Open(dir, Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer db.Close()
+	names, err := db.ColumnFamilies()
+	if err != nil {
+		t.Fatalf("列出列族失败: %v", err)
+	}
+	if want := []string{DefaultColumnFamily, "empty", "users"}; !slices.Equal(names, want) {
+		t.Fatalf("期望 %v, 实际 %v", want, names)
+	}
+}
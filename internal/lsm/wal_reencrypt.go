@@ -0,0 +1,230 @@
+package lsm
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"path/filepath"
+	"slices"
+
+	"github.com/aireet/SimpleDBForge/internal/utils"
+)
+
+// WALReencryptInfo 描述一次 DB.ReencryptWAL
+type WALReencryptInfo struct {
+	// KeyID 重新加密使用的当前密钥
+	KeyID uint32
+	// Segments 被重写的段数，Records 重新加密的记录数
+	Segments int
+	Records  int
+	// RetiredKeys 被替换掉的旧密钥 ID，升序排列；WAL 中不再有使用它们的记录
+	RetiredKeys []uint32
+}
+
+// ReencryptWAL 用当前密钥（见 Options.EncryptionKeys）重新加密 WAL 中使用旧密钥的记录，
+// 完成后 RetiredKeys 中的密钥不再被 WAL 使用，可以从 KeyProvider 中移除
+//
+// 活跃段非空时先切换，使已有的记录都位于封存的段中；含有旧密钥记录的段被重写到临时文件后原子地替换，
+// 期间不阻塞读写。重新加密不改变记录的长度，复制使用的 WALPosition 仍然有效，但 follower 同样需要新密钥。
+// 启用加密之前写入的明文记录保持不变；已归档的段、备份与 Checkpoint 不会被重写，其中仍可能使用旧密钥
+func (db *DB) ReencryptWAL(ctx context.Context) (WALReencryptInfo, error) {
+	if db.wal == nil {
+		return WALReencryptInfo{}, fmt.Errorf("reencrypt wal: %w", ErrInMemory)
+	}
+	info, err := db.wal.reencrypt(ctx)
+	if err != nil {
+		return info, fmt.Errorf("reencrypt wal: %w", err)
+	}
+	slog.Info("wal reencrypted", "dir", db.dir, "key", info.KeyID,
+		"segments", info.Segments, "records", info.Records, "retired", info.RetiredKeys)
+	return info, nil
+}
+
+// reencrypt 依次重写含有旧密钥记录的封存段，reencryptMu 保证同一时间只有一次重写
+func (m *WALManager) reencrypt(ctx context.Context) (WALReencryptInfo, error) {
+	if m.cipher == nil {
+		return WALReencryptInfo{}, fmt.Errorf("%w: encryption is not enabled", ErrEncryptionKey)
+	}
+	m.reencryptMu.Lock()
+	defer m.reencryptMu.Unlock()
+
+	current, _, err := m.cipher.current()
+	if err != nil {
+		return WALReencryptInfo{}, err
+	}
+	m.mu.RLock()
+	empty := m.active.Size() == 0
+	m.mu.RUnlock()
+	if !empty {
+		if _, err := m.Rotate(); err != nil {
+			return WALReencryptInfo{}, err
+		}
+	}
+
+	info := WALReencryptInfo{KeyID: current}
+	retired := make(map[uint32]struct{})
+	segments := m.Segments()
+	for _, id := range segments[:len(segments)-1] {
+		if err := ctx.Err(); err != nil {
+			return info, err
+		}
+		n, err := m.reencryptSegment(id, current, retired)
+		if err != nil {
+			return info, err
+		}
+		if n > 0 {
+			info.Segments++
+			info.Records += n
+		}
+	}
+	info.RetiredKeys = slices.Sorted(maps.Keys(retired))
+	return info, nil
+}
+
+// reencryptSegment 重写封存的段 id 中使用旧密钥的记录，返回重新加密的记录数，
+// 旧密钥的 ID 加入 retired。段中没有旧密钥的记录，或者段在重写期间被删除时返回 0
+func (m *WALManager) reencryptSegment(id uint64, current uint32, retired map[uint32]struct{}) (int, error) {
+	path := filepath.Join(m.dir, segmentName(id))
+	fd, err := m.fs.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("open wal segment %s: %w", path, err)
+	}
+	defer fd.Close()
+
+	// 先只读取密钥 ID，大多数段不需要重写，不必解密
+	stale, err := m.hasStaleKey(bufio.NewReader(fd), current)
+	if err != nil || !stale {
+		return 0, wrapSegmentErr(path, err)
+	}
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("seek wal segment %s: %w", path, err)
+	}
+
+	tmpPath := path + ".tmp"
+	tmp, err := m.fs.Create(tmpPath)
+	if err != nil {
+		return 0, fmt.Errorf("create %s: %w", tmpPath, err)
+	}
+	n, err := m.reencryptFrames(bufio.NewReader(fd), tmp, current, retired)
+	err = wrapSegmentErr(path, err)
+	if err == nil {
+		if err = tmp.Sync(); err != nil {
+			err = fmt.Errorf("sync %s: %w", tmpPath, err)
+		}
+	}
+	if cerr := tmp.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("close %s: %w", tmpPath, cerr)
+	}
+	var replaced bool
+	if err == nil {
+		replaced, err = m.replaceSegment(id, tmpPath, path)
+	}
+	if err != nil || !replaced {
+		if rerr := m.fs.Remove(tmpPath); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) {
+			slog.Warn("remove temp file", "path", tmpPath, "err", rerr)
+		}
+		return 0, err
+	}
+	slog.Info("wal segment reencrypted", "path", path, "records", n)
+	return n, nil
+}
+
+// wrapSegmentErr 为读取段 path 时的错误加上路径
+func wrapSegmentErr(path string, err error) error {
+	if err != nil {
+		return fmt.Errorf("wal segment %s: %w", path, err)
+	}
+	return nil
+}
+
+// replaceSegment 用 tmpPath 替换段 id，持有写锁以免与 RemoveSegmentsBefore 交错：
+// 段已被删除时不替换，返回 false
+func (m *WALManager) replaceSegment(id uint64, tmpPath, path string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !slices.Contains(m.segments, id) {
+		return false, nil
+	}
+	if err := m.fs.Rename(tmpPath, path); err != nil {
+		return false, fmt.Errorf("rename %s: %w", tmpPath, err)
+	}
+	return true, syncDir(m.fs, m.dir)
+}
+
+// hasStaleKey 报告 r 中是否有不是用 current 加密的记录，不校验也不解密记录
+func (m *WALManager) hasStaleKey(r io.Reader, current uint32) (bool, error) {
+	buf := utils.Pool.Get()
+	defer utils.Pool.Put(buf)
+	for {
+		rec, err := readFrame(r, buf, m.maxRecordSize)
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		data := buf.Bytes()
+		if rec.Flags&walFlagEncrypted != 0 && len(data) >= walEncryptionOverhead &&
+			binary.LittleEndian.Uint32(data[1:5]) != current {
+			return true, nil
+		}
+	}
+}
+
+// reencryptFrames 把 r 中的记录依次写入 w，加密的记录换用当前密钥，其余记录原样写入，
+// 返回重新加密的记录数。损坏的记录返回错误，不做任何跳过
+func (m *WALManager) reencryptFrames(r io.Reader, w io.Writer, current uint32, retired map[uint32]struct{}) (int, error) {
+	buf := utils.Pool.Get()
+	defer utils.Pool.Put(buf)
+	sealed := utils.Pool.Get()
+	defer utils.Pool.Put(sealed)
+	frame := utils.Pool.Get()
+	defer utils.Pool.Put(frame)
+	bw := bufio.NewWriter(w)
+
+	var n int
+	for {
+		rec, err := readFrame(r, buf, m.maxRecordSize)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		data := buf.Bytes()
+		if crc32.Checksum(data, crcTable) != rec.Checksum {
+			return n, fmt.Errorf("%w: %w", errCorruptedWAL, errChecksumMismatch)
+		}
+		if rec.Flags&walFlagEncrypted != 0 {
+			var old uint32
+			if data, old, err = m.cipher.reseal(sealed.AvailableBuffer(), rec.Flags, data); err != nil {
+				return n, err
+			}
+			if old != current {
+				retired[old] = struct{}{}
+				n++
+			}
+		}
+		frame.Reset()
+		if err := appendFrame(frame, rec.Flags, data); err != nil {
+			return n, err
+		}
+		if _, err := bw.Write(frame.Bytes()); err != nil {
+			return n, fmt.Errorf("write: %w", err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return n, fmt.Errorf("write: %w", err)
+	}
+	return n, nil
+}
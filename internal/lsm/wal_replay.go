@@ -0,0 +1,309 @@
+package lsm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/internal/utils"
+)
+
+// RecoveryProgress 描述打开数据库时 WAL 回放的进度，见 EventListener.OnRecoveryProgress
+type RecoveryProgress struct {
+	// Segment 正在回放的段序号
+	Segment uint64
+	// SegmentsDone 已回放完的段数，Segments 为需要回放的段总数
+	SegmentsDone int
+	Segments     int
+	// BytesDone 已回放的字节数，Bytes 为所有段的总字节数（损坏的尾部不会计入 BytesDone）
+	BytesDone int64
+	Bytes     int64
+	// Entries 已回放的条目数
+	Entries int64
+	// SkippedRecords RecoveryMode 为 SkipCorruptRecords 时跳过的损坏记录数
+	SkippedRecords int64
+}
+
+// replayReadBuffer 回放时读取段文件的缓冲区大小
+const replayReadBuffer = 1 << 20
+
+// replayJob 一批按顺序读出、等待校验与解析的记录
+type replayJob struct {
+	// offsets 每条记录的起始偏移，frames 为记录头部，data 为所有记录的数据依次拼接
+	offsets []int64
+	frames  []WALRecord
+	data    []byte
+	// 解析结果：recs 为解析出的每条记录；errs 不为 nil 时记录每条记录校验或解析失败的原因
+	recs []WALRecord
+	errs []error
+	// limit 解压后的长度上限，cipher 用于解密加密的记录，见 decodeFrame
+	limit  int64
+	cipher *walCipher
+	done   chan struct{}
+}
+
+// decode 校验并解析 job 中的所有记录，损坏的记录不影响之后的记录
+func (job *replayJob) decode() {
+	defer close(job.done)
+	job.recs = make([]WALRecord, len(job.frames))
+	data := job.data
+	for i, rec := range job.frames {
+		rec, err := decodeFrame(rec, data[:rec.Length], job.limit, job.cipher)
+		data = data[rec.Length:]
+		if err != nil {
+			if job.errs == nil {
+				job.errs = make([]error, len(job.frames))
+			}
+			job.errs[i] = err
+			continue
+		}
+		job.recs[i] = rec
+	}
+}
+
+// err 返回第 i 条记录损坏的原因，完好时返回 nil
+func (job *replayJob) err(i int) error {
+	if job.errs == nil {
+		return nil
+	}
+	return job.errs[i]
+}
+
+// replay 按段序号依次回放所有段，对每条数据记录与创建列族记录按写入顺序调用 fn，并通知 EventListener 回放进度
+//
+// 读取是顺序的，校验、解压与反序列化由 recoveryConcurrency 个 goroutine 并行完成，
+// 结果仍按原顺序交给 fn。事务开始与提交记录不交给 fn：事务中的记录在读到提交记录之后才一起交给 fn。
+// 每个段独立按 recoveryMode 处理损坏的记录（见 RecoveryMode）；读写文件失败时返回错误
+func (m *WALManager) replay(batchSize int, fn func(rec WALRecord)) error {
+	m.mu.RLock()
+	segments := slices.Clone(m.segments)
+	active := m.active
+	m.mu.RUnlock()
+
+	start := time.Now()
+	progress := RecoveryProgress{Segments: len(segments)}
+	for _, id := range segments[:len(segments)-1] {
+		path := filepath.Join(m.dir, segmentName(id))
+		stat, err := m.fs.Stat(path)
+		if err != nil {
+			return fmt.Errorf("stat wal segment %s: %w", path, err)
+		}
+		progress.Bytes += stat.Size()
+	}
+	progress.Bytes += active.Size()
+
+	for _, id := range segments {
+		progress.Segment = id
+		w := active
+		if id != segments[len(segments)-1] {
+			var err error
+			w, err = m.openSealed(id)
+			if err != nil {
+				return fmt.Errorf("replay wal: %w", err)
+			}
+		}
+		err := m.replaySegment(w, batchSize, &progress, fn)
+		if w != active {
+			w.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("replay wal segment %s: %w", w.path, err)
+		}
+		progress.SegmentsDone++
+		m.listener.OnRecoveryProgress(progress)
+	}
+
+	slog.Info("wal replayed", "dir", m.dir, "segments", progress.Segments, "bytes", progress.BytesDone,
+		"entries", progress.Entries, "workers", m.recoveryConcurrency, "elapsed", time.Since(start))
+	return nil
+}
+
+// replayTxn 回放时正在读取的多记录事务，见 WALRecordTxnBegin
+type replayTxn struct {
+	// begin 事务开始记录的偏移
+	begin int64
+	id    uint64
+	// recs 事务中已经读到的记录，读到提交记录之后一起应用
+	recs []WALRecord
+}
+
+// unterminated 返回事务没有提交记录时的损坏原因
+func (t *replayTxn) unterminated() error {
+	return fmt.Errorf("%w: transaction %d at %d has no commit", errCorruptedWAL, t.id, t.begin)
+}
+
+// replaySegment 回放一个段，见 replay
+func (m *WALManager) replaySegment(w *WAL, batchSize int, progress *RecoveryProgress, fn func(rec WALRecord)) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.fd == nil {
+		return errNilFD
+	}
+	if _, err := w.fd.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// ordered 按读取顺序排列的批次，容量限制了读取领先于应用的距离
+	ordered := make(chan *replayJob, 2*m.recoveryConcurrency)
+	work := make(chan *replayJob, m.recoveryConcurrency)
+	stop := make(chan struct{})
+	var workers sync.WaitGroup
+	for range m.recoveryConcurrency {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for job := range work {
+				job.decode()
+			}
+		}()
+	}
+	defer workers.Wait()
+
+	// 读取协程：读到文件结束、不完整的记录或出错时结束，结果通过以下变量在 ordered 关闭之后返回
+	var (
+		readErr    error
+		tornAt     int64 = -1
+		tornReason error
+	)
+	go func() {
+		defer close(ordered)
+		defer close(work)
+
+		r := bufio.NewReaderSize(w.fd, replayReadBuffer)
+		buf := utils.Pool.Get()
+		defer utils.Pool.Put(buf)
+
+		var offset int64
+		for {
+			job := &replayJob{limit: w.recordLimit(), cipher: w.cipher, done: make(chan struct{})}
+			var err error
+			for len(job.frames) < batchSize {
+				var rec WALRecord
+				rec, err = readFrame(r, buf, w.recordLimit())
+				if err != nil {
+					break
+				}
+				job.offsets = append(job.offsets, offset)
+				job.frames = append(job.frames, rec)
+				job.data = append(job.data, buf.Bytes()...)
+				offset += rec.Size()
+			}
+			if len(job.frames) > 0 {
+				select {
+				case ordered <- job:
+				case <-stop:
+					return
+				}
+				work <- job
+			}
+			switch {
+			case err == nil:
+				continue
+			case err == io.EOF:
+			case errors.Is(err, errCorruptedWAL):
+				tornAt, tornReason = offset, err
+			default:
+				readErr = fmt.Errorf("read record at %d: %w", offset, err)
+			}
+			return
+		}
+	}()
+
+	corruptedAt, reason := int64(-1), error(nil)
+	var decodeErr error
+	// txn 正在读取、还没有读到提交记录的事务
+	var txn *replayTxn
+	apply := func(rec WALRecord) {
+		fn(rec)
+		progress.Entries += int64(len(rec.Entries))
+	}
+	// corrupt 处理 offset 处损坏的记录：SkipCorruptRecords 模式下跳过并返回 true，否则记录损坏位置并返回 false
+	corrupt := func(offset int64, err error) bool {
+		if m.recoveryMode == SkipCorruptRecords {
+			slog.Warn("wal corrupted record skipped", "path", w.path, "offset", offset, "err", err)
+			progress.SkippedRecords++
+			return true
+		}
+		corruptedAt, reason = offset, err
+		return false
+	}
+	for job := range ordered {
+		if corruptedAt >= 0 || decodeErr != nil {
+			// 已经发现损坏或出错，丢弃之后读出的记录，等待读取协程结束
+			continue
+		}
+		<-job.done
+		for i, frame := range job.frames {
+			offset, rec := job.offsets[i], job.recs[i]
+			err := job.err(i)
+			if err != nil && !errors.Is(err, errCorruptedWAL) {
+				// 缺少密钥等：记录本身完好，不能跳过或截断
+				decodeErr = fmt.Errorf("decode record at %d: %w", offset, err)
+				close(stop)
+				break
+			}
+			switch {
+			case err != nil:
+			case rec.Type == WALRecordTxnBegin:
+				if txn != nil {
+					// 上一个事务没有提交记录：跳过时丢弃它已经读到的记录
+					err = txn.unterminated()
+					offset = txn.begin
+				}
+				txn = &replayTxn{begin: job.offsets[i], id: rec.TxnID}
+			case rec.Type == WALRecordTxnCommit:
+				if txn == nil || txn.id != rec.TxnID {
+					err = fmt.Errorf("%w: commit of transaction %d without begin", errCorruptedWAL, rec.TxnID)
+					break
+				}
+				for _, r := range txn.recs {
+					apply(r)
+				}
+				txn = nil
+			case txn != nil:
+				txn.recs = append(txn.recs, rec)
+			default:
+				apply(rec)
+			}
+			if err != nil && !corrupt(offset, err) {
+				close(stop)
+				break
+			}
+			progress.BytesDone += frame.Size()
+		}
+		m.listener.OnRecoveryProgress(*progress)
+	}
+	if decodeErr != nil {
+		return decodeErr
+	}
+	if readErr != nil {
+		return readErr
+	}
+	if corruptedAt < 0 && tornAt >= 0 {
+		// 不完整的记录或不合法的头部之后无法再定位下一条记录，SkipCorruptRecords 也只能截断
+		corruptedAt, reason = tornAt, tornReason
+	}
+	if txn != nil && (corruptedAt < 0 || txn.begin < corruptedAt) {
+		// 没有提交记录的事务是写入中途崩溃留下的，与不完整的记录一样只能截断：
+		// 否则之后追加的记录会被当作这个事务的一部分
+		corruptedAt, reason = txn.begin, txn.unterminated()
+	}
+	if corruptedAt < 0 {
+		return nil
+	}
+	if m.recoveryMode == AbsoluteConsistency {
+		return &WALCorruptionError{Offset: corruptedAt, Err: reason}
+	}
+
+	// 丢弃崩溃时写了一半的尾部记录，保证之后的追加可以被正常恢复
+	slog.Warn("wal corrupted, stop reading", "path", w.path, "offset", corruptedAt, "err", reason)
+	w.corrupted, w.corruptedAt, w.corruptedErr = true, corruptedAt, reason
+	return w.truncateCorruptedTailLocked()
+}
@@ -0,0 +1,237 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+// progressListener 记录收到的回放进度
+type progressListener struct {
+	BaseEventListener
+	mu       sync.Mutex
+	progress []RecoveryProgress
+}
+
+func (l *progressListener) OnRecoveryProgress(p RecoveryProgress) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.progress = append(l.progress, p)
+}
+
+// 测试并行回放按写入顺序应用记录、报告进度，并只截断损坏的段
+func TestWALManager_Replay(t *testing.T) {
+	const sealedRecords, activeRecords = 20, 10
+	tests := []struct {
+		name string
+		// corrupt 破坏第一个（已封存的）段，offsets 为各条记录的起始偏移；返回该段保留的记录数
+		corrupt func(t *testing.T, path string, offsets []int64) int
+	}{
+		{
+			name:    "完整",
+			corrupt: func(t *testing.T, path string, offsets []int64) int { return sealedRecords },
+		},
+		{
+			name: "中间记录校验失败",
+			corrupt: func(t *testing.T, path string, offsets []int64) int {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				data[offsets[7]+walHeaderSize] ^= 0xff
+				if err := os.WriteFile(path, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return 7
+			},
+		},
+		{
+			name: "尾部记录不完整",
+			corrupt: func(t *testing.T, path string, offsets []int64) int {
+				if err := os.Truncate(path, offsets[sealedRecords-1]+3); err != nil {
+					t.Fatal(err)
+				}
+				return sealedRecords - 1
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			m, err := OpenWALManager(dir, Options{})
+			if err != nil {
+				t.Fatalf("打开失败: %v", err)
+			}
+			var keys []string
+			var offsets []int64
+			for i := range sealedRecords + activeRecords {
+				if i == sealedRecords {
+					if _, err := m.Rotate(); err != nil {
+						t.Fatalf("切换失败: %v", err)
+					}
+				}
+				if i < sealedRecords {
+					offsets = append(offsets, m.active.Size())
+				}
+				key := fmt.Sprintf("key:%02d", i)
+				keys = append(keys, key)
+				if _, err := m.Write(&sdbf.Entry{Key: key, Value: []byte("v"), Version: int64(i + 1)}); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+			}
+			if err := m.Close(); err != nil {
+				t.Fatalf("关闭失败: %v", err)
+			}
+
+			path := filepath.Join(dir, segmentName(1))
+			kept := tt.corrupt(t, path, offsets)
+			want := append(keys[:kept:kept], keys[sealedRecords:]...)
+
+			listener := &progressListener{}
+			m, err = OpenWALManager(dir, Options{RecoveryConcurrency: 4, EventListener: listener})
+			if err != nil {
+				t.Fatalf("重新打开失败: %v", err)
+			}
+			defer m.Close()
+			var got []string
+			err = m.replay(3, func(rec WALRecord) {
+				for _, e := range rec.Entries {
+					got = append(got, e.Key)
+				}
+			})
+			if err != nil {
+				t.Fatalf("回放失败: %v", err)
+			}
+			if !slices.Equal(got, want) {
+				t.Fatalf("期望回放 %v, 实际 %v", want, got)
+			}
+
+			// 损坏的段被截断到最后一条完整记录之后
+			stat, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kept < sealedRecords && stat.Size() != offsets[kept] {
+				t.Fatalf("期望段被截断到 %d, 实际 %d", offsets[kept], stat.Size())
+			}
+
+			// 进度单调递增，最后一次报告覆盖所有段与回放的条目
+			p := listener.progress
+			if len(p) == 0 {
+				t.Fatal("没有收到回放进度")
+			}
+			for i := 1; i < len(p); i++ {
+				if p[i].Entries < p[i-1].Entries || p[i].BytesDone < p[i-1].BytesDone || p[i].SegmentsDone < p[i-1].SegmentsDone {
+					t.Fatalf("进度倒退: %+v -> %+v", p[i-1], p[i])
+				}
+			}
+			last := p[len(p)-1]
+			if last.Segments != 2 || last.SegmentsDone != 2 || last.Segment != 2 || last.Entries != int64(len(want)) {
+				t.Fatalf("最后的进度不符合预期: %+v", last)
+			}
+			if last.BytesDone > last.Bytes || (kept == sealedRecords && last.BytesDone != last.Bytes) {
+				t.Fatalf("字节进度不符合预期: %+v", last)
+			}
+		})
+	}
+}
+
+// 测试不同 RecoveryMode 对中间损坏的记录与写了一半的尾部记录的处理
+func TestOpen_RecoveryMode(t *testing.T) {
+	keys := []string{"k0", "k1", "k2", "k3", "k4"}
+	tests := []struct {
+		name string
+		mode RecoveryMode
+		// torn 为 true 时截断最后一条记录，否则破坏 k2 所在记录的数据
+		torn bool
+		// want 打开后能读到的 key，wantErr 为 true 时 Open 应返回损坏错误且不修改 WAL
+		want    []string
+		wantErr bool
+	}{
+		{name: "容忍尾部损坏/中间损坏", mode: TolerateTailCorruption, want: []string{"k0", "k1"}},
+		{name: "容忍尾部损坏/尾部不完整", mode: TolerateTailCorruption, torn: true, want: []string{"k0", "k1", "k2", "k3"}},
+		{name: "绝对一致/中间损坏", mode: AbsoluteConsistency, wantErr: true},
+		{name: "绝对一致/尾部不完整", mode: AbsoluteConsistency, torn: true, wantErr: true},
+		{name: "跳过损坏记录/中间损坏", mode: SkipCorruptRecords, want: []string{"k0", "k1", "k3", "k4"}},
+		{name: "跳过损坏记录/尾部不完整", mode: SkipCorruptRecords, torn: true, want: []string{"k0", "k1", "k2", "k3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			db, err := Open(dir, Options{})
+			if err != nil {
+				t.Fatalf("打开失败: %v", err)
+			}
+			for _, key := range keys {
+				if err := db.Set(key, []byte("v")); err != nil {
+					t.Fatalf("写入失败: %v", err)
+				}
+			}
+			if err := db.Close(); err != nil {
+				t.Fatalf("关闭失败: %v", err)
+			}
+
+			path := filepath.Join(dir, walDirName, segmentName(1))
+			var records []WALRecord
+			if err := InspectWAL(path, nil, func(rec WALRecord) error {
+				records = append(records, rec)
+				return nil
+			}); err != nil {
+				t.Fatalf("读取 WAL 失败: %v", err)
+			}
+			if tt.torn {
+				last := records[len(records)-1]
+				if err := os.Truncate(path, last.Offset+last.Size()-1); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				flipByte(t, path, records[2].Offset+walHeaderSize)
+			}
+			before, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db, err = Open(dir, Options{RecoveryMode: tt.mode})
+			var corruption *WALCorruptionError
+			if tt.wantErr {
+				if !errors.As(err, &corruption) {
+					t.Fatalf("期望损坏错误, 实际 %v", err)
+				}
+				after, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(before, after) {
+					t.Fatal("AbsoluteConsistency 不应修改 WAL")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("重新打开失败: %v", err)
+			}
+			defer db.Close()
+
+			var got []string
+			for _, key := range keys {
+				if _, err := db.Get(key); err == nil {
+					got = append(got, key)
+				} else if !errors.Is(err, ErrNotFound) {
+					t.Fatalf("读取 %s 失败: %v", key, err)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("期望恢复 %v, 实际 %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package lsm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// corruptionListener 收集损坏事件
+type corruptionListener struct {
+	BaseEventListener
+	mu    sync.Mutex
+	infos []CorruptionInfo
+}
+
+func (l *corruptionListener) OnCorruption(info CorruptionInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.infos = append(l.infos, info)
+}
+
+func (l *corruptionListener) reported() []CorruptionInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]CorruptionInfo(nil), l.infos...)
+}
+
+// openScrubDB 打开一个段很小的数据库并写入数据，使其中有多个封存的段
+func openScrubDB(t *testing.T, opts Options) (*DB, string) {
+	t.Helper()
+	dir := t.TempDir()
+	opts.SyncMode, opts.WALSegmentSize = NoSync, 512
+	db, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for i := range 50 {
+		if err := db.Set(fmt.Sprintf("key-%02d", i), bytes.Repeat([]byte{'v'}, 64)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	return db, filepath.Join(dir, walDirName)
+}
+
+func TestDB_Scrub(t *testing.T) {
+	db, walDir := openScrubDB(t, Options{})
+	res, err := db.Scrub(context.Background())
+	if err != nil || len(res.Corruptions) != 0 {
+		t.Fatalf("完好的 WAL 不应报告损坏: %+v %v", res, err)
+	}
+	if res.Segments < 2 || res.Bytes == 0 {
+		t.Fatalf("期望校验多个封存的段: %+v", res)
+	}
+
+	// 破坏第二条记录的数据，第一条记录之前的部分仍然完好
+	path := filepath.Join(walDir, segmentName(2))
+	var second int64
+	if err := InspectWAL(path, nil, func(rec WALRecord) error {
+		if second == 0 && rec.Offset > 0 {
+			second = rec.Offset
+		}
+		return nil
+	}); err != nil || second == 0 {
+		t.Fatalf("找不到第二条记录: %v", err)
+	}
+	flipByte(t, path, second+walHeaderSize)
+
+	res, err = db.Scrub(context.Background())
+	if err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	if len(res.Corruptions) != 1 {
+		t.Fatalf("期望 1 处损坏, 实际 %+v", res.Corruptions)
+	}
+	c := res.Corruptions[0]
+	var corruption *WALCorruptionError
+	if c.Segment != 2 || c.Path != path || c.Offset != second || !errors.As(c.Err, &corruption) {
+		t.Fatalf("损坏信息不正确: %+v", c)
+	}
+	// 数据仍在 MemTable 中，校验不修改文件
+	if _, err := db.Get("key-00"); err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := db.Scrub(canceled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("期望 context.Canceled, 实际 %v", err)
+	}
+	mem := openTestDB(t, InMemory)
+	defer mem.Close()
+	if _, err := mem.Scrub(context.Background()); !errors.Is(err, ErrInMemory) {
+		t.Fatalf("期望 ErrInMemory, 实际 %v", err)
+	}
+}
+
+// 测试后台校验：发现的损坏通过 OnCorruption 报告，同一个段只报告一次
+func TestDB_ScrubBackground(t *testing.T) {
+	listener := &corruptionListener{}
+	_, walDir := openScrubDB(t, Options{ScrubInterval: 5 * time.Millisecond, EventListener: listener})
+	flipByte(t, filepath.Join(walDir, segmentName(1)), walHeaderSize)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(listener.reported()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("后台校验没有报告损坏")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// 再经过几轮校验
+	time.Sleep(50 * time.Millisecond)
+	if got := listener.reported(); len(got) != 1 || got[0].Segment != 1 || got[0].Offset != 0 {
+		t.Fatalf("期望只报告一次段 1 的损坏, 实际 %+v", got)
+	}
+}
+
+func TestThrottledReader(t *testing.T) {
+	start := time.Now()
+	r := &throttledReader{ctx: context.Background(), r: bytes.NewReader(make([]byte, 1000)), rate: 20000, start: start}
+	if n, err := io.Copy(io.Discard, r); err != nil || n != 1000 {
+		t.Fatalf("读取失败: %d %v", n, err)
+	}
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond {
+		t.Fatalf("每秒 20000 字节读取 1000 字节应至少 50ms, 实际 %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r = &throttledReader{ctx: ctx, r: bytes.NewReader(make([]byte, 10)), start: time.Now()}
+	if _, err := r.Read(make([]byte, 10)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("期望 context.Canceled, 实际 %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package lsm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+)
+
+// Watch 订阅默认列族中以 prefix 开头的 key 在序列号 fromSeq 之后的修改，prefix 为空时订阅整个列族
+//
+// 基于 Subscribe 的变更流，每个 Change 只包含匹配的条目，没有匹配条目的提交被跳过，
+// Change.Seq 为其中最大的序列号。与 prefix 对应的 key 区间相交的范围删除同样会被传递，
+// 调用方需要自行判断其中哪些 key 受到影响。fromSeq 与 Subscription 的用法见 Subscribe
+func (db *DB) Watch(ctx context.Context, prefix string, fromSeq int64) (*Subscription, error) {
+	s, err := db.subscribe(ctx, fromSeq, matchPrefix("", prefix))
+	if err != nil {
+		return nil, fmt.Errorf("watch %q: %w", prefix, err)
+	}
+	return s, nil
+}
+
+// Watch 订阅列族中以 prefix 开头的 key 的修改，见 DB.Watch
+func (cf *ColumnFamily) Watch(ctx context.Context, prefix string, fromSeq int64) (*Subscription, error) {
+	s, err := cf.db.subscribe(ctx, fromSeq, matchPrefix(cf.name, prefix))
+	if err != nil {
+		return nil, fmt.Errorf("watch %q: %w", prefix, err)
+	}
+	return s, nil
+}
+
+// matchPrefix 返回判断条目是否属于列族 cf 且 key 以 prefix 开头的函数，
+// 范围墓碑与 prefix 对应的区间（见 utils.PrefixRange）相交即匹配
+func matchPrefix(cf, prefix string) func(*sdbf.Entry) bool {
+	start, end, bounded := utils.PrefixRange(prefix)
+	return func(e *sdbf.Entry) bool {
+		if e.ColumnFamily != cf {
+			return false
+		}
+		if e.RangeEnd == "" {
+			return strings.HasPrefix(e.Key, prefix)
+		}
+		return utils.CompareKey(e.RangeEnd, start) > 0 && (!bounded || utils.CompareKey(e.Key, end) < 0)
+	}
+}
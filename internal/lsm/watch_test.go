@@ -0,0 +1,83 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDB_Watch(t *testing.T) {
+	db := openTestDB(t, t.TempDir())
+	defer db.Close()
+	users, err := db.CF("users")
+	if err != nil {
+		t.Fatalf("获取列族失败: %v", err)
+	}
+
+	watch, err := db.Watch(context.Background(), "user/", 0)
+	if err != nil {
+		t.Fatalf("watch 失败: %v", err)
+	}
+	defer watch.Close()
+	cfWatch, err := users.Watch(context.Background(), "user/", 0)
+	if err != nil {
+		t.Fatalf("watch 失败: %v", err)
+	}
+	defer cfWatch.Close()
+
+	writes := []func() error{
+		func() error { return db.Set("user/1", []byte("a")) },
+		func() error { return db.Set("order/1", []byte("b")) },
+		func() error {
+			b := NewWriteBatch()
+			b.Set("order/2", nil)
+			b.Delete("user/1")
+			b.SetCF(users, "user/9", nil)
+			return db.Write(b)
+		},
+		func() error { return db.DeleteRange("a", "b") },
+		func() error { return db.DeleteRange("order/", "user/1") },
+		func() error { return users.Set("user/2", nil) },
+		func() error { return db.Set("user/3", nil) },
+	}
+	for i, write := range writes {
+		if err := write(); err != nil {
+			t.Fatalf("第 %d 次写入失败: %v", i, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		s    *Subscription
+		want []string
+		seqs []int64
+	}{
+		{"默认列族", watch, []string{"user/1", "user/1", "order/", "user/3"}, []int64{1, 4, 7, 9}},
+		{"列族", cfWatch, []string{"users/user/9", "users/user/2"}, []int64{5, 8}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.want {
+				c := nextChange(t, tt.s)
+				if got := changeKeys(c); got != want || c.Seq != tt.seqs[i] {
+					t.Fatalf("第 %d 个变更期望 %s@%d, 实际 %s@%d", i, want, tt.seqs[i], got, c.Seq)
+				}
+			}
+			select {
+			case c := <-tt.s.Changes():
+				t.Fatalf("不期望更多的变更: %v", changeKeys(c))
+			case <-time.After(3 * subscribePollInterval):
+			}
+		})
+	}
+
+	mem, err := Open(InMemory, DefaultOptions())
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer mem.Close()
+	if _, err := mem.Watch(context.Background(), "", 0); !errors.Is(err, ErrInMemory) {
+		t.Fatalf("期望 ErrInMemory, 实际 %v", err)
+	}
+}
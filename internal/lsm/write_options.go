@@ -0,0 +1,61 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrWriteStalled 写入被阻塞（见 PropIsWriteStalled），设置了 WriteOptions.LowPriority 的写入被拒绝
+var ErrWriteStalled = errors.New("write stalled")
+
+// WriteOptions 控制一次写入，零值与 Write 的行为相同
+type WriteOptions struct {
+	// NoSync 为 true 时即使是 SyncEveryWrite 模式也不等待 fsync，写入在之后的 fsync
+	// （同组或之后的其他写入、DB.Sync）时持久化，崩溃时可能丢失。与其他写入同组提交时，
+	// 只要组内有一个写入需要 fsync，整组都会被 fsync
+	NoSync bool
+	// DisableWAL 为 true 时不写 WAL，写入只存在于 MemTable 中：崩溃后丢失，关闭后除非指定了
+	// CloseOptions.FlushUnlogged（见 Options.TrackUnloggedWrites）也会丢失；也不会出现在 Subscribe、Watch 与复制中。
+	// 只适用于可以重建的数据，例如缓存
+	DisableWAL bool
+	// LowPriority 为 true 时写入被阻塞时不排队等待，直接返回 ErrWriteStalled，
+	// 把提交的机会让给其他写入；调用方可以稍后重试。适用于后台回填等不紧急的写入
+	LowPriority bool
+}
+
+// WriteWithOptions 按 wo 原子地提交一个批次，见 Write
+func (db *DB) WriteWithOptions(b *WriteBatch, wo WriteOptions) error {
+	t := db.startOp("write", "", "")
+	defer t.done()
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+	if err := db.checkBatch(b); err != nil {
+		return fmt.Errorf("write batch: %w", err)
+	}
+	if wo.LowPriority && db.writeStalled() {
+		return fmt.Errorf("write batch: %w", ErrWriteStalled)
+	}
+
+	entries := b.entries()
+	req := &commitRequest{entries: entries, noSync: wo.NoSync, disableWAL: wo.DisableWAL}
+	err := db.memTable.commitRequest(req)
+	t.commit(req)
+	if err != nil {
+		return fmt.Errorf("write batch: %w", err)
+	}
+	b.seq = entries[len(entries)-1].Version
+	return nil
+}
+
+// writeStalled 报告写入是否被阻塞：异步写入队列已满
+func (db *DB) writeStalled() bool {
+	return len(db.asyncSlots) == cap(db.asyncSlots)
+}
@@ -0,0 +1,113 @@
+package lsm
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/vfs"
+)
+
+// 测试 WriteOptions：NoSync 不 fsync，DisableWAL 不写 WAL、重新打开后丢失，LowPriority 在写入阻塞时被拒绝
+func TestDB_WriteOptions(t *testing.T) {
+	dir := t.TempDir()
+	fail := &atomic.Bool{}
+	opts := Options{SyncMode: SyncEveryWrite, AsyncWriteQueueSize: 1, FS: failSyncFS{FS: vfs.NewMemFS(), fail: fail}}
+	db, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+
+	// 默认写入在 fsync 失败时返回错误
+	fail.Store(true)
+	if err := db.Set("sync-fail", []byte("v")); err == nil {
+		t.Fatalf("fsync 失败时期望写入失败")
+	}
+	fail.Store(false)
+
+	stall := func() { db.asyncSlots <- struct{}{} }
+	tests := []struct {
+		name    string
+		key     string
+		wo      WriteOptions
+		prepare func()
+		wantErr error
+		// persist 重新打开之后是否还能读到
+		persist bool
+	}{
+		{name: "默认", key: "default", persist: true},
+		{name: "NoSync 不受 fsync 失败影响", key: "no-sync", wo: WriteOptions{NoSync: true}, prepare: func() { fail.Store(true) }, persist: true},
+		{name: "DisableWAL", key: "no-wal", wo: WriteOptions{DisableWAL: true}, prepare: func() { fail.Store(true) }},
+		{name: "LowPriority 被拒绝", key: "low-stalled", wo: WriteOptions{LowPriority: true}, prepare: stall, wantErr: ErrWriteStalled},
+		{name: "阻塞时普通写入不受影响", key: "stalled", prepare: stall, persist: true},
+		{name: "LowPriority 未阻塞", key: "low", wo: WriteOptions{LowPriority: true}, persist: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.prepare != nil {
+				tt.prepare()
+			}
+			defer func() {
+				fail.Store(false)
+				if len(db.asyncSlots) > 0 {
+					<-db.asyncSlots
+				}
+			}()
+
+			b := NewWriteBatch()
+			b.Set(tt.key, []byte("v"))
+			err := db.WriteWithOptions(b, tt.wo)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("期望错误 %v, 实际 %v", tt.wantErr, err)
+			}
+			if got, err := db.Get(tt.key); (err == nil) != (tt.wantErr == nil) || (err == nil && string(got) != "v") {
+				t.Fatalf("写入之后读取结果不正确: %q %v", got, err)
+			}
+		})
+	}
+	db.Close()
+
+	db, err = Open(dir, opts)
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer db.Close()
+	for _, tt := range tests {
+		if _, err := db.Get(tt.key); (err == nil) != tt.persist {
+			t.Fatalf("%s: 重新打开后期望可读 %v, 实际 %v", tt.name, tt.persist, err)
+		}
+	}
+}
+
+// 测试同一组提交中跳过 WAL 的写入不影响其他写入落盘
+func TestMemTable_WriteWALSkipsDisabled(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir, Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	reqs := []*commitRequest{
+		{entries: []*sdbf.Entry{{Key: "a", Value: []byte("v")}}, disableWAL: true},
+		{entries: []*sdbf.Entry{{Key: "b", Value: []byte("v")}}},
+		{entries: []*sdbf.Entry{{Key: "c", Value: []byte("v")}}, disableWAL: true},
+	}
+	db.memTable.applyGroup(reqs)
+	for _, r := range reqs {
+		if r.err != nil {
+			t.Fatalf("提交失败: %v", r.err)
+		}
+	}
+	db.Close()
+
+	db, err = Open(dir, Options{SyncMode: NoSync})
+	if err != nil {
+		t.Fatalf("重新打开失败: %v", err)
+	}
+	defer db.Close()
+	for key, want := range map[string]bool{"a": false, "b": true, "c": false} {
+		if _, err := db.Get(key); (err == nil) != want {
+			t.Fatalf("key %s 期望可读 %v, 实际 %v", key, want, err)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package replication
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+)
+
+// errPositionGone leader 上已没有 follower 需要的 WAL 位置，需要重新追赶
+var errPositionGone = errors.New("wal position gone on leader")
+
+// FollowerOptions 控制 Follower 的拉取行为
+type FollowerOptions struct {
+	// Client 访问 leader 使用的 HTTP 客户端，为 nil 时使用 http.DefaultClient；
+	// leader 启用 TLS 时在其 Transport 中配置 TLSClientConfig
+	Client *http.Client
+	// Token leader 启用认证时使用的 token（至少需要只读权限），以 Bearer 方式发送
+	Token string
+	// PollWait 没有新记录时 leader 长轮询等待的时间
+	PollWait time.Duration
+	// RetryInterval 请求失败后重试前等待的时间
+	RetryInterval time.Duration
+	// EncryptionKeys leader 启用了 WAL 加密时解密拉取到的记录，通常与 leader 的 Options.EncryptionKeys 相同
+	EncryptionKeys lsm.KeyProvider
+}
+
+// DefaultFollowerOptions 返回默认的 follower 配置
+func DefaultFollowerOptions() FollowerOptions {
+	return FollowerOptions{
+		Client:        http.DefaultClient,
+		PollWait:      time.Second,
+		RetryInterval: time.Second,
+	}
+}
+
+// Follower 从 leader 拉取 WAL 记录并应用到本地的 db
+//
+// 复制来的条目保留 leader 分配的序列号，因此 db 上不应有本地写入，
+// 否则之后的复制会因为序列号冲突而停止（Run 返回 lsm.ErrSequenceOutOfOrder）
+type Follower struct {
+	db     *lsm.DB
+	leader string
+	opts   FollowerOptions
+
+	mu sync.Mutex
+	// cursor 下一次拉取的位置，synced 为 false 时无效，需要先通过 changes 追赶
+	cursor  lsm.WALPosition
+	synced  bool
+	lastSeq int64
+}
+
+// NewFollower 创建一个从 leaderURL（leader 的 HTTP 地址，例如 http://10.0.0.1:8080）复制到 db 的 Follower
+func NewFollower(db *lsm.DB, leaderURL string, opts FollowerOptions) *Follower {
+	def := DefaultFollowerOptions()
+	if opts.Client == nil {
+		opts.Client = def.Client
+	}
+	if opts.PollWait <= 0 {
+		opts.PollWait = def.PollWait
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = def.RetryInterval
+	}
+	return &Follower{db: db, leader: leaderURL, opts: opts}
+}
+
+// Run 持续复制直到 ctx 被取消，返回 ctx 的错误
+//
+// 网络等临时错误会在 RetryInterval 之后重试；follower 的数据比 leader 新
+// （序列号冲突）时无法继续复制，返回 lsm.ErrSequenceOutOfOrder
+func (f *Follower) Run(ctx context.Context) error {
+	seq, err := f.db.LastSequence()
+	if err != nil {
+		return fmt.Errorf("start follower: %w", err)
+	}
+	f.mu.Lock()
+	f.lastSeq = seq
+	f.mu.Unlock()
+	slog.Info("follower started", "leader", f.leader, "seq", seq)
+
+	for {
+		err := f.step(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, errPositionGone):
+			slog.Info("follower position gone on leader, catching up", "leader", f.leader, "err", err)
+			f.mu.Lock()
+			f.synced = false
+			f.mu.Unlock()
+		case errors.Is(err, lsm.ErrSequenceOutOfOrder):
+			return fmt.Errorf("follow %s: %w", f.leader, err)
+		default:
+			slog.Warn("replication failed, retrying", "leader", f.leader, "err", err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(f.opts.RetryInterval):
+			}
+		}
+	}
+}
+
+// Position 返回下一次拉取的 WAL 位置与已应用的最新序列号，还未完成首次同步时 ok 为 false
+func (f *Follower) Position() (pos lsm.WALPosition, seq int64, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.cursor, f.lastSeq, f.synced
+}
+
+// step 完成一次拉取：未同步时请求 changes 追赶，否则从 cursor 拉取 WAL 记录
+func (f *Follower) step(ctx context.Context) error {
+	f.mu.Lock()
+	cursor, synced, since := f.cursor, f.synced, f.lastSeq
+	f.mu.Unlock()
+
+	var u string
+	if synced {
+		u = fmt.Sprintf("%s/replication/wal?pos=%s&wait=%s", f.leader, url.QueryEscape(cursor.String()), f.opts.PollWait)
+	} else {
+		u = fmt.Sprintf("%s/replication/changes?since=%d", f.leader, since)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	if f.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.opts.Token)
+	}
+	resp, err := f.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusGone:
+		return fmt.Errorf("%w: %s", errPositionGone, readError(resp.Body))
+	case http.StatusConflict:
+		return fmt.Errorf("%w: follower is ahead of leader: %s", lsm.ErrSequenceOutOfOrder, readError(resp.Body))
+	default:
+		return fmt.Errorf("leader returned %s: %s", resp.Status, readError(resp.Body))
+	}
+	next, err := lsm.ParseWALPosition(resp.Header.Get(headerNext))
+	if err != nil {
+		return fmt.Errorf("leader response: %w", err)
+	}
+
+	if err := lsm.DecodeWAL(bufio.NewReader(resp.Body), f.opts.EncryptionKeys, f.apply); err != nil {
+		return fmt.Errorf("apply records from %s: %w", u, err)
+	}
+
+	f.mu.Lock()
+	f.cursor, f.synced = next, true
+	f.mu.Unlock()
+	return nil
+}
+
+// apply 应用一条记录，跳过已经应用过的记录（重复拉取或追赶之后回放 WAL）
+func (f *Follower) apply(rec lsm.WALRecord) error {
+	if rec.Type == lsm.WALRecordCreateColumnFamily {
+		// 创建列族是幂等的，不需要判断是否已经应用过
+		_, err := f.db.CF(rec.ColumnFamily)
+		return err
+	}
+	if len(rec.Entries) == 0 {
+		return nil
+	}
+	last := rec.Entries[len(rec.Entries)-1].Version
+	f.mu.Lock()
+	applied := last <= f.lastSeq
+	f.mu.Unlock()
+	if applied {
+		return nil
+	}
+
+	if err := f.db.ApplyReplicated(rec.Entries); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.lastSeq = last
+	f.mu.Unlock()
+	return nil
+}
+
+// readError 读取错误响应体作为错误信息
+func readError(r io.Reader) string {
+	b, _ := io.ReadAll(io.LimitReader(r, 1024))
+	return strconv.Quote(string(b))
+}
@@ -0,0 +1,143 @@
+// Package replication 实现基于 WAL 传输的主从复制：leader 通过 HTTP 提供已写入的 WAL 记录，
+// follower 拉取后原样（保留序列号）应用到自己的数据库
+//
+// 复制流程：
+//
+//  1. follower 启动时请求 /replication/changes?since=<本地最新序列号>，得到每个 key 的最新修改
+//     以及继续追赶的 WAL 位置（段序号 + 段内偏移）
+//  2. 之后从该位置开始循环请求 /replication/wal，leader 没有新记录时长轮询等待
+//  3. 位置不可用（段已被删除，或 leader 重启后截断了尾部）时回到第 1 步
+//
+// 记录以 WAL 段文件格式传输，follower 解码时逐条校验 CRC；已应用的记录按序列号跳过，
+// 因此重复拉取同一段数据是安全的
+package replication
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+)
+
+const (
+	// headerNext 响应头，给出下一次请求 /replication/wal 的位置
+	headerNext = "Sdbf-Wal-Next"
+
+	// maxResponseBytes 一次 /replication/wal 响应最多携带的记录字节数（至少一条记录）
+	maxResponseBytes = 4 << 20
+	// maxWait 长轮询的最长等待时间
+	maxWait = 30 * time.Second
+	// pollInterval 长轮询期间检查新记录的间隔
+	pollInterval = 20 * time.Millisecond
+)
+
+// Leader 向 follower 提供 db 的 WAL 记录，路由：
+//
+//	GET /replication/wal?pos=3/1024&wait=1s   从 pos 开始的记录，没有新记录时最多等待 wait
+//	GET /replication/changes?since=42         序列号大于 since 的修改，用于首次同步与追赶
+//
+// 两者的响应体都是 WAL 段文件格式的记录，响应头 Sdbf-Wal-Next 给出下一次请求 /replication/wal
+// 的位置。位置不可用时返回 410，since 超过 leader 的最新序列号时返回 409
+type Leader struct {
+	db *lsm.DB
+}
+
+// NewLeader 创建一个基于 db 的 Leader，db 的生命周期由调用方管理
+func NewLeader(db *lsm.DB) *Leader {
+	return &Leader{db: db}
+}
+
+// Handler 返回复制相关的路由
+func (l *Leader) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /replication/wal", l.handleWAL)
+	mux.HandleFunc("GET /replication/changes", l.handleChanges)
+	return mux
+}
+
+func (l *Leader) handleWAL(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	pos, err := lsm.ParseWALPosition(q.Get("pos"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var wait time.Duration
+	if v := q.Get("wait"); v != "" {
+		wait, err = time.ParseDuration(v)
+		if err != nil || wait < 0 {
+			http.Error(w, fmt.Sprintf("invalid wait %q", v), http.StatusBadRequest)
+			return
+		}
+		wait = min(wait, maxWait)
+	}
+
+	buf := utils.Pool.Get()
+	defer utils.Pool.Put(buf)
+
+	deadline := time.Now().Add(wait)
+	for {
+		next, err := l.db.ReadWAL(pos, maxResponseBytes, buf)
+		if err != nil {
+			writeError(w, r, err)
+			return
+		}
+		if buf.Len() > 0 || next != pos || !time.Now().Before(deadline) {
+			w.Header().Set(headerNext, next.String())
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+			buf.WriteTo(w)
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (l *Leader) handleChanges(w http.ResponseWriter, r *http.Request) {
+	since, err := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	if err != nil || since < 0 {
+		http.Error(w, fmt.Sprintf("invalid since %q", r.URL.Query().Get("since")), http.StatusBadRequest)
+		return
+	}
+
+	// 位置在写完修改之后才能确定，先写入缓冲区再一起返回
+	buf := utils.Pool.Get()
+	defer utils.Pool.Put(buf)
+	next, err := l.db.WriteChangesSince(buf, since)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set(headerNext, next.String())
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	buf.WriteTo(w)
+}
+
+// writeError 把引擎错误映射为 HTTP 状态码，follower 据此决定重新追赶还是停止复制
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, lsm.ErrWALPositionGone):
+		status = http.StatusGone
+	case errors.Is(err, lsm.ErrSequenceOutOfOrder):
+		status = http.StatusConflict
+	case errors.Is(err, lsm.ErrInMemory):
+		status = http.StatusNotImplemented
+	case errors.Is(err, lsm.ErrClosed):
+		status = http.StatusServiceUnavailable
+	default:
+		slog.Error("replication request failed", "path", r.URL.Path, "query", r.URL.RawQuery, "err", err)
+	}
+	http.Error(w, err.Error(), status)
+}
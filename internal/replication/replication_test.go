@@ -0,0 +1,167 @@
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+)
+
+// openDB 打开一个段很小的数据库，keys 不为 nil 时启用 WAL 加密
+func openDB(t *testing.T, keys lsm.KeyProvider) *lsm.DB {
+	t.Helper()
+	opts := lsm.DefaultOptions()
+	opts.WALSegmentSize = 256
+	opts.EncryptionKeys = keys
+	db, err := lsm.Open(t.TempDir(), opts)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func dump(t *testing.T, db *lsm.DB) map[string]string {
+	t.Helper()
+	entries, err := db.Scan("", "\xff")
+	if err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	got := map[string]string{}
+	for _, e := range entries {
+		got[e.Key] = string(e.Value)
+	}
+	return got
+}
+
+// waitSynced 等待 follower 的数据与 leader 一致
+func waitSynced(t *testing.T, leader, follower *lsm.DB) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		want, got := dump(t, leader), dump(t, follower)
+		if maps.Equal(want, got) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("follower 未追上 leader: 期望 %v, 实际 %v", want, got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFollower(t *testing.T) {
+	tests := []struct {
+		name string
+		keys lsm.KeyProvider
+	}{
+		{name: "plain"},
+		// leader 的 WAL 加密时 follower 用同样的密钥解密拉取到的记录
+		{name: "encrypted", keys: lsm.StaticKey{ID: 1, Secret: make([]byte, 32)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) { testFollower(t, tt.keys) })
+	}
+}
+
+func testFollower(t *testing.T, keys lsm.KeyProvider) {
+	leader := openDB(t, keys)
+	srv := httptest.NewServer(NewLeader(leader).Handler())
+	defer srv.Close()
+
+	// 启动前已有的数据通过 changes 追赶
+	for i := range 10 {
+		if err := leader.Set(fmt.Sprintf("key%02d", i), []byte("old")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	if err := leader.Delete("key00"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+
+	follower := openDB(t, keys)
+	f := NewFollower(follower, srv.URL, FollowerOptions{PollWait: 50 * time.Millisecond, RetryInterval: 10 * time.Millisecond, EncryptionKeys: keys})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- f.Run(ctx) }()
+	waitSynced(t, leader, follower)
+
+	// 之后的写入通过 WAL 复制，跨越多个段
+	for i := range 30 {
+		if err := leader.Set(fmt.Sprintf("key%02d", i), []byte("new")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	b := lsm.NewWriteBatch()
+	b.Delete("key01")
+	b.Set("batch", []byte("1"))
+	if err := leader.Write(b); err != nil {
+		t.Fatalf("批量写入失败: %v", err)
+	}
+	waitSynced(t, leader, follower)
+
+	pos, seq, ok := f.Position()
+	leaderStats, _ := leader.Stats()
+	if !ok || pos.Segment < 2 || seq != leaderStats.LastSequence {
+		t.Fatalf("复制位置不符合预期: %v seq %d ok %v, leader seq %d", pos, seq, ok, leaderStats.LastSequence)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("期望 %v, 实际 %v", context.Canceled, err)
+	}
+}
+
+func TestFollower_AheadOfLeader(t *testing.T) {
+	leader := openDB(t, nil)
+	srv := httptest.NewServer(NewLeader(leader).Handler())
+	defer srv.Close()
+	if err := leader.Set("a", nil); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	// follower 上有 leader 没有的写入，无法继续复制
+	follower := openDB(t, nil)
+	for _, k := range []string{"x", "y"} {
+		if err := follower.Set(k, nil); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	f := NewFollower(follower, srv.URL, FollowerOptions{RetryInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := f.Run(ctx); !errors.Is(err, lsm.ErrSequenceOutOfOrder) {
+		t.Fatalf("期望 %v, 实际 %v", lsm.ErrSequenceOutOfOrder, err)
+	}
+}
+
+func TestLeader_BadRequest(t *testing.T) {
+	h := NewLeader(openDB(t, nil)).Handler()
+	tests := []struct {
+		name   string
+		target string
+		want   int
+	}{
+		{name: "非法位置", target: "/replication/wal?pos=abc", want: http.StatusBadRequest},
+		{name: "非法等待时间", target: "/replication/wal?pos=1/0&wait=x", want: http.StatusBadRequest},
+		{name: "位置不可用", target: "/replication/wal?pos=9/0", want: http.StatusGone},
+		{name: "非法序列号", target: "/replication/changes?since=-1", want: http.StatusBadRequest},
+		{name: "序列号超前", target: "/replication/changes?since=100", want: http.StatusConflict},
+		{name: "没有新记录", target: "/replication/wal?pos=1/0", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("期望状态码 %d, 实际 %d: %s", tt.want, rec.Code, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Role 客户端被授予的权限
+type Role int
+
+const (
+	// RoleNone 未通过认证，只能执行认证相关的命令
+	RoleNone Role = iota
+	// RoleReadOnly 只能读取：GET、SCAN、统计信息与复制
+	RoleReadOnly
+	// RoleReadWrite 可以读写
+	RoleReadWrite
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleNone:
+		return "none"
+	case RoleReadOnly:
+		return "ro"
+	case RoleReadWrite:
+		return "rw"
+	default:
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+}
+
+// parseRole 解析 ro / rw
+func parseRole(s string) (Role, error) {
+	switch s {
+	case "ro":
+		return RoleReadOnly, nil
+	case "rw":
+		return RoleReadWrite, nil
+	default:
+		return RoleNone, fmt.Errorf("invalid role %q, want ro or rw", s)
+	}
+}
+
+// AuthConfig 网络服务的 TLS 与认证配置，零值表示不加密、不认证，只适合可信的局域网
+//
+// 客户端的权限取 token 与客户端证书授予的角色中较高的一个：
+// HTTP 通过 "Authorization: Bearer <token>" 携带 token，RESP 通过 AUTH 命令；
+// 双向 TLS 时客户端证书的 CommonName 在 CertRoles 中查找。
+// Tokens 与 CertRoles 都为空时不做认证，所有客户端都可以读写
+type AuthConfig struct {
+	// TLS 非 nil 时在 TLS 之上提供服务，ClientAuth 设为 tls.RequireAndVerifyClientCert 即为双向 TLS
+	TLS *tls.Config
+	// Tokens token -> 角色
+	Tokens map[string]Role
+	// CertRoles 客户端证书的 CommonName -> 角色
+	CertRoles map[string]Role
+}
+
+// enabled 是否需要认证
+func (c *AuthConfig) enabled() bool {
+	return c != nil && (len(c.Tokens) > 0 || len(c.CertRoles) > 0)
+}
+
+// role 返回 token 与客户端证书共同授予的角色，未启用认证时总是 RoleReadWrite
+func (c *AuthConfig) role(token string, cs *tls.ConnectionState) Role {
+	if !c.enabled() {
+		return RoleReadWrite
+	}
+	return max(c.tokenRole(token), c.certRole(cs))
+}
+
+// tokenRole 逐个比较所有 token，比较耗时与 token 是否匹配无关
+func (c *AuthConfig) tokenRole(token string) Role {
+	role := RoleNone
+	if token == "" {
+		return role
+	}
+	for t, r := range c.Tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			role = r
+		}
+	}
+	return role
+}
+
+// certRole 返回已验证的客户端证书授予的角色，没有证书时为 RoleNone
+func (c *AuthConfig) certRole(cs *tls.ConnectionState) Role {
+	// VerifiedChains 只在证书通过 ClientCAs 验证后才非空
+	if cs == nil || len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+		return RoleNone
+	}
+	return c.CertRoles[cs.VerifiedChains[0][0].Subject.CommonName]
+}
+
+// LoadAuthFile 从文件读取 token 与证书角色，每行一条规则，# 开头的行与空行被忽略：
+//
+//	token <ro|rw> <token>
+//	cert  <ro|rw> <client certificate CommonName>
+func LoadAuthFile(path string) (tokens, certRoles map[string]Role, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load auth file: %w", err)
+	}
+	defer f.Close()
+
+	tokens, certRoles = make(map[string]Role), make(map[string]Role)
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, nil, fmt.Errorf("load auth file %s:%d: want \"<token|cert> <ro|rw> <value>\"", path, line)
+		}
+		role, err := parseRole(fields[1])
+		if err != nil {
+			return nil, nil, fmt.Errorf("load auth file %s:%d: %w", path, line, err)
+		}
+		switch fields[0] {
+		case "token":
+			tokens[fields[2]] = role
+		case "cert":
+			certRoles[fields[2]] = role
+		default:
+			return nil, nil, fmt.Errorf("load auth file %s:%d: unknown kind %q", path, line, fields[0])
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, fmt.Errorf("load auth file %s: %w", path, err)
+	}
+	return tokens, certRoles, nil
+}
+
+// bearerToken 返回请求 Authorization 头中的 Bearer token
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// requireRole 包装 h：请求的角色低于 need 时返回 401（未认证）或 403（权限不足）
+func (c *AuthConfig) requireRole(need Role, h http.HandlerFunc) http.HandlerFunc {
+	if !c.enabled() {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch role := c.role(bearerToken(r), r.TLS); {
+		case role == RoleNone:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sdbf"`)
+			writeJSON(w, http.StatusUnauthorized, httpError{Error: "authentication required"})
+		case role < need:
+			writeJSON(w, http.StatusForbidden, httpError{Error: fmt.Sprintf("role %s cannot perform this operation", role)})
+		default:
+			h(w, r)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 测试 RESP 的 AUTH：未认证时拒绝命令，只读 token 不能写入
+func TestRESPServer_Auth(t *testing.T) {
+	auth := &AuthConfig{Tokens: map[string]Role{"reader": RoleReadOnly, "writer": RoleReadWrite}}
+	conn, _ := startRESPServer(t, openTestDB(t), auth)
+	r := bufio.NewReader(conn)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "未认证", args: []string{"GET", "k"}, want: "-NOAUTH Authentication required.\r\n"},
+		{name: "错误的 token", args: []string{"AUTH", "nope"}, want: "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		{name: "只读 token", args: []string{"AUTH", "reader"}, want: "+OK\r\n"},
+		{name: "只读可以读取", args: []string{"GET", "k"}, want: "$-1\r\n"},
+		{name: "只读不能写入", args: []string{"SET", "k", "v"}, want: "-NOPERM this user has no permissions to run the 'set' command\r\n"},
+		{name: "失败的 AUTH 保留原有角色", args: []string{"AUTH", "nope"}, want: "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		{name: "仍然可以读取", args: []string{"EXISTS", "k"}, want: ":0\r\n"},
+		{name: "用户名加 token", args: []string{"AUTH", "default", "writer"}, want: "+OK\r\n"},
+		{name: "读写 token 可以写入", args: []string{"SET", "k", "v"}, want: "+OK\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := conn.Write([]byte(encodeCommand(tt.args...))); err != nil {
+				t.Fatalf("发送失败: %v", err)
+			}
+			if got := readReply(t, r); got != tt.want {
+				t.Fatalf("期望 %q, 实际 %q", tt.want, got)
+			}
+		})
+	}
+
+	// 未启用认证时 AUTH 报错，与 Redis 一致
+	conn, _ = startRESPServer(t, openTestDB(t), nil)
+	if _, err := conn.Write([]byte(encodeCommand("AUTH", "x"))); err != nil {
+		t.Fatalf("发送失败: %v", err)
+	}
+	if got := readReply(t, bufio.NewReader(conn)); !strings.HasPrefix(got, "-ERR AUTH <password> called without any password") {
+		t.Fatalf("未启用认证时期望 AUTH 报错, 实际 %q", got)
+	}
+}
+
+// 测试 HTTP 的 Bearer token：401 未认证、403 权限不足
+func TestHTTPServer_Auth(t *testing.T) {
+	s := NewHTTPServer(openTestDB(t))
+	s.SetAuth(&AuthConfig{Tokens: map[string]Role{"reader": RoleReadOnly, "writer": RoleReadWrite}})
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "没有 token", method: http.MethodGet, path: "/kv/k", wantStatus: http.StatusUnauthorized},
+		{name: "错误的 token", method: http.MethodGet, path: "/stats", token: "nope", wantStatus: http.StatusUnauthorized},
+		{name: "只读写入", method: http.MethodPut, path: "/kv/k", token: "reader", wantStatus: http.StatusForbidden},
+		{name: "只读批量写入", method: http.MethodPost, path: "/batch", token: "reader", wantStatus: http.StatusForbidden},
+		{name: "读写写入", method: http.MethodPut, path: "/kv/k", token: "writer", wantStatus: http.StatusNoContent},
+		{name: "只读读取", method: http.MethodGet, path: "/kv/k", token: "reader", wantStatus: http.StatusOK},
+		{name: "只读扫描", method: http.MethodGet, path: "/scan", token: "reader", wantStatus: http.StatusOK},
+		{name: "复制需要认证", method: http.MethodGet, path: "/replication/wal", wantStatus: http.StatusUnauthorized},
+		{name: "health 不需要认证", method: http.MethodGet, path: "/health", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader("v"))
+			if err != nil {
+				t.Fatalf("构造请求失败: %v", err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("期望状态码 %d, 实际 %d", tt.wantStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+// testPKI 测试用的 CA 以及由它签发的证书
+type testPKI struct {
+	pool   *x509.CertPool
+	caCert *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sdbf test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testPKI{pool: pool, caCert: cert, caKey: key}
+}
+
+// issue 签发 CommonName 为 cn 的证书，server 为 true 时可用于 127.0.0.1 上的服务端
+func (p *testPKI) issue(t *testing.T, cn string, server bool) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		tmpl.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, p.caCert, &key.PublicKey, p.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// 测试双向 TLS：按客户端证书的 CommonName 授予角色，没有证书的客户端无法完成握手
+func TestServer_MutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	auth := &AuthConfig{
+		TLS: &tls.Config{
+			Certificates: []tls.Certificate{pki.issue(t, "server", true)},
+			ClientCAs:    pki.pool,
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+		},
+		CertRoles: map[string]Role{"reader": RoleReadOnly, "writer": RoleReadWrite},
+	}
+	clientTLS := func(cn string) *tls.Config {
+		cfg := &tls.Config{RootCAs: pki.pool}
+		if cn != "" {
+			cfg.Certificates = []tls.Certificate{pki.issue(t, cn, false)}
+		}
+		return cfg
+	}
+
+	db := openTestDB(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	hs := NewHTTPServer(db)
+	hs.SetAuth(auth)
+	go hs.Serve(ln)
+	defer hs.Close()
+
+	tests := []struct {
+		name       string
+		cn         string
+		method     string
+		wantStatus int
+		// wantErr 为 true 时期望 TLS 握手失败
+		wantErr bool
+	}{
+		{name: "读写证书写入", cn: "writer", method: http.MethodPut, wantStatus: http.StatusNoContent},
+		{name: "只读证书读取", cn: "reader", method: http.MethodGet, wantStatus: http.StatusOK},
+		{name: "只读证书写入", cn: "reader", method: http.MethodPut, wantStatus: http.StatusForbidden},
+		{name: "未授权的证书", cn: "stranger", method: http.MethodGet, wantStatus: http.StatusUnauthorized},
+		{name: "没有证书", method: http.MethodGet, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS(tt.cn)}}
+			req, err := http.NewRequest(tt.method, "https://"+ln.Addr().String()+"/kv/k", strings.NewReader("v"))
+			if err != nil {
+				t.Fatalf("构造请求失败: %v", err)
+			}
+			resp, err := c.Do(req)
+			if tt.wantErr {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatal("没有客户端证书时期望握手失败")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("期望状态码 %d, 实际 %d", tt.wantStatus, resp.StatusCode)
+			}
+		})
+	}
+
+	// RESP 连接按证书获得角色，不需要 AUTH
+	rln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	rs := NewRESPServer(db)
+	rs.SetAuth(auth)
+	served := make(chan error, 1)
+	go func() { served <- rs.Serve(rln) }()
+	defer func() {
+		rs.Close()
+		if err := <-served; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Serve 期望返回 ErrServerClosed, 实际 %v", err)
+		}
+	}()
+
+	for _, tc := range []struct{ cn, want string }{
+		{cn: "writer", want: "+OK\r\n"},
+		{cn: "reader", want: "-NOPERM this user has no permissions to run the 'set' command\r\n"},
+	} {
+		conn, err := tls.Dial("tcp", rln.Addr().String(), clientTLS(tc.cn))
+		if err != nil {
+			t.Fatalf("连接失败: %v", err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write([]byte(encodeCommand("SET", "k", "v"))); err != nil {
+			t.Fatalf("发送失败: %v", err)
+		}
+		if got := readReply(t, bufio.NewReader(conn)); got != tc.want {
+			t.Fatalf("%s 期望 %q, 实际 %q", tc.cn, tc.want, got)
+		}
+		conn.Close()
+	}
+}
+
+func TestLoadAuthFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantToken map[string]Role
+		wantCert  map[string]Role
+		wantErr   bool
+	}{
+		{
+			name:      "正常",
+			content:   "# 注释\n\ntoken ro r-token\ntoken rw w-token\ncert rw backup-job\n",
+			wantToken: map[string]Role{"r-token": RoleReadOnly, "w-token": RoleReadWrite},
+			wantCert:  map[string]Role{"backup-job": RoleReadWrite},
+		},
+		{name: "未知角色", content: "token admin x\n", wantErr: true},
+		{name: "未知类型", content: "user rw x\n", wantErr: true},
+		{name: "字段个数错误", content: "token rw\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "auth")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			tokens, certs, err := LoadAuthFile(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("期望出错 %v, 实际 %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(tokens) != len(tt.wantToken) || len(certs) != len(tt.wantCert) {
+				t.Fatalf("期望 %v %v, 实际 %v %v", tt.wantToken, tt.wantCert, tokens, certs)
+			}
+			for k, v := range tt.wantToken {
+				if tokens[k] != v {
+					t.Fatalf("token %s 期望 %s, 实际 %s", k, v, tokens[k])
+				}
+			}
+			for k, v := range tt.wantCert {
+				if certs[k] != v {
+					t.Fatalf("cert %s 期望 %s, 实际 %s", k, v, certs[k])
+				}
+			}
+		})
+	}
+}
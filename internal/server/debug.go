@@ -0,0 +1,98 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+)
+
+// DebugServer 提供在线排查问题用的 HTTP 接口：
+//
+//	GET /debug/pprof/...                  net/http/pprof 的 CPU、堆、goroutine 等剖析
+//	GET /debug/lsm/memtable               返回 lsm.MemTableInfo（JSON）
+//	GET /debug/lsm/levels                 返回数据文件的布局（JSON，见 debugLevelsResponse）
+//
+// 这些接口会暴露内部状态，pprof 还可能拖慢服务，不做认证，应只监听在本机或受信任的管理网络上
+type DebugServer struct {
+	db  *lsm.DB
+	srv *http.Server
+}
+
+// NewDebugServer 创建一个基于 db 的调试服务，db 的生命周期由调用方管理
+func NewDebugServer(db *lsm.DB) *DebugServer {
+	s := &DebugServer{db: db}
+	s.srv = &http.Server{Handler: s.Handler()}
+	return s
+}
+
+// Handler 返回路由，便于挂载到已有的 http.Server 或在测试中直接使用
+func (s *DebugServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	// pprof.Index 按路径分发 heap、goroutine 等命名的 profile
+	mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+	mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("GET /debug/lsm/memtable", s.handleMemTable)
+	mux.HandleFunc("GET /debug/lsm/levels", s.handleLevels)
+	return mux
+}
+
+// ListenAndServe 监听 addr 并处理请求，直到 Close 被调用
+func (s *DebugServer) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen debug %s: %w", addr, err)
+	}
+	return s.Serve(ln)
+}
+
+// Serve 在 ln 上处理请求，Close 之后返回 ErrServerClosed
+func (s *DebugServer) Serve(ln net.Listener) error {
+	slog.Info("debug server listening", "addr", ln.Addr().String())
+	err := s.srv.Serve(ln)
+	if errors.Is(err, http.ErrServerClosed) {
+		return ErrServerClosed
+	}
+	return fmt.Errorf("serve debug: %w", err)
+}
+
+// Close 立即关闭监听和所有连接
+func (s *DebugServer) Close() error {
+	if err := s.srv.Close(); err != nil {
+		return fmt.Errorf("close debug server: %w", err)
+	}
+	return nil
+}
+
+func (s *DebugServer) handleMemTable(w http.ResponseWriter, r *http.Request) {
+	info, err := s.db.MemTableInfo()
+	if err != nil {
+		writeHTTPError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// debugLevelsResponse 是 /debug/lsm/levels 的响应
+type debugLevelsResponse struct {
+	// WAL 所有 WAL 段文件，纯内存数据库为空
+	WAL []lsm.WALFileInfo `json:"wal"`
+	// Levels SSTable 各层的文件；目前数据只持久化在 WAL 中，总是为空
+	Levels []struct{} `json:"levels"`
+}
+
+func (s *DebugServer) handleLevels(w http.ResponseWriter, r *http.Request) {
+	files, err := s.db.WALFiles()
+	if err != nil {
+		writeHTTPError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, debugLevelsResponse{WAL: files, Levels: []struct{}{}})
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+)
+
+func TestDebugServer(t *testing.T) {
+	db := openTestDB(t)
+	for _, k := range []string{"a", "b", "c"} {
+		if err := db.Set(k, []byte("v")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		t.Fatalf("创建快照失败: %v", err)
+	}
+	defer snap.Release()
+
+	ts := httptest.NewServer(NewDebugServer(db).Handler())
+	defer ts.Close()
+
+	get := func(path string, v any) {
+		t.Helper()
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("请求 %s 失败: %v", path, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s 期望 200, 实际 %d", path, resp.StatusCode)
+		}
+		if v != nil {
+			if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+				t.Fatalf("解析 %s 的响应失败: %v", path, err)
+			}
+		}
+	}
+
+	var mem lsm.MemTableInfo
+	get("/debug/lsm/memtable", &mem)
+	if len(mem.Families) != 1 || mem.Families[0].Entries != 3 || mem.Families[0].Bytes == 0 {
+		t.Fatalf("MemTable 信息不正确: %+v", mem)
+	}
+	if mem.VisibleSequence != 3 || mem.Snapshots != 1 || mem.OldestSnapshot != 3 {
+		t.Fatalf("序列号或快照信息不正确: %+v", mem)
+	}
+
+	var levels debugLevelsResponse
+	get("/debug/lsm/levels", &levels)
+	if len(levels.WAL) != 1 || !levels.WAL[0].Active || levels.WAL[0].Size == 0 || levels.Levels == nil {
+		t.Fatalf("文件布局不正确: %+v", levels)
+	}
+
+	get("/debug/pprof/", nil)
+	get("/debug/pprof/goroutine?debug=1", nil)
+}
@@ -0,0 +1,535 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/internal/expr"
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+	"github.com/aireet/SimpleDBForge/internal/replication"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+)
+
+const (
+	// maxHTTPValueLen PUT 请求体（即 value）的最大长度
+	maxHTTPValueLen = 64 << 20
+	// headerVersion 响应头，给出 key 的版本（GET）或条件写入分配的新版本（带 version 的 PUT/DELETE）
+	headerVersion = "Sdbf-Version"
+)
+
+// HTTPServer 提供轻量的 HTTP/JSON 接口，方便脚本和调试：
+//
+//	GET    /kv/{key}                       返回原始 value，不存在时 404，响应头 Sdbf-Version 为 key 的版本
+//	PUT    /kv/{key}?ttl=10s               请求体作为 value 写入，ttl 可选（time.ParseDuration 格式）
+//	PUT    /kv/{key}?version=N             只在 key 的版本为 N 时写入（0 表示 key 不存在），否则 409，见 lsm.DB.CAS
+//	DELETE /kv/{key}?version=N             删除 key，version 可选，语义同上
+//	POST   /incr/{key}?delta=1             把 value 作为十进制整数加上 delta（默认 1），返回 {"value": 新值}，见 lsm.DB.Increment
+//	GET    /scan?start=&end=&limit=        返回 [start, end] 区间内的条目（JSON），end 为空表示不设上界；
+//	       &key_contains=&value_prefix=&value_contains=&where=  可选的过滤条件，同时给出时都要满足，在服务端遍历时过滤；
+//	       where 为过滤表达式（见 expr 包），例如 where=has_prefix(key,"user/") && int(value) >= 18
+//	POST   /batch                          原子地提交一组写入与删除（JSON，见 httpBatchRequest）
+//	GET    /stats                          返回 lsm.Stats（JSON）
+//	GET    /property/{name}                返回 lsm.DB.GetProperty 的值（纯文本），属性不存在时 404
+//	GET    /watch?prefix=&cf=&from=        持续推送 prefix 开头的 key 在序列号 from 之后的修改（每行一个 httpWatchEvent）
+//	GET    /health                         健康时返回 200，否则 503 与原因（JSON），见 lsm.DB.Health
+//	GET    /replication/...                WAL 复制接口，见 replication.Leader
+//
+// key 可以包含 '/'，例如 /kv/user/1 对应的 key 为 "user/1"。
+// 启用认证（见 SetAuth）后读取接口需要 RoleReadOnly，写入接口需要 RoleReadWrite；
+// /health 不需要认证，便于编排系统探测
+type HTTPServer struct {
+	db      *lsm.DB
+	srv     *http.Server
+	auth    *AuthConfig
+	limiter *rateLimiter
+}
+
+// NewHTTPServer 创建一个基于 db 的 HTTP 服务，db 的生命周期由调用方管理
+func NewHTTPServer(db *lsm.DB) *HTTPServer {
+	s := &HTTPServer{db: db}
+	s.srv = &http.Server{Handler: s.Handler()}
+	return s
+}
+
+// SetAuth 设置 TLS 与认证，必须在 Serve 之前调用；cfg 为 nil 表示不加密、不认证
+func (s *HTTPServer) SetAuth(cfg *AuthConfig) {
+	s.auth = cfg
+	s.srv.Handler = s.Handler()
+}
+
+// SetRateLimit 设置每个客户端的速率与带宽限制，必须在 Serve 之前调用；cfg 为 nil 表示不限制
+func (s *HTTPServer) SetRateLimit(cfg *RateLimitConfig) {
+	s.limiter = newRateLimiter(cfg)
+	s.srv.Handler = s.Handler()
+}
+
+// Handler 返回路由，便于挂载到已有的 http.Server 或在测试中直接使用
+func (s *HTTPServer) Handler() http.Handler {
+	read := func(h http.HandlerFunc) http.HandlerFunc { return s.auth.requireRole(RoleReadOnly, h) }
+	write := func(h http.HandlerFunc) http.HandlerFunc { return s.auth.requireRole(RoleReadWrite, h) }
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /kv/{key...}", read(s.handleGet))
+	mux.HandleFunc("PUT /kv/{key...}", write(s.handlePut))
+	mux.HandleFunc("DELETE /kv/{key...}", write(s.handleDelete))
+	mux.HandleFunc("POST /incr/{key...}", write(s.handleIncr))
+	mux.HandleFunc("GET /scan", read(s.handleScan))
+	mux.HandleFunc("POST /batch", write(s.handleBatch))
+	mux.HandleFunc("GET /stats", read(s.handleStats))
+	mux.HandleFunc("GET /property/{name}", read(s.handleProperty))
+	mux.HandleFunc("GET /watch", read(s.handleWatch))
+	mux.HandleFunc("GET /health", s.handleHealth)
+	mux.HandleFunc("GET /replication/", read(replication.NewLeader(s.db).Handler().ServeHTTP))
+	return s.rateLimit(mux)
+}
+
+// ListenAndServe 监听 addr 并处理请求，直到 Close 被调用
+func (s *HTTPServer) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen http %s: %w", addr, err)
+	}
+	return s.Serve(ln)
+}
+
+// Serve 在 ln 上处理请求，配置了 TLS 时在 ln 之上进行 TLS 握手，Close 之后返回 ErrServerClosed
+func (s *HTTPServer) Serve(ln net.Listener) error {
+	if s.auth != nil && s.auth.TLS != nil {
+		ln = tls.NewListener(ln, s.auth.TLS)
+	}
+	slog.Info("http server listening", "addr", ln.Addr().String())
+	err := s.srv.Serve(ln)
+	if errors.Is(err, http.ErrServerClosed) {
+		return ErrServerClosed
+	}
+	return fmt.Errorf("serve http: %w", err)
+}
+
+// Close 立即关闭监听和所有连接
+func (s *HTTPServer) Close() error {
+	if err := s.srv.Close(); err != nil {
+		return fmt.Errorf("close http server: %w", err)
+	}
+	return nil
+}
+
+func (s *HTTPServer) handleGet(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	value, version, err := s.db.GetWithVersion(key)
+	if err != nil {
+		writeHTTPError(w, r, err)
+		return
+	}
+	w.Header().Set(headerVersion, strconv.FormatInt(version, 10))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+	w.Write(value)
+}
+
+func (s *HTTPServer) handlePut(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	v := r.URL.Query().Get("ttl")
+	version, conditional, ok := parseVersion(w, r)
+	if !ok {
+		return
+	}
+	if conditional && v != "" {
+		writeJSON(w, http.StatusBadRequest, httpError{Error: "ttl and version cannot be combined"})
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, maxHTTPValueLen)
+	if v == "" && !conditional && r.ContentLength >= 0 {
+		// 长度已知时由 SetReader 直接读入 value 的最终缓冲区，省去 io.ReadAll 的扩容复制
+		if r.ContentLength > maxHTTPValueLen {
+			writeJSON(w, http.StatusRequestEntityTooLarge, httpError{Error: fmt.Sprintf("body too large: %d bytes", r.ContentLength)})
+			return
+		}
+		if err := s.db.SetReader(key, body, r.ContentLength); err != nil {
+			writeHTTPError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	value, err := io.ReadAll(body)
+	if err != nil {
+		writeJSON(w, http.StatusRequestEntityTooLarge, httpError{Error: fmt.Sprintf("read body: %v", err)})
+		return
+	}
+
+	if conditional {
+		s.writeVersion(w, r, func() (int64, error) { return s.db.CAS(key, version, value) })
+		return
+	}
+	if v != "" {
+		ttl, perr := time.ParseDuration(v)
+		if perr != nil || ttl <= 0 {
+			writeJSON(w, http.StatusBadRequest, httpError{Error: fmt.Sprintf("invalid ttl %q", v)})
+			return
+		}
+		err = s.db.SetWithTTL(key, value, ttl)
+	} else {
+		err = s.db.Set(key, value)
+	}
+	if err != nil {
+		writeHTTPError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *HTTPServer) handleDelete(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	version, conditional, ok := parseVersion(w, r)
+	if !ok {
+		return
+	}
+	if conditional {
+		s.writeVersion(w, r, func() (int64, error) { return s.db.CompareAndDelete(key, version) })
+		return
+	}
+	if err := s.db.Delete(key); err != nil {
+		writeHTTPError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// httpIncrResponse 是 /incr 的响应
+type httpIncrResponse struct {
+	Value int64 `json:"value"`
+}
+
+func (s *HTTPServer) handleIncr(w http.ResponseWriter, r *http.Request) {
+	delta := int64(1)
+	if v := r.URL.Query().Get("delta"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, httpError{Error: fmt.Sprintf("invalid delta %q", v)})
+			return
+		}
+		delta = n
+	}
+	n, err := s.db.Increment(r.PathValue("key"), delta)
+	if err != nil {
+		writeHTTPError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, httpIncrResponse{Value: n})
+}
+
+// parseVersion 解析条件写入的 version 参数，没有该参数时 conditional 为 false；参数非法时写入 400 并返回 ok 为 false
+func parseVersion(w http.ResponseWriter, r *http.Request) (version int64, conditional, ok bool) {
+	v := r.URL.Query().Get("version")
+	if v == "" {
+		return 0, false, true
+	}
+	version, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || version < 0 {
+		writeJSON(w, http.StatusBadRequest, httpError{Error: fmt.Sprintf("invalid version %q", v)})
+		return 0, false, false
+	}
+	return version, true, true
+}
+
+// writeVersion 执行一次条件写入，成功时在响应头中返回新版本
+func (s *HTTPServer) writeVersion(w http.ResponseWriter, r *http.Request, write func() (int64, error)) {
+	version, err := write()
+	if err != nil {
+		writeHTTPError(w, r, err)
+		return
+	}
+	w.Header().Set(headerVersion, strconv.FormatInt(version, 10))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// httpEntry 是 /scan 与 /watch 返回的单个条目，Value 按 JSON 惯例以 base64 编码；
+// Tombstone 与 RangeEnd 只出现在 /watch 中，RangeEnd 非空表示删除了 [key, range_end)
+type httpEntry struct {
+	Key       string `json:"key"`
+	Value     []byte `json:"value"`
+	Version   int64  `json:"version"`
+	Tombstone bool   `json:"tombstone,omitempty"`
+	RangeEnd  string `json:"range_end,omitempty"`
+}
+
+// httpWatchEvent 是 /watch 推送的一次提交，见 lsm.Change；订阅异常结束时最后一行只有 Error
+type httpWatchEvent struct {
+	Seq     int64       `json:"seq,omitempty"`
+	Entries []httpEntry `json:"entries,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+type httpScanResponse struct {
+	Entries []httpEntry `json:"entries"`
+	// Next 因 limit 截断时为下一条的 key，作为下一页请求的 start
+	Next string `json:"next,omitempty"`
+}
+
+// httpBatchRequest 是 /batch 的请求体，Ops 按顺序放入同一个 lsm.WriteBatch
+type httpBatchRequest struct {
+	Ops []httpBatchOp `json:"ops"`
+}
+
+// httpBatchOp 是批次中的一个操作：
+//
+//	{"op": "set", "key": "k", "value": "<base64>", "ttl": "10s"}   ttl 可选
+//	{"op": "delete", "key": "k"}
+//	{"op": "delete_range", "key": "a", "end": "b"}                删除 [key, end)
+type httpBatchOp struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value []byte `json:"value,omitempty"`
+	TTL   string `json:"ttl,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+type httpError struct {
+	Error string `json:"error"`
+}
+
+func (s *HTTPServer) handleScan(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	start, end := q.Get("start"), q.Get("end")
+	limit := -1
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, httpError{Error: fmt.Sprintf("invalid limit %q", v)})
+			return
+		}
+		limit = n
+	}
+	filter, err := scanFilter(q)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, httpError{Error: err.Error()})
+		return
+	}
+
+	// 快照迭代器直接遍历 MemTable，不复制整个数据库
+	snap, err := s.db.GetSnapshot()
+	if err != nil {
+		writeHTTPError(w, r, err)
+		return
+	}
+	defer snap.Release()
+	it, err := snap.NewIterator()
+	if err != nil {
+		writeHTTPError(w, r, err)
+		return
+	}
+
+	resp := httpScanResponse{Entries: []httpEntry{}}
+	for it.Seek(start); it.Valid(); it.Next() {
+		if end != "" && utils.CompareKey(it.Key(), end) > 0 {
+			break
+		}
+		if filter != nil && !filter(it.Key(), it.Value()) {
+			continue
+		}
+		if limit == 0 {
+			resp.Next = it.Key()
+			break
+		}
+		e := it.Entry()
+		resp.Entries = append(resp.Entries, httpEntry{Key: e.Key, Value: e.Value, Version: e.Version})
+		limit--
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// scanFilter 根据 /scan 的过滤参数生成过滤函数，含义同 lsm.ReadOptions.Filter，没有过滤参数时返回 nil；
+// where 表达式不合法时返回错误
+func scanFilter(q url.Values) (func(key string, value []byte) bool, error) {
+	var where *expr.Program
+	if src := q.Get("where"); src != "" {
+		p, err := expr.Compile(src)
+		if err != nil {
+			return nil, err
+		}
+		where = p
+	}
+	keyContains, valuePrefix, valueContains := q.Get("key_contains"), q.Get("value_prefix"), q.Get("value_contains")
+	if keyContains == "" && valuePrefix == "" && valueContains == "" {
+		if where == nil {
+			return nil, nil
+		}
+		return where.Match, nil
+	}
+	prefix, sub := []byte(valuePrefix), []byte(valueContains)
+	return func(key string, value []byte) bool {
+		return strings.Contains(key, keyContains) && bytes.HasPrefix(value, prefix) && bytes.Contains(value, sub) &&
+			(where == nil || where.Match(key, value))
+	}, nil
+}
+
+func (s *HTTPServer) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var req httpBatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHTTPValueLen)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, httpError{Error: fmt.Sprintf("decode batch: %v", err)})
+		return
+	}
+
+	b := lsm.NewWriteBatch()
+	for i, op := range req.Ops {
+		switch op.Op {
+		case "set":
+			if op.TTL == "" {
+				b.Set(op.Key, op.Value)
+				continue
+			}
+			ttl, err := time.ParseDuration(op.TTL)
+			if err == nil {
+				err = b.SetWithTTL(op.Key, op.Value, ttl)
+			}
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, httpError{Error: fmt.Sprintf("op %d: invalid ttl %q", i, op.TTL)})
+				return
+			}
+		case "delete":
+			b.Delete(op.Key)
+		case "delete_range":
+			b.DeleteRange(op.Key, op.End)
+		default:
+			writeJSON(w, http.StatusBadRequest, httpError{Error: fmt.Sprintf("op %d: unknown op %q", i, op.Op)})
+			return
+		}
+	}
+	if err := s.db.Write(b); err != nil {
+		writeHTTPError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *HTTPServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.db.Stats()
+	if err != nil {
+		writeHTTPError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (s *HTTPServer) handleProperty(w http.ResponseWriter, r *http.Request) {
+	value, err := s.db.GetProperty(r.PathValue("name"))
+	if err != nil {
+		writeHTTPError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, value)
+}
+
+func (s *HTTPServer) handleWatch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var from int64
+	if v := q.Get("from"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, httpError{Error: fmt.Sprintf("invalid from %q", v)})
+			return
+		}
+		from = n
+	}
+
+	var sub *lsm.Subscription
+	var err error
+	if name := q.Get("cf"); name != "" {
+		var cf *lsm.ColumnFamily
+		// 只读请求不能创建列族：CF 会在 WAL 中持久地记录新列族
+		if cf, err = s.db.LookupCF(name); err == nil {
+			sub, err = cf.Watch(r.Context(), q.Get("prefix"), from)
+		}
+	} else {
+		sub, err = s.db.Watch(r.Context(), q.Get("prefix"), from)
+	}
+	if err != nil {
+		writeHTTPError(w, r, err)
+		return
+	}
+	defer sub.Close()
+
+	// 先发出响应头，客户端据此确认订阅已经建立
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	enc := json.NewEncoder(w)
+	for c := range sub.Changes() {
+		event := httpWatchEvent{Seq: c.Seq, Entries: make([]httpEntry, len(c.Entries))}
+		for i, e := range c.Entries {
+			event.Entries[i] = httpEntry{Key: e.Key, Value: e.Value, Version: e.Version, Tombstone: e.Tombstone, RangeEnd: e.RangeEnd}
+		}
+		if err := enc.Encode(event); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+	if err := sub.Err(); r.Context().Err() == nil && err != nil {
+		enc.Encode(httpWatchEvent{Error: err.Error()})
+	}
+}
+
+// httpHealthResponse 是 /health 的响应
+type httpHealthResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (s *HTTPServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if err := s.db.Health(); err != nil {
+		writeJSON(w, http.StatusServiceUnavailable, httpHealthResponse{Status: "unhealthy", Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, httpHealthResponse{Status: "ok"})
+}
+
+// writeHTTPError 把引擎错误映射为 HTTP 状态码
+func writeHTTPError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, lsm.ErrNotFound), errors.Is(err, lsm.ErrUnknownProperty), errors.Is(err, lsm.ErrColumnFamilyNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, lsm.ErrClosed):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, lsm.ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, lsm.ErrInvalidColumnFamily), errors.Is(err, lsm.ErrNotInteger):
+		status = http.StatusBadRequest
+	case errors.Is(err, lsm.ErrInMemory):
+		status = http.StatusNotImplemented
+	case errors.Is(err, lsm.ErrKeyTooLarge), errors.Is(err, lsm.ErrValueTooLarge), errors.Is(err, lsm.ErrBatchTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		// 请求体比 Content-Length 短
+		status = http.StatusBadRequest
+	default:
+		slog.Error("http request failed", "method", r.Method, "path", r.URL.Path, "err", err)
+	}
+	writeJSON(w, status, httpError{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Debug("write http response", "err", err)
+	}
+}
@@ -0,0 +1,315 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestHTTPServer_KV(t *testing.T) {
+	ts := httptest.NewServer(NewHTTPServer(openTestDB(t)).Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "GET 不存在", method: http.MethodGet, path: "/kv/a", wantStatus: http.StatusNotFound},
+		{name: "PUT", method: http.MethodPut, path: "/kv/a", body: "1", wantStatus: http.StatusNoContent},
+		{name: "GET", method: http.MethodGet, path: "/kv/a", wantStatus: http.StatusOK, wantBody: "1"},
+		{name: "key 包含斜杠", method: http.MethodPut, path: "/kv/user/1", body: "alice", wantStatus: http.StatusNoContent},
+		{name: "GET 包含斜杠", method: http.MethodGet, path: "/kv/user/1", wantStatus: http.StatusOK, wantBody: "alice"},
+		{name: "DELETE", method: http.MethodDelete, path: "/kv/a", wantStatus: http.StatusNoContent},
+		{name: "DELETE 之后 GET", method: http.MethodGet, path: "/kv/a", wantStatus: http.StatusNotFound},
+		{name: "PUT 带 ttl", method: http.MethodPut, path: "/kv/t?ttl=1h", body: "v", wantStatus: http.StatusNoContent},
+		{name: "GET 带 ttl", method: http.MethodGet, path: "/kv/t", wantStatus: http.StatusOK, wantBody: "v"},
+		{name: "非法 ttl", method: http.MethodPut, path: "/kv/t?ttl=abc", wantStatus: http.StatusBadRequest},
+		{name: "不支持的方法", method: http.MethodPost, path: "/kv/a", wantStatus: http.StatusMethodNotAllowed},
+		{name: "stats", method: http.MethodGet, path: "/stats", wantStatus: http.StatusOK},
+		{name: "属性", method: http.MethodGet, path: "/property/sdbf.num-snapshots", wantStatus: http.StatusOK, wantBody: "0"},
+		{name: "不存在的属性", method: http.MethodGet, path: "/property/nope", wantStatus: http.StatusNotFound},
+		{name: "health", method: http.MethodGet, path: "/health", wantStatus: http.StatusOK, wantBody: "{\"status\":\"ok\"}\n"},
+		{name: "非法 limit", method: http.MethodGet, path: "/scan?limit=-1", wantStatus: http.StatusBadRequest},
+		{name: "非法表达式", method: http.MethodGet, path: "/scan?where=key", wantStatus: http.StatusBadRequest},
+		{name: "自增", method: http.MethodPost, path: "/incr/n", wantStatus: http.StatusOK, wantBody: "{\"value\":1}\n"},
+		{name: "自增 delta", method: http.MethodPost, path: "/incr/n?delta=-3", wantStatus: http.StatusOK, wantBody: "{\"value\":-2}\n"},
+		{name: "自增非整数", method: http.MethodPost, path: "/incr/user/1", wantStatus: http.StatusBadRequest},
+		{name: "非法 delta", method: http.MethodPost, path: "/incr/n?delta=x", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("构造请求失败: %v", err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("期望状态码 %d, 实际 %d", tt.wantStatus, resp.StatusCode)
+			}
+			if tt.wantBody != "" {
+				body, _ := io.ReadAll(resp.Body)
+				if string(body) != tt.wantBody {
+					t.Fatalf("期望响应 %q, 实际 %q", tt.wantBody, body)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPServer_Scan(t *testing.T) {
+	db := openTestDB(t)
+	for _, k := range []string{"a", "b", "c", "d"} {
+		if err := db.Set(k, []byte("v"+k)); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	ts := httptest.NewServer(NewHTTPServer(db).Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name     string
+		query    string
+		want     []string
+		wantNext string
+	}{
+		{name: "全部", query: "", want: []string{"a", "b", "c", "d"}},
+		{name: "区间", query: "?start=b&end=c", want: []string{"b", "c"}},
+		{name: "只有下界", query: "?start=c", want: []string{"c", "d"}},
+		{name: "limit", query: "?start=a&limit=3", want: []string{"a", "b", "c"}, wantNext: "d"},
+		{name: "limit 恰好读完", query: "?start=c&limit=2", want: []string{"c", "d"}},
+		{name: "空区间", query: "?start=x", want: []string{}},
+		{name: "过滤 value", query: "?value_contains=c", want: []string{"c"}},
+		{name: "过滤与 limit", query: "?value_prefix=v&key_contains=&limit=1&start=b", want: []string{"b"}, wantNext: "c"},
+		{name: "过滤后的 next", query: "?key_contains=d&limit=0", want: []string{}, wantNext: "d"},
+		{name: "全部被过滤", query: "?value_prefix=x", want: []string{}},
+		{name: "表达式", query: "?where=" + url.QueryEscape(`key >= "b" && value != "vc"`), want: []string{"b", "d"}},
+		{name: "表达式与其他条件", query: "?where=" + url.QueryEscape(`key < "d"`) + "&value_contains=c", want: []string{"c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Get(ts.URL + "/scan" + tt.query)
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			defer resp.Body.Close()
+
+			var got httpScanResponse
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("解析响应失败: %v", err)
+			}
+			if len(got.Entries) != len(tt.want) || got.Next != tt.wantNext {
+				t.Fatalf("期望 %d 条、next=%q, 实际 %d 条、next=%q", len(tt.want), tt.wantNext, len(got.Entries), got.Next)
+			}
+			for i, e := range got.Entries {
+				if e.Key != tt.want[i] || string(e.Value) != "v"+tt.want[i] {
+					t.Errorf("第 %d 条期望 %s=v%s, 实际 %s=%s", i, tt.want[i], tt.want[i], e.Key, e.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPServer_CAS(t *testing.T) {
+	ts := httptest.NewServer(NewHTTPServer(openTestDB(t)).Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		wantStatus  int
+		wantVersion string
+	}{
+		{name: "不存在时创建", method: http.MethodPut, path: "/kv/lock?version=0", wantStatus: http.StatusNoContent, wantVersion: "1"},
+		{name: "已存在时创建", method: http.MethodPut, path: "/kv/lock?version=0", wantStatus: http.StatusConflict},
+		{name: "GET 返回版本", method: http.MethodGet, path: "/kv/lock", wantStatus: http.StatusOK, wantVersion: "1"},
+		{name: "版本匹配", method: http.MethodPut, path: "/kv/lock?version=1", wantStatus: http.StatusNoContent, wantVersion: "2"},
+		{name: "删除版本不匹配", method: http.MethodDelete, path: "/kv/lock?version=1", wantStatus: http.StatusConflict},
+		{name: "删除", method: http.MethodDelete, path: "/kv/lock?version=2", wantStatus: http.StatusNoContent, wantVersion: "3"},
+		{name: "非法版本", method: http.MethodPut, path: "/kv/lock?version=x", wantStatus: http.StatusBadRequest},
+		{name: "版本与 ttl 同时使用", method: http.MethodPut, path: "/kv/lock?version=0&ttl=1s", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader("v"))
+			if err != nil {
+				t.Fatalf("构造请求失败: %v", err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus || resp.Header.Get(headerVersion) != tt.wantVersion {
+				t.Fatalf("期望 %d 与版本 %q, 实际 %d 与版本 %q", tt.wantStatus, tt.wantVersion, resp.StatusCode, resp.Header.Get(headerVersion))
+			}
+		})
+	}
+}
+
+func TestHTTPServer_Batch(t *testing.T) {
+	db := openTestDB(t)
+	ts := httptest.NewServer(NewHTTPServer(db).Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		want       map[string]string
+	}{
+		{
+			name:       "写入与删除",
+			body:       `{"ops":[{"op":"set","key":"a","value":"MQ=="},{"op":"set","key":"b","value":"Mg==","ttl":"1h"},{"op":"delete","key":"a"}]}`,
+			wantStatus: http.StatusNoContent,
+			want:       map[string]string{"a": "", "b": "2"},
+		},
+		{
+			name:       "范围删除",
+			body:       `{"ops":[{"op":"set","key":"c","value":"Mw=="},{"op":"delete_range","key":"b","end":"c"}]}`,
+			wantStatus: http.StatusNoContent,
+			want:       map[string]string{"b": "", "c": "3"},
+		},
+		{name: "未知操作不提交任何修改", body: `{"ops":[{"op":"set","key":"d","value":"NA=="},{"op":"put","key":"d"}]}`, wantStatus: http.StatusBadRequest, want: map[string]string{"d": ""}},
+		{name: "非法 ttl", body: `{"ops":[{"op":"set","key":"d","ttl":"abc"}]}`, wantStatus: http.StatusBadRequest},
+		{name: "非法 JSON", body: `{"ops":`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.Post(ts.URL+"/batch", "application/json", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("期望状态码 %d, 实际 %d", tt.wantStatus, resp.StatusCode)
+			}
+			for k, want := range tt.want {
+				got, err := db.Get(k)
+				if want == "" && err == nil || want != "" && string(got) != want {
+					t.Fatalf("key %s 期望 %q, 实际 %q %v", k, want, got, err)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPServer_Watch(t *testing.T) {
+	db := openTestDB(t)
+	ts := httptest.NewServer(NewHTTPServer(db).Handler())
+	defer ts.Close()
+
+	for _, path := range []string{"/watch?from=-1", "/watch?cf=" + strings.Repeat("x", 300)} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s 期望状态码 400, 实际 %d", path, resp.StatusCode)
+		}
+	}
+
+	if err := db.Set("user/1", []byte("alice")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	resp, err := http.Get(ts.URL + "/watch?prefix=user/")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("期望状态码 200, 实际 %d", resp.StatusCode)
+	}
+	if err := db.Set("order/1", nil); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := db.Delete("user/1"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	want := []httpWatchEvent{
+		{Seq: 1, Entries: []httpEntry{{Key: "user/1", Value: []byte("alice"), Version: 1}}},
+		{Seq: 3, Entries: []httpEntry{{Key: "user/1", Version: 3, Tombstone: true}}},
+	}
+	for i, w := range want {
+		var got httpWatchEvent
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("读取第 %d 个事件失败: %v", i, err)
+		}
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(w)
+		if string(gotJSON) != string(wantJSON) {
+			t.Fatalf("第 %d 个事件期望 %s, 实际 %s", i, wantJSON, gotJSON)
+		}
+	}
+
+	// 数据库关闭时以一行错误结束
+	db.Close()
+	var last httpWatchEvent
+	if err := dec.Decode(&last); err != nil || !strings.Contains(last.Error, "closed") {
+		t.Fatalf("期望以错误结束, 实际 %+v, err=%v", last, err)
+	}
+}
+
+// 测试 /watch 只订阅已存在的列族：只读 token 不能借此创建列族，不存在时返回 404
+func TestHTTPServer_WatchColumnFamily(t *testing.T) {
+	db := openTestDB(t)
+	if _, err := db.CF("meta"); err != nil {
+		t.Fatalf("创建列族失败: %v", err)
+	}
+	s := NewHTTPServer(db)
+	s.SetAuth(&AuthConfig{Tokens: map[string]Role{"reader": RoleReadOnly}})
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		cf         string
+		wantStatus int
+	}{
+		{cf: "not-exist", wantStatus: http.StatusNotFound},
+		{cf: "meta", wantStatus: http.StatusOK},
+		{cf: "default", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cf, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/watch?cf="+tt.cf, nil)
+			if err != nil {
+				t.Fatalf("构造请求失败: %v", err)
+			}
+			req.Header.Set("Authorization", "Bearer reader")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("期望状态码 %d, 实际 %d", tt.wantStatus, resp.StatusCode)
+			}
+		})
+	}
+
+	names, err := db.ColumnFamilies()
+	if err != nil {
+		t.Fatalf("列出列族失败: %v", err)
+	}
+	if strings.Join(names, ",") != "default,meta" {
+		t.Fatalf("只读请求不应创建列族, 实际 %v", names)
+	}
+}
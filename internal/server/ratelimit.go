@@ -0,0 +1,245 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig 每个客户端的请求速率与带宽限制，零值字段表示不限制对应的维度
+//
+// 客户端按认证使用的 token、客户端证书的 CommonName 或来源 IP 区分（依次优先）。
+// 超出限制的请求被拒绝：HTTP 返回 429 并带上 Retry-After，RESP 返回 -ERR rate limit exceeded
+type RateLimitConfig struct {
+	// QPS 每秒允许的请求数，Burst 为允许的突发请求数（默认为 QPS 向上取整）
+	QPS   float64
+	Burst int
+	// BytesPerSec 每秒允许的请求体与响应体的字节数，BurstBytes 为允许的突发字节数（默认等于 BytesPerSec）
+	//
+	// 响应的大小在处理之前未知，因此按先处理后扣除计算：超出的部分在之后的请求上等待补足
+	BytesPerSec int64
+	BurstBytes  int64
+}
+
+// clientIdleTimeout 客户端超过该时间没有请求后丢弃其限流状态，此时它的令牌桶已经补满
+const clientIdleTimeout = 10 * time.Minute
+
+// tokenBucket 令牌桶，tokens 可以为负数表示透支
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill 按 rate 补充令牌，最多到 burst
+func (b *tokenBucket) refill(now time.Time, rate, burst float64) {
+	if !b.last.IsZero() {
+		b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	}
+	b.last = now
+}
+
+// wait 返回令牌数补充到 need 还需要的时间
+func (b *tokenBucket) wait(need, rate float64) time.Duration {
+	return time.Duration((need - b.tokens) / rate * float64(time.Second))
+}
+
+type clientLimit struct {
+	requests tokenBucket
+	bytes    tokenBucket
+	// used 最近一次请求的时间
+	used time.Time
+}
+
+// rateLimiter 按客户端限流，nil 表示不限制，所有方法都可以在 nil 上调用
+type rateLimiter struct {
+	qps, burst           float64
+	bytesRate, burstByte float64
+	now                  func() time.Time
+
+	mu        sync.Mutex
+	clients   map[string]*clientLimit
+	lastSweep time.Time
+}
+
+// newRateLimiter cfg 为 nil 或没有任何限制时返回 nil
+func newRateLimiter(cfg *RateLimitConfig) *rateLimiter {
+	if cfg == nil || (cfg.QPS <= 0 && cfg.BytesPerSec <= 0) {
+		return nil
+	}
+	l := &rateLimiter{now: time.Now, clients: make(map[string]*clientLimit)}
+	if cfg.QPS > 0 {
+		l.qps = cfg.QPS
+		l.burst = float64(cfg.Burst)
+		if cfg.Burst <= 0 {
+			l.burst = math.Ceil(cfg.QPS)
+		}
+	}
+	if cfg.BytesPerSec > 0 {
+		l.bytesRate = float64(cfg.BytesPerSec)
+		l.burstByte = float64(cfg.BurstBytes)
+		if cfg.BurstBytes <= 0 {
+			l.burstByte = l.bytesRate
+		}
+	}
+	return l
+}
+
+// allow 判断 client 的一个请求体为 n 字节的请求能否执行，可以执行时扣除相应的令牌，
+// 否则返回需要等待的时间
+func (l *rateLimiter) allow(client string, n int64) (ok bool, retryAfter time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	c := l.clientLocked(client, now)
+	if l.qps > 0 {
+		c.requests.refill(now, l.qps, l.burst)
+		if c.requests.tokens < 1 {
+			retryAfter = c.requests.wait(1, l.qps)
+		}
+	}
+	if l.bytesRate > 0 {
+		c.bytes.refill(now, l.bytesRate, l.burstByte)
+		// 只要没有透支就放行，单个请求可以大于 BurstBytes
+		if c.bytes.tokens < 0 {
+			retryAfter = max(retryAfter, c.bytes.wait(0, l.bytesRate))
+		}
+	}
+	if retryAfter > 0 {
+		return false, retryAfter
+	}
+	c.requests.tokens--
+	c.bytes.tokens -= float64(n)
+	return true, 0
+}
+
+// charge 在请求处理之后扣除响应的 n 字节
+func (l *rateLimiter) charge(client string, n int64) {
+	if l == nil || l.bytesRate <= 0 || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	c := l.clientLocked(client, now)
+	c.bytes.refill(now, l.bytesRate, l.burstByte)
+	c.bytes.tokens -= float64(n)
+}
+
+// clientLocked 返回 client 的限流状态，新客户端的令牌桶是满的；顺便丢弃长时间空闲的客户端
+func (l *rateLimiter) clientLocked(client string, now time.Time) *clientLimit {
+	if now.Sub(l.lastSweep) > clientIdleTimeout {
+		for id, c := range l.clients {
+			if now.Sub(c.used) > clientIdleTimeout {
+				delete(l.clients, id)
+			}
+		}
+		l.lastSweep = now
+	}
+	c, ok := l.clients[client]
+	if !ok {
+		c = &clientLimit{
+			requests: tokenBucket{tokens: l.burst, last: now},
+			bytes:    tokenBucket{tokens: l.burstByte, last: now},
+		}
+		l.clients[client] = c
+	}
+	c.used = now
+	return c
+}
+
+// clientID 返回限流使用的客户端标识：有效的 token、已验证的客户端证书或来源 IP
+//
+// 无效的 token 不作为标识，避免随意构造的 token 让限流状态无限增长
+func clientID(auth *AuthConfig, token string, r *http.Request) string {
+	if auth.enabled() {
+		if token != "" && auth.tokenRole(token) != RoleNone {
+			return "token:" + token
+		}
+		if r.TLS != nil && auth.certRole(r.TLS) != RoleNone {
+			return "cert:" + r.TLS.VerifiedChains[0][0].Subject.CommonName
+		}
+	}
+	return "ip:" + remoteIP(r.RemoteAddr)
+}
+
+// remoteIP 去掉地址中的端口
+func remoteIP(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// countingWriter 统计写入的字节数
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// countingReadCloser 统计读取的字节数
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// countingResponseWriter 统计写入的响应体字节数
+type countingResponseWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Unwrap 让 http.ResponseController 可以访问底层的 ResponseWriter
+func (w *countingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// rateLimit 包装 h：超出限制的请求返回 429；Content-Length 在处理之前扣除，
+// 处理完成后再扣除响应体以及超出 Content-Length（例如分块传输）的请求体
+func (s *HTTPServer) rateLimit(h http.Handler) http.Handler {
+	if s.limiter == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := clientID(s.auth, bearerToken(r), r)
+		declared := max(r.ContentLength, 0)
+		ok, retryAfter := s.limiter.allow(client, declared)
+		if !ok {
+			secs := int64(math.Ceil(retryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.FormatInt(max(secs, 1), 10))
+			writeJSON(w, http.StatusTooManyRequests, httpError{Error: fmt.Sprintf("rate limit exceeded, retry after %s", retryAfter.Round(time.Millisecond))})
+			return
+		}
+		body := &countingReadCloser{ReadCloser: r.Body}
+		r.Body = body
+		cw := &countingResponseWriter{ResponseWriter: w}
+		h.ServeHTTP(cw, r)
+		s.limiter.charge(client, cw.n+max(body.n-declared, 0))
+	})
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestLimiter 返回使用可控时钟的限流器
+func newTestLimiter(cfg RateLimitConfig) (*rateLimiter, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	l := newRateLimiter(&cfg)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestRateLimiter_Requests(t *testing.T) {
+	l, now := newTestLimiter(RateLimitConfig{QPS: 2, Burst: 3})
+
+	// 突发 3 个请求之后被拒绝，每 500ms 补充一个令牌
+	for i := range 3 {
+		if ok, _ := l.allow("a", 0); !ok {
+			t.Fatalf("第 %d 个请求期望放行", i+1)
+		}
+	}
+	ok, retryAfter := l.allow("a", 0)
+	if ok || retryAfter != 500*time.Millisecond {
+		t.Fatalf("期望拒绝并等待 500ms, 实际 %v %v", ok, retryAfter)
+	}
+	// 不同客户端互不影响
+	if ok, _ := l.allow("b", 0); !ok {
+		t.Fatalf("其他客户端期望放行")
+	}
+
+	*now = now.Add(500 * time.Millisecond)
+	if ok, _ := l.allow("a", 0); !ok {
+		t.Fatalf("补充令牌后期望放行")
+	}
+	if ok, _ := l.allow("a", 0); ok {
+		t.Fatalf("令牌用尽后期望拒绝")
+	}
+
+	// 空闲客户端的状态被丢弃
+	*now = now.Add(2 * clientIdleTimeout)
+	l.allow("c", 0)
+	if _, ok := l.clients["a"]; ok {
+		t.Fatalf("空闲客户端的状态期望被丢弃")
+	}
+}
+
+func TestRateLimiter_Bytes(t *testing.T) {
+	l, now := newTestLimiter(RateLimitConfig{BytesPerSec: 100})
+
+	tests := []struct {
+		name      string
+		advance   time.Duration
+		request   int64
+		response  int64
+		wantOK    bool
+		wantRetry time.Duration
+	}{
+		// 没有透支时单个请求可以超过突发字节数
+		{name: "大请求", request: 150, wantOK: true},
+		{name: "透支后拒绝", wantOK: false, wantRetry: 500 * time.Millisecond},
+		{name: "补足后放行", advance: 500 * time.Millisecond, response: 100, wantOK: true},
+		{name: "响应字节透支", wantOK: false, wantRetry: time.Second},
+		{name: "再次补足", advance: time.Second, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*now = now.Add(tt.advance)
+			ok, retryAfter := l.allow("a", tt.request)
+			if ok != tt.wantOK || retryAfter != tt.wantRetry {
+				t.Fatalf("期望 %v %v, 实际 %v %v", tt.wantOK, tt.wantRetry, ok, retryAfter)
+			}
+			if ok {
+				l.charge("a", tt.response)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_Disabled(t *testing.T) {
+	for _, cfg := range []*RateLimitConfig{nil, {}, {Burst: 10}} {
+		if l := newRateLimiter(cfg); l != nil {
+			t.Fatalf("%+v 期望不限流", cfg)
+		}
+	}
+	var l *rateLimiter
+	if ok, _ := l.allow("a", 1<<30); !ok {
+		t.Fatalf("nil 限流器期望放行")
+	}
+	l.charge("a", 1<<30)
+}
+
+// 测试 HTTP 超出限制时返回 429 与 Retry-After，客户端按 token 区分
+func TestHTTPServer_RateLimit(t *testing.T) {
+	s := NewHTTPServer(openTestDB(t))
+	s.SetAuth(&AuthConfig{Tokens: map[string]Role{"t1": RoleReadWrite, "t2": RoleReadWrite}})
+	s.SetRateLimit(&RateLimitConfig{QPS: 0.5, Burst: 2})
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	get := func(token string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/stats", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	for i := range 2 {
+		if resp := get("t1"); resp.StatusCode != http.StatusOK {
+			t.Fatalf("第 %d 个请求期望 200, 实际 %d", i+1, resp.StatusCode)
+		}
+	}
+	resp := get("t1")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("期望 429, 实际 %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Retry-After"); got != "2" {
+		t.Fatalf("期望 Retry-After 2, 实际 %q", got)
+	}
+	if resp := get("t2"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("其他 token 期望 200, 实际 %d", resp.StatusCode)
+	}
+}
+
+// 测试 RESP 超出限制时返回错误但保持连接
+func TestRESPServer_RateLimit(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	s := NewRESPServer(openTestDB(t))
+	s.SetRateLimit(&RateLimitConfig{QPS: 0.1, Burst: 2})
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ln) }()
+	defer func() {
+		s.Close()
+		if err := <-served; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Serve 期望返回 ErrServerClosed, 实际 %v", err)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+
+	for i, want := range []string{"+PONG", "+PONG", "-ERR rate limit exceeded", "-ERR rate limit exceeded"} {
+		if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+		if got := readReply(t, r); !strings.HasPrefix(got, want) {
+			t.Fatalf("第 %d 个请求期望 %q, 实际 %q", i+1, want, got)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// RESP（REdis Serialization Protocol）的编解码
+//
+// 请求：客户端发送由多行批量字符串组成的数组，例如 SET k v：
+//
+//	*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n
+//
+// 为了方便 telnet / nc 调试，也支持以空白分隔的内联命令（SET k v\r\n）。
+
+const (
+	// maxBulkLen 单个批量字符串的最大长度，与 Redis 的 proto-max-bulk-len 默认值一致
+	maxBulkLen = 512 << 20
+	// maxArrayLen 单个请求的最大参数个数
+	maxArrayLen = 1 << 20
+)
+
+var errProtocol = errors.New("protocol error")
+
+// respReader 从连接中读取 RESP 请求
+type respReader struct {
+	r *bufio.Reader
+}
+
+func newRESPReader(r io.Reader) *respReader {
+	return &respReader{r: bufio.NewReader(r)}
+}
+
+// buffered 返回已读入缓冲区但尚未解析的字节数，用于流水线请求时合并回复的刷新
+func (rr *respReader) buffered() int {
+	return rr.r.Buffered()
+}
+
+// readCommand 读取一条请求并返回其参数列表，空行返回长度为 0 的参数列表
+func (rr *respReader) readCommand() ([][]byte, error) {
+	line, err := rr.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return inlineArgs(line), nil
+	}
+
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArrayLen {
+		return nil, fmt.Errorf("%w: invalid multibulk length %q", errProtocol, line[1:])
+	}
+	if n <= 0 {
+		return [][]byte{}, nil
+	}
+
+	args := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		arg, err := rr.readBulk()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+func (rr *respReader) readBulk() ([]byte, error) {
+	line, err := rr.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '$' {
+		return nil, fmt.Errorf("%w: expected '$', got %q", errProtocol, line)
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < 0 || n > maxBulkLen {
+		return nil, fmt.Errorf("%w: invalid bulk length %q", errProtocol, line[1:])
+	}
+
+	buf := make([]byte, n+2)
+	if _, err := io.ReadFull(rr.r, buf); err != nil {
+		return nil, fmt.Errorf("read bulk: %w", err)
+	}
+	if buf[n] != '\r' || buf[n+1] != '\n' {
+		return nil, fmt.Errorf("%w: bulk not terminated by CRLF", errProtocol)
+	}
+	return buf[:n], nil
+}
+
+// readLine 读取一行并去掉结尾的 \r\n（兼容只有 \n 的内联命令）
+func (rr *respReader) readLine() ([]byte, error) {
+	line, err := rr.r.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, fmt.Errorf("%w: line too long", errProtocol)
+		}
+		return nil, fmt.Errorf("read line: %w", err)
+	}
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	// ReadSlice 返回的切片在下次读取时会被覆盖，调用方需要自行拷贝
+	return append([]byte(nil), line...), nil
+}
+
+func inlineArgs(line []byte) [][]byte {
+	fields := strings.Fields(string(line))
+	args := make([][]byte, len(fields))
+	for i, f := range fields {
+		args[i] = []byte(f)
+	}
+	return args
+}
+
+// respWriter 向连接写入 RESP 回复，数据先写入缓冲区，由调用方决定何时 flush
+type respWriter struct {
+	w *bufio.Writer
+}
+
+func newRESPWriter(w io.Writer) *respWriter {
+	return &respWriter{w: bufio.NewWriter(w)}
+}
+
+func (rw *respWriter) writeSimple(s string) {
+	rw.w.WriteByte('+')
+	rw.w.WriteString(s)
+	rw.w.WriteString("\r\n")
+}
+
+func (rw *respWriter) writeError(msg string) {
+	rw.w.WriteByte('-')
+	// 错误信息中不能出现换行，否则会破坏协议
+	rw.w.WriteString(strings.NewReplacer("\r", " ", "\n", " ").Replace(msg))
+	rw.w.WriteString("\r\n")
+}
+
+func (rw *respWriter) writeInt(n int64) {
+	rw.w.WriteByte(':')
+	rw.w.WriteString(strconv.FormatInt(n, 10))
+	rw.w.WriteString("\r\n")
+}
+
+func (rw *respWriter) writeBulk(b []byte) {
+	rw.w.WriteByte('$')
+	rw.w.WriteString(strconv.Itoa(len(b)))
+	rw.w.WriteString("\r\n")
+	rw.w.Write(b)
+	rw.w.WriteString("\r\n")
+}
+
+func (rw *respWriter) writeNull() {
+	rw.w.WriteString("$-1\r\n")
+}
+
+func (rw *respWriter) writeArrayHeader(n int) {
+	rw.w.WriteByte('*')
+	rw.w.WriteString(strconv.Itoa(n))
+	rw.w.WriteString("\r\n")
+}
+
+func (rw *respWriter) flush() error {
+	if err := rw.w.Flush(); err != nil {
+		return fmt.Errorf("flush reply: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,669 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+)
+
+// ErrServerClosed Serve 在 Close 之后返回的错误
+var ErrServerClosed = errors.New("server closed")
+
+// defaultScanCount SCAN 未指定 COUNT 时每次返回的 key 数量，与 Redis 一致
+const defaultScanCount = 10
+
+// RESPServer 把 Redis 协议的命令映射到 LSM 引擎上，使 redis-cli、redis-benchmark
+// 以及各语言的 Redis 客户端可以直接访问 SimpleDBForge
+//
+// 支持的命令：PING、ECHO、GET、MGET、SET（含 EX/PX）、DEL、EXISTS、INCR、INCRBY、DECR、DECRBY、
+// SCAN、TTL、PTTL、QUIT，以及客户端连接时常用的 COMMAND、CONFIG GET（返回空结果）。
+// 启用认证（见 SetAuth）后，连接需要先通过 AUTH <token> 或客户端证书获得角色，
+// 只读角色不能执行 SET、DEL 与 INCR 等写入命令
+//
+// 每个连接一个协程，连接内的命令按顺序执行；流水线请求的回复会在读缓冲区
+// 清空后一起刷新，减少系统调用次数
+type RESPServer struct {
+	db      *lsm.DB
+	auth    *AuthConfig
+	limiter *rateLimiter
+
+	// mu 保护 listeners、conns 与 closed，Close 与 Serve/连接协程可能并发访问
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// NewRESPServer 创建一个基于 db 的 RESP 服务，db 的生命周期由调用方管理
+func NewRESPServer(db *lsm.DB) *RESPServer {
+	return &RESPServer{
+		db:        db,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// SetAuth 设置 TLS 与认证，必须在 Serve 之前调用；cfg 为 nil 表示不加密、不认证
+func (s *RESPServer) SetAuth(cfg *AuthConfig) {
+	s.auth = cfg
+}
+
+// SetRateLimit 设置每个客户端的速率与带宽限制，必须在 Serve 之前调用；cfg 为 nil 表示不限制
+func (s *RESPServer) SetRateLimit(cfg *RateLimitConfig) {
+	s.limiter = newRateLimiter(cfg)
+}
+
+// ListenAndServe 监听 addr 并处理连接，直到 Close 被调用
+func (s *RESPServer) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen resp %s: %w", addr, err)
+	}
+	return s.Serve(ln)
+}
+
+// Serve 在 ln 上接受连接，阻塞直到 ln 出错或 Close 被调用，Close 之后返回 ErrServerClosed。
+// 配置了 TLS 时在 ln 之上进行 TLS 握手
+func (s *RESPServer) Serve(ln net.Listener) error {
+	if s.auth != nil && s.auth.TLS != nil {
+		ln = tls.NewListener(ln, s.auth.TLS)
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+
+	slog.Info("resp server listening", "addr", ln.Addr().String())
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, ln)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return fmt.Errorf("accept resp: %w", err)
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close 停止监听并关闭所有连接，等待正在执行的命令结束
+func (s *RESPServer) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+
+	var errs []error
+	for ln := range s.listeners {
+		if err := ln.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close resp listener: %w", err))
+		}
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return errors.Join(errs...)
+}
+
+func (s *RESPServer) serveConn(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		s.wg.Done()
+	}()
+
+	remote := conn.RemoteAddr().String()
+	sess := &respSession{}
+	if tc, ok := conn.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			slog.Debug("resp tls handshake", "remote", remote, "err", err)
+			return
+		}
+		cs := tc.ConnectionState()
+		sess.tls = &cs
+	}
+	sess.role = s.auth.role("", sess.tls)
+	sess.client = "ip:" + remoteIP(remote)
+	if s.auth.certRole(sess.tls) != RoleNone {
+		sess.client = "cert:" + sess.tls.VerifiedChains[0][0].Subject.CommonName
+	}
+	r := newRESPReader(conn)
+	// out 统计写回的字节数，用于带宽限制
+	out := &countingWriter{w: conn}
+	w := newRESPWriter(out)
+	var charged int64
+
+	for {
+		args, err := r.readCommand()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				w.writeError("ERR " + err.Error())
+				w.flush()
+				slog.Warn("resp protocol error", "remote", remote, "err", err)
+			} else if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				slog.Debug("resp read", "remote", remote, "err", err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		var quit bool
+		if ok, _ := s.limiter.allow(sess.client, argsSize(args)); ok {
+			quit = s.dispatch(w, args, sess)
+		} else {
+			w.writeError("ERR rate limit exceeded")
+		}
+
+		// 流水线中还有未处理的请求时先不刷新，攒到一起写回
+		if quit || r.buffered() == 0 {
+			if err := w.flush(); err != nil {
+				slog.Debug("resp write", "remote", remote, "err", err)
+				return
+			}
+		}
+		s.limiter.charge(sess.client, out.n-charged)
+		charged = out.n
+		if quit {
+			return
+		}
+	}
+}
+
+// respSession 连接的认证状态
+type respSession struct {
+	role Role
+	// tls 客户端的 TLS 连接状态，非 TLS 连接为 nil
+	tls *tls.ConnectionState
+	// client 限流使用的客户端标识，见 clientID
+	client string
+}
+
+// argsSize 返回命令参数的总字节数
+func argsSize(args [][]byte) int64 {
+	var n int64
+	for _, a := range args {
+		n += int64(len(a))
+	}
+	return n
+}
+
+// respCommand 描述一个命令：arity 为正数时参数个数（含命令名）必须相等，
+// 为负数时至少为 -arity，与 Redis COMMAND 的约定一致；role 为执行该命令需要的角色
+type respCommand struct {
+	arity   int
+	role    Role
+	handler func(s *RESPServer, w *respWriter, args [][]byte)
+}
+
+var respCommands map[string]respCommand
+
+func init() {
+	// 在 init 中赋值，避免 handler 引用 respCommands 造成初始化循环
+	respCommands = map[string]respCommand{
+		"ping":    {-1, RoleReadOnly, (*RESPServer).cmdPing},
+		"echo":    {2, RoleReadOnly, (*RESPServer).cmdEcho},
+		"get":     {2, RoleReadOnly, (*RESPServer).cmdGet},
+		"mget":    {-2, RoleReadOnly, (*RESPServer).cmdMGet},
+		"set":     {-3, RoleReadWrite, (*RESPServer).cmdSet},
+		"del":     {-2, RoleReadWrite, (*RESPServer).cmdDel},
+		"exists":  {-2, RoleReadOnly, (*RESPServer).cmdExists},
+		"incr":    {2, RoleReadWrite, (*RESPServer).cmdIncr},
+		"incrby":  {3, RoleReadWrite, (*RESPServer).cmdIncr},
+		"decr":    {2, RoleReadWrite, (*RESPServer).cmdIncr},
+		"decrby":  {3, RoleReadWrite, (*RESPServer).cmdIncr},
+		"scan":    {-2, RoleReadOnly, (*RESPServer).cmdScan},
+		"ttl":     {2, RoleReadOnly, (*RESPServer).cmdTTL},
+		"pttl":    {2, RoleReadOnly, (*RESPServer).cmdPTTL},
+		"command": {-1, RoleReadOnly, (*RESPServer).cmdCommand},
+		"config":  {-2, RoleReadOnly, (*RESPServer).cmdConfig},
+	}
+}
+
+// dispatch 执行一条命令并写入回复，返回连接是否应当关闭
+func (s *RESPServer) dispatch(w *respWriter, args [][]byte, sess *respSession) (quit bool) {
+	name := strings.ToLower(string(args[0]))
+	switch name {
+	case "quit":
+		w.writeSimple("OK")
+		return true
+	case "auth":
+		s.cmdAuth(w, args, sess)
+		return false
+	}
+
+	cmd, ok := respCommands[name]
+	if !ok {
+		w.writeError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+		return false
+	}
+	if sess.role < cmd.role {
+		if sess.role == RoleNone {
+			w.writeError("NOAUTH Authentication required.")
+		} else {
+			w.writeError(fmt.Sprintf("NOPERM this user has no permissions to run the '%s' command", name))
+		}
+		return false
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		w.writeError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+		return false
+	}
+	cmd.handler(s, w, args)
+	return false
+}
+
+// cmdAuth 处理 AUTH <token> 与 Redis 6 的 AUTH <username> <password>（用户名被忽略，password 作为 token），
+// 失败时保留连接原有的角色
+func (s *RESPServer) cmdAuth(w *respWriter, args [][]byte, sess *respSession) {
+	if len(args) != 2 && len(args) != 3 {
+		w.writeError("ERR wrong number of arguments for 'auth' command")
+		return
+	}
+	if !s.auth.enabled() {
+		w.writeError("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+		return
+	}
+	role := s.auth.tokenRole(string(args[len(args)-1]))
+	if role == RoleNone {
+		w.writeError("WRONGPASS invalid username-password pair or user is disabled.")
+		return
+	}
+	sess.role = max(role, s.auth.certRole(sess.tls))
+	sess.client = "token:" + string(args[len(args)-1])
+	w.writeSimple("OK")
+}
+
+// writeDBError 把引擎错误转换为 RESP 错误回复
+func writeDBError(w *respWriter, err error) {
+	slog.Error("resp command failed", "err", err)
+	w.writeError("ERR " + err.Error())
+}
+
+func (s *RESPServer) cmdPing(w *respWriter, args [][]byte) {
+	switch len(args) {
+	case 1:
+		w.writeSimple("PONG")
+	case 2:
+		w.writeBulk(args[1])
+	default:
+		w.writeError("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (s *RESPServer) cmdEcho(w *respWriter, args [][]byte) {
+	w.writeBulk(args[1])
+}
+
+func (s *RESPServer) cmdGet(w *respWriter, args [][]byte) {
+	value, err := s.db.Get(string(args[1]))
+	switch {
+	case errors.Is(err, lsm.ErrNotFound):
+		w.writeNull()
+	case err != nil:
+		writeDBError(w, err)
+	default:
+		w.writeBulk(value)
+	}
+}
+
+// cmdMGet 实现 MGET key [key ...]，所有 key 读取同一时刻的数据
+func (s *RESPServer) cmdMGet(w *respWriter, args [][]byte) {
+	keys := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		keys[i] = string(arg)
+	}
+	values, err := s.db.MultiGet(keys)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.writeArrayHeader(len(values))
+	for _, v := range values {
+		if v == nil {
+			w.writeNull()
+			continue
+		}
+		w.writeBulk(v)
+	}
+}
+
+// cmdSet 实现 SET key value [EX seconds | PX milliseconds]
+func (s *RESPServer) cmdSet(w *respWriter, args [][]byte) {
+	var ttl time.Duration
+	switch len(args) {
+	case 3:
+	case 5:
+		n, err := strconv.ParseInt(string(args[4]), 10, 64)
+		if err != nil || n <= 0 {
+			w.writeError("ERR invalid expire time in 'set' command")
+			return
+		}
+		switch strings.ToLower(string(args[3])) {
+		case "ex":
+			ttl = time.Duration(n) * time.Second
+		case "px":
+			ttl = time.Duration(n) * time.Millisecond
+		default:
+			w.writeError("ERR syntax error")
+			return
+		}
+	default:
+		w.writeError("ERR syntax error")
+		return
+	}
+
+	var err error
+	if ttl > 0 {
+		err = s.db.SetWithTTL(string(args[1]), args[2], ttl)
+	} else {
+		err = s.db.Set(string(args[1]), args[2])
+	}
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.writeSimple("OK")
+}
+
+// cmdDel 返回实际被删除（删除前存在）的 key 数量
+func (s *RESPServer) cmdDel(w *respWriter, args [][]byte) {
+	var n int64
+	for _, arg := range args[1:] {
+		key := string(arg)
+		if _, err := s.db.Get(key); err != nil {
+			if errors.Is(err, lsm.ErrNotFound) {
+				continue
+			}
+			writeDBError(w, err)
+			return
+		}
+		if err := s.db.Delete(key); err != nil {
+			writeDBError(w, err)
+			return
+		}
+		n++
+	}
+	w.writeInt(n)
+}
+
+// cmdIncr 实现 INCR key、INCRBY key delta、DECR key 与 DECRBY key delta
+func (s *RESPServer) cmdIncr(w *respWriter, args [][]byte) {
+	delta := int64(1)
+	if len(args) == 3 {
+		n, err := strconv.ParseInt(string(args[2]), 10, 64)
+		if err != nil {
+			w.writeError("ERR value is not an integer or out of range")
+			return
+		}
+		delta = n
+	}
+	if args[0][0] == 'd' || args[0][0] == 'D' {
+		if delta == math.MinInt64 {
+			w.writeError("ERR decrement would overflow")
+			return
+		}
+		delta = -delta
+	}
+
+	n, err := s.db.Increment(string(args[1]), delta)
+	switch {
+	case errors.Is(err, lsm.ErrNotInteger):
+		w.writeError("ERR value is not an integer or out of range")
+	case err != nil:
+		writeDBError(w, err)
+	default:
+		w.writeInt(n)
+	}
+}
+
+func (s *RESPServer) cmdExists(w *respWriter, args [][]byte) {
+	var n int64
+	for _, arg := range args[1:] {
+		_, err := s.db.Get(string(arg))
+		if errors.Is(err, lsm.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		n++
+	}
+	w.writeInt(n)
+}
+
+// cmdScan 实现 SCAN cursor [MATCH pattern] [COUNT count]
+//
+// 游标是已遍历过的 key 数量，返回 0 表示遍历结束。与 Redis 一样，遍历期间一直存在的
+// key 至少会被返回一次；但两次调用之间删除 key 会使游标后移，可能漏掉少量 key
+func (s *RESPServer) cmdScan(w *respWriter, args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		w.writeError("ERR invalid cursor")
+		return
+	}
+
+	pattern, count := "", defaultScanCount
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			w.writeError("ERR syntax error")
+			return
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			pattern = string(args[i+1])
+		case "count":
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil || count < 1 {
+				w.writeError("ERR syntax error")
+				return
+			}
+		default:
+			w.writeError("ERR syntax error")
+			return
+		}
+	}
+
+	it, err := s.db.NewIterator()
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	defer it.Close()
+
+	// COUNT 限制的是遍历的 key 数量而不是匹配的数量，与 Redis 一致
+	var keys []string
+	pos := uint64(0)
+	it.Seek("")
+	for ; it.Valid() && pos < cursor; it.Next() {
+		pos++
+	}
+	for scanned := 0; it.Valid() && scanned < count; it.Next() {
+		if pattern == "" || globMatch(pattern, it.Key()) {
+			keys = append(keys, it.Key())
+		}
+		scanned++
+		pos++
+	}
+
+	next := pos
+	if !it.Valid() {
+		next = 0
+	}
+
+	w.writeArrayHeader(2)
+	w.writeBulk([]byte(strconv.FormatUint(next, 10)))
+	w.writeArrayHeader(len(keys))
+	for _, k := range keys {
+		w.writeBulk([]byte(k))
+	}
+}
+
+// cmdTTL 返回剩余生存时间（秒），永不过期返回 -1，不存在返回 -2
+func (s *RESPServer) cmdTTL(w *respWriter, args [][]byte) {
+	s.writeTTL(w, string(args[1]), time.Second)
+}
+
+// cmdPTTL 与 TTL 相同，单位为毫秒
+func (s *RESPServer) cmdPTTL(w *respWriter, args [][]byte) {
+	s.writeTTL(w, string(args[1]), time.Millisecond)
+}
+
+func (s *RESPServer) writeTTL(w *respWriter, key string, unit time.Duration) {
+	expireAt, err := s.db.ExpireAt(key)
+	switch {
+	case errors.Is(err, lsm.ErrNotFound):
+		w.writeInt(-2)
+	case err != nil:
+		writeDBError(w, err)
+	case expireAt.IsZero():
+		w.writeInt(-1)
+	default:
+		// 与 Redis 一致，四舍五入到 unit
+		w.writeInt(int64((time.Until(expireAt) + unit/2) / unit))
+	}
+}
+
+// cmdCommand redis-cli 连接时会发送 COMMAND DOCS 获取命令提示，返回空数组即可
+func (s *RESPServer) cmdCommand(w *respWriter, args [][]byte) {
+	w.writeArrayHeader(0)
+}
+
+// cmdConfig 只支持 CONFIG GET 并返回空结果，redis-benchmark 启动时会查询配置
+func (s *RESPServer) cmdConfig(w *respWriter, args [][]byte) {
+	if strings.ToLower(string(args[1])) != "get" {
+		w.writeError(fmt.Sprintf("ERR unknown subcommand '%s'", args[1]))
+		return
+	}
+	w.writeArrayHeader(0)
+}
+
+// globMatch 实现 Redis 风格的通配符匹配：*、?、[abc]、[^a-z] 以及 \ 转义
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			matched, rest, ok := matchClass(pattern[1:], s[0])
+			if !ok {
+				// 没有闭合的 ']'，按普通字符处理
+				if s[0] != '[' {
+					return false
+				}
+				s, pattern = s[1:], pattern[1:]
+				continue
+			}
+			if !matched {
+				return false
+			}
+			s, pattern = s[1:], rest
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// matchClass 匹配 [...] 字符类，pattern 从 '[' 之后开始，返回剩余的模式
+func matchClass(pattern string, c byte) (matched bool, rest string, ok bool) {
+	negate := false
+	if len(pattern) > 0 && pattern[0] == '^' {
+		negate = true
+		pattern = pattern[1:]
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == ']':
+			return matched != negate, pattern[i+1:], true
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			if pattern[i] == c {
+				matched = true
+			}
+		case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+			lo, hi := pattern[i], pattern[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				matched = true
+			}
+			i += 2
+		default:
+			if pattern[i] == c {
+				matched = true
+			}
+		}
+	}
+	return false, "", false
+}
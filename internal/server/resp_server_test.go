@@ -0,0 +1,231 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+)
+
+func openTestDB(t *testing.T) *lsm.DB {
+	t.Helper()
+	db, err := lsm.Open(t.TempDir(), lsm.Options{SyncMode: lsm.NoSync})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// startRESPServer 在随机端口上启动服务并返回一个已连接的客户端，auth 为 nil 时不认证
+func startRESPServer(t *testing.T, db *lsm.DB, auth *AuthConfig) (net.Conn, *RESPServer) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	s := NewRESPServer(db)
+	s.SetAuth(auth)
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ln) }()
+	t.Cleanup(func() {
+		s.Close()
+		if err := <-served; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("Serve 期望返回 ErrServerClosed, 实际 %v", err)
+		}
+	})
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn, s
+}
+
+// encodeCommand 把参数编码为 RESP 数组
+func encodeCommand(args ...string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&sb, "$%d\r\n%s\r\n", len(a), a)
+	}
+	return sb.String()
+}
+
+// readReply 读取一条完整的回复并原样返回
+func readReply(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("读取回复失败: %v", err)
+	}
+	switch line[0] {
+	case '$':
+		var n int
+		fmt.Sscanf(line, "$%d", &n)
+		if n < 0 {
+			return line
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatalf("读取回复失败: %v", err)
+		}
+		return line + string(buf)
+	case '*':
+		var n int
+		fmt.Sscanf(line, "*%d", &n)
+		for i := 0; i < n; i++ {
+			line += readReply(t, r)
+		}
+	}
+	return line
+}
+
+func TestRESPServer_Commands(t *testing.T) {
+	conn, _ := startRESPServer(t, openTestDB(t), nil)
+	r := bufio.NewReader(conn)
+
+	tests := []struct {
+		name string
+		req  string
+		want string
+	}{
+		{name: "PING", req: encodeCommand("PING"), want: "+PONG\r\n"},
+		{name: "PING 带参数", req: encodeCommand("ping", "hi"), want: "$2\r\nhi\r\n"},
+		{name: "GET 不存在", req: encodeCommand("GET", "a"), want: "$-1\r\n"},
+		{name: "SET", req: encodeCommand("SET", "a", "1"), want: "+OK\r\n"},
+		{name: "GET", req: encodeCommand("GET", "a"), want: "$1\r\n1\r\n"},
+		{name: "二进制值", req: encodeCommand("SET", "bin", "x\r\ny"), want: "+OK\r\n"},
+		{name: "GET 二进制值", req: encodeCommand("GET", "bin"), want: "$4\r\nx\r\ny\r\n"},
+		{name: "MGET", req: encodeCommand("MGET", "a", "missing", "bin"), want: "*3\r\n$1\r\n1\r\n$-1\r\n$4\r\nx\r\ny\r\n"},
+		{name: "内联命令", req: "SET b 2\r\n", want: "+OK\r\n"},
+		{name: "EXISTS", req: encodeCommand("EXISTS", "a", "b", "c"), want: ":2\r\n"},
+		{name: "TTL 存在", req: encodeCommand("TTL", "a"), want: ":-1\r\n"},
+		{name: "TTL 不存在", req: encodeCommand("TTL", "c"), want: ":-2\r\n"},
+		{name: "SET EX", req: encodeCommand("SET", "t", "1", "EX", "100"), want: "+OK\r\n"},
+		{name: "TTL 带过期时间", req: encodeCommand("TTL", "t"), want: ":100\r\n"},
+		{name: "SET 非法过期时间", req: encodeCommand("SET", "t", "1", "EX", "0"), want: "-ERR invalid expire time in 'set' command\r\n"},
+		{name: "DEL", req: encodeCommand("DEL", "a", "c"), want: ":1\r\n"},
+		{name: "DEL 之后 GET", req: encodeCommand("GET", "a"), want: "$-1\r\n"},
+		{name: "INCR 不存在", req: encodeCommand("INCR", "n"), want: ":1\r\n"},
+		{name: "INCRBY", req: encodeCommand("INCRBY", "n", "10"), want: ":11\r\n"},
+		{name: "DECR", req: encodeCommand("decr", "n"), want: ":10\r\n"},
+		{name: "DECRBY", req: encodeCommand("DECRBY", "n", "-5"), want: ":15\r\n"},
+		{name: "INCR 非整数", req: encodeCommand("INCR", "bin"), want: "-ERR value is not an integer or out of range\r\n"},
+		{name: "INCRBY 非法增量", req: encodeCommand("INCRBY", "n", "x"), want: "-ERR value is not an integer or out of range\r\n"},
+		{name: "未知命令", req: encodeCommand("FOO"), want: "-ERR unknown command 'FOO'\r\n"},
+		{name: "参数个数错误", req: encodeCommand("GET"), want: "-ERR wrong number of arguments for 'get' command\r\n"},
+		{
+			name: "流水线",
+			req:  encodeCommand("SET", "p", "1") + encodeCommand("GET", "p"),
+			want: "+OK\r\n$1\r\n1\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := conn.Write([]byte(tt.req)); err != nil {
+				t.Fatalf("发送失败: %v", err)
+			}
+			var got string
+			for len(got) < len(tt.want) {
+				got += readReply(t, r)
+			}
+			if got != tt.want {
+				t.Fatalf("期望 %q, 实际 %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRESPServer_Scan(t *testing.T) {
+	db := openTestDB(t)
+	for _, k := range []string{"user:1", "user:2", "user:3", "order:1", "order:2"} {
+		if err := db.Set(k, []byte("v")); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+	conn, _ := startRESPServer(t, db, nil)
+	r := bufio.NewReader(conn)
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "全部",
+			args: []string{"SCAN", "0"},
+			want: "*2\r\n$1\r\n0\r\n*5\r\n$7\r\norder:1\r\n$7\r\norder:2\r\n$6\r\nuser:1\r\n$6\r\nuser:2\r\n$6\r\nuser:3\r\n",
+		},
+		{
+			name: "COUNT 分页",
+			args: []string{"SCAN", "0", "COUNT", "2"},
+			want: "*2\r\n$1\r\n2\r\n*2\r\n$7\r\norder:1\r\n$7\r\norder:2\r\n",
+		},
+		{
+			name: "从游标继续",
+			args: []string{"SCAN", "4", "COUNT", "2"},
+			want: "*2\r\n$1\r\n0\r\n*1\r\n$6\r\nuser:3\r\n",
+		},
+		{
+			name: "MATCH",
+			args: []string{"SCAN", "0", "MATCH", "user:[12]"},
+			want: "*2\r\n$1\r\n0\r\n*2\r\n$6\r\nuser:1\r\n$6\r\nuser:2\r\n",
+		},
+		{
+			name: "非法游标",
+			args: []string{"SCAN", "abc"},
+			want: "-ERR invalid cursor\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := conn.Write([]byte(encodeCommand(tt.args...))); err != nil {
+				t.Fatalf("发送失败: %v", err)
+			}
+			if got := readReply(t, r); got != tt.want {
+				t.Fatalf("期望 %q, 实际 %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "anything", true},
+		{"user:*", "user:1", true},
+		{"user:*", "order:1", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"*a*b", "xxaxxb", true},
+		{"a[", "a[", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.s, func(t *testing.T) {
+			if got := globMatch(tt.pattern, tt.s); got != tt.want {
+				t.Fatalf("globMatch(%q, %q) 期望 %v, 实际 %v", tt.pattern, tt.s, tt.want, got)
+			}
+		})
+	}
+}
@@ -1,32 +1,266 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
 	"runtime"
+	"slices"
+	"sync"
 
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/snappy"
 	"github.com/klauspost/compress/zstd"
 )
 
-var (
-	smallEecoder *zstd.Encoder
-	smallDecoder *zstd.Decoder
+// CodecID 标识一种压缩算法，随压缩后的数据一起写入文件，使文件自描述：
+// 读取时按记录的 CodecID 选择解压算法，而不依赖打开时的配置。已分配的值不可更改
+type CodecID byte
+
+const (
+	// CodecNone 不压缩
+	CodecNone CodecID = 0
+	// CodecZstd 压缩率高，适合冷数据与带宽受限的场景
+	CodecZstd CodecID = 1
+	// CodecSnappy 速度快、压缩率一般
+	CodecSnappy CodecID = 2
+	// CodecS2 snappy 的改进版本，压缩与解压都比 snappy 更快，压缩率相近
+	CodecS2 CodecID = 3
 )
 
+// Codec 是一种压缩算法的实现，必须并发安全
+//
+// 内置 none、zstd、snappy、s2，其他算法（例如 lz4）可以通过 RegisterCodec 注册，
+// 需要选择一个未被占用的 CodecID
+type Codec interface {
+	// ID 写入数据格式中的算法标识
+	ID() CodecID
+	// Name 算法名称，用于配置与日志
+	Name() string
+	// Encode 把 src 压缩后追加到 dst 之后，返回追加后的切片
+	Encode(dst, src []byte) []byte
+	// Decode 把 src 解压后追加到 dst 之后，返回追加后的切片
+	Decode(dst, src []byte) ([]byte, error)
+}
+
+// MaxDecodedLen 内置算法一次解压的长度上限（1 GiB），Decode 等同于 limit 为该值的 DecodeLimit
+const MaxDecodedLen = 1 << 30
+
+// ErrDecodedTooLarge 解压后的数据超过 DecodeLimit 的上限
+var ErrDecodedTooLarge = errors.New("decoded data too large")
+
+// limitDecoder 由能在分配内存之前检查解压后长度的算法实现，见 DecodeLimit
+type limitDecoder interface {
+	decodeLimit(dst, src []byte, limit int) ([]byte, error)
+}
+
+// DecodeLimit 与 c.Decode 相同，但解压后的数据超过 limit 字节时返回 ErrDecodedTooLarge
+//
+// 压缩数据的头部声明了解压后的长度，解码器按它一次性分配内存：损坏或恶意构造的头部只需几个字节
+// 就能让 Decode 尝试分配数 GB。内置算法在分配之前用 limit 检查声明的长度；
+// 通过 RegisterCodec 注册的其他算法只能在解压之后检查
+func DecodeLimit(c Codec, dst, src []byte, limit int) ([]byte, error) {
+	if ld, ok := c.(limitDecoder); ok {
+		return ld.decodeLimit(dst, src, limit)
+	}
+	out, err := c.Decode(dst, src)
+	if err != nil {
+		return out, err
+	}
+	if len(out)-len(dst) > limit {
+		return dst, fmt.Errorf("%w: %d bytes, limit %d", ErrDecodedTooLarge, len(out)-len(dst), limit)
+	}
+	return out, nil
+}
+
+// checkDecodedLen 检查头部声明的解压后长度
+func checkDecodedLen(size uint64, limit int) error {
+	if size > uint64(limit) {
+		return fmt.Errorf("%w: header declares %d bytes, limit %d", ErrDecodedTooLarge, size, limit)
+	}
+	return nil
+}
+
+var codecs = struct {
+	sync.RWMutex
+	byID   map[CodecID]Codec
+	byName map[string]Codec
+}{byID: make(map[CodecID]Codec), byName: make(map[string]Codec)}
+
+// RegisterCodec 注册一种压缩算法，ID 或名称已被占用时 panic；通常在 init 中调用
+func RegisterCodec(c Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	if _, ok := codecs.byID[c.ID()]; ok {
+		panic(fmt.Sprintf("compress: codec id %d already registered", c.ID()))
+	}
+	if _, ok := codecs.byName[c.Name()]; ok {
+		panic(fmt.Sprintf("compress: codec %q already registered", c.Name()))
+	}
+	codecs.byID[c.ID()] = c
+	codecs.byName[c.Name()] = c
+}
+
+// CodecByID 返回已注册的算法，未注册时返回错误（例如读到了更新版本写入的数据）
+func CodecByID(id CodecID) (Codec, error) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	c, ok := codecs.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression codec id %d", id)
+	}
+	return c, nil
+}
+
+// CodecByName 按名称返回已注册的算法
+func CodecByName(name string) (Codec, error) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	c, ok := codecs.byName[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression codec %q", name)
+	}
+	return c, nil
+}
+
+// Codecs 返回所有已注册算法的名称，按 ID 排序
+func Codecs() []string {
+	codecs.RLock()
+	defer codecs.RUnlock()
+	ids := make([]CodecID, 0, len(codecs.byID))
+	for id := range codecs.byID {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = codecs.byID[id].Name()
+	}
+	return names
+}
+
 func init() {
-	numCpu := runtime.GOMAXPROCS(0)
-	smallEecoder, _ = zstd.NewWriter(
-		nil,
-		zstd.WithEncoderLevel(zstd.SpeedBetterCompression),
-	)
-	smallDecoder, _ = zstd.NewReader(
-		nil,
-		zstd.WithDecoderConcurrency(numCpu),
-	)
+	RegisterCodec(noneCodec{})
+	RegisterCodec(newZstdCodec())
+	RegisterCodec(snappyCodec{})
+	RegisterCodec(s2Codec{})
+}
+
+type noneCodec struct{}
+
+func (noneCodec) ID() CodecID                            { return CodecNone }
+func (noneCodec) Name() string                           { return "none" }
+func (noneCodec) Encode(dst, src []byte) []byte          { return append(dst, src...) }
+func (noneCodec) Decode(dst, src []byte) ([]byte, error) { return append(dst, src...), nil }
+
+func (noneCodec) decodeLimit(dst, src []byte, limit int) ([]byte, error) {
+	if err := checkDecodedLen(uint64(len(src)), limit); err != nil {
+		return dst, err
+	}
+	return append(dst, src...), nil
+}
+
+// zstdCodec 共享一组编码器与解码器，EncodeAll / DecodeAll 本身是并发安全的
+type zstdCodec struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+func newZstdCodec() zstdCodec {
+	encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	// 默认的上限是 64 GiB，帧头声明的长度不超过上限时 DecodeAll 会按它一次性分配
+	decoder, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(runtime.GOMAXPROCS(0)),
+		zstd.WithDecoderMaxMemory(MaxDecodedLen))
+	return zstdCodec{encoder: encoder, decoder: decoder}
+}
+
+func (zstdCodec) ID() CodecID                     { return CodecZstd }
+func (zstdCodec) Name() string                    { return "zstd" }
+func (c zstdCodec) Encode(dst, src []byte) []byte { return c.encoder.EncodeAll(src, dst) }
+func (c zstdCodec) Decode(dst, src []byte) ([]byte, error) {
+	return c.decodeLimit(dst, src, MaxDecodedLen)
+}
+
+// decodeLimit 检查第一帧的帧头，EncodeAll 只产生一帧；拼接的多帧数据在解压之后检查，
+// 但总量仍受解码器的 MaxDecodedLen 限制
+func (c zstdCodec) decodeLimit(dst, src []byte, limit int) ([]byte, error) {
+	var h zstd.Header
+	if err := h.Decode(src); err == nil && h.HasFCS {
+		if err := checkDecodedLen(h.FrameContentSize, limit); err != nil {
+			return dst, err
+		}
+	}
+	out, err := c.decoder.DecodeAll(src, dst)
+	if err != nil {
+		return dst, err
+	}
+	if err := checkDecodedLen(uint64(len(out)-len(dst)), limit); err != nil {
+		return dst, err
+	}
+	return out, nil
+}
+
+// snappyCodec 与 s2Codec 的 Encode / Decode 写入 dst 的可用容量而不是追加，
+// 这里先扩容再把结果接在 dst 之后
+type snappyCodec struct{}
+
+func (snappyCodec) ID() CodecID  { return CodecSnappy }
+func (snappyCodec) Name() string { return "snappy" }
+
+func (snappyCodec) Encode(dst, src []byte) []byte {
+	n := len(dst)
+	dst = slices.Grow(dst, snappy.MaxEncodedLen(len(src)))
+	return dst[:n+len(snappy.Encode(dst[n:cap(dst)], src))]
+}
+
+func (c snappyCodec) Decode(dst, src []byte) ([]byte, error) {
+	return c.decodeLimit(dst, src, MaxDecodedLen)
+}
+
+func (snappyCodec) decodeLimit(dst, src []byte, limit int) ([]byte, error) {
+	size, err := snappy.DecodedLen(src)
+	if err != nil {
+		return dst, err
+	}
+	if err := checkDecodedLen(uint64(size), limit); err != nil {
+		return dst, err
+	}
+	n := len(dst)
+	dst = slices.Grow(dst, size)
+	out, err := snappy.Decode(dst[n:n+size], src)
+	if err != nil {
+		return dst[:n], err
+	}
+	return dst[:n+len(out)], nil
+}
+
+type s2Codec struct{}
+
+func (s2Codec) ID() CodecID  { return CodecS2 }
+func (s2Codec) Name() string { return "s2" }
+
+func (s2Codec) Encode(dst, src []byte) []byte {
+	n := len(dst)
+	dst = slices.Grow(dst, s2.MaxEncodedLen(len(src)))
+	return dst[:n+len(s2.Encode(dst[n:cap(dst)], src))]
 }
 
-func Compress(src []byte) []byte {
-	return smallEecoder.EncodeAll(src, nil)
+func (c s2Codec) Decode(dst, src []byte) ([]byte, error) {
+	return c.decodeLimit(dst, src, MaxDecodedLen)
 }
 
-func Decompress(src []byte) ([]byte, error) {
-	return smallDecoder.DecodeAll(src, nil)
+func (s2Codec) decodeLimit(dst, src []byte, limit int) ([]byte, error) {
+	size, err := s2.DecodedLen(src)
+	if err != nil {
+		return dst, err
+	}
+	if err := checkDecodedLen(uint64(size), limit); err != nil {
+		return dst, err
+	}
+	n := len(dst)
+	dst = slices.Grow(dst, size)
+	out, err := s2.Decode(dst[n:n+size], src)
+	if err != nil {
+		return dst[:n], err
+	}
+	return dst[:n+len(out)], nil
 }
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCodec_RoundTrip(t *testing.T) {
+	inputs := map[string][]byte{
+		"空":   nil,
+		"短":   []byte("hello"),
+		"重复":  bytes.Repeat([]byte("SimpleDBForge "), 1000),
+		"二进制": {0, 1, 2, 3, 255, 254, 0, 0, 0},
+	}
+	for _, name := range Codecs() {
+		codec, err := CodecByName(name)
+		if err != nil {
+			t.Fatalf("CodecByName(%q) 失败: %v", name, err)
+		}
+		if byID, err := CodecByID(codec.ID()); err != nil || byID.Name() != name {
+			t.Fatalf("CodecByID(%d) = %v, %v, 期望 %s", codec.ID(), byID, err, name)
+		}
+		for label, src := range inputs {
+			t.Run(name+"/"+label, func(t *testing.T) {
+				// 结果应当追加在 dst 之后，不覆盖已有内容
+				prefix := []byte("prefix")
+				encoded := codec.Encode(append([]byte(nil), prefix...), src)
+				if !bytes.HasPrefix(encoded, prefix) {
+					t.Fatalf("Encode 覆盖了 dst 中已有的内容: %q", encoded)
+				}
+				decoded, err := codec.Decode(append([]byte(nil), prefix...), encoded[len(prefix):])
+				if err != nil {
+					t.Fatalf("Decode 失败: %v", err)
+				}
+				if !bytes.Equal(decoded[len(prefix):], src) || !bytes.HasPrefix(decoded, prefix) {
+					t.Fatalf("往返结果不一致: %q", decoded)
+				}
+			})
+		}
+	}
+}
+
+func TestCodec_Unknown(t *testing.T) {
+	if _, err := CodecByID(200); err == nil {
+		t.Fatal("未注册的 CodecID 应当返回错误")
+	}
+	if _, err := CodecByName("lz77"); err == nil {
+		t.Fatal("未注册的名称应当返回错误")
+	}
+	for _, name := range []string{"snappy", "s2"} {
+		codec, _ := CodecByName(name)
+		if _, err := codec.Decode(nil, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0x01}); err == nil {
+			t.Fatalf("%s 解码损坏的数据应当返回错误", name)
+		}
+	}
+}
+
+const fuzzDecodeLimit = 1 << 20
+
+// FuzzCodec_Decode 任意输入都不能让解码 panic，合法的压缩数据往返后保持不变
+func FuzzCodec_Decode(f *testing.F) {
+	for _, name := range Codecs() {
+		codec, _ := CodecByName(name)
+		for _, src := range [][]byte{nil, []byte("hello"), bytes.Repeat([]byte("SimpleDBForge "), 100)} {
+			f.Add(byte(codec.ID()), codec.Encode(nil, src))
+		}
+	}
+	f.Fuzz(func(t *testing.T, id byte, data []byte) {
+		codec, err := CodecByID(CodecID(id))
+		if err != nil {
+			return
+		}
+		// 用较小的上限解码，头部声明的长度再大也不会真的分配
+		if out, err := DecodeLimit(codec, nil, data, fuzzDecodeLimit); err == nil && len(out) > fuzzDecodeLimit {
+			t.Fatalf("%s 解压后 %d 字节, 超过上限 %d", codec.Name(), len(out), fuzzDecodeLimit)
+		}
+
+		decoded, err := codec.Decode(nil, codec.Encode(nil, data))
+		if err != nil || !bytes.Equal(decoded, data) {
+			t.Fatalf("%s 往返结果不一致: %v", codec.Name(), err)
+		}
+	})
+}
+
+func TestDecodeLimit(t *testing.T) {
+	src := bytes.Repeat([]byte("SimpleDBForge "), 100)
+	for _, name := range Codecs() {
+		codec, _ := CodecByName(name)
+		encoded := codec.Encode(nil, src)
+		if out, err := DecodeLimit(codec, nil, encoded, len(src)); err != nil || !bytes.Equal(out, src) {
+			t.Fatalf("%s 上限等于原始长度时应当解压成功: %v", name, err)
+		}
+		if _, err := DecodeLimit(codec, nil, encoded, len(src)-1); !errors.Is(err, ErrDecodedTooLarge) {
+			t.Fatalf("%s 期望 ErrDecodedTooLarge, 实际 %v", name, err)
+		}
+	}
+
+	// 头部声明了超过 MaxDecodedLen 的长度，应当在分配内存之前返回错误
+	tests := []struct {
+		codec string
+		data  []byte
+	}{
+		{codec: "snappy", data: []byte{0xff, 0xff, 0xff, 0xff, 0x0f, 0}},
+		{codec: "s2", data: []byte{0xff, 0xff, 0xff, 0xff, 0x0f, 0}},
+		// 单段帧，8 字节的 Frame_Content_Size 为 1 TiB
+		{codec: "zstd", data: []byte{0x28, 0xb5, 0x2f, 0xfd, 0xe0, 0, 0, 0, 0, 0, 1, 0, 0, 1, 0, 0}},
+	}
+	for _, tt := range tests {
+		codec, _ := CodecByName(tt.codec)
+		if _, err := codec.Decode(nil, tt.data); !errors.Is(err, ErrDecodedTooLarge) {
+			t.Fatalf("%s 期望 ErrDecodedTooLarge, 实际 %v", tt.codec, err)
+		}
+	}
+}
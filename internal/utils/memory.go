@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+// entryStructSize sdbf.Entry 结构体本身的大小，包含 protobuf 的内部状态与各字段的 string/slice 头部
+const entryStructSize = int64(unsafe.Sizeof(sdbf.Entry{}))
+
+// EntrySize 估算条目占用的内存：结构体本身加上 key、value、列族名与范围终点的数据
+//
+// value 按容量计算，反序列化或复用缓冲区得到的 value 实际持有的是整个底层数组
+func EntrySize(e *sdbf.Entry) int64 {
+	return entryStructSize + int64(len(e.Key)+cap(e.Value)+cap(e.UserMeta)+len(e.ColumnFamily)+len(e.RangeEnd))
+}
+
+// MemoryBudget 是多个组件共享的内存预算
+//
+// 各组件（MemTable，以及之后的块缓存、写缓冲）用同一套估算方法计算自己的占用，
+// 通过 Add 把变化申报到同一个预算上，据此判断整体是否超出限制并各自采取措施。
+// 预算只做统计，不会阻止分配。所有方法都可以并发调用
+type MemoryBudget struct {
+	// limit 为 0 表示不限制，只统计；运行期间可以通过 SetLimit 调整
+	limit atomic.Int64
+	used  atomic.Int64
+}
+
+// NewMemoryBudget 创建上限为 limit 字节的预算，limit 为 0 表示不限制
+func NewMemoryBudget(limit int64) *MemoryBudget {
+	b := &MemoryBudget{}
+	b.limit.Store(max(limit, 0))
+	return b
+}
+
+// Add 申报 delta 字节的占用变化（释放时为负数），返回申报之后的总占用
+func (b *MemoryBudget) Add(delta int64) int64 {
+	return b.used.Add(delta)
+}
+
+// Used 返回当前的总占用
+func (b *MemoryBudget) Used() int64 {
+	return b.used.Load()
+}
+
+// Limit 返回预算上限，0 表示不限制
+func (b *MemoryBudget) Limit() int64 {
+	return b.limit.Load()
+}
+
+// SetLimit 调整预算上限，0 表示不限制；已有的占用不受影响，下次检查时按新的上限判断
+func (b *MemoryBudget) SetLimit(limit int64) {
+	b.limit.Store(max(limit, 0))
+}
+
+// Exceeded 总占用是否超过了上限
+func (b *MemoryBudget) Exceeded() bool {
+	limit := b.limit.Load()
+	return limit > 0 && b.used.Load() > limit
+}
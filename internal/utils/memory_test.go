@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+func TestEntrySize(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry *sdbf.Entry
+		want  int64
+	}{
+		{name: "空", entry: &sdbf.Entry{}, want: entryStructSize},
+		{name: "key 与 value", entry: &sdbf.Entry{Key: "key", Value: []byte("value")}, want: entryStructSize + 8},
+		{name: "value 按容量计算", entry: &sdbf.Entry{Key: "k", Value: make([]byte, 1, 64)}, want: entryStructSize + 65},
+		{name: "列族与范围删除", entry: &sdbf.Entry{Key: "a", RangeEnd: "z", ColumnFamily: "cf"}, want: entryStructSize + 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EntrySize(tt.entry); got != tt.want {
+				t.Fatalf("期望 %d, 实际 %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int64
+		add      []int64
+		want     int64
+		exceeded bool
+	}{
+		{name: "不限制", limit: 0, add: []int64{1 << 40}, want: 1 << 40, exceeded: false},
+		{name: "未超出", limit: 100, add: []int64{60, 40}, want: 100, exceeded: false},
+		{name: "超出", limit: 100, add: []int64{60, 41}, want: 101, exceeded: true},
+		{name: "释放后恢复", limit: 100, add: []int64{150, -80}, want: 70, exceeded: false},
+		{name: "负数上限视为不限制", limit: -1, add: []int64{10}, want: 10, exceeded: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemoryBudget(tt.limit)
+			for _, d := range tt.add {
+				b.Add(d)
+			}
+			if b.Used() != tt.want || b.Exceeded() != tt.exceeded {
+				t.Fatalf("期望占用 %d 超出 %v, 实际 %d %v", tt.want, tt.exceeded, b.Used(), b.Exceeded())
+			}
+		})
+	}
+}
+
+// 测试并发申报
+func TestMemoryBudget_Concurrent(t *testing.T) {
+	b := NewMemoryBudget(0)
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 1000 {
+				b.Add(3)
+				b.Add(-1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := b.Used(); got != 8*1000*2 {
+		t.Fatalf("期望 %d, 实际 %d", 8*1000*2, got)
+	}
+}
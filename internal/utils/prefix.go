@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// maxTsSuffix 最大的时间戳后缀，"key"+maxTsSuffix 按 CompareKey 排在所有 "key@ts" 之前
+var maxTsSuffix = "@" + strconv.FormatUint(math.MaxUint64, 10)
+
+// PrefixRange 返回按 CompareKey 排序时，所有以 prefix 开头的 key 所在的区间 [start, end)
+//
+// 由于同一个 key 的多个时间戳版本按时间戳降序排列，"user@5" 会排在 "user" 之前，
+// 所以两端都附加最大时间戳：start 排在 prefix 的所有版本之前，end 排在上界 key 的所有版本之前。
+// prefix 为空或全部由 0xff 组成时没有上界，bounded 为 false
+//
+// prefix 不含 '@' 时区间内恰好是以 prefix 开头的 key；含 '@' 时以 prefix 开头的 key
+// 不一定连续（"a@12" 按 "a" 排序），区间按第一个 '@' 之前的部分计算，调用方需要再逐个过滤
+func PrefixRange(prefix string) (start, end string, bounded bool) {
+	if i := strings.IndexByte(prefix, '@'); i >= 0 {
+		prefix = prefix[:i]
+	}
+	start = prefix + maxTsSuffix
+
+	// 上界是最短的、大于所有以 prefix 开头的字符串：去掉末尾的 0xff 后把最后一个字节加一
+	upper := []byte(prefix)
+	for len(upper) > 0 && upper[len(upper)-1] == 0xff {
+		upper = upper[:len(upper)-1]
+	}
+	if len(upper) == 0 {
+		return start, "", false
+	}
+	upper[len(upper)-1]++
+	return start, string(upper) + maxTsSuffix, true
+}
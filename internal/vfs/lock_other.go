@@ -0,0 +1,54 @@
+//go:build !unix
+
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// osLocks 当前进程持有的锁，非 unix 平台没有 flock，只能防止同一进程内的重复加锁
+var osLocks = struct {
+	sync.Mutex
+	names map[string]struct{}
+}{names: make(map[string]struct{})}
+
+func (OSFS) Lock(name string) (io.Closer, error) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "lock", Path: name, Err: err}
+	}
+
+	osLocks.Lock()
+	defer osLocks.Unlock()
+	if _, ok := osLocks.names[abs]; ok {
+		return nil, &fs.PathError{Op: "lock", Path: name, Err: ErrLocked}
+	}
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	osLocks.names[abs] = struct{}{}
+	return &osLock{File: f, name: abs}, nil
+}
+
+// osLock 关闭文件时从 osLocks 中移除
+type osLock struct {
+	*os.File
+	name string
+	once sync.Once
+}
+
+func (l *osLock) Close() error {
+	var err error
+	l.once.Do(func() {
+		osLocks.Lock()
+		delete(osLocks.names, l.name)
+		osLocks.Unlock()
+		err = l.File.Close()
+	})
+	return err
+}
@@ -0,0 +1,422 @@
+package vfs
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// MemFS 是完全位于内存中的文件系统，用于测试；并发安全
+//
+// 路径按 filepath.Clean 规范化后作为键，相对路径与绝对路径互不相同。
+// 根目录（"/" 与 "."）总是存在。Sync 与 SyncDir 不做任何事，写入立即对所有打开的文件可见
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string]*memNode
+	dirs  map[string]struct{}
+	// locks 当前被锁定的文件
+	locks map[string]struct{}
+}
+
+var _ FS = (*MemFS)(nil)
+
+// NewMemFS 创建一个空的内存文件系统
+func NewMemFS() *MemFS {
+	return &MemFS{
+		files: make(map[string]*memNode),
+		dirs:  map[string]struct{}{"/": {}, ".": {}},
+		locks: make(map[string]struct{}),
+	}
+}
+
+// memNode 文件内容，同一个文件的多个句柄共享一个 memNode
+type memNode struct {
+	mu      sync.RWMutex
+	data    []byte
+	modTime time.Time
+}
+
+func (m *MemFS) Create(name string) (File, error) {
+	return m.open(name, true, true)
+}
+
+func (m *MemFS) Open(name string) (File, error) {
+	return m.open(name, false, false)
+}
+
+func (m *MemFS) OpenReadWrite(name string) (File, error) {
+	return m.open(name, true, false)
+}
+
+// open 打开 name，writable 时文件不存在则创建，truncate 时清空已有内容
+func (m *MemFS) open(name string, writable, truncate bool) (File, error) {
+	name = filepath.Clean(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.dirs[name]; ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	node, ok := m.files[name]
+	if !ok {
+		if !writable {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		if _, ok := m.dirs[filepath.Dir(name)]; !ok {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		node = &memNode{modTime: time.Now()}
+		m.files[name] = node
+	}
+	if truncate {
+		node.mu.Lock()
+		node.data = node.data[:0]
+		node.modTime = time.Now()
+		node.mu.Unlock()
+	}
+	return &memFile{name: name, node: node, writable: writable}, nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	name = filepath.Clean(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[name]; ok {
+		delete(m.files, name)
+		return nil
+	}
+	if _, ok := m.dirs[name]; ok {
+		if len(m.childrenLocked(name)) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+		delete(m.dirs, name)
+		return nil
+	}
+	return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *MemFS) Rename(oldname, newname string) error {
+	oldname, newname = filepath.Clean(oldname), filepath.Clean(newname)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.files[oldname]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if _, ok := m.dirs[filepath.Dir(newname)]; !ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if _, ok := m.dirs[newname]; ok {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EISDIR}
+	}
+	delete(m.files, oldname)
+	m.files[newname] = node
+	return nil
+}
+
+// Link 让 newname 与 oldname 共享同一个文件节点，通过任一名称的修改对另一个可见
+func (m *MemFS) Link(oldname, newname string) error {
+	oldname, newname = filepath.Clean(oldname), filepath.Clean(newname)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.files[oldname]
+	if !ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	if _, ok := m.dirs[filepath.Dir(newname)]; !ok {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrNotExist}
+	}
+	_, isFile := m.files[newname]
+	if _, isDir := m.dirs[newname]; isFile || isDir {
+		return &os.LinkError{Op: "link", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+	m.files[newname] = node
+	return nil
+}
+
+func (m *MemFS) MkdirAll(dir string, perm os.FileMode) error {
+	dir = filepath.Clean(dir)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for p := dir; ; p = filepath.Dir(p) {
+		if _, ok := m.files[p]; ok {
+			return &fs.PathError{Op: "mkdir", Path: p, Err: syscall.ENOTDIR}
+		}
+		if _, ok := m.dirs[p]; ok {
+			break
+		}
+		m.dirs[p] = struct{}{}
+	}
+	return nil
+}
+
+func (m *MemFS) List(dir string) ([]string, error) {
+	dir = filepath.Clean(dir)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.dirs[dir]; !ok {
+		return nil, &fs.PathError{Op: "open", Path: dir, Err: fs.ErrNotExist}
+	}
+	names := m.childrenLocked(dir)
+	slices.Sort(names)
+	return names, nil
+}
+
+// childrenLocked 返回 dir 下直接子条目的名称，调用方需持有 m.mu
+func (m *MemFS) childrenLocked(dir string) []string {
+	var names []string
+	add := func(p string) {
+		if p != dir && filepath.Dir(p) == dir {
+			names = append(names, filepath.Base(p))
+		}
+	}
+	for p := range m.files {
+		add(p)
+	}
+	for p := range m.dirs {
+		add(p)
+	}
+	return names
+}
+
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	name = filepath.Clean(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if node, ok := m.files[name]; ok {
+		node.mu.RLock()
+		defer node.mu.RUnlock()
+		return &memFileInfo{name: filepath.Base(name), size: int64(len(node.data)), modTime: node.modTime}, nil
+	}
+	if _, ok := m.dirs[name]; ok {
+		return &memFileInfo{name: filepath.Base(name), dir: true}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+func (m *MemFS) SyncDir(dir string) error {
+	dir = filepath.Clean(dir)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.dirs[dir]; !ok {
+		return &fs.PathError{Op: "open", Path: dir, Err: fs.ErrNotExist}
+	}
+	return nil
+}
+
+// memFile 是 MemFS 中一个打开的文件句柄，每个句柄有独立的读写位置
+type memFile struct {
+	mu       sync.Mutex
+	name     string
+	node     *memNode
+	pos      int64
+	writable bool
+	closed   bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.node.mu.RLock()
+	defer f.node.mu.RUnlock()
+
+	if f.pos >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[f.pos:])
+	f.pos += int64(n)
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrClosed}
+	}
+	if !f.writable {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+	}
+	f.node.mu.Lock()
+	defer f.node.mu.Unlock()
+
+	// 写入位置超出文件末尾时，中间的空洞以 0 填充
+	if end := f.pos + int64(len(p)); end > int64(len(f.node.data)) {
+		size := len(f.node.data)
+		f.node.data = slices.Grow(f.node.data, int(end)-size)[:end]
+		// 底层数组可能残留截断前的内容
+		clear(f.node.data[size:])
+	}
+	n := copy(f.node.data[f.pos:], p)
+	f.pos += int64(n)
+	f.node.modTime = time.Now()
+	return n, nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+	var base int64
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		base = f.pos
+	case io.SeekEnd:
+		f.node.mu.RLock()
+		base = int64(len(f.node.data))
+		f.node.mu.RUnlock()
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if base+offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.pos = base + offset
+	return f.pos, nil
+}
+
+func (f *memFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: fs.ErrClosed}
+	}
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.node.mu.RLock()
+	defer f.node.mu.RUnlock()
+	return &memFileInfo{name: filepath.Base(f.name), size: int64(len(f.node.data)), modTime: f.node.modTime}, nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrClosed}
+	}
+	if !f.writable {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrPermission}
+	}
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.node.mu.Lock()
+	defer f.node.mu.Unlock()
+
+	if size <= int64(len(f.node.data)) {
+		f.node.data = f.node.data[:size]
+	} else {
+		f.node.data = append(f.node.data, make([]byte, size-int64(len(f.node.data)))...)
+	}
+	f.node.modTime = time.Now()
+	return nil
+}
+
+// memFileInfo 实现 os.FileInfo
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *memFileInfo) Name() string       { return i.name }
+func (i *memFileInfo) Size() int64        { return i.size }
+func (i *memFileInfo) ModTime() time.Time { return i.modTime }
+func (i *memFileInfo) IsDir() bool        { return i.dir }
+func (i *memFileInfo) Sys() any           { return nil }
+
+func (i *memFileInfo) Mode() os.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (m *MemFS) Lock(name string) (io.Closer, error) {
+	name = filepath.Clean(name)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.dirs[filepath.Dir(name)]; !ok {
+		return nil, &fs.PathError{Op: "lock", Path: name, Err: fs.ErrNotExist}
+	}
+	if _, ok := m.dirs[name]; ok {
+		return nil, &fs.PathError{Op: "lock", Path: name, Err: syscall.EISDIR}
+	}
+	if _, ok := m.locks[name]; ok {
+		return nil, &fs.PathError{Op: "lock", Path: name, Err: ErrLocked}
+	}
+	if _, ok := m.files[name]; !ok {
+		m.files[name] = &memNode{modTime: time.Now()}
+	}
+	m.locks[name] = struct{}{}
+	return &memLock{fs: m, name: name}, nil
+}
+
+// memLock 是 MemFS.Lock 返回的锁，重复关闭是安全的
+type memLock struct {
+	fs   *MemFS
+	name string
+	once sync.Once
+}
+
+func (l *memLock) Close() error {
+	l.once.Do(func() {
+		l.fs.mu.Lock()
+		delete(l.fs.locks, l.name)
+		l.fs.mu.Unlock()
+	})
+	return nil
+}
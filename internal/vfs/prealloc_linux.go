@@ -0,0 +1,35 @@
+//go:build linux
+
+package vfs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Preallocate 为 f 预先分配 size 字节的磁盘空间并把文件扩展到 size，新增部分读出为 0；
+// 文件已不小于 size 时不做任何事。之后在这个范围内的写入不需要再分配块，
+// 文件系统也就不必为每次扩展记录元数据日志。
+// 文件系统不支持 fallocate 或 f 不是 *os.File（例如 MemFS）时退化为 Truncate 扩展文件
+func Preallocate(f File, size int64) error {
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() >= size {
+		return nil
+	}
+	of, ok := f.(*os.File)
+	if !ok {
+		return f.Truncate(size)
+	}
+	err = syscall.Fallocate(int(of.Fd()), 0, 0, size)
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		return f.Truncate(size)
+	}
+	if err != nil {
+		return &os.PathError{Op: "fallocate", Path: of.Name(), Err: err}
+	}
+	return nil
+}
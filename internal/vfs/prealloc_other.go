@@ -0,0 +1,16 @@
+//go:build !linux
+
+package vfs
+
+// Preallocate 把文件扩展到 size，新增部分读出为 0；非 Linux 平台没有统一的 fallocate，
+// 只扩展文件而不保证分配磁盘空间。语义见 Linux 版本
+func Preallocate(f File, size int64) error {
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if stat.Size() >= size {
+		return nil
+	}
+	return f.Truncate(size)
+}
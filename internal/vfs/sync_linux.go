@@ -0,0 +1,30 @@
+//go:build linux
+
+package vfs
+
+import (
+	"os"
+	"syscall"
+)
+
+// SyncData 持久化 f 中已写入的数据以及读回这些数据所需的元数据（例如文件长度），
+// 跳过修改时间等无关元数据，对应 fdatasync。不是 *os.File 的文件（例如 MemFS）退化为 Sync
+func SyncData(f File) error {
+	of, ok := f.(*os.File)
+	if !ok {
+		return f.Sync()
+	}
+	if err := syscall.Fdatasync(int(of.Fd())); err != nil {
+		return &os.PathError{Op: "fdatasync", Path: of.Name(), Err: err}
+	}
+	return nil
+}
+
+// OpenReadWriteDSync 同 OpenReadWrite，但以 O_DSYNC 方式打开：每次 Write 返回前数据已经持久化
+func (OSFS) OpenReadWriteDSync(name string) (File, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR|syscall.O_DSYNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package vfs
+
+// SyncData 非 Linux 平台没有统一的 fdatasync，退化为 Sync
+func SyncData(f File) error {
+	return f.Sync()
+}
@@ -0,0 +1,133 @@
+// Package vfs 抽象存储引擎用到的所有文件操作，
+// 使 WAL 等组件可以运行在真实磁盘（OSFS）、内存（MemFS）或注入故障的文件系统之上
+package vfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"slices"
+)
+
+// ErrLocked 文件已被其他持有者锁定，见 FS.Lock
+var ErrLocked = errors.New("file is locked")
+
+// File 是一个打开的文件，*os.File 满足该接口
+type File interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	io.Closer
+	// Sync 将已写入的数据持久化
+	Sync() error
+	// Stat 返回文件信息
+	Stat() (os.FileInfo, error)
+	// Truncate 将文件截断（或扩展）到 size 字节
+	Truncate(size int64) error
+}
+
+// FS 是一个文件系统，返回的错误与 os 包保持一致，可以用 errors.Is(err, fs.ErrNotExist) 等判断
+type FS interface {
+	// Create 创建可读写的文件，文件已存在时清空其内容
+	Create(name string) (File, error)
+	// Open 以只读方式打开文件
+	Open(name string) (File, error)
+	// OpenReadWrite 以读写方式打开文件，文件不存在时创建，不会清空已有内容
+	OpenReadWrite(name string) (File, error)
+	// Remove 删除文件或空目录
+	Remove(name string) error
+	// Rename 重命名文件，newname 已存在时被覆盖
+	Rename(oldname, newname string) error
+	// Link 创建指向 oldname 的硬链接 newname，newname 已存在时返回错误
+	Link(oldname, newname string) error
+	// MkdirAll 创建目录及所有不存在的父目录
+	MkdirAll(dir string, perm os.FileMode) error
+	// List 返回目录下所有条目的名称，按字典序排列
+	List(dir string) ([]string, error)
+	// Stat 返回文件或目录的信息
+	Stat(name string) (os.FileInfo, error)
+	// SyncDir 持久化目录本身，保证其中文件的创建、删除与重命名不会在崩溃后丢失
+	SyncDir(dir string) error
+	// Lock 以排他方式锁定文件 name（不存在时创建），关闭返回的 io.Closer 释放锁。
+	// 锁已被其他持有者持有时（包括同一进程内的其他调用）返回包装了 ErrLocked 的错误
+	Lock(name string) (io.Closer, error)
+}
+
+// DSyncFS 由能以同步写入方式（O_DSYNC）打开文件的文件系统实现，
+// 目前只有 Linux 上的 OSFS；调用方需要在不支持时退化为 Write 之后调用 Sync / SyncData
+type DSyncFS interface {
+	// OpenReadWriteDSync 同 FS.OpenReadWrite，但每次 Write 返回前数据已经持久化
+	OpenReadWriteDSync(name string) (File, error)
+}
+
+// OSFS 是基于 os 包的真实文件系统
+type OSFS struct{}
+
+var _ FS = OSFS{}
+
+func (OSFS) Create(name string) (File, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (OSFS) Open(name string) (File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (OSFS) OpenReadWrite(name string) (File, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (OSFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFS) Rename(oldname, newname string) error {
+	return os.Rename(oldname, newname)
+}
+
+func (OSFS) Link(oldname, newname string) error {
+	return os.Link(oldname, newname)
+}
+
+func (OSFS) MkdirAll(dir string, perm os.FileMode) error {
+	return os.MkdirAll(dir, perm)
+}
+
+func (OSFS) List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	// os.ReadDir 已按文件名排序，这里再保证一次以免依赖实现细节
+	slices.Sort(names)
+	return names, nil
+}
+
+func (OSFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFS) SyncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
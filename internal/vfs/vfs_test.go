@@ -0,0 +1,247 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// 对 OSFS 与 MemFS 运行同一组用例，保证两者行为一致
+func TestFS(t *testing.T) {
+	impls := []struct {
+		name string
+		fs   FS
+		root func(t *testing.T) string
+	}{
+		{name: "OSFS", fs: OSFS{}, root: func(t *testing.T) string { return t.TempDir() }},
+		{name: "MemFS", fs: NewMemFS(), root: func(t *testing.T) string { return "/data" }},
+	}
+
+	for _, impl := range impls {
+		t.Run(impl.name, func(t *testing.T) {
+			fsys, root := impl.fs, impl.root(t)
+			dir := filepath.Join(root, "wal")
+			if err := fsys.MkdirAll(dir, 0755); err != nil {
+				t.Fatalf("创建目录失败: %v", err)
+			}
+			path := filepath.Join(dir, "000001.wal")
+
+			tests := []struct {
+				name string
+				run  func(t *testing.T)
+			}{
+				{name: "打开不存在的文件", run: func(t *testing.T) {
+					if _, err := fsys.Open(path); !errors.Is(err, fs.ErrNotExist) {
+						t.Fatalf("期望 ErrNotExist, 实际 %v", err)
+					}
+				}},
+				{name: "写入后读取", run: func(t *testing.T) {
+					f, err := fsys.OpenReadWrite(path)
+					if err != nil {
+						t.Fatalf("打开失败: %v", err)
+					}
+					defer f.Close()
+					if _, err := f.Write([]byte("hello world")); err != nil {
+						t.Fatalf("写入失败: %v", err)
+					}
+					if err := f.Sync(); err != nil {
+						t.Fatalf("同步失败: %v", err)
+					}
+					if err := SyncData(f); err != nil {
+						t.Fatalf("同步数据失败: %v", err)
+					}
+
+					r, err := fsys.Open(path)
+					if err != nil {
+						t.Fatalf("打开失败: %v", err)
+					}
+					defer r.Close()
+					if _, err := r.Seek(6, io.SeekStart); err != nil {
+						t.Fatalf("定位失败: %v", err)
+					}
+					got, err := io.ReadAll(r)
+					if err != nil || string(got) != "world" {
+						t.Fatalf("期望 world, 实际 %q %v", got, err)
+					}
+					if _, err := r.Write([]byte("x")); err == nil {
+						t.Fatal("只读文件不应允许写入")
+					}
+				}},
+				{name: "重新打开不清空并截断", run: func(t *testing.T) {
+					f, err := fsys.OpenReadWrite(path)
+					if err != nil {
+						t.Fatalf("打开失败: %v", err)
+					}
+					defer f.Close()
+					if err := f.Truncate(5); err != nil {
+						t.Fatalf("截断失败: %v", err)
+					}
+					if _, err := f.Seek(0, io.SeekEnd); err != nil {
+						t.Fatalf("定位失败: %v", err)
+					}
+					if _, err := f.Write([]byte("!")); err != nil {
+						t.Fatalf("写入失败: %v", err)
+					}
+					info, err := f.Stat()
+					if err != nil || info.Size() != 6 {
+						t.Fatalf("期望大小 6, 实际 %v %v", info, err)
+					}
+				}},
+				{name: "列出与重命名", run: func(t *testing.T) {
+					if err := fsys.Rename(path, filepath.Join(dir, "000002.wal")); err != nil {
+						t.Fatalf("重命名失败: %v", err)
+					}
+					f, err := fsys.Create(filepath.Join(dir, "000001.wal"))
+					if err != nil {
+						t.Fatalf("创建失败: %v", err)
+					}
+					f.Close()
+					if err := fsys.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+						t.Fatalf("创建目录失败: %v", err)
+					}
+					if err := fsys.SyncDir(dir); err != nil {
+						t.Fatalf("同步目录失败: %v", err)
+					}
+
+					names, err := fsys.List(dir)
+					if want := []string{"000001.wal", "000002.wal", "sub"}; err != nil || !slices.Equal(names, want) {
+						t.Fatalf("期望 %v, 实际 %v %v", want, names, err)
+					}
+					info, err := fsys.Stat(filepath.Join(dir, "000002.wal"))
+					if err != nil || info.Size() != 6 || info.IsDir() {
+						t.Fatalf("重命名后的文件信息不正确: %v %v", info, err)
+					}
+					if info, err := fsys.Stat(filepath.Join(dir, "sub")); err != nil || !info.IsDir() {
+						t.Fatalf("期望 sub 为目录: %v %v", info, err)
+					}
+				}},
+				{name: "硬链接", run: func(t *testing.T) {
+					src, linked := filepath.Join(dir, "000002.wal"), filepath.Join(dir, "linked.wal")
+					if err := fsys.Link(src, linked); err != nil {
+						t.Fatalf("创建硬链接失败: %v", err)
+					}
+					if err := fsys.Link(src, linked); !errors.Is(err, fs.ErrExist) {
+						t.Fatalf("期望 ErrExist, 实际 %v", err)
+					}
+					if err := fsys.Link(filepath.Join(dir, "missing"), filepath.Join(dir, "x")); !errors.Is(err, fs.ErrNotExist) {
+						t.Fatalf("期望 ErrNotExist, 实际 %v", err)
+					}
+					if err := fsys.Remove(src); err != nil {
+						t.Fatalf("删除失败: %v", err)
+					}
+					// 删除原名称不影响硬链接的内容
+					r, err := fsys.Open(linked)
+					if err != nil {
+						t.Fatalf("打开失败: %v", err)
+					}
+					got, err := io.ReadAll(r)
+					r.Close()
+					if err != nil || len(got) != 6 {
+						t.Fatalf("期望 6 字节, 实际 %q %v", got, err)
+					}
+					if err := fsys.Rename(linked, src); err != nil {
+						t.Fatalf("重命名失败: %v", err)
+					}
+				}},
+				{name: "删除", run: func(t *testing.T) {
+					if err := fsys.Remove(dir); err == nil {
+						t.Fatal("非空目录不应被删除")
+					}
+					for _, name := range []string{"000001.wal", "000002.wal", "sub"} {
+						if err := fsys.Remove(filepath.Join(dir, name)); err != nil {
+							t.Fatalf("删除 %s 失败: %v", name, err)
+						}
+					}
+					if err := fsys.Remove(path); !errors.Is(err, fs.ErrNotExist) {
+						t.Fatalf("期望 ErrNotExist, 实际 %v", err)
+					}
+					names, err := fsys.List(dir)
+					if err != nil || len(names) != 0 {
+						t.Fatalf("期望空目录, 实际 %v %v", names, err)
+					}
+				}},
+			}
+
+			// 用例之间共享文件状态，必须按顺序执行
+			for _, tt := range tests {
+				t.Run(tt.name, tt.run)
+			}
+		})
+	}
+}
+
+// 测试截断后再扩展写入时，空洞以 0 填充而不是残留旧数据
+func TestMemFS_WriteAfterTruncate(t *testing.T) {
+	fsys := NewMemFS()
+	f, err := fsys.Create("a")
+	if err != nil {
+		t.Fatalf("创建失败: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write([]byte("abcdef")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if err := f.Truncate(2); err != nil {
+		t.Fatalf("截断失败: %v", err)
+	}
+	if _, err := f.Seek(4, io.SeekStart); err != nil {
+		t.Fatalf("定位失败: %v", err)
+	}
+	if _, err := f.Write([]byte("x")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("定位失败: %v", err)
+	}
+	got, _ := io.ReadAll(f)
+	if want := "ab\x00\x00x"; string(got) != want {
+		t.Fatalf("期望 %q, 实际 %q", want, got)
+	}
+}
+
+// 测试锁的互斥与释放，同一进程内的重复加锁同样会失败
+func TestFS_Lock(t *testing.T) {
+	impls := []struct {
+		name string
+		fs   FS
+		root func(t *testing.T) string
+	}{
+		{name: "OSFS", fs: OSFS{}, root: func(t *testing.T) string { return t.TempDir() }},
+		{name: "MemFS", fs: NewMemFS(), root: func(t *testing.T) string { return "/" }},
+	}
+
+	for _, impl := range impls {
+		t.Run(impl.name, func(t *testing.T) {
+			fsys := impl.fs
+			name := filepath.Join(impl.root(t), "LOCK")
+
+			l, err := fsys.Lock(name)
+			if err != nil {
+				t.Fatalf("加锁失败: %v", err)
+			}
+			if _, err := fsys.Lock(name); !errors.Is(err, ErrLocked) {
+				t.Fatalf("期望 ErrLocked, 实际 %v", err)
+			}
+			if _, err := fsys.Stat(name); err != nil {
+				t.Fatalf("锁文件应存在: %v", err)
+			}
+			if err := l.Close(); err != nil {
+				t.Fatalf("释放锁失败: %v", err)
+			}
+
+			l, err = fsys.Lock(name)
+			if err != nil {
+				t.Fatalf("释放后重新加锁失败: %v", err)
+			}
+			l.Close()
+
+			if _, err := fsys.Lock(filepath.Join(impl.root(t), "missing", "LOCK")); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("期望 ErrNotExist, 实际 %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+	"github.com/aireet/SimpleDBForge/internal/utils"
+)
+
+// Batch 收集一组写入与删除，通过 Client.Write 原子地提交，对应 lsm.WriteBatch
+//
+// Batch 不是并发安全的
+type Batch struct {
+	ops []batchOp
+}
+
+// batchOp 与服务端 /batch 接口的操作格式一致
+type batchOp struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value []byte `json:"value,omitempty"`
+	TTL   string `json:"ttl,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// Set 在批次中追加一次写入
+func (b *Batch) Set(key string, value []byte) {
+	b.ops = append(b.ops, batchOp{Op: "set", Key: key, Value: value})
+}
+
+// SetWithTTL 在批次中追加一次带过期时间的写入，过期时间从服务端应用批次时开始计算
+func (b *Batch) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("batch set %s: %w", key, lsm.ErrInvalidTTL)
+	}
+	b.ops = append(b.ops, batchOp{Op: "set", Key: key, Value: value, TTL: ttl.String()})
+	return nil
+}
+
+// Delete 在批次中追加一次删除
+func (b *Batch) Delete(key string) {
+	b.ops = append(b.ops, batchOp{Op: "delete", Key: key})
+}
+
+// DeleteRange 在批次中追加一次 [start, end) 的范围删除，start 不小于 end 时不做任何事
+func (b *Batch) DeleteRange(start, end string) {
+	if utils.CompareKey(start, end) >= 0 {
+		return
+	}
+	b.ops = append(b.ops, batchOp{Op: "delete_range", Key: start, End: end})
+}
+
+// Len 返回批次中的操作数
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Reset 清空批次以便复用
+func (b *Batch) Reset() {
+	b.ops = b.ops[:0]
+}
@@ -0,0 +1,383 @@
+// Package client 是 sdbf-server HTTP 网关的 Go 客户端
+//
+// Client 的方法与嵌入式的 lsm.DB 保持相同的形状（Get/Set/SetWithTTL/Delete/DeleteRange/Scan/ScanPage/Write），
+// 只是多了 context 参数，错误同样可以用 errors.Is 与 lsm.ErrNotFound 等比较，
+// 便于同一份代码在嵌入式与远程模式之间切换：
+//
+//	c := client.New("localhost:8080", client.Options{})
+//	defer c.Close()
+//	if err := c.Set(ctx, "k", []byte("v")); err != nil { ... }
+//	v, err := c.Get(ctx, "k")
+//
+// 连接由内部的 http.Transport 复用（Options.MaxConns 控制每个服务端保持的空闲连接数）；
+// 网络错误与 502/503/504 按指数退避重试，所有操作都是幂等的，重试不会改变最终结果
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+)
+
+// Options 客户端配置，零值字段使用默认值
+type Options struct {
+	// HTTPClient 自定义的 HTTP 客户端，为 nil 时使用内部创建的连接池，MaxConns 与 TLS 只对内部连接池生效
+	HTTPClient *http.Client
+	// TLS 连接 https:// 地址时使用的配置，例如服务端 CA 与双向 TLS 的客户端证书
+	TLS *tls.Config
+	// Token 服务端启用认证时使用的 token，以 "Authorization: Bearer" 发送
+	Token string
+	// MaxConns 每个服务端保持的最大空闲连接数，默认 16
+	MaxConns int
+	// MaxRetries 失败后的最大重试次数，默认 3，小于 0 表示不重试
+	MaxRetries int
+	// RetryBackoff 第一次重试前的等待时间，之后每次翻倍并加入随机抖动，默认 50ms
+	RetryBackoff time.Duration
+	// MaxRetryBackoff 两次重试之间的最长等待时间，默认 2s
+	MaxRetryBackoff time.Duration
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxConns <= 0 {
+		o.MaxConns = 16
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = 3
+	}
+	if o.RetryBackoff <= 0 {
+		o.RetryBackoff = 50 * time.Millisecond
+	}
+	if o.MaxRetryBackoff <= 0 {
+		o.MaxRetryBackoff = 2 * time.Second
+	}
+	return o
+}
+
+// ServerError 服务端返回的、没有对应 lsm 错误的非 2xx 响应
+type ServerError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server returned %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Client 是并发安全的，应当在多个 goroutine 之间共享
+type Client struct {
+	base   string
+	opts   Options
+	client *http.Client
+	// transport 内部创建的连接池，使用 Options.HTTPClient 时为 nil
+	transport *http.Transport
+}
+
+// New 创建连接 addr（host:port 或完整的 http(s):// 地址）的客户端，不会立即建立连接
+func New(addr string, opts Options) *Client {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	opts = opts.withDefaults()
+	c := &Client{base: strings.TrimRight(addr, "/"), opts: opts, client: opts.HTTPClient}
+	if c.client == nil {
+		c.transport = http.DefaultTransport.(*http.Transport).Clone()
+		c.transport.MaxIdleConnsPerHost = opts.MaxConns
+		c.transport.TLSClientConfig = opts.TLS
+		c.client = &http.Client{Transport: c.transport}
+	}
+	return c
+}
+
+// Close 关闭内部连接池中的空闲连接
+func (c *Client) Close() error {
+	if c.transport != nil {
+		c.transport.CloseIdleConnections()
+	}
+	return nil
+}
+
+// Get 返回 key 对应的值，不存在时返回 lsm.ErrNotFound
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	err := c.do(ctx, http.MethodGet, c.kvPath(key), nil, func(resp *http.Response) error {
+		var err error
+		value, err = io.ReadAll(resp.Body)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get %s: %w", key, err)
+	}
+	return value, nil
+}
+
+// Set 写入或覆盖一个键值对
+func (c *Client) Set(ctx context.Context, key string, value []byte) error {
+	if err := c.do(ctx, http.MethodPut, c.kvPath(key), value, nil); err != nil {
+		return fmt.Errorf("set %s: %w", key, err)
+	}
+	return nil
+}
+
+// SetWithTTL 写入一个键值对，ttl 之后该 key 视为不存在
+func (c *Client) SetWithTTL(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("set %s: %w", key, lsm.ErrInvalidTTL)
+	}
+	path := c.kvPath(key) + "?" + url.Values{"ttl": {ttl.String()}}.Encode()
+	if err := c.do(ctx, http.MethodPut, path, value, nil); err != nil {
+		return fmt.Errorf("set %s: %w", key, err)
+	}
+	return nil
+}
+
+// Delete 删除 key
+func (c *Client) Delete(ctx context.Context, key string) error {
+	if err := c.do(ctx, http.MethodDelete, c.kvPath(key), nil, nil); err != nil {
+		return fmt.Errorf("delete %s: %w", key, err)
+	}
+	return nil
+}
+
+// DeleteRange 删除 [start, end) 区间内的所有 key，见 lsm.DB.DeleteRange
+func (c *Client) DeleteRange(ctx context.Context, start, end string) error {
+	b := NewBatch()
+	b.DeleteRange(start, end)
+	if err := c.Write(ctx, b); err != nil {
+		return fmt.Errorf("delete range [%s, %s): %w", start, end, err)
+	}
+	return nil
+}
+
+// Scan 返回 [start, end] 区间内所有未被删除的条目，按 key 有序；与 lsm.DB.Scan 不同，end 为空表示不设上界
+//
+// 内部按页读取（见 ScanPage），单个响应的大小有上限，但结果仍全部保存在内存中
+func (c *Client) Scan(ctx context.Context, start, end string) ([]*sdbf.Entry, error) {
+	var entries []*sdbf.Entry
+	for {
+		page, next, err := c.ScanPage(ctx, start, end, scanPageSize)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, page...)
+		if next == "" {
+			return entries, nil
+		}
+		start = next
+	}
+}
+
+// scanPageSize Scan 每页读取的条目数
+const scanPageSize = 1000
+
+// ScanPage 返回 [start, end] 区间内最多 limit 条条目（limit <= 0 表示不限制）以及下一页的游标，
+// 见 lsm.DB.ScanPage；end 为空表示不设上界
+func (c *Client) ScanPage(ctx context.Context, start, end string, limit int) (entries []*sdbf.Entry, next string, err error) {
+	return c.ScanPageWithFilter(ctx, start, end, limit, ScanFilter{})
+}
+
+// ScanFilter 是服务端在扫描时应用的过滤条件，被过滤掉的条目不会通过网络传输；
+// 为空的字段不参与过滤，非空的字段都要满足
+type ScanFilter struct {
+	KeyContains   string
+	ValuePrefix   string
+	ValueContains string
+	// Where 是服务端的过滤表达式，例如 has_prefix(key, "user/") && int(value) >= 18，语法见服务端的 expr 包
+	Where string
+}
+
+// ScanPageWithFilter 与 ScanPage 相同，只返回满足 f 的条目，limit 计算的是满足条件的条目数
+func (c *Client) ScanPageWithFilter(ctx context.Context, start, end string, limit int, f ScanFilter) (entries []*sdbf.Entry, next string, err error) {
+	q := url.Values{"start": {start}, "end": {end}}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	for name, v := range map[string]string{"key_contains": f.KeyContains, "value_prefix": f.ValuePrefix, "value_contains": f.ValueContains, "where": f.Where} {
+		if v != "" {
+			q.Set(name, v)
+		}
+	}
+	err = c.do(ctx, http.MethodGet, "/scan?"+q.Encode(), nil, func(resp *http.Response) error {
+		var body struct {
+			Entries []struct {
+				Key     string `json:"key"`
+				Value   []byte `json:"value"`
+				Version int64  `json:"version"`
+			} `json:"entries"`
+			Next string `json:"next"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+		entries = make([]*sdbf.Entry, len(body.Entries))
+		for i, e := range body.Entries {
+			entries[i] = &sdbf.Entry{Key: e.Key, Value: e.Value, Version: e.Version}
+		}
+		next = body.Next
+		return nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("scan [%s, %s]: %w", start, end, err)
+	}
+	return entries, next, nil
+}
+
+// Write 原子地提交一个批次
+func (c *Client) Write(ctx context.Context, b *Batch) error {
+	if b.Len() == 0 {
+		return nil
+	}
+	body, err := json.Marshal(struct {
+		Ops []batchOp `json:"ops"`
+	}{b.ops})
+	if err != nil {
+		return fmt.Errorf("write batch: %w", err)
+	}
+	if err := c.do(ctx, http.MethodPost, "/batch", body, nil); err != nil {
+		return fmt.Errorf("write batch: %w", err)
+	}
+	return nil
+}
+
+// Stats 返回服务端数据库的统计信息
+func (c *Client) Stats(ctx context.Context) (lsm.Stats, error) {
+	var stats lsm.Stats
+	err := c.do(ctx, http.MethodGet, "/stats", nil, func(resp *http.Response) error {
+		return json.NewDecoder(resp.Body).Decode(&stats)
+	})
+	if err != nil {
+		return lsm.Stats{}, fmt.Errorf("stats: %w", err)
+	}
+	return stats, nil
+}
+
+// GetProperty 返回服务端数据库名为 name 的属性（见 lsm.PropNumEntriesActiveMemTable 等），
+// 不存在时返回 lsm.ErrUnknownProperty
+func (c *Client) GetProperty(ctx context.Context, name string) (string, error) {
+	var value string
+	err := c.do(ctx, http.MethodGet, "/property/"+url.PathEscape(name), nil, func(resp *http.Response) error {
+		b, err := io.ReadAll(resp.Body)
+		value = string(b)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, lsm.ErrNotFound) {
+			err = lsm.ErrUnknownProperty
+		}
+		return "", fmt.Errorf("get property %q: %w", name, err)
+	}
+	return value, nil
+}
+
+// Health 检查服务端数据库是否健康（见 lsm.DB.Health），不健康时返回状态码 503 的 ServerError
+//
+// 不健康不属于临时错误，不会重试
+func (c *Client) Health(ctx context.Context) error {
+	if err := c.attempt(ctx, http.MethodGet, "/health", nil, nil); err != nil {
+		return fmt.Errorf("health: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) kvPath(key string) string {
+	// 保留 key 中的 '/'，网关的路由允许 key 包含斜杠
+	return "/kv/" + (&url.URL{Path: key}).EscapedPath()
+}
+
+// do 发送请求并在可重试的失败时按退避重试，2xx 响应交给 read 处理（可以为 nil）
+func (c *Client) do(ctx context.Context, method, path string, body []byte, read func(*http.Response) error) error {
+	backoff := c.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := c.attempt(ctx, method, path, body, read)
+		if err == nil || !retryable(err) || attempt >= c.opts.MaxRetries {
+			return err
+		}
+		// 全抖动：在 [backoff/2, backoff) 内随机等待，避免大量客户端同时重试
+		wait := backoff/2 + rand.N(backoff/2+1)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (last error: %w)", ctx.Err(), err)
+		case <-time.After(wait):
+		}
+		backoff = min(2*backoff, c.opts.MaxRetryBackoff)
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, method, path string, body []byte, read func(*http.Response) error) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, r)
+	if err != nil {
+		return err
+	}
+	if c.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := responseError(resp); err != nil {
+		return err
+	}
+	if read == nil {
+		return nil
+	}
+	return read(resp)
+}
+
+// responseError 把非 2xx 的响应转换为错误，能对应到 lsm 错误的状态码包装对应的错误
+func responseError(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&body)
+
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return lsm.ErrNotFound
+	case http.StatusRequestEntityTooLarge:
+		// 服务端的错误信息里保留了具体是 key、value 还是批次超限
+		for _, target := range []error{lsm.ErrKeyTooLarge, lsm.ErrValueTooLarge, lsm.ErrBatchTooLarge} {
+			if strings.Contains(body.Error, target.Error()) {
+				return fmt.Errorf("%w: %s", target, body.Error)
+			}
+		}
+	}
+	return &ServerError{StatusCode: resp.StatusCode, Message: body.Error}
+}
+
+// retryable 判断失败是否可以重试：网络错误与网关、服务不可用类的响应，context 取消与超时除外
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var se *ServerError
+	if errors.As(err, &se) {
+		switch se.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var ue *url.Error
+	return errors.As(err, &ue)
+}
@@ -0,0 +1,219 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+	"github.com/aireet/SimpleDBForge/internal/lsm"
+	"github.com/aireet/SimpleDBForge/internal/server"
+)
+
+// startServer 启动一个基于内存数据库的 HTTP 网关，wrap 不为 nil 时用它包装路由
+func startServer(t *testing.T, wrap func(http.Handler) http.Handler) (*Client, *lsm.DB) {
+	t.Helper()
+	opts := lsm.DefaultOptions()
+	opts.MaxValueSize = 1 << 10
+	db, err := lsm.Open(lsm.InMemory, opts)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	h := server.NewHTTPServer(db).Handler()
+	if wrap != nil {
+		h = wrap(h)
+	}
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	c := New(ts.URL, Options{RetryBackoff: time.Millisecond})
+	t.Cleanup(func() { c.Close() })
+	return c, db
+}
+
+func TestClient_KV(t *testing.T) {
+	c, _ := startServer(t, nil)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		op      func() error
+		key     string
+		want    string
+		wantErr error
+	}{
+		{name: "写入", op: func() error { return c.Set(ctx, "a", []byte("1")) }, key: "a", want: "1"},
+		{name: "覆盖", op: func() error { return c.Set(ctx, "a", []byte("2")) }, key: "a", want: "2"},
+		{name: "key 包含斜杠", op: func() error { return c.Set(ctx, "user/1", []byte("alice")) }, key: "user/1", want: "alice"},
+		{name: "带 TTL", op: func() error { return c.SetWithTTL(ctx, "t", []byte("v"), time.Hour) }, key: "t", want: "v"},
+		{name: "删除", op: func() error { return c.Delete(ctx, "a") }, key: "a", wantErr: lsm.ErrNotFound},
+		{name: "不存在", op: func() error { return nil }, key: "missing", wantErr: lsm.ErrNotFound},
+		{name: "非法 TTL", op: func() error { return c.SetWithTTL(ctx, "t", nil, 0) }, wantErr: lsm.ErrInvalidTTL},
+		{name: "value 过长", op: func() error { return c.Set(ctx, "big", make([]byte, 2<<10)) }, wantErr: lsm.ErrValueTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.op()
+			if tt.key == "" {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望 %v, 实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("操作失败: %v", err)
+			}
+			got, err := c.Get(ctx, tt.key)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望 %v, 实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil || string(got) != tt.want {
+				t.Fatalf("期望读到 %q, 实际 %q %v", tt.want, got, err)
+			}
+		})
+	}
+}
+
+// 测试批量写入与分页扫描
+func TestClient_BatchScan(t *testing.T) {
+	c, db := startServer(t, nil)
+	ctx := context.Background()
+
+	b := NewBatch()
+	for _, k := range []string{"a", "b", "c", "d", "e", "f"} {
+		b.Set(k, []byte("v-"+k))
+	}
+	b.Delete("b")
+	b.DeleteRange("d", "f")
+	if err := c.Write(ctx, b); err != nil {
+		t.Fatalf("批量写入失败: %v", err)
+	}
+	// 批次作为一个整体提交：每个操作获得一个序列号
+	if seq, err := db.LastSequence(); err != nil || seq != 8 {
+		t.Fatalf("期望序列号 8, 实际 %d %v", seq, err)
+	}
+
+	keys := func(entries []*sdbf.Entry) []string {
+		var out []string
+		for _, e := range entries {
+			out = append(out, e.Key)
+		}
+		return out
+	}
+	all, err := c.Scan(ctx, "", "")
+	if err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	if got := keys(all); !slices.Equal(got, []string{"a", "c", "f"}) {
+		t.Fatalf("期望 [a c f], 实际 %v", got)
+	}
+	if string(all[0].Value) != "v-a" || all[0].Version == 0 {
+		t.Fatalf("条目内容不正确: %v", all[0])
+	}
+
+	page, next, err := c.ScanPage(ctx, "", "", 2)
+	if err != nil || !slices.Equal(keys(page), []string{"a", "c"}) || next != "f" {
+		t.Fatalf("第一页期望 [a c] next=f, 实际 %v next=%q %v", keys(page), next, err)
+	}
+	page, next, err = c.ScanPage(ctx, next, "", 2)
+	if err != nil || !slices.Equal(keys(page), []string{"f"}) || next != "" {
+		t.Fatalf("第二页期望 [f], 实际 %v next=%q %v", keys(page), next, err)
+	}
+	page, next, err = c.ScanPageWithFilter(ctx, "", "", 1, ScanFilter{ValuePrefix: "v-", KeyContains: "f"})
+	if err != nil || !slices.Equal(keys(page), []string{"f"}) || next != "" {
+		t.Fatalf("过滤后期望 [f], 实际 %v next=%q %v", keys(page), next, err)
+	}
+	page, _, err = c.ScanPageWithFilter(ctx, "", "", 0, ScanFilter{Where: `value != "v-c"`})
+	if err != nil || !slices.Equal(keys(page), []string{"a", "f"}) {
+		t.Fatalf("表达式过滤后期望 [a f], 实际 %v %v", keys(page), err)
+	}
+
+	if err := c.DeleteRange(ctx, "a", "d"); err != nil {
+		t.Fatalf("范围删除失败: %v", err)
+	}
+	stats, err := c.Stats(ctx)
+	if err != nil || stats.LastSequence != 9 {
+		t.Fatalf("统计信息不正确: %+v %v", stats, err)
+	}
+	if v, err := c.GetProperty(ctx, lsm.PropLastSequence); err != nil || v != "9" {
+		t.Fatalf("期望属性值 9, 实际 %q %v", v, err)
+	}
+	if _, err := c.GetProperty(ctx, "nope"); !errors.Is(err, lsm.ErrUnknownProperty) {
+		t.Fatalf("期望 ErrUnknownProperty, 实际 %v", err)
+	}
+	if err := c.Health(ctx); err != nil {
+		t.Fatalf("期望健康, 实际 %v", err)
+	}
+	db.Close()
+	var se *ServerError
+	if err := c.Health(ctx); !errors.As(err, &se) || se.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("关闭后期望 503, 实际 %v", err)
+	}
+}
+
+// 测试网络错误与 503 按退避重试，其他错误不重试
+func TestClient_Retry(t *testing.T) {
+	tests := []struct {
+		name string
+		// failures 前 failures 次请求返回 status
+		failures     int32
+		status       int
+		maxRetries   int
+		wantAttempts int32
+		wantErr      bool
+	}{
+		{name: "重试后成功", failures: 2, status: http.StatusServiceUnavailable, maxRetries: 3, wantAttempts: 3},
+		{name: "重试次数用尽", failures: 10, status: http.StatusServiceUnavailable, maxRetries: 3, wantAttempts: 4, wantErr: true},
+		{name: "不重试", failures: 10, status: http.StatusBadGateway, maxRetries: -1, wantAttempts: 1, wantErr: true},
+		{name: "非临时错误", failures: 1, status: http.StatusBadRequest, maxRetries: 3, wantAttempts: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			c, _ := startServer(t, func(h http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if attempts.Add(1) <= tt.failures {
+						http.Error(w, "unavailable", tt.status)
+						return
+					}
+					h.ServeHTTP(w, r)
+				})
+			})
+			c.opts.MaxRetries = tt.maxRetries
+
+			err := c.Set(context.Background(), "k", []byte("v"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("期望出错 %v, 实际 %v", tt.wantErr, err)
+			}
+			var se *ServerError
+			if tt.wantErr && (!errors.As(err, &se) || se.StatusCode != tt.status) {
+				t.Fatalf("期望状态码 %d 的 ServerError, 实际 %v", tt.status, err)
+			}
+			if got := attempts.Load(); got != tt.wantAttempts {
+				t.Fatalf("期望请求 %d 次, 实际 %d 次", tt.wantAttempts, got)
+			}
+		})
+	}
+
+	// context 取消后立即停止重试
+	c, _ := startServer(t, func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		})
+	})
+	c.opts.RetryBackoff, c.opts.MaxRetries = time.Hour, 3
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Get(ctx, "k"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("期望 DeadlineExceeded, 实际 %v", err)
+	}
+}
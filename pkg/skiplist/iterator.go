@@ -0,0 +1,66 @@
+package skiplist
+
+import "github.com/aireet/SimpleDBForge/api/sdbf"
+
+// Iterator 按 key 顺序（同一个 key 的版本从新到旧）直接在跳表上遍历，不复制条目
+//
+// 迭代器不加锁，可以与写入并发使用：已删除的节点会被跳过，迭代期间插入的节点可能被看到，
+// 也可能看不到。条目在定位到节点时读取一次，Key/Value/Entry 返回的总是同一个条目，
+// 即使该节点随后被覆盖写。需要一致视图的调用方应自行按版本号过滤（见 GetVersion）
+//
+//	it := s.NewIterator()
+//	for it.SeekGE(start); it.Valid(); it.Next() {
+//		use(it.Key(), it.Value())
+//	}
+type Iterator struct {
+	list  *SkipList
+	node  *Element
+	entry *sdbf.Entry
+}
+
+// NewIterator 返回一个未定位的迭代器，使用前需调用 SeekGE 或 SeekToFirst
+func (s *SkipList) NewIterator() *Iterator {
+	return &Iterator{list: s}
+}
+
+// SeekGE 定位到第一个 key >= target 的节点
+func (it *Iterator) SeekGE(target string) {
+	it.set(it.list.seek(target))
+}
+
+// SeekToFirst 定位到第一个节点
+func (it *Iterator) SeekToFirst() {
+	it.set(it.list.head.successor())
+}
+
+// Next 移动到下一个节点，调用前 Valid 必须为 true
+func (it *Iterator) Next() {
+	it.set(it.node.successor())
+}
+
+// Valid 当前是否指向一个节点
+func (it *Iterator) Valid() bool {
+	return it.node != nil
+}
+
+// Key 当前节点的 key
+func (it *Iterator) Key() string {
+	return it.node.key
+}
+
+// Value 当前条目的 value
+func (it *Iterator) Value() []byte {
+	return it.entry.Value
+}
+
+// Entry 定位到当前节点时读取的条目
+func (it *Iterator) Entry() *sdbf.Entry {
+	return it.entry
+}
+
+func (it *Iterator) set(node *Element) {
+	it.node, it.entry = node, nil
+	if node != nil {
+		it.entry = node.Entry()
+	}
+}
@@ -0,0 +1,72 @@
+package skiplist
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/aireet/SimpleDBForge/api/sdbf"
+)
+
+func TestIterator(t *testing.T) {
+	sl := NewSkipList(4, 0.5)
+	for i, key := range []string{"b", "d", "d", "f"} {
+		sl.Insert(&sdbf.Entry{Key: key, Value: []byte(fmt.Sprintf("%s%d", key, i)), Version: int64(i + 1)})
+	}
+
+	tests := []struct {
+		name string
+		seek func(it *Iterator)
+		want []string
+	}{
+		{name: "从头开始", seek: func(it *Iterator) { it.SeekToFirst() }, want: []string{"b0", "d2", "d1", "f3"}},
+		{name: "定位到已有key", seek: func(it *Iterator) { it.SeekGE("d") }, want: []string{"d2", "d1", "f3"}},
+		{name: "定位到两个key之间", seek: func(it *Iterator) { it.SeekGE("c") }, want: []string{"d2", "d1", "f3"}},
+		{name: "定位到第一个key之前", seek: func(it *Iterator) { it.SeekGE("a") }, want: []string{"b0", "d2", "d1", "f3"}},
+		{name: "定位到最后一个key之后", seek: func(it *Iterator) { it.SeekGE("g") }, want: nil},
+		{name: "未定位", seek: func(it *Iterator) {}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := sl.NewIterator()
+			var got []string
+			for tt.seek(it); it.Valid(); it.Next() {
+				if it.Key() != it.Entry().Key || string(it.Value()) != string(it.Entry().Value) {
+					t.Fatalf("Key/Value 与 Entry 不一致: %s %s %v", it.Key(), it.Value(), it.Entry())
+				}
+				got = append(got, string(it.Value()))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("期望 %v, 实际 %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// 测试迭代期间的删除与覆盖写：已删除的节点被跳过，当前位置的条目保持不变
+func TestIterator_ConcurrentModification(t *testing.T) {
+	sl := NewSkipList(4, 0.5)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		sl.Set(&sdbf.Entry{Key: key, Value: []byte("v1")})
+	}
+
+	it := sl.NewIterator()
+	it.SeekGE("b")
+	sl.Set(&sdbf.Entry{Key: "b", Value: []byte("v2")})
+	if string(it.Value()) != "v1" {
+		t.Fatalf("定位后的条目不应随覆盖写改变, 实际 %s", it.Value())
+	}
+
+	// 删除当前节点与下一个节点后，Next 越过它们
+	sl.Delete("b")
+	sl.Delete("c")
+	it.Next()
+	if !it.Valid() || it.Key() != "d" {
+		t.Fatalf("期望跳到 d, 实际 valid=%v", it.Valid())
+	}
+	it.Next()
+	if it.Valid() {
+		t.Fatalf("期望遍历结束, 实际指向 %s", it.Key())
+	}
+}
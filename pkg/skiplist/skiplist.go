@@ -1,17 +1,125 @@
 package skiplist
 
 import (
-	"math/rand"
-	"time"
+	"math/rand/v2"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/aireet/SimpleDBForge/api/sdbf"
 	"github.com/aireet/SimpleDBForge/internal/utils"
 )
 
+// Element 是跳表中的一个节点
+//
+// key 在节点创建后不再改变；entry 与 next 通过原子指针读写，
+// 读操作无需加锁即可与写操作并发执行
 type Element struct {
-	*sdbf.Entry
-	next []*Element
+	key   string
+	entry atomic.Pointer[sdbf.Entry]
+	next  []atomic.Pointer[Element]
+	// marker 为 true 时是删除标记：节点被删除时，它每一层的 next 都被替换为一个指向原后继的
+	// 标记节点，此后该层的 next 不再改变，任何试图链接到它之后的 CAS 都会失败
+	marker bool
+}
+
+// newElement 创建一个 level 层的节点
+//
+// 大多数节点只有很少的层（p = 0.5 时约 94% 不超过 4 层），这些节点与它们的 next 数组
+// 在一次分配中创建：next 指向同一个对象内的数组，节点指针会让整个对象保持存活
+func newElement(entry *sdbf.Entry, level int) *Element {
+	var e *Element
+	switch level {
+	case 1:
+		n := new(struct {
+			Element
+			links [1]atomic.Pointer[Element]
+		})
+		n.next, e = n.links[:], &n.Element
+	case 2:
+		n := new(struct {
+			Element
+			links [2]atomic.Pointer[Element]
+		})
+		n.next, e = n.links[:], &n.Element
+	case 3:
+		n := new(struct {
+			Element
+			links [3]atomic.Pointer[Element]
+		})
+		n.next, e = n.links[:], &n.Element
+	case 4:
+		n := new(struct {
+			Element
+			links [4]atomic.Pointer[Element]
+		})
+		n.next, e = n.links[:], &n.Element
+	default:
+		e = &Element{next: make([]atomic.Pointer[Element], level)}
+	}
+	e.key = entry.Key
+	e.entry.Store(entry)
+	return e
+}
+
+// newMarker 返回指向 succ 的删除标记
+func newMarker(succ *Element) *Element {
+	m := &Element{marker: true, next: make([]atomic.Pointer[Element], 1)}
+	m.next[0].Store(succ)
+	return m
+}
+
+// Entry 返回节点当前的条目
+func (e *Element) Entry() *sdbf.Entry {
+	return e.entry.Load()
+}
+
+// loadNext 返回节点在第 i 层的后继，marked 表示节点在该层已被标记删除
+func (e *Element) loadNext(i int) (next *Element, marked bool) {
+	next = e.next[i].Load()
+	if next != nil && next.marker {
+		return next.next[0].Load(), true
+	}
+	return next, false
+}
+
+// deleted 返回节点是否已被删除：第 0 层被标记即逻辑删除，读操作不再返回它
+func (e *Element) deleted() bool {
+	_, marked := e.loadNext(0)
+	return marked
+}
+
+// successor 返回第 0 层之后第一个未被删除的节点
+func (e *Element) successor() *Element {
+	next, _ := e.loadNext(0)
+	for next != nil && next.deleted() {
+		next, _ = next.loadNext(0)
+	}
+	return next
+}
+
+// mark 在第 i 层标记节点，返回标记是否由本次调用完成
+func (e *Element) mark(i int) bool {
+	for {
+		next := e.next[i].Load()
+		if next != nil && next.marker {
+			return false
+		}
+		if e.next[i].CompareAndSwap(next, newMarker(next)) {
+			return true
+		}
+	}
+}
+
+var (
+	// elementStructSize 节点结构体本身的大小，linkSize 为每一层 next 指针的大小
+	elementStructSize = int64(unsafe.Sizeof(Element{}))
+	linkSize          = int64(unsafe.Sizeof(atomic.Pointer[Element]{}))
+)
+
+// elementSize 估算节点占用的内存：节点结构体、每层的 next 指针以及条目本身（见 utils.EntrySize）。
+// 节点的 key 与条目的 Key 共用同一份数据，只计算一次
+func elementSize(entry *sdbf.Entry, level int) int64 {
+	return elementStructSize + int64(level)*linkSize + utils.EntrySize(entry)
 }
 
 // SkipList
@@ -25,33 +133,44 @@ type Element struct {
 // - HEAD.next[0] = 3, HEAD.next[1] = 3, HEAD.next[2] = 3
 // - 节点3.next[0] = 6, 节点3.next[1] = 6, 节点3.next[2] = 9
 // - 节点6.next[0] = 7, 节点6.next[1] = 9
+//
+// 并发安全：所有方法都可以被多个协程并发调用，读操作不加锁、不会被写操作阻塞
+//   - 插入新节点时先填好新节点的 next，再用 CAS 把它挂到前驱节点上，
+//     CAS 失败说明前驱在此期间被其他写入者修改，重新定位后重试
+//   - 自底向上逐层链接，第 0 层链接成功即对读可见，上层只是加速查找的索引，
+//     读操作在上层暂时看不到新节点不影响正确性
+//   - 覆盖写通过原子替换节点的 entry 指针完成，读操作看到的要么是旧条目，要么是新条目
+//   - 删除先自顶向下把节点每一层的 next 替换为删除标记（第 0 层标记成功即逻辑删除），
+//     再由之后经过它的搜索用 CAS 从各层摘除；读操作跳过已标记的节点，
+//     持有的已删除节点指针仍然有效，沿着标记可以回到链表中
+//   - 节点只会被 Delete 与 DropShadowed 移除，不与它们并发执行时读到的节点始终在链表中
+//   - GetSize 是内存占用的估算值，覆盖写与删除同一个节点并发时可能略有偏差
+//
+// 跨多个 key 的写入（例如一个批次）对无锁读不是原子可见的，需要由调用方通过
+// 版本号等方式保证一致的视图
 type SkipList struct {
 	maxLevel int
 	p        float32
-	level    int
-	rand     *rand.Rand
-	size     int
-	count    int64
-	head     *Element
+	// level 当前最高的层级，只增不减
+	level atomic.Int32
+	size  atomic.Int64
+	count atomic.Int64
+	head  *Element
 }
 
 func NewSkipList(maxLevel int, p float64) *SkipList {
-	return &SkipList{
+	s := &SkipList{
 		maxLevel: maxLevel,
 		p:        float32(p),
-		level:    1,
-		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
-		size:     0,
-		head: &Element{
-			Entry: &sdbf.Entry{
-				Key:       "HEAD",
-				Value:     nil,
-				Tombstone: false,
-				Version:   0,
-			},
-			next: make([]*Element, maxLevel),
-		},
+		head: newElement(&sdbf.Entry{
+			Key:       "HEAD",
+			Value:     nil,
+			Tombstone: false,
+			Version:   0,
+		}, maxLevel),
 	}
+	s.level.Store(1)
+	return s
 }
 
 // randomLevel 生成跳表节点的随机层级
@@ -78,7 +197,8 @@ func NewSkipList(maxLevel int, p float64) *SkipList {
 // - 12.5% 概率： level = 4 （节点出现在所有层）
 func (s *SkipList) randomLevel() int {
 	level := 1
-	for level < s.maxLevel && s.rand.Float32() < s.p {
+	// math/rand/v2 的全局函数可以安全地被并发调用
+	for level < s.maxLevel && rand.Float32() < s.p {
 		level++
 	}
 	return level
@@ -88,8 +208,14 @@ func (s *SkipList) Reset() *SkipList {
 	return NewSkipList(s.maxLevel, float64(s.p))
 }
 
+// GetSize 返回跳表估算的内存占用（字节），包含节点与条目的结构体开销，见 elementSize
 func (s *SkipList) GetSize() int {
-	return s.size
+	return int(s.size.Load())
+}
+
+// Len 返回跳表中的节点数，同一个 key 保留的多个版本各算一个
+func (s *SkipList) Len() int {
+	return int(s.count.Load())
 }
 
 // Set 在跳表中插入或更新一个条目
@@ -113,97 +239,261 @@ func (s *SkipList) GetSize() int {
 //
 // 时间复杂度：O(log n)
 func (s *SkipList) Set(entry *sdbf.Entry) {
-	// 从顶层开始搜索，记录每层需要更新的前置节点
-	curr := s.head
-	update := make([]*Element, s.maxLevel)
+	s.insert(entry, true)
+}
 
-	// 从最高层往下搜索，记录路径上每层的最后节点
-	for i := s.maxLevel - 1; i >= 0; i-- {
-		// 在当前层向右移动，直到找到插入位置
-		for curr.next[i] != nil && utils.CompareKey(curr.next[i].Key, entry.Key) < 0 {
-			curr = curr.next[i]
-		}
-		update[i] = curr
-	}
+// Insert 插入一个新版本而不覆盖同 key 的已有版本，用于 MVCC
+//
+// 同一个 key 的多个版本按插入顺序从新到旧排列，新版本总是排在最前面，
+// 因此调用方必须保证 entry.Version 不小于已有版本。Get 返回最新版本，
+// GetVersion 返回不超过指定版本的最新版本，Scan/All 会返回所有版本。
+func (s *SkipList) Insert(entry *sdbf.Entry) {
+	s.insert(entry, false)
+}
 
-	// 检查key是否已存在，如果存在则更新
-	if curr.next[0] != nil && utils.CompareKey(curr.next[0].Key, entry.Key) == 0 {
-		// 更新现有条目，调整内存统计
-		s.size += len(entry.Value) - len(curr.next[0].Value)
-		curr.next[0].Value = entry.Value
-		curr.next[0].Tombstone = entry.Tombstone
-		return
+// spliceStackLevels maxLevel 不超过该值时，findSplice 使用的 preds 与 succs 分配在调用方的栈上
+const spliceStackLevels = 32
+
+// spliceBuffers 把 buf 切分为 findSplice 使用的 preds 与 succs，buf 不够大时重新分配
+func (s *SkipList) spliceBuffers(buf []*Element) (preds, succs []*Element) {
+	if len(buf) < 2*s.maxLevel {
+		buf = make([]*Element, 2*s.maxLevel)
 	}
+	return buf[:s.maxLevel:s.maxLevel], buf[s.maxLevel : 2*s.maxLevel]
+}
+
+// insert 插入新节点，overwrite 为 true 且 key 已存在时改为覆盖最新版本
+func (s *SkipList) insert(entry *sdbf.Entry, overwrite bool) {
+	var buf [2 * spliceStackLevels]*Element
+	preds, succs := s.spliceBuffers(buf[:])
 
-	// 插入新条目
-	// 随机生成节点层级（决定这个节点在几层"立交桥"上可见）
-	level := s.randomLevel()
+	var e *Element
+	for {
+		s.findSplice(entry.Key, nil, preds, succs)
 
-	// 如果生成的层级超过了当前跳表的最大层级，需要扩展
-	if level > s.level {
-		// 新的层级需要更新所有层的头节点
-		for i := s.level; i < level; i++ {
-			update[i] = s.head
+		// 检查key是否已存在，如果存在则更新
+		if curr := succs[0]; overwrite && curr != nil && utils.CompareKey(curr.key, entry.Key) == 0 {
+			// 更新现有条目，调整内存统计
+			// 直接替换条目指针而不是原地修改字段，Version 等字段随之更新，
+			// 已被 Get/Scan 返回给调用方的旧条目也不会被改写
+			old := curr.entry.Swap(entry)
+			if curr.deleted() {
+				// 节点在此期间被删除，覆盖写随之丢失，重新定位后插入新节点
+				continue
+			}
+			s.size.Add(utils.EntrySize(entry) - utils.EntrySize(old))
+			return
+		}
+
+		if e == nil {
+			// 随机生成节点层级（决定这个节点在几层"立交桥"上可见）
+			e = newElement(entry, s.randomLevel())
+			s.raiseLevel(len(e.next))
 		}
-		s.level = level
-	}
 
-	// 创建新节点
-	e := &Element{
-		Entry: entry,
-		next:  make([]*Element, level),
+		// 第 0 层链接成功后节点即对读可见
+		e.next[0].Store(succs[0])
+		if preds[0].next[0].CompareAndSwap(succs[0], e) {
+			break
+		}
 	}
 
+	// 更新内存统计信息
+	s.size.Add(elementSize(entry, len(e.next)))
+	s.count.Add(1)
+
 	// 在每一层建立连接关系（像在多层立交桥上建立匝道）
-	for i := range level {
-		e.next[i] = update[i].next[i] // 新节点指向原来的下一个节点
-		update[i].next[i] = e         // 前置节点指向新节点
+	for i := 1; i < len(e.next); i++ {
+		for {
+			next := e.next[i].Load()
+			if next != nil && next.marker {
+				// 新节点在链接上层的过程中被删除，摘除已经链接的层后停止
+				s.findSplice(entry.Key, e, preds, succs)
+				return
+			}
+			// 新节点指向原来的下一个节点，用 CAS 避免覆盖并发写入的删除标记
+			if !e.next[i].CompareAndSwap(next, succs[i]) {
+				continue
+			}
+			if preds[i].next[i].CompareAndSwap(succs[i], e) { // 前置节点指向新节点
+				break
+			}
+			// 前驱在此期间被修改，重新定位
+			s.findSplice(entry.Key, nil, preds, succs)
+		}
 	}
+}
 
-	// 更新内存统计信息
-	s.size += len(entry.Key) + len(entry.Value) +
-		int(unsafe.Sizeof(entry.Tombstone)) +
-		int(unsafe.Sizeof(entry.Version)) +
-		len(e.next)*int(unsafe.Sizeof((*Element)(nil)))
-	s.count++
+// raiseLevel 把当前层级提升到至少 level
+func (s *SkipList) raiseLevel(level int) {
+	for {
+		curr := s.level.Load()
+		if int(curr) >= level || s.level.CompareAndSwap(curr, int32(level)) {
+			return
+		}
+	}
 }
 
-func (s *SkipList) Get(key string) (*sdbf.Entry, bool) {
-	curr := s.head
-	for i := s.maxLevel - 1; i >= 0; i-- {
-		for curr.next[i] != nil && utils.CompareKey(curr.next[i].Key, key) < 0 {
-			curr = curr.next[i]
+// findSplice 从顶层开始搜索，在 preds 中记录每层最后一个 key 小于目标 key 的节点，
+// 在 succs 中记录其后继；target 不为 nil 时还会越过 key 相同但不是 target 的节点，
+// 用于摘除同一个 key 的某个版本
+//
+// 搜索途中会用 CAS 摘除经过的已标记删除的节点，因此 preds 中的节点在返回时都未被标记；
+// 前驱在此期间被标记导致摘除失败时从头重新搜索
+//
+// 这里从 maxLevel 而不是当前层级开始搜索：层级可能在读取之后被并发提升，
+// 如果直接把高层的前驱当作头节点，可能把新节点链接到错误的位置
+func (s *SkipList) findSplice(key string, target *Element, preds, succs []*Element) {
+retry:
+	for {
+		pred := s.head
+		// 从最高层往下搜索，记录路径上每层的最后节点
+		for i := s.maxLevel - 1; i >= 0; i-- {
+			curr, marked := pred.loadNext(i)
+			if marked {
+				continue retry
+			}
+			// 在当前层向右移动，直到找到插入位置
+			for curr != nil {
+				succ, marked := curr.loadNext(i)
+				if marked {
+					if !pred.next[i].CompareAndSwap(curr, succ) {
+						continue retry
+					}
+					curr = succ
+					continue
+				}
+				if c := utils.CompareKey(curr.key, key); c > 0 || (c == 0 && (target == nil || curr == target)) {
+					break
+				}
+				pred, curr = curr, succ
+			}
+			preds[i], succs[i] = pred, curr
+		}
+		return
+	}
+}
+
+// seek 返回第一个 key 不小于目标 key 且未被删除的节点
+//
+// 与 findSplice 不同，这里不修改链表：遇到已标记的节点时直接越过，不会停在它上面向下一层搜索
+func (s *SkipList) seek(key string) *Element {
+	pred := s.head
+	var curr *Element
+	for i := int(s.level.Load()) - 1; i >= 0; i-- {
+		curr, _ = pred.loadNext(i)
+		for curr != nil {
+			succ, marked := curr.loadNext(i)
+			if marked {
+				curr = succ
+				continue
+			}
+			if utils.CompareKey(curr.key, key) >= 0 {
+				break
+			}
+			pred, curr = curr, succ
 		}
 	}
-	curr = curr.next[0]
-	if curr != nil && curr.Key == key {
-		return curr.Entry, true
+	return curr
+}
+
+func (s *SkipList) Get(key string) (*sdbf.Entry, bool) {
+	curr := s.seek(key)
+	if curr != nil && curr.key == key {
+		return curr.Entry(), true
 	}
 	return nil, false
 }
 
-func (s *SkipList) Scan(start, end string) []*sdbf.Entry {
-	curr := s.head
-	for i := s.maxLevel - 1; i >= 0; i-- {
-		for curr.next[i] != nil && utils.CompareKey(curr.next[i].Key, start) < 0 {
-			curr = curr.next[i]
+// GetVersion 返回 key 的版本号不超过 maxVersion 的最新版本
+func (s *SkipList) GetVersion(key string, maxVersion int64) (*sdbf.Entry, bool) {
+	// 同一个 key 的版本从新到旧排列，第一个满足条件的即为所求
+	for curr := s.seek(key); curr != nil && curr.key == key; curr = curr.successor() {
+		if entry := curr.Entry(); entry.Version <= maxVersion {
+			return entry, true
 		}
 	}
-	curr = curr.next[0]
+	return nil, false
+}
+
+func (s *SkipList) Scan(start, end string) []*sdbf.Entry {
 	entries := make([]*sdbf.Entry, 0)
-	for curr != nil && utils.CompareKey(curr.Key, end) <= 0 {
-		entries = append(entries, curr.Entry)
-		curr = curr.next[0]
+	for curr := s.seek(start); curr != nil && utils.CompareKey(curr.key, end) <= 0; curr = curr.successor() {
+		entries = append(entries, curr.Entry())
 	}
 	return entries
 }
 
+// All 按顺序返回所有条目，与并发写入同时进行时可能包含遍历期间新插入的条目
 func (s *SkipList) All() []*sdbf.Entry {
-	all := make([]*sdbf.Entry, s.count)
-	index := 0
-	for curr := s.head.next[0]; curr != nil; curr = curr.next[0] {
-		all[index] = curr.Entry
-		index++
+	all := make([]*sdbf.Entry, 0, s.count.Load())
+	for curr := s.head.successor(); curr != nil; curr = curr.successor() {
+		all = append(all, curr.Entry())
 	}
 	return all
 }
+
+// Delete 删除 key 的所有版本，返回删除的节点数
+//
+// 节点被标记后立即对读不可见，随后从每一层摘除，内存统计随之减少
+func (s *SkipList) Delete(key string) int {
+	removed := 0
+	for {
+		e := s.seek(key)
+		if e == nil || e.key != key {
+			return removed
+		}
+		if s.remove(e) {
+			removed++
+		}
+	}
+}
+
+// DropShadowed 删除对版本号不小于 horizon 的读取都不可见的旧版本，返回删除的节点数
+//
+// 对每个 key，版本号大于 horizon 的版本与不超过 horizon 的最新版本都会保留，更旧的版本
+// 被后者遮蔽，Get 与 GetVersion(key, v) (v >= horizon) 都不会再返回它们。墓碑与其他版本一样处理：
+// 被保留的墓碑仍然表示 key 已删除，调用方需要它向下层或增量备份传达删除
+//
+// 用于在内存紧张时回收快照释放后残留的旧版本，调用方需保证之后不会以小于 horizon 的版本号读取
+func (s *SkipList) DropShadowed(horizon int64) int {
+	removed := 0
+	var prev *Element
+	// covered 当前 key 是否已经保留了一个不超过 horizon 的版本
+	covered := false
+	for curr := s.head.successor(); curr != nil; curr = curr.successor() {
+		if prev == nil || curr.key != prev.key {
+			covered = false
+		}
+		prev = curr
+		if curr.Entry().Version > horizon {
+			continue
+		}
+		if !covered {
+			covered = true
+			continue
+		}
+		if s.remove(curr) {
+			removed++
+		}
+	}
+	return removed
+}
+
+// remove 删除节点 e，返回删除是否由本次调用完成
+func (s *SkipList) remove(e *Element) bool {
+	// 自顶向下标记，第 0 层最后标记：标记成功的调用者负责更新统计与摘除
+	for i := len(e.next) - 1; i > 0; i-- {
+		e.mark(i)
+	}
+	if !e.mark(0) {
+		return false
+	}
+	s.size.Add(-elementSize(e.Entry(), len(e.next)))
+	s.count.Add(-1)
+
+	var buf [2 * spliceStackLevels]*Element
+	preds, succs := s.spliceBuffers(buf[:])
+	s.findSplice(e.key, e, preds, succs)
+	return true
+}
@@ -1,6 +1,10 @@
 package skiplist
 
 import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
 	"testing"
 
 	"github.com/aireet/SimpleDBForge/api/sdbf"
@@ -15,14 +19,14 @@ func TestNewSkipList(t *testing.T) {
 	if sl.maxLevel != 4 {
 		t.Errorf("Expected maxLevel 4, got %d", sl.maxLevel)
 	}
-	if sl.level != 1 {
-		t.Errorf("Expected initial level 1, got %d", sl.level)
+	if sl.level.Load() != 1 {
+		t.Errorf("Expected initial level 1, got %d", sl.level.Load())
 	}
-	if sl.count != 0 {
-		t.Errorf("Expected initial count 0, got %d", sl.count)
+	if sl.count.Load() != 0 {
+		t.Errorf("Expected initial count 0, got %d", sl.count.Load())
 	}
-	if sl.size != 0 {
-		t.Errorf("Expected initial size 0, got %d", sl.size)
+	if sl.size.Load() != 0 {
+		t.Errorf("Expected initial size 0, got %d", sl.size.Load())
 	}
 }
 
@@ -86,8 +90,8 @@ func TestUpdateExistingKey(t *testing.T) {
 	}
 
 	// 验证count没有增加
-	if sl.count != 1 {
-		t.Errorf("Expected count 1 after update, got %d", sl.count)
+	if sl.count.Load() != 1 {
+		t.Errorf("Expected count 1 after update, got %d", sl.count.Load())
 	}
 }
 
@@ -212,7 +216,7 @@ func TestCompareKey(t *testing.T) {
 func TestMemoryTracking(t *testing.T) {
 	sl := NewSkipList(4, 0.5)
 	initialSize := sl.GetSize()
-	initialCount := sl.count
+	initialCount := sl.count.Load()
 
 	// 插入条目
 	entry := &sdbf.Entry{
@@ -222,8 +226,8 @@ func TestMemoryTracking(t *testing.T) {
 	sl.Set(entry)
 
 	// 验证计数器增加
-	if sl.count != initialCount+1 {
-		t.Errorf("Expected count to increase by 1, got %d", sl.count-initialCount)
+	if sl.count.Load() != initialCount+1 {
+		t.Errorf("Expected count to increase by 1, got %d", sl.count.Load()-initialCount)
 	}
 
 	// 验证大小增加
@@ -239,8 +243,8 @@ func TestMemoryTracking(t *testing.T) {
 	}
 	sl.Set(entryUpdated)
 
-	if sl.count != initialCount+1 {
-		t.Errorf("Expected count to remain the same after update, got %d", sl.count)
+	if sl.count.Load() != initialCount+1 {
+		t.Errorf("Expected count to remain the same after update, got %d", sl.count.Load())
 	}
 }
 
@@ -251,18 +255,18 @@ func TestReset(t *testing.T) {
 	entry := sdbf.Entry{Key: "test", Value: []byte("value")}
 	sl.Set(&entry)
 
-	if sl.count != 1 {
-		t.Errorf("Expected count 1 before reset, got %d", sl.count)
+	if sl.count.Load() != 1 {
+		t.Errorf("Expected count 1 before reset, got %d", sl.count.Load())
 	}
 
 	// 重置
 	sl = sl.Reset()
 
-	if sl.count != 0 {
-		t.Errorf("Expected count 0 after reset, got %d", sl.count)
+	if sl.count.Load() != 0 {
+		t.Errorf("Expected count 0 after reset, got %d", sl.count.Load())
 	}
-	if sl.level != 1 {
-		t.Errorf("Expected level 1 after reset, got %d", sl.level)
+	if sl.level.Load() != 1 {
+		t.Errorf("Expected level 1 after reset, got %d", sl.level.Load())
 	}
 }
 
@@ -279,6 +283,34 @@ func BenchmarkSkipListSet(b *testing.B) {
 	}
 }
 
+// BenchmarkSkipListInsertAllocs 只统计跳表自身的分配：条目在计时之前创建好
+func BenchmarkSkipListInsertAllocs(b *testing.B) {
+	benchmarks := []struct {
+		name      string
+		overwrite bool
+	}{
+		{name: "插入新key"},
+		{name: "覆盖已有key", overwrite: true},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			sl := NewSkipList(12, 0.5)
+			entries := make([]*sdbf.Entry, b.N)
+			for i, k := range rand.Perm(b.N) {
+				entries[i] = &sdbf.Entry{Key: fmt.Sprintf("key:%08d", k), Value: []byte("v")}
+				if bm.overwrite {
+					sl.Set(entries[i])
+				}
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for _, e := range entries {
+				sl.Set(e)
+			}
+		})
+	}
+}
+
 func BenchmarkSkipListGet(b *testing.B) {
 	sl := NewSkipList(4, 0.5)
 
@@ -299,26 +331,105 @@ func BenchmarkSkipListGet(b *testing.B) {
 	}
 }
 
+// BenchmarkSkipListParallelGet 并发读取，同时有一个协程持续写入
+func BenchmarkSkipListParallelGet(b *testing.B) {
+	sl := NewSkipList(12, 0.5)
+	for i := 0; i < 10000; i++ {
+		sl.Set(&sdbf.Entry{Key: fmt.Sprintf("key:%05d", i), Value: []byte("v")})
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				sl.Set(&sdbf.Entry{Key: fmt.Sprintf("key:%05d", i%20000), Value: []byte("v")})
+			}
+		}
+	}()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			sl.Get(fmt.Sprintf("key:%05d", i%10000))
+			i++
+		}
+	})
+	b.StopTimer()
+	close(stop)
+	<-done
+}
+
 func TestConcurrentAccess(t *testing.T) {
-	// 注意：当前实现不是线程安全的
-	// 这个测试主要是为了文档化当前的行为
 	sl := NewSkipList(4, 0.5)
 
-	// 快速连续操作
-	for i := 0; i < 100; i++ {
-		entry := &sdbf.Entry{
-			Key:   "key" + string(rune(i)),
-			Value: []byte("value" + string(rune(i))),
-		}
-		sl.Set(entry)
-	}
+	const writers, perWriter = 4, 200
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	// 读协程在写入期间持续读取，配合 -race 检查数据竞争；
+	// 已经读到的 key 之后不应再消失，Scan 结果必须保持有序
+	var readers sync.WaitGroup
+	for r := 0; r < 2; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				all := sl.All()
+				for i := 1; i < len(all); i++ {
+					if utils.CompareKey(all[i-1].Key, all[i].Key) > 0 {
+						t.Errorf("All 结果无序: %s > %s", all[i-1].Key, all[i].Key)
+						return
+					}
+				}
+			}
+		}()
+	}
+
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				key := fmt.Sprintf("key:%d:%03d", w, i)
+				sl.Set(&sdbf.Entry{Key: key, Value: []byte("v1")})
+				// 覆盖写与新插入并发进行
+				sl.Set(&sdbf.Entry{Key: key, Value: []byte("v2")})
+				if e, ok := sl.Get(key); !ok || string(e.Value) != "v2" {
+					t.Errorf("写入后应能读到 %s", key)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	readers.Wait()
 
 	// 验证所有数据都能正确获取
-	for i := 0; i < 100; i++ {
-		key := "key" + string(rune(i))
-		_, found := sl.Get(key)
-		if !found {
-			t.Errorf("Expected to find key %s", key)
+	if got := sl.count.Load(); got != writers*perWriter {
+		t.Fatalf("Expected count %d, got %d", writers*perWriter, got)
+	}
+	all := sl.All()
+	if len(all) != writers*perWriter {
+		t.Fatalf("Expected %d entries, got %d", writers*perWriter, len(all))
+	}
+	for w := 0; w < writers; w++ {
+		for i := 0; i < perWriter; i++ {
+			key := fmt.Sprintf("key:%d:%03d", w, i)
+			if _, found := sl.Get(key); !found {
+				t.Errorf("Expected to find key %s", key)
+			}
 		}
 	}
 }
@@ -354,3 +465,307 @@ func TestEdgeCases(t *testing.T) {
 		t.Error("Expected to find special key")
 	}
 }
+
+func TestSetTombstone(t *testing.T) {
+	tests := []struct {
+		name          string
+		entries       []*sdbf.Entry
+		wantTombstone bool
+		wantVersion   int64
+	}{
+		{
+			name: "覆盖为墓碑",
+			entries: []*sdbf.Entry{
+				{Key: "k", Value: []byte("v1"), Version: 1},
+				{Key: "k", Tombstone: true, Version: 2},
+			},
+			wantTombstone: true,
+			wantVersion:   2,
+		},
+		{
+			name: "墓碑后重新写入",
+			entries: []*sdbf.Entry{
+				{Key: "k", Value: []byte("v1"), Version: 1},
+				{Key: "k", Tombstone: true, Version: 2},
+				{Key: "k", Value: []byte("v3"), Version: 3},
+			},
+			wantTombstone: false,
+			wantVersion:   3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sl := NewSkipList(4, 0.5)
+			var first *sdbf.Entry
+			for i, e := range tt.entries {
+				sl.Set(e)
+				if i == 0 {
+					first, _ = sl.Get("k")
+				}
+			}
+
+			got, found := sl.Get("k")
+			if !found {
+				t.Fatal("Expected to find key 'k'")
+			}
+			if got.Tombstone != tt.wantTombstone {
+				t.Errorf("Expected tombstone %t, got %t", tt.wantTombstone, got.Tombstone)
+			}
+			if got.Version != tt.wantVersion {
+				t.Errorf("Expected version %d, got %d", tt.wantVersion, got.Version)
+			}
+			if sl.count.Load() != 1 {
+				t.Errorf("Expected count 1, got %d", sl.count.Load())
+			}
+			// 之前返回的条目不应被后续写入改写
+			if first.Version != 1 || first.Tombstone {
+				t.Errorf("Expected previously returned entry to stay unchanged, got %+v", first)
+			}
+		})
+	}
+}
+
+func TestInsertAndGetVersion(t *testing.T) {
+	sl := NewSkipList(4, 0.5)
+	sl.Set(&sdbf.Entry{Key: "a", Value: []byte("a1"), Version: 1})
+	sl.Insert(&sdbf.Entry{Key: "k", Value: []byte("v2"), Version: 2})
+	sl.Insert(&sdbf.Entry{Key: "k", Value: []byte("v5"), Version: 5})
+	sl.Insert(&sdbf.Entry{Key: "k", Value: []byte("v9"), Version: 9})
+	sl.Set(&sdbf.Entry{Key: "z", Value: []byte("z1"), Version: 1})
+
+	tests := []struct {
+		name       string
+		maxVersion int64
+		want       string
+		found      bool
+	}{
+		{name: "最新版本", maxVersion: 100, want: "v9", found: true},
+		{name: "恰好等于某个版本", maxVersion: 5, want: "v5", found: true},
+		{name: "位于两个版本之间", maxVersion: 4, want: "v2", found: true},
+		{name: "早于所有版本", maxVersion: 1, found: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := sl.GetVersion("k", tt.maxVersion)
+			if found != tt.found {
+				t.Fatalf("Expected found %t, got %t", tt.found, found)
+			}
+			if found && string(got.Value) != tt.want {
+				t.Errorf("Expected value '%s', got '%s'", tt.want, string(got.Value))
+			}
+		})
+	}
+
+	// Get 返回最新版本，All 按从新到旧返回所有版本
+	if got, _ := sl.Get("k"); string(got.Value) != "v9" {
+		t.Errorf("Expected latest value 'v9', got '%s'", string(got.Value))
+	}
+	var versions []int64
+	for _, e := range sl.All() {
+		if e.Key == "k" {
+			versions = append(versions, e.Version)
+		}
+	}
+	if len(versions) != 3 || versions[0] != 9 || versions[1] != 5 || versions[2] != 2 {
+		t.Errorf("Expected versions [9 5 2], got %v", versions)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tests := []struct {
+		name string
+		// insert 依次用 Insert 写入的 key（同一个 key 多次出现即多个版本）
+		insert  []string
+		del     string
+		removed int
+		want    []string
+	}{
+		{name: "删除中间的key", insert: []string{"a", "b", "c"}, del: "b", removed: 1, want: []string{"a", "c"}},
+		{name: "删除第一个key", insert: []string{"a", "b", "c"}, del: "a", removed: 1, want: []string{"b", "c"}},
+		{name: "删除不存在的key", insert: []string{"a", "c"}, del: "b", removed: 0, want: []string{"a", "c"}},
+		{name: "删除所有版本", insert: []string{"a", "b", "b", "b", "c"}, del: "b", removed: 3, want: []string{"a", "c"}},
+		{name: "删除唯一的key", insert: []string{"a"}, del: "a", removed: 1, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sl := NewSkipList(4, 0.5)
+			for i, key := range tt.insert {
+				sl.Insert(&sdbf.Entry{Key: key, Value: []byte("value"), Version: int64(i + 1)})
+			}
+			if got := sl.Delete(tt.del); got != tt.removed {
+				t.Fatalf("期望删除 %d 个节点, 实际 %d", tt.removed, got)
+			}
+			if _, ok := sl.Get(tt.del); ok {
+				t.Fatalf("删除后仍能读到 %s", tt.del)
+			}
+			var keys []string
+			for _, e := range sl.All() {
+				keys = append(keys, e.Key)
+			}
+			if !slices.Equal(keys, tt.want) {
+				t.Fatalf("期望剩余 %v, 实际 %v", tt.want, keys)
+			}
+			if sl.Len() != len(tt.want) {
+				t.Fatalf("期望节点数 %d, 实际 %d", len(tt.want), sl.Len())
+			}
+			assertLinked(t, sl)
+
+			// 删除所有剩余的 key 后内存统计归零
+			for _, key := range tt.want {
+				sl.Delete(key)
+			}
+			if sl.GetSize() != 0 || sl.Len() != 0 {
+				t.Fatalf("全部删除后期望大小与节点数为 0, 实际 %d, %d", sl.GetSize(), sl.Len())
+			}
+		})
+	}
+}
+
+func TestDropShadowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		horizon int64
+		// want 剩余的 "key@version"
+		want    []string
+		removed int
+	}{
+		{name: "保留所有新版本", horizon: 1, want: []string{"a@7", "a@5", "a@2", "b@4", "c@6", "c@3"}, removed: 0},
+		{name: "丢弃被遮蔽的版本", horizon: 5, want: []string{"a@7", "a@5", "b@4", "c@6", "c@3"}, removed: 1},
+		{name: "只保留最新版本", horizon: 10, want: []string{"a@7", "b@4", "c@6"}, removed: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sl := NewSkipList(4, 0.5)
+			// c@3 与 c@6 中 c@6 是墓碑，墓碑同样作为版本保留
+			for _, e := range []*sdbf.Entry{
+				{Key: "a", Version: 2}, {Key: "c", Version: 3}, {Key: "b", Version: 4},
+				{Key: "a", Version: 5}, {Key: "c", Version: 6, Tombstone: true}, {Key: "a", Version: 7},
+			} {
+				sl.Insert(e)
+			}
+
+			if got := sl.DropShadowed(tt.horizon); got != tt.removed {
+				t.Fatalf("期望删除 %d 个版本, 实际 %d", tt.removed, got)
+			}
+			var got []string
+			for _, e := range sl.All() {
+				got = append(got, fmt.Sprintf("%s@%d", e.Key, e.Version))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("期望剩余 %v, 实际 %v", tt.want, got)
+			}
+			assertLinked(t, sl)
+
+			// horizon 及之后的读取结果不变
+			for _, key := range []string{"a", "b", "c"} {
+				for v := tt.horizon; v <= 8; v++ {
+					e, ok := sl.GetVersion(key, v)
+					want, wantOK := newestVersion(key, v)
+					if ok != wantOK || (ok && e.Version != want) {
+						t.Fatalf("GetVersion(%s, %d): 期望 %d %v, 实际 %v %v", key, v, want, wantOK, e, ok)
+					}
+				}
+			}
+		})
+	}
+}
+
+// newestVersion 返回 TestDropShadowed 中 key 不超过 v 的最新版本
+func newestVersion(key string, v int64) (int64, bool) {
+	versions := map[string][]int64{"a": {7, 5, 2}, "b": {4}, "c": {6, 3}}
+	for _, version := range versions[key] {
+		if version <= v {
+			return version, true
+		}
+	}
+	return 0, false
+}
+
+// 测试删除与插入、覆盖写、读取并发进行
+func TestConcurrentDelete(t *testing.T) {
+	sl := NewSkipList(8, 0.5)
+	const keys = 2000
+	for i := 0; i < keys; i++ {
+		sl.Set(&sdbf.Entry{Key: fmt.Sprintf("key:%04d", i), Value: []byte("v1")})
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			all := sl.All()
+			for i := 1; i < len(all); i++ {
+				if utils.CompareKey(all[i-1].Key, all[i].Key) >= 0 {
+					t.Errorf("All 结果无序或重复: %s, %s", all[i-1].Key, all[i].Key)
+					return
+				}
+			}
+		}
+	}()
+
+	// 删除偶数 key，同时覆盖写奇数 key 并插入新 key
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w * 2; i < keys; i += 8 {
+				sl.Delete(fmt.Sprintf("key:%04d", i))
+				sl.Set(&sdbf.Entry{Key: fmt.Sprintf("key:%04d", i+1), Value: []byte("v2")})
+				sl.Set(&sdbf.Entry{Key: fmt.Sprintf("key:%04d:new", i), Value: []byte("v")})
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("key:%04d", i)
+		e, ok := sl.Get(key)
+		if i%2 == 0 && ok {
+			t.Fatalf("%s 应已被删除", key)
+		}
+		if i%2 == 1 && (!ok || string(e.Value) != "v2") {
+			t.Fatalf("%s 应为 v2, 实际 %v", key, e)
+		}
+		if _, ok := sl.Get(key + ":new"); i%2 == 0 && !ok {
+			t.Fatalf("%s:new 应存在", key)
+		}
+	}
+	if want := keys; sl.Len() != want {
+		t.Fatalf("期望节点数 %d, 实际 %d", want, sl.Len())
+	}
+	assertLinked(t, sl)
+}
+
+// assertLinked 检查每一层都有序，且经过一次搜索后不再链接已删除的节点
+func assertLinked(t *testing.T, sl *SkipList) {
+	t.Helper()
+	preds := make([]*Element, sl.maxLevel)
+	succs := make([]*Element, sl.maxLevel)
+	sl.findSplice("\xff\xff\xff\xff", nil, preds, succs)
+	for i := 0; i < sl.maxLevel; i++ {
+		var prev *Element
+		for curr := sl.head.next[i].Load(); curr != nil; curr = curr.next[i].Load() {
+			if curr.marker || curr.deleted() {
+				t.Fatalf("第 %d 层仍链接着已删除的节点 %s", i, curr.key)
+			}
+			if prev != nil && utils.CompareKey(prev.key, curr.key) > 0 {
+				t.Fatalf("第 %d 层无序: %s > %s", i, prev.key, curr.key)
+			}
+			prev = curr
+		}
+	}
+}